@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"go.uber.org/zap"
+	"k8s.io/client-go/dynamic"
+)
+
+// checkReport prints the outcome of each startup check and remembers whether any failed
+type checkReport struct {
+	out    io.Writer
+	failed bool
+}
+
+func (r *checkReport) ok(name string) {
+	fmt.Fprintf(r.out, "OK:    %s\n", name)
+}
+
+func (r *checkReport) skip(name, reason string) {
+	fmt.Fprintf(r.out, "SKIP:  %s: %s\n", name, reason)
+}
+
+func (r *checkReport) fail(name string, err error) {
+	fmt.Fprintf(r.out, "FAIL:  %s: %v\n", name, err)
+	r.failed = true
+}
+
+// result reports err as a failure of name, or name as passed
+func (r *checkReport) result(name string, err error) {
+	if err != nil {
+		r.fail(name, err)
+	} else {
+		r.ok(name)
+	}
+}
+
+// runCheck is the check subcommand, the same as running the webhook with -check
+func runCheck(args []string, out io.Writer) int {
+	config, err := loadConfig(args, os.Getenv, out)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(out, "FAIL:  configuration: %v\n", err)
+		return 2
+	}
+
+	logger, _, err := initLogger(config)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to initialize logger: %v\n", err)
+		return 1
+	}
+	defer logger.Sync()
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	return runChecks(ctx, config, logger, out)
+}
+
+// runChecks runs the validations the webhook relies on at startup and prints a report, for an
+// init container or a pre-deploy step: the Azure credential, Azure Resource Manager, access to
+// DNSEndpoints, read (and with CheckWrite, write) access to each configured resource group, and
+// the actions the identity's role assignments grant there.
+// It returns 0 when every check passed.
+func runChecks(ctx context.Context, config *Config, logger *zap.Logger, out io.Writer) int {
+	report := &checkReport{out: out}
+	report.ok("configuration")
+
+	var dynamicClient dynamic.Interface
+	client, err := createDynamicClient()
+	switch {
+	case err == nil:
+		dynamicClient = client
+	case config.VanityRecordMode == provider.VanityRecordModeAzureDNS:
+		report.skip("kubernetes API", fmt.Sprintf("no Kubernetes access (%v)", err))
+	default:
+		report.fail("kubernetes API", err)
+	}
+
+	// Creating the provider obtains a token, so it fails when the credential is unusable
+	tmProvider, err := provider.NewTrafficManagerProvider(providerConfig(config), dynamicClient, logger)
+	if err != nil {
+		report.fail("azure credential", err)
+		return 1
+	}
+	report.ok("azure credential")
+	report.result("azure resource manager", tmProvider.CheckReadiness(ctx))
+
+	if dynamicClient != nil {
+		checked, err := tmProvider.CheckDNSEndpointAccess(ctx)
+		if !checked {
+			report.skip("dnsendpoint access", "vanity hostnames are not published as DNSEndpoints")
+		} else {
+			report.result("dnsendpoint access", err)
+		}
+	}
+
+	access := tmProvider.CheckResourceGroupAccess(ctx, config.CheckWrite)
+	if len(access) == 0 {
+		report.skip("resource groups", "none configured")
+	}
+	for _, rg := range access {
+		report.result("resource group "+rg.ResourceGroup+" read", rg.ReadErr)
+		if rg.WriteChecked {
+			report.result("resource group "+rg.ResourceGroup+" write", rg.WriteErr)
+		}
+	}
+	for _, rg := range tmProvider.CheckPermissions(ctx) {
+		var err error
+		if problem := rg.Problem(); problem != "" {
+			err = errors.New(problem)
+		}
+		report.result("resource group "+rg.ResourceGroup+" role", err)
+	}
+
+	if report.failed {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"go.uber.org/zap"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/yaml"
+)
+
+// commands are the one-shot subcommands, for CI pipelines and break-glass operations.
+// Apart from validate, they take the webhook's configuration flags, environment variables
+// and config file, and need Azure access but not a cluster.
+var commands = map[string]func(args []string, out io.Writer) int{
+	"validate": runValidate,
+	"check":    runCheck,
+	"sync":     runSync,
+	"list":     runList,
+	"gc":       runGC,
+	"export":   runExport,
+	"import":   runImport,
+}
+
+// command is a provider set up for a one-shot subcommand
+type command struct {
+	provider *provider.TrafficManagerProvider
+	logger   *zap.Logger
+	cluster  bool // Whether Kubernetes is reachable
+}
+
+// newCommand loads the webhook configuration from args and creates a provider. Without
+// Kubernetes access the provider is created without a Kubernetes client. It returns the
+// exit code to use when it fails.
+func newCommand(args []string, out io.Writer) (*command, int) {
+	config, err := loadConfig(args, os.Getenv, out)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, 0
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Invalid configuration: %v\n", err)
+		return nil, 2
+	}
+
+	logger, _, err := initLogger(config)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to initialize logger: %v\n", err)
+		return nil, 1
+	}
+
+	var dynamicClient dynamic.Interface
+	if client, err := createDynamicClient(); err != nil {
+		logger.Warn("No Kubernetes access, continuing without it", zap.Error(err))
+	} else {
+		dynamicClient = client
+	}
+
+	tmProvider, err := provider.NewTrafficManagerProvider(providerConfig(config), dynamicClient, logger)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to create Traffic Manager provider: %v\n", err)
+		return nil, 1
+	}
+	return &command{provider: tmProvider, logger: logger, cluster: dynamicClient != nil}, 0
+}
+
+// commandContext returns a context cancelled by SIGINT or SIGTERM
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// runSync runs a single records sync, as External DNS triggers it, and prints the records
+func runSync(args []string, out io.Writer) int {
+	cmd, code := newCommand(args, out)
+	if cmd == nil {
+		return code
+	}
+	defer cmd.logger.Sync()
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	records, err := cmd.provider.Records(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "Sync failed: %v\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tNAME\tTARGETS")
+	for _, record := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", record.RecordType, record.DNSName, strings.Join(record.Targets, ","))
+	}
+	w.Flush()
+	fmt.Fprintf(out, "Synced %d records\n", len(records))
+	return 0
+}
+
+// runList syncs the managed profiles and prints them with their endpoints
+func runList(args []string, out io.Writer) int {
+	cmd, code := newCommand(args, out)
+	if cmd == nil {
+		return code
+	}
+	defer cmd.logger.Sync()
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	if _, err := cmd.provider.Records(ctx); err != nil {
+		fmt.Fprintf(out, "Sync failed: %v\n", err)
+		return 1
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "HOSTNAME\tPROFILE\tRESOURCE GROUP\tROUTING\tENDPOINTS")
+	for _, cached := range cmd.provider.CachedProfiles() {
+		profile := cached.Profile
+		names := make([]string, 0, len(profile.Endpoints))
+		for name := range profile.Endpoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		endpoints := make([]string, 0, len(names))
+		for _, name := range names {
+			endpoint := profile.Endpoints[name]
+			endpoints = append(endpoints, fmt.Sprintf("%s(%s/%s)", name, endpoint.Status, endpoint.MonitorStatus))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", cached.Hostname, profile.ProfileName, profile.ResourceGroup,
+			profile.RoutingMethod, strings.Join(endpoints, " "))
+	}
+	w.Flush()
+	return 0
+}
+
+// runGC deletes soft-deleted profiles whose grace period has passed and, with Kubernetes
+// access, DNSEndpoints whose profile no longer exists
+func runGC(args []string, out io.Writer) int {
+	cmd, code := newCommand(args, out)
+	if cmd == nil {
+		return code
+	}
+	defer cmd.logger.Sync()
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	failed := false
+	purged, err := cmd.provider.PurgeDeletedProfiles(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "Failed to purge soft-deleted profiles: %v\n", err)
+		failed = true
+	}
+	fmt.Fprintf(out, "Purged %d soft-deleted profiles\n", purged)
+
+	if cmd.cluster {
+		deleted, err := cmd.provider.GarbageCollectDNSEndpoints(ctx)
+		if err != nil {
+			fmt.Fprintf(out, "Failed to collect DNSEndpoints: %v\n", err)
+			failed = true
+		}
+		fmt.Fprintf(out, "Deleted %d stale DNSEndpoints\n", deleted)
+	} else {
+		fmt.Fprintln(out, "Skipped DNSEndpoints: no Kubernetes access")
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// runExport prints the managed profiles with their endpoints and tags as YAML
+func runExport(args []string, out io.Writer) int {
+	cmd, code := newCommand(args, out)
+	if cmd == nil {
+		return code
+	}
+	defer cmd.logger.Sync()
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	defs, err := cmd.provider.ExportProfiles(ctx)
+	if err != nil {
+		fmt.Fprintf(out, "Export failed: %v\n", err)
+		return 1
+	}
+	data, err := yaml.Marshal(defs)
+	if err != nil {
+		fmt.Fprintf(out, "Export failed: %v\n", err)
+		return 1
+	}
+	out.Write(data)
+	return 0
+}
+
+// runImport creates or updates the profiles exported to the YAML read from stdin
+func runImport(args []string, out io.Writer) int {
+	cmd, code := newCommand(args, out)
+	if cmd == nil {
+		return code
+	}
+	defer cmd.logger.Sync()
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	defs, err := provider.ReadProfileDefinitions(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(out, "Invalid profile definitions: %v\n", err)
+		return 2
+	}
+	result, err := cmd.provider.ImportProfiles(ctx, defs, false)
+	if err != nil {
+		fmt.Fprintf(out, "Import failed: %v\n", err)
+		return 1
+	}
+
+	for _, failure := range result.Errors {
+		fmt.Fprintf(out, "Failed to import %s: %s\n", failure.Hostname, failure.Error)
+	}
+	fmt.Fprintf(out, "Imported %d profiles\n", len(result.Imported))
+	if len(result.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
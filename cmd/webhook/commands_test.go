@@ -0,0 +1,28 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommands_InvalidConfiguration(t *testing.T) {
+	for _, name := range []string{"sync", "list", "gc", "export", "import"} {
+		var out bytes.Buffer
+		assert.Equal(t, 2, commands[name]([]string{"-no-such-flag"}, &out), name)
+		assert.Contains(t, out.String(), "Invalid configuration", name)
+	}
+}
+
+func TestCommands_Help(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, 0, commands["list"]([]string{"-h"}, &out))
+	assert.Contains(t, out.String(), "-resource-groups")
+}
+
+func TestCheck_InvalidConfiguration(t *testing.T) {
+	var out bytes.Buffer
+	assert.Equal(t, 2, commands["check"]([]string{"-check-write", "-no-such-flag"}, &out))
+	assert.Contains(t, out.String(), "FAIL:  configuration")
+}
@@ -0,0 +1,672 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"sigs.k8s.io/yaml"
+)
+
+// configFileEnv names the environment variable that can point at a config file instead of -config
+const configFileEnv = "CONFIG_FILE"
+
+// redacted replaces secret values when the configuration is printed
+const redacted = "<redacted>"
+
+// Config holds the application configuration
+type Config struct {
+	WebhookPort    string
+	HealthPort     string
+	DomainFilter   []string
+	ResourceGroups []string
+	SubscriptionID string
+	Cloud          string
+	AuthMode       string
+	TenantID       string
+	ClientID       string
+	ClientSecret   string
+
+	// "<scope>=<tenant-id>[:<client-id>]" entries giving resource groups or subscriptions their own tenant or identity
+	ScopedCredentials []string
+
+	// Subdomains of DomainFilter the webhook leaves alone
+	DomainFilterExclude []string
+
+	// Azure client user agent, retries, Traffic Manager API version, proxy and write rate limit
+	AzureUserAgent           string
+	AzureMaxRetries          int
+	AzureRetryDelay          time.Duration
+	AzureMaxRetryDelay       time.Duration
+	TrafficManagerAPIVersion string
+	AzureProxyURL            string
+	AzureWriteRateLimit      int
+	AzureWriteBurst          int
+
+	// Credential files mounted from a Kubernetes Secret
+	ClientSecretFile          string
+	ClientCertificateFile     string
+	ClientCertificatePassword string
+	CredentialFilePoll        time.Duration
+
+	LogLevel    string
+	LogLevels   string
+	Environment string
+	ClusterName string
+	Policy      string
+
+	// resource-groups syncs RESOURCE_GROUPS; subscription syncs every resource group
+	ProfileDiscovery string
+
+	// Vanity record publishing
+	VanityRecordMode      string
+	AzureDNSResourceGroup string
+	AzureDNSZones         []string
+
+	// ConfigMap storing External DNS TXT ownership records when the webhook is the only provider
+	TXTRegistryConfigMap string
+
+	// ConfigMap storing resolved endpoint configurations for deletes that arrive without annotations
+	EndpointConfigConfigMap string
+
+	// Create AzureEndpoints for A record addresses that are public IP resources
+	ResolvePublicIPs bool
+
+	// Return the source records of endpoints from Records() alongside the vanity CNAMEs
+	EndpointRecords bool
+
+	// Interval between DNSEndpoint garbage collection passes (0 disables)
+	DNSEndpointGCInterval    time.Duration
+	DNSEndpointRetryInterval time.Duration
+
+	// Interval between checks that enable fallback endpoints when every primary is Degraded (0 disables)
+	FallbackCheckInterval time.Duration
+
+	// Interval between reads of the Traffic View heat maps of enrolled profiles (0 disables)
+	TrafficViewPollInterval time.Duration
+
+	// Interval between checks that step canary weights (0 disables)
+	CanaryCheckInterval time.Duration
+
+	// Interval between checks that enable and disable endpoints on their schedules (0 disables)
+	ScheduleCheckInterval time.Duration
+
+	// Interval between probes of the identity's role on each resource group, the first at startup (0 disables)
+	PermissionCheckInterval time.Duration
+
+	// The webhook's own Pod, from the downward API, which events about the webhook are recorded on
+	PodName      string
+	PodNamespace string
+
+	// Take over existing profiles not created by the webhook
+	AdoptExistingProfiles bool
+
+	// Go templates for generated profile and endpoint names
+	ProfileNameTemplate  string
+	EndpointNameTemplate string
+
+	// Tags marking the profiles this deployment manages
+	ManagedByTag   string
+	ManagedByValue string
+	HostnameTag    string
+
+	// fail, hash or sequence when a generated profile name is taken under trafficmanager.net
+	ProfileNameCollision string
+
+	// retry, rollback or resume when one endpoint of a create fails
+	CreateFailureMode string
+
+	// Empty profiles are disabled and purged after the grace period (0 deletes them at once)
+	ProfileDeleteGracePeriod time.Duration
+	ProfilePurgeInterval     time.Duration
+
+	// Interval between checks that disable endpoints whose Service has no ready endpoints (0 disables)
+	ServiceReadinessCheckInterval time.Duration
+
+	// Deleted endpoints are taken out of rotation and removed after their profile's DNS TTL times the multiple
+	EndpointDrain              string
+	EndpointDrainTTLMultiple   int
+	EndpointDrainCheckInterval time.Duration
+
+	// Weight change guardrails
+	MaxWeightChangePercent int
+	WeightChangeAction     string
+
+	// Change freeze windows
+	FreezeWindows   string
+	FreezeTimezone  string
+	HostnameMapping []string
+	DebugEndpoints  bool
+
+	// Bearer token for the admin API on the health port, set directly or read from a mounted secret; empty disables it
+	AdminToken     string
+	AdminTokenFile string
+
+	// Token webhook API requests must carry, set directly or read from a mounted secret; empty disables it
+	WebhookToken      string
+	WebhookTokenFile  string
+	WebhookAuthHeader string
+
+	// Key Event Grid deliveries to /eventgrid on the health port must carry; empty disables it
+	EventGridKey string
+
+	// State cache size and lifetime; stale profiles are served while they are refreshed
+	StateCacheMaxProfiles int
+	StateCacheTTL         time.Duration
+	StateCacheStaleTTL    time.Duration
+
+	// Subscriptions and resource groups annotations may reference
+	AllowedSubscriptions    []string
+	AllowedResourceGroups   []string
+	NamespaceResourceGroups []string
+
+	// Profiles and endpoints each namespace may create
+	MaxProfilesPerNamespace  int
+	MaxEndpointsPerNamespace int
+	NamespaceProfileQuotas   []string
+	NamespaceEndpointQuotas  []string
+
+	// Defaults for settings annotations leave out; reloadable with the domain filter
+	DefaultResourceGroup    string
+	DefaultRoutingMethod    string
+	DefaultMonitorProtocol  string
+	DefaultMonitorPort      int
+	DefaultMonitorPath      string
+	DefaultEndpointLocation string
+	DefaultTags             string // "key=value,key=value"
+
+	// ConfigMap in each source namespace overriding the defaults above
+	NamespaceDefaultsConfigMap string
+
+	// Fall back to the cluster's Azure region when no endpoint location is set
+	DetectEndpointLocation bool
+
+	ConfigReloadInterval time.Duration
+	SilenceDuration      time.Duration
+
+	// Webhook and health server listeners, configured separately
+	WebhookHost         string
+	HealthHost          string
+	WebhookWriteTimeout time.Duration
+	HealthWriteTimeout  time.Duration
+	ReusePort           bool
+
+	// Limits on webhook API requests, so a malformed or oversized body can't exhaust memory
+	// and a looping External DNS can't flood Azure with writes
+	MaxRequestBytes       int
+	StrictRequestDecoding bool
+	RequestTimeout        time.Duration
+	ApplyRateLimit        int
+	ApplyBurst            int
+
+	// Zero-downtime restarts: how long to drain before shutting down, and how long shutdown may take
+	DrainDelay      time.Duration
+	ShutdownTimeout time.Duration
+
+	// Run the startup checks, print a report and exit, optionally proving write access per resource group
+	Check      bool
+	CheckWrite bool
+
+	configFile string
+	flags      *flag.FlagSet
+	options    []configOption
+}
+
+// configOption is a setting that can come from a flag, the config file or environment variables.
+// The flag name doubles as the config file key.
+type configOption struct {
+	name   string
+	env    []string // Checked in order; the first non-empty variable wins
+	secret bool
+}
+
+// loadConfig builds the configuration from defaults, a YAML config file, environment variables
+// and command line flags, in increasing order of precedence, and validates the result
+func loadConfig(args []string, getenv func(string) string, output io.Writer) (*Config, error) {
+	config := &Config{}
+	flags := flag.NewFlagSet("webhook", flag.ContinueOnError)
+	flags.SetOutput(output)
+	configFile := flags.String("config", "", fmt.Sprintf("Path to a YAML config file [$%s]", configFileEnv))
+	config.bind(flags)
+
+	// Parse once to find the config file; flags are parsed again last so they win
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", flags.Args())
+	}
+
+	config.configFile = *configFile
+	if config.configFile == "" {
+		config.configFile = getenv(configFileEnv)
+	}
+	if config.configFile != "" {
+		if err := config.applyFile(config.configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.applyEnv(getenv); err != nil {
+		return nil, err
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// bind registers a flag, with its default, for every setting
+func (c *Config) bind(flags *flag.FlagSet) {
+	b := &configBinder{flags: flags}
+
+	b.string(&c.WebhookPort, "webhook-port", "8888", "Port for the External DNS webhook API")
+	b.string(&c.HealthPort, "health-port", "8080", "Port for health and metrics endpoints")
+	b.string(&c.WebhookHost, "webhook-host", "0.0.0.0", "Address the webhook API listens on")
+	b.string(&c.HealthHost, "health-host", "0.0.0.0", "Address the health and metrics endpoints listen on")
+	b.duration(&c.WebhookWriteTimeout, "webhook-write-timeout", 15*time.Second, "Maximum time to write a webhook API response")
+	b.duration(&c.HealthWriteTimeout, "health-write-timeout", 15*time.Second, "Maximum time to write a health port response")
+	b.int(&c.MaxRequestBytes, "webhook-max-request-bytes", provider.DefaultMaxRequestBytes, "Largest webhook API request body accepted, in bytes (0 is unlimited)")
+	b.bool(&c.StrictRequestDecoding, "webhook-strict-decoding", false, "Reject webhook API requests with fields the webhook doesn't recognise")
+	b.duration(&c.RequestTimeout, "webhook-request-timeout", 0, "Maximum time a webhook API request may run (0 uses webhook-write-timeout)")
+	b.int(&c.ApplyRateLimit, "webhook-apply-rate-limit", 0, "POST /records requests accepted a minute on average (0 is unlimited)")
+	b.int(&c.ApplyBurst, "webhook-apply-burst", 5, "POST /records requests accepted at once before webhook-apply-rate-limit applies")
+	b.bool(&c.ReusePort, "reuse-port", false, "Open listeners with SO_REUSEPORT so a replacement process can bind the ports before this one exits")
+	b.duration(&c.DrainDelay, "drain-delay", 0, "How long to keep serving after draining starts, so External DNS moves to another instance")
+	b.duration(&c.ShutdownTimeout, "shutdown-timeout", 10*time.Second, "Maximum time to wait for in-flight requests on shutdown")
+	b.strings(&c.DomainFilter, "domain-filter", nil, "Comma-separated domains the webhook will manage")
+	b.strings(&c.DomainFilterExclude, "domain-filter-exclude", nil, "Comma-separated subdomains of domain-filter the webhook will not manage")
+	b.strings(&c.ResourceGroups, "resource-groups", nil, "Comma-separated resource groups to sync existing profiles from")
+	b.string(&c.ProfileDiscovery, "profile-discovery", provider.ProfileDiscoveryResourceGroups, "Where existing profiles are synced from: resource-groups, or subscription for every resource group in the subscription")
+	b.string(&c.SubscriptionID, "azure-subscription-id", "", "Subscription containing the Traffic Manager profiles (required)")
+	b.string(&c.Cloud, "azure-environment", "", "Azure cloud to use", "AZURE_CLOUD")
+	b.string(&c.AuthMode, "azure-auth-mode", trafficmanager.AuthModeDefault, "How to authenticate to Azure")
+	b.string(&c.TenantID, "azure-tenant-id", "", "Tenant of the app registration")
+	b.string(&c.ClientID, "azure-client-id", "", "Client ID of the identity to use")
+	b.secret(&c.ClientSecret, "azure-client-secret", "App registration secret")
+	b.strings(&c.ScopedCredentials, "azure-scoped-credentials", nil, "Comma-separated <scope>=<tenant-id>[:<client-id>] entries authenticating to a resource group (<resource-group> or <subscription-id>/<resource-group>) or subscription (<subscription-id>/*) as another tenant or identity, e.g. for Azure Lighthouse")
+	b.string(&c.AzureUserAgent, "azure-user-agent", "", fmt.Sprintf("Prefix of the User-Agent sent to Azure, up to %d characters, so Azure support can trace the webhook's requests", trafficmanager.MaxUserAgentLength))
+	b.int(&c.AzureMaxRetries, "azure-max-retries", 3, "Retries of a failed Azure request (0 disables retries)")
+	b.duration(&c.AzureRetryDelay, "azure-retry-delay", 800*time.Millisecond, "Delay before the first retry of a failed Azure request, doubling with each retry")
+	b.duration(&c.AzureMaxRetryDelay, "azure-max-retry-delay", 60*time.Second, "Longest delay between retries of a failed Azure request")
+	b.string(&c.TrafficManagerAPIVersion, "trafficmanager-api-version", "", "Traffic Manager API version to call (empty uses the version the webhook was built with)")
+	b.string(&c.AzureProxyURL, "azure-proxy-url", "", "HTTP proxy for requests to Azure (empty uses HTTPS_PROXY and NO_PROXY)")
+	b.int(&c.AzureWriteRateLimit, "azure-write-rate-limit", 0, "Azure write requests sent a minute on average (0 is unlimited)")
+	b.int(&c.AzureWriteBurst, "azure-write-burst", 10, "Azure write requests sent at once before azure-write-rate-limit applies")
+
+	b.string(&c.ClientSecretFile, "azure-client-secret-file", "", "Path to a file containing the client secret")
+	b.string(&c.ClientCertificateFile, "azure-client-certificate-path", "", "Path to a PEM or PKCS#12 client certificate")
+	b.secret(&c.ClientCertificatePassword, "azure-client-certificate-password", "Password for the certificate file")
+	b.duration(&c.CredentialFilePoll, "credential-file-poll-interval", 30*time.Second, "How often credential files are checked for changes (0 disables)")
+
+	b.string(&c.LogLevel, "log-level", "info", "Log level: debug, info, warn, error")
+	b.string(&c.LogLevels, "log-levels", "", "Per-subsystem log level overrides, e.g. trafficmanager=debug,webhook=warn")
+	b.string(&c.Environment, "environment", "", "Set to production for JSON logs")
+	b.string(&c.ClusterName, "cluster-name", "", "Name of this cluster, recorded in endpoint metadata")
+	b.string(&c.Policy, "policy", provider.PolicySync, "sync or upsert-only")
+
+	b.string(&c.VanityRecordMode, "vanity-record-mode", provider.VanityRecordModeDNSEndpoint, "How vanity hostname records are published: dnsendpoint or azure-dns")
+	b.string(&c.AzureDNSResourceGroup, "azure-dns-resource-group", "", "Resource group containing the Azure DNS zones")
+	b.strings(&c.AzureDNSZones, "azure-dns-zones", nil, "Comma-separated Azure DNS zones vanity hostnames are written to")
+	b.string(&c.TXTRegistryConfigMap, "txt-registry-configmap", "", "ConfigMap, as <namespace>/<name> or <name> in default, storing External DNS TXT ownership records (empty skips TXT records)")
+	b.string(&c.EndpointConfigConfigMap, "endpoint-config-configmap", "", "ConfigMap, as <namespace>/<name> or <name> in default, storing endpoint configurations for deletes without annotations (empty keeps them in memory)")
+	b.bool(&c.ResolvePublicIPs, "resolve-public-ips", false, "Create AzureEndpoints referencing the public IP resources of A record addresses, so their location comes from Azure")
+	b.bool(&c.EndpointRecords, "endpoint-records", false, "Also return the source record of each Traffic Manager endpoint from Records(), so External DNS plans show endpoint membership and recreate endpoints removed in Azure")
+
+	b.duration(&c.DNSEndpointGCInterval, "dnsendpoint-gc-interval", 10*time.Minute, "How often orphaned DNSEndpoints are deleted (0 disables)")
+	b.duration(&c.DNSEndpointRetryInterval, "dnsendpoint-retry-interval", 5*time.Second, "How often failed DNSEndpoint writes are checked for retry (0 disables)")
+	b.duration(&c.FallbackCheckInterval, "fallback-check-interval", 30*time.Second, "How often endpoint monitor status is checked to switch fallback endpoints (0 disables)")
+	b.duration(&c.TrafficViewPollInterval, "traffic-view-poll-interval", time.Hour, "How often the Traffic View heat maps of enrolled profiles are read (0 disables)")
+	b.duration(&c.CanaryCheckInterval, "canary-check-interval", 30*time.Second, "How often canaries are checked to step their weight (0 disables)")
+	b.duration(&c.ScheduleCheckInterval, "schedule-check-interval", time.Minute, "How often endpoint schedules are checked to enable or disable endpoints (0 disables)")
+	b.duration(&c.PermissionCheckInterval, "permission-check-interval", time.Hour, "How often the identity's permissions on each resource group are checked for a missing Traffic Manager Contributor role, starting at startup (0 disables)")
+	b.string(&c.PodName, "pod-name", "", "Name of the webhook's Pod, from the downward API, for events about the webhook such as missing permissions")
+	b.string(&c.PodNamespace, "pod-namespace", "", "Namespace of the webhook's Pod, from the downward API")
+
+	b.bool(&c.AdoptExistingProfiles, "adopt-existing-profiles", false, "Take over existing profiles not created by the webhook, as if every endpoint had the adopt annotation")
+	b.string(&c.ManagedByTag, "managed-by-tag", trafficmanager.DefaultManagedByTag, "Tag key marking profiles managed by this deployment")
+	b.string(&c.ManagedByValue, "managed-by-value", trafficmanager.DefaultManagedByValue, "Tag value marking profiles managed by this deployment; give each deployment sharing a subscription its own")
+	b.string(&c.HostnameTag, "hostname-tag", trafficmanager.DefaultHostnameTag, "Tag key recording the vanity hostname of a profile")
+	b.string(&c.ProfileNameTemplate, "profile-name-template", provider.DefaultProfileNameTemplate, "Go template for generated profile names, referencing .Hostname, .Namespace, .Cluster and .Target")
+	b.string(&c.EndpointNameTemplate, "endpoint-name-template", provider.DefaultEndpointNameTemplate, "Go template for generated endpoint names, referencing .Hostname, .Namespace, .Cluster, .Target and .SetIdentifier")
+	b.string(&c.ProfileNameCollision, "profile-name-collision", provider.ProfileNameCollisionFail, "fail, hash or sequence when a generated profile name is already taken under trafficmanager.net")
+	b.string(&c.CreateFailureMode, "create-failure-mode", provider.CreateFailureRetry, "What happens to the profile and endpoints a create wrote when one of its endpoints fails: retry, rollback or resume")
+	b.duration(&c.ProfileDeleteGracePeriod, "profile-delete-grace-period", 0, "How long an empty profile is kept disabled before it is deleted (0 deletes at once)")
+	b.duration(&c.ProfilePurgeInterval, "profile-purge-interval", 10*time.Minute, "How often soft-deleted profiles past their grace period are purged (0 disables)")
+	b.duration(&c.ServiceReadinessCheckInterval, "service-readiness-check-interval", 0, "How often the Services behind endpoints are checked to disable endpoints with no ready pods (0 disables)")
+
+	b.string(&c.EndpointDrain, "endpoint-drain", provider.EndpointDrainNone, "How endpoints are taken out of rotation before deletion: none, weight or disable")
+	b.int(&c.EndpointDrainTTLMultiple, "endpoint-drain-ttl-multiple", 2, "Multiple of the profile's DNS TTL a drained endpoint is kept before deletion")
+	b.duration(&c.EndpointDrainCheckInterval, "endpoint-drain-check-interval", 10*time.Second, "How often drained endpoints are checked for deletion (0 disables)")
+
+	b.int(&c.MaxWeightChangePercent, "max-weight-change-percent", 0, "Maximum weight change in one apply, as a percentage (0 disables)")
+	b.string(&c.WeightChangeAction, "weight-change-action", provider.WeightChangeActionClamp, "clamp or reject larger weight changes")
+
+	b.string(&c.FreezeWindows, "freeze-windows", "", "Comma-separated weekly windows during which changes are deferred")
+	b.string(&c.FreezeTimezone, "freeze-timezone", "UTC", "IANA time zone the freeze windows are defined in")
+	b.strings(&c.HostnameMapping, "hostname-mapping", []string{provider.HostnameMappingTag}, "Comma-separated hostname mapping strategies, tried in order")
+	b.bool(&c.DebugEndpoints, "debug-endpoints", false, "Serve /debug/pprof/ and /debug/state on the health port")
+	b.secret(&c.AdminToken, "admin-token", "Bearer token required by the admin API on the health port (empty disables the API)")
+	b.string(&c.AdminTokenFile, "admin-token-file", "", "Path to a file containing the admin token; takes precedence over admin-token")
+	b.secret(&c.WebhookToken, "webhook-token", "Token webhook API requests must carry (empty disables webhook authentication)")
+	b.string(&c.WebhookTokenFile, "webhook-token-file", "", "Path to a file containing the webhook token; takes precedence over webhook-token")
+	b.string(&c.WebhookAuthHeader, "webhook-auth-header", provider.DefaultWebhookAuthHeader, "Header carrying the webhook token; Authorization expects a bearer token, any other header the token itself")
+	b.duration(&c.StateCacheTTL, "state-cache-ttl", 5*time.Minute, "How long cached profiles are used before they are read from Azure again")
+	b.duration(&c.StateCacheStaleTTL, "state-cache-stale-ttl", 0, "How long past state-cache-ttl an expired profile is still used while it is refreshed in the background (0 disables)")
+	b.int(&c.StateCacheMaxProfiles, "state-cache-max-profiles", 0, "Profiles kept in the state cache before the least recently used are evicted (0 is unbounded)")
+	b.secret(&c.EventGridKey, "event-grid-key", "Key Event Grid deliveries to /eventgrid on the health port must pass as the key query parameter (empty disables the endpoint)")
+
+	b.strings(&c.AllowedSubscriptions, "allowed-subscriptions", nil, "Comma-separated subscriptions annotations may reference besides the default one (empty allows any)")
+	b.strings(&c.AllowedResourceGroups, "allowed-resource-groups", nil, "Comma-separated resource groups annotations may reference, as <resource-group> or <subscription-id>/<resource-group> (empty allows any)")
+	b.strings(&c.NamespaceResourceGroups, "namespace-resource-groups", nil, "Comma-separated <namespace>=<resource-group> entries limiting a namespace to those resource groups")
+
+	b.int(&c.MaxProfilesPerNamespace, "max-profiles-per-namespace", 0, "Maximum Traffic Manager profiles a namespace may have endpoints in (0 is unlimited)")
+	b.int(&c.MaxEndpointsPerNamespace, "max-endpoints-per-namespace", 0, "Maximum Traffic Manager endpoints a namespace may own (0 is unlimited)")
+	b.strings(&c.NamespaceProfileQuotas, "namespace-profile-quotas", nil, "Comma-separated <namespace>=<limit> entries overriding max-profiles-per-namespace")
+	b.strings(&c.NamespaceEndpointQuotas, "namespace-endpoint-quotas", nil, "Comma-separated <namespace>=<limit> entries overriding max-endpoints-per-namespace")
+
+	b.string(&c.DefaultResourceGroup, "default-resource-group", "", "Resource group for profiles whose annotations don't set one")
+	b.string(&c.DefaultRoutingMethod, "default-routing-method", "", "Routing method for profiles whose annotations don't set one")
+	b.string(&c.DefaultMonitorProtocol, "default-monitor-protocol", "", "Monitor protocol for profiles whose annotations don't set one")
+	b.int(&c.DefaultMonitorPort, "default-monitor-port", 0, "Monitor port for profiles whose annotations don't set one")
+	b.string(&c.DefaultMonitorPath, "default-monitor-path", "", "Monitor path for profiles whose annotations don't set one")
+	b.string(&c.DefaultEndpointLocation, "default-endpoint-location", "", "Endpoint location for endpoints whose annotations don't set one")
+	b.bool(&c.DetectEndpointLocation, "detect-endpoint-location", true, "Use the cluster's Azure region, from node labels or instance metadata, as the endpoint location when annotations and defaults don't set one")
+	b.string(&c.DefaultTags, "default-tags", "", "Azure tags added to every profile, as key=value,key=value; the tags annotation overrides them key by key")
+	b.string(&c.NamespaceDefaultsConfigMap, "namespace-defaults-configmap", "", "Name of a ConfigMap in each source namespace that overrides the defaults for that namespace")
+	b.duration(&c.SilenceDuration, "silence-duration", 0, "How long intentional deletes and disables are silenced for alerting (0 disables)")
+	b.duration(&c.ConfigReloadInterval, "config-reload-interval", 10*time.Second, "How often the config file is checked for changes (0 disables; SIGHUP always reloads)")
+
+	b.bool(&c.Check, "check", false, "Check the configuration, Azure credential and permissions, print a report and exit instead of serving")
+	b.bool(&c.CheckWrite, "check-write", false, "With check, also create and delete a disabled profile in each resource group to prove write access")
+
+	c.flags = flags
+	c.options = b.options
+}
+
+// applyFile sets values from a YAML config file keyed by flag name
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, ok := c.option(key); !ok {
+			return fmt.Errorf("unknown setting %q in config file %s", key, path)
+		}
+		value, err := fileValue(values[key])
+		if err != nil {
+			return fmt.Errorf("invalid value for %s in config file %s: %w", key, path, err)
+		}
+		if err := c.flags.Set(key, value); err != nil {
+			return fmt.Errorf("invalid value for %s in config file %s: %w", key, path, err)
+		}
+	}
+	return nil
+}
+
+// applyEnv sets values from environment variables
+func (c *Config) applyEnv(getenv func(string) string) error {
+	for _, option := range c.options {
+		for _, env := range option.env {
+			value := getenv(env)
+			if value == "" {
+				continue
+			}
+			if err := c.flags.Set(option.name, value); err != nil {
+				return fmt.Errorf("invalid value %q for %s: %w", value, env, err)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// validate checks settings that the provider doesn't validate itself
+func (c *Config) validate() error {
+	var errs []error
+	if c.SubscriptionID == "" {
+		errs = append(errs, errors.New("azure-subscription-id (AZURE_SUBSCRIPTION_ID) is required"))
+	}
+	for name, port := range map[string]string{"webhook-port": c.WebhookPort, "health-port": c.HealthPort} {
+		if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be a port number, got %q", name, port))
+		}
+	}
+	if c.WebhookPort == c.HealthPort {
+		errs = append(errs, fmt.Errorf("webhook-port and health-port must differ, both are %s", c.WebhookPort))
+	}
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log-level %q", c.LogLevel))
+	}
+	if c.MaxWeightChangePercent < 0 || c.MaxWeightChangePercent > 100 {
+		errs = append(errs, fmt.Errorf("max-weight-change-percent must be between 0 and 100, got %d", c.MaxWeightChangePercent))
+	}
+	if _, err := annotations.ParseTags(c.DefaultTags); err != nil {
+		errs = append(errs, fmt.Errorf("invalid default-tags: %w", err))
+	}
+	if c.AzureMaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("azure-max-retries must not be negative, got %d", c.AzureMaxRetries))
+	}
+	if err := c.clientOptions().Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if c.StateCacheMaxProfiles < 0 {
+		errs = append(errs, fmt.Errorf("state-cache-max-profiles must not be negative, got %d", c.StateCacheMaxProfiles))
+	}
+	if c.WebhookAuthHeader == "" || strings.ContainsAny(c.WebhookAuthHeader, " \t:") {
+		errs = append(errs, fmt.Errorf("webhook-auth-header must be a header name, got %q", c.WebhookAuthHeader))
+	}
+	if c.MaxRequestBytes < 0 {
+		errs = append(errs, fmt.Errorf("webhook-max-request-bytes must not be negative, got %d", c.MaxRequestBytes))
+	}
+	for name, limit := range map[string]int{
+		"webhook-apply-rate-limit": c.ApplyRateLimit,
+		"azure-write-rate-limit":   c.AzureWriteRateLimit,
+	} {
+		if limit < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", name, limit))
+		}
+	}
+	for name, burst := range map[string]int{
+		"webhook-apply-burst": c.ApplyBurst,
+		"azure-write-burst":   c.AzureWriteBurst,
+	} {
+		if burst < 1 {
+			errs = append(errs, fmt.Errorf("%s must be at least 1, got %d", name, burst))
+		}
+	}
+	if c.EndpointDrainTTLMultiple < 1 {
+		errs = append(errs, fmt.Errorf("endpoint-drain-ttl-multiple must be at least 1, got %d", c.EndpointDrainTTLMultiple))
+	}
+	for name, interval := range map[string]time.Duration{
+		"credential-file-poll-interval":    c.CredentialFilePoll,
+		"dnsendpoint-gc-interval":          c.DNSEndpointGCInterval,
+		"dnsendpoint-retry-interval":       c.DNSEndpointRetryInterval,
+		"fallback-check-interval":          c.FallbackCheckInterval,
+		"traffic-view-poll-interval":       c.TrafficViewPollInterval,
+		"canary-check-interval":            c.CanaryCheckInterval,
+		"schedule-check-interval":          c.ScheduleCheckInterval,
+		"permission-check-interval":        c.PermissionCheckInterval,
+		"endpoint-drain-check-interval":    c.EndpointDrainCheckInterval,
+		"service-readiness-check-interval": c.ServiceReadinessCheckInterval,
+		"profile-delete-grace-period":      c.ProfileDeleteGracePeriod,
+		"profile-purge-interval":           c.ProfilePurgeInterval,
+		"state-cache-ttl":                  c.StateCacheTTL,
+		"azure-retry-delay":                c.AzureRetryDelay,
+		"azure-max-retry-delay":            c.AzureMaxRetryDelay,
+		"state-cache-stale-ttl":            c.StateCacheStaleTTL,
+		"config-reload-interval":           c.ConfigReloadInterval,
+		"silence-duration":                 c.SilenceDuration,
+		"webhook-write-timeout":            c.WebhookWriteTimeout,
+		"health-write-timeout":             c.HealthWriteTimeout,
+		"webhook-request-timeout":          c.RequestTimeout,
+		"drain-delay":                      c.DrainDelay,
+		"shutdown-timeout":                 c.ShutdownTimeout,
+	} {
+		if interval < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", name, interval))
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// clientOptions returns the options of the webhook's Azure clients; the provider fills in the cloud
+func (c *Config) clientOptions() trafficmanager.ClientOptions {
+	// The SDK reads 0 retries as its default and a negative count as none
+	maxRetries := int32(c.AzureMaxRetries)
+	if maxRetries == 0 {
+		maxRetries = -1
+	}
+	return trafficmanager.ClientOptions{
+		UserAgent:     c.AzureUserAgent,
+		MaxRetries:    maxRetries,
+		RetryDelay:    c.AzureRetryDelay,
+		MaxRetryDelay: c.AzureMaxRetryDelay,
+		APIVersion:    c.TrafficManagerAPIVersion,
+		ProxyURL:      c.AzureProxyURL,
+		WriteLimiter:  trafficmanager.NewWriteLimiter(c.AzureWriteRateLimit, c.AzureWriteBurst),
+	}
+}
+
+// Fields returns the effective configuration as log fields, with secrets redacted
+func (c *Config) Fields() []zap.Field {
+	fields := make([]zap.Field, 0, len(c.options))
+	for _, option := range c.options {
+		value := c.flags.Lookup(option.name).Value.String()
+		if option.secret && value != "" {
+			value = redacted
+		}
+		fields = append(fields, zap.String(option.name, value))
+	}
+	return fields
+}
+
+func (c *Config) option(name string) (configOption, bool) {
+	for _, option := range c.options {
+		if option.name == name {
+			return option, true
+		}
+	}
+	return configOption{}, false
+}
+
+// fileValue converts a YAML value to the string form its flag accepts
+func fileValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return "", fmt.Errorf("list items must be strings, got %v", item)
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", v)
+	}
+}
+
+// configBinder registers flags and records how each maps to environment variables
+type configBinder struct {
+	flags   *flag.FlagSet
+	options []configOption
+}
+
+// add records an option; its primary environment variable is the flag name in upper snake case
+func (b *configBinder) add(name string, secret bool, aliases []string) string {
+	env := append([]string{strings.ToUpper(strings.ReplaceAll(name, "-", "_"))}, aliases...)
+	b.options = append(b.options, configOption{name: name, env: env, secret: secret})
+
+	vars := make([]string, len(env))
+	for i, e := range env {
+		vars[i] = "$" + e
+	}
+	return " [" + strings.Join(vars, ", ") + "]"
+}
+
+func (b *configBinder) string(p *string, name, value, usage string, aliases ...string) {
+	b.flags.StringVar(p, name, value, usage+b.add(name, false, aliases))
+}
+
+func (b *configBinder) secret(p *string, name, usage string) {
+	b.flags.StringVar(p, name, "", usage+b.add(name, true, nil))
+}
+
+func (b *configBinder) strings(p *[]string, name string, value []string, usage string) {
+	*p = value
+	b.flags.Var((*stringSliceValue)(p), name, usage+b.add(name, false, nil))
+}
+
+func (b *configBinder) duration(p *time.Duration, name string, value time.Duration, usage string) {
+	b.flags.DurationVar(p, name, value, usage+b.add(name, false, nil))
+}
+
+func (b *configBinder) int(p *int, name string, value int, usage string) {
+	b.flags.IntVar(p, name, value, usage+b.add(name, false, nil))
+}
+
+func (b *configBinder) bool(p *bool, name string, value bool, usage string) {
+	b.flags.BoolVar(p, name, value, usage+b.add(name, false, nil))
+}
+
+// stringSliceValue is a comma-separated list flag; each Set replaces the previous value
+type stringSliceValue []string
+
+func (s *stringSliceValue) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSliceValue) Set(value string) error {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*s = items
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envFunc(env map[string]string) func(string) string {
+	return func(key string) string { return env[key] }
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	config, err := loadConfig(nil, envFunc(map[string]string{"AZURE_SUBSCRIPTION_ID": "sub"}), io.Discard)
+	require.NoError(t, err)
+
+	assert.Equal(t, "sub", config.SubscriptionID)
+	assert.Equal(t, "8888", config.WebhookPort)
+	assert.Equal(t, "8080", config.HealthPort)
+	assert.Equal(t, "0.0.0.0", config.WebhookHost)
+	assert.Equal(t, 10*time.Second, config.ShutdownTimeout)
+	assert.Zero(t, config.DrainDelay)
+	assert.Equal(t, 10<<20, config.MaxRequestBytes)
+	assert.False(t, config.StrictRequestDecoding)
+	assert.Equal(t, 10*time.Minute, config.DNSEndpointGCInterval)
+	assert.Equal(t, []string{"tag"}, config.HostnameMapping)
+	assert.Empty(t, config.DomainFilter)
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := writeConfigFile(t, `
+azure-subscription-id: file-sub
+webhook-port: 9000
+health-port: "9001"
+domain-filter:
+  - example.com
+  - example.org
+debug-endpoints: true
+dnsendpoint-gc-interval: 1m
+`)
+	env := map[string]string{
+		"CONFIG_FILE":           path,
+		"AZURE_SUBSCRIPTION_ID": "env-sub",
+		"HEALTH_PORT":           "9100",
+	}
+
+	config, err := loadConfig([]string{"--health-port=9200"}, envFunc(env), io.Discard)
+	require.NoError(t, err)
+
+	assert.Equal(t, "env-sub", config.SubscriptionID, "env overrides file")
+	assert.Equal(t, "9000", config.WebhookPort, "file overrides default")
+	assert.Equal(t, "9200", config.HealthPort, "flag overrides env")
+	assert.Equal(t, []string{"example.com", "example.org"}, config.DomainFilter)
+	assert.True(t, config.DebugEndpoints)
+	assert.Equal(t, time.Minute, config.DNSEndpointGCInterval)
+}
+
+func TestLoadConfig_ConfigFlag(t *testing.T) {
+	path := writeConfigFile(t, "azure-subscription-id: file-sub\n")
+
+	config, err := loadConfig([]string{"-config", path}, envFunc(nil), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "file-sub", config.SubscriptionID)
+}
+
+func TestLoadConfig_EnvAlias(t *testing.T) {
+	env := map[string]string{"AZURE_SUBSCRIPTION_ID": "sub", "AZURE_CLOUD": "AzureChinaCloud"}
+
+	config, err := loadConfig(nil, envFunc(env), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "AzureChinaCloud", config.Cloud)
+
+	env["AZURE_ENVIRONMENT"] = "AzureUSGovernmentCloud"
+	config, err = loadConfig(nil, envFunc(env), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "AzureUSGovernmentCloud", config.Cloud)
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		file    string
+		wantErr string
+	}{
+		{
+			name:    "missing subscription",
+			wantErr: "azure-subscription-id (AZURE_SUBSCRIPTION_ID) is required",
+		},
+		{
+			name:    "invalid duration in env",
+			env:     map[string]string{"DNSENDPOINT_GC_INTERVAL": "soon"},
+			wantErr: `invalid value "soon" for DNSENDPOINT_GC_INTERVAL`,
+		},
+		{
+			name:    "invalid port",
+			args:    []string{"--webhook-port=http"},
+			wantErr: `webhook-port must be a port number, got "http"`,
+		},
+		{
+			name:    "same ports",
+			args:    []string{"--webhook-port=8080"},
+			wantErr: "webhook-port and health-port must differ",
+		},
+		{
+			name:    "weight change percent out of range",
+			args:    []string{"--max-weight-change-percent=150"},
+			wantErr: "max-weight-change-percent must be between 0 and 100",
+		},
+		{
+			name:    "invalid log level",
+			env:     map[string]string{"LOG_LEVEL": "loud"},
+			wantErr: `invalid log-level "loud"`,
+		},
+		{
+			name:    "user agent too long",
+			args:    []string{"--azure-user-agent=external-dns-traffic-manager-webhook"},
+			wantErr: "is longer than 24 characters",
+		},
+		{
+			name:    "invalid proxy",
+			env:     map[string]string{"AZURE_PROXY_URL": "proxy"},
+			wantErr: `invalid proxy URL "proxy"`,
+		},
+		{
+			name:    "negative request size",
+			args:    []string{"--webhook-max-request-bytes=-1"},
+			wantErr: "webhook-max-request-bytes must not be negative",
+		},
+		{
+			name:    "invalid webhook auth header",
+			args:    []string{"--webhook-auth-header=X-Token:"},
+			wantErr: `webhook-auth-header must be a header name, got "X-Token:"`,
+		},
+		{
+			name:    "negative azure write rate limit",
+			env:     map[string]string{"AZURE_WRITE_RATE_LIMIT": "-5"},
+			wantErr: "azure-write-rate-limit must not be negative",
+		},
+		{
+			name:    "zero webhook apply burst",
+			args:    []string{"--webhook-apply-rate-limit=6", "--webhook-apply-burst=0"},
+			wantErr: "webhook-apply-burst must be at least 1",
+		},
+		{
+			name:    "unknown file key",
+			file:    "subscription: sub\n",
+			wantErr: `unknown setting "subscription" in config file`,
+		},
+		{
+			name:    "unexpected argument",
+			args:    []string{"serve"},
+			wantErr: "unexpected arguments: [serve]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := map[string]string{}
+			if tt.name != "missing subscription" {
+				env["AZURE_SUBSCRIPTION_ID"] = "sub"
+			}
+			for k, v := range tt.env {
+				env[k] = v
+			}
+			if tt.file != "" {
+				env["CONFIG_FILE"] = writeConfigFile(t, tt.file)
+			}
+
+			_, err := loadConfig(tt.args, envFunc(env), io.Discard)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestConfigFields_RedactsSecrets(t *testing.T) {
+	env := map[string]string{
+		"AZURE_SUBSCRIPTION_ID": "sub",
+		"AZURE_CLIENT_SECRET":   "hunter2",
+	}
+	config, err := loadConfig(nil, envFunc(env), io.Discard)
+	require.NoError(t, err)
+
+	values := map[string]string{}
+	for _, field := range config.Fields() {
+		values[field.Key] = field.String
+	}
+
+	assert.Equal(t, redacted, values["azure-client-secret"])
+	assert.Equal(t, "", values["azure-client-certificate-password"], "unset secrets are shown as empty")
+	assert.Equal(t, "sub", values["azure-subscription-id"])
+	assert.Equal(t, "tag", values["hostname-mapping"])
+}
+
+func TestLoadConfig_Check(t *testing.T) {
+	config, err := loadConfig([]string{"-check"}, envFunc(map[string]string{
+		"AZURE_SUBSCRIPTION_ID": "sub",
+		"CHECK_WRITE":           "true",
+	}), io.Discard)
+	require.NoError(t, err)
+	assert.True(t, config.Check)
+	assert.True(t, config.CheckWrite)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// newHTTPServer creates one of the webhook's HTTP servers
+func newHTTPServer(host, port string, handler http.Handler, writeTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:         net.JoinHostPort(host, port),
+		Handler:      handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: writeTimeout,
+		IdleTimeout:  60 * time.Second,
+	}
+}
+
+// listen opens the server's listener. With reusePort the socket is opened with SO_REUSEPORT,
+// so a replacement process can bind the same port and start accepting before this one stops.
+func listen(server *http.Server, reusePort bool) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+	return lc.Listen(context.Background(), "tcp", server.Addr)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl fails on platforms without SO_REUSEPORT
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("reuse-port is not supported on this platform")
+}
@@ -2,89 +2,272 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"net/http"
+	"net/http/pprof"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
+	_ "time/tzdata" // FREEZE_TIMEZONE must resolve in minimal images without zoneinfo
 
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/middleware"
 	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
 	"go.uber.org/zap"
-	"k8s.io/client-go/kubernetes"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 func main() {
+	// One-shot subcommands run instead of the webhook server
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			os.Exit(run(os.Args[2:], os.Stdout))
+		}
+	}
+
+	// Load configuration from flags, environment variables and an optional config file
+	config, err := loadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		os.Exit(2)
+	}
+
 	// Initialize logger
-	logger, err := initLogger()
+	logger, logLevels, err := initLogger(config)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to initialize logger: %v\n", err)
 		os.Exit(1)
 	}
 	defer logger.Sync()
 
-	logger.Info("Starting Traffic Manager Webhook Provider")
-
-	// Get configuration from environment
-	config := getConfig()
-	logger.Info("Configuration loaded",
-		zap.String("webhookPort", config.WebhookPort),
-		zap.String("healthPort", config.HealthPort),
-		zap.Strings("domainFilter", config.DomainFilter))
-
-	// Validate required configuration
-	if config.SubscriptionID == "" {
-		logger.Fatal("AZURE_SUBSCRIPTION_ID environment variable is required")
+	// Report on the startup checks and exit, for an init container or pre-deploy check
+	if config.Check {
+		ctx, cancel := commandContext()
+		code := runChecks(ctx, config, logger, os.Stdout)
+		cancel()
+		logger.Sync()
+		os.Exit(code)
 	}
 
-	if len(config.ResourceGroups) == 0 {
+	logger.Info("Starting Traffic Manager Webhook Provider")
+	logger.Info("Effective configuration", config.Fields()...)
+
+	if len(config.ResourceGroups) == 0 && config.ProfileDiscovery != provider.ProfileDiscoverySubscription {
 		logger.Warn("RESOURCE_GROUPS not configured - will not sync existing profiles from Azure")
 	}
 
-	// Create Kubernetes client
-	k8sClient, err := createKubernetesClient()
+	// Create Kubernetes client (in-cluster, falling back to kubeconfig)
+	dynamicClient, err := createDynamicClient()
 	if err != nil {
 		logger.Fatal("Failed to create Kubernetes client", zap.Error(err))
 	}
 
 	// Create Traffic Manager provider
-	tmProvider, err := provider.NewTrafficManagerProvider(config.SubscriptionID, config.ResourceGroups, config.DomainFilter, k8sClient, logger)
+	tmProvider, err := provider.NewTrafficManagerProvider(providerConfig(config), dynamicClient, logger)
 	if err != nil {
 		logger.Fatal("Failed to create Traffic Manager provider", zap.Error(err))
 	}
 
+	// Periodically remove DNSEndpoints left behind by deleted profiles
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+	if config.DNSEndpointGCInterval > 0 {
+		logger.Info("Starting DNSEndpoint garbage collection",
+			zap.Duration("interval", config.DNSEndpointGCInterval))
+		go tmProvider.RunDNSEndpointGC(backgroundCtx, config.DNSEndpointGCInterval)
+	}
+
+	// Retry DNSEndpoint writes that failed during apply so vanity hostnames don't stay unresolvable
+	if config.DNSEndpointRetryInterval > 0 {
+		go tmProvider.RunDNSEndpointRetries(backgroundCtx, config.DNSEndpointRetryInterval)
+	}
+
+	// Find missing role assignments before ApplyChanges fails with 403s
+	if config.PermissionCheckInterval > 0 {
+		go tmProvider.RunPermissionProbe(backgroundCtx, config.PermissionCheckInterval)
+	}
+
+	// Serve fallback endpoints only while every primary endpoint of their profile is Degraded
+	if config.FallbackCheckInterval > 0 {
+		go tmProvider.RunFallbackWatcher(backgroundCtx, config.FallbackCheckInterval)
+	}
+
+	// Read where the DNS queries of profiles enrolled in Traffic View come from
+	if config.TrafficViewPollInterval > 0 {
+		go tmProvider.RunTrafficViewPoller(backgroundCtx, config.TrafficViewPollInterval)
+	}
+
+	// Step canary weights towards their targets, pausing or rolling back when endpoints degrade
+	if config.CanaryCheckInterval > 0 {
+		go tmProvider.RunCanaryController(backgroundCtx, config.CanaryCheckInterval)
+	}
+
+	// Enable and disable endpoints at the times their schedule annotations give
+	if config.ScheduleCheckInterval > 0 {
+		go tmProvider.RunScheduler(backgroundCtx, config.ScheduleCheckInterval)
+	}
+
+	// Disable endpoints whose Service has no ready pods, ahead of the Azure health probe
+	if config.ServiceReadinessCheckInterval > 0 {
+		go tmProvider.RunServiceReadinessWatcher(backgroundCtx, config.ServiceReadinessCheckInterval)
+	}
+
+	// Delete soft-deleted profiles once their grace period has passed
+	if config.ProfileDeleteGracePeriod > 0 && config.ProfilePurgeInterval > 0 {
+		go tmProvider.RunProfilePurge(backgroundCtx, config.ProfilePurgeInterval)
+	}
+
+	// Delete drained endpoints once resolvers' cached answers for them have expired
+	if config.EndpointDrainCheckInterval > 0 {
+		go tmProvider.RunEndpointDrains(backgroundCtx, config.EndpointDrainCheckInterval)
+	}
+
+	// Resync straight away when Event Grid reports a profile changed outside the webhook
+	if config.EventGridKey != "" {
+		go tmProvider.RunChangeResync(backgroundCtx)
+	}
+
+	// Reload the domain filter and defaults on SIGHUP or when the config file changes
+	reloader := newConfigReloader(os.Args[1:], os.Getenv, config, tmProvider, logger.Named("config"))
+	go reloader.run(backgroundCtx, config.ConfigReloadInterval)
+
+	// Pick up rotated credentials from mounted secret files without a restart
+	if config.CredentialFilePoll > 0 {
+		go tmProvider.WatchCredentialFiles(backgroundCtx, config.CredentialFilePoll)
+	}
+
 	// Create webhook server
-	webhookServer := provider.NewWebhookServer(tmProvider, logger)
+	webhookServer := provider.NewWebhookServer(tmProvider, logger.Named("webhook"))
+
+	// Bound request bodies and how often External DNS may apply changes, and stop handlers once
+	// the response could no longer be written
+	requestTimeout := config.RequestTimeout
+	if requestTimeout == 0 {
+		requestTimeout = config.WebhookWriteTimeout
+	}
+	webhookServer.SetRequestLimits(provider.RequestLimits{
+		MaxBodyBytes:   int64(config.MaxRequestBytes),
+		StrictDecoding: config.StrictRequestDecoding,
+		Timeout:        requestTimeout,
+		ApplyPerMinute: config.ApplyRateLimit,
+		ApplyBurst:     config.ApplyBurst,
+	})
 
 	// Set up HTTP routes for webhook endpoints (localhost only)
 	webhookMux := http.NewServeMux()
 	webhookMux.HandleFunc("/", webhookServer.HandleNegotiate)
 	webhookMux.HandleFunc("/records", webhookServer.HandleRecords)
 	webhookMux.HandleFunc("/adjustendpoints", webhookServer.HandleAdjustEndpoints)
+	webhookMux.HandleFunc("/plan", webhookServer.HandlePlan) // POST a Changes body to preview the Traffic Manager operations it triggers
+
+	// Require a token on the webhook API when it is reachable beyond localhost
+	webhookHandler := http.Handler(webhookMux)
+	if config.WebhookToken != "" || config.WebhookTokenFile != "" {
+		token, err := provider.NewWebhookToken(config.WebhookAuthHeader, config.WebhookToken, config.WebhookTokenFile)
+		if err != nil {
+			logger.Fatal("Failed to load webhook token", zap.Error(err))
+		}
+		if config.CredentialFilePoll > 0 {
+			go token.Watch(backgroundCtx, config.CredentialFilePoll, logger.Named("webhook"))
+		}
+		webhookHandler = webhookServer.RequireWebhookToken(token, webhookMux)
+	}
+
+	// Routes that change Azure or runtime state, or expose the cached state, need the admin token;
+	// without one they are rejected
+	var adminToken *provider.WebhookToken
+	if config.AdminToken != "" || config.AdminTokenFile != "" {
+		token, err := provider.NewWebhookToken(provider.DefaultWebhookAuthHeader, config.AdminToken, config.AdminTokenFile)
+		if err != nil {
+			logger.Fatal("Failed to load admin token", zap.Error(err))
+		}
+		if config.CredentialFilePoll > 0 {
+			go token.Watch(backgroundCtx, config.CredentialFilePoll, logger.Named("admin"))
+		}
+		adminToken = token
+	}
+	adminOnly := func(handler http.HandlerFunc) http.Handler {
+		return webhookServer.RequireAdminToken(adminToken, handler)
+	}
+	adminToChange := func(handler http.Handler) http.Handler {
+		return webhookServer.RequireAdminTokenToChange(adminToken, handler)
+	}
 
 	// Set up HTTP routes for health/metrics endpoints (all interfaces)
 	healthMux := http.NewServeMux()
 	healthMux.HandleFunc("/healthz", webhookServer.HandleHealth)
-	healthMux.HandleFunc("/readyz", webhookServer.HandleHealth) // Readiness probe uses same health check
-	healthMux.HandleFunc("/metrics", handleMetrics)
+	healthMux.HandleFunc("/readyz", webhookServer.HandleReady) // Checks Azure credential and ARM connectivity
+	healthMux.Handle("/metrics", metrics.Handler())
+	healthMux.Handle("/freeze", adminToChange(http.HandlerFunc(webhookServer.HandleFreeze))) // GET status, PUT {"bypassFor":"2h"} to bypass, DELETE to end the bypass
+	healthMux.Handle("/loglevel", adminToChange(logLevels))                                  // GET to list levels, PUT {"subsystem":"...","level":"..."} to change one
+	healthMux.HandleFunc("/dnsendpoints", webhookServer.HandleDNSEndpoints)                  // GET DNSEndpoints managed for vanity CNAMEs
+	healthMux.HandleFunc("/silences", webhookServer.HandleSilences)                          // GET intentional removals silenced for alerting
+	healthMux.HandleFunc("/quotas", webhookServer.HandleQuotas)                              // GET per-namespace profile and endpoint quota usage
+	healthMux.Handle("/drain", adminOnly(webhookServer.HandleDrain))                         // GET or POST to drain before shutdown
+	healthMux.HandleFunc("/canaries", webhookServer.HandleCanaries)                          // GET endpoints whose weight is being shifted in steps
+	healthMux.HandleFunc("/schedules", webhookServer.HandleSchedules)                        // GET endpoints enabled and disabled on a schedule
+	healthMux.HandleFunc("/endpointdrains", webhookServer.HandleEndpointDrains)              // GET endpoints waiting to be deleted after a drain
+	healthMux.Handle("/handoff", adminOnly(webhookServer.HandleHandoff))                     // POST {"fromCluster":"...","toCluster":"...","dryRun":true} to move endpoint ownership
+	healthMux.Handle("/swap", adminOnly(webhookServer.HandleSwap))                           // POST {"resourceGroup":"...","profileName":"...","from":"blue","to":"green"} for a blue/green cutover
+
+	// Weight management for the Argo Rollouts traffic router plugin
+	healthMux.Handle("/rollouts/setweight", adminOnly(webhookServer.HandleRolloutSetWeight))
+	healthMux.HandleFunc("/rollouts/verifyweight", webhookServer.HandleRolloutVerifyWeight)
+
+	if config.DebugEndpoints {
+		logger.Warn("Debug endpoints enabled on the health port")
+		healthMux.Handle("/debug/pprof/", adminOnly(pprof.Index))
+		healthMux.Handle("/debug/pprof/cmdline", adminOnly(pprof.Cmdline))
+		healthMux.Handle("/debug/pprof/profile", adminOnly(pprof.Profile))
+		healthMux.Handle("/debug/pprof/symbol", adminOnly(pprof.Symbol))
+		healthMux.Handle("/debug/pprof/trace", adminOnly(pprof.Trace))
+		healthMux.Handle("/debug/state", adminOnly(webhookServer.HandleDebugState))
+	}
 
-	// Create HTTP servers
-	webhookHTTPServer := &http.Server{
-		Addr:         fmt.Sprintf("0.0.0.0:%s", config.WebhookPort),
-		Handler:      webhookMux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	admin := http.NewServeMux()
+	admin.HandleFunc("/admin/profiles", webhookServer.HandleAdminProfiles)               // GET cached profiles and endpoints with their cache age
+	admin.HandleFunc("/admin/resync", webhookServer.HandleAdminResync)                   // POST to sync profiles from Azure now
+	admin.HandleFunc("/admin/cache", webhookServer.HandleAdminCache)                     // DELETE ?hostname=... to invalidate one cached profile, or all without it
+	admin.HandleFunc("/admin/endpoints/status", webhookServer.HandleAdminEndpointStatus) // PUT {"hostname":"...","endpointName":"...","status":"Disabled"}
+	admin.HandleFunc("/admin/export", webhookServer.HandleAdminExport)                   // GET managed profiles as YAML
+	admin.HandleFunc("/admin/import", webhookServer.HandleAdminImport)                   // POST exported YAML, ?dryRun=true to only validate it
+	admin.HandleFunc("/admin/trafficview", webhookServer.HandleAdminTrafficView)         // GET the latest Traffic View heat maps, ?hostname=... for one profile
+	healthMux.Handle("/admin/", webhookServer.RequireAdminToken(adminToken, admin))
+
+	if config.EventGridKey != "" {
+		healthMux.Handle("/eventgrid", webhookServer.RequireEventGridKey(config.EventGridKey, http.HandlerFunc(webhookServer.HandleEventGrid))) // POST Event Grid resource change events
 	}
 
-	healthHTTPServer := &http.Server{
-		Addr:         fmt.Sprintf("0.0.0.0:%s", config.HealthPort),
-		Handler:      healthMux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	// Create HTTP servers
+	webhookHTTPServer := newHTTPServer(config.WebhookHost, config.WebhookPort,
+		middleware.Wrap(webhookHandler, logger.Named("webhook")), config.WebhookWriteTimeout)
+	healthHTTPServer := newHTTPServer(config.HealthHost, config.HealthPort,
+		middleware.Wrap(healthMux, logger.Named("admin")), config.HealthWriteTimeout)
+
+	// While draining, connections are closed after each response so External DNS reconnects,
+	// reaching the replacement instance once this one stops accepting
+	webhookServer.SetDrain(config.DrainDelay, func() {
+		webhookHTTPServer.SetKeepAlivesEnabled(false)
+	})
+
+	// Bind both listeners before serving so a port conflict fails startup
+	webhookListener, err := listen(webhookHTTPServer, config.ReusePort)
+	if err != nil {
+		logger.Fatal("Failed to listen for webhook server", zap.String("address", webhookHTTPServer.Addr), zap.Error(err))
+	}
+	healthListener, err := listen(healthHTTPServer, config.ReusePort)
+	if err != nil {
+		logger.Fatal("Failed to listen for health server", zap.String("address", healthHTTPServer.Addr), zap.Error(err))
 	}
 
 	// Channel to listen for errors from servers
@@ -92,14 +275,16 @@ func main() {
 
 	// Start webhook server
 	go func() {
-		logger.Info("Starting webhook server", zap.String("address", webhookHTTPServer.Addr))
-		serverErrors <- webhookHTTPServer.ListenAndServe()
+		logger.Info("Starting webhook server",
+			zap.String("address", webhookHTTPServer.Addr),
+			zap.Bool("reusePort", config.ReusePort))
+		serverErrors <- webhookHTTPServer.Serve(webhookListener)
 	}()
 
 	// Start health server
 	go func() {
 		logger.Info("Starting health server", zap.String("address", healthHTTPServer.Addr))
-		serverErrors <- healthHTTPServer.ListenAndServe()
+		serverErrors <- healthHTTPServer.Serve(healthListener)
 	}()
 
 	// Set up graceful shutdown
@@ -116,11 +301,15 @@ func main() {
 		logger.Info("Received shutdown signal", zap.String("signal", sig.String()))
 	}
 
+	// Drain unless a preStop hook already has, so External DNS isn't cut off mid-poll
+	webhookServer.Drain()
+
 	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 	defer cancel()
 
 	logger.Info("Shutting down servers...")
+	stopBackground()
 
 	if err := webhookHTTPServer.Shutdown(ctx); err != nil {
 		logger.Error("Webhook server shutdown error", zap.Error(err))
@@ -133,127 +322,152 @@ func main() {
 	logger.Info("Servers stopped")
 }
 
-// Config holds the application configuration
-type Config struct {
-	WebhookPort      string
-	HealthPort       string
-	DomainFilter     []string
-	ResourceGroups   []string
-	SubscriptionID   string
-	TenantID         string
-	ClientID         string
-	ClientSecret     string
-	LogLevel         string
+// providerConfig returns the provider configuration for the webhook configuration
+func providerConfig(config *Config) *provider.Config {
+	return &provider.Config{
+		SubscriptionID: config.SubscriptionID,
+		Cloud:          config.Cloud,
+		AuthMode:       config.AuthMode,
+		TenantID:       config.TenantID,
+		ClientID:       config.ClientID,
+		ClientSecret:   config.ClientSecret,
+		ClientOptions:  config.clientOptions(),
+
+		ScopedCredentials:         config.ScopedCredentials,
+		ClientSecretFile:          config.ClientSecretFile,
+		ClientCertificateFile:     config.ClientCertificateFile,
+		ClientCertificatePassword: config.ClientCertificatePassword,
+
+		ResourceGroups:        config.ResourceGroups,
+		ProfileDiscovery:      config.ProfileDiscovery,
+		DomainFilter:          config.DomainFilter,
+		DomainFilterExclude:   config.DomainFilterExclude,
+		ClusterName:           config.ClusterName,
+		Policy:                config.Policy,
+		VanityRecordMode:      config.VanityRecordMode,
+		AzureDNSResourceGroup: config.AzureDNSResourceGroup,
+		AzureDNSZones:         config.AzureDNSZones,
+		TXTRegistryConfigMap:  config.TXTRegistryConfigMap,
+
+		EndpointConfigConfigMap: config.EndpointConfigConfigMap,
+		ResolvePublicIPs:        config.ResolvePublicIPs,
+		EndpointRecords:         config.EndpointRecords,
+
+		MaxWeightChangePercent: config.MaxWeightChangePercent,
+		WeightChangeAction:     config.WeightChangeAction,
+
+		AllowedSubscriptions:    config.AllowedSubscriptions,
+		AllowedResourceGroups:   config.AllowedResourceGroups,
+		NamespaceResourceGroups: config.NamespaceResourceGroups,
+
+		MaxProfilesPerNamespace:  config.MaxProfilesPerNamespace,
+		MaxEndpointsPerNamespace: config.MaxEndpointsPerNamespace,
+		NamespaceProfileQuotas:   config.NamespaceProfileQuotas,
+		NamespaceEndpointQuotas:  config.NamespaceEndpointQuotas,
+
+		FreezeWindows:   config.FreezeWindows,
+		FreezeTimezone:  config.FreezeTimezone,
+		HostnameMapping: config.HostnameMapping,
+		Defaults:        config.providerSettings().Defaults,
+		SilenceDuration: config.SilenceDuration,
+
+		AdoptProfiles: config.AdoptExistingProfiles,
+		Ownership: trafficmanager.Ownership{
+			ManagedByTag:   config.ManagedByTag,
+			ManagedByValue: config.ManagedByValue,
+			HostnameTag:    config.HostnameTag,
+		},
+		ProfileNameTemplate:      config.ProfileNameTemplate,
+		EndpointNameTemplate:     config.EndpointNameTemplate,
+		ProfileNameCollision:     config.ProfileNameCollision,
+		CreateFailureMode:        config.CreateFailureMode,
+		ProfileDeleteGracePeriod: config.ProfileDeleteGracePeriod,
+		ServiceReadiness:         config.ServiceReadinessCheckInterval > 0,
+		EndpointDrain:            config.EndpointDrain,
+		EndpointDrainTTLMultiple: config.EndpointDrainTTLMultiple,
+		StateCacheMaxProfiles:    config.StateCacheMaxProfiles,
+		StateCacheTTL:            config.StateCacheTTL,
+		StateCacheStaleTTL:       config.StateCacheStaleTTL,
+
+		NamespaceDefaultsConfigMap: config.NamespaceDefaultsConfigMap,
+		DetectEndpointLocation:     config.DetectEndpointLocation,
+
+		PodName:      config.PodName,
+		PodNamespace: config.PodNamespace,
+	}
 }
 
-// getConfig loads configuration from environment variables
-func getConfig() *Config {
-	return &Config{
-		WebhookPort:      getEnv("WEBHOOK_PORT", "8888"),
-		HealthPort:       getEnv("HEALTH_PORT", "8080"),
-		DomainFilter:     getEnvSlice("DOMAIN_FILTER", []string{}),
-		ResourceGroups:   getEnvSlice("RESOURCE_GROUPS", []string{}),
-		SubscriptionID:   getEnv("AZURE_SUBSCRIPTION_ID", ""),
-		TenantID:         getEnv("AZURE_TENANT_ID", ""),
-		ClientID:         getEnv("AZURE_CLIENT_ID", ""),
-		ClientSecret:     getEnv("AZURE_CLIENT_SECRET", ""),
-		LogLevel:         getEnv("LOG_LEVEL", "info"),
+// initLogger initializes the logger from the configuration.
+// LogLevel sets the default level and LogLevels overrides it per subsystem
+// (e.g. "trafficmanager=debug,webhook=warn"); both can be changed at runtime via /loglevel.
+func initLogger(cfg *Config) (*zap.Logger, *logging.Levels, error) {
+	var config zap.Config
+	if cfg.Environment == "production" {
+		config = zap.NewProductionConfig()
+	} else {
+		config = zap.NewDevelopmentConfig()
 	}
-}
 
-// getEnv gets an environment variable or returns a default value
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+	// Set log level
+	defaultLevel, err := zapcore.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		defaultLevel = zapcore.InfoLevel
 	}
-	return defaultValue
-}
 
-// getEnvSlice gets an environment variable as a slice (comma-separated)
-func getEnvSlice(key string, defaultValue []string) []string {
-	if value := os.Getenv(key); value != "" {
-		// Simple split by comma - could be enhanced
-		result := []string{}
-		current := ""
-		for _, char := range value {
-			if char == ',' {
-				if current != "" {
-					result = append(result, current)
-					current = ""
-				}
-			} else {
-				current += string(char)
-			}
-		}
-		if current != "" {
-			result = append(result, current)
-		}
-		return result
+	overrides, err := logging.ParseOverrides(cfg.LogLevels)
+	if err != nil {
+		return nil, nil, err
 	}
-	return defaultValue
-}
 
-// initLogger initializes the logger based on environment
-func initLogger() (*zap.Logger, error) {
-	logLevel := getEnv("LOG_LEVEL", "info")
+	levels := logging.NewLevels(defaultLevel)
+	for subsystem, level := range overrides {
+		levels.Set(subsystem, level)
+	}
 
-	var config zap.Config
-	if os.Getenv("ENVIRONMENT") == "production" {
-		config = zap.NewProductionConfig()
-	} else {
-		config = zap.NewDevelopmentConfig()
+	// Build at debug so any subsystem can be made more verbose later; levels does the filtering
+	config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
+	logger, err := config.Build(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return logging.NewCore(core, levels)
+	}))
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// Set log level
-	switch logLevel {
-	case "debug":
-		config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
-	case "info":
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-	case "warn":
-		config.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
-	case "error":
-		config.Level = zap.NewAtomicLevelAt(zap.ErrorLevel)
-	default:
-		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
-	}
-
-	return config.Build()
+	return logger, levels, nil
 }
 
-// createKubernetesClient creates a Kubernetes client for the in-cluster environment
-func createKubernetesClient() (*kubernetes.Clientset, error) {
+// getKubernetesConfig returns the in-cluster config, falling back to kubeconfig for local development
+func getKubernetesConfig() (*rest.Config, error) {
 	// Try in-cluster config first
 	config, err := rest.InClusterConfig()
-	if err != nil {
-		// Fall back to kubeconfig for local development
-		kubeconfig := os.Getenv("KUBECONFIG")
-		if kubeconfig == "" {
-			kubeconfig = os.Getenv("HOME") + "/.kube/config"
-		}
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kubernetes config: %w", err)
-		}
+	if err == nil {
+		return config, nil
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	// Fall back to kubeconfig for local development
+	kubeconfig := os.Getenv("KUBECONFIG")
+	if kubeconfig == "" {
+		kubeconfig = os.Getenv("HOME") + "/.kube/config"
+	}
+	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+		return nil, fmt.Errorf("failed to create kubernetes config: %w", err)
 	}
 
-	return clientset, nil
+	return config, nil
 }
 
-// handleMetrics is a placeholder for metrics endpoint
-func handleMetrics(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// createDynamicClient creates a dynamic Kubernetes client used for DNSEndpoint CRD operations
+func createDynamicClient() (dynamic.Interface, error) {
+	config, err := getKubernetesConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
-	// TODO: Implement Prometheus metrics
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "# Metrics endpoint - TODO: Implement Prometheus metrics\n")
+	return client, nil
 }
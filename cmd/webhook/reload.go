@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"go.uber.org/zap"
+)
+
+// reloadableSettings are the settings applied without a restart; changes to others are logged and ignored
+var reloadableSettings = map[string]bool{
+	"domain-filter":             true,
+	"domain-filter-exclude":     true,
+	"default-resource-group":    true,
+	"default-routing-method":    true,
+	"default-monitor-protocol":  true,
+	"default-monitor-port":      true,
+	"default-monitor-path":      true,
+	"default-endpoint-location": true,
+	"default-tags":              true,
+}
+
+// settingsUpdater applies reloaded settings; implemented by the Traffic Manager provider
+type settingsUpdater interface {
+	UpdateSettings(settings provider.Settings) error
+}
+
+// providerSettings returns the settings the provider can change at runtime
+func (c *Config) providerSettings() provider.Settings {
+	return provider.Settings{
+		DomainFilter:        c.DomainFilter,
+		DomainFilterExclude: c.DomainFilterExclude,
+		Defaults: annotations.Defaults{
+			ResourceGroup:    c.DefaultResourceGroup,
+			RoutingMethod:    c.DefaultRoutingMethod,
+			MonitorProtocol:  c.DefaultMonitorProtocol,
+			MonitorPort:      int64(c.DefaultMonitorPort),
+			MonitorPath:      c.DefaultMonitorPath,
+			EndpointLocation: c.DefaultEndpointLocation,
+			Tags:             c.defaultTags(),
+		},
+	}
+}
+
+// defaultTags returns the parsed default tags; validate has already rejected invalid ones
+func (c *Config) defaultTags() map[string]string {
+	tags, _ := annotations.ParseTags(c.DefaultTags)
+	return tags
+}
+
+// configReloader reloads the configuration from the same flags, environment and config file
+// the webhook started with, and hands the reloadable settings to the provider
+type configReloader struct {
+	args    []string
+	getenv  func(string) string
+	target  settingsUpdater
+	logger  *zap.Logger
+	current *Config
+	digest  string
+}
+
+func newConfigReloader(args []string, getenv func(string) string, current *Config, target settingsUpdater, logger *zap.Logger) *configReloader {
+	r := &configReloader{args: args, getenv: getenv, target: target, logger: logger, current: current}
+	r.digest = fileDigest(current.configFile)
+	return r
+}
+
+// run reloads on SIGHUP and, when a config file is used, whenever its contents change.
+// A mounted ConfigMap is updated in place by the kubelet, so editing it is picked up
+// within the kubelet sync period plus the reload interval.
+func (r *configReloader) run(ctx context.Context, interval time.Duration) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var poll <-chan time.Time
+	if r.current.configFile != "" && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+
+		r.logger.Info("Watching config file for changes",
+			zap.String("path", r.current.configFile),
+			zap.Duration("interval", interval))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			r.reload("SIGHUP")
+		case <-poll:
+			if r.fileChanged() {
+				r.reload("config file changed")
+			}
+		}
+	}
+}
+
+// fileChanged reports whether the config file contents changed since the last check
+func (r *configReloader) fileChanged() bool {
+	digest := fileDigest(r.current.configFile)
+	if digest == r.digest {
+		return false
+	}
+	r.digest = digest
+	return true
+}
+
+// reload loads the configuration again and applies the reloadable settings.
+// On any error the current settings are kept.
+func (r *configReloader) reload(trigger string) {
+	config, err := loadConfig(r.args, r.getenv, io.Discard)
+	if err != nil {
+		r.logger.Error("Failed to reload configuration; keeping the current settings",
+			zap.String("trigger", trigger),
+			zap.Error(err))
+		return
+	}
+
+	for _, name := range restartRequired(r.current, config) {
+		r.logger.Warn("Configuration setting changed but requires a restart to take effect",
+			zap.String("setting", name))
+	}
+
+	if err := r.target.UpdateSettings(config.providerSettings()); err != nil {
+		r.logger.Error("Failed to apply reloaded configuration; keeping the current settings",
+			zap.String("trigger", trigger),
+			zap.Error(err))
+		return
+	}
+
+	r.current = config
+	r.logger.Info("Reloaded configuration", zap.String("trigger", trigger))
+}
+
+// restartRequired lists settings that differ between old and updated but can't be reloaded
+func restartRequired(old, updated *Config) []string {
+	before := make(map[string]string)
+	for _, field := range old.Fields() {
+		before[field.Key] = field.String
+	}
+
+	var changed []string
+	for _, field := range updated.Fields() {
+		if !reloadableSettings[field.Key] && before[field.Key] != field.String {
+			changed = append(changed, field.Key)
+		}
+	}
+	return changed
+}
+
+// fileDigest returns a hash of the file contents, or "" if there is no file or it can't be read
+func fileDigest(path string) string {
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
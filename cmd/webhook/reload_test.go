@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeSettingsUpdater struct {
+	updates []provider.Settings
+	err     error
+}
+
+func (f *fakeSettingsUpdater) UpdateSettings(settings provider.Settings) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.updates = append(f.updates, settings)
+	return nil
+}
+
+func TestConfigReloader_Reload(t *testing.T) {
+	path := writeConfigFile(t, "azure-subscription-id: sub\ndomain-filter: [example.com]\n")
+	getenv := envFunc(map[string]string{"CONFIG_FILE": path})
+
+	config, err := loadConfig(nil, getenv, io.Discard)
+	require.NoError(t, err)
+
+	updater := &fakeSettingsUpdater{}
+	r := newConfigReloader(nil, getenv, config, updater, zaptest.NewLogger(t))
+	assert.False(t, r.fileChanged())
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+azure-subscription-id: sub
+domain-filter: [example.org]
+domain-filter-exclude: [internal.example.org]
+default-resource-group: tm-rg
+default-monitor-port: 8443
+`), 0o600))
+	require.True(t, r.fileChanged())
+	assert.False(t, r.fileChanged(), "the change is only reported once")
+
+	r.reload("test")
+	require.Len(t, updater.updates, 1)
+	assert.Equal(t, []string{"example.org"}, updater.updates[0].DomainFilter)
+	assert.Equal(t, []string{"internal.example.org"}, updater.updates[0].DomainFilterExclude)
+	assert.Equal(t, "tm-rg", updater.updates[0].Defaults.ResourceGroup)
+	assert.Equal(t, int64(8443), updater.updates[0].Defaults.MonitorPort)
+	assert.Equal(t, []string{"example.org"}, r.current.DomainFilter)
+}
+
+func TestConfigReloader_KeepsSettingsOnError(t *testing.T) {
+	path := writeConfigFile(t, "azure-subscription-id: sub\ndomain-filter: [example.com]\n")
+	getenv := envFunc(map[string]string{"CONFIG_FILE": path})
+
+	config, err := loadConfig(nil, getenv, io.Discard)
+	require.NoError(t, err)
+
+	updater := &fakeSettingsUpdater{}
+	r := newConfigReloader(nil, getenv, config, updater, zaptest.NewLogger(t))
+
+	// An invalid file is not applied
+	require.NoError(t, os.WriteFile(path, []byte("azure-subscription-id: sub\nwebhook-port: nope\n"), 0o600))
+	r.reload("test")
+	assert.Empty(t, updater.updates)
+	assert.Same(t, config, r.current)
+
+	// Nor is a file the provider rejects
+	require.NoError(t, os.WriteFile(path, []byte("azure-subscription-id: sub\ndefault-routing-method: RoundRobin\n"), 0o600))
+	updater.err = errors.New("invalid default routing method")
+	r.reload("test")
+	assert.Same(t, config, r.current)
+}
+
+func TestRestartRequired(t *testing.T) {
+	old, err := loadConfig(nil, envFunc(map[string]string{"AZURE_SUBSCRIPTION_ID": "sub"}), io.Discard)
+	require.NoError(t, err)
+
+	updated, err := loadConfig([]string{"--domain-filter=example.com", "--health-port=9090", "--default-monitor-path=/healthz"},
+		envFunc(map[string]string{"AZURE_SUBSCRIPTION_ID": "sub"}), io.Discard)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"health-port"}, restartRequired(old, updated))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/probe"
+	"sigs.k8s.io/yaml"
+)
+
+// manifest holds the fields of a Kubernetes object the validate subcommand needs
+type manifest struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+}
+
+var documentSeparator = regexp.MustCompile(`(?m)^---\s*$`)
+
+// runValidate checks Traffic Manager annotations in Kubernetes manifests without contacting Azure.
+// With -probe-target it also simulates the Traffic Manager health probe against that target.
+// It returns the process exit code.
+func runValidate(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(out)
+	file := flags.String("f", "", "Manifest file to validate (- for stdin)")
+	probeTarget := flags.String("probe-target", "", "Hostname or IP to probe with the declared monitor settings")
+	probeTimeout := flags.Duration("probe-timeout", probe.DefaultTimeout, "Probe timeout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *file == "" {
+		fmt.Fprintln(out, "usage: webhook validate -f <manifest.yaml> [-probe-target <host>] [-probe-timeout 10s]")
+		return 2
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Failed to read manifest: %v\n", err)
+		return 1
+	}
+
+	failed := false
+	for _, document := range documentSeparator.Split(string(data), -1) {
+		if strings.TrimSpace(document) == "" {
+			continue
+		}
+
+		var m manifest
+		if err := yaml.Unmarshal([]byte(document), &m); err != nil {
+			fmt.Fprintf(out, "ERROR: failed to parse document: %v\n", err)
+			failed = true
+			continue
+		}
+
+		name := fmt.Sprintf("%s %s/%s", m.Kind, m.Metadata.Namespace, m.Metadata.Name)
+		config, err := annotations.ValidateAnnotations(m.Metadata.Annotations)
+		if err != nil {
+			fmt.Fprintf(out, "ERROR: %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		if !config.Enabled {
+			fmt.Fprintf(out, "SKIP:  %s: Traffic Manager not enabled\n", name)
+			continue
+		}
+		fmt.Fprintf(out, "OK:    %s\n", name)
+
+		if *probeTarget == "" {
+			continue
+		}
+
+		result := probe.Simulate(context.Background(), probe.Config{
+			Target:   *probeTarget,
+			Protocol: config.MonitorProtocol,
+			Port:     config.MonitorPort,
+			Path:     config.MonitorPath,
+			Timeout:  *probeTimeout,
+		})
+		if result.Healthy {
+			fmt.Fprintf(out, "       probe would pass: %s (%s)\n", result.Reason, result.Latency.Round(time.Millisecond))
+		} else {
+			fmt.Fprintf(out, "       probe would FAIL: %s\n", result.Reason)
+			failed = true
+		}
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
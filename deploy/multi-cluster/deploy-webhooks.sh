@@ -145,6 +145,8 @@ spec:
           value: "8888"
         - name: HEALTH_PORT
           value: "8080"
+        - name: DRAIN_DELAY
+          value: "15s"
         - name: DOMAIN_FILTER
           value: "${DNS_ZONE_NAME}"
         - name: AZURE_SUBSCRIPTION_ID
@@ -155,6 +157,14 @@ spec:
           value: "${AZURE_TENANT_ID}"
         - name: AZURE_USE_MANAGED_IDENTITY
           value: "true"
+        - name: POD_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.name
+        - name: POD_NAMESPACE
+          valueFrom:
+            fieldRef:
+              fieldPath: metadata.namespace
         livenessProbe:
           httpGet:
             path: /healthz
@@ -0,0 +1,136 @@
+// Package externaldns implements External DNS's provider.Provider interface with the Traffic
+// Manager provider, for forks of External DNS that compile it in instead of running the webhook.
+// It is a separate module so the webhook doesn't depend on External DNS.
+package externaldns
+
+import (
+	"context"
+
+	tmprovider "github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"go.uber.org/zap"
+	"k8s.io/client-go/dynamic"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+	"sigs.k8s.io/external-dns/provider"
+)
+
+// Provider adapts a TrafficManagerProvider to External DNS's provider.Provider
+type Provider struct {
+	provider *tmprovider.TrafficManagerProvider
+}
+
+var _ provider.Provider = (*Provider)(nil)
+
+// NewProvider creates a Traffic Manager provider from config. dynamicClient may be nil when no
+// feature that needs Kubernetes, such as the TXT registry ConfigMap, is configured.
+func NewProvider(config *tmprovider.Config, dynamicClient dynamic.Interface, logger *zap.Logger) (*Provider, error) {
+	p, err := tmprovider.NewTrafficManagerProvider(config, dynamicClient, logger)
+	if err != nil {
+		return nil, err
+	}
+	return Wrap(p), nil
+}
+
+// Wrap adapts an existing TrafficManagerProvider
+func Wrap(p *tmprovider.TrafficManagerProvider) *Provider {
+	return &Provider{provider: p}
+}
+
+// TrafficManagerProvider returns the wrapped provider, for its operations External DNS doesn't call
+func (p *Provider) TrafficManagerProvider() *tmprovider.TrafficManagerProvider {
+	return p.provider
+}
+
+// Records returns the managed Traffic Manager profiles as DNS records
+func (p *Provider) Records(ctx context.Context) ([]*endpoint.Endpoint, error) {
+	records, err := p.provider.Records(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return fromEndpoints(records), nil
+}
+
+// ApplyChanges creates, updates and deletes Traffic Manager profiles and endpoints
+func (p *Provider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
+	return p.provider.ApplyChanges(ctx, &tmprovider.Changes{
+		Create:    toEndpoints(changes.Create),
+		UpdateOld: toEndpoints(changes.UpdateOld),
+		UpdateNew: toEndpoints(changes.UpdateNew),
+		Delete:    toEndpoints(changes.Delete),
+	})
+}
+
+// AdjustEndpoints normalizes the Traffic Manager annotations of endpoints, as the webhook's
+// /adjustendpoints does
+func (p *Provider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	return fromEndpoints(p.provider.AdjustEndpoints(context.Background(), toEndpoints(endpoints))), nil
+}
+
+// GetDomainFilter returns the configured domain filter and exclusions
+func (p *Provider) GetDomainFilter() endpoint.DomainFilter {
+	return endpoint.NewDomainFilterWithExclusions(p.provider.DomainFilter(), p.provider.DomainFilterExclude())
+}
+
+// toEndpoints converts External DNS endpoints to the provider's
+func toEndpoints(endpoints []*endpoint.Endpoint) []*tmprovider.Endpoint {
+	if endpoints == nil {
+		return nil
+	}
+	converted := make([]*tmprovider.Endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		converted = append(converted, toEndpoint(e))
+	}
+	return converted
+}
+
+// toEndpoint converts an External DNS endpoint to the provider's
+func toEndpoint(e *endpoint.Endpoint) *tmprovider.Endpoint {
+	converted := &tmprovider.Endpoint{
+		DNSName:       e.DNSName,
+		Targets:       append([]string(nil), e.Targets...),
+		RecordType:    e.RecordType,
+		SetIdentifier: e.SetIdentifier,
+		RecordTTL:     int64(e.RecordTTL),
+	}
+	if e.Labels != nil {
+		converted.Labels = make(map[string]string, len(e.Labels))
+		for k, v := range e.Labels {
+			converted.Labels[k] = v
+		}
+	}
+	for _, property := range e.ProviderSpecific {
+		converted.ProviderSpecific = append(converted.ProviderSpecific, tmprovider.ProviderSpecificProperty{Name: property.Name, Value: property.Value})
+	}
+	return converted
+}
+
+// fromEndpoints converts the provider's endpoints to External DNS endpoints
+func fromEndpoints(endpoints []*tmprovider.Endpoint) []*endpoint.Endpoint {
+	if endpoints == nil {
+		return nil
+	}
+	converted := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		converted = append(converted, fromEndpoint(e))
+	}
+	return converted
+}
+
+// fromEndpoint converts one of the provider's endpoints to an External DNS endpoint
+func fromEndpoint(e *tmprovider.Endpoint) *endpoint.Endpoint {
+	converted := &endpoint.Endpoint{
+		DNSName:       e.DNSName,
+		Targets:       append(endpoint.Targets(nil), e.Targets...),
+		RecordType:    e.RecordType,
+		SetIdentifier: e.SetIdentifier,
+		RecordTTL:     endpoint.TTL(e.RecordTTL),
+		Labels:        endpoint.NewLabels(),
+	}
+	for k, v := range e.Labels {
+		converted.Labels[k] = v
+	}
+	for _, property := range e.ProviderSpecific {
+		converted.ProviderSpecific = append(converted.ProviderSpecific, endpoint.ProviderSpecificProperty{Name: property.Name, Value: property.Value})
+	}
+	return converted
+}
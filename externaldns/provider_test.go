@@ -0,0 +1,29 @@
+package externaldns
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestEndpointConversion(t *testing.T) {
+	e := &endpoint.Endpoint{
+		DNSName:          "app.example.com",
+		Targets:          endpoint.Targets{"20.30.40.50"},
+		RecordType:       endpoint.RecordTypeA,
+		SetIdentifier:    "east",
+		RecordTTL:        30,
+		Labels:           endpoint.Labels{"webhook/traffic-manager-enabled": "true"},
+		ProviderSpecific: endpoint.ProviderSpecific{{Name: "webhook/traffic-manager-weight", Value: "50"}},
+	}
+
+	converted := toEndpoint(e)
+	assert.Equal(t, "app.example.com", converted.DNSName)
+	assert.Equal(t, int64(30), converted.RecordTTL)
+	assert.Equal(t, "true", converted.Labels["webhook/traffic-manager-enabled"])
+	assert.Equal(t, "50", converted.ProviderSpecific[0].Value)
+
+	assert.Equal(t, e, fromEndpoint(converted))
+	assert.Nil(t, toEndpoints(nil))
+}
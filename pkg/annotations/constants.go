@@ -6,42 +6,113 @@ const (
 	// in the ProviderSpecific field, so we use the transformed prefix here
 	AnnotationPrefix = "webhook/traffic-manager-"
 
+	// ResourceAnnotationPrefix is the prefix as written on Kubernetes resources, before External DNS transforms it
+	ResourceAnnotationPrefix = "external-dns.alpha.kubernetes.io/webhook-traffic-manager-"
+
 	// Core configuration annotations
-	AnnotationEnabled      = AnnotationPrefix + "enabled"
-	AnnotationProfileName  = AnnotationPrefix + "profile-name"
-	AnnotationResourceGroup = AnnotationPrefix + "resource-group"
-	AnnotationHostname     = AnnotationPrefix + "hostname"
+	AnnotationEnabled        = AnnotationPrefix + "enabled"
+	AnnotationProfileName    = AnnotationPrefix + "profile-name"
+	AnnotationResourceGroup  = AnnotationPrefix + "resource-group"
+	AnnotationHostname       = AnnotationPrefix + "hostname"
+	AnnotationSubscriptionID = AnnotationPrefix + "subscription-id"
+
+	// Naming templates used when no explicit profile or endpoint name is set
+	AnnotationProfileNameTemplate  = AnnotationPrefix + "profile-name-template"
+	AnnotationEndpointNameTemplate = AnnotationPrefix + "endpoint-name-template"
 
 	// Routing configuration
 	AnnotationRoutingMethod = AnnotationPrefix + "routing-method"
 	AnnotationWeight        = AnnotationPrefix + "weight"
+	AnnotationWeightMode    = AnnotationPrefix + "weight-mode"
 	AnnotationPriority      = AnnotationPrefix + "priority"
 
 	// Endpoint configuration
 	AnnotationEndpointName     = AnnotationPrefix + "endpoint-name"
 	AnnotationEndpointLocation = AnnotationPrefix + "endpoint-location"
 	AnnotationEndpointStatus   = AnnotationPrefix + "endpoint-status"
+	AnnotationMaintenance      = AnnotationPrefix + "maintenance"
+	AnnotationFallbackTarget   = AnnotationPrefix + "fallback-target"
+
+	// HTTP headers sent with the health probes of one endpoint, as "name:value,name:value",
+	// e.g. the Host a multi-tenant gateway routes the probe by
+	AnnotationEndpointCustomHeaders = AnnotationPrefix + "endpoint-custom-headers"
 
 	// DNS configuration
-	AnnotationDNSTTL = AnnotationPrefix + "dns-ttl"
+	AnnotationDNSTTL           = AnnotationPrefix + "dns-ttl"
+	AnnotationVanityRecordType = AnnotationPrefix + "vanity-record-type"
 
 	// Monitoring configuration
-	AnnotationMonitorProtocol    = AnnotationPrefix + "monitor-protocol"
-	AnnotationMonitorPort        = AnnotationPrefix + "monitor-port"
-	AnnotationMonitorPath        = AnnotationPrefix + "monitor-path"
+	AnnotationMonitorProtocol     = AnnotationPrefix + "monitor-protocol"
+	AnnotationMonitorPort         = AnnotationPrefix + "monitor-port"
+	AnnotationMonitorPath         = AnnotationPrefix + "monitor-path"
 	AnnotationHealthChecksEnabled = AnnotationPrefix + "health-checks-enabled"
+
+	// Administrative status of the whole profile; a disabled profile answers no queries
+	AnnotationProfileStatus = AnnotationPrefix + "profile-status"
+
+	// Traffic View, which reports where the profile's DNS queries come from
+	AnnotationTrafficView = AnnotationPrefix + "traffic-view"
+
+	// Guardrail overrides
+	AnnotationAllowLargeWeightChange = AnnotationPrefix + "allow-large-weight-change"
+	AnnotationFreezeOverride         = AnnotationPrefix + "freeze-override"
+	AnnotationForceProfileSettings   = AnnotationPrefix + "force-profile-settings"
+
+	// Profile protection and adoption
+	AnnotationDeletionProtection = AnnotationPrefix + "deletion-protection"
+	AnnotationAdopt              = AnnotationPrefix + "adopt"
+
+	// Custom Azure tags for the profile, as "key=value,key=value"
+	AnnotationTags = AnnotationPrefix + "tags"
+
+	// Progressive traffic shifting
+	AnnotationCanaryStep       = AnnotationPrefix + "canary-step"
+	AnnotationCanaryInterval   = AnnotationPrefix + "canary-interval"
+	AnnotationCanaryOnDegraded = AnnotationPrefix + "canary-on-degraded"
+
+	// Scheduled status changes
+	AnnotationScheduleDisable = AnnotationPrefix + "schedule-disable"
+	AnnotationScheduleEnable  = AnnotationPrefix + "schedule-enable"
+)
+
+// What a canary does when its endpoint's monitor status is Degraded
+const (
+	CanaryOnDegradedPause    = "pause"    // Hold the current weight until the endpoint recovers
+	CanaryOnDegradedRollback = "rollback" // Return to the weight the canary started from
+)
+
+// Health check protocols; HTTP and HTTPS probe a path, TCP only opens a connection
+const (
+	MonitorProtocolHTTP  = "HTTP"
+	MonitorProtocolHTTPS = "HTTPS"
+	MonitorProtocolTCP   = "TCP"
+)
+
+// How the weight annotation is read
+const (
+	WeightModeAbsolute = "absolute" // An Azure weight from 1 to 1000
+	WeightModePercent  = "percent"  // A share of the profile's traffic; the profile's percentages sum to 100
+)
+
+// Vanity record types; empty means a CNAME, or an alias record at a zone apex
+const (
+	VanityRecordTypeCNAME = "cname" // CNAME to the Traffic Manager FQDN
+	VanityRecordTypeAlias = "alias" // Azure DNS A alias record targeting the profile (azure-dns vanity mode only)
+	VanityRecordTypeNone  = "none"  // No record; the vanity hostname is managed elsewhere
 )
 
 // Default values
 const (
-	DefaultRoutingMethod   = "Weighted"
-	DefaultWeight          = int64(100)
-	DefaultPriority        = int64(1)
-	DefaultDNSTTL          = int64(30)
-	DefaultMonitorProtocol    = "HTTPS"
-	DefaultMonitorPort        = int64(443)
-	DefaultMonitorPath        = "/"
-	DefaultEndpointStatus     = "Enabled"
-	DefaultEndpointType       = "ExternalEndpoints"
+	DefaultRoutingMethod       = "Weighted"
+	DefaultWeight              = int64(100)
+	DefaultPriority            = int64(1)
+	DefaultDNSTTL              = int64(30)
+	DefaultMonitorProtocol     = MonitorProtocolHTTPS
+	DefaultMonitorPort         = int64(443)
+	DefaultHTTPMonitorPort     = int64(80)
+	DefaultMonitorPath         = "/"
+	DefaultEndpointStatus      = "Enabled"
+	DefaultEndpointType        = "ExternalEndpoints"
 	DefaultHealthChecksEnabled = true
+	DefaultProfileStatus       = "Enabled"
 )
@@ -0,0 +1,123 @@
+package annotations
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Keys accepted in a namespace defaults ConfigMap; each matches the annotation of the same name
+const (
+	DefaultsKeyResourceGroup    = "resource-group"
+	DefaultsKeyRoutingMethod    = "routing-method"
+	DefaultsKeyMonitorProtocol  = "monitor-protocol"
+	DefaultsKeyMonitorPort      = "monitor-port"
+	DefaultsKeyMonitorPath      = "monitor-path"
+	DefaultsKeyEndpointLocation = "endpoint-location"
+	DefaultsKeyTags             = "tags"
+)
+
+// Defaults holds values used when the corresponding annotation isn't set.
+// Empty fields fall back to the built-in defaults.
+type Defaults struct {
+	ResourceGroup    string
+	RoutingMethod    string
+	MonitorProtocol  string
+	MonitorPort      int64
+	MonitorPath      string
+	EndpointLocation string
+	Tags             map[string]string // Custom Azure tags for profiles; merged key by key
+}
+
+// Merge returns d with the non-empty fields of override applied on top
+func (d Defaults) Merge(override Defaults) Defaults {
+	if override.ResourceGroup != "" {
+		d.ResourceGroup = override.ResourceGroup
+	}
+	if override.RoutingMethod != "" {
+		d.RoutingMethod = override.RoutingMethod
+	}
+	if override.MonitorProtocol != "" {
+		d.MonitorProtocol = override.MonitorProtocol
+	}
+	if override.MonitorPort != 0 {
+		d.MonitorPort = override.MonitorPort
+	}
+	if override.MonitorPath != "" {
+		d.MonitorPath = override.MonitorPath
+	}
+	if override.EndpointLocation != "" {
+		d.EndpointLocation = override.EndpointLocation
+	}
+	d.Tags = mergeTags(d.Tags, override.Tags)
+	return d
+}
+
+// apply overrides the built-in defaults in config with the non-empty defaults
+func (d Defaults) apply(config *TrafficManagerConfig) {
+	if d.ResourceGroup != "" {
+		config.ResourceGroup = d.ResourceGroup
+	}
+	if d.RoutingMethod != "" {
+		config.RoutingMethod = d.RoutingMethod
+	}
+	if d.MonitorProtocol != "" {
+		config.MonitorProtocol = d.MonitorProtocol
+	}
+	if d.MonitorPort != 0 {
+		config.MonitorPort = d.MonitorPort
+	}
+	if d.MonitorPath != "" {
+		config.MonitorPath = d.MonitorPath
+	}
+	if d.EndpointLocation != "" {
+		config.EndpointLocation = d.EndpointLocation
+	}
+	config.Tags = mergeTags(nil, d.Tags)
+}
+
+// ParseDefaults parses defaults from the data of a namespace defaults ConfigMap and validates them
+func ParseDefaults(data map[string]string) (Defaults, error) {
+	var defaults Defaults
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := data[key]
+		switch key {
+		case DefaultsKeyResourceGroup:
+			defaults.ResourceGroup = value
+		case DefaultsKeyRoutingMethod:
+			defaults.RoutingMethod = value
+		case DefaultsKeyMonitorProtocol:
+			defaults.MonitorProtocol = value
+		case DefaultsKeyMonitorPort:
+			port, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return Defaults{}, fmt.Errorf("invalid monitor port value %q: %w", value, err)
+			}
+			defaults.MonitorPort = port
+		case DefaultsKeyMonitorPath:
+			defaults.MonitorPath = value
+		case DefaultsKeyEndpointLocation:
+			defaults.EndpointLocation = value
+		case DefaultsKeyTags:
+			tags, err := ParseTags(value)
+			if err != nil {
+				return Defaults{}, err
+			}
+			defaults.Tags = tags
+		default:
+			return Defaults{}, fmt.Errorf("unknown defaults key %q", key)
+		}
+	}
+
+	if err := ValidateDefaults(defaults); err != nil {
+		return Defaults{}, err
+	}
+	return defaults, nil
+}
@@ -0,0 +1,10 @@
+// Package annotations parses and validates the Traffic Manager annotations used
+// by the webhook. It has no dependencies on the provider or the Azure SDK, so
+// admission controllers, CLIs and CI checks can import it to apply exactly the
+// same rules the webhook enforces:
+//
+//	config, err := annotations.ValidateAnnotations(service.Annotations)
+//	if err != nil {
+//		// reject the resource
+//	}
+package annotations
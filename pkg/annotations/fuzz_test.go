@@ -0,0 +1,86 @@
+package annotations
+
+import (
+	"math"
+	"testing"
+)
+
+// FuzzParseConfig parses hostile annotation values and checks that a configuration passing
+// validation is one Azure would accept. Run with: go test -fuzz FuzzParseConfig ./pkg/annotations
+func FuzzParseConfig(f *testing.F) {
+	seeds := []struct{ weightMode, weight, priority, ttl, hostname, tags string }{
+		{"", "100", "1", "60", "app.example.com", "team=web"},
+		{"percent", "12.5%", "", "30", "", ""},
+		{"percent", "NaN", "", "", "", ""},
+		{"percent", "+Inf", "", "", "", ""},
+		{"", "99999999999999999999", "-1", "1e9", "app example.com", "a=b,c"},
+		{"", "0x10", "1_000", "", "app.example.com,evil.example.com", "=,managedBy=x"},
+		{"PERCENT", "1e-1", "0", "30", "ünïcode.example.com", "k=v=w"},
+		{"", "100", "1", "60", "app.example.com\n", "k\x00=v"},
+	}
+	for _, s := range seeds {
+		f.Add(s.weightMode, s.weight, s.priority, s.ttl, s.hostname, s.tags)
+	}
+
+	f.Fuzz(func(t *testing.T, weightMode, weight, priority, ttl, hostname, tags string) {
+		config, err := ParseConfig(map[string]string{
+			AnnotationEnabled:          "true",
+			AnnotationResourceGroup:    "my-rg",
+			AnnotationEndpointLocation: "westeurope",
+			AnnotationRoutingMethod:    "Weighted",
+			AnnotationWeightMode:       weightMode,
+			AnnotationWeight:           weight,
+			AnnotationPriority:         priority,
+			AnnotationDNSTTL:           ttl,
+			AnnotationHostname:         hostname,
+			AnnotationTags:             tags,
+		})
+		if err != nil {
+			return
+		}
+		if err := ValidateConfig(config); err != nil {
+			return
+		}
+
+		if config.Weight < MinWeight || config.Weight > MaxWeight {
+			t.Errorf("weight %d accepted from %q", config.Weight, weight)
+		}
+		if config.WeightMode == WeightModePercent && (math.IsNaN(config.WeightPercent) || config.WeightPercent <= 0 || config.WeightPercent > 100) {
+			t.Errorf("weight percentage %v accepted from %q", config.WeightPercent, weight)
+		}
+		if config.Priority < MinPriority || config.Priority > MaxPriority {
+			t.Errorf("priority %d accepted from %q", config.Priority, priority)
+		}
+		if config.DNSTTL < MinDNSTTL {
+			t.Errorf("DNS TTL %d accepted from %q", config.DNSTTL, ttl)
+		}
+		if config.Hostname != "" {
+			if err := ValidateHostname(config.Hostname); err != nil {
+				t.Errorf("hostname %q accepted: %v", config.Hostname, err)
+			}
+		}
+		if err := ValidateTags(config.Tags); err != nil {
+			t.Errorf("tags %q accepted: %v", tags, err)
+		}
+	})
+}
+
+// FuzzParseWeightPercent checks that any percentage accepted converts to a whole Azure weight
+func FuzzParseWeightPercent(f *testing.F) {
+	for _, seed := range []string{"25", "12.5%", " 100% ", "NaN", "-Inf", "1e308", "0x1p-3", "12.25"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		percent, err := ParseWeightPercent(value)
+		if err != nil {
+			return
+		}
+		if math.IsNaN(percent) || math.IsInf(percent, 0) {
+			t.Fatalf("%q parsed to %v", value, percent)
+		}
+		if percent >= 0 && percent <= 100 && float64(PercentWeight(percent)) != math.Round(percent*PercentWeightScale) {
+			t.Errorf("%q converts to weight %d", value, PercentWeight(percent))
+		}
+	})
+}
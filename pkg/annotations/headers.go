@@ -0,0 +1,86 @@
+package annotations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Azure custom header limits
+const (
+	MaxCustomHeaders           = 8
+	MaxCustomHeaderValueLength = 256
+)
+
+// ParseCustomHeaders parses the HTTP headers sent with an endpoint's health probes, written as
+// "name:value,name:value" like in the Azure portal, and validates them
+func ParseCustomHeaders(value string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, val, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid custom header %q, must be name:value", pair)
+		}
+		name, val = strings.TrimSpace(name), strings.TrimSpace(val)
+		for existing := range headers {
+			if strings.EqualFold(existing, name) {
+				return nil, fmt.Errorf("custom header %q is set more than once", name)
+			}
+		}
+		headers[name] = val
+	}
+	if err := ValidateCustomHeaders(headers); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// ValidateCustomHeaders checks custom headers are valid HTTP headers within Azure's limits
+func ValidateCustomHeaders(headers map[string]string) error {
+	if len(headers) > MaxCustomHeaders {
+		return fmt.Errorf("%d custom headers set, at most %d are allowed", len(headers), MaxCustomHeaders)
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("custom header name is empty")
+		}
+		if !isHeaderToken(name) {
+			return fmt.Errorf("custom header name %q must only contain letters, digits and !#$%%&'*+-.^_`|~", name)
+		}
+		value := headers[name]
+		if value == "" {
+			return fmt.Errorf("value of custom header %q is empty", name)
+		}
+		if len(value) > MaxCustomHeaderValueLength {
+			return fmt.Errorf("value of custom header %q is longer than %d characters", name, MaxCustomHeaderValueLength)
+		}
+		if strings.ContainsFunc(value, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+			return fmt.Errorf("value of custom header %q must not contain control characters", name)
+		}
+	}
+	return nil
+}
+
+// isHeaderToken reports whether name is an HTTP token, as header names must be
+func isHeaderToken(name string) bool {
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
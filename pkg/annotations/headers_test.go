@@ -0,0 +1,67 @@
+package annotations
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCustomHeaders(t *testing.T) {
+	headers, err := ParseCustomHeaders("host:tenant-a.example.com, X-Probe : traffic-manager ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "tenant-a.example.com", "X-Probe": "traffic-manager"}, headers)
+
+	_, err = ParseCustomHeaders("host")
+	assert.ErrorContains(t, err, "must be name:value")
+
+	_, err = ParseCustomHeaders("host:a.example.com,Host:b.example.com")
+	assert.ErrorContains(t, err, "more than once")
+
+	_, err = ParseCustomHeaders(":a.example.com")
+	assert.ErrorContains(t, err, "name is empty")
+
+	_, err = ParseCustomHeaders("x probe:1")
+	assert.ErrorContains(t, err, "must only contain")
+
+	_, err = ParseCustomHeaders("host:")
+	assert.ErrorContains(t, err, "is empty")
+
+	_, err = ParseCustomHeaders("x-long:" + strings.Repeat("a", MaxCustomHeaderValueLength+1))
+	assert.ErrorContains(t, err, "longer than")
+
+	_, err = ParseCustomHeaders("a:1,b:1,c:1,d:1,e:1,f:1,g:1,h:1,i:1")
+	assert.ErrorContains(t, err, "at most 8")
+}
+
+func TestValidateCustomHeaders_ControlCharacters(t *testing.T) {
+	assert.NoError(t, ValidateCustomHeaders(nil))
+	assert.ErrorContains(t, ValidateCustomHeaders(map[string]string{"host": "a.example.com\r\nX-Injected: 1"}), "control characters")
+}
+
+func TestParseConfig_EndpointCustomHeaders(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:               "true",
+		AnnotationResourceGroup:         "my-rg",
+		AnnotationEndpointCustomHeaders: "host:tenant-a.example.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"host": "tenant-a.example.com"}, config.EndpointCustomHeaders)
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:               "true",
+		AnnotationResourceGroup:         "my-rg",
+		AnnotationEndpointCustomHeaders: "host",
+	})
+	assert.ErrorContains(t, err, "invalid endpoint custom headers")
+
+	config, err = ParseConfig(map[string]string{
+		AnnotationEnabled:               "true",
+		AnnotationResourceGroup:         "my-rg",
+		AnnotationMonitorProtocol:       "TCP",
+		AnnotationEndpointCustomHeaders: "host:tenant-a.example.com",
+	})
+	require.NoError(t, err)
+	assert.ErrorContains(t, ValidateConfig(config), "can't be used with monitor protocol TCP")
+}
@@ -0,0 +1,102 @@
+package annotations
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Name lengths Azure accepts. A profile name is also its relative DNS name under
+// trafficmanager.net, so it follows DNS label rules.
+const (
+	MaxProfileNameLength  = 63
+	MaxEndpointNameLength = 260
+
+	// DNS limits for the vanity hostname
+	MaxHostnameLength = 253
+	MaxLabelLength    = 63
+)
+
+// ValidateProfileName checks a Traffic Manager profile name against ARM's rules, so a bad
+// name fails with an explanation rather than being rejected by Azure
+func ValidateProfileName(name string) error {
+	if name == "" {
+		return fmt.Errorf("profile name is empty")
+	}
+	if len(name) > MaxProfileNameLength {
+		return fmt.Errorf("profile name %q is %d characters, Traffic Manager allows at most %d", name, len(name), MaxProfileNameLength)
+	}
+	if c, ok := firstInvalid(name, isAlphanumeric, '-'); ok {
+		return fmt.Errorf("profile name %q contains %q, only letters, digits and hyphens are allowed", name, c)
+	}
+	if !isAlphanumeric(rune(name[0])) || !isAlphanumeric(rune(name[len(name)-1])) {
+		return fmt.Errorf("profile name %q must start and end with a letter or digit", name)
+	}
+	return nil
+}
+
+// ValidateEndpointName checks a Traffic Manager endpoint name against ARM's rules
+func ValidateEndpointName(name string) error {
+	if name == "" {
+		return fmt.Errorf("endpoint name is empty")
+	}
+	if len(name) > MaxEndpointNameLength {
+		return fmt.Errorf("endpoint name %q is %d characters, Traffic Manager allows at most %d", name, len(name), MaxEndpointNameLength)
+	}
+	if c, ok := firstInvalid(name, isAlphanumeric, '-', '_', '.'); ok {
+		return fmt.Errorf("endpoint name %q contains %q, only letters, digits, hyphens, underscores and periods are allowed", name, c)
+	}
+	if !isAlphanumeric(rune(name[0])) {
+		return fmt.Errorf("endpoint name %q must start with a letter or digit", name)
+	}
+	if strings.HasSuffix(name, ".") {
+		return fmt.Errorf("endpoint name %q must not end with a period", name)
+	}
+	return nil
+}
+
+// ValidateHostname checks a vanity hostname is a DNS name the webhook can publish: labels of
+// ASCII letters, digits and hyphens, optionally under a leading "*." wildcard. Unicode names must
+// be written in their punycode form.
+func ValidateHostname(hostname string) error {
+	if hostname == "" {
+		return fmt.Errorf("hostname is empty")
+	}
+	if len(hostname) > MaxHostnameLength {
+		return fmt.Errorf("hostname %q is %d characters, DNS allows at most %d", hostname, len(hostname), MaxHostnameLength)
+	}
+	labels := strings.Split(strings.TrimPrefix(hostname, "*."), ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("hostname %q must have at least two labels", hostname)
+	}
+	for _, label := range labels {
+		if label == "" {
+			return fmt.Errorf("hostname %q has an empty label", hostname)
+		}
+		if len(label) > MaxLabelLength {
+			return fmt.Errorf("hostname %q has a label longer than %d characters", hostname, MaxLabelLength)
+		}
+		if c, ok := firstInvalid(label, isAlphanumeric, '-'); ok {
+			return fmt.Errorf("hostname %q contains %q, only letters, digits, hyphens and periods are allowed", hostname, c)
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("hostname %q has a label starting or ending with a hyphen", hostname)
+		}
+	}
+	return nil
+}
+
+// firstInvalid returns the first character of s that is neither valid nor one of extra
+func firstInvalid(s string, valid func(rune) bool, extra ...rune) (rune, bool) {
+	for _, c := range s {
+		if valid(c) || strings.ContainsRune(string(extra), c) {
+			continue
+		}
+		return c, true
+	}
+	return 0, false
+}
+
+// isAlphanumeric reports whether c is an ASCII letter or digit
+func isAlphanumeric(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,95 @@
+package annotations
+
+import (
+	"strconv"
+	"strings"
+)
+
+// knownAnnotations are the annotations ParseConfig understands
+var knownAnnotations = map[string]bool{
+	AnnotationEnabled:                true,
+	AnnotationProfileName:            true,
+	AnnotationResourceGroup:          true,
+	AnnotationHostname:               true,
+	AnnotationSubscriptionID:         true,
+	AnnotationProfileNameTemplate:    true,
+	AnnotationEndpointNameTemplate:   true,
+	AnnotationRoutingMethod:          true,
+	AnnotationWeight:                 true,
+	AnnotationWeightMode:             true,
+	AnnotationPriority:               true,
+	AnnotationEndpointName:           true,
+	AnnotationEndpointLocation:       true,
+	AnnotationEndpointStatus:         true,
+	AnnotationMaintenance:            true,
+	AnnotationFallbackTarget:         true,
+	AnnotationEndpointCustomHeaders:  true,
+	AnnotationDNSTTL:                 true,
+	AnnotationVanityRecordType:       true,
+	AnnotationMonitorProtocol:        true,
+	AnnotationMonitorPort:            true,
+	AnnotationMonitorPath:            true,
+	AnnotationHealthChecksEnabled:    true,
+	AnnotationProfileStatus:          true,
+	AnnotationTrafficView:            true,
+	AnnotationAllowLargeWeightChange: true,
+	AnnotationFreezeOverride:         true,
+	AnnotationForceProfileSettings:   true,
+	AnnotationDeletionProtection:     true,
+	AnnotationAdopt:                  true,
+	AnnotationTags:                   true,
+	AnnotationCanaryStep:             true,
+	AnnotationCanaryInterval:         true,
+	AnnotationCanaryOnDegraded:       true,
+	AnnotationScheduleDisable:        true,
+	AnnotationScheduleEnable:         true,
+}
+
+// IsKnownAnnotation reports whether key, in the form External DNS passes to the webhook, is a
+// Traffic Manager annotation
+func IsKnownAnnotation(key string) bool {
+	return knownAnnotations[key]
+}
+
+// canonicalValues are the accepted values of annotations whose values are matched case-insensitively
+var canonicalValues = map[string][]string{
+	AnnotationRoutingMethod:    ValidRoutingMethods,
+	AnnotationMonitorProtocol:  ValidMonitorProtocols,
+	AnnotationEndpointStatus:   ValidEndpointStatuses,
+	AnnotationProfileStatus:    ValidProfileStatuses,
+	AnnotationVanityRecordType: ValidVanityRecordTypes,
+	AnnotationCanaryOnDegraded: ValidCanaryOnDegraded,
+	AnnotationWeightMode:       ValidWeightModes,
+}
+
+// boolAnnotations are the annotations holding a boolean
+var boolAnnotations = map[string]bool{
+	AnnotationEnabled:                true,
+	AnnotationMaintenance:            true,
+	AnnotationHealthChecksEnabled:    true,
+	AnnotationTrafficView:            true,
+	AnnotationAllowLargeWeightChange: true,
+	AnnotationFreezeOverride:         true,
+	AnnotationDeletionProtection:     true,
+	AnnotationAdopt:                  true,
+}
+
+// NormalizeValue returns the canonical form of an annotation value: surrounding whitespace is
+// removed, values from a fixed set take the spelling ValidateConfig expects ("weighted" becomes
+// "Weighted") and booleans become "true" or "false". Values that can't be normalized are
+// returned trimmed, for ParseConfig to report.
+func NormalizeValue(key, value string) string {
+	value = strings.TrimSpace(value)
+
+	for _, valid := range canonicalValues[key] {
+		if strings.EqualFold(value, valid) {
+			return valid
+		}
+	}
+	if boolAnnotations[key] {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return strconv.FormatBool(b)
+		}
+	}
+	return value
+}
@@ -0,0 +1,35 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsKnownAnnotation(t *testing.T) {
+	assert.True(t, IsKnownAnnotation(AnnotationWeight))
+	assert.True(t, IsKnownAnnotation(AnnotationScheduleEnable))
+	assert.False(t, IsKnownAnnotation(AnnotationPrefix+"wieght"))
+	assert.False(t, IsKnownAnnotation(ResourceAnnotationPrefix+"weight"), "keys are in the form External DNS passes")
+}
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		key, value, expected string
+	}{
+		{AnnotationRoutingMethod, " weighted ", "Weighted"},
+		{AnnotationMonitorProtocol, "https", "HTTPS"},
+		{AnnotationEndpointStatus, "DISABLED", "Disabled"},
+		{AnnotationVanityRecordType, "CNAME", "cname"},
+		{AnnotationEnabled, "True", "true"},
+		{AnnotationDeletionProtection, "1", "true"},
+		{AnnotationMaintenance, "yes", "yes"},
+		{AnnotationRoutingMethod, "roundrobin", "roundrobin"},
+		{AnnotationWeight, " 50", "50"},
+		{AnnotationMonitorPath, "/Healthz", "/Healthz"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, NormalizeValue(tt.key, tt.value), "%s=%q", tt.key, tt.value)
+	}
+}
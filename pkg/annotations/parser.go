@@ -4,41 +4,82 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
-
-	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"time"
 )
 
 // TrafficManagerConfig holds parsed Traffic Manager configuration from annotations
 type TrafficManagerConfig struct {
 	// Core configuration
-	Enabled       bool
-	ProfileName   string
-	ResourceGroup string
-	Hostname      string // Vanity hostname for Traffic Manager (e.g., demo.example.com)
+	Enabled        bool
+	ProfileName    string
+	ResourceGroup  string
+	Hostname       string // Vanity hostname for Traffic Manager (e.g., demo.example.com)
+	SubscriptionID string // Subscription for the profile; empty means the webhook's default subscription
+
+	// Go templates for generated names; empty means the webhook's configured templates
+	ProfileNameTemplate  string
+	EndpointNameTemplate string
 
 	// Routing configuration
 	RoutingMethod string
 	Weight        int64
 	Priority      int64
+	PriorityAuto  bool    // No priority annotation: Priority routing profiles assign the next free priority
+	WeightMode    string  // See WeightMode*; empty means WeightModeAbsolute
+	WeightPercent float64 // The weight annotation with WeightModePercent, which Weight is converted from
 
 	// Endpoint configuration
 	EndpointName     string
 	EndpointLocation string
 	EndpointStatus   string
+	Maintenance      bool // Endpoint is disabled for maintenance, overriding EndpointStatus
 	EndpointType     string
+	FallbackTarget   string // Served only while every primary endpoint is Degraded; empty means no fallback
+
+	// HTTP headers sent with this endpoint's health probes, by name
+	EndpointCustomHeaders map[string]string
 
 	// DNS configuration
-	DNSTTL int64
+	DNSTTL           int64
+	VanityRecordType string // How the vanity hostname is published (see VanityRecordType*); empty means automatic
 
 	// Monitoring configuration
-	MonitorProtocol      string
-	MonitorPort          int64
-	MonitorPath          string
-	HealthChecksEnabled  bool
+	MonitorProtocol     string
+	MonitorPort         int64
+	MonitorPath         string
+	HealthChecksEnabled bool   // Probe endpoints; false sets them to Always Serve
+	TrafficViewEnabled  bool   // Enrol the profile in Traffic View
+	ProfileStatus       string // Enabled or Disabled, independent of health checks
+
+	// Guardrail overrides
+	AllowLargeWeightChange bool // Bypass the webhook's maximum weight change per apply
+
+	// Keep the profile when its last endpoint is deleted
+	DeletionProtection bool
+	// Take over an existing profile the webhook didn't create
+	Adopt bool
+
+	// Custom Azure tags for the profile, from the defaults and the tags annotation
+	Tags map[string]string
+
+	// Progressive traffic shifting; a step of 0 applies weight changes at once
+	CanaryStepPercent int64         // Share of the weight change applied per step
+	CanaryInterval    time.Duration // Time between steps
+	CanaryOnDegraded  string        // See CanaryOnDegraded*
+
+	// Scheduled status changes, e.g. a nightly maintenance window; both are set or neither
+	DisableSchedule *Schedule // When the endpoint is disabled
+	EnableSchedule  *Schedule // When it is enabled again
 }
 
 // ParseConfig parses Traffic Manager configuration from annotation labels
 func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
+	return ParseConfigWithDefaults(labels, Defaults{})
+}
+
+// ParseConfigWithDefaults parses Traffic Manager configuration from annotation labels,
+// using defaults for settings the annotations leave out
+func ParseConfigWithDefaults(labels map[string]string, defaults Defaults) (*TrafficManagerConfig, error) {
 	config := &TrafficManagerConfig{
 		// Set defaults
 		RoutingMethod:   DefaultRoutingMethod,
@@ -50,7 +91,11 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 		MonitorPath:     DefaultMonitorPath,
 		EndpointStatus:  DefaultEndpointStatus,
 		EndpointType:    DefaultEndpointType,
+		ProfileStatus:   DefaultProfileStatus,
+
+		HealthChecksEnabled: DefaultHealthChecksEnabled,
 	}
+	defaults.apply(config)
 
 	// Check if Traffic Manager is enabled
 	if enabled, ok := labels[AnnotationEnabled]; ok {
@@ -62,7 +107,9 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 	}
 
 	// Parse required fields
-	config.ResourceGroup = labels[AnnotationResourceGroup]
+	if resourceGroup := labels[AnnotationResourceGroup]; resourceGroup != "" {
+		config.ResourceGroup = resourceGroup
+	}
 	if config.ResourceGroup == "" {
 		return nil, fmt.Errorf("annotation %s is required when Traffic Manager is enabled", AnnotationResourceGroup)
 	}
@@ -72,6 +119,19 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 		config.ProfileName = profileName
 	}
 
+	// Parse optional naming templates, rendered by the provider when no name is set
+	if tmpl, ok := labels[AnnotationProfileNameTemplate]; ok && tmpl != "" {
+		config.ProfileNameTemplate = tmpl
+	}
+	if tmpl, ok := labels[AnnotationEndpointNameTemplate]; ok && tmpl != "" {
+		config.EndpointNameTemplate = tmpl
+	}
+
+	// Parse optional subscription ID
+	if subscriptionID, ok := labels[AnnotationSubscriptionID]; ok && subscriptionID != "" {
+		config.SubscriptionID = subscriptionID
+	}
+
 	// Parse optional vanity hostname
 	if hostname, ok := labels[AnnotationHostname]; ok && hostname != "" {
 		config.Hostname = hostname
@@ -82,13 +142,26 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 		config.RoutingMethod = routingMethod
 	}
 
+	if mode, ok := labels[AnnotationWeightMode]; ok && mode != "" {
+		config.WeightMode = strings.ToLower(mode)
+	}
+
 	// Parse weight
 	if weight, ok := labels[AnnotationWeight]; ok && weight != "" {
-		w, err := strconv.ParseInt(weight, 10, 64)
-		if err != nil {
-			return nil, fmt.Errorf("invalid weight value %q: %w", weight, err)
+		if config.WeightMode == WeightModePercent {
+			percent, err := ParseWeightPercent(weight)
+			if err != nil {
+				return nil, err
+			}
+			config.WeightPercent = percent
+			config.Weight = PercentWeight(percent)
+		} else {
+			w, err := strconv.ParseInt(weight, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight value %q: %w", weight, err)
+			}
+			config.Weight = w
 		}
-		config.Weight = w
 	}
 
 	// Parse priority
@@ -98,6 +171,8 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 			return nil, fmt.Errorf("invalid priority value %q: %w", priority, err)
 		}
 		config.Priority = p
+	} else {
+		config.PriorityAuto = true
 	}
 
 	// Parse endpoint name
@@ -115,6 +190,32 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 		config.EndpointStatus = status
 	}
 
+	// Parse maintenance mode, which keeps the endpoint but takes it out of rotation
+	if maintenance, ok := labels[AnnotationMaintenance]; ok && maintenance != "" {
+		enabled, err := strconv.ParseBool(maintenance)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance value %q: %w", maintenance, err)
+		}
+		config.Maintenance = enabled
+		if enabled {
+			config.EndpointStatus = "Disabled"
+		}
+	}
+
+	// Parse fallback target
+	if fallback, ok := labels[AnnotationFallbackTarget]; ok && fallback != "" {
+		config.FallbackTarget = fallback
+	}
+
+	// Parse the endpoint's probe headers
+	if value, ok := labels[AnnotationEndpointCustomHeaders]; ok && value != "" {
+		headers, err := ParseCustomHeaders(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint custom headers: %w", err)
+		}
+		config.EndpointCustomHeaders = headers
+	}
+
 	// Parse DNS TTL
 	if ttl, ok := labels[AnnotationDNSTTL]; ok && ttl != "" {
 		t, err := strconv.ParseInt(ttl, 10, 64)
@@ -129,18 +230,22 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 		config.MonitorProtocol = protocol
 	}
 
-	// Parse monitor port
+	// Parse monitor port; without one, the port follows the protocol
 	if port, ok := labels[AnnotationMonitorPort]; ok && port != "" {
 		p, err := strconv.ParseInt(port, 10, 64)
 		if err != nil {
 			return nil, fmt.Errorf("invalid monitor port value %q: %w", port, err)
 		}
 		config.MonitorPort = p
+	} else if defaults.MonitorPort == 0 {
+		config.MonitorPort = DefaultMonitorPortFor(config.MonitorProtocol)
 	}
 
-	// Parse monitor path
+	// Parse monitor path; TCP probes only connect, so they drop the default path
 	if path, ok := labels[AnnotationMonitorPath]; ok && path != "" {
 		config.MonitorPath = path
+	} else if config.MonitorProtocol == MonitorProtocolTCP {
+		config.MonitorPath = ""
 	}
 
 	// Parse health checks enabled
@@ -152,46 +257,122 @@ func ParseConfig(labels map[string]string) (*TrafficManagerConfig, error) {
 		config.HealthChecksEnabled = enabled
 	}
 
+	// Parse profile status
+	if status, ok := labels[AnnotationProfileStatus]; ok && status != "" {
+		config.ProfileStatus = status
+	}
+
+	// Parse Traffic View enrollment
+	if trafficView, ok := labels[AnnotationTrafficView]; ok && trafficView != "" {
+		enabled, err := strconv.ParseBool(trafficView)
+		if err != nil {
+			return nil, fmt.Errorf("invalid traffic view value %q: %w", trafficView, err)
+		}
+		config.TrafficViewEnabled = enabled
+	}
+
+	if recordType, ok := labels[AnnotationVanityRecordType]; ok && recordType != "" {
+		config.VanityRecordType = strings.ToLower(recordType)
+	}
+
+	if allow, ok := labels[AnnotationAllowLargeWeightChange]; ok && allow != "" {
+		allowed, err := strconv.ParseBool(allow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow large weight change value %q: %w", allow, err)
+		}
+		config.AllowLargeWeightChange = allowed
+	}
+
+	if protect, ok := labels[AnnotationDeletionProtection]; ok && protect != "" {
+		protected, err := strconv.ParseBool(protect)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deletion protection value %q: %w", protect, err)
+		}
+		config.DeletionProtection = protected
+	}
+
+	if adopt, ok := labels[AnnotationAdopt]; ok && adopt != "" {
+		adopted, err := strconv.ParseBool(adopt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid adopt value %q: %w", adopt, err)
+		}
+		config.Adopt = adopted
+	}
+
+	if value, ok := labels[AnnotationTags]; ok && value != "" {
+		tags, err := ParseTags(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tags: %w", err)
+		}
+		config.Tags = mergeTags(config.Tags, tags)
+		if err := ValidateTags(config.Tags); err != nil {
+			return nil, fmt.Errorf("invalid tags: %w", err)
+		}
+	}
+
+	if step, ok := labels[AnnotationCanaryStep]; ok && step != "" {
+		s, err := strconv.ParseInt(strings.TrimSuffix(step, "%"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid canary step value %q: %w", step, err)
+		}
+		config.CanaryStepPercent = s
+		config.CanaryOnDegraded = CanaryOnDegradedPause
+	}
+
+	if interval, ok := labels[AnnotationCanaryInterval]; ok && interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid canary interval value %q: %w", interval, err)
+		}
+		config.CanaryInterval = d
+	}
+
+	if onDegraded, ok := labels[AnnotationCanaryOnDegraded]; ok && onDegraded != "" {
+		config.CanaryOnDegraded = strings.ToLower(onDegraded)
+	}
+
+	if spec, ok := labels[AnnotationScheduleDisable]; ok && spec != "" {
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disable schedule: %w", err)
+		}
+		config.DisableSchedule = schedule
+	}
+
+	if spec, ok := labels[AnnotationScheduleEnable]; ok && spec != "" {
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enable schedule: %w", err)
+		}
+		config.EnableSchedule = schedule
+	}
+
 	return config, nil
 }
 
-// ToProfileConfig converts TrafficManagerConfig to trafficmanager.ProfileConfig
-func (c *TrafficManagerConfig) ToProfileConfig() *trafficmanager.ProfileConfig {
-	config := trafficmanager.DefaultProfileConfig()
-	
-	if c.ProfileName != "" {
-		config.ProfileName = c.ProfileName
-	}
-	config.ResourceGroup = c.ResourceGroup
-	config.RoutingMethod = c.RoutingMethod
-	config.DNSTTL = c.DNSTTL
-	config.MonitorProtocol = c.MonitorProtocol
-	config.MonitorPort = c.MonitorPort
-	config.MonitorPath = c.MonitorPath
-	config.HealthChecksEnabled = c.HealthChecksEnabled
-	
-	// Add managed-by tag
-	if config.Tags == nil {
-		config.Tags = make(map[string]string)
-	}
-	config.Tags["managedBy"] = "external-dns-traffic-manager-webhook"
-	
-	return config
+// DefaultMonitorPortFor returns the port health checks use for protocol when none is set: 80 for
+// HTTP and 443 otherwise
+func DefaultMonitorPortFor(protocol string) int64 {
+	if protocol == MonitorProtocolHTTP {
+		return DefaultHTTPMonitorPort
+	}
+	return DefaultMonitorPort
 }
 
-// ToEndpointConfig converts TrafficManagerConfig to trafficmanager.EndpointConfig
-func (c *TrafficManagerConfig) ToEndpointConfig(target string) *trafficmanager.EndpointConfig {
-	config := trafficmanager.DefaultEndpointConfig()
-	
-	if c.EndpointName != "" {
-		config.EndpointName = c.EndpointName
-	}
-	config.EndpointType = c.EndpointType
-	config.Target = target
-	config.Weight = c.Weight
-	config.Priority = c.Priority
-	config.Status = c.EndpointStatus
-	config.Location = c.EndpointLocation
-	
-	return config
+// NormalizeAnnotations returns a copy of annotations with resource-style keys
+// (external-dns.alpha.kubernetes.io/webhook-traffic-manager-*) rewritten to the
+// keys External DNS passes to the webhook, so both forms can be parsed.
+// When both forms of a key are present the transformed one wins.
+func NormalizeAnnotations(annotations map[string]string) map[string]string {
+	normalized := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		if strings.HasPrefix(k, ResourceAnnotationPrefix) {
+			k = AnnotationPrefix + strings.TrimPrefix(k, ResourceAnnotationPrefix)
+			if _, ok := annotations[k]; ok {
+				continue
+			}
+		}
+		normalized[k] = v
+	}
+	return normalized
 }
@@ -2,6 +2,7 @@ package annotations
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -137,52 +138,70 @@ func TestParseConfig_InvalidMonitorPort(t *testing.T) {
 	assert.Contains(t, err.Error(), "port")
 }
 
-func TestToProfileConfig(t *testing.T) {
-	config := &TrafficManagerConfig{
-		Enabled:         true,
-		ProfileName:     "my-profile",
-		ResourceGroup:   "my-rg",
-		RoutingMethod:   "Weighted",
-		DNSTTL:          45,
-		MonitorProtocol: "HTTPS",
-		MonitorPort:     443,
-		MonitorPath:     "/healthz",
+func TestParseConfig_MonitorDefaultsFollowProtocol(t *testing.T) {
+	parse := func(extra map[string]string) *TrafficManagerConfig {
+		labels := map[string]string{AnnotationEnabled: "true", AnnotationResourceGroup: "my-rg"}
+		for k, v := range extra {
+			labels[k] = v
+		}
+		config, err := ParseConfig(labels)
+		require.NoError(t, err)
+		return config
 	}
 
-	profileConfig := config.ToProfileConfig()
-
-	assert.Equal(t, "my-profile", profileConfig.ProfileName)
-	assert.Equal(t, "my-rg", profileConfig.ResourceGroup)
-	assert.Equal(t, "Weighted", profileConfig.RoutingMethod)
-	assert.Equal(t, int64(45), profileConfig.DNSTTL)
-	assert.Equal(t, "HTTPS", profileConfig.MonitorProtocol)
-	assert.Equal(t, int64(443), profileConfig.MonitorPort)
-	assert.Equal(t, "/healthz", profileConfig.MonitorPath)
-	assert.Equal(t, "global", profileConfig.Location)
-	assert.Contains(t, profileConfig.Tags, "managedBy")
-	assert.Equal(t, "external-dns-traffic-manager-webhook", profileConfig.Tags["managedBy"])
-}
-
-func TestToEndpointConfig(t *testing.T) {
-	config := &TrafficManagerConfig{
-		EndpointName:     "test-endpoint",
-		EndpointLocation: "West US",
-		EndpointType:     DefaultEndpointType,
-		Weight:           200,
-		Priority:         3,
-		EndpointStatus:   "Enabled",
-	}
+	config := parse(map[string]string{AnnotationMonitorProtocol: "HTTP"})
+	assert.Equal(t, int64(80), config.MonitorPort)
+	assert.Equal(t, "/", config.MonitorPath)
+
+	config = parse(map[string]string{AnnotationMonitorProtocol: "HTTPS"})
+	assert.Equal(t, int64(443), config.MonitorPort)
+
+	config = parse(map[string]string{AnnotationMonitorProtocol: "TCP", AnnotationMonitorPort: "5432"})
+	assert.Equal(t, int64(5432), config.MonitorPort)
+	assert.Empty(t, config.MonitorPath, "TCP drops the default path")
+
+	config = parse(map[string]string{AnnotationMonitorProtocol: "HTTP", AnnotationMonitorPort: "8080"})
+	assert.Equal(t, int64(8080), config.MonitorPort, "an explicit port wins")
+
+	config, err := ParseConfigWithDefaults(map[string]string{AnnotationEnabled: "true", AnnotationResourceGroup: "my-rg", AnnotationMonitorProtocol: "HTTP"}, Defaults{MonitorPort: 8443})
+	require.NoError(t, err)
+	assert.Equal(t, int64(8443), config.MonitorPort, "a namespace default port wins")
+}
 
-	target := "20.30.40.50"
-	endpointConfig := config.ToEndpointConfig(target)
+func TestParseConfig_TrafficView(t *testing.T) {
+	labels := map[string]string{AnnotationEnabled: "true", AnnotationResourceGroup: "my-rg"}
+	config, err := ParseConfig(labels)
+	require.NoError(t, err)
+	assert.False(t, config.TrafficViewEnabled)
 
-	assert.Equal(t, "test-endpoint", endpointConfig.EndpointName)
-	assert.Equal(t, target, endpointConfig.Target)
-	assert.Equal(t, int64(200), endpointConfig.Weight)
-	assert.Equal(t, int64(3), endpointConfig.Priority)
-	assert.Equal(t, "Enabled", endpointConfig.Status)
-	assert.Equal(t, "West US", endpointConfig.Location)
-	assert.Equal(t, DefaultEndpointType, endpointConfig.EndpointType)
+	labels[AnnotationTrafficView] = "true"
+	config, err = ParseConfig(labels)
+	require.NoError(t, err)
+	assert.True(t, config.TrafficViewEnabled)
+
+	labels[AnnotationTrafficView] = "sometimes"
+	_, err = ParseConfig(labels)
+	assert.Error(t, err)
+}
+
+func TestParseConfig_ProfileStatus(t *testing.T) {
+	labels := map[string]string{AnnotationEnabled: "true", AnnotationResourceGroup: "my-rg"}
+	config, err := ParseConfig(labels)
+	require.NoError(t, err)
+	assert.Equal(t, "Enabled", config.ProfileStatus)
+	assert.True(t, config.HealthChecksEnabled)
+
+	labels[AnnotationProfileStatus] = "Disabled"
+	config, err = ParseConfig(labels)
+	require.NoError(t, err)
+	assert.Equal(t, "Disabled", config.ProfileStatus)
+	assert.True(t, config.HealthChecksEnabled, "disabling the profile leaves health checks alone")
+
+	labels[AnnotationHealthChecksEnabled] = "false"
+	config, err = ParseConfig(labels)
+	require.NoError(t, err)
+	assert.False(t, config.HealthChecksEnabled)
+	assert.Equal(t, "Disabled", config.ProfileStatus)
 }
 
 func TestAnnotationConstants(t *testing.T) {
@@ -276,3 +295,287 @@ func TestParseConfig_OnlyPartialFields(t *testing.T) {
 	assert.Equal(t, DefaultRoutingMethod, config.RoutingMethod)
 	assert.Equal(t, DefaultMonitorProtocol, config.MonitorProtocol)
 }
+
+func TestParseConfig_SubscriptionID(t *testing.T) {
+	labels := map[string]string{
+		AnnotationEnabled:        "true",
+		AnnotationResourceGroup:  "my-rg",
+		AnnotationSubscriptionID: "00000000-0000-0000-0000-000000000001",
+	}
+
+	config, err := ParseConfig(labels)
+	require.NoError(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", config.SubscriptionID)
+}
+
+func TestParseConfig_FallbackTarget(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:        "true",
+		AnnotationResourceGroup:  "my-rg",
+		AnnotationFallbackTarget: "status.example.com",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "status.example.com", config.FallbackTarget)
+}
+
+func TestParseConfig_Canary(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:        "true",
+		AnnotationResourceGroup:  "my-rg",
+		AnnotationCanaryStep:     "10%",
+		AnnotationCanaryInterval: "5m",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), config.CanaryStepPercent)
+	assert.Equal(t, 5*time.Minute, config.CanaryInterval)
+	assert.Equal(t, CanaryOnDegradedPause, config.CanaryOnDegraded)
+
+	config, err = ParseConfig(map[string]string{
+		AnnotationEnabled:          "true",
+		AnnotationResourceGroup:    "my-rg",
+		AnnotationCanaryStep:       "25",
+		AnnotationCanaryInterval:   "1m",
+		AnnotationCanaryOnDegraded: "Rollback",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, CanaryOnDegradedRollback, config.CanaryOnDegraded)
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:        "true",
+		AnnotationResourceGroup:  "my-rg",
+		AnnotationCanaryStep:     "10",
+		AnnotationCanaryInterval: "often",
+	})
+	assert.ErrorContains(t, err, "invalid canary interval")
+}
+
+func TestParseConfig_AllowLargeWeightChange(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:                "true",
+		AnnotationResourceGroup:          "my-rg",
+		AnnotationAllowLargeWeightChange: "true",
+	})
+	require.NoError(t, err)
+	assert.True(t, config.AllowLargeWeightChange)
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:                "true",
+		AnnotationResourceGroup:          "my-rg",
+		AnnotationAllowLargeWeightChange: "sometimes",
+	})
+	assert.Error(t, err)
+}
+
+func TestParseConfig_VanityRecordType(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:          "true",
+		AnnotationResourceGroup:    "my-rg",
+		AnnotationVanityRecordType: "Alias",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, VanityRecordTypeAlias, config.VanityRecordType)
+}
+
+func TestParseConfig_Maintenance(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:        "true",
+		AnnotationResourceGroup:  "my-rg",
+		AnnotationEndpointStatus: "Enabled",
+		AnnotationMaintenance:    "true",
+	})
+	require.NoError(t, err)
+	assert.True(t, config.Maintenance)
+	assert.Equal(t, "Disabled", config.EndpointStatus, "maintenance overrides the endpoint status")
+
+	config, err = ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationMaintenance:   "false",
+	})
+	require.NoError(t, err)
+	assert.False(t, config.Maintenance)
+	assert.Equal(t, DefaultEndpointStatus, config.EndpointStatus)
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationMaintenance:   "later",
+	})
+	assert.ErrorContains(t, err, "invalid maintenance value")
+}
+
+func TestParseConfig_DeletionProtection(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:            "true",
+		AnnotationResourceGroup:      "my-rg",
+		AnnotationDeletionProtection: "true",
+	})
+	require.NoError(t, err)
+	assert.True(t, config.DeletionProtection)
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:            "true",
+		AnnotationResourceGroup:      "my-rg",
+		AnnotationDeletionProtection: "always",
+	})
+	assert.ErrorContains(t, err, "invalid deletion protection value")
+}
+
+func TestParseConfig_Adopt(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationAdopt:         "true",
+	})
+	require.NoError(t, err)
+	assert.True(t, config.Adopt)
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationAdopt:         "maybe",
+	})
+	assert.ErrorContains(t, err, "invalid adopt value")
+}
+
+func TestParseConfig_NameTemplates(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:              "true",
+		AnnotationResourceGroup:        "my-rg",
+		AnnotationProfileNameTemplate:  "{{ .Namespace }}-{{ .Hostname }}",
+		AnnotationEndpointNameTemplate: "{{ .Cluster }}",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "{{ .Namespace }}-{{ .Hostname }}", config.ProfileNameTemplate)
+	assert.Equal(t, "{{ .Cluster }}", config.EndpointNameTemplate)
+}
+
+func TestParseConfigWithDefaults(t *testing.T) {
+	defaults := Defaults{
+		ResourceGroup:   "default-rg",
+		RoutingMethod:   "Priority",
+		MonitorProtocol: "HTTP",
+		MonitorPort:     8080,
+		MonitorPath:     "/healthz",
+	}
+
+	config, err := ParseConfigWithDefaults(map[string]string{AnnotationEnabled: "true"}, defaults)
+	require.NoError(t, err)
+	assert.Equal(t, "default-rg", config.ResourceGroup)
+	assert.Equal(t, "Priority", config.RoutingMethod)
+	assert.Equal(t, "HTTP", config.MonitorProtocol)
+	assert.Equal(t, int64(8080), config.MonitorPort)
+	assert.Equal(t, "/healthz", config.MonitorPath)
+
+	// Annotations take precedence over defaults
+	config, err = ParseConfigWithDefaults(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationRoutingMethod: "Weighted",
+		AnnotationMonitorPort:   "443",
+	}, defaults)
+	require.NoError(t, err)
+	assert.Equal(t, "my-rg", config.ResourceGroup)
+	assert.Equal(t, "Weighted", config.RoutingMethod)
+	assert.Equal(t, int64(443), config.MonitorPort)
+	assert.Equal(t, "/healthz", config.MonitorPath)
+}
+
+func TestParseDefaults(t *testing.T) {
+	defaults, err := ParseDefaults(map[string]string{
+		DefaultsKeyResourceGroup:    "team-rg",
+		DefaultsKeyMonitorPort:      "8443",
+		DefaultsKeyEndpointLocation: "westeurope",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, Defaults{ResourceGroup: "team-rg", MonitorPort: 8443, EndpointLocation: "westeurope"}, defaults)
+
+	_, err = ParseDefaults(map[string]string{"weight": "10"})
+	assert.ErrorContains(t, err, `unknown defaults key "weight"`)
+
+	_, err = ParseDefaults(map[string]string{DefaultsKeyMonitorPort: "https"})
+	assert.ErrorContains(t, err, "invalid monitor port")
+
+	_, err = ParseDefaults(map[string]string{DefaultsKeyRoutingMethod: "RoundRobin"})
+	assert.ErrorContains(t, err, "invalid default routing method")
+}
+
+func TestDefaultsMerge(t *testing.T) {
+	global := Defaults{ResourceGroup: "global-rg", RoutingMethod: "Priority", MonitorPath: "/healthz"}
+	merged := global.Merge(Defaults{ResourceGroup: "team-rg", EndpointLocation: "eastus"})
+
+	assert.Equal(t, Defaults{
+		ResourceGroup:    "team-rg",
+		RoutingMethod:    "Priority",
+		MonitorPath:      "/healthz",
+		EndpointLocation: "eastus",
+	}, merged)
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags("costCenter=1234, team = payments ,env=")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"costCenter": "1234", "team": "payments", "env": ""}, tags)
+
+	_, err = ParseTags("team")
+	assert.ErrorContains(t, err, "must be key=value")
+
+	_, err = ParseTags("=payments")
+	assert.ErrorContains(t, err, "tag key is empty")
+
+	_, err = ParseTags("team/name=payments")
+	assert.ErrorContains(t, err, "must not contain")
+
+	_, err = ParseTags("ManagedBy=someone-else")
+	assert.ErrorContains(t, err, "set by the webhook")
+
+	_, err = ParseTags("endpointMetadata2=x")
+	assert.ErrorContains(t, err, "set by the webhook")
+}
+
+func TestParseConfig_Tags(t *testing.T) {
+	defaults := Defaults{Tags: map[string]string{"costCenter": "1234", "env": "prod"}}
+
+	config, err := ParseConfigWithDefaults(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationTags:          "team=payments,env=staging",
+	}, defaults)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"costCenter": "1234", "team": "payments", "env": "staging"}, config.Tags)
+	assert.Equal(t, "prod", defaults.Tags["env"], "the defaults aren't modified")
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationTags:          "hostname=other.example.com",
+	})
+	assert.ErrorContains(t, err, "invalid tags")
+}
+
+func TestDefaultsMerge_Tags(t *testing.T) {
+	global := Defaults{Tags: map[string]string{"costCenter": "1234", "env": "prod"}}
+	merged := global.Merge(Defaults{Tags: map[string]string{"env": "dev", "team": "payments"}})
+
+	assert.Equal(t, map[string]string{"costCenter": "1234", "env": "dev", "team": "payments"}, merged.Tags)
+	assert.Equal(t, "prod", global.Tags["env"])
+
+	defaults, err := ParseDefaults(map[string]string{DefaultsKeyTags: "team=payments"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments"}, defaults.Tags)
+}
+
+func TestNormalizeAnnotations(t *testing.T) {
+	normalized := NormalizeAnnotations(map[string]string{
+		ResourceAnnotationPrefix + "weight":         "10",
+		ResourceAnnotationPrefix + "resource-group": "resource-rg",
+		AnnotationResourceGroup:                     "webhook-rg",
+		"resource":                                  "service/default/demo",
+	})
+
+	assert.Equal(t, map[string]string{
+		AnnotationWeight:        "10",
+		AnnotationResourceGroup: "webhook-rg",
+		"resource":              "service/default/demo",
+	}, normalized)
+}
@@ -0,0 +1,219 @@
+package annotations
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleSearchLimit bounds the search for a schedule's next or previous time, so specs
+// that can never fire (e.g. "0 0 31 2 *") don't loop forever
+const scheduleSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Schedule is a standard five-field cron expression ("minute hour day-of-month month day-of-week")
+// used to enable and disable endpoints at set times. An optional "CRON_TZ=<zone> " prefix sets the
+// time zone the fields are read in; the default is UTC.
+type Schedule struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+
+	// When both day fields are restricted, a time matches either of them, as in cron
+	anyDay     bool
+	anyWeekday bool
+
+	location *time.Location
+	spec     string
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// ParseSchedule parses a cron expression such as "0 1 * * mon-fri" or "CRON_TZ=Europe/London 30 2 * * *"
+func ParseSchedule(spec string) (*Schedule, error) {
+	s := &Schedule{location: time.UTC, spec: strings.TrimSpace(spec)}
+
+	fields := strings.Fields(spec)
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "CRON_TZ=") {
+		location, err := time.LoadLocation(strings.TrimPrefix(fields[0], "CRON_TZ="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		s.location = location
+		fields = fields[1:]
+	}
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q, expected \"<minute> <hour> <day-of-month> <month> <day-of-week>\"", spec)
+	}
+
+	var err error
+	if s.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q minute: %w", spec, err)
+	}
+	if s.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q hour: %w", spec, err)
+	}
+	if s.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q day of month: %w", spec, err)
+	}
+	if s.months, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q month: %w", spec, err)
+	}
+	if s.weekdays, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q day of week: %w", spec, err)
+	}
+	// 7 is also Sunday
+	if s.weekdays&(1<<7) != 0 {
+		s.weekdays |= 1
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeekday = fields[4] == "*"
+
+	return s, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges ("1-5") and steps ("*/15", "0-30/10")
+// into a bitset of the values it allows
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*":
+			low, high = min, max
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = parseCronValue(from, min, max, names); err != nil {
+				return 0, err
+			}
+			if high, err = parseCronValue(to, min, max, names); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := parseCronValue(rangePart, min, max, names)
+			if err != nil {
+				return 0, err
+			}
+			low, high = value, value
+			if hasStep {
+				high = max
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, min, max int, names map[string]int) (int, error) {
+	if n, ok := names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if n < min || n > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", n, min, max)
+	}
+	return n, nil
+}
+
+// String returns the schedule as it was written, or "" for no schedule
+func (s *Schedule) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.spec
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weekdays&(1<<uint(t.Weekday())) != 0
+	if !s.anyDay && !s.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Next returns the first time after t the schedule fires, or the zero time if it never does
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(scheduleSearchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Prev returns the last time at or before t the schedule fired, or the zero time if it never did
+func (s *Schedule) Prev(t time.Time) time.Time {
+	t = t.In(s.location).Truncate(time.Minute)
+	limit := t.Add(-scheduleSearchLimit)
+
+	for t.After(limit) {
+		switch {
+		case s.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.location).Add(-time.Minute)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location).Add(-time.Minute)
+		case s.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.location).Add(-time.Minute)
+		case s.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(-time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ScheduledStatus returns the endpoint status a pair of schedules gives at t: Disabled when the
+// disable schedule fired more recently than the enable schedule, Enabled otherwise
+func ScheduledStatus(disable, enable *Schedule, t time.Time) string {
+	disabledAt := disable.Prev(t)
+	if disabledAt.IsZero() {
+		return "Enabled"
+	}
+	if disabledAt.After(enable.Prev(t)) {
+		return "Disabled"
+	}
+	return "Enabled"
+}
@@ -0,0 +1,100 @@
+package annotations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, spec := range []string{
+		"0 1 * * *",
+		"*/15 0-6 * * mon-fri",
+		"0 22 1,15 * *",
+		"30 2 * jan-mar 0,7",
+		"CRON_TZ=Europe/London 0 1 * * *",
+	} {
+		s, err := ParseSchedule(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(t, spec, s.String())
+	}
+
+	for _, spec := range []string{
+		"",
+		"0 1 * *",
+		"60 1 * * *",
+		"0 24 * * *",
+		"0 1 0 * *",
+		"0 1 * 13 *",
+		"0 1 * * 8",
+		"0 5-1 * * *",
+		"*/0 1 * * *",
+		"0 1 * * someday",
+		"CRON_TZ=Nowhere/Special 0 1 * * *",
+	} {
+		_, err := ParseSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+
+	var none *Schedule
+	assert.Equal(t, "", none.String())
+}
+
+func TestSchedule_NextPrev(t *testing.T) {
+	s, err := ParseSchedule("0 1 * * mon-fri")
+	require.NoError(t, err)
+
+	// Thursday 15 October 2026
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC), s.Next(now))
+	assert.Equal(t, time.Date(2026, 10, 15, 1, 0, 0, 0, time.UTC), s.Prev(now))
+
+	// Friday's run is followed by Monday's
+	assert.Equal(t, time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC), s.Next(time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC)))
+	// Prev includes the current minute
+	assert.Equal(t, time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC), s.Prev(time.Date(2026, 10, 16, 1, 0, 30, 0, time.UTC)))
+	assert.Equal(t, time.Date(2026, 10, 16, 1, 0, 0, 0, time.UTC), s.Prev(time.Date(2026, 10, 18, 23, 0, 0, 0, time.UTC)))
+
+	// Both day fields restricted: either matches
+	s, err = ParseSchedule("0 0 1 * sun")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), s.Next(now))
+	assert.Equal(t, time.Date(2026, 10, 11, 0, 0, 0, 0, time.UTC), s.Prev(now))
+	assert.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), s.Next(time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)))
+
+	// Schedules that never fire
+	s, err = ParseSchedule("0 0 31 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.Next(now).IsZero())
+	assert.True(t, s.Prev(now).IsZero())
+}
+
+func TestSchedule_TimeZone(t *testing.T) {
+	s, err := ParseSchedule("CRON_TZ=America/New_York 0 1 * * *")
+	require.NoError(t, err)
+
+	// 01:00 in New York is 05:00 UTC during daylight saving time
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	assert.True(t, s.Next(now).Equal(time.Date(2026, 10, 16, 5, 0, 0, 0, time.UTC)))
+}
+
+func TestScheduledStatus(t *testing.T) {
+	disable, err := ParseSchedule("0 1 * * *")
+	require.NoError(t, err)
+	enable, err := ParseSchedule("0 3 * * *")
+	require.NoError(t, err)
+
+	day := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "Enabled", ScheduledStatus(disable, enable, day.Add(30*time.Minute)))
+	assert.Equal(t, "Disabled", ScheduledStatus(disable, enable, day.Add(time.Hour)))
+	assert.Equal(t, "Disabled", ScheduledStatus(disable, enable, day.Add(2*time.Hour+59*time.Minute)))
+	assert.Equal(t, "Enabled", ScheduledStatus(disable, enable, day.Add(3*time.Hour)))
+
+	// A window that spans midnight
+	disable, err = ParseSchedule("0 22 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, "Disabled", ScheduledStatus(disable, enable, day.Add(time.Hour)))
+	assert.Equal(t, "Enabled", ScheduledStatus(disable, enable, day.Add(12*time.Hour)))
+}
@@ -0,0 +1,95 @@
+package annotations
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Azure tag limits
+const (
+	MaxTagKeyLength   = 512
+	MaxTagValueLength = 256
+
+	// MaxCustomTags leaves room under Azure's 50 tags per resource for the tags the webhook writes itself
+	MaxCustomTags = 45
+)
+
+// endpointMetadataTag is the first of the profile tags holding endpoint metadata
+const endpointMetadataTag = "endpointMetadata"
+
+// reservedTagKeys are the profile tags the webhook writes itself; custom tags can't set them
+var reservedTagKeys = []string{"managedBy", "hostname", endpointMetadataTag, "deletionProtection", "deleteAfter"}
+
+// ParseTags parses custom Azure tags written as "key=value,key=value" and validates them
+func ParseTags(value string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid tag %q, must be key=value", pair)
+		}
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	if err := ValidateTags(tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// ValidateTags checks custom tags against Azure's tag rules and the tags the webhook reserves
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > MaxCustomTags {
+		return fmt.Errorf("%d tags set, at most %d custom tags are allowed", len(tags), MaxCustomTags)
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "" {
+			return fmt.Errorf("tag key is empty")
+		}
+		if len(key) > MaxTagKeyLength {
+			return fmt.Errorf("tag key %q is longer than %d characters", key, MaxTagKeyLength)
+		}
+		if strings.ContainsAny(key, `<>%&\?/`) {
+			return fmt.Errorf(`tag key %q must not contain any of <>%%&\?/`, key)
+		}
+		for _, reserved := range reservedTagKeys {
+			if strings.EqualFold(key, reserved) {
+				return fmt.Errorf("tag %q is set by the webhook and can't be overridden", key)
+			}
+		}
+		// Endpoint metadata continues in endpointMetadata2, endpointMetadata3, ...
+		if len(key) > len(endpointMetadataTag) && strings.EqualFold(key[:len(endpointMetadataTag)], endpointMetadataTag) {
+			return fmt.Errorf("tag %q is set by the webhook and can't be overridden", key)
+		}
+		if len(tags[key]) > MaxTagValueLength {
+			return fmt.Errorf("value of tag %q is longer than %d characters", key, MaxTagValueLength)
+		}
+	}
+	return nil
+}
+
+// mergeTags returns the tags of base with those of override applied on top, or nil when both are empty
+func mergeTags(base, override map[string]string) map[string]string {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
@@ -2,8 +2,36 @@ package annotations
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 )
 
+// Values accepted by ValidateConfig
+var (
+	ValidRoutingMethods    = []string{"Weighted", "Priority", "Performance", "Geographic"}
+	ValidMonitorProtocols  = []string{MonitorProtocolHTTP, MonitorProtocolHTTPS, MonitorProtocolTCP}
+	ValidEndpointStatuses  = []string{"Enabled", "Disabled"}
+	ValidProfileStatuses   = []string{"Enabled", "Disabled"}
+	ValidVanityRecordTypes = []string{VanityRecordTypeCNAME, VanityRecordTypeAlias, VanityRecordTypeNone}
+	FallbackRoutingMethods = []string{"Weighted", "Priority"}
+	ValidCanaryOnDegraded  = []string{CanaryOnDegradedPause, CanaryOnDegradedRollback}
+	ValidWeightModes       = []string{WeightModeAbsolute, WeightModePercent}
+)
+
+// Ranges accepted by ValidateConfig
+const (
+	MinWeight      = 1
+	MaxWeight      = 1000
+	MinPriority    = 1
+	MaxPriority    = 1000
+	MinDNSTTL      = 30
+	MinMonitorPort = 1
+	MaxMonitorPort = 65535
+)
+
+// subscriptionIDPattern matches an Azure subscription ID (GUID)
+var subscriptionIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 // ValidateConfig validates a TrafficManagerConfig
 func ValidateConfig(config *TrafficManagerConfig) error {
 	if !config.Enabled {
@@ -15,42 +43,124 @@ func ValidateConfig(config *TrafficManagerConfig) error {
 		return fmt.Errorf("resource group is required")
 	}
 
+	// Validate subscription ID format if specified
+	if config.SubscriptionID != "" && !subscriptionIDPattern.MatchString(config.SubscriptionID) {
+		return fmt.Errorf("invalid subscription ID %q, must be a GUID", config.SubscriptionID)
+	}
+
+	// Explicit names are used as given, so they must already satisfy Azure's naming rules
+	if config.ProfileName != "" {
+		if err := ValidateProfileName(config.ProfileName); err != nil {
+			return err
+		}
+	}
+	if config.EndpointName != "" {
+		if err := ValidateEndpointName(config.EndpointName); err != nil {
+			return err
+		}
+	}
+
+	// The vanity hostname is published as a DNS record, so it must be a DNS name
+	if config.Hostname != "" {
+		if err := ValidateHostname(config.Hostname); err != nil {
+			return err
+		}
+	}
+
+	// Percentages are converted to weights, so they need weighted routing and an explicit weight
+	if config.WeightMode != "" && !contains(ValidWeightModes, config.WeightMode) {
+		return fmt.Errorf("invalid weight mode %q, must be one of: %v", config.WeightMode, ValidWeightModes)
+	}
+	if config.WeightMode == WeightModePercent {
+		if config.RoutingMethod != "Weighted" {
+			return fmt.Errorf("weight mode %s requires routing method Weighted, got %q", WeightModePercent, config.RoutingMethod)
+		}
+		if config.WeightPercent <= 0 || config.WeightPercent > 100 {
+			return fmt.Errorf("weight mode %s requires a weight between 0.1%% and 100%%, got %v%%", WeightModePercent, config.WeightPercent)
+		}
+	}
+
 	// Validate weight range (1-1000)
-	if config.Weight < 1 || config.Weight > 1000 {
-		return fmt.Errorf("weight must be between 1 and 1000, got %d", config.Weight)
+	if config.Weight < MinWeight || config.Weight > MaxWeight {
+		return fmt.Errorf("weight must be between %d and %d, got %d", MinWeight, MaxWeight, config.Weight)
 	}
 
 	// Validate priority range (1-1000)
-	if config.Priority < 1 || config.Priority > 1000 {
-		return fmt.Errorf("priority must be between 1 and 1000, got %d", config.Priority)
+	if config.Priority < MinPriority || config.Priority > MaxPriority {
+		return fmt.Errorf("priority must be between %d and %d, got %d", MinPriority, MaxPriority, config.Priority)
 	}
 
 	// Validate routing method
-	validRoutingMethods := []string{"Weighted", "Priority", "Performance", "Geographic"}
-	if !contains(validRoutingMethods, config.RoutingMethod) {
-		return fmt.Errorf("invalid routing method %q, must be one of: %v", config.RoutingMethod, validRoutingMethods)
+	if !contains(ValidRoutingMethods, config.RoutingMethod) {
+		return fmt.Errorf("invalid routing method %q, must be one of: %v", config.RoutingMethod, ValidRoutingMethods)
 	}
 
 	// Validate monitor protocol
-	validProtocols := []string{"HTTP", "HTTPS", "TCP"}
-	if !contains(validProtocols, config.MonitorProtocol) {
-		return fmt.Errorf("invalid monitor protocol %q, must be one of: %v", config.MonitorProtocol, validProtocols)
+	if !contains(ValidMonitorProtocols, config.MonitorProtocol) {
+		return fmt.Errorf("invalid monitor protocol %q, must be one of: %v", config.MonitorProtocol, ValidMonitorProtocols)
+	}
+
+	// Azure probes HTTP and HTTPS endpoints at a path, "/" when empty, and rejects a path for TCP
+	if config.MonitorProtocol == MonitorProtocolTCP && config.MonitorPath != "" {
+		return fmt.Errorf("monitor path %q can't be used with monitor protocol %s", config.MonitorPath, MonitorProtocolTCP)
+	}
+	// Headers are only sent with HTTP and HTTPS probes
+	if config.MonitorProtocol == MonitorProtocolTCP && len(config.EndpointCustomHeaders) > 0 {
+		return fmt.Errorf("endpoint custom headers can't be used with monitor protocol %s", MonitorProtocolTCP)
+	}
+	if config.MonitorPath != "" && !strings.HasPrefix(config.MonitorPath, "/") {
+		return fmt.Errorf("monitor path must start with /, got %q", config.MonitorPath)
 	}
 
 	// Validate endpoint status
-	validStatuses := []string{"Enabled", "Disabled"}
-	if !contains(validStatuses, config.EndpointStatus) {
-		return fmt.Errorf("invalid endpoint status %q, must be one of: %v", config.EndpointStatus, validStatuses)
+	if !contains(ValidEndpointStatuses, config.EndpointStatus) {
+		return fmt.Errorf("invalid endpoint status %q, must be one of: %v", config.EndpointStatus, ValidEndpointStatuses)
+	}
+
+	// Validate profile status, empty meaning Enabled
+	if config.ProfileStatus != "" && !contains(ValidProfileStatuses, config.ProfileStatus) {
+		return fmt.Errorf("invalid profile status %q, must be one of: %v", config.ProfileStatus, ValidProfileStatuses)
 	}
 
 	// Validate DNS TTL (minimum 30 seconds)
-	if config.DNSTTL < 30 {
-		return fmt.Errorf("DNS TTL must be at least 30 seconds, got %d", config.DNSTTL)
+	if config.DNSTTL < MinDNSTTL {
+		return fmt.Errorf("DNS TTL must be at least %d seconds, got %d", MinDNSTTL, config.DNSTTL)
 	}
 
 	// Validate monitor port
-	if config.MonitorPort < 1 || config.MonitorPort > 65535 {
-		return fmt.Errorf("monitor port must be between 1 and 65535, got %d", config.MonitorPort)
+	if config.MonitorPort < MinMonitorPort || config.MonitorPort > MaxMonitorPort {
+		return fmt.Errorf("monitor port must be between %d and %d, got %d", MinMonitorPort, MaxMonitorPort, config.MonitorPort)
+	}
+
+	// Validate vanity record type
+	if config.VanityRecordType != "" && !contains(ValidVanityRecordTypes, config.VanityRecordType) {
+		return fmt.Errorf("invalid vanity record type %q, must be one of: %v", config.VanityRecordType, ValidVanityRecordTypes)
+	}
+
+	// A fallback is kept out of rotation by weight or priority, which only those routing methods honour
+	if config.FallbackTarget != "" && !contains(FallbackRoutingMethods, config.RoutingMethod) {
+		return fmt.Errorf("fallback target requires routing method %v, got %q", FallbackRoutingMethods, config.RoutingMethod)
+	}
+
+	// A canary shifts weight, so it needs weighted routing and a pace
+	if config.CanaryStepPercent != 0 {
+		if config.RoutingMethod != "Weighted" {
+			return fmt.Errorf("canary requires routing method Weighted, got %q", config.RoutingMethod)
+		}
+		if config.CanaryStepPercent < 1 || config.CanaryStepPercent > 100 {
+			return fmt.Errorf("canary step must be between 1 and 100 percent, got %d", config.CanaryStepPercent)
+		}
+		if config.CanaryInterval <= 0 {
+			return fmt.Errorf("canary interval is required with a canary step")
+		}
+		if !contains(ValidCanaryOnDegraded, config.CanaryOnDegraded) {
+			return fmt.Errorf("invalid canary on-degraded action %q, must be one of: %v", config.CanaryOnDegraded, ValidCanaryOnDegraded)
+		}
+	}
+
+	// A schedule that only disables would never bring the endpoint back, and one that only enables does nothing
+	if (config.DisableSchedule == nil) != (config.EnableSchedule == nil) {
+		return fmt.Errorf("disable and enable schedules must be set together")
 	}
 
 	// Validate endpoint location for ExternalEndpoints
@@ -61,6 +171,38 @@ func ValidateConfig(config *TrafficManagerConfig) error {
 	return nil
 }
 
+// ValidateDefaults validates webhook-wide defaults
+func ValidateDefaults(defaults Defaults) error {
+	if defaults.RoutingMethod != "" && !contains(ValidRoutingMethods, defaults.RoutingMethod) {
+		return fmt.Errorf("invalid default routing method %q, must be one of: %v", defaults.RoutingMethod, ValidRoutingMethods)
+	}
+	if defaults.MonitorProtocol != "" && !contains(ValidMonitorProtocols, defaults.MonitorProtocol) {
+		return fmt.Errorf("invalid default monitor protocol %q, must be one of: %v", defaults.MonitorProtocol, ValidMonitorProtocols)
+	}
+	if defaults.MonitorPort != 0 && (defaults.MonitorPort < MinMonitorPort || defaults.MonitorPort > MaxMonitorPort) {
+		return fmt.Errorf("default monitor port must be between %d and %d, got %d", MinMonitorPort, MaxMonitorPort, defaults.MonitorPort)
+	}
+	if err := ValidateTags(defaults.Tags); err != nil {
+		return fmt.Errorf("invalid default tags: %w", err)
+	}
+	return nil
+}
+
+// ValidateAnnotations parses and validates Traffic Manager annotations in one step.
+// It accepts either the annotations as written on a Kubernetes resource
+// (external-dns.alpha.kubernetes.io/webhook-traffic-manager-*) or the
+// transformed keys External DNS passes to the webhook.
+func ValidateAnnotations(annotations map[string]string) (*TrafficManagerConfig, error) {
+	config, err := ParseConfig(NormalizeAnnotations(annotations))
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateConfig(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
 // contains checks if a string slice contains a specific string
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
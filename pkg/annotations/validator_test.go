@@ -1,9 +1,12 @@
 package annotations
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestValidateConfig_Disabled(t *testing.T) {
@@ -150,6 +153,36 @@ func TestValidateConfig_InvalidMonitorProtocol(t *testing.T) {
 	assert.Contains(t, err.Error(), "protocol")
 }
 
+func TestValidateConfig_MonitorPath(t *testing.T) {
+	config := func(protocol, path string) *TrafficManagerConfig {
+		return &TrafficManagerConfig{
+			Enabled:          true,
+			ResourceGroup:    "my-rg",
+			Weight:           100,
+			Priority:         1,
+			DNSTTL:           30,
+			RoutingMethod:    "Weighted",
+			MonitorProtocol:  protocol,
+			MonitorPort:      443,
+			MonitorPath:      path,
+			EndpointStatus:   "Enabled",
+			EndpointType:     "ExternalEndpoints",
+			EndpointLocation: "East US",
+		}
+	}
+
+	assert.NoError(t, ValidateConfig(config("HTTPS", "/healthz")))
+	assert.NoError(t, ValidateConfig(config("TCP", "")))
+
+	err := ValidateConfig(config("TCP", "/healthz"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "TCP")
+
+	err = ValidateConfig(config("HTTP", "healthz"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "must start with /")
+}
+
 func TestValidateConfig_ValidMonitorProtocols(t *testing.T) {
 	protocols := []string{"HTTP", "HTTPS", "TCP"}
 
@@ -195,6 +228,30 @@ func TestValidateConfig_InvalidEndpointStatus(t *testing.T) {
 	assert.Contains(t, err.Error(), "status")
 }
 
+func TestValidateConfig_InvalidProfileStatus(t *testing.T) {
+	config := &TrafficManagerConfig{
+		Enabled:          true,
+		ResourceGroup:    "my-rg",
+		Weight:           100,
+		Priority:         1,
+		DNSTTL:           30,
+		RoutingMethod:    "Weighted",
+		MonitorProtocol:  "HTTPS",
+		MonitorPort:      443,
+		EndpointStatus:   "Enabled",
+		ProfileStatus:    "Paused",
+		EndpointType:     "ExternalEndpoints",
+		EndpointLocation: "East US",
+	}
+
+	err := ValidateConfig(config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "profile status")
+
+	config.ProfileStatus = "Disabled"
+	assert.NoError(t, ValidateConfig(config))
+}
+
 func TestValidateConfig_TTLTooLow(t *testing.T) {
 	config := &TrafficManagerConfig{
 		Enabled:          true,
@@ -386,3 +443,238 @@ func TestValidateConfig_EdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateConfig_SubscriptionID(t *testing.T) {
+	config := &TrafficManagerConfig{
+		Enabled:          true,
+		ResourceGroup:    "my-rg",
+		SubscriptionID:   "00000000-0000-0000-0000-000000000001",
+		RoutingMethod:    "Weighted",
+		Weight:           100,
+		Priority:         1,
+		DNSTTL:           30,
+		MonitorProtocol:  "HTTPS",
+		MonitorPort:      443,
+		EndpointStatus:   "Enabled",
+		EndpointType:     "ExternalEndpoints",
+		EndpointLocation: "East US",
+	}
+	assert.NoError(t, ValidateConfig(config))
+
+	config.SubscriptionID = "not-a-guid"
+	err := ValidateConfig(config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid subscription ID")
+}
+
+func TestValidateAnnotations(t *testing.T) {
+	// Annotations as written on a Service
+	config, err := ValidateAnnotations(map[string]string{
+		"external-dns.alpha.kubernetes.io/hostname":                                  "demo-east.example.com",
+		"external-dns.alpha.kubernetes.io/webhook-traffic-manager-enabled":           "true",
+		"external-dns.alpha.kubernetes.io/webhook-traffic-manager-resource-group":    "my-rg",
+		"external-dns.alpha.kubernetes.io/webhook-traffic-manager-weight":            "50",
+		"external-dns.alpha.kubernetes.io/webhook-traffic-manager-endpoint-location": "East US",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "my-rg", config.ResourceGroup)
+	assert.Equal(t, int64(50), config.Weight)
+
+	// Keys as passed to the webhook
+	_, err = ValidateAnnotations(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationWeight:        "5000",
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "weight")
+
+	// Parse errors are returned too
+	_, err = ValidateAnnotations(map[string]string{
+		AnnotationEnabled: "true",
+		AnnotationWeight:  "heavy",
+	})
+	assert.Error(t, err)
+}
+
+func TestValidateConfig_VanityRecordType(t *testing.T) {
+	config := &TrafficManagerConfig{
+		Enabled:          true,
+		ResourceGroup:    "my-rg",
+		RoutingMethod:    "Weighted",
+		Weight:           100,
+		Priority:         1,
+		DNSTTL:           30,
+		MonitorProtocol:  "HTTPS",
+		MonitorPort:      443,
+		EndpointStatus:   "Enabled",
+		EndpointType:     "ExternalEndpoints",
+		EndpointLocation: "East US",
+	}
+
+	for _, recordType := range append([]string{""}, ValidVanityRecordTypes...) {
+		config.VanityRecordType = recordType
+		assert.NoError(t, ValidateConfig(config), recordType)
+	}
+
+	config.VanityRecordType = "aaaa"
+	err := ValidateConfig(config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "vanity record type")
+}
+
+func TestValidateConfig_FallbackTarget(t *testing.T) {
+	config := &TrafficManagerConfig{
+		Enabled:          true,
+		ResourceGroup:    "my-rg",
+		Weight:           100,
+		Priority:         1,
+		DNSTTL:           30,
+		MonitorProtocol:  "HTTPS",
+		MonitorPort:      443,
+		EndpointStatus:   "Enabled",
+		EndpointType:     "ExternalEndpoints",
+		EndpointLocation: "East US",
+		FallbackTarget:   "status.example.com",
+	}
+
+	for _, routingMethod := range FallbackRoutingMethods {
+		config.RoutingMethod = routingMethod
+		assert.NoError(t, ValidateConfig(config), routingMethod)
+	}
+
+	config.RoutingMethod = "Performance"
+	assert.ErrorContains(t, ValidateConfig(config), "fallback target requires routing method")
+}
+
+func TestValidateConfig_Canary(t *testing.T) {
+	config := &TrafficManagerConfig{
+		Enabled:           true,
+		ResourceGroup:     "my-rg",
+		RoutingMethod:     "Weighted",
+		Weight:            100,
+		Priority:          1,
+		DNSTTL:            30,
+		MonitorProtocol:   "HTTPS",
+		MonitorPort:       443,
+		EndpointStatus:    "Enabled",
+		EndpointType:      "ExternalEndpoints",
+		EndpointLocation:  "East US",
+		CanaryStepPercent: 10,
+		CanaryInterval:    5 * time.Minute,
+		CanaryOnDegraded:  CanaryOnDegradedPause,
+	}
+	assert.NoError(t, ValidateConfig(config))
+
+	config.CanaryOnDegraded = "ignore"
+	assert.ErrorContains(t, ValidateConfig(config), "invalid canary on-degraded action")
+
+	config.CanaryOnDegraded = CanaryOnDegradedRollback
+	config.CanaryInterval = 0
+	assert.ErrorContains(t, ValidateConfig(config), "canary interval is required")
+
+	config.CanaryInterval = time.Minute
+	config.CanaryStepPercent = 150
+	assert.ErrorContains(t, ValidateConfig(config), "canary step must be between 1 and 100")
+
+	config.CanaryStepPercent = 10
+	config.RoutingMethod = "Priority"
+	assert.ErrorContains(t, ValidateConfig(config), "canary requires routing method Weighted")
+}
+
+func TestValidateAnnotations_Schedule(t *testing.T) {
+	labels := map[string]string{
+		AnnotationEnabled:          "true",
+		AnnotationResourceGroup:    "my-rg",
+		AnnotationEndpointLocation: "eastus",
+		AnnotationScheduleDisable:  "0 1 * * *",
+		AnnotationScheduleEnable:   "0 3 * * *",
+	}
+	config, err := ValidateAnnotations(labels)
+	require.NoError(t, err)
+	assert.Equal(t, "0 1 * * *", config.DisableSchedule.String())
+	assert.Equal(t, "0 3 * * *", config.EnableSchedule.String())
+
+	delete(labels, AnnotationScheduleEnable)
+	_, err = ValidateAnnotations(labels)
+	assert.ErrorContains(t, err, "disable and enable schedules must be set together")
+
+	labels[AnnotationScheduleEnable] = "at three"
+	_, err = ValidateAnnotations(labels)
+	assert.ErrorContains(t, err, "invalid enable schedule")
+}
+
+func TestValidateDefaults(t *testing.T) {
+	assert.NoError(t, ValidateDefaults(Defaults{}))
+	assert.NoError(t, ValidateDefaults(Defaults{RoutingMethod: "Priority", MonitorProtocol: "TCP", MonitorPort: 8080}))
+
+	assert.ErrorContains(t, ValidateDefaults(Defaults{RoutingMethod: "RoundRobin"}), "invalid default routing method")
+	assert.ErrorContains(t, ValidateDefaults(Defaults{MonitorProtocol: "UDP"}), "invalid default monitor protocol")
+	assert.ErrorContains(t, ValidateDefaults(Defaults{MonitorPort: 70000}), "default monitor port must be between")
+}
+
+func TestValidateProfileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		wantErr string
+	}{
+		{"valid", "app-example-com-tm", ""},
+		{"empty", "", "empty"},
+		{"too long", strings.Repeat("a", 64), "at most 63"},
+		{"period", "app.example.com", `contains '.'`},
+		{"leading hyphen", "-app-tm", "start and end"},
+		{"trailing hyphen", "app-tm-", "start and end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateProfileName(tt.profile)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateEndpointName(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantErr  string
+	}{
+		{"valid", "east_endpoint.v2", ""},
+		{"empty", "", "empty"},
+		{"too long", strings.Repeat("a", 261), "at most 260"},
+		{"slash", "east/west", `contains '/'`},
+		{"leading period", ".east", "start with"},
+		{"trailing period", "east.", "end with a period"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateEndpointName(tt.endpoint)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateAnnotations_Names(t *testing.T) {
+	_, err := ValidateAnnotations(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationProfileName:   "my_profile",
+	})
+	assert.ErrorContains(t, err, "only letters, digits and hyphens")
+
+	_, err = ValidateAnnotations(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationEndpointName:  "east:1",
+	})
+	assert.ErrorContains(t, err, "endpoint name")
+}
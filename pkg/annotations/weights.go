@@ -0,0 +1,33 @@
+package annotations
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PercentWeightScale converts a percentage to an Azure weight. Percentages summing to 100 become
+// weights summing to 1000, so each endpoint gets exactly its share of the traffic.
+const PercentWeightScale = MaxWeight / 100
+
+// ParseWeightPercent parses a weight written as a percentage, e.g. "25", "25%" or "12.5", with at
+// most one decimal place so it converts to a whole Azure weight
+func ParseWeightPercent(value string) (float64, error) {
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid weight percentage %q: %w", value, err)
+	}
+	if math.IsNaN(percent) || math.IsInf(percent, 0) {
+		return 0, fmt.Errorf("invalid weight percentage %q, must be a number", value)
+	}
+	if scaled := percent * PercentWeightScale; math.Abs(scaled-math.Round(scaled)) > 1e-9 {
+		return 0, fmt.Errorf("invalid weight percentage %q, at most one decimal place is allowed", value)
+	}
+	return percent, nil
+}
+
+// PercentWeight returns the Azure weight for a percentage
+func PercentWeight(percent float64) int64 {
+	return int64(math.Round(percent * PercentWeightScale))
+}
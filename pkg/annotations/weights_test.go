@@ -0,0 +1,66 @@
+package annotations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWeightPercent(t *testing.T) {
+	for value, want := range map[string]float64{"25": 25, "25%": 25, "12.5": 12.5, " 100% ": 100} {
+		got, err := ParseWeightPercent(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, want, got, value)
+	}
+
+	for _, value := range []string{"", "a quarter", "12.25", "%"} {
+		_, err := ParseWeightPercent(value)
+		assert.Error(t, err, value)
+	}
+
+	assert.Equal(t, int64(1), PercentWeight(0.1))
+	assert.Equal(t, int64(333), PercentWeight(33.3))
+	assert.Equal(t, int64(MaxWeight), PercentWeight(100))
+}
+
+func TestParseConfig_WeightPercent(t *testing.T) {
+	config, err := ParseConfig(map[string]string{
+		AnnotationEnabled:          "true",
+		AnnotationResourceGroup:    "my-rg",
+		AnnotationWeightMode:       "Percent",
+		AnnotationWeight:           "30%",
+		AnnotationEndpointLocation: "eastus",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, WeightModePercent, config.WeightMode)
+	assert.Equal(t, float64(30), config.WeightPercent)
+	assert.Equal(t, int64(300), config.Weight)
+	assert.NoError(t, ValidateConfig(config))
+
+	// A percentage must be given explicitly, as the default weight isn't one
+	config, err = ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationWeightMode:    "percent",
+	})
+	require.NoError(t, err)
+	assert.ErrorContains(t, ValidateConfig(config), "requires a weight between 0.1% and 100%")
+
+	config, err = ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationWeightMode:    "percent",
+		AnnotationWeight:        "50",
+		AnnotationRoutingMethod: "Priority",
+	})
+	require.NoError(t, err)
+	assert.ErrorContains(t, ValidateConfig(config), "requires routing method Weighted")
+
+	_, err = ParseConfig(map[string]string{
+		AnnotationEnabled:       "true",
+		AnnotationResourceGroup: "my-rg",
+		AnnotationWeight:        "30%",
+	})
+	assert.Error(t, err, "percentages need the percent weight mode")
+}
@@ -0,0 +1,210 @@
+package azuredns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/dns/armdns"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"go.uber.org/zap"
+)
+
+// Client writes vanity hostname records directly to Azure DNS zones
+type Client struct {
+	recordSetsClient *armdns.RecordSetsClient
+	resourceGroup    string
+	zones            []string
+	managedByKey     string // Record metadata marking the records this webhook writes
+	managedByValue   string
+	logger           *zap.Logger
+}
+
+// Default record metadata marking the records this webhook writes, matching the profiles' default
+// managed-by tag
+const (
+	DefaultManagedByKey   = "managedBy"
+	DefaultManagedByValue = "external-dns-traffic-manager-webhook"
+)
+
+// NewClient creates a new Azure DNS client for the given zones in a single resource group
+func NewClient(subscriptionID, resourceGroup string, zones []string, credential azcore.TokenCredential, options *arm.ClientOptions, logger *zap.Logger) (*Client, error) {
+	if resourceGroup == "" {
+		return nil, fmt.Errorf("Azure DNS resource group is required")
+	}
+	if len(zones) == 0 {
+		return nil, fmt.Errorf("at least one Azure DNS zone is required")
+	}
+
+	recordSetsClient, err := armdns.NewRecordSetsClient(subscriptionID, credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create record sets client: %w", err)
+	}
+
+	return &Client{
+		recordSetsClient: recordSetsClient,
+		resourceGroup:    resourceGroup,
+		zones:            zones,
+		managedByKey:     DefaultManagedByKey,
+		managedByValue:   DefaultManagedByValue,
+		logger:           logger,
+	}, nil
+}
+
+// SetManagedBy sets the metadata key and value that mark the records the client writes;
+// empty ones keep their defaults
+func (c *Client) SetManagedBy(key, value string) {
+	if key != "" {
+		c.managedByKey = key
+	}
+	if value != "" {
+		c.managedByValue = value
+	}
+}
+
+// Vanity record types accepted by UpsertVanityRecord and DeleteVanityRecord
+const (
+	RecordTypeAuto  = ""      // CNAME, or an A alias record at the zone apex
+	RecordTypeCNAME = "cname" // CNAME to the Traffic Manager FQDN
+	RecordTypeAlias = "alias" // A alias record targeting the Traffic Manager profile resource
+)
+
+// UpsertVanityRecord creates or updates the record for a vanity hostname.
+// By default subdomains get a CNAME to the Traffic Manager FQDN and the zone apex
+// gets an A alias record targeting the Traffic Manager profile resource, since CNAMEs
+// are not allowed at the apex. recordType can force either kind.
+func (c *Client) UpsertVanityRecord(ctx context.Context, hostname, target, profileID string, ttl int64, recordType string) error {
+	zone, relativeName, err := c.splitHostname(hostname)
+	if err != nil {
+		return err
+	}
+
+	armRecordType, err := resolveRecordType(hostname, relativeName, recordType)
+	if err != nil {
+		return err
+	}
+
+	properties := &armdns.RecordSetProperties{
+		TTL:      &ttl,
+		Metadata: map[string]*string{c.managedByKey: toStringPtr(c.managedByValue)},
+	}
+
+	if armRecordType == armdns.RecordTypeA {
+		if profileID == "" {
+			return fmt.Errorf("profile resource ID is required for alias record %s", hostname)
+		}
+		properties.TargetResource = &armdns.SubResource{ID: &profileID}
+	} else {
+		properties.CnameRecord = &armdns.CnameRecord{Cname: &target}
+	}
+
+	c.log(ctx).Info("Writing vanity record to Azure DNS",
+		zap.String("hostname", hostname),
+		zap.String("zone", zone),
+		zap.String("recordType", string(armRecordType)),
+		zap.String("target", target))
+
+	_, err = c.recordSetsClient.CreateOrUpdate(
+		ctx,
+		c.resourceGroup,
+		zone,
+		relativeName,
+		armRecordType,
+		armdns.RecordSet{Properties: properties},
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write %s record for %s: %w", armRecordType, hostname, err)
+	}
+
+	c.log(ctx).Info("Successfully wrote vanity record to Azure DNS",
+		zap.String("hostname", hostname),
+		zap.String("recordType", string(armRecordType)))
+
+	return nil
+}
+
+// DeleteVanityRecord removes the record previously written for a vanity hostname
+// with the same recordType
+func (c *Client) DeleteVanityRecord(ctx context.Context, hostname, recordType string) error {
+	zone, relativeName, err := c.splitHostname(hostname)
+	if err != nil {
+		return err
+	}
+
+	armRecordType, err := resolveRecordType(hostname, relativeName, recordType)
+	if err != nil {
+		return err
+	}
+
+	c.log(ctx).Info("Deleting vanity record from Azure DNS",
+		zap.String("hostname", hostname),
+		zap.String("zone", zone),
+		zap.String("recordType", string(armRecordType)))
+
+	_, err = c.recordSetsClient.Delete(ctx, c.resourceGroup, zone, relativeName, armRecordType, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s record for %s: %w", armRecordType, hostname, err)
+	}
+
+	return nil
+}
+
+// resolveRecordType returns the Azure DNS record type for a vanity record:
+// CNAME for CNAME records and A for alias records
+func resolveRecordType(hostname, relativeName, recordType string) (armdns.RecordType, error) {
+	switch recordType {
+	case RecordTypeAuto:
+		if relativeName == "@" {
+			return armdns.RecordTypeA, nil
+		}
+		return armdns.RecordTypeCNAME, nil
+	case RecordTypeCNAME:
+		if relativeName == "@" {
+			return "", fmt.Errorf("CNAME record not allowed at zone apex %s, use an alias record", hostname)
+		}
+		return armdns.RecordTypeCNAME, nil
+	case RecordTypeAlias:
+		return armdns.RecordTypeA, nil
+	default:
+		return "", fmt.Errorf("unknown vanity record type %q", recordType)
+	}
+}
+
+// splitHostname finds the most specific configured zone for a hostname and
+// returns the zone name and the relative record name ("@" for the apex)
+func (c *Client) splitHostname(hostname string) (string, string, error) {
+	hostname = strings.TrimSuffix(strings.ToLower(hostname), ".")
+
+	bestZone := ""
+	for _, zone := range c.zones {
+		zone = strings.TrimSuffix(strings.ToLower(zone), ".")
+		if hostname != zone && !strings.HasSuffix(hostname, "."+zone) {
+			continue
+		}
+		if len(zone) > len(bestZone) {
+			bestZone = zone
+		}
+	}
+
+	if bestZone == "" {
+		return "", "", fmt.Errorf("hostname %s is not in any configured Azure DNS zone %v", hostname, c.zones)
+	}
+
+	if hostname == bestZone {
+		return bestZone, "@", nil
+	}
+
+	return bestZone, strings.TrimSuffix(hostname, "."+bestZone), nil
+}
+
+func toStringPtr(s string) *string {
+	return &s
+}
+
+// log returns the client logger with the request ID from ctx attached
+func (c *Client) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, c.logger)
+}
@@ -0,0 +1,130 @@
+package azuredns
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/dns/armdns"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSplitHostname(t *testing.T) {
+	c := &Client{zones: []string{"example.com", "internal.example.com."}}
+
+	tests := []struct {
+		hostname     string
+		zone         string
+		relativeName string
+	}{
+		{"demo.example.com", "example.com", "demo"},
+		{"a.b.example.com", "example.com", "a.b"},
+		{"example.com", "example.com", "@"},
+		{"Demo.Example.com.", "example.com", "demo"},
+		{"api.internal.example.com", "internal.example.com", "api"},
+		{"internal.example.com", "internal.example.com", "@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostname, func(t *testing.T) {
+			zone, relativeName, err := c.splitHostname(tt.hostname)
+			require.NoError(t, err)
+			assert.Equal(t, tt.zone, zone)
+			assert.Equal(t, tt.relativeName, relativeName)
+		})
+	}
+}
+
+func TestSplitHostname_NoMatchingZone(t *testing.T) {
+	c := &Client{zones: []string{"example.com"}}
+
+	_, _, err := c.splitHostname("demo.notexample.com")
+	assert.Error(t, err)
+}
+
+func TestResolveRecordType(t *testing.T) {
+	tests := []struct {
+		relativeName string
+		recordType   string
+		want         armdns.RecordType
+		wantErr      bool
+	}{
+		{"demo", RecordTypeAuto, armdns.RecordTypeCNAME, false},
+		{"@", RecordTypeAuto, armdns.RecordTypeA, false},
+		{"demo", RecordTypeCNAME, armdns.RecordTypeCNAME, false},
+		{"@", RecordTypeCNAME, "", true},
+		{"demo", RecordTypeAlias, armdns.RecordTypeA, false},
+		{"@", RecordTypeAlias, armdns.RecordTypeA, false},
+		{"demo", "aaaa", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.relativeName+"/"+tt.recordType, func(t *testing.T) {
+			got, err := resolveRecordType("demo.example.com", tt.relativeName, tt.recordType)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// recordSetTransport keeps the last record set written and answers every request with it
+type recordSetTransport struct {
+	written armdns.RecordSet
+}
+
+func (t *recordSetTransport) Do(req *http.Request) (*http.Response, error) {
+	body := "{}"
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &t.written); err != nil {
+			return nil, err
+		}
+		body = string(data)
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Header: http.Header{}, Request: req}, nil
+}
+
+func TestUpsertVanityRecord_ManagedBy(t *testing.T) {
+	tests := []struct {
+		name      string
+		key       string
+		value     string
+		wantKey   string
+		wantValue string
+	}{
+		{"default", "", "", DefaultManagedByKey, DefaultManagedByValue},
+		{"configured", "owner", "platform-team", "owner", "platform-team"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &recordSetTransport{}
+			options := &arm.ClientOptions{ClientOptions: policy.ClientOptions{Transport: transport, Retry: policy.RetryOptions{MaxRetries: -1}}}
+			c, err := NewClient("sub", "dns-rg", []string{"example.com"}, fakeazure.Credential{}, options, zaptest.NewLogger(t))
+			require.NoError(t, err)
+			c.SetManagedBy(tt.key, tt.value)
+
+			require.NoError(t, c.UpsertVanityRecord(context.Background(), "app.example.com", "app-tm.trafficmanager.net", "", 60, RecordTypeAuto))
+			require.NotNil(t, transport.written.Properties)
+			metadata := transport.written.Properties.Metadata
+			require.Len(t, metadata, 1)
+			require.Contains(t, metadata, tt.wantKey)
+			assert.Equal(t, tt.wantValue, *metadata[tt.wantKey])
+		})
+	}
+}
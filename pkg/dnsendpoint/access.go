@@ -0,0 +1,57 @@
+package dnsendpoint
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// RequiredVerbs are the verbs the webhook uses on DNSEndpoints. Server-side apply creates with
+// create and updates with patch.
+var RequiredVerbs = []string{"get", "list", "create", "patch", "delete"}
+
+// selfSubjectAccessReviewGVR is the resource asking the API server what the caller may do
+var selfSubjectAccessReviewGVR = schema.GroupVersionResource{
+	Group:    "authorization.k8s.io",
+	Version:  "v1",
+	Resource: "selfsubjectaccessreviews",
+}
+
+// CheckAccess asks the Kubernetes API whether the webhook's service account may use each of
+// RequiredVerbs on DNSEndpoints in the namespace, and returns an error naming those denied
+func (m *Manager) CheckAccess(ctx context.Context) error {
+	gvr := DNSEndpointGVR()
+	var denied []string
+	for _, verb := range RequiredVerbs {
+		review := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "authorization.k8s.io/v1",
+			"kind":       "SelfSubjectAccessReview",
+			"spec": map[string]interface{}{
+				"resourceAttributes": map[string]interface{}{
+					"namespace": m.namespace,
+					"verb":      verb,
+					"group":     gvr.Group,
+					"resource":  gvr.Resource,
+				},
+			},
+		}}
+
+		result, err := m.client.Resource(selfSubjectAccessReviewGVR).Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to review DNSEndpoint access: %w", err)
+		}
+		if allowed, _, _ := unstructured.NestedBool(result.Object, "status", "allowed"); !allowed {
+			denied = append(denied, verb)
+		}
+	}
+
+	if len(denied) > 0 {
+		return fmt.Errorf("not allowed to %s %s.%s in namespace %s",
+			strings.Join(denied, ", "), gvr.Resource, gvr.Group, m.namespace)
+	}
+	return nil
+}
@@ -2,15 +2,37 @@ package dnsendpoint
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
 	"go.uber.org/zap"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+)
+
+const (
+	// FieldManager identifies this webhook as the owner of applied DNSEndpoint fields
+	FieldManager = "external-dns-traffic-manager-webhook"
+
+	// ManagedByLabel and ManagedByValue mark DNSEndpoints created by this webhook
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "external-dns-traffic-manager-webhook"
+
+	// ProfileNameAnnotation, ResourceGroupAnnotation and SubscriptionAnnotation record
+	// which Traffic Manager profile a DNSEndpoint points to
+	ProfileNameAnnotation   = "traffic-manager.externaldns.k8s.io/profile-name"
+	ResourceGroupAnnotation = "traffic-manager.externaldns.k8s.io/resource-group"
+	SubscriptionAnnotation  = "traffic-manager.externaldns.k8s.io/subscription-id"
+
+	// DefaultApplyConcurrency is the number of DNSEndpoint writes issued in parallel
+	DefaultApplyConcurrency = 4
 )
 
 // Manager handles DNSEndpoint CRD operations
@@ -18,25 +40,21 @@ type Manager struct {
 	client    dynamic.Interface
 	namespace string
 	logger    *zap.Logger
-}
 
-// NewManager creates a new DNSEndpoint manager
-func NewManager(k8sClient *kubernetes.Clientset, namespace string, logger *zap.Logger) (*Manager, error) {
-	config, err := rest.InClusterConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
-	}
-
-	dynamicClient, err := dynamic.NewForConfig(config)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
-	}
+	concurrency int         // DNSEndpoint writes of a batch issued in parallel
+	retries     *retryQueue // Records whose writes failed, retried with backoff by RunRetries
+}
 
+// NewManager creates a new DNSEndpoint manager using the given dynamic client
+func NewManager(client dynamic.Interface, namespace string, logger *zap.Logger) *Manager {
 	return &Manager{
-		client:    dynamicClient,
+		client:    client,
 		namespace: namespace,
 		logger:    logger,
-	}, nil
+
+		concurrency: DefaultApplyConcurrency,
+		retries:     newRetryQueue(),
+	}
 }
 
 // DNSEndpointGVR returns the GroupVersionResource for DNSEndpoint
@@ -48,74 +66,221 @@ func DNSEndpointGVR() schema.GroupVersionResource {
 	}
 }
 
+// CNAMERecord describes a single vanity CNAME to be written as a DNSEndpoint
+type CNAMERecord struct {
+	Name           string // DNSEndpoint resource name
+	Hostname       string // Vanity hostname (e.g., demo.example.com)
+	Target         string // Traffic Manager FQDN
+	TTL            int64
+	SubscriptionID string // Subscription of the owning profile; empty means the default subscription
+	ProfileName    string // Owning Traffic Manager profile
+	ResourceGroup  string // Resource group of the owning profile
+}
+
+// ManagedEndpoint is a DNSEndpoint created by this webhook
+type ManagedEndpoint struct {
+	Name           string `json:"name"`
+	Hostname       string `json:"hostname"`
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+	ProfileName    string `json:"profileName,omitempty"`
+	ResourceGroup  string `json:"resourceGroup,omitempty"`
+}
+
 // CreateOrUpdateCNAME creates or updates a DNSEndpoint for a CNAME record
 func (m *Manager) CreateOrUpdateCNAME(ctx context.Context, name, hostname, target string, ttl int64) error {
-	m.logger.Info("Creating or updating DNSEndpoint for CNAME",
-		zap.String("name", name),
-		zap.String("hostname", hostname),
-		zap.String("target", target))
+	return m.applyCNAME(ctx, CNAMERecord{
+		Name:     name,
+		Hostname: hostname,
+		Target:   target,
+		TTL:      ttl,
+	})
+}
+
+// ApplyCNAMEs writes a batch of DNSEndpoints using server-side apply with limited concurrency.
+// All records are attempted; the returned error joins every individual failure.
+// Failed records are queued and retried with backoff by RunRetries.
+func (m *Manager) ApplyCNAMEs(ctx context.Context, records []CNAMERecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	m.log(ctx).Info("Applying DNSEndpoint batch",
+		zap.Int("count", len(records)),
+		zap.Int("concurrency", m.concurrency))
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, m.concurrency)
+
+	for _, record := range records {
+		record := record
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := m.applyCNAME(ctx, record); err != nil {
+				m.retries.fail(record.Name, &record, err)
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", record.Name, err))
+				mu.Unlock()
+				return
+			}
+			m.retries.succeed(record.Name)
+		}()
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// applyCNAME creates or updates a single DNSEndpoint with a server-side apply patch
+func (m *Manager) applyCNAME(ctx context.Context, record CNAMERecord) error {
+	m.log(ctx).Info("Applying DNSEndpoint for CNAME",
+		zap.String("name", record.Name),
+		zap.String("hostname", record.Hostname),
+		zap.String("target", record.Target))
+
+	data, err := json.Marshal(buildCNAMEObject(m.namespace, record).Object)
+	if err != nil {
+		return fmt.Errorf("failed to encode DNSEndpoint: %w", err)
+	}
+
+	force := true
+	_, err = m.client.Resource(DNSEndpointGVR()).Namespace(m.namespace).Patch(
+		ctx,
+		record.Name,
+		types.ApplyPatchType,
+		data,
+		metav1.PatchOptions{FieldManager: FieldManager, Force: &force},
+	)
+	metrics.DNSEndpointOperations.WithLabelValues("apply", metrics.Result(err)).Inc()
+	if err != nil {
+		return fmt.Errorf("failed to apply DNSEndpoint: %w", err)
+	}
+
+	m.log(ctx).Info("Successfully applied DNSEndpoint", zap.String("name", record.Name))
+	return nil
+}
 
-	// Create the DNSEndpoint object
-	dnsEndpoint := &unstructured.Unstructured{
+// buildCNAMEObject builds the DNSEndpoint object for a CNAME record
+func buildCNAMEObject(namespace string, record CNAMERecord) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
 		Object: map[string]interface{}{
 			"apiVersion": "externaldns.k8s.io/v1alpha1",
 			"kind":       "DNSEndpoint",
 			"metadata": map[string]interface{}{
-				"name":      name,
-				"namespace": m.namespace,
+				"name":      record.Name,
+				"namespace": namespace,
 				"labels": map[string]interface{}{
-					"app.kubernetes.io/managed-by": "external-dns-traffic-manager-webhook",
+					ManagedByLabel: ManagedByValue,
 				},
+				"annotations": buildAnnotations(record),
 			},
 			"spec": map[string]interface{}{
 				"endpoints": []interface{}{
 					map[string]interface{}{
-						"dnsName":    hostname,
-						"recordTTL":  ttl,
+						"dnsName":    record.Hostname,
+						"recordTTL":  record.TTL,
 						"recordType": "CNAME",
 						"targets": []interface{}{
-							target,
+							record.Target,
 						},
 					},
 				},
 			},
 		},
 	}
+}
+
+// buildAnnotations records the owning profile on a DNSEndpoint
+func buildAnnotations(record CNAMERecord) map[string]interface{} {
+	annotations := map[string]interface{}{
+		ProfileNameAnnotation:   record.ProfileName,
+		ResourceGroupAnnotation: record.ResourceGroup,
+	}
+	if record.SubscriptionID != "" {
+		annotations[SubscriptionAnnotation] = record.SubscriptionID
+	}
+	return annotations
+}
+
+// ListManaged returns all DNSEndpoints labeled as managed by this webhook
+func (m *Manager) ListManaged(ctx context.Context) ([]ManagedEndpoint, error) {
+	list, err := m.client.Resource(DNSEndpointGVR()).Namespace(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", ManagedByLabel, ManagedByValue),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DNSEndpoints: %w", err)
+	}
 
-	// Try to get existing DNSEndpoint
-	existing, err := m.client.Resource(DNSEndpointGVR()).Namespace(m.namespace).Get(ctx, name, metav1.GetOptions{})
-	if err == nil {
-		// Update existing
-		m.logger.Debug("Updating existing DNSEndpoint", zap.String("name", name))
-		dnsEndpoint.SetResourceVersion(existing.GetResourceVersion())
-		_, err = m.client.Resource(DNSEndpointGVR()).Namespace(m.namespace).Update(ctx, dnsEndpoint, metav1.UpdateOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to update DNSEndpoint: %w", err)
+	managed := make([]ManagedEndpoint, 0, len(list.Items))
+	for _, item := range list.Items {
+		endpoint := ManagedEndpoint{
+			Name:           item.GetName(),
+			SubscriptionID: item.GetAnnotations()[SubscriptionAnnotation],
+			ProfileName:    item.GetAnnotations()[ProfileNameAnnotation],
+			ResourceGroup:  item.GetAnnotations()[ResourceGroupAnnotation],
 		}
-		m.logger.Info("Successfully updated DNSEndpoint", zap.String("name", name))
-	} else {
-		// Create new
-		m.logger.Debug("Creating new DNSEndpoint", zap.String("name", name))
-		_, err = m.client.Resource(DNSEndpointGVR()).Namespace(m.namespace).Create(ctx, dnsEndpoint, metav1.CreateOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to create DNSEndpoint: %w", err)
+
+		endpoints, _, _ := unstructured.NestedSlice(item.Object, "spec", "endpoints")
+		if len(endpoints) > 0 {
+			if first, ok := endpoints[0].(map[string]interface{}); ok {
+				endpoint.Hostname, _, _ = unstructured.NestedString(first, "dnsName")
+			}
 		}
-		m.logger.Info("Successfully created DNSEndpoint", zap.String("name", name))
+
+		managed = append(managed, endpoint)
 	}
 
+	metrics.DNSEndpointsManaged.Set(float64(len(managed)))
+
+	return managed, nil
+}
+
+// Ping checks the Kubernetes API is reachable and DNSEndpoints can be listed in the namespace
+func (m *Manager) Ping(ctx context.Context) error {
+	_, err := m.client.Resource(DNSEndpointGVR()).Namespace(m.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", ManagedByLabel, ManagedByValue),
+		Limit:         1,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list DNSEndpoints: %w", err)
+	}
 	return nil
 }
 
-// Delete removes a DNSEndpoint
+// Delete removes a DNSEndpoint. A DNSEndpoint that is already gone is not an error.
+// Failed deletes are queued and retried with backoff by RunRetries.
 func (m *Manager) Delete(ctx context.Context, name string) error {
-	m.logger.Info("Deleting DNSEndpoint", zap.String("name", name))
+	if err := m.delete(ctx, name); err != nil {
+		m.retries.fail(name, nil, err)
+		return err
+	}
+	m.retries.succeed(name)
+	return nil
+}
+
+// delete removes a single DNSEndpoint
+func (m *Manager) delete(ctx context.Context, name string) error {
+	m.log(ctx).Info("Deleting DNSEndpoint", zap.String("name", name))
 
 	err := m.client.Resource(DNSEndpointGVR()).Namespace(m.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if isAlreadyDeleted(err) {
+		metrics.DNSEndpointOperations.WithLabelValues("delete", metrics.ResultSuccess).Inc()
+		m.log(ctx).Debug("DNSEndpoint already deleted", zap.String("name", name))
+		return nil
+	}
+	metrics.DNSEndpointOperations.WithLabelValues("delete", metrics.Result(err)).Inc()
 	if err != nil {
 		return fmt.Errorf("failed to delete DNSEndpoint: %w", err)
 	}
 
-	m.logger.Info("Successfully deleted DNSEndpoint", zap.String("name", name))
+	m.log(ctx).Info("Successfully deleted DNSEndpoint", zap.String("name", name))
 	return nil
 }
 
@@ -132,3 +297,8 @@ func GenerateName(hostname string) string {
 	}
 	return name + "-tm-cname"
 }
+
+// log returns the manager logger with the request ID from ctx attached
+func (m *Manager) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, m.logger)
+}
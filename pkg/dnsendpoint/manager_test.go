@@ -0,0 +1,152 @@
+package dnsendpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newFakeManager(t *testing.T) (*Manager, *dynamicfake.FakeDynamicClient) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{DNSEndpointGVR(): "DNSEndpointList"})
+
+	return NewManager(client, "default", zaptest.NewLogger(t)), client
+}
+
+func TestApplyCNAMEs_UsesServerSideApply(t *testing.T) {
+	manager, client := newFakeManager(t)
+
+	var mu sync.Mutex
+	applied := make(map[string]map[string]interface{})
+	client.PrependReactor("patch", "dnsendpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		assert.Equal(t, types.ApplyPatchType, patch.GetPatchType())
+
+		var obj map[string]interface{}
+		require.NoError(t, json.Unmarshal(patch.GetPatch(), &obj))
+
+		mu.Lock()
+		applied[patch.GetName()] = obj
+		mu.Unlock()
+		return true, nil, nil
+	})
+
+	records := []CNAMERecord{
+		{Name: "demo-example-com-tm-cname", Hostname: "demo.example.com", Target: "demo-example-com-tm.trafficmanager.net", TTL: 300},
+		{Name: "api-example-com-tm-cname", Hostname: "api.example.com", Target: "api-example-com-tm.trafficmanager.net", TTL: 60},
+	}
+
+	err := manager.ApplyCNAMEs(context.Background(), records)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+
+	obj := applied["demo-example-com-tm-cname"]
+	metadata := obj["metadata"].(map[string]interface{})
+	labels := metadata["labels"].(map[string]interface{})
+	assert.Equal(t, ManagedByValue, labels[ManagedByLabel])
+
+	endpoints := obj["spec"].(map[string]interface{})["endpoints"].([]interface{})
+	endpoint := endpoints[0].(map[string]interface{})
+	assert.Equal(t, "demo.example.com", endpoint["dnsName"])
+	assert.Equal(t, "CNAME", endpoint["recordType"])
+	assert.Equal(t, []interface{}{"demo-example-com-tm.trafficmanager.net"}, endpoint["targets"])
+}
+
+func TestApplyCNAMEs_JoinsErrors(t *testing.T) {
+	manager, client := newFakeManager(t)
+	successes := testutil.ToFloat64(metrics.DNSEndpointOperations.WithLabelValues("apply", metrics.ResultSuccess))
+	failures := testutil.ToFloat64(metrics.DNSEndpointOperations.WithLabelValues("apply", metrics.ResultError))
+
+	client.PrependReactor("patch", "dnsendpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.PatchAction).GetName() == "bad" {
+			return true, nil, fmt.Errorf("conflict")
+		}
+		return true, nil, nil
+	})
+
+	err := manager.ApplyCNAMEs(context.Background(), []CNAMERecord{
+		{Name: "good", Hostname: "good.example.com", Target: "good.trafficmanager.net", TTL: 300},
+		{Name: "bad", Hostname: "bad.example.com", Target: "bad.trafficmanager.net", TTL: 300},
+	})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad")
+	assert.NotContains(t, err.Error(), "good")
+	assert.Equal(t, successes+1, testutil.ToFloat64(metrics.DNSEndpointOperations.WithLabelValues("apply", metrics.ResultSuccess)))
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.DNSEndpointOperations.WithLabelValues("apply", metrics.ResultError)))
+}
+
+func TestApplyCNAMEs_Empty(t *testing.T) {
+	manager, _ := newFakeManager(t)
+
+	assert.NoError(t, manager.ApplyCNAMEs(context.Background(), nil))
+}
+
+func TestListManaged(t *testing.T) {
+	managed := buildCNAMEObject("default", CNAMERecord{
+		Name:          "demo-example-com-tm-cname",
+		Hostname:      "demo.example.com",
+		Target:        "demo-example-com-tm.trafficmanager.net",
+		TTL:           300,
+		ProfileName:   "demo-example-com-tm",
+		ResourceGroup: "tm-rg",
+	})
+	unmanaged := buildCNAMEObject("default", CNAMERecord{Name: "other", Hostname: "other.example.com"})
+	unmanaged.SetLabels(map[string]string{})
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{DNSEndpointGVR(): "DNSEndpointList"}, managed, unmanaged)
+	manager := NewManager(client, "default", zaptest.NewLogger(t))
+
+	endpoints, err := manager.ListManaged(context.Background())
+	require.NoError(t, err)
+	require.Len(t, endpoints, 1)
+	assert.Equal(t, ManagedEndpoint{
+		Name:          "demo-example-com-tm-cname",
+		Hostname:      "demo.example.com",
+		ProfileName:   "demo-example-com-tm",
+		ResourceGroup: "tm-rg",
+	}, endpoints[0])
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.DNSEndpointsManaged))
+}
+
+func TestPing(t *testing.T) {
+	manager, client := newFakeManager(t)
+	require.NoError(t, manager.Ping(context.Background()))
+
+	client.PrependReactor("list", "dnsendpoints", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("forbidden")
+	})
+	assert.ErrorContains(t, manager.Ping(context.Background()), "forbidden")
+}
+
+func TestCheckAccess(t *testing.T) {
+	manager, client := newFakeManager(t)
+	allowed := map[string]bool{"get": true, "list": true, "create": true, "patch": true, "delete": true}
+	client.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		verb, _, _ := unstructured.NestedString(review.Object, "spec", "resourceAttributes", "verb")
+		require.NoError(t, unstructured.SetNestedField(review.Object, allowed[verb], "status", "allowed"))
+		return true, review, nil
+	})
+
+	require.NoError(t, manager.CheckAccess(context.Background()))
+
+	allowed["create"], allowed["delete"] = false, false
+	assert.EqualError(t, manager.CheckAccess(context.Background()),
+		"not allowed to create, delete dnsendpoints.externaldns.k8s.io in namespace default")
+}
@@ -0,0 +1,161 @@
+package dnsendpoint
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	// retryBaseDelay is the wait before the first retry; it doubles on each failure up to retryMaxDelay
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// pendingWrite is a failed DNSEndpoint write waiting to be retried
+type pendingWrite struct {
+	record   *CNAMERecord // Record to apply; nil means the DNSEndpoint should be deleted
+	attempts int
+	next     time.Time
+	lastErr  error
+}
+
+// retryQueue holds failed DNSEndpoint writes keyed by DNSEndpoint name.
+// Only the latest desired state for a name is kept.
+type retryQueue struct {
+	mu      sync.Mutex
+	pending map[string]*pendingWrite
+	now     func() time.Time
+}
+
+func newRetryQueue() *retryQueue {
+	return &retryQueue{
+		pending: make(map[string]*pendingWrite),
+		now:     time.Now,
+	}
+}
+
+// fail records a failed write, replacing any earlier pending write for the same name
+func (q *retryQueue) fail(name string, record *CNAMERecord, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	attempts := 1
+	if existing, ok := q.pending[name]; ok && sameWrite(existing.record, record) {
+		attempts = existing.attempts + 1
+	}
+
+	q.pending[name] = &pendingWrite{
+		record:   record,
+		attempts: attempts,
+		next:     q.now().Add(retryDelay(attempts)),
+		lastErr:  err,
+	}
+	metrics.DNSEndpointsUnreconciled.Set(float64(len(q.pending)))
+}
+
+// succeed drops any pending write for name
+func (q *retryQueue) succeed(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.pending, name)
+	metrics.DNSEndpointsUnreconciled.Set(float64(len(q.pending)))
+}
+
+// due returns the pending writes whose backoff has elapsed
+func (q *retryQueue) due() map[string]pendingWrite {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	due := make(map[string]pendingWrite)
+	for name, write := range q.pending {
+		if !now.Before(write.next) {
+			due[name] = *write
+		}
+	}
+	return due
+}
+
+// len returns the number of pending writes
+func (q *retryQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// retryDelay returns the backoff before the given retry attempt
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// sameWrite reports whether two pending writes have the same desired state
+func sameWrite(a, b *CNAMERecord) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// Unreconciled returns the number of DNSEndpoint writes waiting to be retried
+func (m *Manager) Unreconciled() int {
+	return m.retries.len()
+}
+
+// RetryFailed retries failed DNSEndpoint writes whose backoff has elapsed
+func (m *Manager) RetryFailed(ctx context.Context) {
+	for name, write := range m.retries.due() {
+		var err error
+		if write.record != nil {
+			err = m.applyCNAME(ctx, *write.record)
+		} else {
+			err = m.delete(ctx, name)
+		}
+
+		if err != nil {
+			m.log(ctx).Warn("Retry of DNSEndpoint write failed",
+				zap.String("name", name),
+				zap.Int("attempts", write.attempts+1),
+				zap.Error(err))
+			m.retries.fail(name, write.record, err)
+			continue
+		}
+
+		m.log(ctx).Info("DNSEndpoint write succeeded on retry",
+			zap.String("name", name),
+			zap.Int("attempts", write.attempts+1))
+		m.retries.succeed(name)
+	}
+}
+
+// RunRetries calls RetryFailed every interval until ctx is cancelled
+func (m *Manager) RunRetries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.RetryFailed(ctx)
+		}
+	}
+}
+
+// isAlreadyDeleted reports whether a delete failed only because the DNSEndpoint is already gone
+func isAlreadyDeleted(err error) bool {
+	return apierrors.IsNotFound(err)
+}
@@ -0,0 +1,87 @@
+package dnsendpoint
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryDelay(1))
+	assert.Equal(t, 10*time.Second, retryDelay(2))
+	assert.Equal(t, 20*time.Second, retryDelay(3))
+	assert.Equal(t, retryMaxDelay, retryDelay(20))
+}
+
+func TestRetryFailed_AppliesWithBackoff(t *testing.T) {
+	manager, client := newFakeManager(t)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	manager.retries.now = func() time.Time { return now }
+
+	failing := true
+	patches := 0
+	client.PrependReactor("patch", "dnsendpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patches++
+		if failing {
+			return true, nil, fmt.Errorf("apiserver unavailable")
+		}
+		return true, nil, nil
+	})
+
+	record := CNAMERecord{Name: "demo", Hostname: "demo.example.com", Target: "demo.trafficmanager.net", TTL: 300}
+	require.Error(t, manager.ApplyCNAMEs(context.Background(), []CNAMERecord{record}))
+	assert.Equal(t, 1, manager.Unreconciled())
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.DNSEndpointsUnreconciled))
+
+	// Not due yet
+	manager.RetryFailed(context.Background())
+	assert.Equal(t, 1, patches)
+
+	// First retry fails and backs off further
+	now = now.Add(retryBaseDelay)
+	manager.RetryFailed(context.Background())
+	assert.Equal(t, 2, patches)
+	now = now.Add(retryBaseDelay)
+	manager.RetryFailed(context.Background())
+	assert.Equal(t, 2, patches)
+
+	failing = false
+	now = now.Add(retryBaseDelay)
+	manager.RetryFailed(context.Background())
+	assert.Equal(t, 3, patches)
+	assert.Equal(t, 0, manager.Unreconciled())
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.DNSEndpointsUnreconciled))
+}
+
+func TestDelete_QueuesFailureAndIgnoresNotFound(t *testing.T) {
+	manager, client := newFakeManager(t)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	manager.retries.now = func() time.Time { return now }
+
+	// The fake client returns not found for a DNSEndpoint that doesn't exist
+	require.NoError(t, manager.Delete(context.Background(), "missing"))
+	assert.Equal(t, 0, manager.Unreconciled())
+
+	client.PrependReactor("delete", "dnsendpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, fmt.Errorf("apiserver unavailable")
+	})
+	require.Error(t, manager.Delete(context.Background(), "demo"))
+	assert.Equal(t, 1, manager.Unreconciled())
+
+	// A later successful apply for the same name supersedes the pending delete
+	client.PrependReactor("patch", "dnsendpoints", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, nil
+	})
+	require.NoError(t, manager.ApplyCNAMEs(context.Background(), []CNAMERecord{
+		{Name: "demo", Hostname: "demo.example.com", Target: "demo.trafficmanager.net", TTL: 300},
+	}))
+	assert.Equal(t, 0, manager.Unreconciled())
+}
@@ -0,0 +1,28 @@
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID for log correlation
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// FromContext returns logger with the request ID from ctx attached, if there is one
+func FromContext(ctx context.Context, logger *zap.Logger) *zap.Logger {
+	if requestID := RequestID(ctx); requestID != "" {
+		return logger.With(zap.String("requestID", requestID))
+	}
+	return logger
+}
@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels holds the default log level and per-subsystem overrides.
+// A subsystem is the first segment of a logger's name (e.g. "trafficmanager"
+// for a logger created with logger.Named("trafficmanager")).
+type Levels struct {
+	mu           sync.RWMutex
+	defaultLevel zapcore.Level
+	overrides    map[string]zapcore.Level
+}
+
+// NewLevels creates Levels with the given default and no overrides
+func NewLevels(defaultLevel zapcore.Level) *Levels {
+	return &Levels{
+		defaultLevel: defaultLevel,
+		overrides:    make(map[string]zapcore.Level),
+	}
+}
+
+// SetDefault changes the level used by subsystems without an override
+func (l *Levels) SetDefault(level zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.defaultLevel = level
+}
+
+// Set overrides the level for a subsystem
+func (l *Levels) Set(subsystem string, level zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.overrides[subsystem] = level
+}
+
+// Reset removes a subsystem override so it follows the default level again
+func (l *Levels) Reset(subsystem string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.overrides, subsystem)
+}
+
+// Enabled reports whether a message at level should be logged for a logger name
+func (l *Levels) Enabled(loggerName string, level zapcore.Level) bool {
+	subsystem := loggerName
+	if i := strings.Index(loggerName, "."); i >= 0 {
+		subsystem = loggerName[:i]
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if override, ok := l.overrides[subsystem]; ok {
+		return level >= override
+	}
+	return level >= l.defaultLevel
+}
+
+// minLevel returns the most verbose level currently enabled for any subsystem
+func (l *Levels) minLevel() zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	min := l.defaultLevel
+	for _, level := range l.overrides {
+		if level < min {
+			min = level
+		}
+	}
+	return min
+}
+
+// LevelsResponse is the JSON representation of the current levels
+type LevelsResponse struct {
+	Default   string            `json:"default"`
+	Overrides map[string]string `json:"overrides"`
+}
+
+// Snapshot returns the current levels
+func (l *Levels) Snapshot() LevelsResponse {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	response := LevelsResponse{
+		Default:   l.defaultLevel.String(),
+		Overrides: make(map[string]string, len(l.overrides)),
+	}
+	for subsystem, level := range l.overrides {
+		response.Overrides[subsystem] = level.String()
+	}
+	return response
+}
+
+// SetLevelRequest is the body accepted by PUT /loglevel.
+// An empty subsystem changes the default; an empty level removes the subsystem override.
+type SetLevelRequest struct {
+	Subsystem string `json:"subsystem"`
+	Level     string `json:"level"`
+}
+
+// ServeHTTP handles GET (list levels) and PUT (change a level) requests
+func (l *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req SetLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if req.Level == "" {
+			if req.Subsystem == "" {
+				http.Error(w, "level is required to change the default", http.StatusBadRequest)
+				return
+			}
+			l.Reset(req.Subsystem)
+			break
+		}
+
+		level, err := zapcore.ParseLevel(req.Level)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Subsystem == "" {
+			l.SetDefault(level)
+		} else {
+			l.Set(req.Subsystem, level)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(l.Snapshot()); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// ParseOverrides parses "subsystem=level" pairs separated by commas (e.g. "provider=debug,state=warn")
+func ParseOverrides(value string) (map[string]zapcore.Level, error) {
+	overrides := make(map[string]zapcore.Level)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		subsystem, levelText, ok := strings.Cut(pair, "=")
+		if !ok || subsystem == "" {
+			return nil, fmt.Errorf("invalid log level override %q, expected subsystem=level", pair)
+		}
+
+		level, err := zapcore.ParseLevel(levelText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level override %q: %w", pair, err)
+		}
+		overrides[subsystem] = level
+	}
+	return overrides, nil
+}
+
+// NewCore wraps core so that entries are filtered by their subsystem's level.
+// The wrapped core should be built at the most verbose level that may be requested.
+func NewCore(core zapcore.Core, levels *Levels) zapcore.Core {
+	return &subsystemCore{Core: core, levels: levels}
+}
+
+// subsystemCore filters entries using Levels based on the entry's logger name
+type subsystemCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (c *subsystemCore) Enabled(level zapcore.Level) bool {
+	return level >= c.levels.minLevel() && c.Core.Enabled(level)
+}
+
+func (c *subsystemCore) With(fields []zapcore.Field) zapcore.Core {
+	return &subsystemCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *subsystemCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.Enabled(entry.LoggerName, entry.Level) {
+		return checked
+	}
+	return c.Core.Check(entry, checked)
+}
@@ -0,0 +1,122 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newObservedLogger(levels *Levels) (*zap.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return zap.New(NewCore(core, levels)), logs
+}
+
+func TestCore_FiltersBySubsystem(t *testing.T) {
+	levels := NewLevels(zapcore.InfoLevel)
+	levels.Set("trafficmanager", zapcore.DebugLevel)
+	levels.Set("webhook", zapcore.WarnLevel)
+
+	logger, logs := newObservedLogger(levels)
+
+	logger.Debug("root debug")
+	logger.Info("root info")
+	logger.Named("trafficmanager").Debug("tm debug")
+	logger.Named("trafficmanager").Named("profiles").Debug("tm child debug")
+	logger.Named("webhook").Info("webhook info")
+	logger.Named("webhook").With(zap.String("k", "v")).Warn("webhook warn")
+
+	var messages []string
+	for _, entry := range logs.All() {
+		messages = append(messages, entry.Message)
+	}
+	assert.Equal(t, []string{"root info", "tm debug", "tm child debug", "webhook warn"}, messages)
+}
+
+func TestCore_LevelChangesApplyToExistingLoggers(t *testing.T) {
+	levels := NewLevels(zapcore.InfoLevel)
+	logger, logs := newObservedLogger(levels)
+	provider := logger.Named("provider")
+
+	provider.Debug("before")
+	levels.Set("provider", zapcore.DebugLevel)
+	provider.Debug("after")
+	levels.Reset("provider")
+	provider.Debug("reset")
+
+	require.Equal(t, 1, logs.Len())
+	assert.Equal(t, "after", logs.All()[0].Message)
+}
+
+func TestParseOverrides(t *testing.T) {
+	overrides, err := ParseOverrides(" trafficmanager=debug, webhook=warn ,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]zapcore.Level{
+		"trafficmanager": zapcore.DebugLevel,
+		"webhook":        zapcore.WarnLevel,
+	}, overrides)
+
+	overrides, err = ParseOverrides("")
+	require.NoError(t, err)
+	assert.Empty(t, overrides)
+
+	_, err = ParseOverrides("trafficmanager")
+	assert.Error(t, err)
+
+	_, err = ParseOverrides("trafficmanager=loud")
+	assert.Error(t, err)
+}
+
+func TestServeHTTP(t *testing.T) {
+	levels := NewLevels(zapcore.InfoLevel)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		levels.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/loglevel", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := put(`{"subsystem":"dnsendpoint","level":"debug"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response LevelsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "info", response.Default)
+	assert.Equal(t, map[string]string{"dnsendpoint": "debug"}, response.Overrides)
+
+	rec = put(`{"level":"error"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, levels.Enabled("provider", zapcore.WarnLevel))
+
+	rec = put(`{"subsystem":"dnsendpoint"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, levels.Enabled("dnsendpoint", zapcore.DebugLevel))
+
+	assert.Equal(t, http.StatusBadRequest, put(`{"level":"loud"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, put(`{}`).Code)
+
+	rec = httptest.NewRecorder()
+	levels.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/loglevel", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestFromContext_AddsRequestID(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+
+	FromContext(context.Background(), logger).Info("without")
+	FromContext(WithRequestID(context.Background(), "abc123"), logger).Info("with")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	assert.NotContains(t, entries[0].ContextMap(), "requestID")
+	assert.Equal(t, "abc123", entries[1].ContextMap()["requestID"])
+}
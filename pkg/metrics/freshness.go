@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Freshness is how up to date the data served by the webhook is, read when metrics are scraped
+type Freshness struct {
+	SinceSync      time.Duration            // Since the last successful Azure sync, or since start before one
+	ExpiredEntries int                      // Cached profiles past their TTL
+	CacheAges      map[string]time.Duration // Age of each cached profile, by hostname
+}
+
+// FreshnessFunc reports the current Freshness
+type FreshnessFunc func() Freshness
+
+var (
+	syncSecondsSinceSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "sync", "seconds_since_success"),
+		"Seconds since profiles were last synced from Azure successfully, or since start before the first sync.",
+		nil, nil)
+
+	stateCacheExpiredEntries = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "state_cache", "expired_entries"),
+		"Number of profiles in the state cache past their TTL.",
+		nil, nil)
+
+	stateCacheProfileAge = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "state_cache", "profile_age_seconds"),
+		"Seconds since each cached profile was last read from Azure.",
+		[]string{"hostname"}, nil)
+)
+
+// freshnessCollector computes the freshness gauges at scrape time, since they grow with the clock
+// rather than changing on events
+type freshnessCollector struct {
+	mu     sync.Mutex
+	source FreshnessFunc
+}
+
+var freshness = &freshnessCollector{}
+
+// SetFreshnessSource sets where the freshness gauges are read from. Until it is called they aren't reported.
+func SetFreshnessSource(source FreshnessFunc) {
+	freshness.mu.Lock()
+	defer freshness.mu.Unlock()
+	freshness.source = source
+}
+
+func (c *freshnessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- syncSecondsSinceSuccess
+	ch <- stateCacheExpiredEntries
+	ch <- stateCacheProfileAge
+}
+
+func (c *freshnessCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	source := c.source
+	c.mu.Unlock()
+	if source == nil {
+		return
+	}
+
+	f := source()
+	ch <- prometheus.MustNewConstMetric(syncSecondsSinceSuccess, prometheus.GaugeValue, f.SinceSync.Seconds())
+	ch <- prometheus.MustNewConstMetric(stateCacheExpiredEntries, prometheus.GaugeValue, float64(f.ExpiredEntries))
+	for hostname, age := range f.CacheAges {
+		ch <- prometheus.MustNewConstMetric(stateCacheProfileAge, prometheus.GaugeValue, age.Seconds(), hostname)
+	}
+}
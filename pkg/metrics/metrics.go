@@ -0,0 +1,370 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "external_dns_traffic_manager"
+
+// Result label values
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+)
+
+// Registry holds all webhook metrics, served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	// DNSEndpointOperations counts DNSEndpoint writes by operation (apply, delete) and result
+	DNSEndpointOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "dnsendpoint",
+		Name:      "operations_total",
+		Help:      "DNSEndpoint operations by operation and result.",
+	}, []string{"operation", "result"})
+
+	// DNSEndpointsManaged is the number of DNSEndpoints managed by the webhook, as of the last list
+	DNSEndpointsManaged = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "dnsendpoint",
+		Name:      "managed",
+		Help:      "Number of DNSEndpoints managed by the webhook as of the last list.",
+	})
+
+	// DNSEndpointsUnreconciled is the number of failed DNSEndpoint writes waiting to be retried
+	DNSEndpointsUnreconciled = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "dnsendpoint",
+		Name:      "unreconciled",
+		Help:      "Number of failed DNSEndpoint writes waiting to be retried.",
+	})
+
+	// ProfilesMissingHostnameTag is the number of managed profiles whose hostname tag was missing at the last sync
+	ProfilesMissingHostnameTag = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "profiles",
+		Name:      "missing_hostname_tag",
+		Help:      "Number of managed Traffic Manager profiles missing their hostname tag at the last sync.",
+	})
+
+	// ProfilesUnmapped is the number of managed profiles omitted from records because no hostname could be found
+	ProfilesUnmapped = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "profiles",
+		Name:      "unmapped",
+		Help:      "Number of managed Traffic Manager profiles omitted from records because no hostname could be recovered.",
+	})
+
+	// SilenceExpiry is the Unix time until which an intentional removal is silenced, by hostname, profile,
+	// endpoint (empty for the whole profile) and reason. Series are removed once the silence expires or is lifted.
+	SilenceExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "silence",
+		Name:      "expiry_timestamp_seconds",
+		Help:      "Unix time until which alerts for an intentionally deleted or disabled profile or endpoint should be silenced.",
+	}, []string{"hostname", "profile", "endpoint", "reason"})
+
+	// FallbackActive is 1 while a profile's fallback endpoint is serving because every primary endpoint is Degraded
+	FallbackActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "fallback",
+		Name:      "active",
+		Help:      "Whether a profile's fallback endpoint is enabled because every primary endpoint is Degraded.",
+	}, []string{"profile"})
+
+	// NamespaceProfiles is the number of Traffic Manager profiles each namespace has endpoints in
+	NamespaceProfiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "quota",
+		Name:      "profiles",
+		Help:      "Number of Traffic Manager profiles each namespace has endpoints in.",
+	}, []string{"namespace"})
+
+	// NamespaceEndpoints is the number of Traffic Manager endpoints each namespace owns
+	NamespaceEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "quota",
+		Name:      "endpoints",
+		Help:      "Number of Traffic Manager endpoints each namespace owns.",
+	}, []string{"namespace"})
+
+	// NamespaceProfileQuota is the profile quota of each limited namespace
+	NamespaceProfileQuota = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "quota",
+		Name:      "profiles_limit",
+		Help:      "Maximum number of Traffic Manager profiles a namespace may have endpoints in.",
+	}, []string{"namespace"})
+
+	// NamespaceEndpointQuota is the endpoint quota of each limited namespace
+	NamespaceEndpointQuota = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "quota",
+		Name:      "endpoints_limit",
+		Help:      "Maximum number of Traffic Manager endpoints a namespace may own.",
+	}, []string{"namespace"})
+
+	// CanaryWeight is the current weight of each endpoint a canary is shifting traffic to
+	CanaryWeight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "canary",
+		Name:      "weight",
+		Help:      "Current weight of endpoints whose weight is being shifted in steps.",
+	}, []string{"profile", "endpoint"})
+
+	// CanaryRollbacks counts canaries rolled back because their endpoint was Degraded
+	CanaryRollbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "canary",
+		Name:      "rollbacks_total",
+		Help:      "Number of canaries rolled back because their endpoint's monitor status was Degraded.",
+	}, []string{"profile"})
+
+	// ScheduledStatusChanges counts endpoints enabled or disabled by their schedule annotations
+	ScheduledStatusChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "schedule",
+		Name:      "status_changes_total",
+		Help:      "Number of endpoints enabled or disabled by their schedule annotations.",
+	}, []string{"profile", "status"})
+
+	// ServiceReadyEndpoints is the number of ready Kubernetes endpoints behind each Traffic Manager endpoint's Service
+	ServiceReadyEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "service",
+		Name:      "ready_endpoints",
+		Help:      "Number of ready Kubernetes endpoints of the Service backing a Traffic Manager endpoint.",
+	}, []string{"profile", "endpoint"})
+
+	// ProfileSettingConflicts counts applies whose profile settings differ from a profile shared with other clusters
+	ProfileSettingConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "profile",
+		Name:      "setting_conflicts_total",
+		Help:      "Number of applies asking for profile settings that differ from a profile other clusters have endpoints in.",
+	}, []string{"profile"})
+
+	// ProfileConfigConflicts counts applies whose records asked for different settings for the same profile
+	ProfileConfigConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "profile",
+		Name:      "config_conflicts_total",
+		Help:      "Number of applies in which records for the same profile asked for different profile settings.",
+	}, []string{"hostname"})
+
+	// ProfileDeletionsBlocked counts deletes of empty profiles refused because of deletion protection
+	ProfileDeletionsBlocked = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "profile",
+		Name:      "deletions_blocked_total",
+		Help:      "Number of times an empty profile was kept because deletion protection is set on it.",
+	}, []string{"profile"})
+
+	// ProfilesPendingPurge is the number of soft-deleted profiles still inside their grace period
+	ProfilesPendingPurge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "profile",
+		Name:      "pending_purge",
+		Help:      "Number of soft-deleted profiles waiting for their grace period to pass before deletion.",
+	})
+
+	// ProfilesAdopted counts existing profiles the webhook has taken over
+	ProfilesAdopted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "profile",
+		Name:      "adopted_total",
+		Help:      "Number of existing Traffic Manager profiles not created by the webhook that it has taken over.",
+	})
+
+	// ProfileNameCollisions counts profile names found to be taken under trafficmanager.net before a create
+	ProfileNameCollisions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "profile",
+		Name:      "name_collisions_total",
+		Help:      "Number of profile creates whose relative DNS name was already taken under trafficmanager.net.",
+	})
+
+	// AzureWritesSkipped counts Azure writes skipped because the profile, endpoint or endpoint metadata already matched
+	AzureWritesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "azure",
+		Name:      "writes_skipped_total",
+		Help:      "Number of Azure writes skipped because the cached profile, endpoint or endpoint metadata already matched.",
+	}, []string{"resource"})
+
+	// AzureWriteRateLimitWait observes how long Azure writes waited for the write rate limit
+	AzureWriteRateLimitWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "azure",
+		Name:      "write_rate_limit_wait_seconds",
+		Help:      "Time Azure writes waited for a token from the write rate limit.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 8),
+	})
+
+	// AzureWritesRateLimited counts Azure writes that failed because no token was free before their deadline
+	AzureWritesRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "azure",
+		Name:      "writes_rate_limited_total",
+		Help:      "Number of Azure writes that failed waiting for a token from the write rate limit.",
+	})
+
+	// WebhookRequestsRateLimited counts POST /records requests rejected by the apply rate limit
+	WebhookRequestsRateLimited = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "webhook",
+		Name:      "requests_rate_limited_total",
+		Help:      "Number of POST /records requests from External DNS rejected by the apply rate limit.",
+	})
+
+	// ChangeFailures counts records of ApplyChanges batches that failed while the rest of the batch was applied
+	ChangeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "changes",
+		Name:      "failures_total",
+		Help:      "Number of records in ApplyChanges batches that couldn't be applied, by action and error code.",
+	}, []string{"action", "code"})
+
+	// SyncDuration observes how long syncing the managed profiles from Azure takes
+	SyncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "duration_seconds",
+		Help:      "Time taken to list the managed profiles of every configured resource group from Azure.",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 8),
+	})
+
+	// SyncErrors counts resource groups whose profiles couldn't be listed during a sync
+	SyncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "sync",
+		Name:      "errors_total",
+		Help:      "Number of times a resource group's profiles couldn't be listed from Azure during a sync.",
+	}, []string{"resource_group"})
+
+	// StateCacheProfiles is the number of profiles in the state cache
+	StateCacheProfiles = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "state_cache",
+		Name:      "profiles",
+		Help:      "Number of profiles in the state cache.",
+	})
+
+	// StateCacheBytes is the approximate memory used by the profiles in the state cache
+	StateCacheBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "state_cache",
+		Name:      "bytes",
+		Help:      "Approximate memory used by the profiles in the state cache, in bytes.",
+	})
+
+	// StateCacheEvictions counts profiles evicted from the state cache to stay within its maximum size
+	StateCacheEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "state_cache",
+		Name:      "evictions_total",
+		Help:      "Number of least recently used profiles evicted from the state cache to stay within its maximum size.",
+	})
+
+	// TXTRegistryRecords is the number of External DNS TXT ownership records stored by the webhook
+	TXTRegistryRecords = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "txt_registry",
+		Name:      "records",
+		Help:      "Number of External DNS TXT ownership records stored by the webhook as of the last read or write.",
+	})
+
+	// TrafficViewQueries is the number of DNS queries each endpoint answered in a profile's latest Traffic View heat map
+	TrafficViewQueries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "traffic_view",
+		Name:      "queries",
+		Help:      "DNS queries answered by each endpoint in the time window of the profile's latest Traffic View heat map.",
+	}, []string{"hostname", "endpoint"})
+
+	// TrafficViewSources is the number of source resolvers in a profile's latest Traffic View heat map
+	TrafficViewSources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "traffic_view",
+		Name:      "sources",
+		Help:      "Number of source resolvers in the profile's latest Traffic View heat map.",
+	}, []string{"hostname"})
+
+	// TrafficViewLatency is the query-weighted mean latency each endpoint's users saw in a profile's latest heat map
+	TrafficViewLatency = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "traffic_view",
+		Name:      "latency_milliseconds",
+		Help:      "Mean latency, weighted by queries, measured from the sources of each endpoint's queries in the profile's latest Traffic View heat map.",
+	}, []string{"hostname", "endpoint"})
+
+	// EndpointsDraining is the number of endpoints taken out of rotation and waiting to be deleted
+	EndpointsDraining = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "endpoints",
+		Name:      "draining",
+		Help:      "Number of endpoints taken out of rotation and waiting to be deleted.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		DNSEndpointOperations,
+		DNSEndpointsManaged,
+		DNSEndpointsUnreconciled,
+		ProfilesMissingHostnameTag,
+		ProfilesUnmapped,
+		SilenceExpiry,
+		FallbackActive,
+		NamespaceProfiles,
+		NamespaceEndpoints,
+		NamespaceProfileQuota,
+		NamespaceEndpointQuota,
+		CanaryWeight,
+		CanaryRollbacks,
+		ScheduledStatusChanges,
+		EndpointsDraining,
+		TrafficViewQueries,
+		TrafficViewSources,
+		TrafficViewLatency,
+		ServiceReadyEndpoints,
+		ProfileSettingConflicts,
+		ProfileConfigConflicts,
+		ProfileDeletionsBlocked,
+		ProfilesPendingPurge,
+		ProfilesAdopted,
+		ProfileNameCollisions,
+		AzureWritesSkipped,
+		AzureWriteRateLimitWait,
+		AzureWritesRateLimited,
+		WebhookRequestsRateLimited,
+		ChangeFailures,
+		SyncDuration,
+		SyncErrors,
+		StateCacheProfiles,
+		StateCacheBytes,
+		StateCacheEvictions,
+		TXTRegistryRecords,
+		freshness,
+	)
+}
+
+// Handler serves the metrics in Prometheus format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Result returns the result label value for err
+func Result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
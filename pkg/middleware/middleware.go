@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIDHeader carries the request ID on requests and responses
+	RequestIDHeader = "X-Request-ID"
+
+	// azureRequestIDHeader is sent on Azure calls so they can be found in Azure activity logs
+	azureRequestIDHeader = "x-ms-client-request-id"
+
+	maxRequestIDLength = 128
+)
+
+// Wrap adds a request ID, panic recovery and request logging to next.
+// The request ID is taken from the X-Request-ID header when present, otherwise generated,
+// and is attached to the request context for logging.FromContext and to Azure calls made with it.
+func Wrap(next http.Handler, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		ctx = policy.WithHTTPHeader(ctx, http.Header{azureRequestIDHeader: []string{requestID}})
+		r = r.WithContext(ctx)
+
+		requestLogger := logger.With(zap.String("requestID", requestID))
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+				requestLogger.Error("Recovered from panic in HTTP handler",
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Any("panic", recovered),
+					zap.Stack("stack"))
+				if !recorder.wroteHeader {
+					recorder.Header().Set("Content-Type", "application/json")
+					recorder.WriteHeader(http.StatusInternalServerError)
+					_, _ = recorder.Write([]byte(`{"code":"internal_error","message":"Internal server error"}` + "\n"))
+				}
+			}
+
+			logRequest(requestLogger, r, recorder.status, time.Since(start))
+		}()
+
+		next.ServeHTTP(recorder, r)
+	})
+}
+
+// logRequest logs a completed request; successful requests are logged at debug level
+// so frequent health probes don't flood the logs
+func logRequest(logger *zap.Logger, r *http.Request, status int, duration time.Duration) {
+	fields := []zap.Field{
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", status),
+		zap.Duration("duration", duration),
+	}
+
+	switch {
+	case status >= http.StatusInternalServerError:
+		logger.Error("HTTP request failed", fields...)
+	case status >= http.StatusBadRequest:
+		logger.Warn("HTTP request rejected", fields...)
+	default:
+		logger.Debug("HTTP request completed", fields...)
+	}
+}
+
+// statusRecorder records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(data)
+}
+
+// validRequestID reports whether a caller-supplied request ID is safe to reuse
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 16 byte hex request ID
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestWrap_RequestID(t *testing.T) {
+	var seen string
+	handler := Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = logging.RequestID(r.Context())
+	}), zap.NewNop())
+
+	// A caller-supplied ID is reused
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+	req.Header.Set(RequestIDHeader, "external-dns-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, "external-dns-123", seen)
+	assert.Equal(t, "external-dns-123", rec.Header().Get(RequestIDHeader))
+
+	// Otherwise one is generated
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/records", nil))
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rec.Header().Get(RequestIDHeader))
+}
+
+func TestWrap_RecoversPanic(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	handler := Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), zap.New(core))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/records", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.JSONEq(t, `{"code":"internal_error","message":"Internal server error"}`, rec.Body.String())
+	require.Equal(t, 1, logs.FilterMessage("Recovered from panic in HTTP handler").Len())
+
+	completed := logs.FilterMessage("HTTP request failed").All()
+	require.Len(t, completed, 1)
+	fields := completed[0].ContextMap()
+	assert.Equal(t, int64(http.StatusInternalServerError), fields["status"])
+	assert.Equal(t, "/records", fields["path"])
+	assert.NotEmpty(t, fields["requestID"])
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, validRequestID("abc-123"))
+	assert.False(t, validRequestID(""))
+	assert.False(t, validRequestID("has space"))
+	assert.False(t, validRequestID("line\nbreak"))
+}
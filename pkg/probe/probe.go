@@ -0,0 +1,101 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout matches Traffic Manager's default probe timeout
+const DefaultTimeout = 10 * time.Second
+
+// Config describes a Traffic Manager health probe against one endpoint target
+type Config struct {
+	Target   string // Hostname or IP the endpoint points at
+	Protocol string // HTTP, HTTPS or TCP
+	Port     int64
+	Path     string
+	Timeout  time.Duration
+}
+
+// Result is the predicted outcome of the Azure probe
+type Result struct {
+	Healthy    bool
+	StatusCode int // Zero for TCP probes or when no response was received
+	Latency    time.Duration
+	Reason     string
+}
+
+// Simulate probes the target the way Traffic Manager does and predicts whether Azure's probe would pass.
+// HTTP(S) probes must return 200 within the timeout; redirects are not followed and
+// certificates are not validated. TCP probes only need the connection to succeed.
+func Simulate(ctx context.Context, config Config) Result {
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	address := net.JoinHostPort(config.Target, strconv.FormatInt(config.Port, 10))
+	start := time.Now()
+
+	switch config.Protocol {
+	case "TCP":
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return Result{Latency: time.Since(start), Reason: fmt.Sprintf("TCP connection failed: %v", err)}
+		}
+		conn.Close()
+		return Result{Healthy: true, Latency: time.Since(start), Reason: "TCP connection succeeded"}
+	case "HTTP", "HTTPS":
+	default:
+		return Result{Reason: fmt.Sprintf("unsupported monitor protocol %q", config.Protocol)}
+	}
+
+	path := config.Path
+	if path == "" {
+		path = "/"
+	}
+	url := fmt.Sprintf("%s://%s%s", strings.ToLower(config.Protocol), address, path)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return Result{Reason: fmt.Sprintf("invalid probe URL %s: %v", url, err)}
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			// Traffic Manager doesn't validate endpoint certificates
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Do(req)
+	latency := time.Since(start)
+	if err != nil {
+		return Result{Latency: latency, Reason: fmt.Sprintf("request to %s failed: %v", url, err)}
+	}
+	defer resp.Body.Close()
+
+	result := Result{StatusCode: resp.StatusCode, Latency: latency}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		result.Healthy = true
+		result.Reason = fmt.Sprintf("%s returned 200", url)
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		result.Reason = fmt.Sprintf("%s returned redirect %d; Traffic Manager does not follow redirects", url, resp.StatusCode)
+	default:
+		result.Reason = fmt.Sprintf("%s returned %d; Traffic Manager expects 200", url, resp.StatusCode)
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package probe
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serverConfig(t *testing.T, server *httptest.Server, protocol, path string) Config {
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	portNumber, err := strconv.ParseInt(port, 10, 64)
+	require.NoError(t, err)
+	return Config{Target: host, Protocol: protocol, Port: portNumber, Path: path, Timeout: 2 * time.Second}
+}
+
+func TestSimulate_HTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/healthz", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	result := Simulate(context.Background(), serverConfig(t, server, "HTTP", "/healthz"))
+	assert.True(t, result.Healthy, result.Reason)
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+
+	result = Simulate(context.Background(), serverConfig(t, server, "HTTP", "/health"))
+	assert.False(t, result.Healthy)
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+
+	result = Simulate(context.Background(), serverConfig(t, server, "HTTP", "/moved"))
+	assert.False(t, result.Healthy)
+	assert.Contains(t, result.Reason, "does not follow redirects")
+}
+
+func TestSimulate_HTTPSSkipsCertificateValidation(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	result := Simulate(context.Background(), serverConfig(t, server, "HTTPS", "/"))
+	assert.True(t, result.Healthy, result.Reason)
+}
+
+func TestSimulate_TCP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	config := serverConfig(t, server, "TCP", "")
+
+	result := Simulate(context.Background(), config)
+	assert.True(t, result.Healthy, result.Reason)
+
+	server.Close()
+	result = Simulate(context.Background(), config)
+	assert.False(t, result.Healthy)
+}
+
+func TestSimulate_UnsupportedProtocol(t *testing.T) {
+	result := Simulate(context.Background(), Config{Target: "localhost", Protocol: "UDP", Port: 53})
+	assert.False(t, result.Healthy)
+	assert.Contains(t, result.Reason, "unsupported monitor protocol")
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"go.uber.org/zap"
+)
+
+// trafficManagerRecordTypes are the record types Traffic Manager endpoints can be created for
+var trafficManagerRecordTypes = map[string]bool{"A": true, "AAAA": true, "CNAME": true}
+
+// AdjustEndpoints prepares the desired endpoints before External DNS plans changes, so the plan
+// shows what ApplyChanges will do:
+//   - provider-specific properties the webhook doesn't understand are removed, and Traffic
+//     Manager annotation values are normalized ("weighted" becomes "Weighted")
+//   - Traffic Manager enabled endpoints get the defaults they rely on as annotations
+//   - Traffic Manager enabled endpoints of record types Traffic Manager can't serve are dropped
+//
+// Endpoints whose annotations don't parse are returned for ApplyChanges to report.
+func (p *TrafficManagerProvider) AdjustEndpoints(ctx context.Context, endpoints []*Endpoint) []*Endpoint {
+	adjusted := make([]*Endpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if endpoint.RecordType == recordTypeTXT {
+			adjusted = append(adjusted, endpoint)
+			continue
+		}
+		if result, ok := p.adjustEndpoint(ctx, endpoint); ok {
+			adjusted = append(adjusted, result)
+		}
+	}
+
+	p.log(ctx).Debug("Adjusted endpoints",
+		zap.Int("received", len(endpoints)),
+		zap.Int("returned", len(adjusted)))
+	return adjusted
+}
+
+// adjustEndpoint returns an adjusted copy of endpoint, or false when it is dropped
+func (p *TrafficManagerProvider) adjustEndpoint(ctx context.Context, endpoint *Endpoint) (*Endpoint, bool) {
+	adjusted := *endpoint
+	adjusted.ProviderSpecific = make([]ProviderSpecificProperty, 0, len(endpoint.ProviderSpecific))
+	for _, prop := range endpoint.ProviderSpecific {
+		name := prop.Name
+		if strings.HasPrefix(name, annotations.ResourceAnnotationPrefix) {
+			name = annotations.AnnotationPrefix + strings.TrimPrefix(name, annotations.ResourceAnnotationPrefix)
+		}
+		if !annotations.IsKnownAnnotation(name) {
+			p.log(ctx).Debug("Removing provider-specific property the webhook doesn't understand",
+				zap.String("dnsName", endpoint.DNSName),
+				zap.String("property", prop.Name))
+			continue
+		}
+		adjusted.ProviderSpecific = append(adjusted.ProviderSpecific, ProviderSpecificProperty{
+			Name:  name,
+			Value: annotations.NormalizeValue(name, prop.Value),
+		})
+	}
+
+	annotationMap := adjusted.annotationMap()
+	config, err := p.parseAnnotations(ctx, annotationMap)
+	if err != nil {
+		p.log(ctx).Warn("Invalid Traffic Manager annotations, leaving endpoint for ApplyChanges to report",
+			zap.String("dnsName", endpoint.DNSName),
+			zap.Error(err))
+		return &adjusted, true
+	}
+	if !config.Enabled {
+		return &adjusted, true
+	}
+
+	if !trafficManagerRecordTypes[endpoint.RecordType] {
+		p.log(ctx).Warn("Dropping Traffic Manager enabled endpoint of a record type Traffic Manager can't serve",
+			zap.String("dnsName", endpoint.DNSName),
+			zap.String("recordType", endpoint.RecordType))
+		return nil, false
+	}
+
+	// The defaults in effect now travel with the endpoint, so the plan shows them
+	for _, setting := range []struct{ key, value string }{
+		{annotations.AnnotationResourceGroup, config.ResourceGroup},
+		{annotations.AnnotationRoutingMethod, config.RoutingMethod},
+		{annotations.AnnotationMonitorProtocol, config.MonitorProtocol},
+		{annotations.AnnotationMonitorPort, strconv.FormatInt(config.MonitorPort, 10)},
+		{annotations.AnnotationMonitorPath, config.MonitorPath},
+		{annotations.AnnotationEndpointLocation, config.EndpointLocation},
+	} {
+		if _, set := annotationMap[setting.key]; !set && setting.value != "" {
+			adjusted.ProviderSpecific = append(adjusted.ProviderSpecific, ProviderSpecificProperty{Name: setting.key, Value: setting.value})
+		}
+	}
+	return &adjusted, true
+}
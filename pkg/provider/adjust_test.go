@@ -0,0 +1,80 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAdjustEndpoints(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger:   zaptest.NewLogger(t),
+		defaults: annotations.Defaults{ResourceGroup: "tm-rg", RoutingMethod: "Weighted", MonitorProtocol: "HTTPS", MonitorPort: 443, MonitorPath: "/", EndpointLocation: "eastus"},
+	}
+
+	enabled := &Endpoint{
+		DNSName:    "demo-east.example.com",
+		RecordType: "A",
+		Targets:    []string{"20.30.40.50"},
+		ProviderSpecific: []ProviderSpecificProperty{
+			{Name: annotations.ResourceAnnotationPrefix + "enabled", Value: "True"},
+			{Name: annotations.AnnotationRoutingMethod, Value: "priority"},
+			{Name: annotations.AnnotationPriority, Value: "1"},
+			{Name: "aws/evaluate-target-health", Value: "true"},
+		},
+	}
+	mx := &Endpoint{
+		DNSName:          "demo.example.com",
+		RecordType:       "MX",
+		Targets:          []string{"10 mail.example.com"},
+		ProviderSpecific: []ProviderSpecificProperty{{Name: annotations.AnnotationEnabled, Value: "true"}},
+	}
+	plain := &Endpoint{
+		DNSName:          "other.example.com",
+		RecordType:       "MX",
+		Targets:          []string{"10 mail.example.com"},
+		ProviderSpecific: []ProviderSpecificProperty{{Name: "aws/evaluate-target-health", Value: "true"}},
+	}
+	txt := &Endpoint{DNSName: "demo-east.example.com", RecordType: "TXT", Targets: []string{"heritage=external-dns"}}
+
+	adjusted := p.AdjustEndpoints(context.Background(), []*Endpoint{enabled, mx, plain, txt})
+	require.Len(t, adjusted, 3, "the enabled MX record is dropped")
+
+	assert.Equal(t, []ProviderSpecificProperty{
+		{Name: annotations.AnnotationEnabled, Value: "true"},
+		{Name: annotations.AnnotationRoutingMethod, Value: "Priority"},
+		{Name: annotations.AnnotationPriority, Value: "1"},
+		{Name: annotations.AnnotationResourceGroup, Value: "tm-rg"},
+		{Name: annotations.AnnotationMonitorProtocol, Value: "HTTPS"},
+		{Name: annotations.AnnotationMonitorPort, Value: "443"},
+		{Name: annotations.AnnotationMonitorPath, Value: "/"},
+		{Name: annotations.AnnotationEndpointLocation, Value: "eastus"},
+	}, adjusted[0].ProviderSpecific)
+	assert.Len(t, enabled.ProviderSpecific, 4, "the received endpoint isn't modified")
+
+	assert.Equal(t, "other.example.com", adjusted[1].DNSName)
+	assert.Empty(t, adjusted[1].ProviderSpecific)
+	assert.Same(t, txt, adjusted[2])
+}
+
+func TestAdjustEndpoints_InvalidAnnotations(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t), defaults: annotations.Defaults{ResourceGroup: "tm-rg"}}
+
+	endpoint := &Endpoint{
+		DNSName:    "demo.example.com",
+		RecordType: "A",
+		Targets:    []string{"20.30.40.50"},
+		ProviderSpecific: []ProviderSpecificProperty{
+			{Name: annotations.AnnotationEnabled, Value: "true"},
+			{Name: annotations.AnnotationWeight, Value: "heavy"},
+		},
+	}
+
+	adjusted := p.AdjustEndpoints(context.Background(), []*Endpoint{endpoint})
+	require.Len(t, adjusted, 1)
+	assert.Equal(t, endpoint.ProviderSpecific, adjusted[0].ProviderSpecific, "defaults aren't added to endpoints ApplyChanges rejects")
+}
@@ -0,0 +1,250 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"go.uber.org/zap"
+)
+
+// EndpointStatusRequest is the body accepted by PUT /admin/endpoints/status
+type EndpointStatusRequest struct {
+	Hostname     string `json:"hostname"` // Vanity hostname of the profile
+	EndpointName string `json:"endpointName"`
+	Status       string `json:"status"` // Enabled or Disabled
+}
+
+// CacheInvalidation is the response of DELETE /admin/cache
+type CacheInvalidation struct {
+	Removed int `json:"removed"`
+}
+
+// RequireAdminToken rejects requests to next that don't carry token. A nil token means no admin
+// token is configured, and every request is rejected.
+func (s *WebhookServer) RequireAdminToken(token *WebhookToken, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == nil {
+			s.writeError(w, ErrorCodeUnauthorized, "The admin API is disabled; set ADMIN_TOKEN or ADMIN_TOKEN_FILE to enable it")
+			return
+		}
+		if !token.valid(r) {
+			s.log(r).Warn("Rejected admin API request without a valid token",
+				zap.String("path", r.URL.Path),
+				zap.String("remoteAddr", r.RemoteAddr))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			s.writeError(w, ErrorCodeUnauthorized, "A valid admin token is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdminTokenToChange applies RequireAdminToken to requests other than GET and HEAD, so
+// status can be read without the token but not changed
+func (s *WebhookServer) RequireAdminTokenToChange(token *WebhookToken, next http.Handler) http.Handler {
+	protected := s.RequireAdminToken(token, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		protected.ServeHTTP(w, r)
+	})
+}
+
+// CachedProfiles returns the cached profiles with their cache age, ordered by hostname
+func (p *TrafficManagerProvider) CachedProfiles() []DebugProfile {
+	now := p.now()
+
+	cached := p.stateManager.ListProfiles()
+	slices.SortFunc(cached, func(a, b *state.ProfileState) int { return strings.Compare(a.Hostname, b.Hostname) })
+
+	profiles := make([]DebugProfile, 0, len(cached))
+	for _, profile := range cached {
+		profiles = append(profiles, DebugProfile{
+			Hostname: profile.Hostname,
+			CacheAge: now.Sub(profile.CachedAt).Round(time.Second).String(),
+			Profile:  profile,
+		})
+	}
+	return profiles
+}
+
+// Resync syncs the profiles from Azure straight away, rather than waiting for External DNS to ask
+// for records. Cached profiles that weren't synced, for example because they were deleted in the
+// Azure portal, are removed from the cache.
+func (p *TrafficManagerProvider) Resync(ctx context.Context) (*SyncResult, error) {
+	// The state manager stamps profiles with the wall clock, not p.now
+	start := time.Now()
+	if _, err := p.Records(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, profile := range p.stateManager.ListProfileSnapshots() {
+		if profile.CachedAt.Before(start) {
+			p.stateManager.DeleteProfile(profile.Hostname)
+		}
+	}
+
+	p.lastSyncMu.Lock()
+	defer p.lastSyncMu.Unlock()
+	return p.lastSync, nil
+}
+
+// InvalidateCache removes the cached profile of hostname, or every cached profile when hostname
+// is empty, so the next sync reads them from Azure again. It returns the number of profiles removed.
+func (p *TrafficManagerProvider) InvalidateCache(hostname string) int {
+	if hostname == "" {
+		removed := p.stateManager.Count()
+		p.stateManager.Clear()
+		return removed
+	}
+	if _, ok := p.stateManager.GetProfile(hostname); !ok {
+		return 0
+	}
+	p.stateManager.DeleteProfile(hostname)
+	return 1
+}
+
+// SetEndpointStatus enables or disables a managed endpoint directly in Azure. The annotations
+// stay the source of truth: the next change to the endpoint's status annotations overrides it.
+func (p *TrafficManagerProvider) SetEndpointStatus(ctx context.Context, req EndpointStatusRequest) (*state.EndpointState, error) {
+	if !slices.Contains(annotations.ValidEndpointStatuses, req.Status) {
+		return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("invalid status %q, must be one of: %v", req.Status, annotations.ValidEndpointStatuses))
+	}
+	profile, ok := p.stateManager.GetProfile(req.Hostname)
+	if !ok {
+		return nil, withCode(ErrorCodeNotFound, fmt.Errorf("no cached profile for hostname %q", req.Hostname))
+	}
+	endpoint, ok := profile.Endpoints[req.EndpointName]
+	if !ok {
+		return nil, withCode(ErrorCodeNotFound, fmt.Errorf("profile %s has no endpoint %q", profile.ProfileName, req.EndpointName))
+	}
+
+	tmClient, err := p.clientFor(subscriptionFromResourceID(profile.ResourceID), profile.ResourceGroup)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmClient.UpdateEndpointStatus(ctx, profile.ResourceGroup, profile.ProfileName, endpoint.EndpointType, req.EndpointName, req.Status); err != nil {
+		return nil, fmt.Errorf("failed to update endpoint %s: %w", req.EndpointName, err)
+	}
+
+	p.log(ctx).Warn("Endpoint status changed via admin API",
+		zap.String("hostname", req.Hostname),
+		zap.String("profileName", profile.ProfileName),
+		zap.String("endpointName", req.EndpointName),
+		zap.String("status", req.Status))
+
+	// Disabling an endpoint takes it out of rotation on purpose; enabling it ends the silence
+	if req.Status == "Disabled" {
+		p.silence(ctx, req.Hostname, profile.ProfileName, req.EndpointName, SilenceReasonDisabled)
+	} else {
+		p.unsilence(profile.ProfileName, req.EndpointName)
+	}
+
+	endpoint.Status = req.Status
+	p.stateManager.SetEndpoint(req.Hostname, req.EndpointName, endpoint)
+	return endpoint, nil
+}
+
+// HandleAdminProfiles handles GET /admin/profiles - List the cached profiles and endpoints with their cache age
+func (s *WebhookServer) HandleAdminProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	s.writeAdminJSON(w, r, s.provider.CachedProfiles())
+}
+
+// HandleAdminTrafficView handles GET /admin/trafficview - List the latest Traffic View heat map of
+// each enrolled profile, or only the one of the hostname query parameter
+func (s *WebhookServer) HandleAdminTrafficView(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	views := s.provider.TrafficViews()
+	if hostname := r.URL.Query().Get("hostname"); hostname != "" {
+		views = slices.DeleteFunc(views, func(view TrafficView) bool { return !strings.EqualFold(view.Hostname, hostname) })
+		if len(views) == 0 {
+			s.writeError(w, ErrorCodeNotFound, fmt.Sprintf("No Traffic View heat map for hostname %q", hostname))
+			return
+		}
+	}
+	s.writeAdminJSON(w, r, views)
+}
+
+// HandleAdminResync handles POST /admin/resync - Sync profiles from Azure now
+func (s *WebhookServer) HandleAdminResync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	result, err := s.provider.Resync(r.Context())
+	if err != nil {
+		s.log(r).Error("Failed to resync profiles", zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to resync profiles: %v", err))
+		return
+	}
+	s.log(r).Info("Resynced profiles via admin API", zap.Int("profiles", result.Profiles))
+	s.writeAdminJSON(w, r, result)
+}
+
+// HandleAdminCache handles DELETE /admin/cache - Invalidate the cached profile of the hostname
+// query parameter, or the whole cache without one
+func (s *WebhookServer) HandleAdminCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	hostname := r.URL.Query().Get("hostname")
+	removed := s.provider.InvalidateCache(hostname)
+	s.log(r).Info("Invalidated state cache via admin API",
+		zap.String("hostname", hostname),
+		zap.Int("removed", removed))
+	s.writeAdminJSON(w, r, CacheInvalidation{Removed: removed})
+}
+
+// HandleAdminEndpointStatus handles PUT /admin/endpoints/status - Enable or disable an endpoint
+func (s *WebhookServer) HandleAdminEndpointStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req EndpointStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+
+	endpoint, err := s.provider.SetEndpointStatus(r.Context(), req)
+	if err != nil {
+		s.log(r).Error("Failed to set endpoint status",
+			zap.String("hostname", req.Hostname),
+			zap.String("endpointName", req.EndpointName),
+			zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to set endpoint status: %v", err))
+		return
+	}
+	s.writeAdminJSON(w, r, endpoint)
+}
+
+// writeAdminJSON writes an admin API response
+func (s *WebhookServer) writeAdminJSON(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.log(r).Error("Failed to encode admin response", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
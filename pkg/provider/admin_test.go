@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newAdminProvider(t *testing.T) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		stateManager: state.NewManager(5*time.Minute, logger),
+	}
+	for _, hostname := range []string{"app.example.com", "api.example.com"} {
+		p.stateManager.SetProfile(hostname, &state.ProfileState{
+			ProfileName: strings.ReplaceAll(hostname, ".", "-"),
+			Hostname:    hostname,
+			Endpoints: map[string]*state.EndpointState{
+				"east": {EndpointName: "east", EndpointType: "ExternalEndpoints", Status: "Enabled"},
+			},
+		})
+	}
+	return p
+}
+
+func TestRequireAdminToken(t *testing.T) {
+	s := NewWebhookServer(newAdminProvider(t), zaptest.NewLogger(t))
+	token, err := NewWebhookToken(DefaultWebhookAuthHeader, "s3cret", "")
+	require.NoError(t, err)
+	handler := s.RequireAdminToken(token, http.HandlerFunc(s.HandleAdminProfiles))
+
+	for _, header := range []string{"", "Bearer wrong", "s3cret", "Basic s3cret"} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/profiles", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, "Authorization: %q", header)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/profiles", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var profiles []DebugProfile
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&profiles))
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "api.example.com", profiles[0].Hostname)
+	assert.Contains(t, profiles[0].Profile.Endpoints, "east")
+}
+
+func TestRequireAdminToken_NotConfigured(t *testing.T) {
+	s := NewWebhookServer(newAdminProvider(t), zaptest.NewLogger(t))
+	handler := s.RequireAdminToken(nil, http.HandlerFunc(s.HandleAdminProfiles))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/profiles", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "ADMIN_TOKEN")
+}
+
+func TestRequireAdminTokenToChange(t *testing.T) {
+	p := newAdminProvider(t)
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+	token, err := NewWebhookToken(DefaultWebhookAuthHeader, "s3cret", "")
+	require.NoError(t, err)
+	handler := s.RequireAdminTokenToChange(token, http.HandlerFunc(s.HandleFreeze))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/freeze", nil))
+	assert.Equal(t, http.StatusOK, rec.Code, "status can be read without the token")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/freeze", strings.NewReader(`{"bypassFor":"2h"}`)))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Nil(t, p.FreezeStatus().BypassUntil, "the bypass isn't set")
+
+	req := httptest.NewRequest(http.MethodPut, "/freeze", strings.NewReader(`{"bypassFor":"2h"}`))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandleAdminCache(t *testing.T) {
+	p := newAdminProvider(t)
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleAdminCache(rec, httptest.NewRequest(http.MethodDelete, "/admin/cache?hostname=app.example.com", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"removed":1}`, rec.Body.String())
+	_, ok := p.stateManager.GetProfile("app.example.com")
+	assert.False(t, ok)
+
+	rec = httptest.NewRecorder()
+	s.HandleAdminCache(rec, httptest.NewRequest(http.MethodDelete, "/admin/cache?hostname=other.example.com", nil))
+	assert.JSONEq(t, `{"removed":0}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.HandleAdminCache(rec, httptest.NewRequest(http.MethodDelete, "/admin/cache", nil))
+	assert.JSONEq(t, `{"removed":1}`, rec.Body.String())
+	assert.Equal(t, 0, p.stateManager.Count())
+
+	rec = httptest.NewRecorder()
+	s.HandleAdminCache(rec, httptest.NewRequest(http.MethodGet, "/admin/cache", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestSetEndpointStatus_Invalid(t *testing.T) {
+	p := newAdminProvider(t)
+	ctx := context.Background()
+
+	_, err := p.SetEndpointStatus(ctx, EndpointStatusRequest{Hostname: "app.example.com", EndpointName: "east", Status: "Paused"})
+	assert.Equal(t, ErrorCodeInvalidRequest, errorCode(err))
+
+	_, err = p.SetEndpointStatus(ctx, EndpointStatusRequest{Hostname: "other.example.com", EndpointName: "east", Status: "Disabled"})
+	assert.Equal(t, ErrorCodeNotFound, errorCode(err))
+
+	_, err = p.SetEndpointStatus(ctx, EndpointStatusRequest{Hostname: "app.example.com", EndpointName: "west", Status: "Disabled"})
+	assert.Equal(t, ErrorCodeNotFound, errorCode(err))
+
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+	rec := httptest.NewRecorder()
+	s.HandleAdminEndpointStatus(rec, httptest.NewRequest(http.MethodPut, "/admin/endpoints/status",
+		strings.NewReader(`{"hostname":"app.example.com","endpointName":"west","status":"Disabled"}`)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
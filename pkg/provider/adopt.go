@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// managedProfile reports whether a profile was created by this webhook, using the same rule as the
+// sync: the managed-by tag, or a state record when the tags have been stripped
+func (p *TrafficManagerProvider) managedProfile(profile *state.ProfileState) bool {
+	return p.owner().Manages(profile.ResourceGroup, profile.ProfileName, profile.Tags)
+}
+
+// adoptProfile checks a profile that already exists before the webhook writes to it. Profiles the
+// webhook manages, and profiles that don't exist yet, pass. Other profiles fail with a conflict
+// unless adoption is enabled, in which case a profile with the same routing method is tagged as
+// managed and its endpoints imported into state. It reports whether the profile was adopted; an
+// adopted profile keeps its own settings and tags on this apply.
+func (p *TrafficManagerProvider) adoptProfile(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, hostname string) (bool, error) {
+	existing, err := tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
+	if err != nil {
+		// A missing profile is created; other errors surface from the create
+		return false, nil
+	}
+	if p.managedProfile(existing) {
+		return false, nil
+	}
+
+	if !config.Adopt && !p.adoptProfiles {
+		return false, withCode(ErrorCodeProfileConflict, fmt.Errorf(
+			"profile %s already exists and isn't managed by this webhook; set the adopt annotation to take it over", config.ProfileName))
+	}
+	if !strings.EqualFold(existing.RoutingMethod, config.RoutingMethod) {
+		return false, withCode(ErrorCodeProfileConflict, fmt.Errorf(
+			"can't adopt profile %s: it uses %s routing but the annotations ask for %s", config.ProfileName, existing.RoutingMethod, config.RoutingMethod))
+	}
+
+	owner := p.owner()
+	tags := map[string]string{owner.ManagedByTag: owner.ManagedByValue, owner.HostnameTag: hostname}
+	if err := tmClient.AddProfileTags(ctx, config.ResourceGroup, config.ProfileName, tags); err != nil {
+		return false, fmt.Errorf("failed to adopt profile %s: %w", config.ProfileName, err)
+	}
+	for k, v := range tags {
+		existing.Tags[k] = v
+	}
+	existing.Hostname = hostname
+	p.stateManager.SetProfile(hostname, existing)
+	metrics.ProfilesAdopted.Inc()
+
+	p.log(ctx).Info("Adopted existing Traffic Manager profile",
+		zap.String("hostname", hostname),
+		zap.String("profileName", config.ProfileName),
+		zap.String("resourceGroup", config.ResourceGroup),
+		zap.Int("endpointCount", len(existing.Endpoints)))
+	return true, nil
+}
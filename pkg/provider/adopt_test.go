@@ -0,0 +1,42 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestManagedProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *state.ProfileState
+		want    bool
+	}{
+		{"tagged", &state.ProfileState{ProfileName: "legacy", Tags: map[string]string{"managedBy": trafficmanager.DefaultManagedByValue}}, true},
+		{"tagged by another tool", &state.ProfileState{ProfileName: "app-tm", Tags: map[string]string{"managedBy": "terraform"}}, false},
+		{"untagged with a generated name", &state.ProfileState{ProfileName: "app-example-com-tm", ResourceGroup: "tm-rg", Tags: map[string]string{}}, false},
+		{"untagged in state", &state.ProfileState{ProfileName: "recorded-tm", ResourceGroup: "tm-rg", Tags: map[string]string{}}, true},
+		{"untagged in state in another resource group", &state.ProfileState{ProfileName: "recorded-tm", ResourceGroup: "other-rg", Tags: map[string]string{}}, false},
+		{"untagged", &state.ProfileState{ProfileName: "legacy", Tags: map[string]string{}}, false},
+	}
+	p := &TrafficManagerProvider{stateManager: state.NewManager(5*time.Minute, zaptest.NewLogger(t))}
+	p.stateManager.SetProfile("recorded.example.com", &state.ProfileState{ProfileName: "recorded-tm", ResourceGroup: "tm-rg", Hostname: "recorded.example.com"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.managedProfile(tt.profile))
+		})
+	}
+}
+
+func TestManagedProfile_CustomOwnership(t *testing.T) {
+	staging := &TrafficManagerProvider{ownership: trafficmanager.Ownership{ManagedByValue: "webhook-staging"}}
+	prod := &state.ProfileState{ProfileName: "app-example-com-tm", Tags: map[string]string{"managedBy": trafficmanager.DefaultManagedByValue}}
+	ours := &state.ProfileState{ProfileName: "app-example-com-tm", Tags: map[string]string{"managedBy": "webhook-staging"}}
+
+	assert.False(t, staging.managedProfile(prod), "another deployment's profile isn't claimed")
+	assert.True(t, staging.managedProfile(ours))
+}
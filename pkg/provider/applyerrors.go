@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+)
+
+// Actions of the records in an ApplyChanges batch
+const (
+	changeActionCreate = "create"
+	changeActionUpdate = "update"
+	changeActionDelete = "delete"
+)
+
+// ChangeFailure is a record of an ApplyChanges batch that couldn't be applied
+type ChangeFailure struct {
+	Action        string `json:"action"` // create, update or delete
+	DNSName       string `json:"dnsName"`
+	RecordType    string `json:"recordType,omitempty"`
+	SetIdentifier string `json:"setIdentifier,omitempty"`
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+}
+
+// ApplyError reports the records of an ApplyChanges batch that failed. The other records were
+// applied, and External DNS retries the whole batch, so they are left unchanged the next time.
+type ApplyError struct {
+	Applied  int             // Records applied
+	Failures []ChangeFailure // Records that failed, in the order they were applied
+	errs     []error
+}
+
+func (e *ApplyError) Error() string {
+	messages := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		failure := e.Failures[i]
+		messages[i] = fmt.Sprintf("%s %s: %v", failure.Action, failure.DNSName, err)
+	}
+	return fmt.Sprintf("%d of %d changes failed: %s", len(e.errs), len(e.errs)+e.Applied, strings.Join(messages, "; "))
+}
+
+// Unwrap returns the error of each failed record
+func (e *ApplyError) Unwrap() []error {
+	return e.errs
+}
+
+// Code returns the error code shared by every failure, or ErrorCodePartialFailure when they differ
+func (e *ApplyError) Code() string {
+	code := ""
+	for _, failure := range e.Failures {
+		if code != "" && failure.Code != code {
+			return ErrorCodePartialFailure
+		}
+		code = failure.Code
+	}
+	return code
+}
+
+// add records the failure of endpoint
+func (e *ApplyError) add(action string, endpoint *Endpoint, err error) {
+	code := errorCode(err)
+	metrics.ChangeFailures.WithLabelValues(action, code).Inc()
+	e.errs = append(e.errs, err)
+	e.Failures = append(e.Failures, ChangeFailure{
+		Action:        action,
+		DNSName:       endpoint.DNSName,
+		RecordType:    endpoint.RecordType,
+		SetIdentifier: endpoint.SetIdentifier,
+		Code:          code,
+		Message:       err.Error(),
+	})
+}
+
+// result records the outcome of applying endpoint
+func (e *ApplyError) result(action string, endpoint *Endpoint, err error) {
+	if err != nil {
+		e.add(action, endpoint, err)
+		return
+	}
+	e.Applied++
+}
+
+// errOrNil returns e if any record failed
+func (e *ApplyError) errOrNil() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return e
+}
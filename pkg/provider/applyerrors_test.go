@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestApplyError(t *testing.T) {
+	applyErr := &ApplyError{}
+	applyErr.result(changeActionCreate, &Endpoint{DNSName: "ok.example.com"}, nil)
+	invalid := withCode(ErrorCodeInvalidAnnotation, errors.New("invalid weight"))
+	applyErr.result(changeActionCreate, &Endpoint{DNSName: "bad.example.com", RecordType: "CNAME"}, invalid)
+
+	assert.Equal(t, 1, applyErr.Applied)
+	require.Len(t, applyErr.Failures, 1)
+	assert.Equal(t, ChangeFailure{Action: "create", DNSName: "bad.example.com", RecordType: "CNAME", Code: ErrorCodeInvalidAnnotation, Message: "invalid weight"}, applyErr.Failures[0])
+	assert.Equal(t, "1 of 2 changes failed: create bad.example.com: invalid weight", applyErr.Error())
+	assert.Equal(t, ErrorCodeInvalidAnnotation, errorCode(applyErr), "a single failure keeps its code")
+	assert.ErrorIs(t, applyErr, invalid)
+
+	applyErr.result(changeActionDelete, &Endpoint{DNSName: "other.example.com"}, withCode(ErrorCodePolicyViolation, errors.New("not allowed")))
+	assert.Equal(t, ErrorCodePartialFailure, errorCode(applyErr))
+
+	assert.NoError(t, (&ApplyError{Applied: 3}).errOrNil())
+}
+
+func TestApplyChanges_ContinuesPastFailures(t *testing.T) {
+	policy, err := newResourcePolicy(defaultSub, nil, []string{"tm-rg"}, nil)
+	require.NoError(t, err)
+	p := &TrafficManagerProvider{
+		logger:         zaptest.NewLogger(t),
+		subscriptionID: defaultSub,
+		resourcePolicy: policy,
+	}
+	record := func(dnsName, resourceGroup string) *Endpoint {
+		return &Endpoint{
+			DNSName:    dnsName,
+			Targets:    []string{"1.2.3.4"},
+			RecordType: "A",
+			Labels: map[string]string{
+				annotations.AnnotationEnabled:          "true",
+				annotations.AnnotationResourceGroup:    resourceGroup,
+				annotations.AnnotationEndpointLocation: "eastus",
+			},
+		}
+	}
+
+	// No Azure client is configured: the first and last records fail before any Azure call, and the
+	// record without Traffic Manager annotations is applied between them
+	changes := &Changes{Create: []*Endpoint{
+		record("first.example.com", "prod-rg"),
+		{DNSName: "plain.example.com", Targets: []string{"5.6.7.8"}, RecordType: "A"},
+		record("last.example.com", "other-rg"),
+	}}
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+	body, err := json.Marshal(changes)
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	s.handleApplyChanges(rec, httptest.NewRequest(http.MethodPost, "/records", strings.NewReader(string(body))))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	var resp ErrorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, ErrorCodePolicyViolation, resp.Code)
+	assert.Equal(t, 1, resp.Applied)
+	require.Len(t, resp.Failures, 2)
+	assert.Equal(t, "first.example.com", resp.Failures[0].DNSName)
+	assert.Equal(t, "last.example.com", resp.Failures[1].DNSName)
+	assert.Equal(t, "create", resp.Failures[1].Action)
+
+	assert.NoError(t, p.ApplyChanges(context.Background(), &Changes{Create: changes.Create[1:2]}))
+}
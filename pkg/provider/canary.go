@@ -0,0 +1,307 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// Canary phases
+const (
+	CanaryPhaseProgressing = "progressing"
+	CanaryPhasePaused      = "paused"      // Held while the endpoint is Degraded
+	CanaryPhaseRolledBack  = "rolled-back" // Returned to its start weight after the endpoint degraded
+)
+
+// Canary shifts an endpoint's weight to a target in steps, so a new or reweighted endpoint
+// takes traffic gradually. Completed canaries are dropped; rolled back ones are kept until
+// the endpoint is next changed so they show up on /canaries.
+type Canary struct {
+	Hostname     string    `json:"hostname"`
+	ProfileName  string    `json:"profileName"`
+	EndpointName string    `json:"endpointName"`
+	StartWeight  int64     `json:"startWeight"` // 0 for a new endpoint, which is disabled on rollback
+	TargetWeight int64     `json:"targetWeight"`
+	Weight       int64     `json:"weight"`
+	StepWeight   int64     `json:"stepWeight"`
+	Interval     string    `json:"interval"`
+	OnDegraded   string    `json:"onDegraded"`
+	Phase        string    `json:"phase"`
+	NextStepAt   time.Time `json:"nextStepAt,omitempty"`
+
+	subscriptionID string
+	resourceGroup  string
+	endpointType   string
+	interval       time.Duration
+}
+
+func (c *Canary) key() string {
+	return c.ProfileName + "/" + c.EndpointName
+}
+
+// canaryAction is what a canary does at a step
+type canaryAction int
+
+const (
+	canaryWait canaryAction = iota
+	canaryStep
+	canaryComplete
+	canaryPause
+	canaryRollback
+)
+
+// newCanary plans a canary from start to target weight for an endpoint; the first step is applied by the caller
+func newCanary(config *annotations.TrafficManagerConfig, hostname, endpointName string, start, target int64, now time.Time) *Canary {
+	delta := target - start
+	if delta < 0 {
+		delta = -delta
+	}
+	step := delta * config.CanaryStepPercent / 100
+	if step < 1 {
+		step = 1
+	}
+
+	c := &Canary{
+		Hostname:       hostname,
+		ProfileName:    config.ProfileName,
+		EndpointName:   endpointName,
+		StartWeight:    start,
+		TargetWeight:   target,
+		Weight:         start,
+		StepWeight:     step,
+		Interval:       config.CanaryInterval.String(),
+		OnDegraded:     config.CanaryOnDegraded,
+		Phase:          CanaryPhaseProgressing,
+		subscriptionID: config.SubscriptionID,
+		resourceGroup:  config.ResourceGroup,
+		endpointType:   config.EndpointType,
+		interval:       config.CanaryInterval,
+	}
+	c.Weight = c.nextWeight()
+	c.NextStepAt = now.Add(c.interval)
+	return c
+}
+
+// nextWeight returns the weight one step closer to the target, never below the minimum weight
+func (c *Canary) nextWeight() int64 {
+	weight := c.Weight + c.StepWeight
+	if c.TargetWeight < c.Weight {
+		weight = c.Weight - c.StepWeight
+	}
+	if (c.TargetWeight >= c.Weight && weight > c.TargetWeight) || (c.TargetWeight < c.Weight && weight < c.TargetWeight) {
+		weight = c.TargetWeight
+	}
+	if weight < annotations.MinWeight {
+		weight = annotations.MinWeight
+	}
+	return weight
+}
+
+// advance decides the canary's next action from the endpoint's monitor status.
+// A Degraded endpoint pauses or rolls back the canary; a paused canary resumes once it recovers.
+func (c *Canary) advance(now time.Time, monitorStatus string) canaryAction {
+	if c.Phase == CanaryPhaseRolledBack {
+		return canaryWait
+	}
+	if monitorStatus == monitorStatusDegraded {
+		if c.OnDegraded == annotations.CanaryOnDegradedRollback {
+			return canaryRollback
+		}
+		if c.Phase != CanaryPhasePaused {
+			return canaryPause
+		}
+		return canaryWait
+	}
+	if c.Phase != CanaryPhasePaused && now.Before(c.NextStepAt) {
+		return canaryWait
+	}
+	if c.Weight == c.TargetWeight {
+		return canaryComplete
+	}
+	return canaryStep
+}
+
+// startCanary tracks a canary, replacing any earlier one for the same endpoint
+func (p *TrafficManagerProvider) startCanary(ctx context.Context, c *Canary) {
+	p.canariesMu.Lock()
+	defer p.canariesMu.Unlock()
+
+	if p.canaries == nil {
+		p.canaries = make(map[string]*Canary)
+	}
+	p.canaries[c.key()] = c
+	metrics.CanaryWeight.WithLabelValues(c.ProfileName, c.EndpointName).Set(float64(c.Weight))
+
+	p.log(ctx).Info("Started canary",
+		zap.String("profileName", c.ProfileName),
+		zap.String("endpointName", c.EndpointName),
+		zap.Int64("startWeight", c.StartWeight),
+		zap.Int64("targetWeight", c.TargetWeight),
+		zap.Int64("weight", c.Weight),
+		zap.Duration("interval", c.interval))
+}
+
+// stopCanary forgets an endpoint's canary, for example when the endpoint is deleted or reweighted directly
+func (p *TrafficManagerProvider) stopCanary(profileName, endpointName string) {
+	p.canariesMu.Lock()
+	defer p.canariesMu.Unlock()
+
+	key := profileName + "/" + endpointName
+	if _, ok := p.canaries[key]; ok {
+		delete(p.canaries, key)
+		metrics.CanaryWeight.DeleteLabelValues(profileName, endpointName)
+	}
+}
+
+// canaryWeight returns the weight to create or update an endpoint with, starting a canary when the
+// annotations ask for one. start is the endpoint's current weight, or 0 for a new endpoint.
+func (p *TrafficManagerProvider) canaryWeight(ctx context.Context, config *annotations.TrafficManagerConfig, hostname, endpointName string, start, target int64) int64 {
+	if config.CanaryStepPercent == 0 || start == target {
+		p.stopCanary(config.ProfileName, endpointName)
+		return target
+	}
+
+	c := newCanary(config, hostname, endpointName, start, target, p.now())
+	p.startCanary(ctx, c)
+	return c.Weight
+}
+
+// Canaries returns the tracked canaries, ordered by profile and endpoint
+func (p *TrafficManagerProvider) Canaries() []Canary {
+	p.canariesMu.Lock()
+	defer p.canariesMu.Unlock()
+
+	canaries := make([]Canary, 0, len(p.canaries))
+	for _, c := range p.canaries {
+		canaries = append(canaries, *c)
+	}
+	sort.Slice(canaries, func(i, j int) bool { return canaries[i].key() < canaries[j].key() })
+	return canaries
+}
+
+// AdvanceCanaries moves every canary that is due one step towards its target weight,
+// pausing or rolling back canaries whose endpoint is Degraded. It returns the number of weights changed.
+func (p *TrafficManagerProvider) AdvanceCanaries(ctx context.Context) (int, error) {
+	p.canariesMu.Lock()
+	canaries := make([]*Canary, 0, len(p.canaries))
+	for _, c := range p.canaries {
+		canaries = append(canaries, c)
+	}
+	p.canariesMu.Unlock()
+
+	changed := 0
+	for _, c := range canaries {
+		if c.Phase == CanaryPhaseRolledBack {
+			continue
+		}
+
+		tmClient, err := p.clientFor(c.subscriptionID, c.resourceGroup)
+		if err != nil {
+			return changed, err
+		}
+
+		// Monitor status changes without any apply, so it's read from Azure rather than the cache
+		endpoint, err := tmClient.GetEndpoint(ctx, c.resourceGroup, c.ProfileName, c.endpointType, c.EndpointName)
+		if err != nil {
+			if trafficmanager.IsNotFound(err) {
+				p.stopCanary(c.ProfileName, c.EndpointName)
+				continue
+			}
+			p.log(ctx).Warn("Failed to read canary endpoint",
+				zap.String("profileName", c.ProfileName),
+				zap.String("endpointName", c.EndpointName),
+				zap.Error(err))
+			continue
+		}
+
+		if p.applyCanaryAction(ctx, tmClient, c, c.advance(p.now(), endpoint.MonitorStatus)) {
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+// applyCanaryAction carries out a canary action, returning whether the endpoint changed
+func (p *TrafficManagerProvider) applyCanaryAction(ctx context.Context, tmClient *trafficmanager.Client, c *Canary, action canaryAction) bool {
+	logger := p.log(ctx).With(
+		zap.String("profileName", c.ProfileName),
+		zap.String("endpointName", c.EndpointName))
+
+	switch action {
+	case canaryStep:
+		weight := c.nextWeight()
+		if err := tmClient.UpdateEndpointWeight(ctx, c.resourceGroup, c.ProfileName, c.endpointType, c.EndpointName, weight); err != nil {
+			logger.Error("Failed to step canary weight", zap.Int64("weight", weight), zap.Error(err))
+			return false
+		}
+		logger.Info("Stepped canary weight", zap.Int64("weight", weight), zap.Int64("targetWeight", c.TargetWeight))
+
+		p.canariesMu.Lock()
+		c.Weight = weight
+		c.Phase = CanaryPhaseProgressing
+		c.NextStepAt = p.now().Add(c.interval)
+		p.canariesMu.Unlock()
+		metrics.CanaryWeight.WithLabelValues(c.ProfileName, c.EndpointName).Set(float64(weight))
+		return true
+
+	case canaryComplete:
+		logger.Info("Canary reached its target weight", zap.Int64("weight", c.Weight))
+		p.stopCanary(c.ProfileName, c.EndpointName)
+
+	case canaryPause:
+		logger.Warn("Pausing canary while the endpoint is Degraded", zap.Int64("weight", c.Weight))
+		p.canariesMu.Lock()
+		c.Phase = CanaryPhasePaused
+		p.canariesMu.Unlock()
+
+	case canaryRollback:
+		var err error
+		if c.StartWeight == 0 {
+			// A new endpoint had no traffic before the canary
+			err = tmClient.UpdateEndpointStatus(ctx, c.resourceGroup, c.ProfileName, c.endpointType, c.EndpointName, "Disabled")
+		} else {
+			err = tmClient.UpdateEndpointWeight(ctx, c.resourceGroup, c.ProfileName, c.endpointType, c.EndpointName, c.StartWeight)
+		}
+		if err != nil {
+			logger.Error("Failed to roll back canary", zap.Error(err))
+			return false
+		}
+		logger.Warn("Rolled back canary because the endpoint is Degraded",
+			zap.Int64("weight", c.Weight),
+			zap.Int64("startWeight", c.StartWeight))
+
+		p.canariesMu.Lock()
+		c.Weight = c.StartWeight
+		c.Phase = CanaryPhaseRolledBack
+		c.NextStepAt = time.Time{}
+		p.canariesMu.Unlock()
+		metrics.CanaryWeight.WithLabelValues(c.ProfileName, c.EndpointName).Set(float64(c.StartWeight))
+		metrics.CanaryRollbacks.WithLabelValues(c.ProfileName).Inc()
+		return true
+	}
+
+	return false
+}
+
+// RunCanaryController runs AdvanceCanaries every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunCanaryController(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.AdvanceCanaries(ctx); err != nil {
+				p.log(ctx).Error("Canary controller failed", zap.Error(err))
+			}
+		}
+	}
+}
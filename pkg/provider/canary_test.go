@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func canaryConfig(onDegraded string) *annotations.TrafficManagerConfig {
+	return &annotations.TrafficManagerConfig{
+		ProfileName:       "app-example-com-tm",
+		ResourceGroup:     "tm-rg",
+		EndpointType:      annotations.DefaultEndpointType,
+		CanaryStepPercent: 10,
+		CanaryInterval:    5 * time.Minute,
+		CanaryOnDegraded:  onDegraded,
+	}
+}
+
+func TestNewCanary_Steps(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	c := newCanary(canaryConfig(annotations.CanaryOnDegradedPause), "app.example.com", "east", 0, 500, now)
+
+	assert.Equal(t, int64(50), c.StepWeight)
+	assert.Equal(t, int64(50), c.Weight, "the first step is applied on creation")
+	assert.Equal(t, now.Add(5*time.Minute), c.NextStepAt)
+	assert.Equal(t, "5m0s", c.Interval)
+
+	// Steps never overshoot the target
+	c.Weight = 480
+	assert.Equal(t, int64(500), c.nextWeight())
+
+	// Weight can also be shifted down, never below the minimum weight
+	c = newCanary(canaryConfig(annotations.CanaryOnDegradedPause), "app.example.com", "east", 100, 1, now)
+	assert.Equal(t, int64(9), c.StepWeight)
+	assert.Equal(t, int64(91), c.Weight)
+	c.Weight = 5
+	assert.Equal(t, int64(1), c.nextWeight())
+
+	// Small changes still move at least one weight per step
+	c = newCanary(canaryConfig(annotations.CanaryOnDegradedPause), "app.example.com", "east", 10, 15, now)
+	assert.Equal(t, int64(1), c.StepWeight)
+}
+
+func TestCanaryAdvance(t *testing.T) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	c := newCanary(canaryConfig(annotations.CanaryOnDegradedPause), "app.example.com", "east", 0, 100, now)
+
+	assert.Equal(t, canaryWait, c.advance(now.Add(time.Minute), "Online"))
+	assert.Equal(t, canaryStep, c.advance(now.Add(5*time.Minute), "Online"))
+	assert.Equal(t, canaryStep, c.advance(now.Add(5*time.Minute), "CheckingEndpoint"))
+
+	// Degraded endpoints pause the canary until they recover
+	assert.Equal(t, canaryPause, c.advance(now.Add(time.Minute), monitorStatusDegraded))
+	c.Phase = CanaryPhasePaused
+	assert.Equal(t, canaryWait, c.advance(now.Add(time.Minute), monitorStatusDegraded))
+	assert.Equal(t, canaryStep, c.advance(now.Add(time.Minute), "Online"), "a recovered canary resumes without waiting")
+
+	c.Phase = CanaryPhaseProgressing
+	c.Weight = c.TargetWeight
+	assert.Equal(t, canaryComplete, c.advance(now.Add(5*time.Minute), "Online"))
+
+	c = newCanary(canaryConfig(annotations.CanaryOnDegradedRollback), "app.example.com", "east", 0, 100, now)
+	assert.Equal(t, canaryRollback, c.advance(now, monitorStatusDegraded))
+	c.Phase = CanaryPhaseRolledBack
+	assert.Equal(t, canaryWait, c.advance(now.Add(time.Hour), "Online"), "rolled back canaries stay put")
+}
+
+func TestCanaryWeight(t *testing.T) {
+	p, _, _, _ := newReadinessProvider(t)
+	ctx := context.Background()
+	config := canaryConfig(annotations.CanaryOnDegradedPause)
+
+	assert.Equal(t, int64(10), p.canaryWeight(ctx, config, "app.example.com", "east", 0, 100))
+	canaries := p.Canaries()
+	require.Len(t, canaries, 1)
+	assert.Equal(t, "east", canaries[0].EndpointName)
+	assert.Equal(t, CanaryPhaseProgressing, canaries[0].Phase)
+
+	// A new target replaces the canary
+	assert.Equal(t, int64(20), p.canaryWeight(ctx, config, "app.example.com", "east", 10, 110))
+	require.Len(t, p.Canaries(), 1)
+	assert.Equal(t, int64(110), p.Canaries()[0].TargetWeight)
+
+	// Without a canary step the weight is applied at once and any canary is dropped
+	config.CanaryStepPercent = 0
+	assert.Equal(t, int64(300), p.canaryWeight(ctx, config, "app.example.com", "east", 20, 300))
+	assert.Empty(t, p.Canaries())
+}
+
+func TestHandleCanaries(t *testing.T) {
+	p, _, _, _ := newReadinessProvider(t)
+	p.canaryWeight(context.Background(), canaryConfig(annotations.CanaryOnDegradedPause), "app.example.com", "east", 0, 100)
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleCanaries(rec, httptest.NewRequest(http.MethodGet, "/canaries", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var canaries []Canary
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &canaries))
+	require.Len(t, canaries, 1)
+	assert.Equal(t, int64(10), canaries[0].Weight)
+
+	rec = httptest.NewRecorder()
+	s.HandleCanaries(rec, httptest.NewRequest(http.MethodPost, "/canaries", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
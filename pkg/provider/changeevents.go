@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Event Grid event types handled by /eventgrid
+const (
+	eventGridSubscriptionValidation = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	eventResourceWriteSuccess       = "Microsoft.Resources.ResourceWriteSuccess"
+	eventResourceDeleteSuccess      = "Microsoft.Resources.ResourceDeleteSuccess"
+)
+
+// profileIDSegment precedes the profile name in Traffic Manager resource IDs
+const profileIDSegment = "/providers/microsoft.network/trafficmanagerprofiles/"
+
+// EventGridEvent is an event in the Event Grid schema, as delivered to /eventgrid
+type EventGridEvent struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"eventType"`
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// resourceEventData is the part of an Azure Resource Manager event's data the webhook reads
+type resourceEventData struct {
+	ResourceURI string `json:"resourceUri"`
+}
+
+// subscriptionValidationData is the data of the event Event Grid sends to confirm a new subscription
+type subscriptionValidationData struct {
+	ValidationCode string `json:"validationCode"`
+}
+
+// SubscriptionValidationResponse answers Event Grid's subscription validation event
+type SubscriptionValidationResponse struct {
+	ValidationResponse string `json:"validationResponse"`
+}
+
+// ProfileChanged handles a change to the Azure resource resourceID made outside the webhook.
+// When it is a Traffic Manager profile or one of its endpoints, the cached profile is removed
+// and a resync is requested; it reports whether it was.
+func (p *TrafficManagerProvider) ProfileChanged(ctx context.Context, resourceID string) bool {
+	profileID, ok := profileIDOf(resourceID)
+	if !ok {
+		return false
+	}
+
+	for _, profile := range p.stateManager.ListProfileSnapshots() {
+		if strings.EqualFold(profile.ResourceID, profileID) {
+			p.stateManager.DeleteProfile(profile.Hostname)
+		}
+	}
+	p.log(ctx).Info("Traffic Manager profile changed in Azure, resyncing",
+		zap.String("resourceID", resourceID))
+
+	// A resync already requested covers this change too
+	select {
+	case p.changes <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// RunChangeResync resyncs the profiles from Azure after ProfileChanged until ctx is cancelled
+func (p *TrafficManagerProvider) RunChangeResync(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.changes:
+			if _, err := p.Resync(ctx); err != nil {
+				p.log(ctx).Error("Resync after profile change failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// profileIDOf returns the ID of the Traffic Manager profile resourceID is, or that its endpoint
+// belongs to
+func profileIDOf(resourceID string) (string, bool) {
+	i := strings.Index(strings.ToLower(resourceID), profileIDSegment)
+	if i < 0 {
+		return "", false
+	}
+	end := i + len(profileIDSegment)
+	name, _, _ := strings.Cut(resourceID[end:], "/")
+	if name == "" {
+		return "", false
+	}
+	return resourceID[:end] + name, true
+}
+
+// RequireEventGridKey rejects requests to next that don't carry key as the key query parameter,
+// which the Event Grid subscription's endpoint URL includes
+func (s *WebhookServer) RequireEventGridKey(key string, next http.Handler) http.Handler {
+	expected := []byte(key)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("key")), expected) != 1 {
+			s.log(r).Warn("Rejected Event Grid delivery without a valid key",
+				zap.String("remoteAddr", r.RemoteAddr))
+			s.writeError(w, ErrorCodeUnauthorized, "A valid key is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandleEventGrid handles POST /eventgrid - Resync when Event Grid reports a change to a Traffic
+// Manager profile, and answer the validation event of a new Event Grid subscription
+func (s *WebhookServer) HandleEventGrid(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var events []EventGridEvent
+	if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+		s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+
+	for _, event := range events {
+		switch event.EventType {
+		case eventGridSubscriptionValidation:
+			var data subscriptionValidationData
+			if err := json.Unmarshal(event.Data, &data); err != nil {
+				s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid validation event: %v", err))
+				return
+			}
+			s.log(r).Info("Validated Event Grid subscription", zap.String("subject", event.Subject))
+			s.writeAdminJSON(w, r, SubscriptionValidationResponse{ValidationResponse: data.ValidationCode})
+			return
+
+		case eventResourceWriteSuccess, eventResourceDeleteSuccess:
+			var data resourceEventData
+			if err := json.Unmarshal(event.Data, &data); err != nil || data.ResourceURI == "" {
+				data.ResourceURI = event.Subject
+			}
+			s.provider.ProfileChanged(r.Context(), data.ResourceURI)
+
+		default:
+			s.log(r).Debug("Ignoring Event Grid event",
+				zap.String("id", event.ID),
+				zap.String("eventType", event.EventType))
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+const testProfileID = "/subscriptions/sub/resourceGroups/tm-rg/providers/Microsoft.Network/trafficManagerProfiles/app-example-com"
+
+func TestProfileIDOf(t *testing.T) {
+	for resourceID, want := range map[string]string{
+		testProfileID: testProfileID,
+		testProfileID + "/externalEndpoints/east": testProfileID,
+		strings.ToLower(testProfileID):            strings.ToLower(testProfileID),
+	} {
+		got, ok := profileIDOf(resourceID)
+		assert.True(t, ok, resourceID)
+		assert.Equal(t, want, got)
+	}
+
+	for _, resourceID := range []string{
+		"/subscriptions/sub/resourceGroups/tm-rg/providers/Microsoft.Network/publicIPAddresses/ip",
+		"/subscriptions/sub/resourceGroups/tm-rg/providers/Microsoft.Network/trafficManagerProfiles/",
+		"",
+	} {
+		_, ok := profileIDOf(resourceID)
+		assert.False(t, ok, resourceID)
+	}
+}
+
+func TestHandleEventGrid(t *testing.T) {
+	p := newAdminProvider(t)
+	p.changes = make(chan struct{}, 1)
+	cached, _ := p.stateManager.GetProfile("app.example.com")
+	cached.ResourceID = testProfileID
+	p.stateManager.SetProfile("app.example.com", cached)
+
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+	handler := s.RequireEventGridKey("s3cret", http.HandlerFunc(s.HandleEventGrid))
+
+	post := func(target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, strings.NewReader(body)))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("/eventgrid", `[]`).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/eventgrid?key=wrong", `[]`).Code)
+
+	// Event Grid confirms a new subscription by having its validation code echoed
+	rec := post("/eventgrid?key=s3cret", `[{"id":"1","eventType":"Microsoft.EventGrid.SubscriptionValidationEvent","data":{"validationCode":"abc123"}}]`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var validation SubscriptionValidationResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&validation))
+	assert.Equal(t, "abc123", validation.ValidationResponse)
+
+	// Changes to other resources leave the cache alone
+	rec = post("/eventgrid?key=s3cret", `[{"id":"2","eventType":"Microsoft.Resources.ResourceWriteSuccess","data":{"resourceUri":"/subscriptions/sub/resourceGroups/tm-rg/providers/Microsoft.Network/publicIPAddresses/ip"}}]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, p.changes, 0)
+
+	// Two changes to one profile invalidate it and request a single resync
+	rec = post("/eventgrid?key=s3cret", `[
+		{"id":"3","eventType":"Microsoft.Resources.ResourceWriteSuccess","data":{"resourceUri":"`+testProfileID+`/externalEndpoints/east"}},
+		{"id":"4","eventType":"Microsoft.Resources.ResourceDeleteSuccess","subject":"`+testProfileID+`","data":{}}
+	]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, p.changes, 1)
+	_, ok := p.stateManager.GetProfile("app.example.com")
+	assert.False(t, ok, "the changed profile is no longer cached")
+	_, ok = p.stateManager.GetProfile("api.example.com")
+	assert.True(t, ok)
+
+	assert.Equal(t, http.StatusBadRequest, post("/eventgrid?key=s3cret", `{`).Code)
+}
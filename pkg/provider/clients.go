@@ -0,0 +1,166 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// clientFor returns the Traffic Manager client for a resource group, creating it on first use.
+// An empty subscription ID selects the webhook's default subscription, and an empty resource
+// group the client for the whole subscription. Resource groups and subscriptions with a scoped
+// credential get a client of their own using it.
+func (p *TrafficManagerProvider) clientFor(subscriptionID, resourceGroup string) (*trafficmanager.Client, error) {
+	if subscriptionID == "" {
+		subscriptionID = p.subscriptionID
+	}
+	scope := p.credentialScope(subscriptionID, resourceGroup)
+	if scope == "" && subscriptionID == p.subscriptionID {
+		return p.tmClient, nil
+	}
+
+	key, credential := subscriptionID, p.credential
+	if scope != "" {
+		key, credential = scope, p.scopedCredentials[scope]
+	}
+
+	p.clientsMu.Lock()
+	defer p.clientsMu.Unlock()
+
+	if client, ok := p.clients[key]; ok {
+		return client, nil
+	}
+
+	client, err := trafficmanager.NewClient(subscriptionID, credential, p.clientOptions, p.tmLogger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Traffic Manager client for subscription %s: %w", subscriptionID, err)
+	}
+	client.SetOwnership(p.owner())
+
+	if p.clients == nil {
+		p.clients = make(map[string]*trafficmanager.Client)
+	}
+	p.clients[key] = client
+
+	return client, nil
+}
+
+// resourceGroupsBySubscription groups configured resource groups by subscription.
+// Entries may be plain resource group names (default subscription) or
+// "<subscription-id>/<resource-group>" to sync a group from another subscription.
+func resourceGroupsBySubscription(resourceGroups []string, defaultSubscription string) map[string][]string {
+	grouped := make(map[string][]string)
+	for _, entry := range resourceGroups {
+		subscriptionID, resourceGroup := defaultSubscription, entry
+		if i := strings.Index(entry, "/"); i >= 0 {
+			subscriptionID, resourceGroup = entry[:i], entry[i+1:]
+		}
+		if resourceGroup == "" {
+			continue
+		}
+		grouped[subscriptionID] = append(grouped[subscriptionID], resourceGroup)
+	}
+	return grouped
+}
+
+// syncProfiles syncs the managed profiles of every configured resource group from Azure, per
+// subscription, or of whole subscriptions with subscription discovery. When some resource groups
+// or subscriptions fail, the profiles of the others are returned with a *trafficmanager.SyncError
+// naming the failed ones as they are configured, a failed subscription as "<subscription-id>/*".
+func (p *TrafficManagerProvider) syncProfiles(ctx context.Context) ([]*state.ProfileState, error) {
+	start := time.Now()
+	defer func() { metrics.SyncDuration.Observe(time.Since(start).Seconds()) }()
+
+	var profiles []*state.ProfileState
+	failed := make(map[string]error)
+	grouped := resourceGroupsBySubscription(p.resourceGroups, p.subscriptionID)
+
+	if p.profileDiscovery == ProfileDiscoverySubscription {
+		if _, ok := grouped[p.subscriptionID]; !ok {
+			grouped[p.subscriptionID] = nil
+		}
+		for _, subscriptionID := range sortedKeys(grouped) {
+			tmClient, err := p.clientFor(subscriptionID, "")
+			if err != nil {
+				return nil, err
+			}
+
+			synced, err := tmClient.SyncSubscriptionProfiles(ctx)
+			if err != nil {
+				p.log(ctx).Error("Failed to list profiles in subscription",
+					zap.String("subscriptionID", subscriptionID),
+					zap.Error(err))
+				failed[subscriptionID+"/*"] = err
+				continue
+			}
+			profiles = append(profiles, synced...)
+		}
+		return profiles, syncFailures(failed)
+	}
+
+	for _, subscriptionID := range sortedKeys(grouped) {
+		// Resource groups with a scoped credential are listed by a client of their own
+		var clients []*trafficmanager.Client
+		byClient := make(map[*trafficmanager.Client][]string)
+		for _, resourceGroup := range grouped[subscriptionID] {
+			tmClient, err := p.clientFor(subscriptionID, resourceGroup)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := byClient[tmClient]; !ok {
+				clients = append(clients, tmClient)
+			}
+			byClient[tmClient] = append(byClient[tmClient], resourceGroup)
+		}
+
+		for _, tmClient := range clients {
+			synced, err := tmClient.SyncProfilesFromAzure(ctx, byClient[tmClient])
+			var syncErr *trafficmanager.SyncError
+			if err != nil && !errors.As(err, &syncErr) {
+				return nil, err
+			}
+			profiles = append(profiles, synced...)
+
+			if syncErr != nil {
+				for resourceGroup, err := range syncErr.ResourceGroups {
+					if subscriptionID != p.subscriptionID {
+						resourceGroup = subscriptionID + "/" + resourceGroup
+					}
+					failed[resourceGroup] = err
+				}
+			}
+		}
+	}
+
+	return profiles, syncFailures(failed)
+}
+
+// syncFailures counts the failed resource groups and returns them as a *trafficmanager.SyncError,
+// or nil when there are none
+func syncFailures(failed map[string]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	for resourceGroup := range failed {
+		metrics.SyncErrors.WithLabelValues(resourceGroup).Inc()
+	}
+	return &trafficmanager.SyncError{ResourceGroups: failed}
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestResourceGroupsBySubscription(t *testing.T) {
+	grouped := resourceGroupsBySubscription([]string{
+		"tm-rg",
+		"other-sub/tm-rg-2",
+		"tm-rg-3",
+		"other-sub/",
+	}, "default-sub")
+
+	assert.Equal(t, map[string][]string{
+		"default-sub": {"tm-rg", "tm-rg-3"},
+		"other-sub":   {"tm-rg-2"},
+	}, grouped)
+	assert.Equal(t, []string{"default-sub", "other-sub"}, sortedKeys(grouped))
+}
+
+func TestClientFor_DefaultSubscription(t *testing.T) {
+	p := &TrafficManagerProvider{subscriptionID: "default-sub"}
+
+	client, err := p.clientFor("", "tm-rg")
+	assert.NoError(t, err)
+	assert.Same(t, p.tmClient, client)
+
+	client, err = p.clientFor("default-sub", "")
+	assert.NoError(t, err)
+	assert.Same(t, p.tmClient, client)
+}
+
+func TestSyncFailures(t *testing.T) {
+	assert.NoError(t, syncFailures(map[string]error{}))
+
+	failed := map[string]error{"other-sub/*": errors.New("authorization failed")}
+	err := syncFailures(failed)
+
+	var syncErr *trafficmanager.SyncError
+	assert.ErrorAs(t, err, &syncErr)
+	assert.Equal(t, failed, syncErr.ResourceGroups)
+	assert.Contains(t, err.Error(), "other-sub/*: authorization failed")
+}
+
+func TestParseScopedCredentials(t *testing.T) {
+	configs, err := parseScopedCredentials([]string{
+		"customer-rg=tenant-a",
+		"Other-Sub/*=tenant-b:client-b",
+		"other-sub/shared-rg=tenant-c",
+	}, "default-sub")
+	require.NoError(t, err)
+	assert.Equal(t, []scopedCredentialConfig{
+		{scope: "default-sub/customer-rg", tenantID: "tenant-a"},
+		{scope: "other-sub/*", tenantID: "tenant-b", clientID: "client-b"},
+		{scope: "other-sub/shared-rg", tenantID: "tenant-c"},
+	}, configs)
+
+	for _, entry := range []string{"customer-rg", "customer-rg=", "=tenant-a", "*=tenant-a", "/rg=tenant-a", "sub/=tenant-a"} {
+		_, err := parseScopedCredentials([]string{entry}, "default-sub")
+		assert.Error(t, err, entry)
+	}
+	_, err = parseScopedCredentials([]string{"rg=tenant-a", "default-sub/RG=tenant-b"}, "default-sub")
+	assert.ErrorContains(t, err, "more than once")
+}
+
+// tokenCredential hands out a fixed token, identifying the credential a request used
+type tokenCredential string
+
+func (c tokenCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(c), ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// tokensByResourceGroup records the token of each request to a resource group
+type tokensByResourceGroup struct {
+	azure  *fakeazure.Server
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+func (r *tokensByResourceGroup) Do(req *http.Request) (*http.Response, error) {
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(segments) >= 4 && strings.EqualFold(segments[2], "resourceGroups") {
+		r.mu.Lock()
+		r.tokens[segments[1]+"/"+segments[3]] = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		r.mu.Unlock()
+	}
+	return r.azure.Do(req)
+}
+
+func TestClientFor_ScopedCredentials(t *testing.T) {
+	transport := &tokensByResourceGroup{azure: fakeazure.New(), tokens: make(map[string]string)}
+	p, err := NewTrafficManagerProvider(&Config{
+		SubscriptionID: "default-sub",
+		Credential:     tokenCredential("default"),
+		ClientOptions:  trafficmanager.ClientOptions{Transport: transport},
+		ResourceGroups: []string{"tm-rg", "customer-rg", "other-sub/shared-rg", "lighthouse-sub/delegated-rg"},
+	}, nil, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	p.scopedCredentials = map[string]azcore.TokenCredential{
+		"default-sub/customer-rg": tokenCredential("customer"),
+		"lighthouse-sub/*":        tokenCredential("lighthouse"),
+	}
+
+	customer, err := p.clientFor("", "Customer-RG")
+	require.NoError(t, err)
+	assert.NotSame(t, p.tmClient, customer, "a scoped resource group has a client of its own")
+	again, err := p.clientFor("default-sub", "customer-rg")
+	require.NoError(t, err)
+	assert.Same(t, customer, again)
+
+	_, err = p.syncProfiles(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"default-sub/tm-rg":           "default",
+		"default-sub/customer-rg":     "customer",
+		"other-sub/shared-rg":         "default",
+		"lighthouse-sub/delegated-rg": "lighthouse",
+	}, transport.tokens)
+}
@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+// Vanity record modes control how the vanity hostname CNAME is published
+const (
+	// VanityRecordModeDNSEndpoint publishes vanity CNAMEs as DNSEndpoint CRDs for external-dns to pick up
+	VanityRecordModeDNSEndpoint = "dnsendpoint"
+
+	// VanityRecordModeAzureDNS writes vanity records directly to an Azure DNS zone
+	VanityRecordModeAzureDNS = "azure-dns"
+)
+
+// Policies mirror External DNS' --policy flag and control whether Azure resources may be deleted
+const (
+	// PolicySync creates, updates and deletes profiles and endpoints
+	PolicySync = "sync"
+
+	// PolicyUpsertOnly creates and updates but never deletes profiles or endpoints
+	PolicyUpsertOnly = "upsert-only"
+)
+
+// Profile discovery modes control where Records looks for managed profiles
+const (
+	// ProfileDiscoveryResourceGroups lists the profiles of the configured resource groups
+	ProfileDiscoveryResourceGroups = "resource-groups"
+
+	// ProfileDiscoverySubscription lists the profiles of every resource group in the default
+	// subscription and the subscriptions the configured resource groups name
+	ProfileDiscoverySubscription = "subscription"
+)
+
+// Weight change actions control what happens when a weight change exceeds the configured maximum
+const (
+	// WeightChangeActionClamp limits the change to the maximum and applies it
+	WeightChangeActionClamp = "clamp"
+
+	// WeightChangeActionReject fails the update
+	WeightChangeActionReject = "reject"
+)
+
+// Config holds the settings used to construct a TrafficManagerProvider
+type Config struct {
+	SubscriptionID string
+	Cloud          string // Azure cloud name (e.g. AzureUSGovernmentCloud); empty means public cloud
+	AuthMode       string // Azure authentication mode (see trafficmanager.AuthModes); empty means default chaining
+	TenantID       string
+	ClientID       string // Selects the app registration or user-assigned identity
+	ClientSecret   string // Only used by client-secret auth mode
+
+	// User agent, retries, Traffic Manager API version and proxy of the Azure clients; the cloud
+	// comes from Cloud
+	ClientOptions trafficmanager.ClientOptions
+
+	// Credential used instead of one built from AuthMode, such as a static token in tests
+	Credential azcore.TokenCredential
+
+	// "<scope>=<tenant-id>[:<client-id>]" entries authenticating to a resource group, <subscription-id>/<resource-group>,
+	// or a whole subscription, <subscription-id>/*, as another tenant or identity, e.g. for profiles
+	// delegated with Azure Lighthouse. They use AuthMode and the secrets below.
+	ScopedCredentials []string
+
+	// Credential files mounted from a Kubernetes Secret, reloaded when they change
+	ClientSecretFile          string
+	ClientCertificateFile     string
+	ClientCertificatePassword string
+
+	ResourceGroups   []string // Resource groups to sync existing profiles from
+	ProfileDiscovery string   // resource-groups (default) or subscription
+	DomainFilter     []string
+	ClusterName      string // Recorded in endpoint metadata to identify the source cluster
+
+	// Subdomains of DomainFilter to leave alone, e.g. internal.example.com under example.com
+	DomainFilterExclude []string
+
+	// Tags marking the profiles this deployment manages; empty fields use the defaults.
+	// Deployments with different values can share a subscription without claiming each other's profiles.
+	Ownership trafficmanager.Ownership
+	Policy    string // sync (default) or upsert-only
+
+	// Vanity record publishing
+	VanityRecordMode      string   // dnsendpoint (default) or azure-dns
+	AzureDNSResourceGroup string   // Resource group of the Azure DNS zones (azure-dns mode)
+	AzureDNSZones         []string // Zones vanity hostnames may be written to (azure-dns mode)
+
+	// Create AzureEndpoints for A records whose addresses are public IP resources in the subscription
+	ResolvePublicIPs bool
+
+	// Return the source record of each endpoint from Records() as well as the vanity CNAMEs
+	EndpointRecords bool
+
+	// Weight change guardrails
+	MaxWeightChangePercent int    // Maximum change of an endpoint weight per apply, relative to its current weight (0 disables)
+	WeightChangeAction     string // clamp (default) or reject
+
+	// Change freeze windows, e.g. "Fri 18:00-Mon 06:00" (see ParseFreezeWindows)
+	FreezeWindows  string
+	FreezeTimezone string // IANA time zone the windows are defined in; empty means UTC
+
+	// Hostname mapping strategies tried in order for each profile (see HostnameMappings); empty means tag only
+	HostnameMapping []string
+
+	// Subscriptions and resource groups annotations may reference (see newResourcePolicy); empty allows any
+	AllowedSubscriptions    []string
+	AllowedResourceGroups   []string
+	NamespaceResourceGroups []string // "<namespace>=<resource-group>" entries further restricting a namespace
+
+	// Profiles and endpoints each namespace may create (0 is unlimited)
+	MaxProfilesPerNamespace  int
+	MaxEndpointsPerNamespace int
+	NamespaceProfileQuotas   []string // "<namespace>=<limit>" overrides of MaxProfilesPerNamespace
+	NamespaceEndpointQuotas  []string // "<namespace>=<limit>" overrides of MaxEndpointsPerNamespace
+
+	// Defaults for settings an endpoint's annotations leave out; can be changed later with UpdateSettings
+	Defaults annotations.Defaults
+
+	// Name of the ConfigMap holding per-namespace defaults in each source namespace; empty disables them
+	NamespaceDefaultsConfigMap string
+
+	// Use the cluster's Azure region, from node labels or IMDS, for endpoints no annotation or default gives a location
+	DetectEndpointLocation bool
+
+	// How long intentional deletes and disables are silenced for alerting; 0 disables silences
+	SilenceDuration time.Duration
+
+	// How endpoints are taken out of rotation before deletion (see EndpointDrain*); empty deletes at once
+	EndpointDrain string
+	// Take over existing profiles not created by the webhook without the adopt annotation
+	AdoptProfiles bool
+
+	// Go templates for profile and endpoint names not set by annotation (see nameData); empty means the defaults
+	ProfileNameTemplate  string
+	EndpointNameTemplate string
+
+	// What happens when a generated profile name is taken under trafficmanager.net: fail (default), hash or sequence
+	ProfileNameCollision string
+
+	// What happens to what a create wrote when one of its endpoints fails: retry (default), rollback or resume
+	CreateFailureMode string
+
+	// How long an empty profile is kept disabled before it is deleted; 0 deletes it at once
+	ProfileDeleteGracePeriod time.Duration
+
+	// Disable endpoints whose backing Service has no ready endpoints; needs a Kubernetes client
+	ServiceReadiness bool
+
+	// ConfigMap ("<namespace>/<name>" or "<name>" in default) storing External DNS TXT ownership records,
+	// for running the webhook as the only provider with --registry=txt; empty skips TXT records
+	TXTRegistryConfigMap string
+
+	// ConfigMap ("<namespace>/<name>" or "<name>" in default) storing each endpoint's resolved configuration,
+	// so deletes without annotations still find their profile after a restart; empty keeps them in memory
+	EndpointConfigConfigMap string
+
+	// Profile DNS TTLs to wait between draining an endpoint and deleting it; values below 1 use 2
+	EndpointDrainTTLMultiple int
+
+	// Profiles kept in the state cache before the least recently used are evicted; 0 is unbounded
+	StateCacheMaxProfiles int
+
+	// How long cached profiles are used (0 uses 5 minutes), and how long past that an expired
+	// profile is still used while it is read again in the background (0 disables)
+	StateCacheTTL      time.Duration
+	StateCacheStaleTTL time.Duration
+
+	// The webhook's own Pod, which events about the webhook rather than a record are recorded on;
+	// empty skips those events
+	PodName      string
+	PodNamespace string
+}
@@ -0,0 +1,131 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// configMapStoreNamespace is used when a store's ConfigMap is given without a namespace
+	configMapStoreNamespace = "default"
+
+	// configMapStoreWriteAttempts bounds retries of a write that lost a conflict to another writer
+	configMapStoreWriteAttempts = 3
+)
+
+// configMapStore keeps a document in one key of a ConfigMap, for state that has to outlive the
+// webhook. The ConfigMap is created on the first write.
+type configMapStore struct {
+	client    dynamic.Interface
+	namespace string
+	name      string
+	key       string
+
+	// Serializes read-modify-write cycles from this replica; other writers are caught by resourceVersion
+	mu sync.Mutex
+}
+
+// newConfigMapStore returns a store for key in the ConfigMap ref, written "<namespace>/<name>" or "<name>"
+func newConfigMapStore(client dynamic.Interface, ref, key string) (*configMapStore, error) {
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		namespace, name = configMapStoreNamespace, ref
+	}
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid ConfigMap %q, must be <namespace>/<name> or <name>", ref)
+	}
+	return &configMapStore{client: client, namespace: namespace, name: name, key: key}, nil
+}
+
+// String returns the ConfigMap as <namespace>/<name>
+func (s *configMapStore) String() string {
+	return s.namespace + "/" + s.name
+}
+
+// load returns the stored document, or "" while the ConfigMap or key doesn't exist
+func (s *configMapStore) load(ctx context.Context) (string, error) {
+	data, _, err := s.read(ctx)
+	return data, err
+}
+
+// update replaces the stored document with the result of mutate, retrying with a fresh copy
+// when another writer changed the ConfigMap in between
+func (s *configMapStore) update(ctx context.Context, mutate func(data string) (string, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < configMapStoreWriteAttempts; attempt++ {
+		if err = s.write(ctx, mutate); !apierrors.IsConflict(err) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write ConfigMap %s: %w", s, err)
+	}
+	return nil
+}
+
+// write performs one read-modify-write of the ConfigMap
+func (s *configMapStore) write(ctx context.Context, mutate func(data string) (string, error)) error {
+	current, obj, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	data, err := mutate(current)
+	if err != nil {
+		return err
+	}
+
+	if obj == nil {
+		obj = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata": map[string]interface{}{
+				"name":      s.name,
+				"namespace": s.namespace,
+			},
+		}}
+		if err := unstructured.SetNestedField(obj.Object, data, "data", s.key); err != nil {
+			return err
+		}
+		_, err = s.client.Resource(configMapGVR).Namespace(s.namespace).Create(ctx, obj, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// Another replica created it first; retry against its copy
+			return apierrors.NewConflict(configMapGVR.GroupResource(), s.name, err)
+		}
+		return err
+	}
+
+	if err := unstructured.SetNestedField(obj.Object, data, "data", s.key); err != nil {
+		return err
+	}
+	_, err = s.client.Resource(configMapGVR).Namespace(s.namespace).Update(ctx, obj, metav1.UpdateOptions{})
+	return err
+}
+
+// read returns the stored document and the ConfigMap it was read from, which is nil while the
+// ConfigMap doesn't exist yet
+func (s *configMapStore) read(ctx context.Context) (string, *unstructured.Unstructured, error) {
+	obj, err := s.client.Resource(configMapGVR).Namespace(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get ConfigMap %s: %w", s, err)
+	}
+
+	data, _, err := unstructured.NestedString(obj.Object, "data", s.key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read ConfigMap %s: %w", s, err)
+	}
+	return data, obj, nil
+}
@@ -0,0 +1,75 @@
+package provider
+
+import (
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+// toProfileConfig converts parsed annotations to a trafficmanager.ProfileConfig for the profile of
+// hostname, tagged as owned by owner
+func toProfileConfig(c *annotations.TrafficManagerConfig, owner trafficmanager.Ownership, hostname string) *trafficmanager.ProfileConfig {
+	config := trafficmanager.DefaultProfileConfig()
+
+	if c.ProfileName != "" {
+		config.ProfileName = c.ProfileName
+	}
+	config.ResourceGroup = c.ResourceGroup
+	config.RoutingMethod = c.RoutingMethod
+	config.DNSTTL = c.DNSTTL
+	config.MonitorProtocol = c.MonitorProtocol
+	config.MonitorPort = c.MonitorPort
+	config.MonitorPath = c.MonitorPath
+	config.HealthChecksEnabled = c.HealthChecksEnabled
+	config.TrafficViewEnabled = c.TrafficViewEnabled
+	if c.ProfileStatus != "" {
+		config.ProfileStatus = c.ProfileStatus
+	}
+
+	// ARM rejects TCP probes with a path and HTTP(S) probes without one
+	if config.MonitorProtocol == annotations.MonitorProtocolTCP {
+		config.MonitorPath = ""
+	} else if config.MonitorPath == "" {
+		config.MonitorPath = annotations.DefaultMonitorPath
+	}
+	if config.MonitorPort == 0 {
+		config.MonitorPort = annotations.DefaultMonitorPortFor(config.MonitorProtocol)
+	}
+
+	// Custom tags first, so the tags the webhook relies on always win
+	if config.Tags == nil {
+		config.Tags = make(map[string]string)
+	}
+	for k, v := range c.Tags {
+		config.Tags[k] = v
+	}
+
+	// Add the tags marking the profile as ours and mapping it back to its vanity hostname
+	config.Tags[owner.ManagedByTag] = owner.ManagedByValue
+	if hostname != "" {
+		config.Tags[owner.HostnameTag] = hostname
+	}
+	if c.DeletionProtection {
+		config.Tags[deletionProtectionTag] = "true"
+	}
+
+	return config
+}
+
+// toEndpointConfig converts parsed annotations to a trafficmanager.EndpointConfig for one target
+func toEndpointConfig(c *annotations.TrafficManagerConfig, target string) *trafficmanager.EndpointConfig {
+	config := trafficmanager.DefaultEndpointConfig()
+
+	if c.EndpointName != "" {
+		config.EndpointName = c.EndpointName
+	}
+	config.EndpointType = c.EndpointType
+	config.Target = target
+	config.Weight = c.Weight
+	config.Priority = c.Priority
+	config.Status = c.EndpointStatus
+	config.Location = c.EndpointLocation
+	config.AlwaysServe = !c.HealthChecksEnabled
+	config.CustomHeaders = c.EndpointCustomHeaders
+
+	return config
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToProfileConfig(t *testing.T) {
+	config := &annotations.TrafficManagerConfig{
+		Enabled:         true,
+		ProfileName:     "my-profile",
+		ResourceGroup:   "my-rg",
+		RoutingMethod:   "Weighted",
+		DNSTTL:          45,
+		MonitorProtocol: "HTTPS",
+		MonitorPort:     443,
+		MonitorPath:     "/healthz",
+	}
+
+	profileConfig := toProfileConfig(config, trafficmanager.DefaultOwnership(), "")
+
+	assert.Equal(t, "my-profile", profileConfig.ProfileName)
+	assert.Equal(t, "my-rg", profileConfig.ResourceGroup)
+	assert.Equal(t, "Weighted", profileConfig.RoutingMethod)
+	assert.Equal(t, int64(45), profileConfig.DNSTTL)
+	assert.Equal(t, "HTTPS", profileConfig.MonitorProtocol)
+	assert.Equal(t, int64(443), profileConfig.MonitorPort)
+	assert.Equal(t, "/healthz", profileConfig.MonitorPath)
+	assert.Equal(t, "global", profileConfig.Location)
+	assert.Contains(t, profileConfig.Tags, "managedBy")
+	assert.Equal(t, "external-dns-traffic-manager-webhook", profileConfig.Tags["managedBy"])
+}
+
+func TestToProfileConfig_MonitorProtocol(t *testing.T) {
+	tcp := toProfileConfig(&annotations.TrafficManagerConfig{MonitorProtocol: "TCP", MonitorPort: 5432, MonitorPath: "/"}, trafficmanager.DefaultOwnership(), "")
+	assert.Empty(t, tcp.MonitorPath)
+	assert.Equal(t, int64(5432), tcp.MonitorPort)
+
+	http := toProfileConfig(&annotations.TrafficManagerConfig{MonitorProtocol: "HTTP"}, trafficmanager.DefaultOwnership(), "")
+	assert.Equal(t, "/", http.MonitorPath)
+	assert.Equal(t, int64(80), http.MonitorPort)
+}
+
+func TestToProfileConfig_ProfileStatus(t *testing.T) {
+	enabled := toProfileConfig(&annotations.TrafficManagerConfig{HealthChecksEnabled: false}, trafficmanager.DefaultOwnership(), "")
+	assert.Equal(t, "Enabled", enabled.ProfileStatus, "turning off health checks leaves the profile enabled")
+
+	disabled := toProfileConfig(&annotations.TrafficManagerConfig{HealthChecksEnabled: true, ProfileStatus: "Disabled"}, trafficmanager.DefaultOwnership(), "")
+	assert.Equal(t, "Disabled", disabled.ProfileStatus)
+}
+
+func TestToProfileConfig_DeletionProtection(t *testing.T) {
+	config := &annotations.TrafficManagerConfig{ProfileName: "my-profile", ResourceGroup: "my-rg"}
+	assert.NotContains(t, toProfileConfig(config, trafficmanager.DefaultOwnership(), "").Tags, deletionProtectionTag)
+
+	config.DeletionProtection = true
+	assert.Equal(t, "true", toProfileConfig(config, trafficmanager.DefaultOwnership(), "").Tags[deletionProtectionTag])
+}
+
+func TestToProfileConfig_Tags(t *testing.T) {
+	config := &annotations.TrafficManagerConfig{
+		ProfileName:   "my-profile",
+		ResourceGroup: "my-rg",
+		Tags:          map[string]string{"team": "payments", "managedBy": "someone-else"},
+	}
+
+	tags := toProfileConfig(config, trafficmanager.DefaultOwnership(), "").Tags
+	assert.Equal(t, "payments", tags["team"])
+	assert.Equal(t, trafficmanager.DefaultManagedByValue, tags["managedBy"], "the webhook's own tags win")
+}
+
+func TestToProfileConfig_Ownership(t *testing.T) {
+	config := &annotations.TrafficManagerConfig{ProfileName: "my-profile", ResourceGroup: "my-rg"}
+	owner := trafficmanager.Ownership{ManagedByTag: "owner", ManagedByValue: "webhook-staging", HostnameTag: "vanity"}.WithDefaults()
+
+	tags := toProfileConfig(config, owner, "app.example.com").Tags
+	assert.Equal(t, map[string]string{"owner": "webhook-staging", "vanity": "app.example.com"}, tags)
+}
+
+func TestHasTags(t *testing.T) {
+	tags := map[string]string{"managedBy": trafficmanager.DefaultManagedByValue, "team": "payments"}
+
+	assert.True(t, hasTags(tags, nil))
+	assert.True(t, hasTags(tags, map[string]string{"team": "payments"}))
+	assert.False(t, hasTags(tags, map[string]string{"team": "identity"}))
+	assert.False(t, hasTags(tags, map[string]string{"env": "prod"}))
+}
+
+func TestDeletionProtected(t *testing.T) {
+	unprotected := &state.ProfileState{Tags: map[string]string{"managedBy": trafficmanager.DefaultManagedByValue}}
+	tagged := &state.ProfileState{Tags: map[string]string{deletionProtectionTag: "true"}}
+
+	assert.False(t, deletionProtected(&annotations.TrafficManagerConfig{}, unprotected))
+	assert.True(t, deletionProtected(&annotations.TrafficManagerConfig{DeletionProtection: true}, unprotected))
+	assert.True(t, deletionProtected(&annotations.TrafficManagerConfig{}, tagged), "the profile tag protects it even without the annotation")
+}
+
+func TestToEndpointConfig(t *testing.T) {
+	config := &annotations.TrafficManagerConfig{
+		EndpointName:     "test-endpoint",
+		EndpointLocation: "West US",
+		EndpointType:     annotations.DefaultEndpointType,
+		Weight:           200,
+		Priority:         3,
+		EndpointStatus:   "Enabled",
+	}
+
+	target := "20.30.40.50"
+	endpointConfig := toEndpointConfig(config, target)
+
+	assert.Equal(t, "test-endpoint", endpointConfig.EndpointName)
+	assert.Equal(t, target, endpointConfig.Target)
+	assert.Equal(t, int64(200), endpointConfig.Weight)
+	assert.Equal(t, int64(3), endpointConfig.Priority)
+	assert.Equal(t, "Enabled", endpointConfig.Status)
+	assert.Equal(t, "West US", endpointConfig.Location)
+	assert.Equal(t, annotations.DefaultEndpointType, endpointConfig.EndpointType)
+	assert.True(t, endpointConfig.AlwaysServe, "endpoints without health checks always serve")
+
+	config.HealthChecksEnabled = true
+	assert.False(t, toEndpointConfig(config, target).AlwaysServe)
+}
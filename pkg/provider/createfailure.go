@@ -0,0 +1,159 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// Create failure modes control what happens to the profile and endpoints a create wrote before
+// one of its endpoints failed
+const (
+	// CreateFailureRetry leaves them in place for External DNS to retry the whole create
+	CreateFailureRetry = "retry"
+
+	// CreateFailureRollback deletes the endpoints the create added, and the profile if it added that too
+	CreateFailureRollback = "rollback"
+
+	// CreateFailureResume caches them, so the retry skips what was written and carries on from the failure
+	CreateFailureResume = "resume"
+)
+
+// createCleanupTimeout bounds rolling back or checkpointing a failed create, which runs apart from
+// the request's own deadline
+const createCleanupTimeout = time.Minute
+
+// createRunClient is the part of trafficmanager.Client a createRun uses
+type createRunClient interface {
+	GetProfileState(ctx context.Context, resourceGroup, profileName string) (*state.ProfileState, error)
+	DeleteEndpoint(ctx context.Context, resourceGroup, profileName, endpointType, endpointName string) error
+	DeleteProfile(ctx context.Context, resourceGroup, profileName string) error
+}
+
+// createRun records the resources one create writes, so they can be rolled back or checkpointed
+// when it fails part way
+type createRun struct {
+	mode          string
+	client        createRunClient
+	hostname      string
+	resourceGroup string
+	profileName   string
+
+	// What existed before the create; only known when rolling back
+	profileExisted bool
+	existing       map[string]bool
+
+	profileWritten bool
+	written        []*trafficmanager.EndpointConfig
+}
+
+// newCreateRun starts recording a create into the profile of hostname. Rolling back needs to know
+// what existed beforehand, which is read from Azure when the profile isn't cached.
+func (p *TrafficManagerProvider) newCreateRun(ctx context.Context, client createRunClient, hostname, resourceGroup, profileName string, cached *state.ProfileState) (*createRun, error) {
+	run := &createRun{
+		mode:          p.createFailureMode,
+		client:        client,
+		hostname:      hostname,
+		resourceGroup: resourceGroup,
+		profileName:   profileName,
+		existing:      make(map[string]bool),
+	}
+	if run.mode == CreateFailureRollback && !p.mayDelete() {
+		// Rolling back deletes what the create wrote, which the upsert-only policy doesn't allow
+		run.mode = CreateFailureResume
+	}
+	if run.mode != CreateFailureRollback {
+		return run, nil
+	}
+
+	profile := cached
+	if profile == nil {
+		var err error
+		profile, err = client.GetProfileState(ctx, resourceGroup, profileName)
+		if err != nil && !trafficmanager.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to read profile %s before creating endpoints: %w", profileName, err)
+		}
+	}
+	if profile != nil {
+		run.profileExisted = true
+		for name := range profile.Endpoints {
+			run.existing[name] = true
+		}
+	}
+	return run, nil
+}
+
+// wrote records an endpoint the create wrote
+func (r *createRun) wrote(config *trafficmanager.EndpointConfig) {
+	r.written = append(r.written, config)
+}
+
+// fail handles err, the failure of the create, according to the create failure mode and returns it
+func (r *createRun) fail(ctx context.Context, p *TrafficManagerProvider, err error) error {
+	// The create may have failed because the request timed out or was cancelled, which mustn't stop the clean up
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), createCleanupTimeout)
+	defer cancel()
+
+	switch r.mode {
+	case CreateFailureRollback:
+		if rollbackErr := r.rollback(cleanupCtx); rollbackErr != nil {
+			p.log(ctx).Error("Failed to roll back partial create",
+				zap.String("profileName", r.profileName),
+				zap.Error(rollbackErr))
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		p.log(ctx).Info("Rolled back partial create",
+			zap.String("profileName", r.profileName),
+			zap.Int("endpoints", len(r.written)),
+			zap.Bool("profileDeleted", r.profileWritten && !r.profileExisted))
+	case CreateFailureResume:
+		r.checkpoint(cleanupCtx, p)
+	}
+	return err
+}
+
+// rollback deletes the endpoints the create added, newest first, then the profile if the create
+// added it. Endpoints that existed before are left as written, since their old settings are gone.
+func (r *createRun) rollback(ctx context.Context) error {
+	var errs []error
+	for i := len(r.written) - 1; i >= 0; i-- {
+		config := r.written[i]
+		if r.existing[config.EndpointName] {
+			continue
+		}
+		if err := r.client.DeleteEndpoint(ctx, r.resourceGroup, r.profileName, config.EndpointType, config.EndpointName); err != nil && !trafficmanager.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("endpoint %s: %w", config.EndpointName, err))
+		}
+	}
+	if r.profileWritten && !r.profileExisted && len(errs) == 0 {
+		if err := r.client.DeleteProfile(ctx, r.resourceGroup, r.profileName); err != nil && !trafficmanager.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("profile %s: %w", r.profileName, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkpoint caches the profile as Azure now has it, so the retry finds the endpoints already
+// written up to date and only writes the rest
+func (r *createRun) checkpoint(ctx context.Context, p *TrafficManagerProvider) {
+	if !r.profileWritten && len(r.written) == 0 {
+		return
+	}
+	profile, err := r.client.GetProfileState(ctx, r.resourceGroup, r.profileName)
+	if err != nil {
+		p.log(ctx).Warn("Failed to checkpoint partial create, the retry starts over",
+			zap.String("profileName", r.profileName),
+			zap.Error(err))
+		return
+	}
+	profile.Hostname = r.hostname
+	p.stateManager.SetProfile(r.hostname, profile)
+	p.log(ctx).Info("Checkpointed partial create for the retry to resume",
+		zap.String("profileName", r.profileName),
+		zap.Int("endpoints", len(r.written)))
+}
@@ -0,0 +1,198 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeCreateRunClient keeps one profile in memory; a nil profile doesn't exist
+type fakeCreateRunClient struct {
+	profile        *state.ProfileState
+	deleted        []string
+	profileDeleted bool
+	failDelete     string
+}
+
+func (f *fakeCreateRunClient) GetProfileState(ctx context.Context, _, _ string) (*state.ProfileState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if f.profile == nil {
+		return nil, trafficmanager.ErrProfileNotFound
+	}
+	return f.profile.Clone(), nil
+}
+
+func (f *fakeCreateRunClient) DeleteEndpoint(ctx context.Context, _, _, _, endpointName string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if endpointName == f.failDelete {
+		return errors.New("delete failed")
+	}
+	f.deleted = append(f.deleted, endpointName)
+	delete(f.profile.Endpoints, endpointName)
+	return nil
+}
+
+func (f *fakeCreateRunClient) DeleteProfile(ctx context.Context, _, _ string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.profileDeleted = true
+	f.profile = nil
+	return nil
+}
+
+func newCreateFailureTestProvider(t *testing.T, mode string) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	return &TrafficManagerProvider{
+		logger:            logger,
+		stateManager:      state.NewManager(5*time.Minute, logger),
+		createFailureMode: mode,
+	}
+}
+
+// writeEndpoints records endpoints as written by run, adding them to the fake profile
+func writeEndpoints(client *fakeCreateRunClient, run *createRun, names ...string) {
+	if client.profile == nil {
+		client.profile = &state.ProfileState{ProfileName: "app-tm", ResourceGroup: "tm-rg", Endpoints: make(map[string]*state.EndpointState)}
+		run.profileWritten = true
+	}
+	for _, name := range names {
+		client.profile.Endpoints[name] = &state.EndpointState{EndpointName: name}
+		run.wrote(&trafficmanager.EndpointConfig{EndpointName: name, EndpointType: "ExternalEndpoints"})
+	}
+}
+
+func TestCreateRun_Rollback(t *testing.T) {
+	ctx := context.Background()
+	createErr := errors.New("failed to create endpoint c")
+
+	t.Run("a new profile is deleted with its endpoints", func(t *testing.T) {
+		p := newCreateFailureTestProvider(t, CreateFailureRollback)
+		client := &fakeCreateRunClient{}
+		run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+		require.NoError(t, err)
+		writeEndpoints(client, run, "a", "b")
+
+		err = run.fail(ctx, p, createErr)
+		assert.Equal(t, createErr, err)
+		assert.Equal(t, []string{"b", "a"}, client.deleted, "newest first")
+		assert.True(t, client.profileDeleted)
+	})
+
+	t.Run("endpoints that existed before are kept", func(t *testing.T) {
+		p := newCreateFailureTestProvider(t, CreateFailureRollback)
+		client := &fakeCreateRunClient{profile: &state.ProfileState{ProfileName: "app-tm", Endpoints: map[string]*state.EndpointState{
+			"a": {EndpointName: "a"},
+		}}}
+		run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+		require.NoError(t, err)
+		run.profileWritten = true
+		writeEndpoints(client, run, "a", "b")
+
+		require.Error(t, run.fail(ctx, p, createErr))
+		assert.Equal(t, []string{"b"}, client.deleted)
+		assert.False(t, client.profileDeleted, "the profile existed before")
+		assert.Contains(t, client.profile.Endpoints, "a")
+	})
+
+	t.Run("a failed rollback returns both errors and keeps the profile", func(t *testing.T) {
+		p := newCreateFailureTestProvider(t, CreateFailureRollback)
+		client := &fakeCreateRunClient{failDelete: "a"}
+		run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+		require.NoError(t, err)
+		writeEndpoints(client, run, "a", "b")
+
+		err = run.fail(ctx, p, createErr)
+		require.ErrorIs(t, err, createErr)
+		assert.Contains(t, err.Error(), "rollback failed")
+		assert.False(t, client.profileDeleted)
+	})
+}
+
+func TestCreateRun_UpsertOnly(t *testing.T) {
+	ctx := context.Background()
+	p := newCreateFailureTestProvider(t, CreateFailureRollback)
+	p.policy = PolicyUpsertOnly
+	client := &fakeCreateRunClient{}
+	run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+	require.NoError(t, err)
+	writeEndpoints(client, run, "a", "b")
+
+	// Nothing is deleted; what was written is checkpointed instead
+	require.Error(t, run.fail(ctx, p, errors.New("failed to create endpoint c")))
+	assert.Empty(t, client.deleted)
+	assert.False(t, client.profileDeleted)
+	assert.NotNil(t, p.cachedProfileFor("app.example.com", "tm-rg", "app-tm"))
+}
+
+func TestCreateRun_CancelledRequest(t *testing.T) {
+	// The create failed because the request's deadline passed, which leaves its context done
+	t.Run("rollback", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := newCreateFailureTestProvider(t, CreateFailureRollback)
+		client := &fakeCreateRunClient{}
+		run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+		require.NoError(t, err)
+		writeEndpoints(client, run, "a", "b")
+		cancel()
+
+		err = run.fail(ctx, p, context.DeadlineExceeded)
+		assert.Equal(t, context.DeadlineExceeded, err, "the rollback succeeded")
+		assert.Equal(t, []string{"b", "a"}, client.deleted)
+		assert.True(t, client.profileDeleted)
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := newCreateFailureTestProvider(t, CreateFailureResume)
+		client := &fakeCreateRunClient{}
+		run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+		require.NoError(t, err)
+		writeEndpoints(client, run, "a")
+		cancel()
+
+		require.Error(t, run.fail(ctx, p, context.DeadlineExceeded))
+		assert.NotNil(t, p.cachedProfileFor("app.example.com", "tm-rg", "app-tm"), "the checkpoint was taken")
+	})
+}
+
+func TestCreateRun_Resume(t *testing.T) {
+	ctx := context.Background()
+	p := newCreateFailureTestProvider(t, CreateFailureResume)
+	client := &fakeCreateRunClient{}
+	run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+	require.NoError(t, err)
+	writeEndpoints(client, run, "a", "b")
+
+	require.Error(t, run.fail(ctx, p, errors.New("failed to create endpoint c")))
+	assert.Empty(t, client.deleted)
+
+	cached := p.cachedProfileFor("app.example.com", "tm-rg", "app-tm")
+	require.NotNil(t, cached, "the written profile is cached for the retry")
+	assert.Len(t, cached.Endpoints, 2)
+	assert.Equal(t, "app.example.com", cached.Hostname)
+}
+
+func TestCreateRun_Retry(t *testing.T) {
+	ctx := context.Background()
+	p := newCreateFailureTestProvider(t, CreateFailureRetry)
+	client := &fakeCreateRunClient{}
+	run, err := p.newCreateRun(ctx, client, "app.example.com", "tm-rg", "app-tm", nil)
+	require.NoError(t, err)
+	writeEndpoints(client, run, "a")
+
+	require.Error(t, run.fail(ctx, p, errors.New("failed to create endpoint b")))
+	assert.Empty(t, client.deleted)
+	assert.Nil(t, p.cachedProfileFor("app.example.com", "tm-rg", "app-tm"))
+}
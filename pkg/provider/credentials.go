@@ -0,0 +1,97 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// scopedCredentialConfig is the tenant and identity used for the profiles of one resource group
+// or subscription, such as one delegated from a customer tenant with Azure Lighthouse
+type scopedCredentialConfig struct {
+	scope    string // Lower-cased <subscription-id>/<resource-group>, or <subscription-id>/* for the whole subscription
+	tenantID string
+	clientID string // Empty uses the default credential's client ID
+}
+
+// parseScopedCredentials parses "<scope>=<tenant-id>[:<client-id>]" entries. A scope is a resource
+// group in the default subscription, <subscription-id>/<resource-group>, or <subscription-id>/*.
+func parseScopedCredentials(entries []string, defaultSubscription string) ([]scopedCredentialConfig, error) {
+	var configs []scopedCredentialConfig
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		scope, identity, ok := strings.Cut(entry, "=")
+		scope, identity = strings.TrimSpace(scope), strings.TrimSpace(identity)
+		tenantID, clientID, _ := strings.Cut(identity, ":")
+		if !ok || scope == "" || tenantID == "" {
+			return nil, fmt.Errorf("invalid scoped credential %q: expected <scope>=<tenant-id>[:<client-id>]", entry)
+		}
+
+		subscriptionID, resourceGroup := defaultSubscription, scope
+		if i := strings.Index(scope, "/"); i >= 0 {
+			subscriptionID, resourceGroup = scope[:i], scope[i+1:]
+		}
+		if subscriptionID == "" || resourceGroup == "" || (resourceGroup == "*" && !strings.Contains(scope, "/")) {
+			return nil, fmt.Errorf("invalid scoped credential %q: scope must be <resource-group>, <subscription-id>/<resource-group> or <subscription-id>/*", entry)
+		}
+
+		key := strings.ToLower(subscriptionID + "/" + resourceGroup)
+		if seen[key] {
+			return nil, fmt.Errorf("scoped credential for %s given more than once", scope)
+		}
+		seen[key] = true
+		configs = append(configs, scopedCredentialConfig{scope: key, tenantID: tenantID, clientID: clientID})
+	}
+	return configs, nil
+}
+
+// credentialScope returns the scope of the credential for a resource group: the resource group's
+// own, else its subscription's, else "" for the default credential. An empty resource group
+// only matches a subscription's credential.
+func (p *TrafficManagerProvider) credentialScope(subscriptionID, resourceGroup string) string {
+	if len(p.scopedCredentials) == 0 {
+		return ""
+	}
+	if resourceGroup != "" {
+		scope := strings.ToLower(subscriptionID + "/" + resourceGroup)
+		if _, ok := p.scopedCredentials[scope]; ok {
+			return scope
+		}
+	}
+	scope := strings.ToLower(subscriptionID + "/*")
+	if _, ok := p.scopedCredentials[scope]; ok {
+		return scope
+	}
+	return ""
+}
+
+// WatchCredentialFiles rebuilds the Azure credentials when their mounted secret files change,
+// until ctx is cancelled. It returns immediately if no credential is file based.
+func (p *TrafficManagerProvider) WatchCredentialFiles(ctx context.Context, interval time.Duration) {
+	credentials := []azcore.TokenCredential{p.credential}
+	for _, scope := range sortedKeys(p.scopedCredentials) {
+		credentials = append(credentials, p.scopedCredentials[scope])
+	}
+
+	var fileCreds []*trafficmanager.FileCredential
+	for _, credential := range credentials {
+		if fileCred, ok := credential.(*trafficmanager.FileCredential); ok {
+			fileCreds = append(fileCreds, fileCred)
+		}
+	}
+	if len(fileCreds) == 0 {
+		return
+	}
+
+	p.logger.Info("Watching Azure credential files for rotation",
+		zap.Duration("interval", interval))
+	for _, fileCred := range fileCreds[1:] {
+		go fileCred.Watch(ctx, interval, p.logger)
+	}
+	fileCreds[0].Watch(ctx, interval, p.logger)
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"go.uber.org/zap"
+)
+
+// SyncResult describes the outcome of a Records call
+type SyncResult struct {
+	Time      time.Time `json:"time"`
+	Duration  string    `json:"duration"`
+	Profiles  int       `json:"profiles"`
+	Endpoints int       `json:"endpoints"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// DebugProfile is a cached profile with its cache age
+type DebugProfile struct {
+	Hostname string              `json:"hostname"`
+	CacheAge string              `json:"cacheAge"`
+	Profile  *state.ProfileState `json:"profile"`
+}
+
+// DebugState is the troubleshooting snapshot served by /debug/state
+type DebugState struct {
+	Stats                    map[string]interface{} `json:"stats"`
+	Profiles                 []DebugProfile         `json:"profiles"`
+	LastSync                 *SyncResult            `json:"lastSync,omitempty"`
+	Freeze                   FreezeStatus           `json:"freeze"`
+	UnreconciledDNSEndpoints int                    `json:"unreconciledDNSEndpoints"`
+}
+
+// recordSync keeps the outcome of the last Records call
+func (p *TrafficManagerProvider) recordSync(start time.Time, profiles, endpoints int, err error) {
+	result := &SyncResult{
+		Time:      start,
+		Duration:  p.now().Sub(start).String(),
+		Profiles:  profiles,
+		Endpoints: endpoints,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	p.lastSyncMu.Lock()
+	p.lastSync = result
+	if err == nil {
+		p.lastSyncSuccess = start
+	}
+	p.lastSyncMu.Unlock()
+}
+
+// freshness reports how stale the synced and cached profiles are, for the freshness metrics
+func (p *TrafficManagerProvider) freshness() metrics.Freshness {
+	// The state manager stamps profiles with the wall clock, not p.now
+	ages, expired := p.stateManager.Ages(time.Now())
+
+	p.lastSyncMu.Lock()
+	since := p.lastSyncSuccess
+	p.lastSyncMu.Unlock()
+	if since.IsZero() {
+		since = p.startedAt
+	}
+
+	return metrics.Freshness{
+		SinceSync:      p.now().Sub(since),
+		ExpiredEntries: expired,
+		CacheAges:      ages,
+	}
+}
+
+// DebugState returns the state cache contents and the last sync result
+func (p *TrafficManagerProvider) DebugState() DebugState {
+	debug := DebugState{
+		Stats:    p.stateManager.GetStats(),
+		Profiles: p.CachedProfiles(),
+		Freeze:   p.FreezeStatus(),
+	}
+
+	p.lastSyncMu.Lock()
+	debug.LastSync = p.lastSync
+	p.lastSyncMu.Unlock()
+
+	if p.dnsEndpointManager != nil {
+		debug.UnreconciledDNSEndpoints = p.dnsEndpointManager.Unreconciled()
+	}
+
+	return debug
+}
+
+// HandleDebugState handles GET /debug/state - Dump the provider state for troubleshooting
+func (s *WebhookServer) HandleDebugState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s.provider.DebugState()); err != nil {
+		s.log(r).Error("Failed to encode debug state", zap.Error(err))
+	}
+}
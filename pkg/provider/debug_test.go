@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestHandleDebugState(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		stateManager: state.NewManager(5*time.Minute, logger),
+		clock:        func() time.Time { return now },
+	}
+	p.stateManager.SetProfile("b.example.com", &state.ProfileState{ProfileName: "b-example-com-tm", Hostname: "b.example.com"})
+	p.stateManager.SetProfile("a.example.com", &state.ProfileState{ProfileName: "a-example-com-tm", Hostname: "a.example.com"})
+	p.recordSync(now.Add(-2*time.Second), 2, 0, fmt.Errorf("throttled"))
+
+	rec := httptest.NewRecorder()
+	NewWebhookServer(p, logger).HandleDebugState(rec, httptest.NewRequest(http.MethodGet, "/debug/state", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var debug DebugState
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&debug))
+	require.Len(t, debug.Profiles, 2)
+	assert.Equal(t, "a.example.com", debug.Profiles[0].Hostname)
+	assert.Equal(t, "b-example-com-tm", debug.Profiles[1].Profile.ProfileName)
+	assert.Equal(t, float64(2), debug.Stats["totalProfiles"])
+	require.NotNil(t, debug.LastSync)
+	assert.Equal(t, "2s", debug.LastSync.Duration)
+	assert.Equal(t, 2, debug.LastSync.Profiles)
+	assert.Equal(t, "throttled", debug.LastSync.Error)
+}
+
+func TestFreshness(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		stateManager: state.NewManager(5*time.Minute, logger),
+		clock:        func() time.Time { return now },
+		startedAt:    now.Add(-time.Hour),
+	}
+	p.stateManager.SetProfile("app.example.com", &state.ProfileState{ProfileName: "app-tm", Hostname: "app.example.com"})
+
+	// Before the first successful sync, staleness counts from start
+	p.recordSync(now.Add(-30*time.Minute), 0, 0, fmt.Errorf("throttled"))
+	assert.Equal(t, time.Hour, p.freshness().SinceSync)
+
+	p.recordSync(now.Add(-2*time.Minute), 1, 1, nil)
+	p.recordSync(now.Add(-time.Minute), 0, 0, fmt.Errorf("throttled"))
+	freshness := p.freshness()
+	assert.Equal(t, 2*time.Minute, freshness.SinceSync, "a failed sync doesn't reset staleness")
+	assert.Equal(t, 0, freshness.ExpiredEntries)
+	assert.Contains(t, freshness.CacheAges, "app.example.com")
+}
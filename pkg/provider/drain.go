@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// drainState tracks whether the webhook is draining ahead of a shutdown
+type drainState struct {
+	draining atomic.Bool
+	once     sync.Once
+	delay    time.Duration
+	hooks    []func()
+}
+
+// SetDrain configures draining: hooks run when draining starts, for example to stop keeping
+// connections alive, and Drain then waits delay so External DNS finishes its poll and
+// reconnects to another instance before the servers shut down.
+func (s *WebhookServer) SetDrain(delay time.Duration, hooks ...func()) {
+	s.drain.delay = delay
+	s.drain.hooks = hooks
+}
+
+// Drain marks the webhook as draining so /readyz fails, runs the drain hooks and waits for the
+// drain delay. Requests are still served while draining. Only the first call waits; later calls
+// return once it has finished, so a preStop hook and SIGTERM don't drain twice.
+func (s *WebhookServer) Drain() {
+	s.drain.once.Do(func() {
+		s.drain.draining.Store(true)
+		s.logger.Info("Draining webhook", zap.Duration("delay", s.drain.delay))
+		for _, hook := range s.drain.hooks {
+			hook()
+		}
+		time.Sleep(s.drain.delay)
+	})
+}
+
+// Draining reports whether Drain has been called
+func (s *WebhookServer) Draining() bool {
+	return s.drain.draining.Load()
+}
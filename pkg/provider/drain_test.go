@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestDrain_RunsHooksOnce(t *testing.T) {
+	p, _, _, _ := newReadinessProvider(t)
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+	hooks := 0
+	s.SetDrain(0, func() { hooks++ })
+
+	assert.False(t, s.Draining())
+	s.Drain()
+	s.Drain()
+	assert.True(t, s.Draining())
+	assert.Equal(t, 1, hooks)
+}
+
+func TestHandleReady_FailsWhileDraining(t *testing.T) {
+	p, _, _, _ := newReadinessProvider(t)
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.HandleDrain(rec, httptest.NewRequest(http.MethodGet, "/drain", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var response HealthResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "draining", response.Status)
+
+	rec = httptest.NewRecorder()
+	s.HandleDrain(rec, httptest.NewRequest(http.MethodDelete, "/drain", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,269 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"go.uber.org/zap"
+)
+
+// endpointConfigKey is the ConfigMap data key holding stored endpoint configurations as JSON
+const endpointConfigKey = "endpoints"
+
+// storedEndpointConfig is what a delete needs to find an endpoint and its profile again, and the
+// source record the endpoint was created for
+type storedEndpointConfig struct {
+	SubscriptionID     string `json:"subscriptionId,omitempty"`
+	ResourceGroup      string `json:"resourceGroup"`
+	ProfileName        string `json:"profileName"`
+	EndpointName       string `json:"endpointName"`
+	EndpointType       string `json:"endpointType,omitempty"`
+	Hostname           string `json:"hostname,omitempty"`
+	RoutingMethod      string `json:"routingMethod,omitempty"`
+	VanityRecordType   string `json:"vanityRecordType,omitempty"`
+	DeletionProtection bool   `json:"deletionProtection,omitempty"`
+
+	// The weight percentage of an endpoint in percent weight mode, for checking its profile's total
+	WeightPercent float64 `json:"weightPercent,omitempty"`
+
+	// The source record, returned by Records() with ENDPOINT_RECORDS
+	DNSName       string   `json:"dnsName,omitempty"`
+	SetIdentifier string   `json:"setIdentifier,omitempty"`
+	RecordType    string   `json:"recordType,omitempty"`
+	Targets       []string `json:"targets,omitempty"`
+	RecordTTL     int64    `json:"recordTTL,omitempty"`
+}
+
+// endpointConfigs remembers the resolved configuration of each endpoint by endpointConfigID.
+// External DNS often sends deletes without the annotations the endpoint was created with, which
+// would otherwise leave its profile behind. Configurations are kept in memory, and in a ConfigMap
+// when one is set so they survive restarts.
+type endpointConfigs struct {
+	store  *configMapStore // nil keeps configurations in memory only
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	configs map[string]storedEndpointConfig
+	loaded  bool
+}
+
+func newEndpointConfigs(store *configMapStore, logger *zap.Logger) *endpointConfigs {
+	return &endpointConfigs{
+		store:   store,
+		logger:  logger,
+		configs: make(map[string]storedEndpointConfig),
+		loaded:  store == nil,
+	}
+}
+
+// toStoredEndpointConfig keeps the parts of a resolved configuration a delete needs, and the source record
+func toStoredEndpointConfig(endpoint *Endpoint, config *annotations.TrafficManagerConfig) storedEndpointConfig {
+	return storedEndpointConfig{
+		SubscriptionID:     config.SubscriptionID,
+		ResourceGroup:      config.ResourceGroup,
+		ProfileName:        config.ProfileName,
+		EndpointName:       config.EndpointName,
+		EndpointType:       config.EndpointType,
+		Hostname:           config.Hostname,
+		RoutingMethod:      config.RoutingMethod,
+		VanityRecordType:   config.VanityRecordType,
+		DeletionProtection: config.DeletionProtection,
+
+		WeightPercent: config.WeightPercent,
+
+		DNSName:       endpoint.DNSName,
+		SetIdentifier: endpoint.SetIdentifier,
+		RecordType:    endpoint.RecordType,
+		Targets:       endpoint.Targets,
+		RecordTTL:     endpoint.RecordTTL,
+	}
+}
+
+// apply sets the stored settings on config and enables it
+func (s storedEndpointConfig) apply(config *annotations.TrafficManagerConfig) {
+	config.Enabled = true
+	config.SubscriptionID = s.SubscriptionID
+	config.ResourceGroup = s.ResourceGroup
+	config.ProfileName = s.ProfileName
+	config.EndpointName = s.EndpointName
+	if s.EndpointType != "" {
+		config.EndpointType = s.EndpointType
+	}
+	config.Hostname = s.Hostname
+	if s.RoutingMethod != "" {
+		config.RoutingMethod = s.RoutingMethod
+	}
+	config.VanityRecordType = s.VanityRecordType
+	config.DeletionProtection = s.DeletionProtection
+}
+
+// endpointConfigID identifies the stored configuration of a record: its lowercase DNS name,
+// followed by its set identifier if it has one
+func endpointConfigID(endpoint *Endpoint) string {
+	id := strings.ToLower(endpoint.DNSName)
+	if endpoint.SetIdentifier != "" {
+		id += "/" + endpoint.SetIdentifier
+	}
+	return id
+}
+
+// get returns the stored configuration of an endpoint
+func (e *endpointConfigs) get(ctx context.Context, id string) (storedEndpointConfig, bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.load(ctx); err != nil {
+		return storedEndpointConfig{}, false, err
+	}
+	config, ok := e.configs[id]
+	return config, ok, nil
+}
+
+// set records the configuration of an endpoint. A failure to persist it is logged; the
+// configuration is still remembered until the webhook restarts.
+func (e *endpointConfigs) set(ctx context.Context, id string, config storedEndpointConfig) {
+	e.mu.Lock()
+	current, ok := e.configs[id]
+	e.configs[id] = config
+	e.mu.Unlock()
+
+	if ok && reflect.DeepEqual(current, config) {
+		return
+	}
+	e.persist(ctx, func(configs map[string]storedEndpointConfig) {
+		configs[id] = config
+	})
+}
+
+// delete forgets the configuration of an endpoint
+func (e *endpointConfigs) delete(ctx context.Context, id string) {
+	e.mu.Lock()
+	_, ok := e.configs[id]
+	delete(e.configs, id)
+	e.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	e.persist(ctx, func(configs map[string]storedEndpointConfig) {
+		delete(configs, id)
+	})
+}
+
+// all returns a copy of the stored configurations by endpointConfigID
+func (e *endpointConfigs) all(ctx context.Context) (map[string]storedEndpointConfig, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.load(ctx); err != nil {
+		return nil, err
+	}
+	return maps.Clone(e.configs), nil
+}
+
+// load reads the stored configurations the first time they are needed; e.mu must be held
+func (e *endpointConfigs) load(ctx context.Context) error {
+	if e.loaded {
+		return nil
+	}
+
+	data, err := e.store.load(ctx)
+	if err != nil {
+		return err
+	}
+	configs, err := decodeEndpointConfigs(data)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint configuration ConfigMap %s: %w", e.store, err)
+	}
+
+	// Configurations recorded since the webhook started are newer than the stored ones
+	for key, config := range configs {
+		if _, ok := e.configs[key]; !ok {
+			e.configs[key] = config
+		}
+	}
+	e.loaded = true
+	return nil
+}
+
+// persist applies mutate to the stored configurations
+func (e *endpointConfigs) persist(ctx context.Context, mutate func(map[string]storedEndpointConfig)) {
+	if e.store == nil {
+		return
+	}
+
+	err := e.store.update(ctx, func(data string) (string, error) {
+		configs, err := decodeEndpointConfigs(data)
+		if err != nil {
+			return "", err
+		}
+		mutate(configs)
+		encoded, err := json.Marshal(configs)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode endpoint configurations: %w", err)
+		}
+		return string(encoded), nil
+	})
+	if err != nil {
+		e.logger.Warn("Failed to persist endpoint configuration", zap.Error(err))
+	}
+}
+
+// decodeEndpointConfigs parses stored configurations keyed by endpointConfigID
+func decodeEndpointConfigs(data string) (map[string]storedEndpointConfig, error) {
+	configs := make(map[string]storedEndpointConfig)
+	if data == "" {
+		return configs, nil
+	}
+	if err := json.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
+// storedConfigForDelete fills in config from the configuration stored for endpoint when the
+// delete arrived without the annotations that enabled it, and reports whether it did
+func (p *TrafficManagerProvider) storedConfigForDelete(ctx context.Context, config *annotations.TrafficManagerConfig, endpoint *Endpoint) bool {
+	if config.Enabled || p.endpointConfigs == nil {
+		return false
+	}
+
+	stored, ok, err := p.endpointConfigs.get(ctx, endpointConfigID(endpoint))
+	if err != nil {
+		p.log(ctx).Warn("Failed to read stored endpoint configuration",
+			zap.String("dnsName", endpoint.DNSName),
+			zap.Error(err))
+		return false
+	}
+	if !ok {
+		return false
+	}
+
+	p.log(ctx).Info("Delete has no Traffic Manager annotations, using the stored endpoint configuration",
+		zap.String("dnsName", endpoint.DNSName),
+		zap.String("setIdentifier", endpoint.SetIdentifier),
+		zap.String("profileName", stored.ProfileName),
+		zap.String("endpointName", stored.EndpointName))
+	stored.apply(config)
+	return true
+}
+
+// rememberEndpointConfig records the resolved configuration of an endpoint for later deletes
+func (p *TrafficManagerProvider) rememberEndpointConfig(ctx context.Context, endpoint *Endpoint, config *annotations.TrafficManagerConfig) {
+	if p.endpointConfigs != nil {
+		p.endpointConfigs.set(ctx, endpointConfigID(endpoint), toStoredEndpointConfig(endpoint, config))
+	}
+}
+
+// forgetEndpointConfig drops the stored configuration of a deleted endpoint
+func (p *TrafficManagerProvider) forgetEndpointConfig(ctx context.Context, endpoint *Endpoint) {
+	if p.endpointConfigs != nil {
+		p.endpointConfigs.delete(ctx, endpointConfigID(endpoint))
+	}
+}
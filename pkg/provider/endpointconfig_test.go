@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestEndpointConfigs_Persisted(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	store, err := newConfigMapStore(client, "external-dns/tm-endpoints", endpointConfigKey)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	stored := storedEndpointConfig{ResourceGroup: "tm-rg", ProfileName: "demo-example-com-tm", EndpointName: "demo-east", Hostname: "demo.example.com"}
+	configs := newEndpointConfigs(store, zaptest.NewLogger(t))
+	configs.set(ctx, endpointConfigID(&Endpoint{DNSName: "Demo-East.example.com"}), stored)
+
+	// A restarted webhook reads the configuration back from the ConfigMap
+	restarted := newEndpointConfigs(store, zaptest.NewLogger(t))
+	got, ok, err := restarted.get(ctx, "demo-east.example.com")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, stored, got)
+
+	restarted.delete(ctx, "demo-east.example.com")
+	_, ok, err = newEndpointConfigs(store, zaptest.NewLogger(t)).get(ctx, "demo-east.example.com")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestEndpointConfigs_InMemory(t *testing.T) {
+	configs := newEndpointConfigs(nil, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	configs.set(ctx, "demo-east.example.com", storedEndpointConfig{ProfileName: "demo-example-com-tm"})
+	got, ok, err := configs.get(ctx, "demo-east.example.com")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "demo-example-com-tm", got.ProfileName)
+}
+
+func TestStoredConfigForDelete(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger:          zaptest.NewLogger(t),
+		endpointConfigs: newEndpointConfigs(nil, zaptest.NewLogger(t)),
+	}
+	ctx := context.Background()
+
+	created := &annotations.TrafficManagerConfig{
+		Enabled:            true,
+		ResourceGroup:      "tm-rg",
+		ProfileName:        "demo-example-com-tm",
+		EndpointName:       "demo-east",
+		EndpointType:       "ExternalEndpoints",
+		Hostname:           "demo.example.com",
+		RoutingMethod:      "Priority",
+		DeletionProtection: true,
+	}
+	endpoint := &Endpoint{DNSName: "demo-east.example.com"}
+	p.rememberEndpointConfig(ctx, endpoint, created)
+
+	// A delete without annotations parses as disabled, with only the defaults filled in
+	config := &annotations.TrafficManagerConfig{ResourceGroup: "default-rg", RoutingMethod: "Weighted"}
+	assert.True(t, p.storedConfigForDelete(ctx, config, endpoint))
+	assert.True(t, config.Enabled)
+	assert.Equal(t, "tm-rg", config.ResourceGroup)
+	assert.Equal(t, "demo-example-com-tm", config.ProfileName)
+	assert.Equal(t, "demo-east", config.EndpointName)
+	assert.Equal(t, "demo.example.com", config.Hostname)
+	assert.Equal(t, "Priority", config.RoutingMethod)
+	assert.True(t, config.DeletionProtection)
+
+	annotated := &annotations.TrafficManagerConfig{Enabled: true, ResourceGroup: "other-rg"}
+	assert.False(t, p.storedConfigForDelete(ctx, annotated, endpoint), "annotations win when present")
+	assert.Equal(t, "other-rg", annotated.ResourceGroup)
+
+	weighted := &Endpoint{DNSName: "demo-east.example.com", SetIdentifier: "blue"}
+	assert.False(t, p.storedConfigForDelete(ctx, &annotations.TrafficManagerConfig{}, weighted), "set identifiers are stored separately")
+
+	p.forgetEndpointConfig(ctx, endpoint)
+	assert.False(t, p.storedConfigForDelete(ctx, &annotations.TrafficManagerConfig{}, endpoint))
+}
@@ -0,0 +1,221 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// Endpoint drain modes control how an endpoint is taken out of rotation before it is deleted
+const (
+	// EndpointDrainNone deletes endpoints at once
+	EndpointDrainNone = "none"
+
+	// EndpointDrainWeight lowers the endpoint to the minimum weight; endpoints of other routing methods are disabled
+	EndpointDrainWeight = "weight"
+
+	// EndpointDrainDisable disables the endpoint
+	EndpointDrainDisable = "disable"
+)
+
+// defaultEndpointDrainTTLMultiple is used when no TTL multiple is configured
+const defaultEndpointDrainTTLMultiple = 2
+
+// Endpoint drain phases
+const (
+	EndpointDrainPhaseDraining = "draining" // Out of rotation, waiting for resolvers' cached answers to expire
+	EndpointDrainPhaseDeleting = "deleting" // Due for deletion; a failed delete is retried
+)
+
+// EndpointDrain tracks an endpoint taken out of rotation before its deletion, so resolvers
+// holding cached answers for it stop being sent there before it disappears
+type EndpointDrain struct {
+	Hostname     string    `json:"hostname"`
+	ProfileName  string    `json:"profileName"`
+	EndpointName string    `json:"endpointName"`
+	Mode         string    `json:"mode"`
+	Phase        string    `json:"phase"`
+	StartedAt    time.Time `json:"startedAt"`
+	DeleteAt     time.Time `json:"deleteAt"`
+	LastError    string    `json:"lastError,omitempty"`
+
+	config  *annotations.TrafficManagerConfig
+	dnsName string
+}
+
+func endpointDrainKey(profileName, endpointName string) string {
+	return profileName + "/" + endpointName
+}
+
+// drainEndpoints reports whether endpoints are drained before deletion
+func (p *TrafficManagerProvider) drainEndpoints() bool {
+	return p.endpointDrain != "" && p.endpointDrain != EndpointDrainNone
+}
+
+// startEndpointDrain takes an endpoint out of rotation and schedules its deletion for
+// the profile's DNS TTL times the configured multiple. An endpoint already draining is left alone.
+func (p *TrafficManagerProvider) startEndpointDrain(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, hostname, dnsName string) error {
+	key := endpointDrainKey(config.ProfileName, config.EndpointName)
+	p.endpointDrainsMu.Lock()
+	_, draining := p.endpointDrains[key]
+	p.endpointDrainsMu.Unlock()
+	if draining {
+		return nil
+	}
+
+	mode := p.endpointDrain
+	if mode == EndpointDrainWeight && config.RoutingMethod != "Weighted" {
+		mode = EndpointDrainDisable
+	}
+
+	var err error
+	if mode == EndpointDrainWeight {
+		err = tmClient.UpdateEndpointWeight(ctx, config.ResourceGroup, config.ProfileName, config.EndpointType, config.EndpointName, annotations.MinWeight)
+	} else {
+		err = tmClient.UpdateEndpointStatus(ctx, config.ResourceGroup, config.ProfileName, config.EndpointType, config.EndpointName, "Disabled")
+	}
+	if err != nil {
+		return err
+	}
+
+	// A canary would otherwise put traffic back on the endpoint; the scheduler skips draining endpoints
+	p.stopCanary(config.ProfileName, config.EndpointName)
+
+	now := p.now()
+	d := &EndpointDrain{
+		Hostname:     hostname,
+		ProfileName:  config.ProfileName,
+		EndpointName: config.EndpointName,
+		Mode:         mode,
+		Phase:        EndpointDrainPhaseDraining,
+		StartedAt:    now,
+		DeleteAt:     now.Add(time.Duration(config.DNSTTL*int64(p.endpointDrainTTLMultiple)) * time.Second),
+		config:       config,
+		dnsName:      dnsName,
+	}
+
+	p.endpointDrainsMu.Lock()
+	if p.endpointDrains == nil {
+		p.endpointDrains = make(map[string]*EndpointDrain)
+	}
+	p.endpointDrains[key] = d
+	metrics.EndpointsDraining.Set(float64(len(p.endpointDrains)))
+	p.endpointDrainsMu.Unlock()
+
+	p.log(ctx).Info("Draining Traffic Manager endpoint before delete",
+		zap.String("endpointName", d.EndpointName),
+		zap.String("profileName", d.ProfileName),
+		zap.String("mode", mode),
+		zap.Time("deleteAt", d.DeleteAt))
+	return nil
+}
+
+// cancelEndpointDrain forgets a drain, for example when the endpoint is created again before it was deleted
+func (p *TrafficManagerProvider) cancelEndpointDrain(ctx context.Context, profileName, endpointName string) {
+	p.endpointDrainsMu.Lock()
+	defer p.endpointDrainsMu.Unlock()
+
+	key := endpointDrainKey(profileName, endpointName)
+	if _, ok := p.endpointDrains[key]; !ok {
+		return
+	}
+	delete(p.endpointDrains, key)
+	metrics.EndpointsDraining.Set(float64(len(p.endpointDrains)))
+
+	p.log(ctx).Info("Cancelled endpoint drain",
+		zap.String("endpointName", endpointName),
+		zap.String("profileName", profileName))
+}
+
+// endpointDraining reports whether an endpoint is waiting to be deleted
+func (p *TrafficManagerProvider) endpointDraining(profileName, endpointName string) bool {
+	p.endpointDrainsMu.Lock()
+	defer p.endpointDrainsMu.Unlock()
+
+	_, ok := p.endpointDrains[endpointDrainKey(profileName, endpointName)]
+	return ok
+}
+
+// EndpointDrains returns the endpoints being drained before deletion, ordered by profile and endpoint
+func (p *TrafficManagerProvider) EndpointDrains() []EndpointDrain {
+	p.endpointDrainsMu.Lock()
+	defer p.endpointDrainsMu.Unlock()
+
+	drains := make([]EndpointDrain, 0, len(p.endpointDrains))
+	for _, d := range p.endpointDrains {
+		drains = append(drains, *d)
+	}
+	sort.Slice(drains, func(i, j int) bool {
+		return endpointDrainKey(drains[i].ProfileName, drains[i].EndpointName) < endpointDrainKey(drains[j].ProfileName, drains[j].EndpointName)
+	})
+	return drains
+}
+
+// CompleteEndpointDrains deletes every drained endpoint whose wait has passed, and its profile
+// once no other endpoint is left. It returns the number of endpoints deleted.
+func (p *TrafficManagerProvider) CompleteEndpointDrains(ctx context.Context) (int, error) {
+	now := p.now()
+
+	p.endpointDrainsMu.Lock()
+	due := make([]*EndpointDrain, 0, len(p.endpointDrains))
+	for _, d := range p.endpointDrains {
+		if !now.Before(d.DeleteAt) {
+			due = append(due, d)
+		}
+	}
+	p.endpointDrainsMu.Unlock()
+
+	deleted := 0
+	for _, d := range due {
+		tmClient, err := p.clientFor(d.config.SubscriptionID, d.config.ResourceGroup)
+		if err != nil {
+			return deleted, err
+		}
+
+		err = p.removeEndpoint(ctx, tmClient, d.config, d.Hostname)
+		if err != nil && !trafficmanager.IsNotFound(err) {
+			p.log(ctx).Warn("Failed to delete drained endpoint",
+				zap.String("endpointName", d.EndpointName),
+				zap.String("profileName", d.ProfileName),
+				zap.Error(err))
+
+			p.endpointDrainsMu.Lock()
+			d.Phase = EndpointDrainPhaseDeleting
+			d.LastError = err.Error()
+			p.endpointDrainsMu.Unlock()
+			continue
+		}
+
+		p.endpointDrainsMu.Lock()
+		delete(p.endpointDrains, endpointDrainKey(d.ProfileName, d.EndpointName))
+		metrics.EndpointsDraining.Set(float64(len(p.endpointDrains)))
+		p.endpointDrainsMu.Unlock()
+
+		p.deleteProfileIfEmpty(ctx, tmClient, d.config, d.Hostname, d.dnsName)
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// RunEndpointDrains runs CompleteEndpointDrains every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunEndpointDrains(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.CompleteEndpointDrains(ctx); err != nil {
+				p.log(ctx).Error("Endpoint drain controller failed", zap.Error(err))
+			}
+		}
+	}
+}
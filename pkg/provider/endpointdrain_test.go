@@ -0,0 +1,100 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newEndpointDrainProvider(t *testing.T, now time.Time) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:        logger,
+		stateManager:  state.NewManager(5*time.Minute, logger),
+		clock:         func() time.Time { return now },
+		endpointDrain: EndpointDrainWeight,
+	}
+	p.endpointDrains = map[string]*EndpointDrain{
+		"web-tm/west": {ProfileName: "web-tm", EndpointName: "west", Phase: EndpointDrainPhaseDraining, DeleteAt: now.Add(time.Minute)},
+		"app-tm/east": {ProfileName: "app-tm", EndpointName: "east", Phase: EndpointDrainPhaseDraining, DeleteAt: now.Add(2 * time.Minute)},
+	}
+	return p
+}
+
+func TestDrainEndpoints(t *testing.T) {
+	for mode, want := range map[string]bool{
+		"":                   false,
+		EndpointDrainNone:    false,
+		EndpointDrainWeight:  true,
+		EndpointDrainDisable: true,
+	} {
+		p := &TrafficManagerProvider{endpointDrain: mode}
+		assert.Equal(t, want, p.drainEndpoints(), mode)
+	}
+}
+
+func TestEndpointDrains_OrderedAndCancelled(t *testing.T) {
+	p := newEndpointDrainProvider(t, time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))
+
+	drains := p.EndpointDrains()
+	require.Len(t, drains, 2)
+	assert.Equal(t, "app-tm", drains[0].ProfileName)
+	assert.Equal(t, "web-tm", drains[1].ProfileName)
+	assert.True(t, p.endpointDraining("web-tm", "west"))
+
+	p.cancelEndpointDrain(context.Background(), "web-tm", "west")
+	assert.False(t, p.endpointDraining("web-tm", "west"))
+	assert.Len(t, p.EndpointDrains(), 1)
+
+	// Cancelling an endpoint that isn't draining is a no-op
+	p.cancelEndpointDrain(context.Background(), "web-tm", "missing")
+	assert.Len(t, p.EndpointDrains(), 1)
+}
+
+func TestCompleteEndpointDrains_WaitsForDeleteAt(t *testing.T) {
+	p := newEndpointDrainProvider(t, time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))
+
+	deleted, err := p.CompleteEndpointDrains(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+	assert.Len(t, p.EndpointDrains(), 2)
+}
+
+func TestApplySchedules_SkipsDrainingEndpoints(t *testing.T) {
+	// Inside the window east would be disabled, but it is draining; west belongs to aks-west
+	p := newScheduleProvider(t, time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC))
+	p.endpointDrains = map[string]*EndpointDrain{
+		"app-example-com-tm/east": {ProfileName: "app-example-com-tm", EndpointName: "east"},
+	}
+
+	changed, err := p.ApplySchedules(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+}
+
+func TestHandleEndpointDrains(t *testing.T) {
+	p := newEndpointDrainProvider(t, time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleEndpointDrains(rec, httptest.NewRequest(http.MethodGet, "/endpointdrains", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var drains []EndpointDrain
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &drains))
+	require.Len(t, drains, 2)
+	assert.Equal(t, "east", drains[0].EndpointName)
+	assert.Equal(t, EndpointDrainPhaseDraining, drains[0].Phase)
+
+	rec = httptest.NewRecorder()
+	s.HandleEndpointDrains(rec, httptest.NewRequest(http.MethodPost, "/endpointdrains", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
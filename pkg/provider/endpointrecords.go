@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+)
+
+// endpointRecords returns the source records behind the endpoints of profiles, so External DNS'
+// plan reflects which records have a Traffic Manager endpoint. A record is only returned while
+// its endpoint exists: one removed in Azure shows up in the plan as a record to create, which
+// creates the endpoint again.
+func (p *TrafficManagerProvider) endpointRecords(ctx context.Context, profiles []*state.ProfileState) ([]*Endpoint, error) {
+	configs, err := p.endpointConfigs.all(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*state.ProfileState, len(profiles))
+	for _, profile := range profiles {
+		byName[profileKey(profile.ResourceGroup, profile.ProfileName)] = profile
+	}
+
+	var records []*Endpoint
+	for _, id := range sortedKeys(configs) {
+		config := configs[id]
+		// Configurations stored before source records were kept can't be returned
+		if config.DNSName == "" || !p.matchesDomainFilter(config.DNSName) {
+			continue
+		}
+		profile, ok := byName[profileKey(config.ResourceGroup, config.ProfileName)]
+		if !ok {
+			continue
+		}
+		if endpoint := profileEndpoint(profile, config.EndpointName); endpoint != nil {
+			records = append(records, config.record(profile, endpoint))
+		}
+	}
+	return records, nil
+}
+
+// profileKey identifies a profile by resource group and name, which Azure compares case-insensitively
+func profileKey(resourceGroup, profileName string) string {
+	return strings.ToLower(resourceGroup + "/" + profileName)
+}
+
+// profileEndpoint returns the endpoint created under name. Records with several targets, and names
+// that collided, get endpoints with a suffix after the name; the first of those is returned.
+func profileEndpoint(profile *state.ProfileState, name string) *state.EndpointState {
+	if endpoint, ok := profile.Endpoints[name]; ok {
+		return endpoint
+	}
+	for _, endpointName := range sortedKeys(profile.Endpoints) {
+		if endpointName != FallbackEndpointName && strings.HasPrefix(endpointName, name+"-") {
+			return profile.Endpoints[endpointName]
+		}
+	}
+	return nil
+}
+
+// record returns the stored source record, labelled with the endpoint that serves it
+func (s storedEndpointConfig) record(profile *state.ProfileState, endpoint *state.EndpointState) *Endpoint {
+	return &Endpoint{
+		DNSName:       s.DNSName,
+		SetIdentifier: s.SetIdentifier,
+		RecordType:    s.RecordType,
+		Targets:       s.Targets,
+		RecordTTL:     s.RecordTTL,
+		Labels: map[string]string{
+			"traffic-manager-profile":         profile.ProfileName,
+			"traffic-manager-endpoint":        endpoint.EndpointName,
+			"traffic-manager-endpoint-status": endpoint.Status,
+			"traffic-manager-monitor-status":  endpoint.MonitorStatus,
+		},
+	}
+}
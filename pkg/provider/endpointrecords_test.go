@@ -0,0 +1,63 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestEndpointRecords(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger:          zaptest.NewLogger(t),
+		endpointConfigs: newEndpointConfigs(nil, zaptest.NewLogger(t)),
+	}
+	ctx := context.Background()
+
+	east := &Endpoint{DNSName: "demo-east.example.com", RecordType: "A", Targets: []string{"20.30.40.50"}, RecordTTL: 60}
+	west := &Endpoint{DNSName: "demo-west.example.com", RecordType: "A", Targets: []string{"20.30.40.60"}}
+	p.rememberEndpointConfig(ctx, east, &annotations.TrafficManagerConfig{ResourceGroup: "tm-rg", ProfileName: "demo-example-com-tm", EndpointName: "demo-east"})
+	p.rememberEndpointConfig(ctx, west, &annotations.TrafficManagerConfig{ResourceGroup: "tm-rg", ProfileName: "demo-example-com-tm", EndpointName: "demo-west"})
+
+	profiles := []*state.ProfileState{{
+		ProfileName:   "demo-example-com-tm",
+		ResourceGroup: "TM-RG",
+		Endpoints: map[string]*state.EndpointState{
+			"demo-east": {EndpointName: "demo-east", Status: "Enabled", MonitorStatus: "Online"},
+		},
+	}}
+
+	records, err := p.endpointRecords(ctx, profiles)
+	require.NoError(t, err)
+	require.Len(t, records, 1, "the west endpoint is missing from the profile")
+	assert.Equal(t, "demo-east.example.com", records[0].DNSName)
+	assert.Equal(t, "A", records[0].RecordType)
+	assert.Equal(t, []string{"20.30.40.50"}, records[0].Targets)
+	assert.Equal(t, int64(60), records[0].RecordTTL)
+	assert.Equal(t, map[string]string{
+		"traffic-manager-profile":         "demo-example-com-tm",
+		"traffic-manager-endpoint":        "demo-east",
+		"traffic-manager-endpoint-status": "Enabled",
+		"traffic-manager-monitor-status":  "Online",
+	}, records[0].Labels)
+
+	records, err = p.endpointRecords(ctx, nil)
+	require.NoError(t, err)
+	assert.Empty(t, records, "records of profiles that weren't synced aren't returned")
+}
+
+func TestProfileEndpoint(t *testing.T) {
+	profile := &state.ProfileState{Endpoints: map[string]*state.EndpointState{
+		"app-1":              {EndpointName: "app-1"},
+		"app-0":              {EndpointName: "app-0"},
+		FallbackEndpointName: {EndpointName: FallbackEndpointName},
+	}}
+
+	assert.Equal(t, "app-0", profileEndpoint(profile, "app").EndpointName, "endpoints of several targets have an index")
+	assert.Equal(t, "app-1", profileEndpoint(profile, "app-1").EndpointName)
+	assert.Nil(t, profileEndpoint(profile, "other"))
+}
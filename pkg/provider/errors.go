@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// Error codes returned in ErrorResponse so External DNS logs and other tooling can categorize failures
+const (
+	ErrorCodeInvalidRequest       = "invalid_request"
+	ErrorCodeRequestTooLarge      = "request_too_large"
+	ErrorCodeRequestTimeout       = "request_timeout"
+	ErrorCodeRateLimited          = "rate_limited"
+	ErrorCodeMethodNotAllowed     = "method_not_allowed"
+	ErrorCodeNotAcceptable        = "not_acceptable"
+	ErrorCodeUnsupportedMediaType = "unsupported_media_type"
+	ErrorCodeUnauthorized         = "unauthorized"
+	ErrorCodeNotFound             = "not_found"
+	ErrorCodeInvalidAnnotation    = "invalid_annotation"
+	ErrorCodeWeightChangeRejected = "weight_change_rejected"
+	ErrorCodePolicyViolation      = "policy_violation"
+	ErrorCodeQuotaExceeded        = "quota_exceeded"
+	ErrorCodeProfileConflict      = "profile_conflict"
+	ErrorCodeAzureThrottled       = "azure_throttled"
+	ErrorCodeAzureUnauthorized    = "azure_unauthorized"
+	ErrorCodeAzureQuotaExceeded   = "azure_quota_exceeded"
+	ErrorCodeAzureNotFound        = "azure_not_found"
+	ErrorCodeAzureError           = "azure_error"
+	ErrorCodeInternal             = "internal_error"
+
+	// Records of an ApplyChanges batch failed for different reasons, listed in ErrorResponse.Failures
+	ErrorCodePartialFailure = "partial_failure"
+)
+
+// errorStatus maps error codes to HTTP status codes
+var errorStatus = map[string]int{
+	ErrorCodeInvalidRequest:       http.StatusBadRequest,
+	ErrorCodeRequestTooLarge:      http.StatusRequestEntityTooLarge,
+	ErrorCodeRequestTimeout:       http.StatusGatewayTimeout,
+	ErrorCodeRateLimited:          http.StatusServiceUnavailable, // External DNS retries server errors
+	ErrorCodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	ErrorCodeNotAcceptable:        http.StatusNotAcceptable,
+	ErrorCodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	ErrorCodeUnauthorized:         http.StatusUnauthorized,
+	ErrorCodeNotFound:             http.StatusNotFound,
+	ErrorCodeInvalidAnnotation:    http.StatusUnprocessableEntity,
+	ErrorCodeWeightChangeRejected: http.StatusUnprocessableEntity,
+	ErrorCodePolicyViolation:      http.StatusForbidden,
+	ErrorCodeQuotaExceeded:        http.StatusForbidden,
+	ErrorCodeProfileConflict:      http.StatusConflict,
+	ErrorCodeAzureThrottled:       http.StatusTooManyRequests,
+	ErrorCodeAzureUnauthorized:    http.StatusBadGateway,
+	ErrorCodeAzureQuotaExceeded:   http.StatusForbidden,
+	ErrorCodeAzureNotFound:        http.StatusNotFound,
+	ErrorCodeAzureError:           http.StatusBadGateway,
+	ErrorCodeInternal:             http.StatusInternalServerError,
+	ErrorCodePartialFailure:       http.StatusInternalServerError, // External DNS retries server errors
+}
+
+// codedError attaches an error code to an error without changing its message
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// withCode tags err with an error code for the webhook response
+func withCode(code string, err error) error {
+	return &codedError{code: code, err: err}
+}
+
+// errorCode returns the error code for err: an explicit code if one was attached,
+// otherwise one derived from the Azure response
+func errorCode(err error) string {
+	var applyErr *ApplyError
+	if errors.As(err, &applyErr) {
+		return applyErr.Code()
+	}
+
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorCodeRequestTimeout
+	case trafficmanager.IsThrottled(err):
+		return ErrorCodeAzureThrottled
+	case trafficmanager.IsConflict(err), trafficmanager.IsPreconditionFailed(err), errors.Is(err, trafficmanager.ErrProfileConflict):
+		return ErrorCodeProfileConflict
+	case trafficmanager.IsAuthorizationFailed(err):
+		return ErrorCodeAzureUnauthorized
+	case trafficmanager.IsQuotaExceeded(err):
+		return ErrorCodeAzureQuotaExceeded
+	case trafficmanager.IsNotFound(err):
+		return ErrorCodeAzureNotFound
+	case trafficmanager.IsAzureError(err):
+		return ErrorCodeAzureError
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// writeError writes a JSON ErrorResponse with the status code for the given error code
+func (s *WebhookServer) writeError(w http.ResponseWriter, code, message string) {
+	s.writeErrorResponse(w, ErrorResponse{Code: code, Message: message})
+}
+
+// writeErrorResponse writes resp with the status code for its error code
+func (s *WebhookServer) writeErrorResponse(w http.ResponseWriter, resp ErrorResponse) {
+	status, ok := errorStatus[resp.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		s.logger.Error("Failed to encode error response", zap.Error(err))
+	}
+}
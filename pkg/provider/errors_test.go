@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"invalid annotation", withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("weight must be between 1 and 1000, got 0")), ErrorCodeInvalidAnnotation},
+		{"wrapped code", fmt.Errorf("failed to apply: %w", withCode(ErrorCodeWeightChangeRejected, fmt.Errorf("too large"))), ErrorCodeWeightChangeRejected},
+		{"throttled", fmt.Errorf("failed to update profile: %w", &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}), ErrorCodeAzureThrottled},
+		{"conflict", &azcore.ResponseError{StatusCode: http.StatusConflict}, ErrorCodeProfileConflict},
+		{"settings changed by another writer", fmt.Errorf("failed to update profile: %w", fmt.Errorf("%w: app-tm", trafficmanager.ErrProfileConflict)), ErrorCodeProfileConflict},
+		{"forbidden", &azcore.ResponseError{StatusCode: http.StatusForbidden}, ErrorCodeAzureUnauthorized},
+		{"classified throttling", fmt.Errorf("failed to list profiles: %w", &trafficmanager.AzureError{Kind: trafficmanager.ErrThrottled, Err: errors.New("429")}), ErrorCodeAzureThrottled},
+		{"quota", &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "QuotaExceeded"}, ErrorCodeAzureQuotaExceeded},
+		{"not found", fmt.Errorf("failed to get profile: %w", &trafficmanager.AzureError{Kind: trafficmanager.ErrProfileNotFound, Err: &azcore.ResponseError{StatusCode: http.StatusNotFound}}), ErrorCodeAzureNotFound},
+		{"other azure error", &azcore.ResponseError{StatusCode: http.StatusInternalServerError}, ErrorCodeAzureError},
+		{"unknown", fmt.Errorf("boom"), ErrorCodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, errorCode(tt.err))
+		})
+	}
+}
+
+func TestWithCode_KeepsMessage(t *testing.T) {
+	err := withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("failed to parse annotations: %w", fmt.Errorf("bad weight")))
+	assert.Equal(t, "failed to parse annotations: bad weight", err.Error())
+}
+
+func TestWriteError(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleRecords(rec, httptest.NewRequest(http.MethodDelete, "/records", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	rec = httptest.NewRecorder()
+	s.HandleAdjustEndpoints(rec, httptest.NewRequest(http.MethodPost, "/adjustendpoints", strings.NewReader("not json")))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response ErrorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, ErrorCodeInvalidRequest, response.Code)
+	assert.Contains(t, response.Message, "Invalid request body")
+}
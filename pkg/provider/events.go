@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// eventComponent is the source of the Kubernetes events the webhook records
+const eventComponent = "external-dns-traffic-manager"
+
+var eventGVR = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+
+// eventObjects maps the kinds in External DNS' "resource" label to the objects events are recorded on
+var eventObjects = map[string]struct{ apiVersion, kind string }{
+	"service": {"v1", "Service"},
+	"ingress": {"networking.k8s.io/v1", "Ingress"},
+	"crd":     {"externaldns.k8s.io/v1alpha1", "DNSEndpoint"},
+}
+
+// eventRecorder records Kubernetes events on the resources behind records, so problems with their
+// annotations show up in kubectl describe
+type eventRecorder struct {
+	client dynamic.Interface
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+func newEventRecorder(client dynamic.Interface, logger *zap.Logger) *eventRecorder {
+	return &eventRecorder{client: client, logger: logger, now: time.Now}
+}
+
+// eventObject is the object an event is recorded on
+type eventObject struct {
+	apiVersion, kind, namespace, name string
+}
+
+// warn records a Warning event on the resource named by labels' "resource" label. Records from
+// sources without a known object are skipped, and failures are only logged, as events are advisory.
+func (r *eventRecorder) warn(ctx context.Context, labels map[string]string, reason, message string) {
+	if r == nil {
+		return
+	}
+	parts := strings.Split(labels["resource"], "/")
+	if len(parts) != 3 {
+		return
+	}
+	object, ok := eventObjects[parts[0]]
+	if !ok {
+		return
+	}
+	r.record(ctx, eventObject{apiVersion: object.apiVersion, kind: object.kind, namespace: parts[1], name: parts[2]}, reason, message)
+}
+
+// warnPod records a Warning event on the webhook's own Pod, for problems with the webhook rather
+// than a record. It is skipped when the Pod isn't known.
+func (r *eventRecorder) warnPod(ctx context.Context, pod types.NamespacedName, reason, message string) {
+	if r == nil || pod.Name == "" || pod.Namespace == "" {
+		return
+	}
+	r.record(ctx, eventObject{apiVersion: "v1", kind: "Pod", namespace: pod.Namespace, name: pod.Name}, reason, message)
+}
+
+// record creates a Warning event on object, logging failures
+func (r *eventRecorder) record(ctx context.Context, object eventObject, reason, message string) {
+	now := r.now()
+	timestamp := now.UTC().Format(time.RFC3339)
+	event := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Event",
+		"metadata": map[string]interface{}{
+			// Named like client-go's recorder names events
+			"name":      fmt.Sprintf("%s.%x", object.name, now.UnixNano()),
+			"namespace": object.namespace,
+		},
+		"involvedObject": map[string]interface{}{
+			"apiVersion": object.apiVersion,
+			"kind":       object.kind,
+			"namespace":  object.namespace,
+			"name":       object.name,
+		},
+		"type":               "Warning",
+		"reason":             reason,
+		"message":            message,
+		"source":             map[string]interface{}{"component": eventComponent},
+		"reportingComponent": eventComponent,
+		"firstTimestamp":     timestamp,
+		"lastTimestamp":      timestamp,
+		"count":              int64(1),
+	}}
+
+	if _, err := r.client.Resource(eventGVR).Namespace(object.namespace).Create(ctx, event, metav1.CreateOptions{}); err != nil {
+		r.logger.Warn("Failed to record Kubernetes event",
+			zap.String("resource", strings.ToLower(object.kind)+"/"+object.namespace+"/"+object.name),
+			zap.String("reason", reason),
+			zap.Error(fmt.Errorf("failed to create event in %s: %w", object.namespace, err)))
+	}
+}
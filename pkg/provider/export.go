@@ -0,0 +1,366 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// ProfileDefinitionsVersion identifies the format of exported profile definitions
+const ProfileDefinitionsVersion = "trafficmanager.webhook/v1"
+
+// ProfileDefinitions is the document written by export and read by import
+type ProfileDefinitions struct {
+	Version  string              `json:"version"`
+	Profiles []ProfileDefinition `json:"profiles"`
+}
+
+// ProfileDefinition is the configuration of one managed Traffic Manager profile
+type ProfileDefinition struct {
+	Hostname       string `json:"hostname"`
+	SubscriptionID string `json:"subscriptionId,omitempty"` // Empty for the default subscription
+	ResourceGroup  string `json:"resourceGroup"`
+	ProfileName    string `json:"profileName"`
+	RoutingMethod  string `json:"routingMethod"`
+	DNSTTL         int64  `json:"dnsTtl"`
+
+	MonitorProtocol     string `json:"monitorProtocol"`
+	MonitorPort         int64  `json:"monitorPort"`
+	MonitorPath         string `json:"monitorPath,omitempty"`
+	HealthChecksEnabled bool   `json:"healthChecksEnabled"`
+	TrafficViewEnabled  bool   `json:"trafficViewEnabled,omitempty"`
+	ProfileStatus       string `json:"profileStatus,omitempty"` // Empty for Enabled
+
+	Tags      map[string]string    `json:"tags,omitempty"`
+	Endpoints []EndpointDefinition `json:"endpoints"`
+}
+
+// EndpointDefinition is the configuration of one endpoint of a ProfileDefinition
+type EndpointDefinition struct {
+	Name             string `json:"name"`
+	Type             string `json:"type"`
+	Target           string `json:"target,omitempty"`
+	TargetResourceID string `json:"targetResourceId,omitempty"` // Replaces Target for AzureEndpoints
+	Weight           int64  `json:"weight,omitempty"`
+	Priority         int64  `json:"priority,omitempty"`
+	Status           string `json:"status"`
+	Location         string `json:"location,omitempty"`
+
+	CustomHeaders map[string]string `json:"customHeaders,omitempty"` // Sent with the endpoint's health probes
+}
+
+// endpointTypes are the endpoint types a definition can use
+var endpointTypes = []string{"AzureEndpoints", "ExternalEndpoints", "NestedEndpoints"}
+
+// ImportResult is the outcome of importing profile definitions
+type ImportResult struct {
+	DryRun   bool          `json:"dryRun"`
+	Imported []string      `json:"imported"` // Hostnames whose profile was written, or would be on a dry run
+	Errors   []ImportError `json:"errors,omitempty"`
+}
+
+// ImportError is a profile that couldn't be imported
+type ImportError struct {
+	Hostname string `json:"hostname"`
+	Error    string `json:"error"`
+}
+
+// ExportProfiles syncs the managed profiles from Azure and returns their definitions, ordered by
+// hostname. Soft-deleted profiles are left out.
+func (p *TrafficManagerProvider) ExportProfiles(ctx context.Context) (*ProfileDefinitions, error) {
+	if _, err := p.Records(ctx); err != nil {
+		return nil, err
+	}
+
+	defs := &ProfileDefinitions{Version: ProfileDefinitionsVersion, Profiles: []ProfileDefinition{}}
+	for _, cached := range p.CachedProfiles() {
+		profile := cached.Profile
+		if softDeleted(profile) {
+			continue
+		}
+
+		def := ProfileDefinition{
+			Hostname:            profile.Hostname,
+			ResourceGroup:       profile.ResourceGroup,
+			ProfileName:         profile.ProfileName,
+			RoutingMethod:       profile.RoutingMethod,
+			DNSTTL:              profile.DNSTTL,
+			MonitorProtocol:     profile.MonitorProtocol,
+			MonitorPort:         profile.MonitorPort,
+			MonitorPath:         profile.MonitorPath,
+			HealthChecksEnabled: profile.HealthChecksEnabled,
+			TrafficViewEnabled:  profile.TrafficViewEnabled,
+			ProfileStatus:       profile.ProfileStatus,
+			Tags:                profile.Tags,
+			Endpoints:           make([]EndpointDefinition, 0, len(profile.Endpoints)),
+		}
+		if subscriptionID := subscriptionFromResourceID(profile.ResourceID); subscriptionID != p.subscriptionID {
+			def.SubscriptionID = subscriptionID
+		}
+
+		for _, name := range sortedKeys(profile.Endpoints) {
+			endpoint := profile.Endpoints[name]
+			def.Endpoints = append(def.Endpoints, EndpointDefinition{
+				Name:             endpoint.EndpointName,
+				Type:             endpointTypeName(endpoint.EndpointType),
+				Target:           endpoint.Target,
+				TargetResourceID: endpoint.TargetResourceID,
+				Weight:           endpoint.Weight,
+				Priority:         endpoint.Priority,
+				Status:           endpoint.Status,
+				Location:         endpoint.Location,
+				CustomHeaders:    endpoint.CustomHeaders,
+			})
+		}
+		defs.Profiles = append(defs.Profiles, def)
+	}
+	return defs, nil
+}
+
+// ImportProfiles creates or updates the profiles and endpoints in defs. Endpoints of an existing
+// profile that aren't in defs are left alone. The definitions are validated before anything is
+// written; a dry run stops there.
+func (p *TrafficManagerProvider) ImportProfiles(ctx context.Context, defs *ProfileDefinitions, dryRun bool) (*ImportResult, error) {
+	if err := validateProfileDefinitions(defs); err != nil {
+		return nil, withCode(ErrorCodeInvalidRequest, err)
+	}
+
+	result := &ImportResult{DryRun: dryRun, Imported: []string{}}
+	for _, def := range defs.Profiles {
+		if dryRun {
+			result.Imported = append(result.Imported, def.Hostname)
+			continue
+		}
+		if err := p.importProfile(ctx, def); err != nil {
+			p.log(ctx).Error("Failed to import profile",
+				zap.String("hostname", def.Hostname),
+				zap.String("profileName", def.ProfileName),
+				zap.Error(err))
+			result.Errors = append(result.Errors, ImportError{Hostname: def.Hostname, Error: err.Error()})
+			continue
+		}
+		result.Imported = append(result.Imported, def.Hostname)
+	}
+	return result, nil
+}
+
+// importProfile writes one profile with its endpoints and caches the result
+func (p *TrafficManagerProvider) importProfile(ctx context.Context, def ProfileDefinition) error {
+	tmClient, err := p.clientFor(def.SubscriptionID, def.ResourceGroup)
+	if err != nil {
+		return err
+	}
+
+	owner := p.owner()
+	tags := make(map[string]string, len(def.Tags)+2)
+	for k, v := range def.Tags {
+		tags[k] = v
+	}
+	// The profile must be recognised as ours, whatever the file says
+	tags[owner.ManagedByTag] = owner.ManagedByValue
+	tags[owner.HostnameTag] = def.Hostname
+	delete(tags, trafficmanager.DeleteAfterTag)
+
+	if _, err := tmClient.CreateProfile(ctx, &trafficmanager.ProfileConfig{
+		ProfileName:         def.ProfileName,
+		ResourceGroup:       def.ResourceGroup,
+		Location:            "global",
+		RoutingMethod:       def.RoutingMethod,
+		DNSTTL:              def.DNSTTL,
+		MonitorProtocol:     def.MonitorProtocol,
+		MonitorPort:         def.MonitorPort,
+		MonitorPath:         def.MonitorPath,
+		HealthChecksEnabled: def.HealthChecksEnabled,
+		TrafficViewEnabled:  def.TrafficViewEnabled,
+		ProfileStatus:       def.ProfileStatus,
+		Tags:                tags,
+	}); err != nil {
+		return err
+	}
+
+	for _, endpoint := range def.Endpoints {
+		if _, err := tmClient.CreateEndpoint(ctx, def.ResourceGroup, def.ProfileName, &trafficmanager.EndpointConfig{
+			EndpointName:     endpoint.Name,
+			EndpointType:     endpoint.Type,
+			Target:           endpoint.Target,
+			Weight:           endpoint.Weight,
+			Priority:         endpoint.Priority,
+			Status:           endpoint.Status,
+			Location:         endpoint.Location,
+			TargetResourceID: endpoint.TargetResourceID,
+			AlwaysServe:      !def.HealthChecksEnabled,
+			CustomHeaders:    endpoint.CustomHeaders,
+		}); err != nil {
+			return fmt.Errorf("failed to import endpoint %s: %w", endpoint.Name, err)
+		}
+	}
+
+	p.log(ctx).Info("Imported Traffic Manager profile",
+		zap.String("hostname", def.Hostname),
+		zap.String("profileName", def.ProfileName),
+		zap.Int("endpoints", len(def.Endpoints)))
+
+	profileState, err := tmClient.GetProfileState(ctx, def.ResourceGroup, def.ProfileName)
+	if err != nil {
+		// The next sync picks the profile up
+		p.log(ctx).Warn("Failed to read back imported profile", zap.String("profileName", def.ProfileName), zap.Error(err))
+		return nil
+	}
+	profileState.Hostname = def.Hostname
+	p.stateManager.SetProfile(def.Hostname, profileState)
+	return nil
+}
+
+// validateProfileDefinitions checks defs can be imported, reporting every problem found
+func validateProfileDefinitions(defs *ProfileDefinitions) error {
+	if defs.Version != ProfileDefinitionsVersion {
+		return fmt.Errorf("unsupported version %q, expected %q", defs.Version, ProfileDefinitionsVersion)
+	}
+
+	var errs []error
+	hostnames := make(map[string]bool, len(defs.Profiles))
+	for i, def := range defs.Profiles {
+		name := def.Hostname
+		if name == "" {
+			name = "#" + strconv.Itoa(i)
+		}
+		invalid := func(format string, args ...any) {
+			errs = append(errs, fmt.Errorf("profile %s: %s", name, fmt.Sprintf(format, args...)))
+		}
+
+		switch {
+		case def.Hostname == "":
+			invalid("hostname is required")
+		case hostnames[def.Hostname]:
+			invalid("hostname is defined more than once")
+		}
+		hostnames[def.Hostname] = true
+
+		if def.ProfileName == "" {
+			invalid("profileName is required")
+		}
+		if def.ResourceGroup == "" {
+			invalid("resourceGroup is required")
+		}
+		if !slices.Contains(annotations.ValidRoutingMethods, def.RoutingMethod) {
+			invalid("invalid routingMethod %q, must be one of: %v", def.RoutingMethod, annotations.ValidRoutingMethods)
+		}
+		if !slices.Contains(annotations.ValidMonitorProtocols, def.MonitorProtocol) {
+			invalid("invalid monitorProtocol %q, must be one of: %v", def.MonitorProtocol, annotations.ValidMonitorProtocols)
+		}
+		if def.MonitorPort < annotations.MinMonitorPort || def.MonitorPort > annotations.MaxMonitorPort {
+			invalid("invalid monitorPort %d", def.MonitorPort)
+		}
+
+		endpoints := make(map[string]bool, len(def.Endpoints))
+		for _, endpoint := range def.Endpoints {
+			switch {
+			case endpoint.Name == "":
+				invalid("endpoint name is required")
+			case endpoints[endpoint.Name]:
+				invalid("endpoint %s is defined more than once", endpoint.Name)
+			}
+			endpoints[endpoint.Name] = true
+
+			if !slices.Contains(endpointTypes, endpoint.Type) {
+				invalid("endpoint %s has invalid type %q, must be one of: %v", endpoint.Name, endpoint.Type, endpointTypes)
+			}
+			if endpoint.Target == "" && endpoint.TargetResourceID == "" {
+				invalid("endpoint %s needs a target or targetResourceId", endpoint.Name)
+			}
+			if !slices.Contains(annotations.ValidEndpointStatuses, endpoint.Status) {
+				invalid("endpoint %s has invalid status %q, must be one of: %v", endpoint.Name, endpoint.Status, annotations.ValidEndpointStatuses)
+			}
+			if err := annotations.ValidateCustomHeaders(endpoint.CustomHeaders); err != nil {
+				invalid("endpoint %s has invalid customHeaders: %v", endpoint.Name, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// endpointTypeName converts the ARM resource type Azure reports for an endpoint, such as
+// Microsoft.Network/trafficManagerProfiles/externalEndpoints, to the name used to create one
+func endpointTypeName(resourceType string) string {
+	name := resourceType[strings.LastIndex(resourceType, "/")+1:]
+	for _, endpointType := range endpointTypes {
+		if strings.EqualFold(name, endpointType) {
+			return endpointType
+		}
+	}
+	return name
+}
+
+// HandleAdminExport handles GET /admin/export - Export the managed profiles as YAML
+func (s *WebhookServer) HandleAdminExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	defs, err := s.provider.ExportProfiles(r.Context())
+	if err != nil {
+		s.log(r).Error("Failed to export profiles", zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to export profiles: %v", err))
+		return
+	}
+	data, err := yaml.Marshal(defs)
+	if err != nil {
+		s.log(r).Error("Failed to encode exported profiles", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+// HandleAdminImport handles POST /admin/import - Create or update the profiles in a YAML body.
+// With ?dryRun=true the body is only validated.
+func (s *WebhookServer) HandleAdminImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	defs, err := ReadProfileDefinitions(r.Body)
+	if err != nil {
+		s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+
+	result, err := s.provider.ImportProfiles(r.Context(), defs, dryRun)
+	if err != nil {
+		s.log(r).Error("Failed to import profiles", zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to import profiles: %v", err))
+		return
+	}
+	s.log(r).Info("Imported profiles via admin API",
+		zap.Bool("dryRun", dryRun),
+		zap.Int("imported", len(result.Imported)),
+		zap.Int("failed", len(result.Errors)))
+	s.writeAdminJSON(w, r, result)
+}
+
+// ReadProfileDefinitions decodes exported profile definitions, rejecting unknown fields
+func ReadProfileDefinitions(r io.Reader) (*ProfileDefinitions, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var defs ProfileDefinitions
+	if err := yaml.UnmarshalStrict(data, &defs); err != nil {
+		return nil, err
+	}
+	return &defs, nil
+}
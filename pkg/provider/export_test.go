@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+const testProfileDefinitions = `version: trafficmanager.webhook/v1
+profiles:
+- hostname: app.example.com
+  resourceGroup: tm-rg
+  profileName: app-tm
+  routingMethod: Weighted
+  dnsTtl: 30
+  monitorProtocol: HTTPS
+  monitorPort: 443
+  monitorPath: /health
+  healthChecksEnabled: true
+  tags:
+    team: payments
+  endpoints:
+  - name: east
+    type: ExternalEndpoints
+    target: 20.30.40.50
+    weight: 50
+    status: Enabled
+    location: eastus
+`
+
+func TestReadProfileDefinitions(t *testing.T) {
+	defs, err := ReadProfileDefinitions(strings.NewReader(testProfileDefinitions))
+	require.NoError(t, err)
+	require.Len(t, defs.Profiles, 1)
+	assert.Equal(t, "app-tm", defs.Profiles[0].ProfileName)
+	assert.Equal(t, int64(443), defs.Profiles[0].MonitorPort)
+	assert.Equal(t, EndpointDefinition{Name: "east", Type: "ExternalEndpoints", Target: "20.30.40.50", Weight: 50, Status: "Enabled", Location: "eastus"},
+		defs.Profiles[0].Endpoints[0])
+
+	_, err = ReadProfileDefinitions(strings.NewReader(testProfileDefinitions + "unknown: true\n"))
+	assert.Error(t, err)
+}
+
+func TestImportProfiles_Validation(t *testing.T) {
+	p := newAdminProvider(t)
+	ctx := context.Background()
+
+	defs, err := ReadProfileDefinitions(strings.NewReader(testProfileDefinitions))
+	require.NoError(t, err)
+	result, err := p.ImportProfiles(ctx, defs, true)
+	require.NoError(t, err)
+	assert.Equal(t, &ImportResult{DryRun: true, Imported: []string{"app.example.com"}}, result)
+
+	invalid := *defs
+	invalid.Profiles = append([]ProfileDefinition{}, defs.Profiles...)
+	invalid.Profiles = append(invalid.Profiles, ProfileDefinition{
+		Hostname:        "app.example.com",
+		RoutingMethod:   "RoundRobin",
+		MonitorProtocol: "HTTPS",
+		MonitorPort:     443,
+		Endpoints:       []EndpointDefinition{{Name: "west", Type: "externalEndpoints", Status: "Paused"}},
+	})
+	_, err = p.ImportProfiles(ctx, &invalid, true)
+	require.Error(t, err)
+	assert.Equal(t, ErrorCodeInvalidRequest, errorCode(err))
+	for _, problem := range []string{"defined more than once", "profileName is required", "resourceGroup is required",
+		`routingMethod "RoundRobin"`, `type "externalEndpoints"`, "needs a target", `status "Paused"`} {
+		assert.Contains(t, err.Error(), problem)
+	}
+
+	_, err = p.ImportProfiles(ctx, &ProfileDefinitions{Version: "v0"}, true)
+	assert.ErrorContains(t, err, "unsupported version")
+}
+
+func TestEndpointTypeName(t *testing.T) {
+	assert.Equal(t, "ExternalEndpoints", endpointTypeName("Microsoft.Network/trafficManagerProfiles/externalEndpoints"))
+	assert.Equal(t, "AzureEndpoints", endpointTypeName("Microsoft.Network/trafficManagerProfiles/azureEndpoints"))
+	assert.Equal(t, "NestedEndpoints", endpointTypeName("NestedEndpoints"))
+}
+
+func TestHandleAdminImport(t *testing.T) {
+	s := NewWebhookServer(newAdminProvider(t), zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleAdminImport(rec, httptest.NewRequest(http.MethodPost, "/admin/import?dryRun=true", strings.NewReader(testProfileDefinitions)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"dryRun":true,"imported":["app.example.com"]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	s.HandleAdminImport(rec, httptest.NewRequest(http.MethodPost, "/admin/import?dryRun=true", strings.NewReader("profiles: {}")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.HandleAdminImport(rec, httptest.NewRequest(http.MethodGet, "/admin/import", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,197 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// FallbackEndpointName is the reserved name of the fallback endpoint in a profile
+const FallbackEndpointName = "fallback"
+
+// monitorStatusDegraded is the Traffic Manager monitor status of an endpoint failing its health checks
+const monitorStatusDegraded = "Degraded"
+
+// fallbackEndpointConfig returns the fallback endpoint for a profile. It sorts last under both
+// Weighted (minimum weight) and Priority (lowest priority) routing and starts disabled;
+// the fallback watcher enables it when every primary endpoint is Degraded.
+func fallbackEndpointConfig(config *annotations.TrafficManagerConfig) *trafficmanager.EndpointConfig {
+	endpointConfig := trafficmanager.DefaultEndpointConfig()
+	endpointConfig.EndpointName = FallbackEndpointName
+	endpointConfig.Target = config.FallbackTarget
+	endpointConfig.Weight = annotations.MinWeight
+	endpointConfig.Priority = annotations.MaxPriority
+	endpointConfig.Status = "Disabled"
+	endpointConfig.Location = config.EndpointLocation
+	return endpointConfig
+}
+
+// ensureFallbackEndpoint creates or retargets the profile's fallback endpoint.
+// An existing fallback keeps its current status so an active fallback isn't switched off by an apply.
+func (p *TrafficManagerProvider) ensureFallbackEndpoint(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig) error {
+	endpointConfig := fallbackEndpointConfig(config)
+
+	existing, err := tmClient.GetEndpoint(ctx, config.ResourceGroup, config.ProfileName, endpointConfig.EndpointType, FallbackEndpointName)
+	switch {
+	case err == nil:
+		if existing.Target == endpointConfig.Target {
+			return nil
+		}
+		endpointConfig.Status = existing.Status
+	case !trafficmanager.IsNotFound(err):
+		return fmt.Errorf("failed to get fallback endpoint: %w", err)
+	}
+
+	p.log(ctx).Info("Setting Traffic Manager fallback endpoint",
+		zap.String("profileName", config.ProfileName),
+		zap.String("target", endpointConfig.Target),
+		zap.String("status", endpointConfig.Status))
+
+	if _, err := tmClient.CreateEndpoint(ctx, config.ResourceGroup, config.ProfileName, endpointConfig); err != nil {
+		return fmt.Errorf("failed to create fallback endpoint: %w", err)
+	}
+	return nil
+}
+
+// removeFallbackEndpoint deletes the profile's fallback endpoint; a missing one is not an error.
+// The upsert-only policy leaves it in place.
+func (p *TrafficManagerProvider) removeFallbackEndpoint(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig) error {
+	if !p.mayDelete() {
+		p.log(ctx).Info("Leaving fallback endpoint in place due to upsert-only policy",
+			zap.String("profileName", config.ProfileName))
+		return nil
+	}
+
+	p.log(ctx).Info("Removing Traffic Manager fallback endpoint",
+		zap.String("profileName", config.ProfileName))
+
+	err := tmClient.DeleteEndpoint(ctx, config.ResourceGroup, config.ProfileName, annotations.DefaultEndpointType, FallbackEndpointName)
+	if err != nil && !trafficmanager.IsNotFound(err) {
+		return fmt.Errorf("failed to delete fallback endpoint: %w", err)
+	}
+	metrics.FallbackActive.DeleteLabelValues(config.ProfileName)
+	return nil
+}
+
+// primaryEndpointCount returns the number of endpoints in a profile other than the fallback
+func primaryEndpointCount(profile *state.ProfileState) int {
+	count := 0
+	for name := range profile.Endpoints {
+		if name != FallbackEndpointName {
+			count++
+		}
+	}
+	return count
+}
+
+// desiredFallbackStatus returns the status the profile's fallback endpoint should have:
+// Enabled when no enabled primary endpoint is healthy, Disabled otherwise.
+// Endpoints still being checked count as healthy so the fallback doesn't flap on creation.
+func desiredFallbackStatus(profile *state.ProfileState) string {
+	for name, endpoint := range profile.Endpoints {
+		if name == FallbackEndpointName || endpoint.Status != "Enabled" {
+			continue
+		}
+		if endpoint.MonitorStatus != monitorStatusDegraded {
+			return "Disabled"
+		}
+	}
+	return "Enabled"
+}
+
+// CheckFallbacks refreshes the monitor status of every cached profile with a fallback endpoint
+// and enables or disables the fallback to match. It returns the number of fallbacks switched.
+func (p *TrafficManagerProvider) CheckFallbacks(ctx context.Context) (int, error) {
+	switched := 0
+	for _, cached := range p.stateManager.ListProfiles() {
+		if _, ok := cached.Endpoints[FallbackEndpointName]; !ok {
+			continue
+		}
+
+		tmClient, err := p.clientFor(subscriptionFromResourceID(cached.ResourceID), cached.ResourceGroup)
+		if err != nil {
+			return switched, err
+		}
+
+		// Monitor status changes without any apply, so the cache can't be trusted for it
+		profile, err := tmClient.GetProfileState(ctx, cached.ResourceGroup, cached.ProfileName)
+		if err != nil {
+			p.log(ctx).Warn("Failed to refresh profile for fallback check",
+				zap.String("profileName", cached.ProfileName),
+				zap.Error(err))
+			continue
+		}
+		profile.Hostname = cached.Hostname
+
+		fallback, ok := profile.Endpoints[FallbackEndpointName]
+		if !ok {
+			p.stateManager.SetProfile(profile.Hostname, profile)
+			continue
+		}
+
+		desired := desiredFallbackStatus(profile)
+		if fallback.Status != desired {
+			p.log(ctx).Warn("Switching Traffic Manager fallback endpoint",
+				zap.String("hostname", profile.Hostname),
+				zap.String("profileName", profile.ProfileName),
+				zap.String("target", fallback.Target),
+				zap.String("status", desired))
+
+			if err := tmClient.UpdateEndpointStatus(ctx, profile.ResourceGroup, profile.ProfileName, fallback.EndpointType, FallbackEndpointName, desired); err != nil {
+				p.log(ctx).Error("Failed to switch fallback endpoint",
+					zap.String("profileName", profile.ProfileName),
+					zap.Error(err))
+				continue
+			}
+			fallback.Status = desired
+			switched++
+		}
+
+		metrics.FallbackActive.WithLabelValues(profile.ProfileName).Set(boolToFloat(desired == "Enabled"))
+		p.stateManager.SetProfile(profile.Hostname, profile)
+	}
+
+	return switched, nil
+}
+
+// RunFallbackWatcher runs CheckFallbacks every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunFallbackWatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.CheckFallbacks(ctx); err != nil {
+				p.log(ctx).Error("Fallback check failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// subscriptionFromResourceID returns the subscription of an Azure resource ID, or "" if it has none
+func subscriptionFromResourceID(resourceID string) string {
+	parts := strings.Split(resourceID, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		if strings.EqualFold(parts[i], "subscriptions") {
+			return parts[i+1]
+		}
+	}
+	return ""
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallbackEndpointConfig(t *testing.T) {
+	endpointConfig := fallbackEndpointConfig(&annotations.TrafficManagerConfig{
+		FallbackTarget:   "status.example.com",
+		EndpointLocation: "eastus",
+		Weight:           500,
+		Priority:         1,
+	})
+
+	assert.Equal(t, FallbackEndpointName, endpointConfig.EndpointName)
+	assert.Equal(t, "status.example.com", endpointConfig.Target)
+	assert.Equal(t, int64(annotations.MinWeight), endpointConfig.Weight)
+	assert.Equal(t, int64(annotations.MaxPriority), endpointConfig.Priority)
+	assert.Equal(t, "Disabled", endpointConfig.Status)
+	assert.Equal(t, "eastus", endpointConfig.Location)
+}
+
+func TestDesiredFallbackStatus(t *testing.T) {
+	profile := func(endpoints ...*state.EndpointState) *state.ProfileState {
+		p := &state.ProfileState{Endpoints: map[string]*state.EndpointState{
+			FallbackEndpointName: {EndpointName: FallbackEndpointName, Status: "Disabled", MonitorStatus: "Disabled"},
+		}}
+		for _, endpoint := range endpoints {
+			p.Endpoints[endpoint.EndpointName] = endpoint
+		}
+		return p
+	}
+
+	assert.Equal(t, "Disabled", desiredFallbackStatus(profile(
+		&state.EndpointState{EndpointName: "east", Status: "Enabled", MonitorStatus: "Degraded"},
+		&state.EndpointState{EndpointName: "west", Status: "Enabled", MonitorStatus: "Online"},
+	)), "one primary is healthy")
+
+	assert.Equal(t, "Enabled", desiredFallbackStatus(profile(
+		&state.EndpointState{EndpointName: "east", Status: "Enabled", MonitorStatus: "Degraded"},
+		&state.EndpointState{EndpointName: "west", Status: "Enabled", MonitorStatus: "Degraded"},
+	)), "every primary is Degraded")
+
+	assert.Equal(t, "Enabled", desiredFallbackStatus(profile(
+		&state.EndpointState{EndpointName: "east", Status: "Enabled", MonitorStatus: "Degraded"},
+		&state.EndpointState{EndpointName: "west", Status: "Disabled", MonitorStatus: "Disabled"},
+	)), "disabled primaries don't serve traffic")
+
+	assert.Equal(t, "Disabled", desiredFallbackStatus(profile(
+		&state.EndpointState{EndpointName: "east", Status: "Enabled", MonitorStatus: "CheckingEndpoint"},
+	)), "endpoints still being checked count as healthy")
+}
+
+func TestPrimaryEndpointCount(t *testing.T) {
+	profile := &state.ProfileState{Endpoints: map[string]*state.EndpointState{
+		FallbackEndpointName: {},
+	}}
+	assert.Equal(t, 0, primaryEndpointCount(profile))
+
+	profile.Endpoints["east"] = &state.EndpointState{}
+	assert.Equal(t, 1, primaryEndpointCount(profile))
+}
+
+func TestSubscriptionFromResourceID(t *testing.T) {
+	assert.Equal(t, "00000000-0000-0000-0000-000000000001", subscriptionFromResourceID(
+		"/subscriptions/00000000-0000-0000-0000-000000000001/resourceGroups/tm-rg/providers/Microsoft.Network/trafficManagerProfiles/demo-tm"))
+	assert.Equal(t, "", subscriptionFromResourceID(""))
+}
+
+func TestUpdateEndpoint_RemoveFallback(t *testing.T) {
+	tests := []struct {
+		policy       string
+		wantFallback bool
+	}{
+		{policy: PolicySync, wantFallback: false},
+		{policy: PolicyUpsertOnly, wantFallback: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			ctx := context.Background()
+			azure := fakeazure.New()
+			p := newFakeAzureProvider(t, azure, "")
+			p.policy = tt.policy
+
+			old := managedRecord("app-east.example.com", "203.0.113.10", "east")
+			old.ProviderSpecific = append(old.ProviderSpecific,
+				ProviderSpecificProperty{Name: annotations.AnnotationFallbackTarget, Value: "status.example.com"})
+			require.NoError(t, p.ApplyChanges(ctx, &Changes{Create: []*Endpoint{old}}))
+
+			// The fallback annotation is removed
+			updated := managedRecord("app-east.example.com", "203.0.113.10", "east")
+			require.NoError(t, p.ApplyChanges(ctx, &Changes{UpdateOld: []*Endpoint{old}, UpdateNew: []*Endpoint{updated}}))
+
+			profile := azure.Profile("default-sub", "tm-rg", "app-tm")
+			require.NotNil(t, profile)
+			fallback := false
+			for _, endpoint := range profile.Properties.Endpoints {
+				fallback = fallback || *endpoint.Name == FallbackEndpointName
+			}
+			assert.Equal(t, tt.wantFallback, fallback)
+		})
+	}
+}
@@ -4,15 +4,24 @@ import (
 	"strings"
 )
 
-// matchesDomainFilter checks if a hostname matches the configured domain filter
+// matchesDomainFilter checks if a hostname matches the configured domain filter.
+// Hostnames under an excluded domain never match, even when an included domain covers them.
 func (p *TrafficManagerProvider) matchesDomainFilter(hostname string) bool {
+	for _, exclude := range p.DomainFilterExclude() {
+		if matchesDomain(hostname, exclude) {
+			return false
+		}
+	}
+
+	domainFilter := p.DomainFilter()
+
 	// If no domain filter configured, allow all
-	if len(p.domainFilter) == 0 {
+	if len(domainFilter) == 0 {
 		return true
 	}
 
 	// Check if hostname matches any of the filters
-	for _, filter := range p.domainFilter {
+	for _, filter := range domainFilter {
 		if matchesDomain(hostname, filter) {
 			return true
 		}
@@ -22,8 +31,14 @@ func (p *TrafficManagerProvider) matchesDomainFilter(hostname string) bool {
 }
 
 // matchesDomain checks if a hostname matches a domain filter pattern
-// Supports exact match and wildcard subdomain matching
+// Supports exact match and wildcard subdomain matching. A filter with no domain left once
+// its wildcard and dots are stripped ("", "*.", ".") matches nothing.
 func matchesDomain(hostname, filter string) bool {
+	domain := strings.TrimPrefix(filter, "*.")
+	if hostname == "" || strings.Trim(domain, ".") == "" {
+		return false
+	}
+
 	// Exact match
 	if hostname == filter {
 		return true
@@ -35,9 +50,8 @@ func matchesDomain(hostname, filter string) bool {
 	}
 
 	// Check if filter has wildcard prefix
-	if strings.HasPrefix(filter, "*.") {
-		suffix := filter[2:] // Remove "*."
-		if hostname == suffix || strings.HasSuffix(hostname, "."+suffix) {
+	if domain != filter {
+		if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
 			return true
 		}
 	}
@@ -0,0 +1,37 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+)
+
+// FuzzMatchesDomain checks that a domain filter only ever matches the filtered domain or its
+// subdomains. Run with: go test -fuzz FuzzMatchesDomain ./pkg/provider
+func FuzzMatchesDomain(f *testing.F) {
+	seeds := [][2]string{
+		{"app.example.com", "example.com"},
+		{"example.com", "*.example.com"},
+		{"notexample.com", "example.com"},
+		{"app.example.com.", ""},
+		{"app.example.com.", "*."},
+		{"app.example.com.", "."},
+		{"ünïcode.example.com", "example.com"},
+		{"app.example.com\x00.evil.com", "evil.com"},
+	}
+	for _, s := range seeds {
+		f.Add(s[0], s[1])
+	}
+
+	f.Fuzz(func(t *testing.T, hostname, filter string) {
+		if !matchesDomain(hostname, filter) {
+			return
+		}
+		domain := strings.TrimPrefix(filter, "*.")
+		if strings.Trim(domain, ".") == "" {
+			t.Fatalf("filter %q with no domain matched %q", filter, hostname)
+		}
+		if hostname != filter && hostname != domain && !strings.HasSuffix(hostname, "."+domain) {
+			t.Errorf("filter %q matched %q outside its domain", filter, hostname)
+		}
+	})
+}
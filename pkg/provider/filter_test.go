@@ -41,6 +41,23 @@ func TestMatchesDomainFilter_SubdomainMatch(t *testing.T) {
 	assert.False(t, p.matchesDomainFilter("notexample.com"))
 }
 
+func TestMatchesDomainFilter_Exclude(t *testing.T) {
+	p := &TrafficManagerProvider{
+		domainFilter:        []string{"example.com"},
+		domainFilterExclude: []string{"internal.example.com"},
+	}
+
+	assert.True(t, p.matchesDomainFilter("app.example.com"))
+	assert.False(t, p.matchesDomainFilter("internal.example.com"))
+	assert.False(t, p.matchesDomainFilter("app.internal.example.com"))
+	assert.True(t, p.matchesDomainFilter("notinternal.example.com"))
+
+	// Exclusions apply without an include list too
+	p.domainFilter = nil
+	assert.True(t, p.matchesDomainFilter("other.com"))
+	assert.False(t, p.matchesDomainFilter("app.internal.example.com"))
+}
+
 func TestMatchesDomainFilter_WildcardMatch(t *testing.T) {
 	p := &TrafficManagerProvider{
 		domainFilter: []string{"*.example.com"},
@@ -331,3 +348,11 @@ func TestGenerateEndpointName(t *testing.T) {
 		})
 	}
 }
+
+func TestMatchesDomain_NoDomainFilter(t *testing.T) {
+	// A filter with nothing left after its wildcard must not match every name ending in a dot
+	assert.False(t, matchesDomain("app.example.com.", ""))
+	assert.False(t, matchesDomain("app.example.com.", "*."))
+	assert.False(t, matchesDomain("app.example.com.", "."))
+	assert.False(t, matchesDomain("app.example.com..", ".."))
+}
@@ -0,0 +1,199 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"go.uber.org/zap"
+)
+
+// FreezeWindow is a weekly recurring period during which changes are deferred
+type FreezeWindow struct {
+	start int // Minutes since Sunday 00:00
+	end   int
+	spec  string
+}
+
+// String returns the window as it was configured
+func (w FreezeWindow) String() string {
+	return w.spec
+}
+
+// Contains reports whether t (already in the freeze time zone) falls inside the window
+func (w FreezeWindow) Contains(t time.Time) bool {
+	minute := int(t.Weekday())*24*60 + t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	// Window wraps past the end of the week (e.g. Fri 18:00-Mon 06:00)
+	return minute >= w.start || minute < w.end
+}
+
+// ParseFreezeWindows parses comma-separated windows such as "Fri 18:00-Mon 06:00,Wed 12:00-Wed 13:00"
+func ParseFreezeWindows(spec string) ([]FreezeWindow, error) {
+	var windows []FreezeWindow
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid freeze window %q, expected \"<day> HH:MM-<day> HH:MM\"", part)
+		}
+
+		start, err := parseWeekMinute(from)
+		if err != nil {
+			return nil, fmt.Errorf("invalid freeze window %q: %w", part, err)
+		}
+		end, err := parseWeekMinute(to)
+		if err != nil {
+			return nil, fmt.Errorf("invalid freeze window %q: %w", part, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("invalid freeze window %q: start and end are the same", part)
+		}
+
+		windows = append(windows, FreezeWindow{start: start, end: end, spec: part})
+	}
+	return windows, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseWeekMinute parses "<day> HH:MM" into minutes since Sunday 00:00
+func parseWeekMinute(value string) (int, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("expected \"<day> HH:MM\", got %q", strings.TrimSpace(value))
+	}
+
+	day, ok := weekdays[strings.ToLower(fields[0])]
+	if !ok {
+		return 0, fmt.Errorf("unknown day %q", fields[0])
+	}
+
+	clock, err := time.Parse("15:04", fields[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", fields[1])
+	}
+
+	return int(day)*24*60 + clock.Hour()*60 + clock.Minute(), nil
+}
+
+// FreezeStatus describes the current change freeze state
+type FreezeStatus struct {
+	Frozen      bool       `json:"frozen"`
+	Window      string     `json:"window,omitempty"`
+	Windows     []string   `json:"windows"`
+	BypassUntil *time.Time `json:"bypassUntil,omitempty"`
+}
+
+// FreezeStatus returns whether changes are currently deferred by a freeze window
+func (p *TrafficManagerProvider) FreezeStatus() FreezeStatus {
+	now := p.now()
+
+	status := FreezeStatus{Windows: make([]string, 0, len(p.freezeWindows))}
+	for _, window := range p.freezeWindows {
+		status.Windows = append(status.Windows, window.String())
+	}
+
+	p.freezeMu.Lock()
+	bypassUntil := p.freezeBypassUntil
+	p.freezeMu.Unlock()
+
+	if now.Before(bypassUntil) {
+		status.BypassUntil = &bypassUntil
+		return status
+	}
+
+	location := p.freezeLocation
+	if location == nil {
+		location = time.UTC
+	}
+
+	local := now.In(location)
+	for _, window := range p.freezeWindows {
+		if window.Contains(local) {
+			status.Frozen = true
+			status.Window = window.String()
+			break
+		}
+	}
+	return status
+}
+
+// SetFreezeBypass lets all changes through until the given time; a zero time ends the bypass
+func (p *TrafficManagerProvider) SetFreezeBypass(until time.Time) {
+	p.freezeMu.Lock()
+	defer p.freezeMu.Unlock()
+
+	p.freezeBypassUntil = until
+
+	p.logger.Info("Change freeze bypass updated",
+		zap.Time("bypassUntil", until))
+}
+
+// deferFrozenChanges returns the changes that may be applied now. During a freeze
+// window only endpoints with the freeze override annotation are kept; the rest are
+// left for External DNS to send again on a later sync once the window has ended.
+func (p *TrafficManagerProvider) deferFrozenChanges(changes *Changes) *Changes {
+	status := p.FreezeStatus()
+	if !status.Frozen {
+		return changes
+	}
+
+	allowed := &Changes{}
+	for _, endpoint := range changes.Create {
+		if hasFreezeOverride(endpoint) {
+			allowed.Create = append(allowed.Create, endpoint)
+		}
+	}
+	for i := range changes.UpdateOld {
+		if hasFreezeOverride(changes.UpdateNew[i]) {
+			allowed.UpdateOld = append(allowed.UpdateOld, changes.UpdateOld[i])
+			allowed.UpdateNew = append(allowed.UpdateNew, changes.UpdateNew[i])
+		}
+	}
+	for _, endpoint := range changes.Delete {
+		if hasFreezeOverride(endpoint) {
+			allowed.Delete = append(allowed.Delete, endpoint)
+		}
+	}
+
+	deferred := len(changes.Create) + len(changes.UpdateNew) + len(changes.Delete) -
+		len(allowed.Create) - len(allowed.UpdateNew) - len(allowed.Delete)
+	if deferred > 0 {
+		p.logger.Info("Deferring changes during freeze window",
+			zap.String("window", status.Window),
+			zap.Int("deferred", deferred))
+	}
+
+	return allowed
+}
+
+// hasFreezeOverride reports whether an endpoint is marked as an emergency change
+func hasFreezeOverride(endpoint *Endpoint) bool {
+	override, _ := strconv.ParseBool(endpoint.annotationMap()[annotations.AnnotationFreezeOverride])
+	return override
+}
+
+// now returns the current time, overridable in tests
+func (p *TrafficManagerProvider) now() time.Time {
+	if p.clock != nil {
+		return p.clock()
+	}
+	return time.Now()
+}
@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestParseFreezeWindows(t *testing.T) {
+	windows, err := ParseFreezeWindows("Fri 18:00-Mon 06:00, wednesday 12:00-wed 13:30")
+	require.NoError(t, err)
+	require.Len(t, windows, 2)
+	assert.Equal(t, "Fri 18:00-Mon 06:00", windows[0].String())
+
+	windows, err = ParseFreezeWindows("")
+	require.NoError(t, err)
+	assert.Empty(t, windows)
+
+	for _, spec := range []string{"Fri 18:00", "Fri 18:00-Someday 06:00", "Fri 25:00-Mon 06:00", "Mon 06:00-Mon 06:00"} {
+		_, err := ParseFreezeWindows(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestFreezeWindow_Contains(t *testing.T) {
+	windows, err := ParseFreezeWindows("Fri 18:00-Mon 06:00,Wed 12:00-Wed 13:00")
+	require.NoError(t, err)
+	weekend, midweek := windows[0], windows[1]
+
+	// 2026-10-16 is a Friday
+	assert.False(t, weekend.Contains(time.Date(2026, 10, 16, 17, 59, 0, 0, time.UTC)))
+	assert.True(t, weekend.Contains(time.Date(2026, 10, 16, 18, 0, 0, 0, time.UTC)))
+	assert.True(t, weekend.Contains(time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)))
+	assert.True(t, weekend.Contains(time.Date(2026, 10, 19, 5, 59, 0, 0, time.UTC)))
+	assert.False(t, weekend.Contains(time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC)))
+
+	assert.True(t, midweek.Contains(time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC)))
+	assert.False(t, midweek.Contains(time.Date(2026, 10, 14, 13, 0, 0, 0, time.UTC)))
+}
+
+func newFreezeProvider(t *testing.T, now time.Time) *TrafficManagerProvider {
+	windows, err := ParseFreezeWindows("Fri 18:00-Mon 06:00")
+	require.NoError(t, err)
+	return &TrafficManagerProvider{
+		logger:         zaptest.NewLogger(t),
+		freezeWindows:  windows,
+		freezeLocation: time.UTC,
+		clock:          func() time.Time { return now },
+	}
+}
+
+func TestDeferFrozenChanges(t *testing.T) {
+	p := newFreezeProvider(t, time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+
+	emergency := &Endpoint{
+		DNSName:          "emergency.example.com",
+		ProviderSpecific: []ProviderSpecificProperty{{Name: annotations.AnnotationFreezeOverride, Value: "true"}},
+	}
+	routine := &Endpoint{DNSName: "routine.example.com"}
+
+	changes := &Changes{
+		Create:    []*Endpoint{routine, emergency},
+		UpdateOld: []*Endpoint{routine},
+		UpdateNew: []*Endpoint{routine},
+		Delete:    []*Endpoint{routine},
+	}
+
+	allowed := p.deferFrozenChanges(changes)
+	assert.Equal(t, []*Endpoint{emergency}, allowed.Create)
+	assert.Empty(t, allowed.UpdateOld)
+	assert.Empty(t, allowed.UpdateNew)
+	assert.Empty(t, allowed.Delete)
+
+	// The caller's changes are untouched
+	assert.Len(t, changes.Create, 2)
+
+	// Admin bypass lets everything through
+	p.SetFreezeBypass(p.now().Add(time.Hour))
+	assert.Same(t, changes, p.deferFrozenChanges(changes))
+}
+
+func TestHandleFreeze(t *testing.T) {
+	p := newFreezeProvider(t, time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC))
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleFreeze(rec, httptest.NewRequest(http.MethodGet, "/freeze", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"frozen":true`)
+
+	rec = httptest.NewRecorder()
+	s.HandleFreeze(rec, httptest.NewRequest(http.MethodPut, "/freeze", strings.NewReader(`{"bypassFor":"2h"}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"frozen":false`)
+	assert.Contains(t, rec.Body.String(), `"bypassUntil":"2026-10-17T12:00:00Z"`)
+
+	rec = httptest.NewRecorder()
+	s.HandleFreeze(rec, httptest.NewRequest(http.MethodDelete, "/freeze", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"frozen":true`)
+
+	rec = httptest.NewRecorder()
+	s.HandleFreeze(rec, httptest.NewRequest(http.MethodPut, "/freeze", strings.NewReader(`{"bypassFor":"soon"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// GarbageCollectDNSEndpoints removes managed DNSEndpoints whose Traffic Manager profile no longer exists.
+// It returns the number of DNSEndpoints deleted.
+func (p *TrafficManagerProvider) GarbageCollectDNSEndpoints(ctx context.Context) (int, error) {
+	if p.dnsEndpointManager == nil {
+		return 0, nil
+	}
+
+	managed, err := p.dnsEndpointManager.ListManaged(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, endpoint := range managed {
+		// DNSEndpoints created before profile annotations were recorded can't be checked safely
+		if endpoint.ProfileName == "" || endpoint.ResourceGroup == "" {
+			p.log(ctx).Debug("Skipping DNSEndpoint without profile annotations",
+				zap.String("name", endpoint.Name),
+				zap.String("hostname", endpoint.Hostname))
+			continue
+		}
+
+		tmClient, err := p.clientFor(endpoint.SubscriptionID, endpoint.ResourceGroup)
+		if err != nil {
+			p.log(ctx).Warn("Failed to get client for DNSEndpoint subscription",
+				zap.String("name", endpoint.Name),
+				zap.String("subscriptionID", endpoint.SubscriptionID),
+				zap.Error(err))
+			continue
+		}
+
+		_, err = tmClient.GetProfile(ctx, endpoint.ResourceGroup, endpoint.ProfileName)
+		if err == nil {
+			continue
+		}
+		if !trafficmanager.IsNotFound(err) {
+			// Only delete on a definitive not-found; transient errors are retried next pass
+			p.log(ctx).Warn("Failed to check profile for DNSEndpoint",
+				zap.String("name", endpoint.Name),
+				zap.String("profileName", endpoint.ProfileName),
+				zap.Error(err))
+			continue
+		}
+
+		p.log(ctx).Info("Deleting stale DNSEndpoint for missing Traffic Manager profile",
+			zap.String("name", endpoint.Name),
+			zap.String("hostname", endpoint.Hostname),
+			zap.String("profileName", endpoint.ProfileName),
+			zap.String("resourceGroup", endpoint.ResourceGroup))
+
+		if err := p.dnsEndpointManager.Delete(ctx, endpoint.Name); err != nil {
+			p.log(ctx).Warn("Failed to delete stale DNSEndpoint",
+				zap.String("name", endpoint.Name),
+				zap.Error(err))
+			continue
+		}
+		deleted++
+	}
+
+	p.log(ctx).Info("DNSEndpoint garbage collection complete",
+		zap.Int("managed", len(managed)),
+		zap.Int("deleted", deleted))
+
+	return deleted, nil
+}
+
+// RunDNSEndpointGC runs GarbageCollectDNSEndpoints every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunDNSEndpointGC(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.GarbageCollectDNSEndpoints(ctx); err != nil {
+				p.log(ctx).Error("DNSEndpoint garbage collection failed", zap.Error(err))
+			}
+		}
+	}
+}
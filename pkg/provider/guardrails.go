@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// guardWeightChange enforces the maximum weight change per apply.
+// The change is measured against the endpoint's current weight (from cached state when
+// available, otherwise the previous annotation value). Larger changes are clamped or
+// rejected depending on the configured action, unless allowLarge is set.
+func (p *TrafficManagerProvider) guardWeightChange(hostname, endpointName string, previousWeight, desiredWeight int64, allowLarge bool) (int64, error) {
+	if p.maxWeightChangePercent <= 0 || allowLarge {
+		return desiredWeight, nil
+	}
+
+	currentWeight := previousWeight
+	if existing, ok := p.stateManager.GetEndpoint(hostname, endpointName); ok && existing.Weight > 0 {
+		currentWeight = existing.Weight
+	}
+	if currentWeight <= 0 {
+		return desiredWeight, nil
+	}
+
+	maxDelta := maxWeightDelta(currentWeight, p.maxWeightChangePercent)
+	delta := desiredWeight - currentWeight
+	if delta >= -maxDelta && delta <= maxDelta {
+		return desiredWeight, nil
+	}
+
+	if p.weightChangeAction == WeightChangeActionReject {
+		return 0, withCode(ErrorCodeWeightChangeRejected, fmt.Errorf("weight change for endpoint %s from %d to %d exceeds the maximum of %d%% per apply; set the allow-large-weight-change annotation to override",
+			endpointName, currentWeight, desiredWeight, p.maxWeightChangePercent))
+	}
+
+	clamped := currentWeight + maxDelta
+	if delta < 0 {
+		clamped = currentWeight - maxDelta
+	}
+
+	p.logger.Warn("Clamping weight change that exceeds the maximum per apply",
+		zap.String("endpointName", endpointName),
+		zap.Int64("currentWeight", currentWeight),
+		zap.Int64("desiredWeight", desiredWeight),
+		zap.Int64("appliedWeight", clamped),
+		zap.Int("maxWeightChangePercent", p.maxWeightChangePercent))
+
+	return clamped, nil
+}
+
+// maxWeightDelta returns the largest allowed change from weight, always allowing at least 1
+func maxWeightDelta(weight int64, percent int) int64 {
+	delta := weight * int64(percent) / 100
+	if delta < 1 {
+		delta = 1
+	}
+	return delta
+}
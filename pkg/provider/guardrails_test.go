@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newGuardrailProvider(t *testing.T, percent int, action string) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	return &TrafficManagerProvider{
+		logger:                 logger,
+		stateManager:           state.NewManager(5*time.Minute, logger),
+		maxWeightChangePercent: percent,
+		weightChangeAction:     action,
+	}
+}
+
+func TestGuardWeightChange_Clamp(t *testing.T) {
+	p := newGuardrailProvider(t, 20, WeightChangeActionClamp)
+
+	tests := []struct {
+		name     string
+		previous int64
+		desired  int64
+		expected int64
+	}{
+		{"within limit", 100, 115, 115},
+		{"increase clamped", 100, 1000, 120},
+		{"decrease clamped", 100, 1, 80},
+		{"small weight moves by at least one", 2, 50, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weight, err := p.guardWeightChange("demo.example.com", "east", tt.previous, tt.desired, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, weight)
+		})
+	}
+}
+
+func TestGuardWeightChange_Reject(t *testing.T) {
+	p := newGuardrailProvider(t, 20, WeightChangeActionReject)
+
+	_, err := p.guardWeightChange("demo.example.com", "east", 100, 500, false)
+	assert.ErrorContains(t, err, "exceeds the maximum of 20%")
+
+	weight, err := p.guardWeightChange("demo.example.com", "east", 100, 500, true)
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), weight)
+}
+
+func TestGuardWeightChange_UsesCachedWeight(t *testing.T) {
+	p := newGuardrailProvider(t, 50, WeightChangeActionClamp)
+	p.stateManager.SetProfile("demo.example.com", &state.ProfileState{
+		Hostname: "demo.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"east": {EndpointName: "east", Weight: 10},
+		},
+	})
+
+	// The annotation said 100 but Azure currently has 10, so the step is measured from 10
+	weight, err := p.guardWeightChange("demo.example.com", "east", 100, 200, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15), weight)
+}
+
+func TestGuardWeightChange_Disabled(t *testing.T) {
+	p := newGuardrailProvider(t, 0, WeightChangeActionReject)
+
+	weight, err := p.guardWeightChange("demo.example.com", "east", 1, 1000, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), weight)
+}
@@ -0,0 +1,229 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// HandoffRequest is the body accepted by POST /handoff
+type HandoffRequest struct {
+	FromCluster string   `json:"fromCluster"`         // Cluster recorded on the endpoints today; empty matches endpoints recorded without a cluster name
+	ToCluster   string   `json:"toCluster"`           // Cluster to record instead
+	Hostnames   []string `json:"hostnames,omitempty"` // Limits the handoff to these vanity hostnames; empty hands off every profile
+	DryRun      bool     `json:"dryRun"`
+}
+
+// HandoffChange is an endpoint whose recorded cluster is, or would be, changed by a handoff
+type HandoffChange struct {
+	Hostname     string `json:"hostname"`
+	ProfileName  string `json:"profileName"`
+	EndpointName string `json:"endpointName"`
+}
+
+// HandoffResult reports the outcome of a handoff. Failed lists profiles that couldn't be updated.
+type HandoffResult struct {
+	FromCluster string          `json:"fromCluster"`
+	ToCluster   string          `json:"toCluster"`
+	DryRun      bool            `json:"dryRun"`
+	Changes     []HandoffChange `json:"changes"`
+	Failed      []string        `json:"failed,omitempty"`
+}
+
+// Handoff re-records the managed endpoints created by one cluster as created by another, so DNS
+// management can move between clusters without deleting and recreating the globally unique profiles.
+// Endpoints are found from the state cache; only the endpoint metadata tag is rewritten.
+func (p *TrafficManagerProvider) Handoff(ctx context.Context, req HandoffRequest) (*HandoffResult, error) {
+	if req.ToCluster == "" {
+		return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("toCluster is required"))
+	}
+	if req.FromCluster == req.ToCluster {
+		return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("fromCluster and toCluster must differ, both are %q", req.ToCluster))
+	}
+
+	hostnames := make(map[string]bool, len(req.Hostnames))
+	for _, hostname := range req.Hostnames {
+		hostnames[hostname] = true
+	}
+
+	result := &HandoffResult{
+		FromCluster: req.FromCluster,
+		ToCluster:   req.ToCluster,
+		DryRun:      req.DryRun,
+		Changes:     []HandoffChange{},
+	}
+
+	profiles := p.stateManager.ListProfiles()
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Hostname < profiles[j].Hostname })
+
+	for _, profile := range profiles {
+		if len(hostnames) > 0 && !hostnames[profile.Hostname] {
+			continue
+		}
+
+		var endpointNames []string
+		for name, endpoint := range profile.Endpoints {
+			if endpoint.Metadata != nil && endpoint.Metadata.Cluster == req.FromCluster {
+				endpointNames = append(endpointNames, name)
+			}
+		}
+		if len(endpointNames) == 0 {
+			continue
+		}
+		sort.Strings(endpointNames)
+
+		if !req.DryRun {
+			tmClient, err := p.clientFor(subscriptionFromResourceID(profile.ResourceID), profile.ResourceGroup)
+			if err != nil {
+				return nil, err
+			}
+
+			// The tag is re-read from Azure so entries written since the last sync are handed off too
+			endpointNames, err = tmClient.ReassignEndpointMetadata(ctx, profile.ResourceGroup, profile.ProfileName, req.FromCluster, req.ToCluster)
+			if err != nil {
+				p.log(ctx).Error("Failed to hand off profile",
+					zap.String("profileName", profile.ProfileName),
+					zap.Error(err))
+				result.Failed = append(result.Failed, profile.ProfileName)
+				continue
+			}
+
+			for _, name := range endpointNames {
+				if endpoint, ok := profile.Endpoints[name]; ok && endpoint.Metadata != nil {
+					endpoint.Metadata.Cluster = req.ToCluster
+				}
+			}
+			p.stateManager.SetProfile(profile.Hostname, profile)
+		}
+
+		for _, name := range endpointNames {
+			result.Changes = append(result.Changes, HandoffChange{
+				Hostname:     profile.Hostname,
+				ProfileName:  profile.ProfileName,
+				EndpointName: name,
+			})
+		}
+	}
+
+	p.log(ctx).Info("Handed off Traffic Manager endpoints",
+		zap.String("fromCluster", req.FromCluster),
+		zap.String("toCluster", req.ToCluster),
+		zap.Bool("dryRun", req.DryRun),
+		zap.Int("endpointCount", len(result.Changes)),
+		zap.Int("failedProfiles", len(result.Failed)))
+
+	return result, nil
+}
+
+// unknownCluster stands for the owner of an endpoint whose creating cluster isn't recorded
+const unknownCluster = "unknown"
+
+// ownedByOtherCluster reports whether a cached endpoint is recorded as created by a different cluster,
+// for example after its management was handed off. Without a cluster name every endpoint is ours.
+// With one, a cached endpoint whose cluster isn't recorded isn't ours either, as its metadata may
+// have been lost; its owner is reported as unknownCluster. An endpoint that isn't cached is
+// reported as ours; endpointOwnedByOtherCluster reads it from Azure instead.
+func (p *TrafficManagerProvider) ownedByOtherCluster(hostname, endpointName string) (string, bool) {
+	if p.clusterName == "" {
+		return "", false
+	}
+	endpoint, ok := p.stateManager.GetEndpoint(hostname, endpointName)
+	if !ok {
+		return "", false
+	}
+	return endpointOwner(endpoint, p.clusterName)
+}
+
+// endpointOwnedByOtherCluster is ownedByOtherCluster for an endpoint that may not be cached, such as
+// one past the cache TTL, evicted, or looked up just after a restart. Its profile is then read from
+// Azure and cached. An endpoint, or profile, that doesn't exist in Azure is reported as ours.
+func (p *TrafficManagerProvider) endpointOwnedByOtherCluster(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, hostname string) (string, bool, error) {
+	if p.clusterName == "" {
+		return "", false, nil
+	}
+	if endpoint, ok := p.stateManager.GetEndpoint(hostname, config.EndpointName); ok {
+		owner, other := endpointOwner(endpoint, p.clusterName)
+		return owner, other, nil
+	}
+
+	profile, err := tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
+	if trafficmanager.IsNotFound(err) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read the owner of endpoint %s: %w", config.EndpointName, err)
+	}
+	profile.Hostname = hostname
+	p.stateManager.SetProfile(hostname, profile)
+
+	endpoint, ok := profile.Endpoints[config.EndpointName]
+	if !ok {
+		return "", false, nil
+	}
+	owner, other := endpointOwner(endpoint, p.clusterName)
+	return owner, other, nil
+}
+
+// endpointOwner returns the cluster recorded on an endpoint, or unknownCluster, and whether it isn't cluster
+func endpointOwner(endpoint *state.EndpointState, cluster string) (string, bool) {
+	if endpoint.Metadata == nil || endpoint.Metadata.Cluster == "" {
+		return unknownCluster, true
+	}
+	return endpoint.Metadata.Cluster, endpoint.Metadata.Cluster != cluster
+}
+
+// foreignEndpoints returns the names of a profile's endpoints not recorded as created by cluster,
+// sorted. The fallback endpoint belongs to the profile rather than a cluster. Without a cluster
+// name no endpoint is foreign.
+func foreignEndpoints(profile *state.ProfileState, cluster string) []string {
+	if cluster == "" {
+		return nil
+	}
+	var names []string
+	for name, endpoint := range profile.Endpoints {
+		if name == FallbackEndpointName {
+			continue
+		}
+		if endpoint.Metadata == nil || endpoint.Metadata.Cluster != cluster {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sharedProfile reports whether a profile already has endpoints created by other clusters. Its
+// profile-level settings then belong to whichever cluster created it, so they aren't rewritten,
+// and settings the annotations ask for that differ are reported as a conflict.
+// A profile that can't be read is treated as not shared.
+func (p *TrafficManagerProvider) sharedProfile(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig) bool {
+	if p.clusterName == "" {
+		return false
+	}
+	profile, err := tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
+	if err != nil {
+		return false
+	}
+	foreign := foreignEndpoints(profile, p.clusterName)
+	if len(foreign) == 0 {
+		return false
+	}
+
+	if profile.RoutingMethod != config.RoutingMethod || profile.DNSTTL != config.DNSTTL {
+		p.log(ctx).Warn("Traffic Manager profile settings conflict with another cluster's, keeping the existing settings",
+			zap.String("profileName", config.ProfileName),
+			zap.String("routingMethod", profile.RoutingMethod),
+			zap.String("requestedRoutingMethod", config.RoutingMethod),
+			zap.Int64("dnsTTL", profile.DNSTTL),
+			zap.Int64("requestedDNSTTL", config.DNSTTL),
+			zap.Strings("otherClusterEndpoints", foreign))
+		metrics.ProfileSettingConflicts.WithLabelValues(config.ProfileName).Inc()
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newHandoffProvider(t *testing.T) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		clusterName:  "aks-east",
+		stateManager: state.NewManager(5*time.Minute, logger),
+	}
+
+	p.stateManager.SetProfile("app.example.com", &state.ProfileState{
+		ProfileName: "app-example-com",
+		Hostname:    "app.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"east": {EndpointName: "east", Metadata: &state.EndpointMetadata{Cluster: "aks-east"}},
+			"west": {EndpointName: "west", Metadata: &state.EndpointMetadata{Cluster: "aks-west"}},
+		},
+	})
+	p.stateManager.SetProfile("api.example.com", &state.ProfileState{
+		ProfileName: "api-example-com",
+		Hostname:    "api.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"east":   {EndpointName: "east", Metadata: &state.EndpointMetadata{Cluster: "aks-east"}},
+			"legacy": {EndpointName: "legacy"},
+		},
+	})
+	return p
+}
+
+func TestHandoff_DryRun(t *testing.T) {
+	p := newHandoffProvider(t)
+
+	result, err := p.Handoff(context.Background(), HandoffRequest{FromCluster: "aks-east", ToCluster: "aks-east-2", DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, []HandoffChange{
+		{Hostname: "api.example.com", ProfileName: "api-example-com", EndpointName: "east"},
+		{Hostname: "app.example.com", ProfileName: "app-example-com", EndpointName: "east"},
+	}, result.Changes)
+
+	// Nothing is changed by a dry run
+	endpoint, ok := p.stateManager.GetEndpoint("app.example.com", "east")
+	require.True(t, ok)
+	assert.Equal(t, "aks-east", endpoint.Metadata.Cluster)
+}
+
+func TestHandoff_Hostnames(t *testing.T) {
+	p := newHandoffProvider(t)
+
+	result, err := p.Handoff(context.Background(), HandoffRequest{
+		FromCluster: "aks-east",
+		ToCluster:   "aks-east-2",
+		Hostnames:   []string{"app.example.com"},
+		DryRun:      true,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Changes, 1)
+	assert.Equal(t, "app-example-com", result.Changes[0].ProfileName)
+
+	// Endpoints without metadata have no cluster, so they don't match an empty fromCluster either
+	result, err = p.Handoff(context.Background(), HandoffRequest{ToCluster: "aks-east-2", DryRun: true})
+	require.NoError(t, err)
+	assert.Empty(t, result.Changes)
+}
+
+func TestHandoff_Invalid(t *testing.T) {
+	p := newHandoffProvider(t)
+
+	_, err := p.Handoff(context.Background(), HandoffRequest{FromCluster: "aks-east"})
+	assert.ErrorContains(t, err, "toCluster is required")
+	assert.Equal(t, ErrorCodeInvalidRequest, errorCode(err))
+
+	_, err = p.Handoff(context.Background(), HandoffRequest{FromCluster: "aks-east", ToCluster: "aks-east"})
+	assert.ErrorContains(t, err, "must differ")
+}
+
+func TestOwnedByOtherCluster(t *testing.T) {
+	p := newHandoffProvider(t)
+
+	owner, other := p.ownedByOtherCluster("app.example.com", "west")
+	assert.True(t, other)
+	assert.Equal(t, "aks-west", owner)
+
+	_, other = p.ownedByOtherCluster("app.example.com", "east")
+	assert.False(t, other)
+	owner, other = p.ownedByOtherCluster("api.example.com", "legacy")
+	assert.True(t, other, "endpoints without a recorded cluster aren't ours")
+	assert.Equal(t, unknownCluster, owner)
+	_, other = p.ownedByOtherCluster("app.example.com", "missing")
+	assert.False(t, other, "endpoints that aren't cached are read from Azure before deleting")
+
+	p.clusterName = ""
+	_, other = p.ownedByOtherCluster("api.example.com", "legacy")
+	assert.False(t, other)
+	_, other = p.ownedByOtherCluster("app.example.com", "west")
+	assert.False(t, other, "without a cluster name every endpoint is ours")
+}
+
+func TestForeignEndpoints(t *testing.T) {
+	profile := &state.ProfileState{Endpoints: map[string]*state.EndpointState{
+		"east":   {Metadata: &state.EndpointMetadata{Cluster: "aks-east"}},
+		"west":   {Metadata: &state.EndpointMetadata{Cluster: "aks-west"}},
+		"north":  {Metadata: &state.EndpointMetadata{Cluster: "aks-north"}},
+		"legacy": {},
+
+		FallbackEndpointName: {},
+	}}
+
+	assert.Equal(t, []string{"legacy", "north", "west"}, foreignEndpoints(profile, "aks-east"))
+	assert.Empty(t, foreignEndpoints(profile, ""), "without a cluster name no endpoint is foreign")
+}
+
+func TestHandleHandoff(t *testing.T) {
+	s := NewWebhookServer(newHandoffProvider(t), zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleHandoff(rec, httptest.NewRequest(http.MethodPost, "/handoff",
+		strings.NewReader(`{"fromCluster":"aks-east","toCluster":"aks-east-2","dryRun":true}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"endpointName":"east"`)
+
+	rec = httptest.NewRecorder()
+	s.HandleHandoff(rec, httptest.NewRequest(http.MethodPost, "/handoff", strings.NewReader(`{"fromCluster":"aks-east"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.HandleHandoff(rec, httptest.NewRequest(http.MethodGet, "/handoff", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+// newFakeAzureProvider returns a provider for cluster backed by azure
+func newFakeAzureProvider(t *testing.T, azure *fakeazure.Server, cluster string) *TrafficManagerProvider {
+	p, err := NewTrafficManagerProvider(&Config{
+		SubscriptionID: "default-sub",
+		Credential:     fakeazure.Credential{},
+		ClientOptions:  trafficmanager.ClientOptions{Transport: azure},
+		ResourceGroups: []string{"tm-rg"},
+		ClusterName:    cluster,
+	}, nil, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	return p
+}
+
+func managedRecord(dnsName, target, endpointName string) *Endpoint {
+	return &Endpoint{
+		DNSName:    dnsName,
+		Targets:    []string{target},
+		RecordType: "A",
+		ProviderSpecific: []ProviderSpecificProperty{
+			{Name: annotations.AnnotationEnabled, Value: "true"},
+			{Name: annotations.AnnotationHostname, Value: "app.example.com"},
+			{Name: annotations.AnnotationProfileName, Value: "app-tm"},
+			{Name: annotations.AnnotationResourceGroup, Value: "tm-rg"},
+			{Name: annotations.AnnotationEndpointName, Value: endpointName},
+			{Name: annotations.AnnotationEndpointLocation, Value: "westeurope"},
+			{Name: annotations.AnnotationVanityRecordType, Value: annotations.VanityRecordTypeNone},
+		},
+	}
+}
+
+func TestDeleteEndpoint_AfterCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	azure := fakeazure.New()
+	east := newFakeAzureProvider(t, azure, "aks-east")
+	west := newFakeAzureProvider(t, azure, "aks-west")
+
+	eastRecord := managedRecord("app-east.example.com", "203.0.113.10", "east")
+	westRecord := managedRecord("app-west.example.com", "203.0.113.20", "west")
+	require.NoError(t, east.ApplyChanges(ctx, &Changes{Create: []*Endpoint{eastRecord}}))
+	require.NoError(t, west.ApplyChanges(ctx, &Changes{Create: []*Endpoint{westRecord}}))
+
+	// As after STATE_CACHE_TTL, an eviction or a restart
+	east.stateManager.Clear()
+
+	// The other cluster's endpoint is read from Azure and left alone
+	require.NoError(t, east.ApplyChanges(ctx, &Changes{Delete: []*Endpoint{westRecord}}))
+	profile := azure.Profile("default-sub", "tm-rg", "app-tm")
+	require.NotNil(t, profile)
+	assert.Len(t, profile.Properties.Endpoints, 2)
+
+	east.stateManager.Clear()
+	require.NoError(t, east.ApplyChanges(ctx, &Changes{Delete: []*Endpoint{eastRecord}}))
+	profile = azure.Profile("default-sub", "tm-rg", "app-tm")
+	require.NotNil(t, profile)
+	require.Len(t, profile.Properties.Endpoints, 1)
+	assert.Equal(t, "west", *profile.Properties.Endpoints[0].Name)
+}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// syncStaleAfter is how long without a successful sync before the cache is reported stale
+	syncStaleAfter = 10 * time.Minute
+
+	// dependencyCheckTimeout bounds each dependency check of a verbose health check
+	dependencyCheckTimeout = 5 * time.Second
+)
+
+// Dependency statuses in a verbose health check
+const (
+	DependencyOK       = "ok"
+	DependencyFailed   = "failed"
+	DependencyStale    = "stale"
+	DependencyDisabled = "disabled"
+)
+
+// DependencyHealth is the status of one dependency of the webhook
+type DependencyHealth struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// CheckDependencies checks the Azure credential, Azure Resource Manager, the Kubernetes API and
+// the freshness of the state cache, and reports the last permission probe. Credential and ARM
+// results are shared with CheckReadiness, so this doesn't call Azure more often than readiness probes do.
+func (p *TrafficManagerProvider) CheckDependencies(ctx context.Context) []DependencyHealth {
+	dependencies := []DependencyHealth{
+		p.checkDependency(ctx, "azureCredential", p.checkCredential),
+		p.checkDependency(ctx, "azureResourceManager", p.checkARM),
+	}
+
+	ping := p.readiness.kubernetesPing
+	if ping == nil && p.dnsEndpointManager != nil {
+		ping = p.dnsEndpointManager.Ping
+	}
+	if ping == nil {
+		dependencies = append(dependencies, DependencyHealth{
+			Name:   "kubernetesAPI",
+			Status: DependencyDisabled,
+			Detail: "DNSEndpoint management is not configured",
+		})
+	} else {
+		dependencies = append(dependencies, p.checkDependency(ctx, "kubernetesAPI", ping))
+	}
+
+	return append(dependencies, p.cacheHealth(), p.permissionsHealth())
+}
+
+// checkDependency runs check within dependencyCheckTimeout and reports its outcome
+func (p *TrafficManagerProvider) checkDependency(ctx context.Context, name string, check func(context.Context) error) DependencyHealth {
+	ctx, cancel := context.WithTimeout(ctx, dependencyCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	health := DependencyHealth{Name: name, Status: DependencyOK}
+	if err := check(ctx); err != nil {
+		health.Status = DependencyFailed
+		health.Error = err.Error()
+	}
+	health.Duration = time.Since(start).Round(time.Millisecond).String()
+	return health
+}
+
+// cacheHealth reports the cache stale when profiles haven't been synced from Azure for syncStaleAfter
+func (p *TrafficManagerProvider) cacheHealth() DependencyHealth {
+	freshness := p.freshness()
+	health := DependencyHealth{
+		Name:   "stateCache",
+		Status: DependencyOK,
+		Detail: fmt.Sprintf("%d profiles cached, %d expired, last successful sync %s ago",
+			len(freshness.CacheAges), freshness.ExpiredEntries, freshness.SinceSync.Round(time.Second)),
+	}
+	if freshness.SinceSync > syncStaleAfter {
+		health.Status = DependencyStale
+	}
+	return health
+}
@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var nodeGVR = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+
+// nodeRegionLabels are the labels Kubernetes puts a node's region in, current one first
+var nodeRegionLabels = []string{"topology.kubernetes.io/region", "failure-domain.beta.kubernetes.io/region"}
+
+// imdsLocationURL asks the Azure Instance Metadata Service for the region of the VM it runs on
+var imdsLocationURL = "http://169.254.169.254/metadata/instance/compute/location?api-version=2021-02-01&format=text"
+
+const (
+	// locationDetectionTimeout bounds region detection at startup, which blocks outside Azure until IMDS times out
+	locationDetectionTimeout = 5 * time.Second
+
+	// locationDetectionNodes is how many nodes are checked for a region label
+	locationDetectionNodes = 10
+)
+
+// detectClusterLocation returns the Azure region the cluster runs in, from its nodes' region
+// labels or, when they can't be read, from IMDS. Pod networks may block IMDS, so the labels come first.
+func detectClusterLocation(ctx context.Context, client dynamic.Interface, httpClient *http.Client) (string, error) {
+	var errs []error
+	if client != nil {
+		location, err := nodeRegion(ctx, client)
+		if err == nil {
+			return location, nil
+		}
+		errs = append(errs, err)
+	}
+
+	location, err := imdsLocation(ctx, httpClient)
+	if err == nil {
+		return location, nil
+	}
+	return "", errors.Join(append(errs, err)...)
+}
+
+// nodeRegion returns the region label of the first labelled node
+func nodeRegion(ctx context.Context, client dynamic.Interface) (string, error) {
+	nodes, err := client.Resource(nodeGVR).List(ctx, metav1.ListOptions{Limit: locationDetectionNodes})
+	if err != nil {
+		return "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	for _, node := range nodes.Items {
+		labels := node.GetLabels()
+		for _, label := range nodeRegionLabels {
+			if region := labels[label]; region != "" {
+				return region, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no node has a %s label", nodeRegionLabels[0])
+}
+
+// imdsLocation returns the region IMDS reports for this VM
+func imdsLocation(ctx context.Context, httpClient *http.Client) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsLocationURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to query instance metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", fmt.Errorf("failed to read instance metadata: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("instance metadata returned %s", resp.Status)
+	}
+	location := strings.TrimSpace(string(body))
+	if location == "" {
+		return "", fmt.Errorf("instance metadata returned no location")
+	}
+	return location, nil
+}
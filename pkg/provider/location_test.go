@@ -0,0 +1,105 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestNode(name string, labels map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Node",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": labels,
+		},
+	}}
+}
+
+func newNodeClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{nodeGVR: "NodeList"}, objects...)
+}
+
+// serveIMDS points imdsLocationURL at a test server answering with location, or status if not 200
+func serveIMDS(t *testing.T, status int, location string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		w.WriteHeader(status)
+		w.Write([]byte(location + "\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	original := imdsLocationURL
+	imdsLocationURL = server.URL
+	t.Cleanup(func() { imdsLocationURL = original })
+}
+
+func TestDetectClusterLocation_NodeLabels(t *testing.T) {
+	serveIMDS(t, http.StatusOK, "westus")
+	client := newNodeClient(
+		newTestNode("virtual-node", nil),
+		newTestNode("aks-nodepool1-0", map[string]interface{}{"topology.kubernetes.io/region": "eastus"}),
+	)
+
+	location, err := detectClusterLocation(context.Background(), client, http.DefaultClient)
+	require.NoError(t, err)
+	assert.Equal(t, "eastus", location, "node labels are preferred to IMDS")
+}
+
+func TestDetectClusterLocation_IMDS(t *testing.T) {
+	serveIMDS(t, http.StatusOK, "westeurope")
+
+	location, err := detectClusterLocation(context.Background(), newNodeClient(newTestNode("node-0", nil)), http.DefaultClient)
+	require.NoError(t, err)
+	assert.Equal(t, "westeurope", location)
+
+	location, err = detectClusterLocation(context.Background(), nil, http.DefaultClient)
+	require.NoError(t, err)
+	assert.Equal(t, "westeurope", location)
+}
+
+func TestDetectClusterLocation_Failure(t *testing.T) {
+	serveIMDS(t, http.StatusBadRequest, "")
+
+	_, err := detectClusterLocation(context.Background(), newNodeClient(), http.DefaultClient)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no node has a topology.kubernetes.io/region label")
+	assert.Contains(t, err.Error(), "400")
+}
+
+func TestParseAnnotations_DetectedLocation(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger:           zaptest.NewLogger(t),
+		defaults:         annotations.Defaults{ResourceGroup: "tm-rg"},
+		detectedLocation: "eastus",
+	}
+	ctx := context.Background()
+	labels := map[string]string{annotations.AnnotationEnabled: "true"}
+
+	config, err := p.parseAnnotations(ctx, labels)
+	require.NoError(t, err)
+	assert.Equal(t, "eastus", config.EndpointLocation)
+
+	labels[annotations.AnnotationEndpointLocation] = "westus"
+	config, err = p.parseAnnotations(ctx, labels)
+	require.NoError(t, err)
+	assert.Equal(t, "westus", config.EndpointLocation, "the annotation overrides the detected region")
+
+	delete(labels, annotations.AnnotationEndpointLocation)
+	require.NoError(t, p.UpdateSettings(Settings{Defaults: annotations.Defaults{ResourceGroup: "tm-rg", EndpointLocation: "northeurope"}}))
+	config, err = p.parseAnnotations(ctx, labels)
+	require.NoError(t, err)
+	assert.Equal(t, "northeurope", config.EndpointLocation, "a configured default overrides the detected region")
+}
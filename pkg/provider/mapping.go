@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"go.uber.org/zap"
+)
+
+// Hostname mapping strategies, tried in the configured order for profiles without a hostname
+const (
+	HostnameMappingTag         = "tag"         // Hostname tag on the profile
+	HostnameMappingNaming      = "naming"      // Profile name generated from the hostname, matched against the domain filter
+	HostnameMappingState       = "state"       // Hostname recorded in the provider's state cache
+	HostnameMappingDNSEndpoint = "dnsendpoint" // DNSEndpoint whose annotations name the profile
+)
+
+// HostnameMappings lists the supported hostname mapping strategies
+var HostnameMappings = []string{HostnameMappingTag, HostnameMappingNaming, HostnameMappingState, HostnameMappingDNSEndpoint}
+
+// HostnameMapper finds vanity hostnames for Traffic Manager profiles
+type HostnameMapper interface {
+	// MapHostnames sets Hostname on the profiles it can match; profiles it can't match are left unchanged
+	MapHostnames(ctx context.Context, profiles []*state.ProfileState) error
+}
+
+// newHostnameMappers builds the mappers for the configured strategies, in order.
+// The naming mapper uses the current domain filter, so callers replacing it must hold settingsMu.
+func (p *TrafficManagerProvider) newHostnameMappers(strategies []string) ([]HostnameMapper, error) {
+	if len(strategies) == 0 {
+		strategies = []string{HostnameMappingTag}
+	}
+
+	mappers := make([]HostnameMapper, 0, len(strategies))
+	for _, strategy := range strategies {
+		switch strings.TrimSpace(strategy) {
+		case HostnameMappingTag:
+			mappers = append(mappers, tagMapper{tag: p.owner().HostnameTag})
+		case HostnameMappingNaming:
+			mappers = append(mappers, namingMapper{domains: p.domainFilter})
+		case HostnameMappingState:
+			mappers = append(mappers, stateMapper{stateManager: p.stateManager})
+		case HostnameMappingDNSEndpoint:
+			if p.dnsEndpointManager == nil {
+				return nil, fmt.Errorf("hostname mapping %q requires vanity record mode %q", HostnameMappingDNSEndpoint, VanityRecordModeDNSEndpoint)
+			}
+			mappers = append(mappers, dnsEndpointMapper{provider: p})
+		default:
+			return nil, fmt.Errorf("invalid hostname mapping %q, must be one of: %v", strategy, HostnameMappings)
+		}
+	}
+	return mappers, nil
+}
+
+// mapHostnames runs the configured mappers over profiles that don't have a hostname yet.
+// A failing mapper is logged and skipped so one broken source doesn't hide every profile.
+func (p *TrafficManagerProvider) mapHostnames(ctx context.Context, profiles []*state.ProfileState) {
+	for _, mapper := range p.mappers() {
+		unmapped := unmappedProfiles(profiles)
+		if len(unmapped) == 0 {
+			return
+		}
+
+		if err := mapper.MapHostnames(ctx, unmapped); err != nil {
+			p.log(ctx).Warn("Hostname mapping failed",
+				zap.String("mapper", fmt.Sprintf("%T", mapper)),
+				zap.Error(err))
+		}
+	}
+}
+
+// unmappedProfiles returns the profiles without a hostname
+func unmappedProfiles(profiles []*state.ProfileState) []*state.ProfileState {
+	var unmapped []*state.ProfileState
+	for _, profile := range profiles {
+		if profile.Hostname == "" {
+			unmapped = append(unmapped, profile)
+		}
+	}
+	return unmapped
+}
+
+// tagMapper reads the hostname tag written when the webhook creates a profile
+type tagMapper struct {
+	tag string
+}
+
+func (m tagMapper) MapHostnames(_ context.Context, profiles []*state.ProfileState) error {
+	for _, profile := range profiles {
+		profile.Hostname = profile.Tags[m.tag]
+	}
+	return nil
+}
+
+// namingMapper reverses the "<hostname with dots as dashes>-tm" profile naming convention.
+// Dashes are ambiguous, so a profile only matches when its name ends with one of the
+// filtered domains; everything before the domain is taken as a single label.
+type namingMapper struct {
+	domains []string
+}
+
+func (m namingMapper) MapHostnames(_ context.Context, profiles []*state.ProfileState) error {
+	for _, profile := range profiles {
+		profile.Hostname = m.hostname(profile.ProfileName)
+	}
+	return nil
+}
+
+func (m namingMapper) hostname(profileName string) string {
+	base, ok := strings.CutSuffix(profileName, "-tm")
+	if !ok {
+		return ""
+	}
+
+	// Prefer the most specific domain
+	match := ""
+	for _, domain := range m.domains {
+		domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+		suffix := "-" + sanitizeName(domain)
+		if strings.HasSuffix(base, suffix) && len(base) > len(suffix) && len(domain) > len(match) {
+			match = domain
+		}
+	}
+	if match == "" {
+		return ""
+	}
+
+	label := strings.TrimSuffix(base, "-"+sanitizeName(match))
+	return label + "." + match
+}
+
+// stateMapper looks up the hostname the provider recorded for a profile of the same name and resource group
+type stateMapper struct {
+	stateManager *state.Manager
+}
+
+func (m stateMapper) MapHostnames(_ context.Context, profiles []*state.ProfileState) error {
+	for _, profile := range profiles {
+		cached, ok := m.stateManager.GetProfileByName(profile.ProfileName)
+		if ok && strings.EqualFold(cached.ResourceGroup, profile.ResourceGroup) {
+			profile.Hostname = cached.Hostname
+		}
+	}
+	return nil
+}
+
+// dnsEndpointMapper matches profiles to the DNSEndpoints created for their vanity hostnames
+type dnsEndpointMapper struct {
+	provider *TrafficManagerProvider
+}
+
+func (m dnsEndpointMapper) MapHostnames(ctx context.Context, profiles []*state.ProfileState) error {
+	managed, err := m.provider.ManagedDNSEndpoints(ctx)
+	if err != nil {
+		return err
+	}
+
+	hostnames := make(map[string]string, len(managed))
+	for _, endpoint := range managed {
+		if endpoint.ProfileName != "" && endpoint.Hostname != "" {
+			hostnames[strings.ToLower(endpoint.ResourceGroup+"/"+endpoint.ProfileName)] = endpoint.Hostname
+		}
+	}
+
+	for _, profile := range profiles {
+		profile.Hostname = hostnames[strings.ToLower(profile.ResourceGroup+"/"+profile.ProfileName)]
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/dnsendpoint"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestNamingMapper(t *testing.T) {
+	m := namingMapper{domains: []string{"example.com", "eu.example.com"}}
+
+	assert.Equal(t, "myapp.example.com", m.hostname("myapp-example-com-tm"))
+	assert.Equal(t, "my-app.example.com", m.hostname("my-app-example-com-tm"))
+	assert.Equal(t, "shop.eu.example.com", m.hostname("shop-eu-example-com-tm"), "most specific domain wins")
+	assert.Equal(t, "", m.hostname("myapp-example-org-tm"), "domain not in filter")
+	assert.Equal(t, "", m.hostname("example-com-tm"), "no label before the domain")
+	assert.Equal(t, "", m.hostname("legacy-profile"), "not a generated name")
+}
+
+func TestMapHostnames_TriesStrategiesInOrder(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		domainFilter: []string{"example.com"},
+		stateManager: state.NewManager(5*time.Minute, logger),
+	}
+	p.stateManager.SetProfile("cached.example.com", &state.ProfileState{
+		ProfileName:   "legacy-profile",
+		ResourceGroup: "tm-rg",
+		Hostname:      "cached.example.com",
+	})
+
+	var err error
+	p.hostnameMappers, err = p.newHostnameMappers([]string{HostnameMappingTag, HostnameMappingNaming, HostnameMappingState})
+	require.NoError(t, err)
+
+	profiles := []*state.ProfileState{
+		{ProfileName: "myapp-example-com-tm", ResourceGroup: "tm-rg", Tags: map[string]string{"hostname": "tagged.example.com"}},
+		{ProfileName: "other-example-com-tm", ResourceGroup: "tm-rg"},
+		{ProfileName: "legacy-profile", ResourceGroup: "tm-rg"},
+		{ProfileName: "unknown", ResourceGroup: "tm-rg"},
+	}
+	p.mapHostnames(context.Background(), profiles)
+
+	assert.Equal(t, "tagged.example.com", profiles[0].Hostname)
+	assert.Equal(t, "other.example.com", profiles[1].Hostname)
+	assert.Equal(t, "cached.example.com", profiles[2].Hostname)
+	assert.Equal(t, "", profiles[3].Hostname)
+}
+
+func TestDNSEndpointMapper(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	object := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "externaldns.k8s.io/v1alpha1",
+		"kind":       "DNSEndpoint",
+		"metadata": map[string]interface{}{
+			"name":      "shop-example-com-tm-cname",
+			"namespace": "default",
+			"labels":    map[string]interface{}{dnsendpoint.ManagedByLabel: dnsendpoint.ManagedByValue},
+			"annotations": map[string]interface{}{
+				dnsendpoint.ProfileNameAnnotation:   "legacy-profile",
+				dnsendpoint.ResourceGroupAnnotation: "tm-rg",
+			},
+		},
+		"spec": map[string]interface{}{
+			"endpoints": []interface{}{map[string]interface{}{"dnsName": "shop.example.com"}},
+		},
+	}}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{dnsendpoint.DNSEndpointGVR(): "DNSEndpointList"}, object)
+
+	p := &TrafficManagerProvider{
+		logger:             logger,
+		dnsEndpointManager: dnsendpoint.NewManager(client, "default", logger),
+	}
+	mappers, err := p.newHostnameMappers([]string{HostnameMappingDNSEndpoint})
+	require.NoError(t, err)
+
+	profiles := []*state.ProfileState{{ProfileName: "legacy-profile", ResourceGroup: "TM-RG"}}
+	require.NoError(t, mappers[0].MapHostnames(context.Background(), profiles))
+	assert.Equal(t, "shop.example.com", profiles[0].Hostname)
+}
+
+func TestNewHostnameMappers_Invalid(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t)}
+
+	_, err := p.newHostnameMappers([]string{"guess"})
+	assert.ErrorContains(t, err, `invalid hostname mapping "guess"`)
+
+	// DNSEndpoint mapping needs DNSEndpoint vanity mode
+	_, err = p.newHostnameMappers([]string{HostnameMappingDNSEndpoint})
+	assert.Error(t, err)
+}
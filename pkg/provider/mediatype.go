@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// webhookMediaType is the External DNS webhook media type, versioned with a "version" parameter
+	webhookMediaType = "application/external.dns.webhook+json"
+
+	// webhookVersion is the protocol version used in responses
+	webhookVersion = "1"
+)
+
+// SupportedVersions lists the External DNS webhook protocol versions this webhook accepts
+var SupportedVersions = []string{webhookVersion}
+
+// webhookContentType returns the response media type for the webhook protocol version
+func webhookContentType() string {
+	return webhookMediaType + ";version=" + webhookVersion
+}
+
+// checkMediaType validates the Accept and Content-Type headers of a webhook request.
+// Requests for an unsupported protocol version are rejected with 406 (Accept) or
+// 415 (Content-Type). Missing headers and plain JSON are allowed for manual testing.
+// It reports whether the request may proceed.
+func (s *WebhookServer) checkMediaType(w http.ResponseWriter, r *http.Request) bool {
+	if accept := r.Header.Get("Accept"); !acceptsWebhookMediaType(accept) {
+		s.writeError(w, ErrorCodeNotAcceptable,
+			fmt.Sprintf("Unsupported Accept %q, supported versions: %s", accept, strings.Join(SupportedVersions, ", ")))
+		return false
+	}
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		if ok, _ := isWebhookMediaType(contentType, false); !ok {
+			s.writeError(w, ErrorCodeUnsupportedMediaType,
+				fmt.Sprintf("Unsupported Content-Type %q, supported versions: %s", contentType, strings.Join(SupportedVersions, ", ")))
+			return false
+		}
+	}
+	return true
+}
+
+// acceptsWebhookMediaType reports whether an Accept header allows a supported webhook version
+func acceptsWebhookMediaType(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+
+	for _, value := range strings.Split(accept, ",") {
+		if ok, quality := isWebhookMediaType(value, true); ok && quality != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// isWebhookMediaType reports whether value names the webhook media type at a supported
+// version, or plain JSON. With wildcards, */* and application/* also match.
+// It also returns the q parameter so Accept entries with q=0 can be skipped.
+func isWebhookMediaType(value string, wildcards bool) (bool, string) {
+	mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(value))
+	if err != nil {
+		return false, ""
+	}
+	quality := params["q"]
+
+	switch mediaType {
+	case webhookMediaType:
+		version, ok := params["version"]
+		if !ok {
+			return true, quality
+		}
+		for _, supported := range SupportedVersions {
+			if version == supported {
+				return true, quality
+			}
+		}
+		return false, quality
+	case "application/json":
+		return true, quality
+	case "*/*", "application/*":
+		return wildcards, quality
+	default:
+		return false, quality
+	}
+}
@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestAcceptsWebhookMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   bool
+	}{
+		{"", true},
+		{"*/*", true},
+		{"application/json", true},
+		{"application/external.dns.webhook+json;version=1", true},
+		{"application/external.dns.webhook+json", true},
+		{"application/external.dns.webhook+json;version=2", false},
+		{"application/external.dns.webhook+json;version=2, application/external.dns.webhook+json;version=1", true},
+		{"application/external.dns.webhook+json;version=1;q=0", false},
+		{"text/plain", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, acceptsWebhookMediaType(tt.accept))
+		})
+	}
+}
+
+func TestCheckMediaType(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+	req.Header.Set("Accept", "application/external.dns.webhook+json;version=2")
+	rec := httptest.NewRecorder()
+	s.HandleRecords(rec, req)
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/adjustendpoints", nil)
+	req.Header.Set("Content-Type", "text/plain")
+	rec = httptest.NewRecorder()
+	s.HandleAdjustEndpoints(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+
+	// Content-Type wildcards are not valid
+	req = httptest.NewRequest(http.MethodPost, "/adjustendpoints", nil)
+	req.Header.Set("Content-Type", "*/*")
+	rec = httptest.NewRecorder()
+	s.HandleAdjustEndpoints(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+}
+
+func TestHandleNegotiate_AdvertisesVersions(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/external.dns.webhook+json;version=1")
+	rec := httptest.NewRecorder()
+	s.HandleNegotiate(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/external.dns.webhook+json;version=1", rec.Header().Get("Content-Type"))
+
+	var response NegotiationResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, "1", response.Version)
+	assert.Equal(t, []string{"1"}, response.SupportedVersions)
+}
@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+// Default naming templates, which give the names the webhook has always generated. Endpoint names
+// end in the record's set identifier, if it has one, so records differing only in it don't collide.
+const (
+	DefaultProfileNameTemplate  = "{{ .Hostname }}-tm"
+	DefaultEndpointNameTemplate = "{{ .Target }}{{ with .SetIdentifier }}-{{ . }}{{ end }}"
+)
+
+// maxResourceNameLength is the longest profile or endpoint name generated. Longer names are
+// shortened and end in a hash of the full name, so different long names stay distinct.
+const maxResourceNameLength = annotations.MaxProfileNameLength
+
+var (
+	defaultProfileNameTemplate  = template.Must(parseNameTemplate("profile", DefaultProfileNameTemplate))
+	defaultEndpointNameTemplate = template.Must(parseNameTemplate("endpoint", DefaultEndpointNameTemplate))
+)
+
+// nameData is what a naming template can reference
+type nameData struct {
+	Hostname  string // Vanity hostname the profile serves
+	Namespace string // Kubernetes namespace of the source; empty when unknown
+	Cluster   string // CLUSTER_NAME of this webhook
+	Target    string // Endpoint target; the DNS name for profiles and endpoints without targets. See nameTarget for IPv6.
+
+	SetIdentifier string // External DNS set identifier of the record; empty when it has none
+}
+
+// nameTemplateFuncs are the functions available to naming templates besides the text/template built-ins
+var nameTemplateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"replace":    func(from, to, s string) string { return strings.ReplaceAll(s, from, to) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"firstLabel": func(s string) string { return strings.SplitN(s, ".", 2)[0] },
+	"hash":       targetHash,
+}
+
+// parseNameTemplate parses a naming template. Referencing a field that doesn't exist is an error.
+func parseNameTemplate(kind, text string) (*template.Template, error) {
+	tmpl, err := template.New(kind).Funcs(nameTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s name template %q: %w", kind, text, err)
+	}
+	return tmpl, nil
+}
+
+// renderName executes a naming template and normalizes the result into a valid Azure resource name
+func renderName(tmpl *template.Template, data nameData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s name template: %w", tmpl.Name(), err)
+	}
+	name, err := normalizeName(buf.String())
+	if err != nil {
+		return "", fmt.Errorf("%s name template rendered %q: %w", tmpl.Name(), buf.String(), err)
+	}
+	return name, nil
+}
+
+// normalizeName turns s into a name that satisfies both the profile and endpoint naming rules:
+// characters other than letters and digits become hyphens, hyphens are trimmed from the ends,
+// and long names are shortened
+func normalizeName(s string) (string, error) {
+	name := strings.Trim(sanitizeName(s), "-")
+	if name == "" {
+		return "", fmt.Errorf("no letters or digits to build a name from")
+	}
+	return fitName(name), nil
+}
+
+// fitName shortens a name longer than maxResourceNameLength, keeping the generated profile suffix
+// so profiles without tags are still recognised as generated
+func fitName(name string) string {
+	if len(name) <= maxResourceNameLength {
+		return name
+	}
+	hash := targetHash(name)
+	if strings.HasSuffix(name, trafficmanager.GeneratedProfileSuffix) {
+		return suffixedProfileName(name, hash)
+	}
+	return strings.TrimRight(name[:maxResourceNameLength-len(hash)-1], "-") + "-" + hash
+}
+
+// nameTemplate returns the template to use: the annotation's if set, then the webhook's, then the default
+func nameTemplate(kind, annotation string, configured, fallback *template.Template) (*template.Template, error) {
+	if annotation != "" {
+		tmpl, err := parseNameTemplate(kind, annotation)
+		if err != nil {
+			return nil, withCode(ErrorCodeInvalidAnnotation, err)
+		}
+		return tmpl, nil
+	}
+	if configured != nil {
+		return configured, nil
+	}
+	return fallback, nil
+}
+
+// newNameData returns the naming template data for an endpoint and one of its targets
+func (p *TrafficManagerProvider) newNameData(endpoint *Endpoint, hostname, target string) nameData {
+	if target == "" {
+		target = endpoint.DNSName
+	}
+	return nameData{
+		Hostname:      hostname,
+		Namespace:     sourceNamespace(endpoint),
+		Cluster:       p.clusterName,
+		Target:        nameTarget(target),
+		SetIdentifier: endpoint.SetIdentifier,
+	}
+}
+
+// renderProfileName renders the profile name template for a hostname
+func (p *TrafficManagerProvider) renderProfileName(config *annotations.TrafficManagerConfig, endpoint *Endpoint, hostname string) (string, error) {
+	tmpl, err := nameTemplate("profile", config.ProfileNameTemplate, p.profileNameTemplate, defaultProfileNameTemplate)
+	if err != nil {
+		return "", err
+	}
+	name, err := renderName(tmpl, p.newNameData(endpoint, hostname, ""))
+	if err != nil {
+		return "", err
+	}
+	return name, annotations.ValidateProfileName(name)
+}
+
+// renderEndpointName renders the endpoint name template for a target; an empty target means the
+// endpoint's first target
+func (p *TrafficManagerProvider) renderEndpointName(config *annotations.TrafficManagerConfig, endpoint *Endpoint, hostname, target string) (string, error) {
+	tmpl, err := nameTemplate("endpoint", config.EndpointNameTemplate, p.endpointNameTemplate, defaultEndpointNameTemplate)
+	if err != nil {
+		return "", err
+	}
+	if target == "" && len(endpoint.Targets) > 0 {
+		target = endpoint.Targets[0]
+	}
+	name, err := renderName(tmpl, p.newNameData(endpoint, hostname, target))
+	if err != nil {
+		return "", err
+	}
+	return name, annotations.ValidateEndpointName(name)
+}
@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRenderName(t *testing.T) {
+	data := nameData{Hostname: "app.example.com", Namespace: "team-a", Cluster: "aks-east", Target: "20.30.40.50", SetIdentifier: "blue"}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"default profile", DefaultProfileNameTemplate, "app-example-com-tm"},
+		{"default endpoint", DefaultEndpointNameTemplate, "20-30-40-50-blue"},
+		{"set identifier", "{{ .Target }}-{{ .SetIdentifier }}", "20-30-40-50-blue"},
+		{"namespace and cluster", "{{ .Namespace }}-{{ firstLabel .Hostname }}-{{ .Cluster }}", "team-a-app-aks-east"},
+		{"functions", "{{ .Hostname | trimSuffix \".example.com\" | upper }}-tm", "APP-tm"},
+		{"leading and trailing hyphens trimmed", "-{{ .Cluster }}.", "aks-east"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseNameTemplate("test", tt.template)
+			require.NoError(t, err)
+			name, err := renderName(tmpl, data)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, name)
+		})
+	}
+}
+
+func TestRenderName_Errors(t *testing.T) {
+	_, err := parseNameTemplate("profile", "{{ .Hostname")
+	assert.Error(t, err)
+
+	tmpl, err := parseNameTemplate("profile", "{{ .Region }}")
+	require.NoError(t, err)
+	_, err = renderName(tmpl, nameData{})
+	assert.Error(t, err, "unknown fields fail rather than render empty")
+
+	tmpl, err = parseNameTemplate("profile", "{{ .Namespace }}")
+	require.NoError(t, err)
+	_, err = renderName(tmpl, nameData{})
+	assert.Error(t, err, "an empty name is rejected")
+}
+
+func TestNormalizeName(t *testing.T) {
+	name, err := normalizeName("*.app.example.com.")
+	require.NoError(t, err)
+	assert.Equal(t, "app-example-com", name)
+
+	_, err = normalizeName("--..--")
+	assert.Error(t, err)
+}
+
+func TestFitName(t *testing.T) {
+	assert.Equal(t, "short-tm", fitName("short-tm"))
+
+	profile := fitName(strings.Repeat("a", 80) + "-tm")
+	assert.Len(t, profile, maxResourceNameLength)
+	assert.True(t, strings.HasSuffix(profile, "-tm"), "the generated suffix is kept")
+
+	endpoint := fitName(strings.Repeat("b", 80))
+	assert.Len(t, endpoint, maxResourceNameLength)
+	assert.NotEqual(t, endpoint, fitName(strings.Repeat("b", 81)), "long names stay distinct")
+}
+
+func TestRenderProfileName_Precedence(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t), clusterName: "aks-east"}
+	endpoint := &Endpoint{DNSName: "app.example.com", Labels: map[string]string{"resource": "service/team-a/web"}}
+
+	name, err := p.renderProfileName(&annotations.TrafficManagerConfig{}, endpoint, "app.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "app-example-com-tm", name)
+
+	p.profileNameTemplate, err = parseNameTemplate("profile", "{{ .Namespace }}-{{ .Hostname }}")
+	require.NoError(t, err)
+	name, err = p.renderProfileName(&annotations.TrafficManagerConfig{}, endpoint, "app.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "team-a-app-example-com", name)
+
+	name, err = p.renderProfileName(&annotations.TrafficManagerConfig{ProfileNameTemplate: "{{ .Cluster }}-tm"}, endpoint, "app.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "aks-east-tm", name, "the annotation wins")
+
+	_, err = p.renderProfileName(&annotations.TrafficManagerConfig{ProfileNameTemplate: "{{"}, endpoint, "app.example.com")
+	assert.Equal(t, ErrorCodeInvalidAnnotation, errorCode(err))
+}
+
+func TestRenderEndpointName(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t), clusterName: "aks-east"}
+	config := &annotations.TrafficManagerConfig{EndpointNameTemplate: "{{ .Cluster }}-{{ .Target }}"}
+
+	name, err := p.renderEndpointName(config, &Endpoint{DNSName: "app-east.example.com", Targets: []string{"20.30.40.50"}}, "app.example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "aks-east-20-30-40-50", name)
+
+	name, err = p.renderEndpointName(config, &Endpoint{DNSName: "app-east.example.com"}, "app.example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "aks-east-app-east-example-com", name, "the DNS name stands in for a missing target")
+}
+
+func TestRenderEndpointName_SetIdentifier(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t)}
+	config := &annotations.TrafficManagerConfig{}
+
+	blue, err := p.renderEndpointName(config, &Endpoint{DNSName: "app.example.com", Targets: []string{"20.30.40.50"}, SetIdentifier: "blue"}, "app.example.com", "")
+	require.NoError(t, err)
+	green, err := p.renderEndpointName(config, &Endpoint{DNSName: "app.example.com", Targets: []string{"20.30.40.50"}, SetIdentifier: "green"}, "app.example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "20-30-40-50-blue", blue)
+	assert.Equal(t, "20-30-40-50-green", green)
+
+	plain, err := p.renderEndpointName(config, &Endpoint{DNSName: "app.example.com", Targets: []string{"20.30.40.50"}}, "app.example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "20-30-40-50", plain, "records without a set identifier keep their names")
+}
+
+func TestRenderEndpointName_IPv6(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t)}
+	config := &annotations.TrafficManagerConfig{}
+
+	name, err := p.renderEndpointName(config, &Endpoint{DNSName: "app.example.com", RecordType: "AAAA", Targets: []string{"2001:db8::1"}, SetIdentifier: "blue"}, "app.example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "2001-db8-0-0-0-0-0-1-blue", name)
+
+	name, err = p.renderEndpointName(config, &Endpoint{DNSName: "app.example.com", Targets: []string{"::1"}}, "app.example.com", "")
+	require.NoError(t, err)
+	assert.Equal(t, "0-0-0-0-0-0-0-1", name)
+	assert.Equal(t, "2001-db8-1-0-0-0-0-0", generateEndpointNameFromTarget("2001:db8:1::", 0))
+}
@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"go.uber.org/zap"
+)
+
+// endpointNameClaims tracks the endpoint names assigned during one ApplyChanges batch,
+// keyed by "<profile>/<endpoint name>" with the target that claimed it
+type endpointNameClaims map[string]string
+
+// uniqueEndpointName returns name unless it is already used by a different target,
+// either earlier in the batch or in cached state for the profile. Colliding names get a
+// short hash of the target appended so the same target always resolves to the same name.
+func (p *TrafficManagerProvider) uniqueEndpointName(claims endpointNameClaims, vanityHostname, profileName, name, target string) string {
+	if !p.endpointNameTaken(claims, vanityHostname, profileName, name, target) {
+		claims[profileName+"/"+name] = target
+		return name
+	}
+
+	disambiguated := fmt.Sprintf("%s-%s", name, targetHash(target))
+
+	p.logger.Warn("Endpoint name collision detected, using disambiguated name",
+		zap.String("profileName", profileName),
+		zap.String("endpointName", name),
+		zap.String("disambiguatedName", disambiguated),
+		zap.String("target", target))
+
+	claims[profileName+"/"+disambiguated] = target
+	return disambiguated
+}
+
+// targetEndpointName returns the name of the endpoint written for the index-th target of endpoint.
+// Creates and updates both name endpoints this way, so an update writes the endpoints the create made.
+func (p *TrafficManagerProvider) targetEndpointName(claims endpointNameClaims, config *annotations.TrafficManagerConfig, endpoint *Endpoint, vanityHostname, target string, index int) string {
+	name := baseEndpointName(config, endpoint, target, index)
+
+	// Sanitization can map different targets to the same name; resolve before calling Azure
+	return p.uniqueEndpointName(claims, vanityHostname, config.ProfileName, name, target)
+}
+
+// baseEndpointName returns the name of the endpoint for the index-th target of endpoint before
+// collisions with other targets are resolved
+func baseEndpointName(config *annotations.TrafficManagerConfig, endpoint *Endpoint, target string, index int) string {
+	// If we have multiple targets, ensure unique endpoint names
+	// This handles the case where External DNS merges multiple DNSEndpoint CRDs
+	if len(endpoint.Targets) > 1 && config.EndpointName != "" {
+		return fmt.Sprintf("%s-%d", config.EndpointName, index)
+	}
+	if config.EndpointName == "" {
+		// Generate endpoint name from target if not specified
+		return generateEndpointNameFromTarget(target, index)
+	}
+	return config.EndpointName
+}
+
+// claimRetargetedNames lets the endpoints an update retargets keep their names. Without the claim,
+// the target cached for an endpoint from the old record would look like another target using its name.
+func (p *TrafficManagerProvider) claimRetargetedNames(claims endpointNameClaims, config *annotations.TrafficManagerConfig, endpoint, oldEndpoint *Endpoint, vanityHostname string, targets []string) {
+	oldTargets := append(endpointTargets(oldEndpoint), oldEndpoint.Targets...)
+	for i, target := range targets {
+		name := baseEndpointName(config, endpoint, target, i)
+		if _, ok := claims[config.ProfileName+"/"+name]; ok {
+			continue
+		}
+		existing, ok := p.stateManager.GetEndpoint(vanityHostname, name)
+		if !ok || strings.EqualFold(existing.Target, target) {
+			continue
+		}
+		for _, oldTarget := range oldTargets {
+			if strings.EqualFold(canonicalTarget(existing.Target), canonicalTarget(oldTarget)) {
+				claims[config.ProfileName+"/"+name] = target
+				break
+			}
+		}
+	}
+}
+
+// endpointNameTaken reports whether name is claimed by a target other than target
+func (p *TrafficManagerProvider) endpointNameTaken(claims endpointNameClaims, vanityHostname, profileName, name, target string) bool {
+	if claimed, ok := claims[profileName+"/"+name]; ok {
+		return !strings.EqualFold(claimed, target)
+	}
+
+	if existing, ok := p.stateManager.GetEndpoint(vanityHostname, name); ok && existing.Target != "" {
+		return !strings.EqualFold(existing.Target, target)
+	}
+
+	return false
+}
+
+// targetHash returns a short, stable hash of a target for use in endpoint names
+func targetHash(target string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(target)))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// parseIPv6 returns target as an IPv6 address, without any zone, if it is one
+func parseIPv6(target string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(target)
+	if err != nil || !addr.Is6() {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone(""), true
+}
+
+// canonicalTarget writes IPv6 targets in their canonical compressed form, so the same address
+// always gives the same endpoint target; other targets are returned unchanged
+func canonicalTarget(target string) string {
+	if addr, ok := parseIPv6(target); ok {
+		return addr.String()
+	}
+	return target
+}
+
+// nameTarget returns the form of target naming templates see. IPv6 addresses are written out as
+// their eight groups separated by hyphens (2001:db8::1 -> 2001-db8-0-0-0-0-0-1): sanitizing the
+// colons would leave names with runs of hyphens, or nothing at all for ::, and different
+// addresses could share one name.
+func nameTarget(target string) string {
+	addr, ok := parseIPv6(target)
+	if !ok {
+		return target
+	}
+	b := addr.As16()
+	groups := make([]string, 8)
+	for i := range groups {
+		groups[i] = strconv.FormatUint(uint64(b[2*i])<<8|uint64(b[2*i+1]), 16)
+	}
+	return strings.Join(groups, "-")
+}
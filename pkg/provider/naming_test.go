@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestUniqueEndpointName(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		stateManager: state.NewManager(5*time.Minute, logger),
+	}
+	claims := make(endpointNameClaims)
+
+	// "a.example.com" and "a-example.com" both sanitize to "a-example-com"
+	first := p.uniqueEndpointName(claims, "demo.example.com", "demo-tm", sanitizeName("a.example.com"), "a.example.com")
+	assert.Equal(t, "a-example-com", first)
+
+	second := p.uniqueEndpointName(claims, "demo.example.com", "demo-tm", sanitizeName("a-example.com"), "a-example.com")
+	assert.Equal(t, "a-example-com-"+targetHash("a-example.com"), second)
+
+	// Same target keeps its name; same name in another profile doesn't collide
+	assert.Equal(t, first, p.uniqueEndpointName(claims, "demo.example.com", "demo-tm", "a-example-com", "A.example.com"))
+	assert.Equal(t, "a-example-com", p.uniqueEndpointName(claims, "other.example.com", "other-tm", "a-example-com", "a-example.com"))
+}
+
+func TestUniqueEndpointName_CachedState(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		stateManager: state.NewManager(5*time.Minute, logger),
+	}
+	p.stateManager.SetProfile("demo.example.com", &state.ProfileState{
+		ProfileName: "demo-tm",
+		Hostname:    "demo.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"a-example-com": {EndpointName: "a-example-com", Target: "a.example.com"},
+		},
+	})
+
+	name := p.uniqueEndpointName(make(endpointNameClaims), "demo.example.com", "demo-tm", "a-example-com", "a-example.com")
+	assert.Equal(t, "a-example-com-"+targetHash("a-example.com"), name)
+
+	name = p.uniqueEndpointName(make(endpointNameClaims), "demo.example.com", "demo-tm", "a-example-com", "a.example.com")
+	assert.Equal(t, "a-example-com", name)
+}
+
+func TestNameTarget(t *testing.T) {
+	assert.Equal(t, "2001-db8-0-0-0-0-0-1", nameTarget("2001:DB8::1"))
+	assert.Equal(t, "0-0-0-0-0-0-0-0", nameTarget("::"))
+	assert.Equal(t, "fe80-0-0-0-0-0-0-1", nameTarget("fe80::1%eth0"), "zones are dropped")
+	assert.Equal(t, "20.30.40.50", nameTarget("20.30.40.50"))
+	assert.Equal(t, "backend.example.net", nameTarget("backend.example.net"))
+}
+
+func TestCanonicalTarget(t *testing.T) {
+	assert.Equal(t, "2001:db8::1", canonicalTarget("2001:0DB8:0:0:0:0:0:1"))
+	assert.Equal(t, "20.30.40.50", canonicalTarget("20.30.40.50"))
+	assert.Equal(t, "Backend.example.net", canonicalTarget("Backend.example.net"))
+}
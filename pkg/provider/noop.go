@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"maps"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+// Resources counted by the skipped writes metric
+const (
+	skippedWriteProfile  = "profile"
+	skippedWriteEndpoint = "endpoint"
+	skippedWriteMetadata = "metadata"
+)
+
+// cachedProfileFor returns the cached profile of hostname when it is the profile config names
+func (p *TrafficManagerProvider) cachedProfileFor(hostname, resourceGroup, profileName string) *state.ProfileState {
+	profile, ok := p.stateManager.GetProfile(hostname)
+	if !ok || profile.ProfileName != profileName || !strings.EqualFold(profile.ResourceGroup, resourceGroup) {
+		return nil
+	}
+	return profile
+}
+
+// profileUpToDate reports whether writing config to profile would change nothing. The endpoint
+// metadata tags are left out, as profile writes keep them.
+func profileUpToDate(profile *state.ProfileState, config *trafficmanager.ProfileConfig) bool {
+	if profile.RoutingMethod != config.RoutingMethod ||
+		profile.DNSTTL != config.DNSTTL ||
+		profile.MonitorProtocol != config.MonitorProtocol ||
+		profile.MonitorPort != config.MonitorPort ||
+		profile.MonitorPath != config.MonitorPath ||
+		profileStatusOf(profile.ProfileStatus) != profileStatusOf(config.ProfileStatus) ||
+		profile.TrafficViewEnabled != config.TrafficViewEnabled {
+		return false
+	}
+
+	return maps.Equal(withoutMetadataTags(profile.Tags), withoutMetadataTags(config.Tags))
+}
+
+// profileStatusOf returns status, or Enabled when it isn't known
+func profileStatusOf(status string) string {
+	if status == "" {
+		return annotations.DefaultProfileStatus
+	}
+	return status
+}
+
+// endpointUpToDate reports whether writing config to endpoint would change nothing
+func endpointUpToDate(endpoint *state.EndpointState, config *trafficmanager.EndpointConfig) bool {
+	if endpointTypeName(endpoint.EndpointType) != config.EndpointType ||
+		endpoint.Weight != config.Weight ||
+		endpoint.Priority != config.Priority ||
+		endpoint.Status != config.Status ||
+		endpoint.AlwaysServe != config.AlwaysServe ||
+		!maps.Equal(endpoint.CustomHeaders, config.CustomHeaders) {
+		return false
+	}
+
+	if config.TargetResourceID != "" {
+		if !strings.EqualFold(endpoint.TargetResourceID, config.TargetResourceID) {
+			return false
+		}
+	} else if endpoint.TargetResourceID != "" || endpoint.Target != config.Target {
+		return false
+	}
+
+	// Azure reports locations by display name, e.g. "East US" for eastus
+	if config.EndpointType == "ExternalEndpoints" && normalizeLocation(endpoint.Location) != normalizeLocation(config.Location) {
+		return false
+	}
+	return true
+}
+
+// normalizeLocation reduces an Azure region's name or display name to its name
+func normalizeLocation(location string) string {
+	return strings.ToLower(strings.ReplaceAll(location, " ", ""))
+}
+
+// withoutMetadataTags returns tags without the endpoint metadata tags
+func withoutMetadataTags(tags map[string]string) map[string]string {
+	filtered := make(map[string]string, len(tags))
+	for k, v := range tags {
+		if !trafficmanager.IsEndpointMetadataTag(k) {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileUpToDate(t *testing.T) {
+	profile := &state.ProfileState{
+		RoutingMethod:       "Weighted",
+		DNSTTL:              30,
+		MonitorProtocol:     "HTTPS",
+		MonitorPort:         443,
+		MonitorPath:         "/",
+		HealthChecksEnabled: true,
+		Tags:                map[string]string{"managedBy": "webhook", trafficmanager.EndpointMetadataTag: `{"east":{}}`},
+	}
+	config := &trafficmanager.ProfileConfig{
+		RoutingMethod:       "Weighted",
+		DNSTTL:              30,
+		MonitorProtocol:     "HTTPS",
+		MonitorPort:         443,
+		MonitorPath:         "/",
+		HealthChecksEnabled: true,
+		Tags:                map[string]string{"managedBy": "webhook"},
+	}
+	assert.True(t, profileUpToDate(profile, config), "the endpoint metadata tag is kept by profile writes")
+
+	config.DNSTTL = 60
+	assert.False(t, profileUpToDate(profile, config))
+	config.DNSTTL = 30
+
+	config.Tags["team"] = "payments"
+	assert.False(t, profileUpToDate(profile, config))
+	delete(config.Tags, "team")
+
+	config.ProfileStatus = "Enabled"
+	assert.True(t, profileUpToDate(profile, config), "an unknown status is Enabled")
+	config.ProfileStatus = "Disabled"
+	assert.False(t, profileUpToDate(profile, config))
+	config.ProfileStatus = ""
+
+	config.HealthChecksEnabled = false
+	assert.True(t, profileUpToDate(profile, config), "health checks are set on the endpoints")
+	config.HealthChecksEnabled = true
+
+	profile.Tags[trafficmanager.DeleteAfterTag] = "2026-10-16T12:00:00Z"
+	assert.False(t, profileUpToDate(profile, config), "a soft-deleted profile is restored")
+}
+
+func TestEndpointUpToDate(t *testing.T) {
+	endpoint := &state.EndpointState{
+		EndpointType: "Microsoft.Network/trafficManagerProfiles/externalEndpoints",
+		Target:       "app-east.example.com",
+		Weight:       50,
+		Priority:     1,
+		Status:       "Enabled",
+		Location:     "East US",
+	}
+	config := &trafficmanager.EndpointConfig{
+		EndpointType: "ExternalEndpoints",
+		Target:       "app-east.example.com",
+		Weight:       50,
+		Priority:     1,
+		Status:       "Enabled",
+		Location:     "eastus",
+	}
+	assert.True(t, endpointUpToDate(endpoint, config))
+
+	changes := map[string]func(c *trafficmanager.EndpointConfig){
+		"weight":       func(c *trafficmanager.EndpointConfig) { c.Weight = 60 },
+		"status":       func(c *trafficmanager.EndpointConfig) { c.Status = "Disabled" },
+		"target":       func(c *trafficmanager.EndpointConfig) { c.Target = "other.example.com" },
+		"location":     func(c *trafficmanager.EndpointConfig) { c.Location = "westus" },
+		"resource":     func(c *trafficmanager.EndpointConfig) { c.TargetResourceID = "/subscriptions/x/ip" },
+		"always serve": func(c *trafficmanager.EndpointConfig) { c.AlwaysServe = true },
+		"headers":      func(c *trafficmanager.EndpointConfig) { c.CustomHeaders = map[string]string{"host": "a.example.com"} },
+	}
+	for name, change := range changes {
+		changed := *config
+		change(&changed)
+		assert.False(t, endpointUpToDate(endpoint, &changed), name)
+	}
+
+	azure := &state.EndpointState{EndpointType: "AzureEndpoints", TargetResourceID: "/subscriptions/X/ip", Target: "20.30.40.50", Weight: 1, Status: "Enabled"}
+	assert.True(t, endpointUpToDate(azure, &trafficmanager.EndpointConfig{EndpointType: "AzureEndpoints", TargetResourceID: "/subscriptions/x/ip", Weight: 1, Status: "Enabled"}))
+}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// namespaceDefaultsTTL is how long a namespace's defaults ConfigMap is cached
+const namespaceDefaultsTTL = time.Minute
+
+var configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// namespaceDefaults reads per-namespace annotation defaults from a ConfigMap of a fixed name
+// in the namespace of the source resource. A namespace without the ConfigMap has no defaults.
+type namespaceDefaults struct {
+	client dynamic.Interface
+	name   string
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedDefaults
+}
+
+type cachedDefaults struct {
+	defaults annotations.Defaults
+	expires  time.Time
+}
+
+func newNamespaceDefaults(client dynamic.Interface, name string) *namespaceDefaults {
+	return &namespaceDefaults{
+		client: client,
+		name:   name,
+		now:    time.Now,
+		cache:  make(map[string]cachedDefaults),
+	}
+}
+
+// get returns the defaults for namespace, reading the ConfigMap at most once per namespaceDefaultsTTL
+func (n *namespaceDefaults) get(ctx context.Context, namespace string) (annotations.Defaults, error) {
+	n.mu.Lock()
+	cached, ok := n.cache[namespace]
+	n.mu.Unlock()
+	if ok && n.now().Before(cached.expires) {
+		return cached.defaults, nil
+	}
+
+	defaults, err := n.read(ctx, namespace)
+	if err != nil {
+		return annotations.Defaults{}, err
+	}
+
+	n.mu.Lock()
+	n.cache[namespace] = cachedDefaults{defaults: defaults, expires: n.now().Add(namespaceDefaultsTTL)}
+	n.mu.Unlock()
+	return defaults, nil
+}
+
+func (n *namespaceDefaults) read(ctx context.Context, namespace string) (annotations.Defaults, error) {
+	obj, err := n.client.Resource(configMapGVR).Namespace(namespace).Get(ctx, n.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return annotations.Defaults{}, nil
+	}
+	if err != nil {
+		return annotations.Defaults{}, fmt.Errorf("failed to get defaults ConfigMap %s/%s: %w", namespace, n.name, err)
+	}
+
+	data, _, err := unstructured.NestedStringMap(obj.Object, "data")
+	if err != nil {
+		return annotations.Defaults{}, fmt.Errorf("failed to read defaults ConfigMap %s/%s: %w", namespace, n.name, err)
+	}
+
+	defaults, err := annotations.ParseDefaults(data)
+	if err != nil {
+		return annotations.Defaults{}, withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("invalid defaults ConfigMap %s/%s: %w", namespace, n.name, err))
+	}
+	return defaults, nil
+}
+
+// resourceNamespace returns the namespace from External DNS' "resource" label
+// (e.g. "service/default/my-service"), or "" if it isn't set
+func resourceNamespace(labels map[string]string) string {
+	parts := strings.Split(labels["resource"], "/")
+	if len(parts) != 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// resourceService returns the Service name from External DNS' "resource" label when the
+// source is a Service, or "" for other sources such as Ingresses
+func resourceService(labels map[string]string) string {
+	parts := strings.Split(labels["resource"], "/")
+	if len(parts) != 3 || parts[0] != "service" {
+		return ""
+	}
+	return parts[2]
+}
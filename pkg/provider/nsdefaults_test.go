@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newDefaultsConfigMap(namespace string, data map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "tm-defaults", "namespace": namespace},
+		"data":       data,
+	}}
+}
+
+func TestParseAnnotations_NamespaceDefaults(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newDefaultsConfigMap("team-a", map[string]interface{}{
+			"resource-group":    "team-a-rg",
+			"endpoint-location": "westeurope",
+		}))
+
+	p := &TrafficManagerProvider{
+		logger:            zaptest.NewLogger(t),
+		defaults:          annotations.Defaults{ResourceGroup: "global-rg", RoutingMethod: "Priority"},
+		namespaceDefaults: newNamespaceDefaults(client, "tm-defaults"),
+	}
+	ctx := context.Background()
+
+	config, err := p.parseAnnotations(ctx, map[string]string{
+		annotations.AnnotationEnabled: "true",
+		"resource":                    "service/team-a/myapp",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "team-a-rg", config.ResourceGroup, "namespace default overrides global default")
+	assert.Equal(t, "westeurope", config.EndpointLocation)
+	assert.Equal(t, "Priority", config.RoutingMethod, "global default applies when the namespace leaves it out")
+
+	config, err = p.parseAnnotations(ctx, map[string]string{
+		annotations.AnnotationEnabled:       "true",
+		annotations.AnnotationResourceGroup: "my-rg",
+		"resource":                          "service/team-a/myapp",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "my-rg", config.ResourceGroup, "annotation overrides namespace default")
+
+	// Namespaces without the ConfigMap use the global defaults
+	config, err = p.parseAnnotations(ctx, map[string]string{
+		annotations.AnnotationEnabled: "true",
+		"resource":                    "service/team-b/myapp",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "global-rg", config.ResourceGroup)
+	assert.Equal(t, "", config.EndpointLocation)
+}
+
+func TestParseAnnotations_InvalidNamespaceDefaults(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newDefaultsConfigMap("team-a", map[string]interface{}{"routing-method": "RoundRobin"}))
+
+	p := &TrafficManagerProvider{
+		logger:            zaptest.NewLogger(t),
+		namespaceDefaults: newNamespaceDefaults(client, "tm-defaults"),
+	}
+
+	_, err := p.parseAnnotations(context.Background(), map[string]string{
+		annotations.AnnotationEnabled: "true",
+		"resource":                    "service/team-a/myapp",
+	})
+	assert.ErrorContains(t, err, "invalid defaults ConfigMap team-a/tm-defaults")
+	assert.Equal(t, ErrorCodeInvalidAnnotation, errorCode(err))
+}
+
+func TestNamespaceDefaults_Caches(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(),
+		newDefaultsConfigMap("team-a", map[string]interface{}{"resource-group": "team-a-rg"}))
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	n := newNamespaceDefaults(client, "tm-defaults")
+	n.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := n.get(ctx, "team-a")
+	require.NoError(t, err)
+	_, err = n.get(ctx, "team-a")
+	require.NoError(t, err)
+	assert.Len(t, client.Actions(), 1, "second read is served from the cache")
+
+	now = now.Add(namespaceDefaultsTTL)
+	_, err = n.get(ctx, "team-a")
+	require.NoError(t, err)
+	assert.Len(t, client.Actions(), 2, "expired entry is read again")
+}
@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"go.uber.org/zap"
+)
+
+// percentMember is a record whose endpoints take a percentage of their profile's traffic
+type percentMember struct {
+	weight    int64 // The Azure weight of each of the record's endpoints
+	endpoints int
+}
+
+// percentChange is a create or update in percent weight mode, by its position in changes
+type percentChange struct {
+	endpoint *Endpoint
+	key      string // The profile the record belongs to
+	create   int    // Index into Create, or -1 for an update
+	update   int    // Index into UpdateNew, or -1 for a create
+}
+
+// checkWeightPercentages checks that, once changes are applied, the endpoints in percent weight
+// mode of each profile changes touches take 100% of its traffic between them. A profile's set is
+// worked out from scratch on every change to any member: the records in the batch replace the
+// stored configuration of the same record, and deleted records leave the set. Deletes alone are
+// not checked, so a record can always be removed; the rest then share its traffic in proportion.
+// The creates and updates of a profile that fails the check, or of every percent mode record when
+// the stored configurations can't be read, are recorded in applyErr and removed from the changes
+// returned, so the rest of the batch is still applied.
+func (p *TrafficManagerProvider) checkWeightPercentages(ctx context.Context, changes *Changes, applyErr *ApplyError) *Changes {
+	sets := make(map[string]map[string]percentMember)
+	touched := make(map[string]bool)
+
+	var storeErr error
+	if p.endpointConfigs != nil {
+		stored, err := p.endpointConfigs.all(ctx)
+		if err != nil {
+			storeErr = fmt.Errorf("failed to read stored endpoint configurations to check weight percentages: %w", err)
+		}
+		for id, config := range stored {
+			if config.WeightPercent <= 0 {
+				continue
+			}
+			record := &Endpoint{DNSName: config.DNSName, SetIdentifier: config.SetIdentifier, RecordType: config.RecordType, Targets: config.Targets}
+			addPercentMember(sets, recordProfileKey(config.Hostname, config.DNSName), id, percentMember{
+				weight:    annotations.PercentWeight(config.WeightPercent),
+				endpoints: len(endpointTargets(record)),
+			})
+		}
+	}
+
+	for _, endpoint := range changes.Delete {
+		removePercentMember(sets, endpointConfigID(endpoint))
+	}
+
+	var members []percentChange
+	add := func(endpoint *Endpoint, create, update int) {
+		if endpoint.RecordType == recordTypeTXT {
+			return
+		}
+		id := endpointConfigID(endpoint)
+		removePercentMember(sets, id)
+
+		config, err := p.parseAnnotations(ctx, endpoint.annotationMap())
+		if err != nil || !config.Enabled || config.WeightMode != annotations.WeightModePercent {
+			// Annotation errors are reported when the record itself is applied
+			return
+		}
+		key := recordProfileKey(config.Hostname, endpoint.DNSName)
+		addPercentMember(sets, key, id, percentMember{weight: config.Weight, endpoints: len(endpointTargets(endpoint))})
+		touched[key] = true
+		members = append(members, percentChange{endpoint: endpoint, key: key, create: create, update: update})
+	}
+	for i, endpoint := range changes.Create {
+		add(endpoint, i, -1)
+	}
+	for i, endpoint := range changes.UpdateNew {
+		add(endpoint, -1, i)
+	}
+
+	rejected := make(map[string]error)
+	for _, key := range sortedKeys(touched) {
+		if storeErr != nil {
+			rejected[key] = storeErr
+			continue
+		}
+
+		var total int64
+		for _, member := range sets[key] {
+			total += member.weight * int64(member.endpoints)
+		}
+		if total == annotations.MaxWeight {
+			continue
+		}
+
+		p.log(ctx).Warn("Rejecting changes whose weight percentages don't sum to 100",
+			zap.String("hostname", key),
+			zap.Strings("records", sortedKeys(sets[key])),
+			zap.Int64("totalWeight", total))
+		rejected[key] = withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("weight percentages of the endpoints of %s sum to %s%%, must sum to 100%% (records: %s)",
+			key, formatPercent(total), strings.Join(sortedKeys(sets[key]), ", ")))
+	}
+	if len(rejected) == 0 {
+		return changes
+	}
+
+	skipCreate := make(map[int]bool)
+	skipUpdate := make(map[int]bool)
+	for _, member := range members {
+		err, ok := rejected[member.key]
+		if !ok {
+			continue
+		}
+		if member.create >= 0 {
+			applyErr.add(changeActionCreate, member.endpoint, err)
+			skipCreate[member.create] = true
+		} else {
+			applyErr.add(changeActionUpdate, member.endpoint, err)
+			skipUpdate[member.update] = true
+		}
+	}
+
+	kept := &Changes{Delete: changes.Delete}
+	for i, endpoint := range changes.Create {
+		if !skipCreate[i] {
+			kept.Create = append(kept.Create, endpoint)
+		}
+	}
+	for i := range changes.UpdateNew {
+		if !skipUpdate[i] {
+			kept.UpdateOld = append(kept.UpdateOld, changes.UpdateOld[i])
+			kept.UpdateNew = append(kept.UpdateNew, changes.UpdateNew[i])
+		}
+	}
+	return kept
+}
+
+// recordProfileKey identifies the profile a record belongs to by its vanity hostname, before its
+// profile name is worked out
+func recordProfileKey(hostname, dnsName string) string {
+	if hostname == "" {
+		hostname = dnsName
+	}
+	return strings.ToLower(hostname)
+}
+
+func addPercentMember(sets map[string]map[string]percentMember, key, id string, member percentMember) {
+	if sets[key] == nil {
+		sets[key] = make(map[string]percentMember)
+	}
+	sets[key][id] = member
+}
+
+// removePercentMember removes the record id from whichever set holds it, as a changed record may
+// have moved to another profile
+func removePercentMember(sets map[string]map[string]percentMember, id string) {
+	for _, set := range sets {
+		delete(set, id)
+	}
+}
+
+// formatPercent formats a total Azure weight of percent mode endpoints as a percentage
+func formatPercent(weight int64) string {
+	return strconv.FormatFloat(float64(weight)/annotations.PercentWeightScale, 'f', -1, 64)
+}
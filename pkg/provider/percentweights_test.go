@@ -0,0 +1,138 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// percentRecord returns a record taking percent of app.example.com's traffic
+func percentRecord(setIdentifier, target, percent string) *Endpoint {
+	return &Endpoint{
+		DNSName:       "app.example.com",
+		SetIdentifier: setIdentifier,
+		RecordType:    "CNAME",
+		Targets:       []string{target},
+		Labels: map[string]string{
+			annotations.AnnotationEnabled:       "true",
+			annotations.AnnotationResourceGroup: "tm-rg",
+			annotations.AnnotationWeightMode:    annotations.WeightModePercent,
+			annotations.AnnotationWeight:        percent,
+		},
+	}
+}
+
+// checkWeightPercentages returns the error of the records checkWeightPercentages rejects, and the changes it keeps
+func checkWeightPercentages(ctx context.Context, p *TrafficManagerProvider, changes *Changes) (*Changes, error) {
+	applyErr := &ApplyError{}
+	kept := p.checkWeightPercentages(ctx, changes, applyErr)
+	return kept, applyErr.errOrNil()
+}
+
+func TestCheckWeightPercentages(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger:          zaptest.NewLogger(t),
+		endpointConfigs: newEndpointConfigs(nil, zaptest.NewLogger(t)),
+	}
+	ctx := context.Background()
+	check := func(changes *Changes) error {
+		_, err := checkWeightPercentages(ctx, p, changes)
+		return err
+	}
+
+	east := percentRecord("east", "east.example.net", "70")
+	west := percentRecord("west", "west.example.net", "30")
+	require.NoError(t, check(&Changes{Create: []*Endpoint{east, west}}))
+
+	err := check(&Changes{Create: []*Endpoint{east, percentRecord("west", "west.example.net", "20")}})
+	require.Error(t, err)
+	assert.Equal(t, ErrorCodeInvalidAnnotation, errorCode(err))
+	assert.Contains(t, err.Error(), "sum to 90%")
+
+	// Once applied, the records are members of the profile's set for later changes
+	for _, record := range []*Endpoint{east, west} {
+		config, err := p.parseAnnotations(ctx, record.annotationMap())
+		require.NoError(t, err)
+		p.rememberEndpointConfig(ctx, record, config)
+	}
+
+	// Changing one member alone breaks the total; changing two together keeps it
+	err = check(&Changes{UpdateOld: []*Endpoint{east}, UpdateNew: []*Endpoint{percentRecord("east", "east.example.net", "60")}})
+	assert.ErrorContains(t, err, "sum to 90%")
+	assert.NoError(t, check(&Changes{
+		UpdateOld: []*Endpoint{east, west},
+		UpdateNew: []*Endpoint{percentRecord("east", "east.example.net", "60"), percentRecord("west", "west.example.net", "40")},
+	}))
+
+	// A new member must come with room made for it
+	north := percentRecord("north", "north.example.net", "10")
+	assert.ErrorContains(t, check(&Changes{Create: []*Endpoint{north}}), "sum to 110%")
+	assert.NoError(t, check(&Changes{
+		Create:    []*Endpoint{north},
+		UpdateOld: []*Endpoint{east},
+		UpdateNew: []*Endpoint{percentRecord("east", "east.example.net", "60")},
+	}))
+
+	// Deletes alone are let through
+	assert.NoError(t, check(&Changes{Delete: []*Endpoint{west}}))
+}
+
+func TestCheckWeightPercentages_KeepsOtherRecords(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger:          zaptest.NewLogger(t),
+		endpointConfigs: newEndpointConfigs(nil, zaptest.NewLogger(t)),
+	}
+	ctx := context.Background()
+
+	other := &Endpoint{DNSName: "other.example.com", RecordType: "A", Targets: []string{"203.0.113.10"}}
+	east := percentRecord("east", "east.example.net", "70")
+	west := percentRecord("west", "west.example.net", "20")
+	gone := &Endpoint{DNSName: "gone.example.com", RecordType: "A", Targets: []string{"203.0.113.20"}}
+
+	kept, err := checkWeightPercentages(ctx, p, &Changes{
+		Create:    []*Endpoint{east, other},
+		UpdateOld: []*Endpoint{west},
+		UpdateNew: []*Endpoint{west},
+		Delete:    []*Endpoint{gone},
+	})
+
+	var applyErr *ApplyError
+	require.ErrorAs(t, err, &applyErr)
+	require.Len(t, applyErr.Failures, 2)
+	assert.Equal(t, "create", applyErr.Failures[0].Action)
+	assert.Equal(t, "update", applyErr.Failures[1].Action)
+	assert.Equal(t, ErrorCodeInvalidAnnotation, applyErr.Failures[0].Code)
+	assert.Equal(t, &Changes{Create: []*Endpoint{other}, Delete: []*Endpoint{gone}}, kept, "the other records are still applied")
+}
+
+func TestCheckWeightPercentages_StoreUnreadable(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	client.PrependReactor("get", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	store, err := newConfigMapStore(client, "external-dns/tm-endpoints", endpointConfigKey)
+	require.NoError(t, err)
+	p := &TrafficManagerProvider{
+		logger:          zaptest.NewLogger(t),
+		endpointConfigs: newEndpointConfigs(store, zaptest.NewLogger(t)),
+	}
+
+	other := &Endpoint{DNSName: "other.example.com", RecordType: "A", Targets: []string{"203.0.113.10"}}
+	east := percentRecord("east", "east.example.net", "100")
+	kept, err := checkWeightPercentages(context.Background(), p, &Changes{Create: []*Endpoint{east, other}})
+
+	var applyErr *ApplyError
+	require.ErrorAs(t, err, &applyErr)
+	require.Len(t, applyErr.Failures, 1)
+	assert.Equal(t, "app.example.com", applyErr.Failures[0].DNSName)
+	assert.Contains(t, applyErr.Failures[0].Message, "connection refused")
+	assert.Equal(t, []*Endpoint{other}, kept.Create, "records outside percent weight mode don't need the check")
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// eventReasonPermissionsMissing is the reason of the event recorded on the webhook's Pod when the
+// identity lacks actions on a resource group
+const eventReasonPermissionsMissing = "TrafficManagerPermissionsMissing"
+
+// ResourceGroupPermissions is the outcome of checking the identity's role on one configured resource group
+type ResourceGroupPermissions struct {
+	ResourceGroup  string   `json:"resourceGroup"` // As configured, <subscription-id>/<resource-group> outside the default subscription
+	MissingActions []string `json:"missingActions,omitempty"`
+	Error          string   `json:"error,omitempty"` // The identity's permissions couldn't be read
+}
+
+// Problem describes what is wrong with the identity's access to the resource group and how to
+// fix it, or returns "" when nothing is
+func (r ResourceGroupPermissions) Problem() string {
+	switch {
+	case r.Error != "":
+		return fmt.Sprintf("couldn't read permissions on resource group %s: %s", r.ResourceGroup, r.Error)
+	case len(r.MissingActions) > 0:
+		return fmt.Sprintf("identity lacks %s on resource group %s; assign it the %s role on the resource group",
+			strings.Join(r.MissingActions, ", "), r.ResourceGroup, trafficmanager.ContributorRole)
+	}
+	return ""
+}
+
+// permissionProbe holds the results of the last ProbePermissions
+type permissionProbe struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	results   []ResourceGroupPermissions
+}
+
+// CheckPermissions reads the identity's effective permissions on each configured resource group
+// and reports the actions the webhook needs that they don't grant
+func (p *TrafficManagerProvider) CheckPermissions(ctx context.Context) []ResourceGroupPermissions {
+	var results []ResourceGroupPermissions
+	for _, rg := range p.configuredResourceGroups() {
+		result := ResourceGroupPermissions{ResourceGroup: rg.label}
+
+		tmClient, err := p.clientFor(rg.subscriptionID, rg.resourceGroup)
+		if err == nil {
+			result.MissingActions, err = tmClient.MissingActions(ctx, rg.resourceGroup)
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// ProbePermissions runs CheckPermissions and keeps the results for readiness and health checks.
+// Each problem is logged, and recorded as an event on the webhook's Pod when it is new, so a
+// missing role assignment is found before ApplyChanges fails with 403s.
+func (p *TrafficManagerProvider) ProbePermissions(ctx context.Context) []ResourceGroupPermissions {
+	results := p.CheckPermissions(ctx)
+
+	probe := &p.permissions
+	probe.mu.Lock()
+	previous := make(map[string]string, len(probe.results))
+	for _, result := range probe.results {
+		previous[result.ResourceGroup] = result.Problem()
+	}
+	probe.results = results
+	probe.checkedAt = p.now()
+	probe.mu.Unlock()
+
+	for _, result := range results {
+		problem := result.Problem()
+		if problem == "" {
+			if previous[result.ResourceGroup] != "" {
+				p.log(ctx).Info("Traffic Manager permissions on resource group are now sufficient",
+					zap.String("resourceGroup", result.ResourceGroup))
+			}
+			continue
+		}
+
+		p.log(ctx).Warn("Traffic Manager permission check failed",
+			zap.String("resourceGroup", result.ResourceGroup),
+			zap.Strings("missingActions", result.MissingActions),
+			zap.String("problem", problem))
+		if problem != previous[result.ResourceGroup] {
+			p.events.warnPod(ctx, p.pod, eventReasonPermissionsMissing, problem)
+		}
+	}
+	return results
+}
+
+// PermissionWarnings returns the problems found by the last ProbePermissions
+func (p *TrafficManagerProvider) PermissionWarnings() []string {
+	probe := &p.permissions
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+
+	var warnings []string
+	for _, result := range probe.results {
+		if problem := result.Problem(); problem != "" {
+			warnings = append(warnings, problem)
+		}
+	}
+	return warnings
+}
+
+// permissionsHealth reports the results of the last ProbePermissions
+func (p *TrafficManagerProvider) permissionsHealth() DependencyHealth {
+	probe := &p.permissions
+	probe.mu.Lock()
+	checkedAt, checked := probe.checkedAt, len(probe.results)
+	probe.mu.Unlock()
+
+	health := DependencyHealth{Name: "azurePermissions", Status: DependencyOK}
+	if checkedAt.IsZero() {
+		health.Status = DependencyDisabled
+		health.Detail = "permissions have not been probed"
+		return health
+	}
+	health.Detail = fmt.Sprintf("%d resource groups checked %s ago", checked, p.now().Sub(checkedAt).Round(time.Second))
+	if warnings := p.PermissionWarnings(); len(warnings) > 0 {
+		health.Status = DependencyFailed
+		health.Error = strings.Join(warnings, "; ")
+	}
+	return health
+}
+
+// RunPermissionProbe runs ProbePermissions straight away and then every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunPermissionProbe(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.ProbePermissions(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
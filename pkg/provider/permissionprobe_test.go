@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestProbePermissions(t *testing.T) {
+	azure := fakeazure.New()
+	azure.SetPermissions("sub", "read-only-rg", "*/read")
+	p, err := NewTrafficManagerProvider(&Config{
+		SubscriptionID: "sub",
+		Credential:     fakeazure.Credential{},
+		ClientOptions:  trafficmanager.ClientOptions{Transport: azure},
+		ResourceGroups: []string{"tm-rg", "read-only-rg"},
+		PodName:        "webhook-0",
+		PodNamespace:   "external-dns",
+	}, nil, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{eventGVR: "EventList"})
+	p.events = newEventRecorder(client, zaptest.NewLogger(t))
+	p.readiness.ping = func(context.Context) error { return nil }
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+	ctx := context.Background()
+
+	assert.Equal(t, DependencyDisabled, p.permissionsHealth().Status, "not probed yet")
+
+	results := p.ProbePermissions(ctx)
+	require.Len(t, results, 2)
+	assert.Empty(t, results[0].Problem())
+	assert.Equal(t, "read-only-rg", results[1].ResourceGroup)
+	assert.NotContains(t, results[1].MissingActions, "Microsoft.Network/trafficManagerProfiles/read")
+	assert.Contains(t, results[1].MissingActions, "Microsoft.Network/trafficManagerProfiles/write")
+	assert.Contains(t, results[1].Problem(), "assign it the Traffic Manager Contributor role")
+
+	// The problem is recorded once on the webhook's Pod, not on every probe
+	p.ProbePermissions(ctx)
+	recorded, err := client.Resource(eventGVR).Namespace("external-dns").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, recorded.Items, 1)
+	kind, _, _ := unstructured.NestedString(recorded.Items[0].Object, "involvedObject", "kind")
+	name, _, _ := unstructured.NestedString(recorded.Items[0].Object, "involvedObject", "name")
+	reason, _, _ := unstructured.NestedString(recorded.Items[0].Object, "reason")
+	assert.Equal(t, "Pod", kind)
+	assert.Equal(t, "webhook-0", name)
+	assert.Equal(t, eventReasonPermissionsMissing, reason)
+
+	// Readiness lists the problem without failing
+	rec := httptest.NewRecorder()
+	s.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"warnings":["identity lacks Microsoft.Network/trafficManagerProfiles/write`)
+	assert.Equal(t, DependencyFailed, p.permissionsHealth().Status)
+
+	// Once the role is assigned the warning clears
+	azure.SetPermissions("sub", "read-only-rg", "Microsoft.Network/trafficManagerProfiles/*")
+	p.ProbePermissions(ctx)
+	assert.Empty(t, p.PermissionWarnings())
+	assert.Equal(t, DependencyOK, p.permissionsHealth().Status)
+}
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+// permissionCheckProfilePrefix starts the names of the profiles a write check creates and deletes.
+// Without the managedBy tag or the -tm suffix they are never synced as managed profiles.
+const permissionCheckProfilePrefix = "tm-webhook-permission-check-"
+
+// ResourceGroupAccess is the outcome of checking the webhook's access to one configured resource group
+type ResourceGroupAccess struct {
+	ResourceGroup string // As configured, <subscription-id>/<resource-group> outside the default subscription
+	ReadErr       error  // Listing the resource group's profiles failed
+	WriteChecked  bool
+	WriteErr      error // Creating or deleting a disabled profile failed
+}
+
+// CheckResourceGroupAccess lists the profiles of each configured resource group. With write it
+// also creates and deletes a disabled profile in each, proving the identity can manage profiles
+// there. A profile whose delete fails is named in WriteErr so it can be removed by hand.
+func (p *TrafficManagerProvider) CheckResourceGroupAccess(ctx context.Context, write bool) []ResourceGroupAccess {
+	var results []ResourceGroupAccess
+	for _, rg := range p.configuredResourceGroups() {
+		access := ResourceGroupAccess{ResourceGroup: rg.label}
+
+		tmClient, err := p.clientFor(rg.subscriptionID, rg.resourceGroup)
+		if err != nil {
+			access.ReadErr = err
+			results = append(results, access)
+			continue
+		}
+
+		if _, err := tmClient.ListProfiles(ctx, rg.resourceGroup); err != nil {
+			access.ReadErr = err
+		}
+		if write {
+			access.WriteChecked = true
+			access.WriteErr = checkProfileWrite(ctx, tmClient, rg.resourceGroup)
+		}
+		results = append(results, access)
+	}
+	return results
+}
+
+// configuredResourceGroup is a configured resource group with its subscription resolved
+type configuredResourceGroup struct {
+	subscriptionID string
+	resourceGroup  string
+	label          string // As configured, <subscription-id>/<resource-group> outside the default subscription
+}
+
+// configuredResourceGroups returns the configured resource groups, grouped by subscription
+func (p *TrafficManagerProvider) configuredResourceGroups() []configuredResourceGroup {
+	var groups []configuredResourceGroup
+	grouped := resourceGroupsBySubscription(p.resourceGroups, p.subscriptionID)
+	for _, subscriptionID := range sortedKeys(grouped) {
+		for _, resourceGroup := range grouped[subscriptionID] {
+			rg := configuredResourceGroup{subscriptionID: subscriptionID, resourceGroup: resourceGroup, label: resourceGroup}
+			if subscriptionID != p.subscriptionID {
+				rg.label = subscriptionID + "/" + resourceGroup
+			}
+			groups = append(groups, rg)
+		}
+	}
+	return groups
+}
+
+// checkProfileWrite creates a disabled profile in resourceGroup and deletes it again
+func checkProfileWrite(ctx context.Context, tmClient *trafficmanager.Client, resourceGroup string) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := permissionCheckProfilePrefix + hex.EncodeToString(suffix)
+
+	_, err := tmClient.CreateProfile(ctx, &trafficmanager.ProfileConfig{
+		ProfileName:     name,
+		ResourceGroup:   resourceGroup,
+		Location:        "global",
+		RoutingMethod:   "Weighted",
+		DNSTTL:          60,
+		MonitorProtocol: "HTTPS",
+		MonitorPort:     443,
+		MonitorPath:     "/",
+		ProfileStatus:   "Disabled",
+	})
+	if err != nil {
+		return err
+	}
+	if err := tmClient.DeleteProfile(ctx, resourceGroup, name); err != nil {
+		return fmt.Errorf("created profile %s but couldn't delete it: %w", name, err)
+	}
+	return nil
+}
+
+// CheckDNSEndpointAccess checks the webhook's service account may manage DNSEndpoints. It
+// reports false when vanity hostnames aren't published as DNSEndpoints, so there is nothing to check.
+func (p *TrafficManagerProvider) CheckDNSEndpointAccess(ctx context.Context) (bool, error) {
+	if p.vanityRecordMode != VanityRecordModeDNSEndpoint || p.dnsEndpointManager == nil {
+		return false, nil
+	}
+	return true, p.dnsEndpointManager.CheckAccess(ctx)
+}
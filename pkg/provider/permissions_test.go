@@ -0,0 +1,62 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// denyWrites answers writes to a resource group with 403, as ARM does without a write role
+type denyWrites struct {
+	azure         *fakeazure.Server
+	resourceGroup string
+}
+
+func (d denyWrites) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && strings.Contains(strings.ToLower(req.URL.Path), "/resourcegroups/"+d.resourceGroup+"/") {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Content-Type", "application/json")
+		rec.WriteHeader(http.StatusForbidden)
+		rec.WriteString(`{"error":{"code":"AuthorizationFailed","message":"The client does not have authorization to perform action"}}`)
+		resp := rec.Result()
+		resp.Request = req
+		return resp, nil
+	}
+	return d.azure.Do(req)
+}
+
+func TestCheckResourceGroupAccess(t *testing.T) {
+	azure := fakeazure.New()
+	p, err := NewTrafficManagerProvider(&Config{
+		SubscriptionID: "sub",
+		Credential:     fakeazure.Credential{},
+		ClientOptions:  trafficmanager.ClientOptions{Transport: denyWrites{azure: azure, resourceGroup: "read-only-rg"}},
+		ResourceGroups: []string{"tm-rg", "read-only-rg"},
+	}, nil, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	// Reads only
+	access := p.CheckResourceGroupAccess(context.Background(), false)
+	require.Len(t, access, 2)
+	for _, rg := range access {
+		assert.NoError(t, rg.ReadErr, rg.ResourceGroup)
+		assert.False(t, rg.WriteChecked)
+	}
+
+	// The write check leaves no profile behind
+	access = p.CheckResourceGroupAccess(context.Background(), true)
+	require.Len(t, access, 2)
+	assert.Equal(t, "tm-rg", access[0].ResourceGroup)
+	assert.NoError(t, access[0].WriteErr)
+	assert.Equal(t, "read-only-rg", access[1].ResourceGroup)
+	assert.True(t, trafficmanager.IsAuthorizationFailed(access[1].WriteErr), "got %v", access[1].WriteErr)
+	assert.Empty(t, azure.ProfileNames())
+}
@@ -0,0 +1,414 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"go.uber.org/zap"
+)
+
+// Actions of planned operations
+const (
+	PlanActionCreateProfile  = "create-profile"
+	PlanActionUpdateProfile  = "update-profile"
+	PlanActionDeleteProfile  = "delete-profile"
+	PlanActionCreateEndpoint = "create-endpoint"
+	PlanActionUpdateEndpoint = "update-endpoint"
+	PlanActionDrainEndpoint  = "drain-endpoint"
+	PlanActionDeleteEndpoint = "delete-endpoint"
+)
+
+// PlanOperation is a Traffic Manager operation ApplyChanges would perform
+type PlanOperation struct {
+	Action        string `json:"action"`
+	DNSName       string `json:"dnsName"` // Record the operation comes from
+	ResourceGroup string `json:"resourceGroup"`
+	ProfileName   string `json:"profileName"`
+	EndpointName  string `json:"endpointName,omitempty"`
+	Target        string `json:"target,omitempty"`
+	OldWeight     int64  `json:"oldWeight,omitempty"`
+	Weight        int64  `json:"weight,omitempty"`
+	OldStatus     string `json:"oldStatus,omitempty"`
+	Status        string `json:"status,omitempty"`
+	Note          string `json:"note,omitempty"`
+}
+
+// PlanSkip is a change ApplyChanges would leave alone
+type PlanSkip struct {
+	DNSName string `json:"dnsName"`
+	Reason  string `json:"reason"`
+}
+
+// PlanError is a change ApplyChanges would fail on
+type PlanError struct {
+	DNSName string `json:"dnsName"`
+	Error   string `json:"error"`
+}
+
+// Plan is the body returned by POST /plan
+type Plan struct {
+	Operations []PlanOperation `json:"operations"`
+	Skipped    []PlanSkip      `json:"skipped,omitempty"`
+	Errors     []PlanError     `json:"errors,omitempty"`
+}
+
+// planner accumulates the operations of one plan
+type planner struct {
+	p               *TrafficManagerProvider
+	plan            *Plan
+	createdProfiles map[string]bool            // profileKey of profiles the plan creates
+	deletedProfiles map[string]bool            // profileKey of profiles the plan deletes
+	removed         map[string]map[string]bool // Endpoint names the plan deletes, by profileKey
+	nameClaims      endpointNameClaims
+}
+
+// PlanChanges returns the Traffic Manager operations ApplyChanges would perform for changes,
+// without writing anything. The plan is worked out from the annotations and the cached state of
+// the profiles, so it doesn't account for changes made in Azure since the last sync, profile
+// name collisions, or addresses of Azure public IPs becoming AzureEndpoints.
+func (p *TrafficManagerProvider) PlanChanges(ctx context.Context, changes *Changes) (*Plan, error) {
+	if len(changes.UpdateOld) != len(changes.UpdateNew) {
+		return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("updateOld has %d endpoints but updateNew has %d", len(changes.UpdateOld), len(changes.UpdateNew)))
+	}
+
+	pl := &planner{
+		p:               p,
+		plan:            &Plan{Operations: []PlanOperation{}},
+		createdProfiles: make(map[string]bool),
+		deletedProfiles: make(map[string]bool),
+		removed:         make(map[string]map[string]bool),
+		nameClaims:      make(endpointNameClaims),
+	}
+	freeze := p.FreezeStatus()
+
+	for _, endpoint := range changes.Create {
+		if pl.skipped(endpoint, freeze) {
+			continue
+		}
+		pl.record(endpoint, pl.create(ctx, endpoint))
+	}
+	for i := range changes.UpdateNew {
+		if pl.skipped(changes.UpdateNew[i], freeze) {
+			continue
+		}
+		pl.record(changes.UpdateNew[i], pl.update(ctx, changes.UpdateOld[i], changes.UpdateNew[i]))
+	}
+	for _, endpoint := range changes.Delete {
+		if pl.skipped(endpoint, freeze) {
+			continue
+		}
+		if !p.mayDelete() {
+			pl.skip(endpoint, "deletes are skipped by the upsert-only policy")
+			continue
+		}
+		pl.record(endpoint, pl.delete(ctx, endpoint))
+	}
+
+	p.log(ctx).Info("Planned changes",
+		zap.Int("operations", len(pl.plan.Operations)),
+		zap.Int("skipped", len(pl.plan.Skipped)),
+		zap.Int("errors", len(pl.plan.Errors)))
+	return pl.plan, nil
+}
+
+// skipped reports whether a change is left alone regardless of its annotations, recording why
+func (pl *planner) skipped(endpoint *Endpoint, freeze FreezeStatus) bool {
+	if endpoint.RecordType == recordTypeTXT {
+		return true
+	}
+	if freeze.Frozen && !hasFreezeOverride(endpoint) {
+		pl.skip(endpoint, fmt.Sprintf("deferred until the freeze window %s ends", freeze.Window))
+		return true
+	}
+	return false
+}
+
+func (pl *planner) skip(endpoint *Endpoint, reason string) {
+	pl.plan.Skipped = append(pl.plan.Skipped, PlanSkip{DNSName: endpoint.DNSName, Reason: reason})
+}
+
+// record records the error ApplyChanges would fail with, if any
+func (pl *planner) record(endpoint *Endpoint, err error) {
+	if err != nil {
+		pl.plan.Errors = append(pl.plan.Errors, PlanError{DNSName: endpoint.DNSName, Error: err.Error()})
+	}
+}
+
+func (pl *planner) add(op PlanOperation) {
+	pl.plan.Operations = append(pl.plan.Operations, op)
+}
+
+// config returns the validated configuration of a Traffic Manager enabled endpoint, or nil
+func (pl *planner) config(ctx context.Context, endpoint *Endpoint) (*annotations.TrafficManagerConfig, error) {
+	config, err := pl.p.parseAnnotations(ctx, endpoint.annotationMap())
+	if err != nil {
+		return nil, withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("failed to parse annotations: %w", err))
+	}
+	if !config.Enabled {
+		return nil, nil
+	}
+	if err := annotations.ValidateConfig(config); err != nil {
+		return nil, withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("invalid Traffic Manager configuration: %w", err))
+	}
+	if err := pl.p.resourcePolicy.check(sourceNamespace(endpoint), config.SubscriptionID, config.ResourceGroup); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// create plans the operations of createEndpoint
+func (pl *planner) create(ctx context.Context, endpoint *Endpoint) error {
+	p := pl.p
+	config, err := pl.config(ctx, endpoint)
+	if err != nil || config == nil {
+		return err
+	}
+	if err := p.checkVanityRecordType(config.VanityRecordType); err != nil {
+		return withCode(ErrorCodeInvalidAnnotation, err)
+	}
+
+	vanityHostname := config.Hostname
+	if vanityHostname == "" {
+		vanityHostname = endpoint.DNSName
+	}
+	if config.ProfileName == "" {
+		if config.ProfileName, err = p.profileNameFor(config, endpoint, vanityHostname); err != nil {
+			return err
+		}
+	}
+	if config.EndpointName == "" {
+		if config.EndpointName, err = p.renderEndpointName(config, endpoint, vanityHostname, ""); err != nil {
+			return err
+		}
+	}
+
+	targets := endpointTargets(endpoint)
+	if err := p.checkQuota(sourceNamespace(endpoint), vanityHostname, targets); err != nil {
+		return err
+	}
+
+	key := profileKey(config.ResourceGroup, config.ProfileName)
+	if _, ok := p.stateManager.GetProfile(vanityHostname); !ok && !pl.createdProfiles[key] {
+		pl.createdProfiles[key] = true
+		pl.add(PlanOperation{
+			Action:        PlanActionCreateProfile,
+			DNSName:       endpoint.DNSName,
+			ResourceGroup: config.ResourceGroup,
+			ProfileName:   config.ProfileName,
+		})
+	}
+
+	for i, target := range targets {
+		endpointConfig := toEndpointConfig(config, target)
+		endpointConfig.EndpointName = p.targetEndpointName(pl.nameClaims, config, endpoint, vanityHostname, target, i)
+
+		op := PlanOperation{
+			Action:        PlanActionCreateEndpoint,
+			DNSName:       endpoint.DNSName,
+			ResourceGroup: config.ResourceGroup,
+			ProfileName:   config.ProfileName,
+			EndpointName:  endpointConfig.EndpointName,
+			Target:        target,
+			Weight:        plannedCanaryWeight(config, 0, endpointConfig.Weight),
+			Status:        p.scheduledStatus(config, endpointConfig.Status),
+		}
+		if existing, ok := p.stateManager.GetEndpoint(vanityHostname, endpointConfig.EndpointName); ok {
+			op.OldWeight = existing.Weight
+			op.OldStatus = existing.Status
+		}
+		if op.Weight != endpointConfig.Weight {
+			op.Note = fmt.Sprintf("canary towards weight %d", endpointConfig.Weight)
+		}
+		pl.add(op)
+	}
+	return nil
+}
+
+// update plans the operations of updateEndpoint
+func (pl *planner) update(ctx context.Context, oldEndpoint, newEndpoint *Endpoint) error {
+	p := pl.p
+	newConfig, err := pl.config(ctx, newEndpoint)
+	if err != nil || newConfig == nil {
+		return err
+	}
+	oldConfig, _ := p.parseAnnotations(ctx, oldEndpoint.annotationMap())
+
+	vanityHostname := newConfig.Hostname
+	if vanityHostname == "" {
+		vanityHostname = newEndpoint.DNSName
+	}
+	if newConfig.ProfileName == "" {
+		if newConfig.ProfileName, err = p.profileNameFor(newConfig, newEndpoint, vanityHostname); err != nil {
+			return err
+		}
+	}
+	if newConfig.EndpointName == "" {
+		if newConfig.EndpointName, err = p.renderEndpointName(newConfig, newEndpoint, vanityHostname, ""); err != nil {
+			return err
+		}
+	}
+
+	tagsChanged := oldConfig != nil && !maps.Equal(oldConfig.Tags, newConfig.Tags)
+	if cached, ok := p.stateManager.GetProfile(vanityHostname); ok && !hasTags(cached.Tags, newConfig.Tags) {
+		tagsChanged = true
+	}
+	if oldConfig == nil || tagsChanged ||
+		oldConfig.RoutingMethod != newConfig.RoutingMethod ||
+		oldConfig.DNSTTL != newConfig.DNSTTL ||
+		oldConfig.MonitorProtocol != newConfig.MonitorProtocol ||
+		oldConfig.MonitorPort != newConfig.MonitorPort ||
+		oldConfig.MonitorPath != newConfig.MonitorPath ||
+		oldConfig.ProfileStatus != newConfig.ProfileStatus ||
+		oldConfig.TrafficViewEnabled != newConfig.TrafficViewEnabled ||
+		oldConfig.DeletionProtection != newConfig.DeletionProtection {
+		pl.add(PlanOperation{
+			Action:        PlanActionUpdateProfile,
+			DNSName:       newEndpoint.DNSName,
+			ResourceGroup: newConfig.ResourceGroup,
+			ProfileName:   newConfig.ProfileName,
+			Note:          "skipped if other clusters have endpoints in the profile",
+		})
+	}
+
+	if oldConfig == nil ||
+		(oldConfig.Weight == newConfig.Weight && oldConfig.EndpointStatus == newConfig.EndpointStatus &&
+			oldConfig.DisableSchedule.String() == newConfig.DisableSchedule.String() &&
+			oldConfig.EnableSchedule.String() == newConfig.EnableSchedule.String()) {
+		return nil
+	}
+
+	targets := endpointTargets(newEndpoint)
+	p.claimRetargetedNames(pl.nameClaims, newConfig, newEndpoint, oldEndpoint, vanityHostname, targets)
+	for i, target := range targets {
+		endpointConfig := toEndpointConfig(newConfig, target)
+		endpointConfig.EndpointName = p.targetEndpointName(pl.nameClaims, newConfig, newEndpoint, vanityHostname, target, i)
+		op := PlanOperation{
+			Action:        PlanActionUpdateEndpoint,
+			DNSName:       newEndpoint.DNSName,
+			ResourceGroup: newConfig.ResourceGroup,
+			ProfileName:   newConfig.ProfileName,
+			EndpointName:  endpointConfig.EndpointName,
+			Target:        target,
+			OldWeight:     oldConfig.Weight,
+			OldStatus:     oldConfig.EndpointStatus,
+			Status:        p.scheduledStatus(newConfig, endpointConfig.Status),
+		}
+		if existing, ok := p.stateManager.GetEndpoint(vanityHostname, endpointConfig.EndpointName); ok {
+			if existing.Weight > 0 {
+				op.OldWeight = existing.Weight
+			}
+			op.OldStatus = existing.Status
+		}
+
+		if newConfig.CanaryStepPercent > 0 {
+			op.Weight = plannedCanaryWeight(newConfig, op.OldWeight, endpointConfig.Weight)
+		} else if op.Weight, err = p.guardWeightChange(vanityHostname, endpointConfig.EndpointName, oldConfig.Weight, endpointConfig.Weight, newConfig.AllowLargeWeightChange); err != nil {
+			return err
+		}
+		if op.Weight != endpointConfig.Weight {
+			op.Note = fmt.Sprintf("limited on the way to weight %d", endpointConfig.Weight)
+		}
+		pl.add(op)
+	}
+	return nil
+}
+
+// delete plans the operations of deleteEndpoint
+func (pl *planner) delete(ctx context.Context, endpoint *Endpoint) error {
+	p := pl.p
+	config, err := p.parseAnnotations(ctx, endpoint.annotationMap())
+	if err != nil {
+		return withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("failed to parse annotations: %w", err))
+	}
+	p.storedConfigForDelete(ctx, config, endpoint)
+	if !config.Enabled {
+		return nil
+	}
+	if err := p.resourcePolicy.check(sourceNamespace(endpoint), config.SubscriptionID, config.ResourceGroup); err != nil {
+		return err
+	}
+
+	vanityHostname := config.Hostname
+	if vanityHostname == "" {
+		vanityHostname = endpoint.DNSName
+	}
+	if config.ProfileName == "" {
+		if config.ProfileName, err = p.profileNameFor(config, endpoint, vanityHostname); err != nil {
+			return err
+		}
+	}
+	if config.EndpointName == "" {
+		if config.EndpointName, err = p.renderEndpointName(config, endpoint, vanityHostname, ""); err != nil {
+			return err
+		}
+	}
+
+	tmClient, err := p.clientFor(config.SubscriptionID, config.ResourceGroup)
+	if err != nil {
+		return err
+	}
+	owner, other, err := p.endpointOwnedByOtherCluster(ctx, tmClient, config, vanityHostname)
+	if err != nil {
+		return err
+	}
+	if other {
+		pl.skip(endpoint, fmt.Sprintf("endpoint %s is managed by cluster %s", config.EndpointName, owner))
+		return nil
+	}
+
+	op := PlanOperation{
+		Action:        PlanActionDeleteEndpoint,
+		DNSName:       endpoint.DNSName,
+		ResourceGroup: config.ResourceGroup,
+		ProfileName:   config.ProfileName,
+		EndpointName:  config.EndpointName,
+	}
+	if existing, ok := p.stateManager.GetEndpoint(vanityHostname, config.EndpointName); ok {
+		op.Target = existing.Target
+		op.OldWeight = existing.Weight
+		op.OldStatus = existing.Status
+	}
+	if p.drainEndpoints() {
+		// The profile outlives a drained endpoint, so it isn't deleted in this apply
+		op.Action = PlanActionDrainEndpoint
+		op.Note = fmt.Sprintf("taken out of rotation by %s and deleted once cached answers expire", p.endpointDrain)
+		pl.add(op)
+		return nil
+	}
+	pl.add(op)
+
+	key := profileKey(config.ResourceGroup, config.ProfileName)
+	if pl.removed[key] == nil {
+		pl.removed[key] = make(map[string]bool)
+	}
+	pl.removed[key][config.EndpointName] = true
+
+	profile, ok := p.stateManager.GetProfile(vanityHostname)
+	if !ok || pl.deletedProfiles[key] || deletionProtected(config, profile) {
+		return nil
+	}
+	for name := range profile.Endpoints {
+		if name != FallbackEndpointName && !pl.removed[key][name] {
+			return nil
+		}
+	}
+	pl.deletedProfiles[key] = true
+	pl.add(PlanOperation{
+		Action:        PlanActionDeleteProfile,
+		DNSName:       endpoint.DNSName,
+		ResourceGroup: config.ResourceGroup,
+		ProfileName:   config.ProfileName,
+	})
+	return nil
+}
+
+// plannedCanaryWeight returns the weight canaryWeight would apply, without starting a canary
+func plannedCanaryWeight(config *annotations.TrafficManagerConfig, start, target int64) int64 {
+	if config.CanaryStepPercent == 0 || start == target {
+		return target
+	}
+	return newCanary(config, "", "", start, target, time.Time{}).Weight
+}
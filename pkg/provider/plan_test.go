@@ -0,0 +1,125 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newPlanProvider(t *testing.T) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:                 logger,
+		stateManager:           state.NewManager(5*time.Minute, logger),
+		defaults:               annotations.Defaults{ResourceGroup: "tm-rg", EndpointLocation: "eastus"},
+		maxWeightChangePercent: 50,
+		weightChangeAction:     WeightChangeActionClamp,
+	}
+	p.stateManager.SetProfile("app.example.com", &state.ProfileState{
+		ProfileName:   "app-tm",
+		ResourceGroup: "tm-rg",
+		Hostname:      "app.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"app-east": {EndpointName: "app-east", Target: "20.30.40.50", Weight: 10, Status: "Enabled"},
+		},
+	})
+	return p
+}
+
+func planEndpoint(dnsName, endpointName, weight string) *Endpoint {
+	return &Endpoint{
+		DNSName:    dnsName,
+		RecordType: "A",
+		Targets:    []string{"20.30.40.50"},
+		Labels: map[string]string{
+			annotations.AnnotationEnabled:      "true",
+			annotations.AnnotationEndpointName: endpointName,
+			annotations.AnnotationWeight:       weight,
+		},
+	}
+}
+
+func TestPlanChanges(t *testing.T) {
+	p := newPlanProvider(t)
+
+	changes := &Changes{
+		Create:    []*Endpoint{planEndpoint("new.example.com", "new-east", "5")},
+		UpdateOld: []*Endpoint{planEndpoint("app.example.com", "app-east", "10")},
+		UpdateNew: []*Endpoint{planEndpoint("app.example.com", "app-east", "50")},
+		Delete:    []*Endpoint{planEndpoint("app.example.com", "app-east", "50")},
+	}
+	changes.Create[0].Labels[annotations.AnnotationProfileName] = "new-tm"
+
+	plan, err := p.PlanChanges(context.Background(), changes)
+	require.NoError(t, err)
+	assert.Empty(t, plan.Errors)
+	assert.Equal(t, []PlanOperation{
+		{Action: PlanActionCreateProfile, DNSName: "new.example.com", ResourceGroup: "tm-rg", ProfileName: "new-tm"},
+		{Action: PlanActionCreateEndpoint, DNSName: "new.example.com", ResourceGroup: "tm-rg", ProfileName: "new-tm", EndpointName: "new-east", Target: "new.example.com", Weight: 5, Status: "Enabled"},
+		{Action: PlanActionUpdateEndpoint, DNSName: "app.example.com", ResourceGroup: "tm-rg", ProfileName: "app-tm", EndpointName: "app-east", Target: "app.example.com",
+			OldWeight: 10, Weight: 15, OldStatus: "Enabled", Status: "Enabled", Note: "limited on the way to weight 50"},
+		{Action: PlanActionDeleteEndpoint, DNSName: "app.example.com", ResourceGroup: "tm-rg", ProfileName: "app-tm", EndpointName: "app-east", Target: "20.30.40.50", OldWeight: 10, OldStatus: "Enabled"},
+		{Action: PlanActionDeleteProfile, DNSName: "app.example.com", ResourceGroup: "tm-rg", ProfileName: "app-tm"},
+	}, plan.Operations)
+
+	// Nothing is changed by planning
+	endpoint, ok := p.stateManager.GetEndpoint("app.example.com", "app-east")
+	require.True(t, ok)
+	assert.Equal(t, int64(10), endpoint.Weight)
+	assert.Empty(t, p.Canaries())
+}
+
+func TestPlanChanges_SkippedAndInvalid(t *testing.T) {
+	p := newPlanProvider(t)
+	p.policy = PolicyUpsertOnly
+
+	plan, err := p.PlanChanges(context.Background(), &Changes{
+		Create: []*Endpoint{planEndpoint("bad.example.com", "bad", "heavy")},
+		Delete: []*Endpoint{planEndpoint("app.example.com", "app-east", "10")},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, plan.Operations)
+	assert.Equal(t, []PlanSkip{{DNSName: "app.example.com", Reason: "deletes are skipped by the upsert-only policy"}}, plan.Skipped)
+	require.Len(t, plan.Errors, 1)
+	assert.Equal(t, "bad.example.com", plan.Errors[0].DNSName)
+
+	_, err = p.PlanChanges(context.Background(), &Changes{UpdateOld: []*Endpoint{planEndpoint("app.example.com", "app-east", "10")}})
+	assert.Equal(t, ErrorCodeInvalidRequest, errorCode(err))
+}
+
+func TestPlanChanges_Drain(t *testing.T) {
+	p := newPlanProvider(t)
+	p.endpointDrain = EndpointDrainDisable
+
+	plan, err := p.PlanChanges(context.Background(), &Changes{Delete: []*Endpoint{planEndpoint("app.example.com", "app-east", "10")}})
+	require.NoError(t, err)
+	require.Len(t, plan.Operations, 1, "a drained endpoint's profile isn't deleted in the same apply")
+	assert.Equal(t, PlanActionDrainEndpoint, plan.Operations[0].Action)
+}
+
+func TestHandlePlan(t *testing.T) {
+	s := NewWebhookServer(newPlanProvider(t), zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandlePlan(rec, httptest.NewRequest(http.MethodPost, "/plan", strings.NewReader(
+		`{"delete":[{"dnsName":"app.example.com","recordType":"A","targets":["20.30.40.50"],"labels":{"webhook/traffic-manager-enabled":"true","webhook/traffic-manager-endpoint-name":"app-east"}}]}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"action":"delete-profile"`)
+
+	rec = httptest.NewRecorder()
+	s.HandlePlan(rec, httptest.NewRequest(http.MethodPost, "/plan", strings.NewReader("not json")))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.HandlePlan(rec, httptest.NewRequest(http.MethodGet, "/plan", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+)
+
+// anyResourceGroup allows every resource group in a subscription in an allowlist entry
+const anyResourceGroup = "*"
+
+// resourcePolicy restricts the subscriptions and resource groups annotations may reference.
+// Empty lists allow anything; namespaces with their own entries are limited to those as well.
+type resourcePolicy struct {
+	defaultSubscription string
+	subscriptions       map[string]bool
+	resourceGroups      []resourceGroupRef
+	namespaces          map[string][]resourceGroupRef
+}
+
+// resourceGroupRef is a resource group allowlist entry; Name may be anyResourceGroup
+type resourceGroupRef struct {
+	SubscriptionID string
+	Name           string
+}
+
+func (r resourceGroupRef) String() string {
+	return r.SubscriptionID + "/" + r.Name
+}
+
+func (r resourceGroupRef) matches(subscriptionID, resourceGroup string) bool {
+	return strings.EqualFold(r.SubscriptionID, subscriptionID) &&
+		(r.Name == anyResourceGroup || strings.EqualFold(r.Name, resourceGroup))
+}
+
+// newResourcePolicy parses the allowlists. Resource groups are written like RESOURCE_GROUPS:
+// "<resource-group>" in the default subscription or "<subscription-id>/<resource-group>",
+// with "*" allowing every group in the subscription. Namespace entries are
+// "<namespace>=<resource-group>" in the same form.
+func newResourcePolicy(defaultSubscription string, subscriptions, resourceGroups, namespaceResourceGroups []string) (*resourcePolicy, error) {
+	policy := &resourcePolicy{
+		defaultSubscription: defaultSubscription,
+		namespaces:          make(map[string][]resourceGroupRef),
+	}
+
+	for _, subscriptionID := range subscriptions {
+		if policy.subscriptions == nil {
+			policy.subscriptions = make(map[string]bool)
+		}
+		policy.subscriptions[strings.ToLower(subscriptionID)] = true
+	}
+
+	for _, entry := range resourceGroups {
+		ref, err := parseResourceGroupRef(entry, defaultSubscription)
+		if err != nil {
+			return nil, err
+		}
+		policy.resourceGroups = append(policy.resourceGroups, ref)
+	}
+
+	for _, entry := range namespaceResourceGroups {
+		namespace, group, ok := strings.Cut(entry, "=")
+		if !ok || namespace == "" {
+			return nil, fmt.Errorf("invalid namespace resource group %q, must be <namespace>=<resource-group>", entry)
+		}
+		ref, err := parseResourceGroupRef(group, defaultSubscription)
+		if err != nil {
+			return nil, err
+		}
+		policy.namespaces[namespace] = append(policy.namespaces[namespace], ref)
+	}
+
+	return policy, nil
+}
+
+func parseResourceGroupRef(entry, defaultSubscription string) (resourceGroupRef, error) {
+	ref := resourceGroupRef{SubscriptionID: defaultSubscription, Name: entry}
+	if i := strings.Index(entry, "/"); i >= 0 {
+		ref.SubscriptionID, ref.Name = entry[:i], entry[i+1:]
+	}
+	if ref.SubscriptionID == "" || ref.Name == "" {
+		return resourceGroupRef{}, fmt.Errorf("invalid allowed resource group %q", entry)
+	}
+	return ref, nil
+}
+
+// check returns a policy_violation error if an endpoint from namespace may not use the
+// resource group in the subscription. An empty subscription means the default one.
+func (p *resourcePolicy) check(namespace, subscriptionID, resourceGroup string) error {
+	if p == nil {
+		return nil
+	}
+	if subscriptionID == "" {
+		subscriptionID = p.defaultSubscription
+	}
+
+	if len(p.subscriptions) > 0 && !strings.EqualFold(subscriptionID, p.defaultSubscription) &&
+		!p.subscriptions[strings.ToLower(subscriptionID)] {
+		return withCode(ErrorCodePolicyViolation, fmt.Errorf("subscription %s is not in the allowed subscriptions", subscriptionID))
+	}
+
+	if len(p.resourceGroups) > 0 && !matchesAny(p.resourceGroups, subscriptionID, resourceGroup) {
+		return withCode(ErrorCodePolicyViolation, fmt.Errorf("resource group %s/%s is not in the allowed resource groups", subscriptionID, resourceGroup))
+	}
+
+	if allowed, ok := p.namespaces[namespace]; ok && !matchesAny(allowed, subscriptionID, resourceGroup) {
+		return withCode(ErrorCodePolicyViolation, fmt.Errorf("namespace %s may not use resource group %s/%s, allowed: %v", namespace, subscriptionID, resourceGroup, allowed))
+	}
+
+	return nil
+}
+
+func matchesAny(refs []resourceGroupRef, subscriptionID, resourceGroup string) bool {
+	for _, ref := range refs {
+		if ref.matches(subscriptionID, resourceGroup) {
+			return true
+		}
+	}
+	return false
+}
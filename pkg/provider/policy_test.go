@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	defaultSub = "00000000-0000-0000-0000-000000000001"
+	otherSub   = "00000000-0000-0000-0000-000000000002"
+)
+
+func TestResourcePolicy_Unrestricted(t *testing.T) {
+	policy, err := newResourcePolicy(defaultSub, nil, nil, nil)
+	require.NoError(t, err)
+	assert.NoError(t, policy.check("apps", otherSub, "any-rg"))
+
+	var none *resourcePolicy
+	assert.NoError(t, none.check("apps", otherSub, "any-rg"))
+}
+
+func TestResourcePolicy_ResourceGroups(t *testing.T) {
+	policy, err := newResourcePolicy(defaultSub, []string{otherSub}, []string{"tm-rg", otherSub + "/*"}, nil)
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.check("apps", "", "tm-rg"))
+	assert.NoError(t, policy.check("apps", defaultSub, "TM-RG"), "resource groups match case-insensitively")
+	assert.NoError(t, policy.check("apps", otherSub, "anything"), "wildcard allows the whole subscription")
+
+	err = policy.check("apps", "", "prod-rg")
+	assert.ErrorContains(t, err, "resource group "+defaultSub+"/prod-rg is not in the allowed resource groups")
+	assert.Equal(t, ErrorCodePolicyViolation, errorCode(err))
+
+	err = policy.check("apps", "00000000-0000-0000-0000-000000000003", "tm-rg")
+	assert.ErrorContains(t, err, "is not in the allowed subscriptions")
+}
+
+func TestResourcePolicy_Namespaces(t *testing.T) {
+	policy, err := newResourcePolicy(defaultSub, nil, nil, []string{"team-a=rg-team-a", "team-a=" + otherSub + "/rg-shared", "team-b=rg-team-b"})
+	require.NoError(t, err)
+
+	assert.NoError(t, policy.check("team-a", "", "rg-team-a"))
+	assert.NoError(t, policy.check("team-a", otherSub, "rg-shared"))
+	assert.ErrorContains(t, policy.check("team-a", "", "rg-team-b"), "namespace team-a may not use resource group")
+	assert.NoError(t, policy.check("team-c", "", "rg-team-b"), "namespaces without entries are only limited by the global lists")
+}
+
+func TestNewResourcePolicy_Invalid(t *testing.T) {
+	_, err := newResourcePolicy(defaultSub, nil, nil, []string{"rg-team-a"})
+	assert.ErrorContains(t, err, "must be <namespace>=<resource-group>")
+
+	_, err = newResourcePolicy(defaultSub, nil, []string{otherSub + "/"}, nil)
+	assert.ErrorContains(t, err, "invalid allowed resource group")
+}
+
+func TestApplyChanges_RejectsPolicyViolation(t *testing.T) {
+	policy, err := newResourcePolicy(defaultSub, nil, []string{"tm-rg"}, nil)
+	require.NoError(t, err)
+	p := &TrafficManagerProvider{
+		logger:         zaptest.NewLogger(t),
+		subscriptionID: defaultSub,
+		resourcePolicy: policy,
+	}
+
+	// No Azure client is configured, so the change must be rejected before any Azure call
+	err = p.ApplyChanges(context.Background(), &Changes{Create: []*Endpoint{{
+		DNSName:    "demo-east.example.com",
+		Targets:    []string{"1.2.3.4"},
+		RecordType: "A",
+		Labels: map[string]string{
+			annotations.AnnotationEnabled:          "true",
+			annotations.AnnotationResourceGroup:    "prod-rg",
+			annotations.AnnotationEndpointLocation: "eastus",
+		},
+	}}})
+	assert.Equal(t, ErrorCodePolicyViolation, errorCode(err))
+}
@@ -0,0 +1,106 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+// priorityAssigner gives the endpoints of a Priority routing profile the unique priorities Azure
+// requires. Endpoints without a priority annotation keep the priority they already have, or take
+// the lowest free one; explicit priorities already used by another endpoint are rejected.
+type priorityAssigner struct {
+	profileName string
+	used        map[int64]string // Endpoint holding each priority
+	current     map[string]int64 // Priority of each endpoint in the profile
+	reserved    int64            // Kept for the fallback endpoint, 0 for none
+}
+
+// newPriorityAssigner starts from the endpoints of profile, which is nil for a new profile. It
+// returns nil for other routing methods, whose priorities Azure ignores.
+func newPriorityAssigner(config *annotations.TrafficManagerConfig, profile *state.ProfileState) *priorityAssigner {
+	if config.RoutingMethod != "Priority" {
+		return nil
+	}
+	a := &priorityAssigner{
+		profileName: config.ProfileName,
+		used:        make(map[int64]string),
+		current:     make(map[string]int64),
+	}
+	if config.FallbackTarget != "" {
+		a.reserved = annotations.MaxPriority
+	}
+	if profile != nil {
+		for _, name := range sortedKeys(profile.Endpoints) {
+			endpoint := profile.Endpoints[name]
+			if endpoint == nil || endpoint.Priority <= 0 {
+				continue
+			}
+			a.current[name] = endpoint.Priority
+			if _, ok := a.used[endpoint.Priority]; !ok {
+				a.used[endpoint.Priority] = name
+			}
+		}
+	}
+	return a
+}
+
+// priorityAssigner returns the assigner for the endpoints of config's profile, reading the
+// profile from Azure when it isn't cached
+func (p *TrafficManagerProvider) priorityAssigner(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, cached *state.ProfileState) (*priorityAssigner, error) {
+	if config.RoutingMethod != "Priority" {
+		return nil, nil
+	}
+	profile := cached
+	if profile == nil {
+		var err error
+		profile, err = tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
+		if err != nil && !trafficmanager.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to read priorities of profile %s: %w", config.ProfileName, err)
+		}
+	}
+	return newPriorityAssigner(config, profile), nil
+}
+
+// assign returns the priority of the endpoint name, claiming it so no later endpoint of the
+// profile gets the same one
+func (a *priorityAssigner) assign(config *annotations.TrafficManagerConfig, name string) (int64, error) {
+	if a == nil {
+		return config.Priority, nil
+	}
+	// The endpoint's own priority is free for it to keep or give up
+	if current, ok := a.current[name]; ok && a.used[current] == name {
+		delete(a.used, current)
+	}
+
+	if !config.PriorityAuto {
+		if holder, ok := a.used[config.Priority]; ok {
+			return 0, withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("priority %d of endpoint %s is already used by endpoint %s in profile %s",
+				config.Priority, name, holder, a.profileName))
+		}
+		if config.Priority == a.reserved {
+			return 0, withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("priority %d of endpoint %s is kept for the fallback endpoint of profile %s",
+				config.Priority, name, a.profileName))
+		}
+		a.used[config.Priority] = name
+		return config.Priority, nil
+	}
+
+	if current, ok := a.current[name]; ok && current != a.reserved {
+		if _, taken := a.used[current]; !taken {
+			a.used[current] = name
+			return current, nil
+		}
+	}
+	for priority := int64(annotations.MinPriority); priority <= annotations.MaxPriority; priority++ {
+		if _, taken := a.used[priority]; taken || priority == a.reserved {
+			continue
+		}
+		a.used[priority] = name
+		return priority, nil
+	}
+	return 0, withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("profile %s has no free priority left for endpoint %s", a.profileName, name))
+}
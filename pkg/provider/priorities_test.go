@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityAssigner(t *testing.T) {
+	profile := &state.ProfileState{Endpoints: map[string]*state.EndpointState{
+		"east": {EndpointName: "east", Priority: 1},
+		"west": {EndpointName: "west", Priority: 2},
+	}}
+	auto := &annotations.TrafficManagerConfig{RoutingMethod: "Priority", ProfileName: "app-tm", Priority: 1, PriorityAuto: true}
+	explicit := func(priority int64) *annotations.TrafficManagerConfig {
+		return &annotations.TrafficManagerConfig{RoutingMethod: "Priority", ProfileName: "app-tm", Priority: priority}
+	}
+
+	t.Run("new endpoints take the next free priority", func(t *testing.T) {
+		a := newPriorityAssigner(auto, profile)
+		priority, err := a.assign(auto, "north")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), priority)
+		priority, err = a.assign(auto, "south")
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), priority)
+	})
+
+	t.Run("existing endpoints keep their priority", func(t *testing.T) {
+		priority, err := newPriorityAssigner(auto, profile).assign(auto, "west")
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), priority)
+	})
+
+	t.Run("new profiles start at the first priority", func(t *testing.T) {
+		priority, err := newPriorityAssigner(auto, nil).assign(auto, "east")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), priority)
+	})
+
+	t.Run("explicit priorities must be free", func(t *testing.T) {
+		_, err := newPriorityAssigner(explicit(2), profile).assign(explicit(2), "north")
+		require.Error(t, err)
+		assert.Equal(t, ErrorCodeInvalidAnnotation, errorCode(err))
+		assert.Contains(t, err.Error(), "already used by endpoint west")
+
+		priority, err := newPriorityAssigner(explicit(5), profile).assign(explicit(5), "north")
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), priority)
+	})
+
+	t.Run("an endpoint can move to another free priority", func(t *testing.T) {
+		priority, err := newPriorityAssigner(explicit(7), profile).assign(explicit(7), "east")
+		require.NoError(t, err)
+		assert.Equal(t, int64(7), priority)
+	})
+
+	t.Run("several targets with one explicit priority collide", func(t *testing.T) {
+		a := newPriorityAssigner(explicit(5), profile)
+		_, err := a.assign(explicit(5), "north-0")
+		require.NoError(t, err)
+		_, err = a.assign(explicit(5), "north-1")
+		assert.Error(t, err)
+	})
+
+	t.Run("the fallback priority is kept free", func(t *testing.T) {
+		config := explicit(annotations.MaxPriority)
+		config.FallbackTarget = "status.example.com"
+		_, err := newPriorityAssigner(config, nil).assign(config, "east")
+		assert.Error(t, err)
+	})
+
+	t.Run("other routing methods keep the annotated priority", func(t *testing.T) {
+		weighted := &annotations.TrafficManagerConfig{RoutingMethod: "Weighted", Priority: 1, PriorityAuto: true}
+		a := newPriorityAssigner(weighted, profile)
+		assert.Nil(t, a)
+		priority, err := a.assign(weighted, "north")
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), priority)
+	})
+}
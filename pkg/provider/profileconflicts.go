@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// eventReasonProfileConflict is the reason of the event recorded on records skipped for conflicting
+const eventReasonProfileConflict = "TrafficManagerProfileConflict"
+
+// profileSettings are the settings of a profile that every record feeding it sets through its annotations
+type profileSettings struct {
+	RoutingMethod       string
+	DNSTTL              int64
+	MonitorProtocol     string
+	MonitorPort         int64
+	MonitorPath         string
+	HealthChecksEnabled bool
+	TrafficViewEnabled  bool
+	ProfileStatus       string
+}
+
+func profileSettingsOf(config *annotations.TrafficManagerConfig) profileSettings {
+	return profileSettings{
+		RoutingMethod:       config.RoutingMethod,
+		DNSTTL:              config.DNSTTL,
+		MonitorProtocol:     config.MonitorProtocol,
+		MonitorPort:         config.MonitorPort,
+		MonitorPath:         config.MonitorPath,
+		HealthChecksEnabled: config.HealthChecksEnabled,
+		TrafficViewEnabled:  config.TrafficViewEnabled,
+		ProfileStatus:       config.ProfileStatus,
+	}
+}
+
+// String describes the settings for logs and events
+func (s profileSettings) String() string {
+	return fmt.Sprintf("routing %s, TTL %d, monitor %s:%d%s, health checks %t, traffic view %t, status %s",
+		s.RoutingMethod, s.DNSTTL, s.MonitorProtocol, s.MonitorPort, s.MonitorPath, s.HealthChecksEnabled, s.TrafficViewEnabled, s.ProfileStatus)
+}
+
+// profileChange is a create or update in a batch, by its position in changes
+type profileChange struct {
+	endpoint *Endpoint
+	update   int // Index into UpdateNew, or -1 for a create
+	create   int // Index into Create, or -1 for an update
+	settings profileSettings
+	forced   bool
+}
+
+// skipConflictingProfileChanges removes the creates and updates of records that ask for different
+// settings for the same profile, which would otherwise overwrite each other with the last one
+// winning. Records with the force-profile-settings annotation win: when they agree, the records
+// asking for other settings are skipped and the rest are kept. Otherwise every record of the
+// profile in the batch is skipped until their annotations agree.
+func (p *TrafficManagerProvider) skipConflictingProfileChanges(ctx context.Context, changes *Changes) *Changes {
+	profiles := make(map[string][]profileChange)
+	add := func(endpoint *Endpoint, create, update int) {
+		if endpoint.RecordType == recordTypeTXT {
+			return
+		}
+		config, err := p.parseAnnotations(ctx, endpoint.annotationMap())
+		if err != nil || !config.Enabled {
+			// Annotation errors are reported when the record itself is applied
+			return
+		}
+		key := recordProfileKey(config.Hostname, endpoint.DNSName)
+		profiles[key] = append(profiles[key], profileChange{
+			endpoint: endpoint,
+			create:   create,
+			update:   update,
+			settings: profileSettingsOf(config),
+			forced:   hasForceProfileSettings(endpoint),
+		})
+	}
+	for i, endpoint := range changes.Create {
+		add(endpoint, i, -1)
+	}
+	for i, endpoint := range changes.UpdateNew {
+		add(endpoint, -1, i)
+	}
+
+	skipCreate := make(map[int]bool)
+	skipUpdate := make(map[int]bool)
+	for _, hostname := range sortedKeys(profiles) {
+		members := profiles[hostname]
+		requested := make(map[profileSettings][]string)
+		forced := make(map[profileSettings]bool)
+		for _, member := range members {
+			requested[member.settings] = append(requested[member.settings], endpointConfigID(member.endpoint))
+			if member.forced {
+				forced[member.settings] = true
+			}
+		}
+		if len(requested) < 2 {
+			continue
+		}
+
+		// Forced records agreeing with each other settle the conflict
+		var winner profileSettings
+		for settings := range forced {
+			winner = settings
+		}
+		resolved := len(forced) == 1
+
+		descriptions := make([]string, 0, len(requested))
+		for settings, records := range requested {
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", settings, strings.Join(records, ", ")))
+		}
+		sort.Strings(descriptions)
+		message := fmt.Sprintf("records for Traffic Manager profile %s ask for different profile settings: %s", hostname, strings.Join(descriptions, "; "))
+		if resolved {
+			message += fmt.Sprintf("; applying the forced settings %s", winner)
+		} else {
+			message += "; skipping them until they agree, or set force-profile-settings on the records whose settings should win"
+		}
+		p.log(ctx).Error("Conflicting Traffic Manager profile settings",
+			zap.String("hostname", hostname),
+			zap.Strings("requested", descriptions),
+			zap.Bool("resolved", resolved))
+		metrics.ProfileConfigConflicts.WithLabelValues(hostname).Inc()
+
+		for _, member := range members {
+			if resolved && member.settings == winner {
+				continue
+			}
+			p.events.warn(ctx, member.endpoint.Labels, eventReasonProfileConflict, message)
+			if member.create >= 0 {
+				skipCreate[member.create] = true
+			} else {
+				skipUpdate[member.update] = true
+			}
+		}
+	}
+	if len(skipCreate) == 0 && len(skipUpdate) == 0 {
+		return changes
+	}
+
+	kept := &Changes{Delete: changes.Delete}
+	for i, endpoint := range changes.Create {
+		if !skipCreate[i] {
+			kept.Create = append(kept.Create, endpoint)
+		}
+	}
+	for i := range changes.UpdateNew {
+		if !skipUpdate[i] {
+			kept.UpdateOld = append(kept.UpdateOld, changes.UpdateOld[i])
+			kept.UpdateNew = append(kept.UpdateNew, changes.UpdateNew[i])
+		}
+	}
+	return kept
+}
+
+// hasForceProfileSettings reports whether a record's profile settings win over conflicting ones
+func hasForceProfileSettings(endpoint *Endpoint) bool {
+	force, _ := strconv.ParseBool(endpoint.annotationMap()[annotations.AnnotationForceProfileSettings])
+	return force
+}
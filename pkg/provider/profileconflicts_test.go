@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// profileRecord returns a record from the Service name feeding the app.example.com profile
+func profileRecord(name, ttl string, extra map[string]string) *Endpoint {
+	labels := map[string]string{
+		"resource":                          "service/default/" + name,
+		annotations.AnnotationEnabled:       "true",
+		annotations.AnnotationResourceGroup: "tm-rg",
+		annotations.AnnotationHostname:      "app.example.com",
+		annotations.AnnotationDNSTTL:        ttl,
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return &Endpoint{DNSName: name + ".example.com", RecordType: "CNAME", Targets: []string{name + ".example.net"}, Labels: labels}
+}
+
+func TestSkipConflictingProfileChanges(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{eventGVR: "EventList"})
+	events := newEventRecorder(client, zaptest.NewLogger(t))
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	events.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t), events: events}
+	ctx := context.Background()
+
+	east := profileRecord("east", "30", nil)
+	west := profileRecord("west", "60", nil)
+	other := &Endpoint{DNSName: "other.example.com", RecordType: "CNAME", Targets: []string{"other.example.net"}, Labels: map[string]string{
+		annotations.AnnotationEnabled:       "true",
+		annotations.AnnotationResourceGroup: "tm-rg",
+	}}
+
+	// Agreeing records are kept
+	changes := &Changes{Create: []*Endpoint{east, profileRecord("north", "30", nil), other}}
+	assert.Same(t, changes, p.skipConflictingProfileChanges(ctx, changes))
+
+	// Without a forced record the whole profile waits; other profiles go ahead
+	kept := p.skipConflictingProfileChanges(ctx, &Changes{
+		Create:    []*Endpoint{east, other},
+		UpdateOld: []*Endpoint{west},
+		UpdateNew: []*Endpoint{west},
+		Delete:    []*Endpoint{profileRecord("south", "30", nil)},
+	})
+	assert.Equal(t, []*Endpoint{other}, kept.Create)
+	assert.Empty(t, kept.UpdateNew)
+	assert.Empty(t, kept.UpdateOld)
+	assert.Len(t, kept.Delete, 1, "deletes don't set profile settings")
+
+	recorded, err := client.Resource(eventGVR).Namespace("default").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, recorded.Items, 2)
+	involved := make([]string, 0, len(recorded.Items))
+	for _, event := range recorded.Items {
+		name, _, _ := unstructured.NestedString(event.Object, "involvedObject", "name")
+		involved = append(involved, name)
+		reason, _, _ := unstructured.NestedString(event.Object, "reason")
+		assert.Equal(t, eventReasonProfileConflict, reason)
+	}
+	assert.ElementsMatch(t, []string{"east", "west"}, involved)
+
+	// A forced record's settings win over the others
+	forcedWest := profileRecord("west", "60", map[string]string{annotations.AnnotationForceProfileSettings: "true"})
+	kept = p.skipConflictingProfileChanges(ctx, &Changes{Create: []*Endpoint{east, forcedWest, profileRecord("north", "60", nil)}})
+	require.Len(t, kept.Create, 2)
+	assert.Equal(t, "west.example.com", kept.Create[0].DNSName)
+	assert.Equal(t, "north.example.com", kept.Create[1].DNSName)
+
+	// Records forcing different settings are still a conflict
+	forcedEast := profileRecord("east", "30", map[string]string{annotations.AnnotationForceProfileSettings: "true"})
+	kept = p.skipConflictingProfileChanges(ctx, &Changes{Create: []*Endpoint{forcedEast, forcedWest}})
+	assert.Empty(t, kept.Create)
+}
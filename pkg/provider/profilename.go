@@ -0,0 +1,134 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// Profile name collision strategies control what happens when a generated profile name's
+// relative DNS name is already taken under trafficmanager.net
+const (
+	// ProfileNameCollisionFail fails the create
+	ProfileNameCollisionFail = "fail"
+
+	// ProfileNameCollisionHash appends a hash of the subscription, resource group and hostname
+	ProfileNameCollisionHash = "hash"
+
+	// ProfileNameCollisionSequence appends the first free number from 2 upwards
+	ProfileNameCollisionSequence = "sequence"
+)
+
+const (
+	// maxRelativeNameLength is the longest relative DNS name Traffic Manager accepts
+	maxRelativeNameLength = annotations.MaxProfileNameLength
+
+	// maxProfileNameSequence bounds the numbers tried by the sequence strategy
+	maxProfileNameSequence = 20
+)
+
+// profileNameFor returns the name of the profile cached for hostname, which may carry a collision
+// suffix or come from an earlier naming template, or renders the profile name template when none is cached
+func (p *TrafficManagerProvider) profileNameFor(config *annotations.TrafficManagerConfig, endpoint *Endpoint, hostname string) (string, error) {
+	if profile, ok := p.stateManager.GetProfile(hostname); ok && profile.ProfileName != "" {
+		return profile.ProfileName, nil
+	}
+	return p.renderProfileName(config, endpoint, hostname)
+}
+
+// suffixedProfileName inserts suffix before the generated-name suffix, shortening the rest of the
+// name so the result is still a valid relative DNS name
+func suffixedProfileName(name, suffix string) string {
+	stem := strings.TrimSuffix(name, trafficmanager.GeneratedProfileSuffix)
+	if limit := maxRelativeNameLength - len(suffix) - 1 - len(trafficmanager.GeneratedProfileSuffix); len(stem) > limit {
+		stem = strings.TrimRight(stem[:limit], "-")
+	}
+	return stem + "-" + suffix + trafficmanager.GeneratedProfileSuffix
+}
+
+// hashedProfileName returns the name the hash strategy uses. The hash covers where the profile
+// lives, so every apply for the same hostname arrives at the same name.
+func hashedProfileName(name, subscriptionID, resourceGroup, hostname string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(subscriptionID + "/" + resourceGroup + "/" + hostname)))
+	return suffixedProfileName(name, hex.EncodeToString(sum[:])[:8])
+}
+
+// profileNameCandidates returns the names a collision strategy tries, in order
+func profileNameCandidates(strategy, name, subscriptionID, resourceGroup, hostname string) []string {
+	switch strategy {
+	case ProfileNameCollisionHash:
+		return []string{hashedProfileName(name, subscriptionID, resourceGroup, hostname)}
+	case ProfileNameCollisionSequence:
+		candidates := make([]string, 0, maxProfileNameSequence-1)
+		for n := 2; n <= maxProfileNameSequence; n++ {
+			candidates = append(candidates, suffixedProfileName(name, strconv.Itoa(n)))
+		}
+		return candidates
+	}
+	return nil
+}
+
+// resolveProfileName checks that the relative DNS name of a profile that doesn't exist yet is free
+// before it is created. A taken name fails with a conflict, unless the name was generated and a
+// collision strategy is configured, in which case config.ProfileName is replaced by the first
+// candidate that already exists in the resource group or is free. A failed check doesn't block the
+// create, which reports its own error if the name really is taken.
+func (p *TrafficManagerProvider) resolveProfileName(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, hostname string, generated bool) error {
+	available, reason, err := p.profileNameAvailable(ctx, tmClient, config.ResourceGroup, config.ProfileName)
+	if err != nil {
+		p.log(ctx).Warn("Failed to check profile name availability",
+			zap.String("profileName", config.ProfileName),
+			zap.Error(err))
+		return nil
+	}
+	if available {
+		return nil
+	}
+	metrics.ProfileNameCollisions.Inc()
+
+	if !generated || p.profileNameCollision == ProfileNameCollisionFail {
+		return withCode(ErrorCodeProfileConflict, fmt.Errorf(
+			"profile name %s is already taken as a trafficmanager.net DNS name: %s", config.ProfileName, reason))
+	}
+
+	for _, candidate := range profileNameCandidates(p.profileNameCollision, config.ProfileName, config.SubscriptionID, config.ResourceGroup, hostname) {
+		available, _, err := p.profileNameAvailable(ctx, tmClient, config.ResourceGroup, candidate)
+		if err != nil {
+			return fmt.Errorf("failed to check profile name %s: %w", candidate, err)
+		}
+		if !available {
+			continue
+		}
+		p.log(ctx).Info("Generated profile name is taken, using an alternative",
+			zap.String("hostname", hostname),
+			zap.String("takenName", config.ProfileName),
+			zap.String("profileName", candidate),
+			zap.String("strategy", p.profileNameCollision))
+		config.ProfileName = candidate
+		return nil
+	}
+
+	return withCode(ErrorCodeProfileConflict, fmt.Errorf(
+		"profile name %s is already taken as a trafficmanager.net DNS name and no %s alternative is free", config.ProfileName, p.profileNameCollision))
+}
+
+// profileNameAvailable reports whether a profile may be created or reused under name: it already
+// exists in the resource group, or its relative DNS name is free
+func (p *TrafficManagerProvider) profileNameAvailable(ctx context.Context, tmClient *trafficmanager.Client, resourceGroup, name string) (bool, string, error) {
+	_, err := tmClient.GetProfile(ctx, resourceGroup, name)
+	if err == nil {
+		return true, "", nil
+	}
+	if !trafficmanager.IsNotFound(err) {
+		return false, "", err
+	}
+	return tmClient.RelativeNameAvailable(ctx, name)
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSuffixedProfileName(t *testing.T) {
+	assert.Equal(t, "app-example-com-2-tm", suffixedProfileName("app-example-com-tm", "2"))
+
+	long := generateProfileName(strings.Repeat("a", 70) + ".example.com")
+	name := suffixedProfileName(long, "1a2b3c4d")
+	assert.Len(t, name, maxRelativeNameLength)
+	assert.True(t, strings.HasSuffix(name, "-1a2b3c4d-tm"))
+}
+
+func TestHashedProfileName(t *testing.T) {
+	name := hashedProfileName("app-example-com-tm", "sub-1", "rg-tm", "app.example.com")
+	assert.Regexp(t, `^app-example-com-[0-9a-f]{8}-tm$`, name)
+	assert.Equal(t, name, hashedProfileName("app-example-com-tm", "SUB-1", "RG-TM", "app.example.com"), "stable across case")
+	assert.NotEqual(t, name, hashedProfileName("app-example-com-tm", "sub-2", "rg-tm", "app.example.com"))
+}
+
+func TestProfileNameCandidates(t *testing.T) {
+	assert.Nil(t, profileNameCandidates(ProfileNameCollisionFail, "app-tm", "sub", "rg", "app"))
+	assert.Len(t, profileNameCandidates(ProfileNameCollisionHash, "app-tm", "sub", "rg", "app"), 1)
+
+	sequence := profileNameCandidates(ProfileNameCollisionSequence, "app-tm", "sub", "rg", "app")
+	assert.Equal(t, "app-2-tm", sequence[0])
+	assert.Equal(t, "app-20-tm", sequence[len(sequence)-1])
+}
+
+func TestProfileNameFor(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{logger: logger, stateManager: state.NewManager(5*time.Minute, logger)}
+
+	config := &annotations.TrafficManagerConfig{}
+	endpoint := &Endpoint{DNSName: "app.example.com"}
+
+	name, err := p.profileNameFor(config, endpoint, "app.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "app-example-com-tm", name)
+
+	p.stateManager.SetProfile("app.example.com", &state.ProfileState{ProfileName: "app-example-com-2-tm", Hostname: "app.example.com"})
+	name, err = p.profileNameFor(config, endpoint, "app.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "app-example-com-2-tm", name, "a suffixed name is kept")
+}
@@ -2,233 +2,757 @@ package provider
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"sync"
+	"text/template"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/azuredns"
 	"github.com/sam-cogan/external-dns-traffic-manager/pkg/dnsendpoint"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/publicip"
 	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
 	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
 	"go.uber.org/zap"
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 )
 
 // TrafficManagerProvider implements the webhook provider logic
 type TrafficManagerProvider struct {
-	domainFilter       []string
+	domainFilter       []string // Guarded by settingsMu, as are domainFilterExclude, defaults and hostnameMappers
 	logger             *zap.Logger
-	tmClient           *trafficmanager.Client
+	tmLogger           *zap.Logger            // Logger for Traffic Manager clients, filtered separately from the provider
+	tmClient           *trafficmanager.Client // Client for the default subscription
+	subscriptionID     string
+	credential         azcore.TokenCredential
+	cloud              cloud.Configuration
+	clientOptions      trafficmanager.ClientOptions      // User agent, retries, API version and proxy of Azure clients
+	clients            map[string]*trafficmanager.Client // Clients for other subscriptions and scoped credentials, created on demand
+	clientsMu          sync.Mutex
 	stateManager       *state.Manager
 	resourceGroups     []string
+	profileDiscovery   string
+	clusterName        string
+	ownership          trafficmanager.Ownership // Tags marking the profiles this deployment manages
+	policy             string
+	vanityRecordMode   string
 	dnsEndpointManager *dnsendpoint.Manager
+	txtRegistry        *txtRegistry     // Stores External DNS TXT ownership records; nil skips them
+	endpointConfigs    *endpointConfigs // Resolved endpoint configurations, for deletes without annotations
+	events             *eventRecorder   // Kubernetes events on the resources behind records; nil without a Kubernetes client
+	azureDNSClient     *azuredns.Client
+
+	// Credentials of other tenants or identities by lower-cased scope, <subscription-id>/<resource-group>
+	// or <subscription-id>/*; resource groups without one use credential
+	scopedCredentials map[string]azcore.TokenCredential
+
+	// Finds the public IP resources of A record addresses; nil unless ResolvePublicIPs is set
+	publicIPs publicIPResolver
+
+	// Records() also returns the source records of endpoints, from endpointConfigs
+	returnEndpointRecords bool
+
+	// Subdomains of domainFilter the webhook leaves alone
+	domainFilterExclude []string
+
+	// Weight change guardrails
+	maxWeightChangePercent int
+	weightChangeAction     string
+
+	// Strategies for matching profiles to vanity hostnames, tried in order
+	hostnameMapping []string
+	hostnameMappers []HostnameMapper
+
+	// Runtime settings, replaced by UpdateSettings
+	defaults   annotations.Defaults
+	settingsMu sync.RWMutex
+
+	// Per-namespace defaults read from ConfigMaps; nil when disabled
+	namespaceDefaults *namespaceDefaults
+
+	// Endpoint location detected from the cluster's region; empty when detection is off or failed
+	detectedLocation string
+
+	// Subscriptions and resource groups annotations may reference
+	resourcePolicy *resourcePolicy
+
+	// Profiles and endpoints each namespace may create; nil when unlimited
+	quotas *namespaceQuotas
+
+	// Change freeze windows
+	freezeWindows     []FreezeWindow
+	freezeLocation    *time.Location
+	freezeBypassUntil time.Time
+	freezeMu          sync.Mutex
+	clock             func() time.Time
+
+	readiness readinessState
+
+	// Missing role assignments found by ProbePermissions, and the Pod their events are recorded on
+	permissions permissionProbe
+	pod         types.NamespacedName
+
+	// Intentional removals silenced for alerting (0 disables)
+	silenceDuration time.Duration
+	silences        map[string]Silence
+	silencesMu      sync.Mutex
+
+	// Endpoints having their weight shifted in steps, by profile and endpoint name
+	canaries   map[string]*Canary
+	canariesMu sync.Mutex
+
+	// Latest Traffic View heat maps of enrolled profiles, by hostname
+	trafficViews   map[string]*TrafficView
+	trafficViewsMu sync.Mutex
+
+	// How endpoints are taken out of rotation before deletion, and the endpoints being drained
+	endpointDrain            string
+	endpointDrainTTLMultiple int
+	endpointDrains           map[string]*EndpointDrain
+	endpointDrainsMu         sync.Mutex
+
+	// Naming templates for profiles and endpoints without an explicit name; nil means the defaults
+	profileNameTemplate  *template.Template
+	endpointNameTemplate *template.Template
+
+	// What happens when a generated profile name is taken under trafficmanager.net
+	profileNameCollision string
+
+	// What happens to the resources of a create that fails part way (see CreateFailure*)
+	createFailureMode string
+
+	// Take over existing profiles the webhook didn't create, for every endpoint rather than per annotation
+	adoptProfiles bool
+
+	// Empty profiles are disabled and kept this long before deletion (0 deletes at once)
+	profileDeleteGracePeriod time.Duration
+
+	// Counts ready Kubernetes endpoints behind Services; nil disables readiness-driven status
+	serviceReadiness *serviceReadiness
+
+	// Resyncs requested by ProfileChanged for RunChangeResync
+	changes chan struct{}
+
+	lastSync   *SyncResult // Outcome of the last Records call, for /debug/state
+	lastSyncMu sync.Mutex
+
+	// When the provider started and last synced from Azure successfully, for the freshness metrics
+	startedAt       time.Time
+	lastSyncSuccess time.Time
 }
 
 // NewTrafficManagerProvider creates a new Traffic Manager provider
-func NewTrafficManagerProvider(subscriptionID string, resourceGroups []string, domainFilter []string, k8sClient *kubernetes.Clientset, logger *zap.Logger) (*TrafficManagerProvider, error) {
+// The logger should be unnamed; each subsystem gets its own named child so its level can be set independently.
+func NewTrafficManagerProvider(config *Config, dynamicClient dynamic.Interface, baseLogger *zap.Logger) (*TrafficManagerProvider, error) {
+	logger := baseLogger.Named("provider")
+	tmLogger := baseLogger.Named("trafficmanager")
+
+	cloudConfig, err := trafficmanager.CloudConfiguration(config.Cloud)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions := config.ClientOptions
+	clientOptions.Cloud = cloudConfig
+	if err := clientOptions.Validate(); err != nil {
+		return nil, err
+	}
+	armOptions, err := clientOptions.ARM()
+	if err != nil {
+		return nil, err
+	}
+
 	// Get Azure credentials
-	cred, err := trafficmanager.GetAzureCredential()
+	cred := config.Credential
+	if cred == nil {
+		cred, err = trafficmanager.GetAzureCredential(trafficmanager.CredentialConfig{
+			AuthMode:     config.AuthMode,
+			TenantID:     config.TenantID,
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Cloud:        cloudConfig,
+			ProxyURL:     clientOptions.ProxyURL,
+
+			ClientSecretFile:          config.ClientSecretFile,
+			ClientCertificateFile:     config.ClientCertificateFile,
+			ClientCertificatePassword: config.ClientCertificatePassword,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Azure credentials: %w", err)
+		}
+	}
+
+	// Credentials of other tenants or identities for some resource groups or subscriptions; they
+	// share the default credential's auth mode and secrets
+	scopedConfigs, err := parseScopedCredentials(config.ScopedCredentials, config.SubscriptionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get Azure credentials: %w", err)
+		return nil, err
+	}
+	scopedCredentials := make(map[string]azcore.TokenCredential, len(scopedConfigs))
+	for _, scoped := range scopedConfigs {
+		clientID := scoped.clientID
+		if clientID == "" {
+			clientID = config.ClientID
+		}
+		scopedCred, err := trafficmanager.GetAzureCredential(trafficmanager.CredentialConfig{
+			AuthMode:     config.AuthMode,
+			TenantID:     scoped.tenantID,
+			ClientID:     clientID,
+			ClientSecret: config.ClientSecret,
+			Cloud:        cloudConfig,
+			ProxyURL:     clientOptions.ProxyURL,
+
+			ClientSecretFile:          config.ClientSecretFile,
+			ClientCertificateFile:     config.ClientCertificateFile,
+			ClientCertificatePassword: config.ClientCertificatePassword,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Azure credentials for %s: %w", scoped.scope, err)
+		}
+		scopedCredentials[scoped.scope] = scopedCred
+		logger.Info("Using scoped Azure credential",
+			zap.String("scope", scoped.scope),
+			zap.String("tenantID", scoped.tenantID),
+			zap.String("clientID", clientID))
 	}
 
 	// Test the credential
 	ctx := context.Background()
-	if err := trafficmanager.TestCredential(ctx, cred); err != nil {
+	if err := trafficmanager.TestCredential(ctx, cred, cloudConfig); err != nil {
 		return nil, fmt.Errorf("failed to validate Azure credentials: %w", err)
 	}
 
 	// Create Traffic Manager client
-	tmClient, err := trafficmanager.NewClient(subscriptionID, cred, logger)
+	tmClient, err := trafficmanager.NewClient(config.SubscriptionID, cred, clientOptions, tmLogger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Traffic Manager client: %w", err)
 	}
 
-	// Create state manager with 5-minute cache TTL
-	stateManager := state.NewManager(5*time.Minute, logger)
+	cacheTTL := config.StateCacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultStateCacheTTL
+	}
+	stateManager := state.NewManager(cacheTTL, logger.Named("state"))
+	stateManager.SetMaxEntries(config.StateCacheMaxProfiles)
+
+	p := &TrafficManagerProvider{
+		domainFilter:     config.DomainFilter,
+		logger:           logger,
+		tmLogger:         tmLogger,
+		tmClient:         tmClient,
+		subscriptionID:   config.SubscriptionID,
+		credential:       cred,
+		cloud:            cloudConfig,
+		clientOptions:    clientOptions,
+		stateManager:     stateManager,
+		resourceGroups:   config.ResourceGroups,
+		profileDiscovery: config.ProfileDiscovery,
+		clusterName:      config.ClusterName,
+		ownership:        config.Ownership.WithDefaults(),
+		policy:           config.Policy,
+		vanityRecordMode: config.VanityRecordMode,
+
+		createFailureMode: config.CreateFailureMode,
+		scopedCredentials: scopedCredentials,
+
+		domainFilterExclude: config.DomainFilterExclude,
+
+		maxWeightChangePercent: config.MaxWeightChangePercent,
+		weightChangeAction:     config.WeightChangeAction,
+
+		hostnameMapping: config.HostnameMapping,
+		defaults:        config.Defaults,
+		silenceDuration: config.SilenceDuration,
+
+		profileDeleteGracePeriod: config.ProfileDeleteGracePeriod,
+		adoptProfiles:            config.AdoptProfiles,
+		profileNameCollision:     config.ProfileNameCollision,
+
+		endpointDrain:            config.EndpointDrain,
+		endpointDrainTTLMultiple: config.EndpointDrainTTLMultiple,
+
+		returnEndpointRecords: config.EndpointRecords,
+
+		changes: make(chan struct{}, 1),
+
+		startedAt: time.Now(),
+		pod:       types.NamespacedName{Namespace: config.PodNamespace, Name: config.PodName},
+	}
+	metrics.SetFreshnessSource(p.freshness)
+
+	if config.StateCacheStaleTTL > 0 {
+		stateManager.SetRevalidation(config.StateCacheStaleTTL, p.revalidateProfile)
+	}
+
+	tmClient.SetOwnership(p.owner())
+
+	switch config.Policy {
+	case PolicySync, "":
+		p.policy = PolicySync
+	case PolicyUpsertOnly:
+	default:
+		return nil, fmt.Errorf("invalid policy %q, must be one of: %v",
+			config.Policy, []string{PolicySync, PolicyUpsertOnly})
+	}
+
+	switch config.ProfileDiscovery {
+	case ProfileDiscoveryResourceGroups, "":
+		p.profileDiscovery = ProfileDiscoveryResourceGroups
+	case ProfileDiscoverySubscription:
+	default:
+		return nil, fmt.Errorf("invalid profile discovery mode %q, must be one of: %v",
+			config.ProfileDiscovery, []string{ProfileDiscoveryResourceGroups, ProfileDiscoverySubscription})
+	}
+
+	switch config.WeightChangeAction {
+	case WeightChangeActionClamp, "":
+		p.weightChangeAction = WeightChangeActionClamp
+	case WeightChangeActionReject:
+	default:
+		return nil, fmt.Errorf("invalid weight change action %q, must be one of: %v",
+			config.WeightChangeAction, []string{WeightChangeActionClamp, WeightChangeActionReject})
+	}
+
+	if config.ProfileNameTemplate != "" {
+		if p.profileNameTemplate, err = parseNameTemplate("profile", config.ProfileNameTemplate); err != nil {
+			return nil, err
+		}
+	}
+	if config.EndpointNameTemplate != "" {
+		if p.endpointNameTemplate, err = parseNameTemplate("endpoint", config.EndpointNameTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	switch config.CreateFailureMode {
+	case CreateFailureRetry, "":
+		p.createFailureMode = CreateFailureRetry
+	case CreateFailureRollback, CreateFailureResume:
+	default:
+		return nil, fmt.Errorf("invalid create failure mode %q, must be one of: %v",
+			config.CreateFailureMode, []string{CreateFailureRetry, CreateFailureRollback, CreateFailureResume})
+	}
 
-	// Create DNSEndpoint manager for automatic CNAME creation
-	dnsEndpointManager, err := dnsendpoint.NewManager(k8sClient, "default", logger)
+	switch config.ProfileNameCollision {
+	case ProfileNameCollisionFail, "":
+		p.profileNameCollision = ProfileNameCollisionFail
+	case ProfileNameCollisionHash, ProfileNameCollisionSequence:
+	default:
+		return nil, fmt.Errorf("invalid profile name collision strategy %q, must be one of: %v",
+			config.ProfileNameCollision, []string{ProfileNameCollisionFail, ProfileNameCollisionHash, ProfileNameCollisionSequence})
+	}
+
+	switch config.EndpointDrain {
+	case EndpointDrainNone, "":
+		p.endpointDrain = EndpointDrainNone
+	case EndpointDrainWeight, EndpointDrainDisable:
+		if p.endpointDrainTTLMultiple < 1 {
+			p.endpointDrainTTLMultiple = defaultEndpointDrainTTLMultiple
+		}
+	default:
+		return nil, fmt.Errorf("invalid endpoint drain mode %q, must be one of: %v",
+			config.EndpointDrain, []string{EndpointDrainNone, EndpointDrainWeight, EndpointDrainDisable})
+	}
+
+	p.freezeWindows, err = ParseFreezeWindows(config.FreezeWindows)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create DNSEndpoint manager: %w", err)
+		return nil, err
+	}
+	p.freezeLocation = time.UTC
+	if config.FreezeTimezone != "" {
+		p.freezeLocation, err = time.LoadLocation(config.FreezeTimezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid freeze time zone %q: %w", config.FreezeTimezone, err)
+		}
+	}
+
+	// Create the writer used for vanity hostname records
+	switch config.VanityRecordMode {
+	case VanityRecordModeAzureDNS:
+		p.azureDNSClient, err = azuredns.NewClient(config.SubscriptionID, config.AzureDNSResourceGroup, config.AzureDNSZones, cred, armOptions, baseLogger.Named("azuredns"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Azure DNS client: %w", err)
+		}
+		// Vanity records carry the same managed-by marker as the profiles
+		p.azureDNSClient.SetManagedBy(p.ownership.ManagedByTag, p.ownership.ManagedByValue)
+	case VanityRecordModeDNSEndpoint, "":
+		p.vanityRecordMode = VanityRecordModeDNSEndpoint
+		p.dnsEndpointManager = dnsendpoint.NewManager(dynamicClient, "default", baseLogger.Named("dnsendpoint"))
+	default:
+		return nil, fmt.Errorf("invalid vanity record mode %q, must be one of: %v",
+			config.VanityRecordMode, []string{VanityRecordModeDNSEndpoint, VanityRecordModeAzureDNS})
+	}
+
+	if config.ResolvePublicIPs {
+		p.publicIPs, err = publicip.NewClient(config.SubscriptionID, cred, armOptions, baseLogger.Named("publicip"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := annotations.ValidateDefaults(config.Defaults); err != nil {
+		return nil, err
+	}
+	if config.NamespaceDefaultsConfigMap != "" {
+		if dynamicClient == nil {
+			return nil, fmt.Errorf("namespace defaults ConfigMap %q requires a Kubernetes client", config.NamespaceDefaultsConfigMap)
+		}
+		p.namespaceDefaults = newNamespaceDefaults(dynamicClient, config.NamespaceDefaultsConfigMap)
+	}
+	if config.DetectEndpointLocation {
+		ctx, cancel := context.WithTimeout(context.Background(), locationDetectionTimeout)
+		p.detectedLocation, err = detectClusterLocation(ctx, dynamicClient, http.DefaultClient)
+		cancel()
+		if err != nil {
+			baseLogger.Warn("Could not detect the cluster's Azure region, endpoints need an endpoint location annotation or default",
+				zap.Error(err))
+		} else {
+			baseLogger.Info("Detected the cluster's Azure region for endpoint locations",
+				zap.String("location", p.detectedLocation))
+		}
+	}
+	var endpointConfigStore *configMapStore
+	if config.EndpointConfigConfigMap != "" {
+		if dynamicClient == nil {
+			return nil, fmt.Errorf("endpoint configuration ConfigMap %q requires a Kubernetes client", config.EndpointConfigConfigMap)
+		}
+		endpointConfigStore, err = newConfigMapStore(dynamicClient, config.EndpointConfigConfigMap, endpointConfigKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid endpoint configuration store: %w", err)
+		}
+	}
+	p.endpointConfigs = newEndpointConfigs(endpointConfigStore, baseLogger.Named("endpointconfig"))
+	if dynamicClient != nil {
+		p.events = newEventRecorder(dynamicClient, baseLogger.Named("events"))
+	}
+
+	if config.TXTRegistryConfigMap != "" {
+		if dynamicClient == nil {
+			return nil, fmt.Errorf("TXT registry ConfigMap %q requires a Kubernetes client", config.TXTRegistryConfigMap)
+		}
+		p.txtRegistry, err = newTXTRegistry(dynamicClient, config.TXTRegistryConfigMap, baseLogger.Named("txtregistry"))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.ServiceReadiness {
+		if dynamicClient == nil {
+			return nil, fmt.Errorf("service readiness requires a Kubernetes client")
+		}
+		p.serviceReadiness = newServiceReadiness(dynamicClient)
+	}
+
+	p.resourcePolicy, err = newResourcePolicy(config.SubscriptionID, config.AllowedSubscriptions, config.AllowedResourceGroups, config.NamespaceResourceGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.MaxProfilesPerNamespace > 0 || config.MaxEndpointsPerNamespace > 0 ||
+		len(config.NamespaceProfileQuotas) > 0 || len(config.NamespaceEndpointQuotas) > 0 {
+		p.quotas, err = newNamespaceQuotas(config.MaxProfilesPerNamespace, config.MaxEndpointsPerNamespace,
+			config.NamespaceProfileQuotas, config.NamespaceEndpointQuotas)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.hostnameMappers, err = p.newHostnameMappers(config.HostnameMapping)
+	if err != nil {
+		return nil, err
 	}
 
 	logger.Info("Successfully initialized Traffic Manager provider",
-		zap.String("subscriptionID", subscriptionID),
-		zap.Int("resourceGroupCount", len(resourceGroups)))
-
-	return &TrafficManagerProvider{
-		domainFilter:       domainFilter,
-		logger:             logger,
-		tmClient:           tmClient,
-		stateManager:       stateManager,
-		resourceGroups:     resourceGroups,
-		dnsEndpointManager: dnsEndpointManager,
-	}, nil
+		zap.String("subscriptionID", config.SubscriptionID),
+		zap.String("cloud", cloudConfig.ActiveDirectoryAuthorityHost),
+		zap.String("authMode", config.AuthMode),
+		zap.Int("resourceGroupCount", len(config.ResourceGroups)),
+		zap.String("profileDiscovery", p.profileDiscovery),
+		zap.String("vanityRecordMode", p.vanityRecordMode),
+		zap.String("policy", p.policy),
+		zap.Strings("hostnameMapping", config.HostnameMapping),
+		zap.Int("freezeWindowCount", len(p.freezeWindows)))
+
+	return p, nil
 }
 
 // Records returns all Traffic Manager profiles as CNAME records
 // This is called by External DNS to get the current state
 func (p *TrafficManagerProvider) Records(ctx context.Context) ([]*Endpoint, error) {
-	p.logger.Info("Getting records from Traffic Manager")
+	start := p.now()
+	p.expireSilences()
+	endpoints, profileCount, err := p.records(ctx)
+	p.recordSync(start, profileCount, len(endpoints), err)
+	return endpoints, err
+}
 
-	// Sync profiles from Azure
-	profiles, err := p.tmClient.SyncProfilesFromAzure(ctx, p.resourceGroups)
-	if err != nil {
-		p.logger.Error("Failed to sync profiles from Azure", zap.Error(err))
-		return nil, fmt.Errorf("failed to sync profiles: %w", err)
+// records syncs profiles from Azure and converts them to endpoints.
+// It also returns the number of profiles synced, for the debug state.
+func (p *TrafficManagerProvider) records(ctx context.Context) ([]*Endpoint, int, error) {
+	p.log(ctx).Info("Getting records from Traffic Manager")
+
+	profiles, err := p.syncProfiles(ctx)
+	var syncErr *trafficmanager.SyncError
+	if err != nil && !errors.As(err, &syncErr) {
+		p.log(ctx).Error("Failed to sync profiles from Azure", zap.Error(err))
+		return nil, 0, fmt.Errorf("failed to sync profiles: %w", err)
 	}
 
-	// Update state with synced profiles
+	// Work out which vanity hostname each profile serves
+	p.mapHostnames(ctx, profiles)
+	p.checkHostnameTags(ctx, profiles)
+
+	// Update state with synced profiles; soft-deleted profiles only exist to be restored or purged
 	for _, profile := range profiles {
-		if profile.Hostname != "" {
+		if profile.Hostname != "" && !softDeleted(profile) {
 			p.stateManager.SetProfile(profile.Hostname, profile)
 		}
 	}
 
+	// Without the failed resource groups' records External DNS would plan to create them again,
+	// so the synced profiles are only cached
+	if syncErr != nil {
+		return nil, len(profiles), fmt.Errorf("failed to sync profiles: %w", err)
+	}
+
 	// Convert profiles to External DNS endpoints
 	var endpoints []*Endpoint
+	var served []*state.ProfileState
 	for _, profile := range profiles {
-		// Skip profiles without hostname or FQDN
-		if profile.Hostname == "" || profile.FQDN == "" {
-			p.logger.Debug("Skipping profile without hostname or FQDN",
+		// Skip profiles without hostname or FQDN, and soft-deleted ones
+		if profile.Hostname == "" || profile.FQDN == "" || softDeleted(profile) {
+			p.log(ctx).Debug("Skipping profile without hostname or FQDN",
 				zap.String("profileName", profile.ProfileName))
 			continue
 		}
 
 		// Apply domain filter if configured
 		if !p.matchesDomainFilter(profile.Hostname) {
-			p.logger.Debug("Profile hostname does not match domain filter",
+			p.log(ctx).Debug("Profile hostname does not match domain filter",
 				zap.String("hostname", profile.Hostname))
 			continue
 		}
 
-		// Create CNAME endpoint pointing to Traffic Manager FQDN
-		endpoint := &Endpoint{
-			DNSName:    profile.Hostname,
-			Targets:    []string{profile.FQDN},
-			RecordType: "CNAME",
-			RecordTTL:  300, // 5 minutes
-			Labels:     make(map[string]string),
-		}
+		endpoint := profileToEndpoint(profile)
+		endpoints = append(endpoints, endpoint)
+		served = append(served, profile)
+	}
 
-		// Add Traffic Manager metadata as labels
-		endpoint.Labels["traffic-manager-profile"] = profile.ProfileName
-		endpoint.Labels["traffic-manager-resource-group"] = profile.ResourceGroup
-		endpoint.Labels["traffic-manager-routing-method"] = profile.RoutingMethod
+	// The source records behind the profiles' endpoints, so plans show endpoint membership
+	if p.returnEndpointRecords {
+		records, err := p.endpointRecords(ctx, served)
+		if err != nil {
+			return nil, 0, err
+		}
+		endpoints = append(endpoints, records...)
+	}
 
-		endpoints = append(endpoints, endpoint)
+	// Ownership records External DNS keeps with this webhook as its only provider
+	if p.txtRegistry != nil {
+		txt, err := p.txtRegistry.Records(ctx)
+		if err != nil {
+			return nil, 0, err
+		}
+		endpoints = append(endpoints, txt...)
 	}
 
-	p.logger.Info("Retrieved Traffic Manager records",
+	p.updateQuotaMetrics()
+
+	p.log(ctx).Info("Retrieved Traffic Manager records",
 		zap.Int("totalProfiles", len(profiles)),
 		zap.Int("endpointCount", len(endpoints)))
 
-	return endpoints, nil
+	return endpoints, len(profiles), nil
 }
 
-// AdjustEndpoints modifies endpoints before they are processed by other providers
-// We don't adjust anything - let Azure DNS handle individual service records
-// The webhook provider only creates the CNAME for the vanity hostname via Records()
-func (p *TrafficManagerProvider) AdjustEndpoints(ctx context.Context, endpoints []*Endpoint) []*Endpoint {
-	// Pass through all endpoints unchanged
-	// Azure DNS will create A records for individual services (demo-east, demo-west)
-	// This webhook creates CNAME for vanity URL (demo) via Records() method
-	p.logger.Debug("AdjustEndpoints called - passing through unchanged",
-		zap.Int("endpointCount", len(endpoints)))
-	
-	return endpoints
+// defaultRecordTTL is the TTL of vanity records for profiles whose DNS TTL isn't known
+const defaultRecordTTL = 300
+
+// profileToEndpoint converts a managed profile into a CNAME endpoint pointing to its Traffic Manager FQDN.
+// The CNAME gets the profile's DNS TTL, so resolvers don't cache it longer than Traffic Manager's answers.
+func profileToEndpoint(profile *state.ProfileState) *Endpoint {
+	ttl := profile.DNSTTL
+	if ttl <= 0 {
+		ttl = defaultRecordTTL
+	}
+	endpoint := &Endpoint{
+		DNSName:    profile.Hostname,
+		Targets:    []string{profile.FQDN},
+		RecordType: "CNAME",
+		RecordTTL:  ttl,
+		Labels:     make(map[string]string),
+	}
+
+	// Add Traffic Manager metadata as labels
+	endpoint.Labels["traffic-manager-profile"] = profile.ProfileName
+	endpoint.Labels["traffic-manager-resource-group"] = profile.ResourceGroup
+	endpoint.Labels["traffic-manager-routing-method"] = profile.RoutingMethod
+	endpoint.Labels["traffic-manager-profile-id"] = profile.ResourceID
+	endpoint.Labels["traffic-manager-fqdn"] = profile.FQDN
+
+	return endpoint
 }
 
 // ApplyChanges applies the given changes to Traffic Manager
 // This is called by External DNS when changes need to be made
 func (p *TrafficManagerProvider) ApplyChanges(ctx context.Context, changes *Changes) error {
-	p.logger.Info("Applying changes to Traffic Manager",
+	p.log(ctx).Info("Applying changes to Traffic Manager",
 		zap.Int("create", len(changes.Create)),
 		zap.Int("updateOld", len(changes.UpdateOld)),
 		zap.Int("updateNew", len(changes.UpdateNew)),
 		zap.Int("delete", len(changes.Delete)))
 
+	// Outside emergencies, changes wait until any active freeze window ends
+	changes = p.deferFrozenChanges(changes)
+
+	// Records disagreeing about their profile's settings would overwrite each other's
+	changes = p.skipConflictingProfileChanges(ctx, changes)
+
+	// Each record is applied on its own, so one that fails doesn't block the rest of the batch
+	applyErr := &ApplyError{}
+
+	// Percent mode weights are checked across each profile before anything is written
+	changes = p.checkWeightPercentages(ctx, changes, applyErr)
+
+	// TXT ownership records are written before the records they own, so a batch that fails part
+	// way never leaves records External DNS doesn't recognise as its own
+	if p.txtRegistry != nil {
+		var txt *Changes
+		txt, changes = splitTXTChanges(changes)
+		if !p.mayDelete() {
+			txt.Delete = nil
+		}
+		if err := p.txtRegistry.Apply(ctx, txt); err != nil {
+			p.log(ctx).Error("Failed to write TXT registry records", zap.Error(err))
+			return err
+		}
+	}
+
+	// Quota usage changes with every create and delete, even when the batch fails part way
+	defer p.updateQuotaMetrics()
+
+	// Vanity hostname records are collected and written as a single batch
+	pendingVanity := make(map[string]vanityRecord)
+	nameClaims := make(endpointNameClaims)
+
 	// Process creates
 	for _, endpoint := range changes.Create {
-		if err := p.createEndpoint(ctx, endpoint); err != nil {
-			p.logger.Error("Failed to create endpoint", zap.Error(err))
-			return err
+		err := p.createEndpoint(ctx, endpoint, pendingVanity, nameClaims)
+		if err != nil {
+			p.log(ctx).Error("Failed to create endpoint", zap.String("dnsName", endpoint.DNSName), zap.Error(err))
 		}
+		applyErr.result(changeActionCreate, endpoint, err)
 	}
 
+	p.applyVanityRecords(ctx, pendingVanity)
+
 	// Process updates
 	for i := range changes.UpdateOld {
-		if err := p.updateEndpoint(ctx, changes.UpdateOld[i], changes.UpdateNew[i]); err != nil {
-			p.logger.Error("Failed to update endpoint", zap.Error(err))
-			return err
+		err := p.updateEndpoint(ctx, changes.UpdateOld[i], changes.UpdateNew[i], nameClaims)
+		if err != nil {
+			p.log(ctx).Error("Failed to update endpoint", zap.String("dnsName", changes.UpdateNew[i].DNSName), zap.Error(err))
 		}
+		applyErr.result(changeActionUpdate, changes.UpdateNew[i], err)
 	}
 
 	// Process deletes
-	for _, endpoint := range changes.Delete {
-		if err := p.deleteEndpoint(ctx, endpoint); err != nil {
-			p.logger.Error("Failed to delete endpoint", zap.Error(err))
-			return err
+	deletes := changes.Delete
+	if !p.mayDelete() && len(deletes) > 0 {
+		p.log(ctx).Info("Skipping deletes due to upsert-only policy",
+			zap.Int("delete", len(deletes)))
+		deletes = nil
+	}
+	for _, endpoint := range deletes {
+		err := p.deleteEndpoint(ctx, endpoint)
+		if err != nil {
+			p.log(ctx).Error("Failed to delete endpoint", zap.String("dnsName", endpoint.DNSName), zap.Error(err))
 		}
+		applyErr.result(changeActionDelete, endpoint, err)
 	}
 
-	p.logger.Info("Successfully applied all changes")
+	if err := applyErr.errOrNil(); err != nil {
+		p.log(ctx).Error("Some changes failed, the rest were applied",
+			zap.Int("applied", applyErr.Applied),
+			zap.Int("failed", len(applyErr.Failures)))
+		return err
+	}
+
+	p.log(ctx).Info("Successfully applied all changes")
 	return nil
 }
 
+// mayDelete reports whether the policy lets the webhook delete profiles and endpoints. Every
+// delete an apply can make is checked here, including the clean up of a failed create.
+func (p *TrafficManagerProvider) mayDelete() bool {
+	return p.policy != PolicyUpsertOnly
+}
+
 // createEndpoint creates a new Traffic Manager endpoint
-func (p *TrafficManagerProvider) createEndpoint(ctx context.Context, endpoint *Endpoint) error {
-	p.logger.Info("Creating endpoint",
+// Vanity hostname records are added to pendingVanity rather than written immediately.
+// Endpoint names are checked against nameClaims so different targets never share a name.
+func (p *TrafficManagerProvider) createEndpoint(ctx context.Context, endpoint *Endpoint, pendingVanity map[string]vanityRecord, nameClaims endpointNameClaims) error {
+	p.log(ctx).Info("Creating endpoint",
 		zap.String("dnsName", endpoint.DNSName),
 		zap.Strings("targets", endpoint.Targets),
 		zap.String("recordType", endpoint.RecordType))
 
-	// Skip TXT records - they're for External DNS ownership tracking, not Traffic Manager endpoints
-	if endpoint.RecordType == "TXT" {
-		p.logger.Debug("Skipping TXT record (ownership record)")
+	// Skip TXT records - they're for External DNS ownership tracking, not Traffic Manager endpoints,
+	// and are stored by the TXT registry when one is configured
+	if endpoint.RecordType == recordTypeTXT {
+		p.log(ctx).Debug("Skipping TXT record (ownership record)")
 		return nil
 	}
 
 	// Debug: Log the full endpoint structure
-	p.logger.Debug("Full endpoint details",
+	p.log(ctx).Debug("Full endpoint details",
 		zap.Any("labels", endpoint.Labels),
 		zap.Any("providerSpecific", endpoint.ProviderSpecific),
 		zap.Int64("ttl", endpoint.RecordTTL))
 
 	// Parse Traffic Manager configuration from annotations
 	// Check both Labels and ProviderSpecific (External DNS passes service annotations via ProviderSpecific)
-	annotationMap := make(map[string]string)
-	
-	// First, copy from Labels
-	for k, v := range endpoint.Labels {
-		annotationMap[k] = v
-	}
-	
-	// Then, add/override from ProviderSpecific
-	for _, prop := range endpoint.ProviderSpecific {
-		annotationMap[prop.Name] = prop.Value
-	}
-	
-	p.logger.Debug("Parsing annotations", 
+	annotationMap := endpoint.annotationMap()
+
+	p.log(ctx).Debug("Parsing annotations",
 		zap.Int("labelCount", len(endpoint.Labels)),
 		zap.Int("providerSpecificCount", len(endpoint.ProviderSpecific)),
 		zap.Any("annotations", annotationMap))
-	
-	config, err := annotations.ParseConfig(annotationMap)
+
+	config, err := p.parseAnnotations(ctx, annotationMap)
 	if err != nil {
-		return fmt.Errorf("failed to parse annotations: %w", err)
+		return withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("failed to parse annotations: %w", err))
 	}
 
 	// Skip if Traffic Manager is not enabled
 	if !config.Enabled {
-		p.logger.Debug("Traffic Manager not enabled for this endpoint", 
+		p.log(ctx).Debug("Traffic Manager not enabled for this endpoint",
 			zap.String("dnsName", endpoint.DNSName))
 		return nil
 	}
 
+	// Addresses of Azure public IPs become AzureEndpoints, which need no endpoint location
+	publicIPs := p.resolvePublicIPs(ctx, config, endpoint)
+
 	// Validate configuration
 	if err := annotations.ValidateConfig(config); err != nil {
-		return fmt.Errorf("invalid Traffic Manager configuration: %w", err)
+		return withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("invalid Traffic Manager configuration: %w", err))
+	}
+	if err := p.checkVanityRecordType(config.VanityRecordType); err != nil {
+		return withCode(ErrorCodeInvalidAnnotation, err)
+	}
+	if err := p.resourcePolicy.check(sourceNamespace(endpoint), config.SubscriptionID, config.ResourceGroup); err != nil {
+		return err
+	}
+
+	tmClient, err := p.clientFor(config.SubscriptionID, config.ResourceGroup)
+	if err != nil {
+		return err
 	}
 
 	// Use vanity hostname if specified, otherwise use endpoint DNSName
@@ -238,102 +762,220 @@ func (p *TrafficManagerProvider) createEndpoint(ctx context.Context, endpoint *E
 	}
 
 	// Generate profile name if not specified (based on vanity hostname)
-	if config.ProfileName == "" {
-		config.ProfileName = generateProfileName(vanityHostname)
+	generatedName := config.ProfileName == ""
+	if generatedName {
+		if config.ProfileName, err = p.profileNameFor(config, endpoint, vanityHostname); err != nil {
+			return err
+		}
 	}
 
 	// Generate endpoint name if not specified
 	if config.EndpointName == "" {
-		config.EndpointName = generateEndpointName(endpoint.DNSName, endpoint.Targets)
+		if config.EndpointName, err = p.renderEndpointName(config, endpoint, vanityHostname, ""); err != nil {
+			return err
+		}
 	}
 
-	p.logger.Info("Creating Traffic Manager profile",
+	targets := writtenTargets(endpoint, publicIPs)
+	if err := p.checkQuota(sourceNamespace(endpoint), vanityHostname, targets); err != nil {
+		return err
+	}
+
+	p.log(ctx).Info("Creating Traffic Manager profile",
 		zap.String("profileName", config.ProfileName),
 		zap.String("vanityHostname", vanityHostname),
 		zap.String("endpointDNS", endpoint.DNSName),
 		zap.String("resourceGroup", config.ResourceGroup))
 
-	// Create or update the Traffic Manager profile
-	profileConfig := config.ToProfileConfig()
-	// Add hostname tag so we can map Traffic Manager profile back to vanity DNS name
-	profileConfig.Tags["hostname"] = vanityHostname
-	_, err = p.tmClient.CreateProfile(ctx, profileConfig)
-	if err != nil {
-		// Profile might already exist, try to get it
-		existing, getErr := p.tmClient.GetProfile(ctx, config.ResourceGroup, config.ProfileName)
-		if getErr != nil {
-			return fmt.Errorf("failed to create/get profile: %w (original error: %v)", getErr, err)
-		}
-		p.logger.Info("Profile already exists, using existing profile",
-			zap.String("profileName", existing.ProfileName),
-			zap.String("fqdn", existing.FQDN))
+	// Relative DNS names are unique across Azure, so a new profile's name may be taken elsewhere
+	if err := p.resolveProfileName(ctx, tmClient, config, vanityHostname, generatedName); err != nil {
+		return err
+	}
+
+	// Writes that wouldn't change the cached profile or its endpoints are skipped
+	cached := p.cachedProfileFor(vanityHostname, config.ResourceGroup, config.ProfileName)
+	var cachedEndpoints map[string]*state.EndpointState
+	if cached != nil {
+		cachedEndpoints = cached.Endpoints
 	}
 
-	// Use endpoint DNS name as target (this is the individual service DNS like demo-east.example.com)
-	// Traffic Manager will point to this DNS name instead of IP
-	targetDNS := endpoint.DNSName
-	
-	// For A records, use the DNS name as target. For other record types, use targets
-	targets := []string{targetDNS}
-	if endpoint.RecordType != "A" && len(endpoint.Targets) > 0 {
-		targets = endpoint.Targets
+	// Azure needs a unique priority for each endpoint of a Priority routing profile
+	priorities, err := p.priorityAssigner(ctx, tmClient, config, cached)
+	if err != nil {
+		return err
 	}
 
-	// Create endpoints for each target
+	// Work out the endpoint for each target before writing any, so they can share a request
+	endpointConfigs := make([]*trafficmanager.EndpointConfig, 0, len(targets))
+	var pending []*trafficmanager.EndpointConfig
 	for i, target := range targets {
-		endpointConfig := config.ToEndpointConfig(target)
-		
-		// If we have multiple targets, ensure unique endpoint names
-		// This handles the case where External DNS merges multiple DNSEndpoint CRDs
-		if len(endpoint.Targets) > 1 && endpointConfig.EndpointName != "" {
-			// Append index or target to make it unique
-			endpointConfig.EndpointName = fmt.Sprintf("%s-%d", endpointConfig.EndpointName, i)
-		} else if endpointConfig.EndpointName == "" {
-			// Generate endpoint name from target if not specified
-			endpointConfig.EndpointName = generateEndpointNameFromTarget(target, i)
-		}
-		
-		p.logger.Info("Creating Traffic Manager endpoint",
+		endpointConfig := toEndpointConfig(config, target)
+		if address, ok := publicIPs[target]; ok {
+			endpointConfig.TargetResourceID = address.ID
+		}
+		endpointConfig.EndpointName = p.targetEndpointName(nameClaims, config, endpoint, vanityHostname, target, i)
+		if endpointConfig.Priority, err = priorities.assign(config, endpointConfig.EndpointName); err != nil {
+			return err
+		}
+
+		// A canary brings a new endpoint in at its first step rather than its full weight
+		endpointConfig.Weight = p.canaryWeight(ctx, config, vanityHostname, endpointConfig.EndpointName, 0, endpointConfig.Weight)
+		// Inside a scheduled disable window the endpoint starts out disabled
+		endpointConfig.Status = p.scheduledStatus(config, endpointConfig.Status)
+		endpointConfigs = append(endpointConfigs, endpointConfig)
+
+		if current, ok := cachedEndpoints[endpointConfig.EndpointName]; ok && endpointUpToDate(current, endpointConfig) {
+			p.log(ctx).Debug("Endpoint is up to date, skipping write",
+				zap.String("endpointName", endpointConfig.EndpointName))
+			metrics.AzureWritesSkipped.WithLabelValues(skippedWriteEndpoint).Inc()
+			continue
+		}
+		p.log(ctx).Info("Creating Traffic Manager endpoint",
 			zap.String("endpointName", endpointConfig.EndpointName),
 			zap.String("target", target),
 			zap.Int64("weight", endpointConfig.Weight))
+		pending = append(pending, endpointConfig)
+	}
+
+	// Create or update the Traffic Manager profile, unless it was just adopted or other clusters share it.
+	// profileConfig is only set when the profile is written.
+	var profileConfig *trafficmanager.ProfileConfig
+	adopted, err := p.adoptProfile(ctx, tmClient, config, vanityHostname)
+	if err != nil {
+		return err
+	}
+	if adopted {
+		p.log(ctx).Info("Adopted profile keeps its existing settings",
+			zap.String("profileName", config.ProfileName))
+	} else if p.sharedProfile(ctx, tmClient, config) {
+		p.log(ctx).Info("Profile has endpoints from other clusters, leaving its settings unchanged",
+			zap.String("profileName", config.ProfileName))
+	} else if desired := toProfileConfig(config, p.owner(), vanityHostname); cached != nil && profileUpToDate(cached, desired) && len(pending) < 2 {
+		p.log(ctx).Debug("Profile is up to date, skipping write",
+			zap.String("profileName", config.ProfileName))
+		metrics.AzureWritesSkipped.WithLabelValues(skippedWriteProfile).Inc()
+	} else {
+		// The hostname tag in the config maps the Traffic Manager profile back to the vanity DNS name.
+		// Several endpoints are worth rewriting an unchanged profile for, to write them in one request.
+		profileConfig = desired
+	}
 
-		endpointState, err := p.tmClient.CreateEndpoint(ctx, config.ResourceGroup, config.ProfileName, endpointConfig)
+	endpointStates := make(map[string]*state.EndpointState, len(pending))
+	if profileConfig != nil && len(pending) > 0 {
+		// One request writes the profile together with its endpoints, rather than one per endpoint
+		profileState, err := tmClient.CreateProfileWithEndpoints(ctx, profileConfig, pending)
+		if err != nil {
+			return err
+		}
+		for _, endpointConfig := range pending {
+			if endpointState, ok := profileState.Endpoints[endpointConfig.EndpointName]; ok {
+				endpointStates[endpointConfig.EndpointName] = convertToStateEndpoint(endpointState)
+			}
+		}
+	} else {
+		// Separate writes can fail part way; the run rolls back or checkpoints what was written
+		run, err := p.newCreateRun(ctx, tmClient, vanityHostname, config.ResourceGroup, config.ProfileName, cached)
+		if err != nil {
+			return err
+		}
+		if profileConfig != nil {
+			_, err = tmClient.CreateProfile(ctx, profileConfig)
+			if err != nil {
+				// Profile might already exist, try to get it
+				existing, getErr := tmClient.GetProfile(ctx, config.ResourceGroup, config.ProfileName)
+				if getErr != nil {
+					return fmt.Errorf("failed to create/get profile: %w (original error: %v)", getErr, err)
+				}
+				p.log(ctx).Info("Profile already exists, using existing profile",
+					zap.String("profileName", existing.ProfileName),
+					zap.String("fqdn", existing.FQDN))
+			}
+			run.profileWritten = true
+		}
+		for _, endpointConfig := range pending {
+			endpointState, err := tmClient.CreateEndpoint(ctx, config.ResourceGroup, config.ProfileName, endpointConfig)
+			if err != nil {
+				return run.fail(ctx, p, fmt.Errorf("failed to create endpoint %s: %w", endpointConfig.EndpointName, err))
+			}
+			run.wrote(endpointConfig)
+			endpointStates[endpointConfig.EndpointName] = convertToStateEndpoint(endpointState)
+		}
+	}
+	written := adopted || profileConfig != nil || len(pending) > 0
+
+	// Metadata that couldn't be saved fails the create once the rest of it is done
+	var metadataErrs []error
+	for _, endpointConfig := range endpointConfigs {
+		// Creating the endpoint again brought it back into rotation, so it must not be deleted after all
+		p.cancelEndpointDrain(ctx, config.ProfileName, endpointConfig.EndpointName)
+
+		current := cachedEndpoints[endpointConfig.EndpointName]
+		var currentMetadata *state.EndpointMetadata
+		if current != nil {
+			currentMetadata = current.Metadata
+		}
+		metadata, err := p.recordEndpointMetadata(ctx, tmClient, config, endpointConfig, endpoint, currentMetadata)
 		if err != nil {
-			return fmt.Errorf("failed to create endpoint %s: %w", endpointConfig.EndpointName, err)
+			metadataErrs = append(metadataErrs, err)
 		}
+		p.unsilence(config.ProfileName, endpointConfig.EndpointName)
 
 		// Update state with new endpoint (store under vanity hostname)
-		p.stateManager.SetEndpoint(vanityHostname, endpointConfig.EndpointName, convertToStateEndpoint(endpointState))
+		// The metadata lets later creates in the same batch count it against the namespace quota
+		stateEndpoint, ok := endpointStates[endpointConfig.EndpointName]
+		if !ok {
+			stateEndpoint = current
+		}
+		if stateEndpoint != nil {
+			stateEndpoint.Metadata = metadata
+			p.stateManager.SetEndpoint(vanityHostname, endpointConfig.EndpointName, stateEndpoint)
+		}
 	}
 
-	// Refresh profile state from Azure to get the complete picture
-	profileState, err := p.tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
-	if err == nil {
-		// Store profile under vanity hostname
-		profileState.Hostname = vanityHostname
-		p.stateManager.SetProfile(vanityHostname, profileState)
-		
-		// Automatically create DNSEndpoint CRD for vanity URL CNAME
-		if vanityHostname != "" && vanityHostname != endpoint.DNSName && profileState.FQDN != "" {
-			dnsEndpointName := dnsendpoint.GenerateName(vanityHostname)
-			err = p.dnsEndpointManager.CreateOrUpdateCNAME(ctx, dnsEndpointName, vanityHostname, profileState.FQDN, 300)
-			if err != nil {
-				p.logger.Error("Failed to create DNSEndpoint for vanity URL",
-					zap.String("vanityHostname", vanityHostname),
-					zap.String("trafficManagerFQDN", profileState.FQDN),
-					zap.Error(err))
-				// Don't fail the whole operation if DNSEndpoint creation fails
-			} else {
-				p.logger.Info("Successfully created DNSEndpoint for vanity URL",
-					zap.String("vanityHostname", vanityHostname),
-					zap.String("trafficManagerFQDN", profileState.FQDN),
-					zap.String("dnsEndpointName", dnsEndpointName))
+	if config.FallbackTarget != "" {
+		written = true
+		if err := p.ensureFallbackEndpoint(ctx, tmClient, config); err != nil {
+			return err
+		}
+	}
+
+	// Refresh profile state from Azure to get the complete picture; when nothing was written the
+	// cached profile, with the endpoints stored above, is still current
+	profileState := cached
+	if written || cached == nil {
+		profileState, err = tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
+		if err != nil {
+			profileState = nil
+		} else {
+			// Store profile under vanity hostname
+			profileState.Hostname = vanityHostname
+			p.stateManager.SetProfile(vanityHostname, profileState)
+		}
+	}
+	if profileState != nil {
+		// Queue the vanity URL record; the batch is applied once all creates are processed
+		if vanityHostname != "" && vanityHostname != endpoint.DNSName && profileState.FQDN != "" &&
+			config.VanityRecordType != annotations.VanityRecordTypeNone {
+			pendingVanity[vanityHostname] = vanityRecord{
+				Hostname:       vanityHostname,
+				Target:         profileState.FQDN,
+				SubscriptionID: config.SubscriptionID,
+				ProfileName:    config.ProfileName,
+				ResourceGroup:  config.ResourceGroup,
+				ProfileID:      profileState.ResourceID,
+				RecordType:     config.VanityRecordType,
+				TTL:            vanityTTL(config, endpoint),
 			}
 		}
 	}
 
-	p.logger.Info("Successfully created Traffic Manager endpoint",
+	p.rememberEndpointConfig(ctx, endpoint, config)
+
+	if len(metadataErrs) > 0 {
+		return errors.Join(metadataErrs...)
+	}
+
+	p.log(ctx).Info("Successfully created Traffic Manager endpoint",
 		zap.String("dnsName", endpoint.DNSName),
 		zap.String("vanityHostname", vanityHostname),
 		zap.String("profileName", config.ProfileName))
@@ -342,91 +984,207 @@ func (p *TrafficManagerProvider) createEndpoint(ctx context.Context, endpoint *E
 }
 
 // updateEndpoint updates an existing Traffic Manager endpoint
-func (p *TrafficManagerProvider) updateEndpoint(ctx context.Context, oldEndpoint, newEndpoint *Endpoint) error {
-	p.logger.Info("Updating endpoint",
+// Endpoint names are checked against nameClaims, as on create.
+func (p *TrafficManagerProvider) updateEndpoint(ctx context.Context, oldEndpoint, newEndpoint *Endpoint, nameClaims endpointNameClaims) error {
+	p.log(ctx).Info("Updating endpoint",
 		zap.String("dnsName", newEndpoint.DNSName))
 
 	// Parse new configuration
-	newConfig, err := annotations.ParseConfig(newEndpoint.Labels)
+	newConfig, err := p.parseAnnotations(ctx, newEndpoint.annotationMap())
 	if err != nil {
-		return fmt.Errorf("failed to parse new annotations: %w", err)
+		return withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("failed to parse new annotations: %w", err))
 	}
 
 	// Skip if Traffic Manager is not enabled
 	if !newConfig.Enabled {
-		p.logger.Debug("Traffic Manager not enabled for this endpoint", 
+		p.log(ctx).Debug("Traffic Manager not enabled for this endpoint",
 			zap.String("dnsName", newEndpoint.DNSName))
 		return nil
 	}
 
+	publicIPs := p.resolvePublicIPs(ctx, newConfig, newEndpoint)
+
 	// Validate configuration
 	if err := annotations.ValidateConfig(newConfig); err != nil {
-		return fmt.Errorf("invalid Traffic Manager configuration: %w", err)
+		return withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("invalid Traffic Manager configuration: %w", err))
+	}
+	if err := p.resourcePolicy.check(sourceNamespace(newEndpoint), newConfig.SubscriptionID, newConfig.ResourceGroup); err != nil {
+		return err
+	}
+
+	tmClient, err := p.clientFor(newConfig.SubscriptionID, newConfig.ResourceGroup)
+	if err != nil {
+		return err
 	}
 
 	// Parse old configuration to detect changes
-	oldConfig, _ := annotations.ParseConfig(oldEndpoint.Labels)
+	oldConfig, _ := p.parseAnnotations(ctx, oldEndpoint.annotationMap())
+
+	// Use vanity hostname if specified; names and cached state follow it, as on create
+	vanityHostname := newConfig.Hostname
+	if vanityHostname == "" {
+		vanityHostname = newEndpoint.DNSName
+	}
 
 	// Generate names if not specified
 	if newConfig.ProfileName == "" {
-		newConfig.ProfileName = generateProfileName(newEndpoint.DNSName)
+		if newConfig.ProfileName, err = p.profileNameFor(newConfig, newEndpoint, vanityHostname); err != nil {
+			return err
+		}
 	}
 	if newConfig.EndpointName == "" {
-		newConfig.EndpointName = generateEndpointName(newEndpoint.DNSName, newEndpoint.Targets)
+		if newConfig.EndpointName, err = p.renderEndpointName(newConfig, newEndpoint, vanityHostname, ""); err != nil {
+			return err
+		}
+	}
+
+	// Custom tags are reconciled when the annotations change them, or when the cached profile
+	// doesn't carry them, for example after the webhook's default tags changed
+	tagsChanged := oldConfig != nil && !maps.Equal(oldConfig.Tags, newConfig.Tags)
+	if cached, ok := p.stateManager.GetProfile(vanityHostname); ok && !hasTags(cached.Tags, newConfig.Tags) {
+		tagsChanged = true
 	}
 
 	// Check if profile configuration changed
-	if oldConfig == nil || 
-	   oldConfig.RoutingMethod != newConfig.RoutingMethod ||
-	   oldConfig.DNSTTL != newConfig.DNSTTL ||
-	   oldConfig.MonitorProtocol != newConfig.MonitorProtocol ||
-	   oldConfig.MonitorPort != newConfig.MonitorPort ||
-	   oldConfig.MonitorPath != newConfig.MonitorPath ||
-	   oldConfig.HealthChecksEnabled != newConfig.HealthChecksEnabled {
-		
-		p.logger.Info("Updating Traffic Manager profile",
-			zap.String("profileName", newConfig.ProfileName))
-
-		profileConfig := newConfig.ToProfileConfig()
-		// Add hostname tag so we can map Traffic Manager profile back to DNS name
-		profileConfig.Tags["hostname"] = newEndpoint.DNSName
-		_, err := p.tmClient.UpdateProfile(ctx, profileConfig)
-		if err != nil {
-			return fmt.Errorf("failed to update profile: %w", err)
+	if oldConfig == nil || tagsChanged ||
+		oldConfig.RoutingMethod != newConfig.RoutingMethod ||
+		oldConfig.DNSTTL != newConfig.DNSTTL ||
+		oldConfig.MonitorProtocol != newConfig.MonitorProtocol ||
+		oldConfig.MonitorPort != newConfig.MonitorPort ||
+		oldConfig.MonitorPath != newConfig.MonitorPath ||
+		oldConfig.ProfileStatus != newConfig.ProfileStatus ||
+		oldConfig.TrafficViewEnabled != newConfig.TrafficViewEnabled ||
+		oldConfig.DeletionProtection != newConfig.DeletionProtection {
+
+		if p.sharedProfile(ctx, tmClient, newConfig) {
+			p.log(ctx).Info("Profile has endpoints from other clusters, leaving its settings unchanged",
+				zap.String("profileName", newConfig.ProfileName))
+		} else {
+			p.log(ctx).Info("Updating Traffic Manager profile",
+				zap.String("profileName", newConfig.ProfileName))
+
+			// The hostname tag maps the Traffic Manager profile back to the vanity DNS name
+			profileConfig := toProfileConfig(newConfig, p.owner(), vanityHostname)
+			_, err := tmClient.UpdateProfile(ctx, profileConfig)
+			if err != nil {
+				return fmt.Errorf("failed to update profile: %w", err)
+			}
 		}
 	}
 
-	// Update endpoints
-	for _, target := range newEndpoint.Targets {
-		endpointConfig := newConfig.ToEndpointConfig(target)
-		
-		// Check if we should update weight or status
-		if oldConfig != nil && 
-		   (oldConfig.Weight != newConfig.Weight || oldConfig.EndpointStatus != newConfig.EndpointStatus) {
-			
-			p.logger.Info("Updating Traffic Manager endpoint",
+	// Endpoints keep their priorities unless the annotation sets another, which must be free
+	priorities, err := p.priorityAssigner(ctx, tmClient, newConfig, p.cachedProfileFor(vanityHostname, newConfig.ResourceGroup, newConfig.ProfileName))
+	if err != nil {
+		return err
+	}
+
+	// Update endpoints; metadata that couldn't be saved fails the update once the rest of it is done
+	// Targets and endpoint names are worked out as on create, so the endpoints it wrote are the ones updated
+	var metadataErrs []error
+	targets := writtenTargets(newEndpoint, publicIPs)
+	p.claimRetargetedNames(nameClaims, newConfig, newEndpoint, oldEndpoint, vanityHostname, targets)
+	for i, target := range targets {
+		endpointConfig := toEndpointConfig(newConfig, target)
+		if address, ok := publicIPs[target]; ok {
+			endpointConfig.TargetResourceID = address.ID
+		}
+		endpointConfig.EndpointName = p.targetEndpointName(nameClaims, newConfig, newEndpoint, vanityHostname, target, i)
+		if endpointConfig.Priority, err = priorities.assign(newConfig, endpointConfig.EndpointName); err != nil {
+			return err
+		}
+
+		// Check if we should update weight, priority, status or custom headers
+		if oldConfig != nil &&
+			(oldConfig.Weight != newConfig.Weight || oldConfig.EndpointStatus != newConfig.EndpointStatus ||
+				oldConfig.Priority != newConfig.Priority || oldConfig.PriorityAuto != newConfig.PriorityAuto ||
+				oldConfig.HealthChecksEnabled != newConfig.HealthChecksEnabled ||
+				!maps.Equal(oldConfig.EndpointCustomHeaders, newConfig.EndpointCustomHeaders) ||
+				oldConfig.DisableSchedule.String() != newConfig.DisableSchedule.String() ||
+				oldConfig.EnableSchedule.String() != newConfig.EnableSchedule.String()) {
+
+			endpointConfig.Status = p.scheduledStatus(newConfig, endpointConfig.Status)
+
+			if newConfig.CanaryStepPercent > 0 {
+				// The canary paces the change, so the per-apply guardrail doesn't apply
+				start := oldConfig.Weight
+				if existing, ok := p.stateManager.GetEndpoint(vanityHostname, endpointConfig.EndpointName); ok && existing.Weight > 0 {
+					start = existing.Weight
+				}
+				endpointConfig.Weight = p.canaryWeight(ctx, newConfig, vanityHostname, endpointConfig.EndpointName, start, endpointConfig.Weight)
+			} else {
+				weight, err := p.guardWeightChange(vanityHostname, endpointConfig.EndpointName, oldConfig.Weight, endpointConfig.Weight, newConfig.AllowLargeWeightChange)
+				if err != nil {
+					return err
+				}
+				endpointConfig.Weight = weight
+				p.stopCanary(newConfig.ProfileName, endpointConfig.EndpointName)
+			}
+
+			p.log(ctx).Info("Updating Traffic Manager endpoint",
 				zap.String("endpointName", endpointConfig.EndpointName),
 				zap.Int64("weight", endpointConfig.Weight),
 				zap.String("status", endpointConfig.Status))
 
-			endpointState, err := p.tmClient.UpdateEndpoint(ctx, newConfig.ResourceGroup, newConfig.ProfileName, endpointConfig)
+			endpointState, err := tmClient.UpdateEndpoint(ctx, newConfig.ResourceGroup, newConfig.ProfileName, endpointConfig)
 			if err != nil {
 				return fmt.Errorf("failed to update endpoint %s: %w", endpointConfig.EndpointName, err)
 			}
+			p.cancelEndpointDrain(ctx, newConfig.ProfileName, endpointConfig.EndpointName)
+
+			var currentMetadata *state.EndpointMetadata
+			if existing, ok := p.stateManager.GetEndpoint(vanityHostname, endpointConfig.EndpointName); ok {
+				currentMetadata = existing.Metadata
+			}
+			metadata, err := p.recordEndpointMetadata(ctx, tmClient, newConfig, endpointConfig, newEndpoint, currentMetadata)
+			if err != nil {
+				metadataErrs = append(metadataErrs, err)
+			}
+
+			// Disabling an endpoint drains it on purpose; re-enabling it ends the silence
+			if endpointConfig.Status == "Disabled" && oldConfig.EndpointStatus != "Disabled" {
+				reason := SilenceReasonDisabled
+				if newConfig.Maintenance {
+					reason = SilenceReasonMaintenance
+				} else if newConfig.EndpointStatus != "Disabled" {
+					reason = SilenceReasonScheduled
+				}
+				p.silence(ctx, vanityHostname, newConfig.ProfileName, endpointConfig.EndpointName, reason)
+			} else if endpointConfig.Status != "Disabled" {
+				p.unsilence(newConfig.ProfileName, endpointConfig.EndpointName)
+			}
 
-			// Update state with modified endpoint
-			p.stateManager.SetEndpoint(newEndpoint.DNSName, endpointConfig.EndpointName, convertToStateEndpoint(endpointState))
+			// Update state with modified endpoint; the metadata carries its schedule to the scheduler
+			stateEndpoint := convertToStateEndpoint(endpointState)
+			stateEndpoint.Metadata = metadata
+			p.stateManager.SetEndpoint(vanityHostname, endpointConfig.EndpointName, stateEndpoint)
 		}
 	}
 
-	// Refresh complete profile state
-	profileState, err := p.tmClient.GetProfileState(ctx, newConfig.ResourceGroup, newConfig.ProfileName)
+	// Add, retarget or remove the fallback endpoint
+	if newConfig.FallbackTarget != "" {
+		if err := p.ensureFallbackEndpoint(ctx, tmClient, newConfig); err != nil {
+			return err
+		}
+	} else if oldConfig != nil && oldConfig.FallbackTarget != "" {
+		if err := p.removeFallbackEndpoint(ctx, tmClient, newConfig); err != nil {
+			return err
+		}
+	}
+
+	// Refresh complete profile state (store under vanity hostname)
+	profileState, err := tmClient.GetProfileState(ctx, newConfig.ResourceGroup, newConfig.ProfileName)
 	if err == nil {
-		profileState.Hostname = newEndpoint.DNSName
-		p.stateManager.SetProfile(newEndpoint.DNSName, profileState)
+		profileState.Hostname = vanityHostname
+		p.stateManager.SetProfile(vanityHostname, profileState)
+	}
+
+	p.rememberEndpointConfig(ctx, newEndpoint, newConfig)
+
+	if len(metadataErrs) > 0 {
+		return errors.Join(metadataErrs...)
 	}
 
-	p.logger.Info("Successfully updated Traffic Manager endpoint",
+	p.log(ctx).Info("Successfully updated Traffic Manager endpoint",
 		zap.String("dnsName", newEndpoint.DNSName))
 
 	return nil
@@ -434,22 +1192,37 @@ func (p *TrafficManagerProvider) updateEndpoint(ctx context.Context, oldEndpoint
 
 // deleteEndpoint deletes a Traffic Manager endpoint
 func (p *TrafficManagerProvider) deleteEndpoint(ctx context.Context, endpoint *Endpoint) error {
-	p.logger.Info("Deleting endpoint",
+	p.log(ctx).Info("Deleting endpoint",
 		zap.String("dnsName", endpoint.DNSName))
 
 	// Parse Traffic Manager configuration
-	config, err := annotations.ParseConfig(endpoint.Labels)
+	config, err := p.parseAnnotations(ctx, endpoint.annotationMap())
 	if err != nil {
-		return fmt.Errorf("failed to parse annotations: %w", err)
+		return withCode(ErrorCodeInvalidAnnotation, fmt.Errorf("failed to parse annotations: %w", err))
 	}
 
+	// External DNS often drops the annotations on deletes; fall back to what the endpoint was created with
+	p.storedConfigForDelete(ctx, config, endpoint)
+
 	// Skip if Traffic Manager is not enabled
 	if !config.Enabled {
-		p.logger.Debug("Traffic Manager not enabled for this endpoint", 
+		p.log(ctx).Debug("Traffic Manager not enabled for this endpoint",
 			zap.String("dnsName", endpoint.DNSName))
 		return nil
 	}
 
+	// Endpoints created for public IPs are AzureEndpoints, which are deleted by that type
+	p.resolvePublicIPs(ctx, config, endpoint)
+
+	if err := p.resourcePolicy.check(sourceNamespace(endpoint), config.SubscriptionID, config.ResourceGroup); err != nil {
+		return err
+	}
+
+	tmClient, err := p.clientFor(config.SubscriptionID, config.ResourceGroup)
+	if err != nil {
+		return err
+	}
+
 	// Use vanity hostname if specified
 	vanityHostname := config.Hostname
 	if vanityHostname == "" {
@@ -458,59 +1231,114 @@ func (p *TrafficManagerProvider) deleteEndpoint(ctx context.Context, endpoint *E
 
 	// Generate names if not specified
 	if config.ProfileName == "" {
-		config.ProfileName = generateProfileName(endpoint.DNSName)
+		if config.ProfileName, err = p.profileNameFor(config, endpoint, vanityHostname); err != nil {
+			return err
+		}
 	}
 	if config.EndpointName == "" {
-		config.EndpointName = generateEndpointName(endpoint.DNSName, endpoint.Targets)
+		if config.EndpointName, err = p.renderEndpointName(config, endpoint, vanityHostname, ""); err != nil {
+			return err
+		}
+	}
+
+	// After a handoff the new cluster manages the endpoint; leave it, the profile and its stored config in place
+	owner, other, err := p.endpointOwnedByOtherCluster(ctx, tmClient, config, vanityHostname)
+	if err != nil {
+		return err
+	}
+	if other {
+		p.log(ctx).Info("Skipping delete of endpoint owned by another cluster",
+			zap.String("endpointName", config.EndpointName),
+			zap.String("profileName", config.ProfileName),
+			zap.String("cluster", owner))
+		return nil
 	}
 
 	// Delete endpoints
 	for _ = range endpoint.Targets {
-		p.logger.Info("Deleting Traffic Manager endpoint",
-			zap.String("endpointName", config.EndpointName),
-			zap.String("profileName", config.ProfileName))
 
-		err := p.tmClient.DeleteEndpoint(ctx, config.ResourceGroup, config.ProfileName, config.EndpointType, config.EndpointName)
-		if err != nil {
+		// Take the endpoint out of rotation first; the drain controller deletes it once cached answers expire
+		if p.drainEndpoints() {
+			if err := p.startEndpointDrain(ctx, tmClient, config, vanityHostname, endpoint.DNSName); err != nil {
+				p.log(ctx).Warn("Failed to drain endpoint",
+					zap.String("endpointName", config.EndpointName),
+					zap.Error(err))
+			}
+			continue
+		}
+
+		if err := p.removeEndpoint(ctx, tmClient, config, vanityHostname); err != nil {
 			// Log but don't fail if endpoint doesn't exist
-			p.logger.Warn("Failed to delete endpoint", 
+			p.log(ctx).Warn("Failed to delete endpoint",
 				zap.String("endpointName", config.EndpointName),
 				zap.Error(err))
-		} else {
-			// Remove from state
-			p.stateManager.DeleteEndpoint(endpoint.DNSName, config.EndpointName)
 		}
 	}
 
-	// Check if profile still has endpoints
-	profileState, err := p.tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
-	if err == nil && len(profileState.Endpoints) == 0 {
-		// Profile is empty, delete it
-		p.logger.Info("Deleting empty Traffic Manager profile",
+	p.deleteProfileIfEmpty(ctx, tmClient, config, vanityHostname, endpoint.DNSName)
+	p.forgetEndpointConfig(ctx, endpoint)
+
+	p.log(ctx).Info("Successfully deleted Traffic Manager endpoint",
+		zap.String("dnsName", endpoint.DNSName))
+
+	return nil
+}
+
+// removeEndpoint deletes an endpoint from Azure and forgets it
+func (p *TrafficManagerProvider) removeEndpoint(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, vanityHostname string) error {
+	p.log(ctx).Info("Deleting Traffic Manager endpoint",
+		zap.String("endpointName", config.EndpointName),
+		zap.String("profileName", config.ProfileName))
+
+	// An endpoint, or profile, that is already gone needs no deleting
+	if err := tmClient.DeleteEndpoint(ctx, config.ResourceGroup, config.ProfileName, config.EndpointType, config.EndpointName); err != nil && !trafficmanager.IsNotFound(err) {
+		return err
+	}
+
+	// Remove from state (stored under vanity hostname)
+	p.stateManager.DeleteEndpoint(vanityHostname, config.EndpointName)
+	p.stopCanary(config.ProfileName, config.EndpointName)
+	p.silence(ctx, vanityHostname, config.ProfileName, config.EndpointName, SilenceReasonDeleted)
+
+	if err := tmClient.RemoveEndpointMetadata(ctx, config.ResourceGroup, config.ProfileName, config.EndpointName); err != nil {
+		p.log(ctx).Warn("Failed to remove endpoint metadata",
+			zap.String("endpointName", config.EndpointName),
+			zap.Error(err))
+	}
+	return nil
+}
+
+// deleteProfileIfEmpty deletes a profile, and its vanity record, once it has no endpoints left apart from
+// any fallback and it isn't protected from deletion; otherwise it refreshes the cached profile
+func (p *TrafficManagerProvider) deleteProfileIfEmpty(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, vanityHostname, dnsName string) {
+	profileState, err := tmClient.GetProfileState(ctx, config.ResourceGroup, config.ProfileName)
+	if err == nil && primaryEndpointCount(profileState) == 0 && deletionProtected(config, profileState) {
+		p.log(ctx).Warn("Refusing to delete empty Traffic Manager profile with deletion protection",
+			zap.String("hostname", vanityHostname),
 			zap.String("profileName", config.ProfileName))
-		
-		err = p.tmClient.DeleteProfile(ctx, config.ResourceGroup, config.ProfileName)
+		metrics.ProfileDeletionsBlocked.WithLabelValues(config.ProfileName).Inc()
+
+		profileState.Hostname = vanityHostname
+		p.stateManager.SetProfile(vanityHostname, profileState)
+	} else if err == nil && primaryEndpointCount(profileState) == 0 {
+		// Profile is empty apart from any fallback, delete it
+		p.log(ctx).Info("Deleting empty Traffic Manager profile",
+			zap.String("profileName", config.ProfileName),
+			zap.Duration("gracePeriod", p.profileDeleteGracePeriod))
+
+		err = p.retireProfile(ctx, tmClient, config)
 		if err != nil {
-			p.logger.Warn("Failed to delete profile",
+			p.log(ctx).Warn("Failed to delete profile",
 				zap.String("profileName", config.ProfileName),
 				zap.Error(err))
 		} else {
 			p.stateManager.DeleteProfile(vanityHostname)
-			
-			// Delete the DNSEndpoint CRD for vanity URL
-			if vanityHostname != "" && vanityHostname != endpoint.DNSName {
-				dnsEndpointName := dnsendpoint.GenerateName(vanityHostname)
-				err = p.dnsEndpointManager.Delete(ctx, dnsEndpointName)
-				if err != nil {
-					p.logger.Warn("Failed to delete DNSEndpoint for vanity URL",
-						zap.String("vanityHostname", vanityHostname),
-						zap.String("dnsEndpointName", dnsEndpointName),
-						zap.Error(err))
-				} else {
-					p.logger.Info("Successfully deleted DNSEndpoint for vanity URL",
-						zap.String("vanityHostname", vanityHostname),
-						zap.String("dnsEndpointName", dnsEndpointName))
-				}
+			metrics.FallbackActive.DeleteLabelValues(config.ProfileName)
+			p.silence(ctx, vanityHostname, config.ProfileName, "", SilenceReasonDeleted)
+
+			// Delete the record for the vanity URL
+			if vanityHostname != "" && vanityHostname != dnsName && config.VanityRecordType != annotations.VanityRecordTypeNone {
+				p.deleteVanityRecord(ctx, vanityHostname, config.VanityRecordType)
 			}
 		}
 	} else if err == nil {
@@ -518,33 +1346,121 @@ func (p *TrafficManagerProvider) deleteEndpoint(ctx context.Context, endpoint *E
 		profileState.Hostname = vanityHostname
 		p.stateManager.SetProfile(vanityHostname, profileState)
 	}
+}
 
-	p.logger.Info("Successfully deleted Traffic Manager endpoint",
-		zap.String("dnsName", endpoint.DNSName))
+// recordEndpointMetadata persists where an endpoint came from on its profile and returns it as saved,
+// with optional fields dropped if it is too long for a tag. The metadata is returned even when it
+// couldn't be saved, so the rest of the change can use it. A failed request then fails the change,
+// and External DNS applies it again; metadata that can never fit is logged instead, as retrying
+// wouldn't help.
+func (p *TrafficManagerProvider) recordEndpointMetadata(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig, endpointConfig *trafficmanager.EndpointConfig, endpoint *Endpoint, current *state.EndpointMetadata) (*state.EndpointMetadata, error) {
+	metadata := &state.EndpointMetadata{
+		Cluster:   p.clusterName,
+		Namespace: sourceNamespace(endpoint),
+		Weight:    endpointConfig.Weight,
+		Service:   resourceService(endpoint.Labels),
+	}
+	// An endpoint the annotations disable outright, e.g. for maintenance, stays disabled whatever its schedule
+	if config.EndpointStatus != "Disabled" {
+		metadata.DisableSchedule = config.DisableSchedule.String()
+		metadata.EnableSchedule = config.EnableSchedule.String()
+	}
 
-	return nil
+	fitted, ok := trafficmanager.FitEndpointMetadata(endpointConfig.EndpointName, metadata)
+	if !ok {
+		p.log(ctx).Warn("Endpoint metadata is too long to record, the endpoint has no recorded cluster",
+			zap.String("profileName", config.ProfileName),
+			zap.String("endpointName", endpointConfig.EndpointName))
+		return metadata, nil
+	}
+	if *fitted != *metadata {
+		p.log(ctx).Warn("Endpoint metadata is too long for a tag, recording it without some optional fields",
+			zap.String("profileName", config.ProfileName),
+			zap.String("endpointName", endpointConfig.EndpointName))
+		metadata = fitted
+	}
+
+	// current is the metadata already recorded, if any
+	if current != nil && *current == *metadata {
+		metrics.AzureWritesSkipped.WithLabelValues(skippedWriteMetadata).Inc()
+		return metadata, nil
+	}
+
+	if err := tmClient.SetEndpointMetadata(ctx, config.ResourceGroup, config.ProfileName, endpointConfig.EndpointName, metadata); errors.Is(err, trafficmanager.ErrEndpointMetadataTooLarge) {
+		p.log(ctx).Warn("Endpoint metadata doesn't fit the profile's tags, the endpoint has no recorded cluster",
+			zap.String("profileName", config.ProfileName),
+			zap.String("endpointName", endpointConfig.EndpointName),
+			zap.Error(err))
+	} else if err != nil {
+		p.log(ctx).Error("Failed to record endpoint metadata",
+			zap.String("profileName", config.ProfileName),
+			zap.String("endpointName", endpointConfig.EndpointName),
+			zap.Error(err))
+		return metadata, fmt.Errorf("failed to record metadata of endpoint %s: %w", endpointConfig.EndpointName, err)
+	}
+	return metadata, nil
 }
 
-// generateProfileName generates a profile name from a DNS name
+// endpointTargets returns the targets Traffic Manager endpoints are created for. An address (A or
+// AAAA) record's endpoint points at its DNS name (the individual service DNS like
+// demo-east.example.com) rather than its addresses, so a dual-stack service's A and AAAA records
+// share one endpoint that answers for both; other record types use their targets. Records with a
+// set identifier always use their targets: External DNS models weighted records as one DNS name
+// with a target set per identifier, and pointing each at the shared DNS name would route every
+// identifier the same way. IPv6 targets are canonicalized.
+func endpointTargets(endpoint *Endpoint) []string {
+	if len(endpoint.Targets) == 0 || (isAddressRecord(endpoint.RecordType) && endpoint.SetIdentifier == "") {
+		return []string{endpoint.DNSName}
+	}
+	targets := make([]string, len(endpoint.Targets))
+	for i, target := range endpoint.Targets {
+		targets[i] = canonicalTarget(target)
+	}
+	return targets
+}
+
+// writtenTargets returns the targets endpoints are written for. Each Azure public IP gets its own
+// endpoint rather than the A record's DNS name.
+func writtenTargets(endpoint *Endpoint, publicIPs map[string]publicip.Address) []string {
+	if publicIPs != nil {
+		return endpoint.Targets
+	}
+	return endpointTargets(endpoint)
+}
+
+// isAddressRecord reports whether recordType holds IP addresses
+func isAddressRecord(recordType string) bool {
+	return recordType == "A" || recordType == "AAAA"
+}
+
+// sourceNamespace extracts the Kubernetes namespace from the External DNS "resource" label
+// (e.g., "service/default/myapp")
+func sourceNamespace(endpoint *Endpoint) string {
+	return resourceNamespace(endpoint.Labels)
+}
+
+// generateProfileName generates a profile name from a DNS name with the default template
+// e.g., "myapp.example.com" -> "myapp-example-com-tm"
 func generateProfileName(dnsName string) string {
-	// Remove dots and use as profile name
-	// e.g., "myapp.example.com" -> "myapp-example-com"
-	return fmt.Sprintf("%s-tm", sanitizeName(dnsName))
+	name, _ := renderName(defaultProfileNameTemplate, nameData{Hostname: dnsName, Target: dnsName})
+	return name
 }
 
-// generateEndpointName generates an endpoint name from DNS name and target
+// generateEndpointName generates an endpoint name from DNS name and target with the default template
 func generateEndpointName(dnsName string, targets []string) string {
+	target := dnsName
 	if len(targets) > 0 {
-		return sanitizeName(targets[0])
+		target = targets[0]
 	}
-	return sanitizeName(dnsName)
+	name, _ := renderName(defaultEndpointNameTemplate, nameData{Hostname: dnsName, Target: nameTarget(target)})
+	return name
 }
 
 // generateEndpointNameFromTarget generates a unique endpoint name from a target IP/hostname
 func generateEndpointNameFromTarget(target string, index int) string {
-	// For IPs, replace dots with hyphens
+	// For IPs, replace dots (or IPv6 colons) with hyphens
 	// For hostnames, sanitize and add index
-	sanitized := sanitizeName(target)
+	sanitized := sanitizeName(nameTarget(target))
 	if index > 0 {
 		return fmt.Sprintf("%s-%d", sanitized, index)
 	}
@@ -568,14 +1484,24 @@ func sanitizeName(name string) string {
 // convertToStateEndpoint converts trafficmanager.EndpointState to state.EndpointState
 func convertToStateEndpoint(tmEndpoint *trafficmanager.EndpointState) *state.EndpointState {
 	return &state.EndpointState{
-		EndpointName: tmEndpoint.EndpointName,
-		EndpointType: tmEndpoint.EndpointType,
-		Target:       tmEndpoint.Target,
-		Weight:       tmEndpoint.Weight,
-		Priority:     tmEndpoint.Priority,
-		Status:       tmEndpoint.Status,
-		Location:     tmEndpoint.Location,
-		CreatedAt:    tmEndpoint.CreatedAt,
-		UpdatedAt:    tmEndpoint.UpdatedAt,
+		EndpointName:  tmEndpoint.EndpointName,
+		EndpointType:  tmEndpoint.EndpointType,
+		Target:        tmEndpoint.Target,
+		Weight:        tmEndpoint.Weight,
+		Priority:      tmEndpoint.Priority,
+		Status:        tmEndpoint.Status,
+		MonitorStatus: tmEndpoint.MonitorStatus,
+		Location:      tmEndpoint.Location,
+		CreatedAt:     tmEndpoint.CreatedAt,
+		UpdatedAt:     tmEndpoint.UpdatedAt,
+
+		TargetResourceID: tmEndpoint.TargetResourceID,
+		AlwaysServe:      tmEndpoint.AlwaysServe,
+		CustomHeaders:    tmEndpoint.CustomHeaders,
 	}
 }
+
+// log returns the provider logger with the request ID from ctx attached
+func (p *TrafficManagerProvider) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, p.logger)
+}
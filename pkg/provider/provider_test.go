@@ -0,0 +1,239 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestProfileToEndpoint(t *testing.T) {
+	profile := &state.ProfileState{
+		ProfileName:   "demo-example-com-tm",
+		ResourceGroup: "tm-rg",
+		ResourceID:    "/subscriptions/sub/resourceGroups/tm-rg/providers/Microsoft.Network/trafficManagerProfiles/demo-example-com-tm",
+		Hostname:      "demo.example.com",
+		FQDN:          "demo-example-com-tm.trafficmanager.net",
+		RoutingMethod: "Weighted",
+	}
+
+	endpoint := profileToEndpoint(profile)
+
+	assert.Equal(t, "demo.example.com", endpoint.DNSName)
+	assert.Equal(t, []string{"demo-example-com-tm.trafficmanager.net"}, endpoint.Targets)
+	assert.Equal(t, "CNAME", endpoint.RecordType)
+	assert.Equal(t, int64(defaultRecordTTL), endpoint.RecordTTL)
+	assert.Equal(t, "demo-example-com-tm", endpoint.Labels["traffic-manager-profile"])
+	assert.Equal(t, "tm-rg", endpoint.Labels["traffic-manager-resource-group"])
+	assert.Equal(t, "Weighted", endpoint.Labels["traffic-manager-routing-method"])
+	assert.Equal(t, profile.ResourceID, endpoint.Labels["traffic-manager-profile-id"])
+	assert.Equal(t, "demo-example-com-tm.trafficmanager.net", endpoint.Labels["traffic-manager-fqdn"])
+}
+
+func TestProfileToEndpoint_DNSTTL(t *testing.T) {
+	endpoint := profileToEndpoint(&state.ProfileState{Hostname: "demo.example.com", DNSTTL: 60})
+	assert.Equal(t, int64(60), endpoint.RecordTTL)
+}
+
+func TestVanityTTL(t *testing.T) {
+	assert.Equal(t, int64(120), vanityTTL(&annotations.TrafficManagerConfig{DNSTTL: 60}, &Endpoint{RecordTTL: 120}), "the source TTL wins")
+	assert.Equal(t, int64(60), vanityTTL(&annotations.TrafficManagerConfig{DNSTTL: 60}, &Endpoint{}))
+	assert.Equal(t, int64(defaultRecordTTL), vanityTTL(&annotations.TrafficManagerConfig{}, &Endpoint{}))
+}
+
+func TestEndpointTargets(t *testing.T) {
+	assert.Equal(t, []string{"demo-east.example.com"}, endpointTargets(&Endpoint{DNSName: "demo-east.example.com", RecordType: "A", Targets: []string{"20.30.40.50"}}))
+	assert.Equal(t, []string{"backend.example.net"}, endpointTargets(&Endpoint{DNSName: "demo-east.example.com", RecordType: "CNAME", Targets: []string{"backend.example.net"}}))
+	assert.Equal(t, []string{"20.30.40.50"}, endpointTargets(&Endpoint{DNSName: "demo.example.com", RecordType: "A", Targets: []string{"20.30.40.50"}, SetIdentifier: "blue"}),
+		"weighted records route to their own targets")
+	assert.Equal(t, []string{"demo.example.com"}, endpointTargets(&Endpoint{DNSName: "demo.example.com", RecordType: "CNAME"}))
+	assert.Equal(t, []string{"demo-east.example.com"}, endpointTargets(&Endpoint{DNSName: "demo-east.example.com", RecordType: "AAAA", Targets: []string{"2001:db8::1"}}),
+		"AAAA records share the endpoint of their A record")
+	assert.Equal(t, []string{"2001:db8::1"}, endpointTargets(&Endpoint{DNSName: "demo.example.com", RecordType: "AAAA", Targets: []string{"2001:DB8:0::1"}, SetIdentifier: "blue"}))
+}
+
+func TestSourceNamespace(t *testing.T) {
+	assert.Equal(t, "apps", sourceNamespace(&Endpoint{Labels: map[string]string{"resource": "service/apps/demo"}}))
+	assert.Equal(t, "", sourceNamespace(&Endpoint{Labels: map[string]string{"resource": "crd"}}))
+	assert.Equal(t, "", sourceNamespace(&Endpoint{}))
+}
+
+func TestApplyChanges_UpsertOnlySkipsDeletes(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger: zaptest.NewLogger(t),
+		policy: PolicyUpsertOnly,
+	}
+
+	changes := &Changes{
+		Delete: []*Endpoint{
+			{
+				DNSName:    "demo-east.example.com",
+				Targets:    []string{"1.2.3.4"},
+				RecordType: "A",
+				Labels: map[string]string{
+					"webhook/traffic-manager-enabled":        "true",
+					"webhook/traffic-manager-resource-group": "tm-rg",
+				},
+			},
+		},
+	}
+
+	// No Azure client is configured, so any delete attempt would panic
+	assert.NoError(t, p.ApplyChanges(context.Background(), changes))
+	assert.Len(t, changes.Delete, 1)
+}
+
+func TestCheckVanityRecordType(t *testing.T) {
+	p := &TrafficManagerProvider{vanityRecordMode: VanityRecordModeDNSEndpoint}
+	assert.NoError(t, p.checkVanityRecordType(""))
+	assert.NoError(t, p.checkVanityRecordType(annotations.VanityRecordTypeCNAME))
+	assert.NoError(t, p.checkVanityRecordType(annotations.VanityRecordTypeNone))
+	assert.Error(t, p.checkVanityRecordType(annotations.VanityRecordTypeAlias))
+
+	p.vanityRecordMode = VanityRecordModeAzureDNS
+	assert.NoError(t, p.checkVanityRecordType(annotations.VanityRecordTypeAlias))
+}
+
+func TestUpdateEndpoint_CustomHeaders(t *testing.T) {
+	ctx := context.Background()
+	azure := fakeazure.New()
+	p := newFakeAzureProvider(t, azure, "")
+
+	old := managedRecord("app-east.example.com", "203.0.113.10", "east")
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{Create: []*Endpoint{old}}))
+
+	// Only the custom headers annotation changes
+	updated := managedRecord("app-east.example.com", "203.0.113.10", "east")
+	updated.ProviderSpecific = append(updated.ProviderSpecific,
+		ProviderSpecificProperty{Name: annotations.AnnotationEndpointCustomHeaders, Value: "host:tenant-a.example.com"})
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{UpdateOld: []*Endpoint{old}, UpdateNew: []*Endpoint{updated}}))
+
+	profile := azure.Profile("default-sub", "tm-rg", "app-tm")
+	require.NotNil(t, profile)
+	require.Len(t, profile.Properties.Endpoints, 1)
+	headers := profile.Properties.Endpoints[0].Properties.CustomHeaders
+	require.Len(t, headers, 1)
+	assert.Equal(t, "host", *headers[0].Name)
+	assert.Equal(t, "tenant-a.example.com", *headers[0].Value)
+}
+
+func TestUpdateEndpoint_SameEndpointsAsCreate(t *testing.T) {
+	tests := []struct {
+		name          string
+		setIdentifier string
+		want          map[string]string
+	}{
+		{
+			// Both addresses are served by one endpoint pointing at the record's DNS name
+			name: "multi-target A record",
+			want: map[string]string{"east-0": "app-east.example.com"},
+		},
+		{
+			name:          "set identifier",
+			setIdentifier: "east",
+			want:          map[string]string{"east-0": "203.0.113.10", "east-1": "203.0.113.11"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			azure := fakeazure.New()
+			p := newFakeAzureProvider(t, azure, "")
+
+			record := func() *Endpoint {
+				r := managedRecord("app-east.example.com", "203.0.113.10", "east")
+				r.Targets = append(r.Targets, "203.0.113.11")
+				r.SetIdentifier = tt.setIdentifier
+				return r
+			}
+			old := record()
+			require.NoError(t, p.ApplyChanges(ctx, &Changes{Create: []*Endpoint{old}}))
+
+			updated := record()
+			updated.ProviderSpecific = append(updated.ProviderSpecific,
+				ProviderSpecificProperty{Name: annotations.AnnotationEndpointCustomHeaders, Value: "host:tenant-a.example.com"})
+			require.NoError(t, p.ApplyChanges(ctx, &Changes{UpdateOld: []*Endpoint{old}, UpdateNew: []*Endpoint{updated}}))
+
+			profile := azure.Profile("default-sub", "tm-rg", "app-tm")
+			require.NotNil(t, profile)
+			targets := make(map[string]string)
+			for _, endpoint := range profile.Properties.Endpoints {
+				targets[*endpoint.Name] = *endpoint.Properties.Target
+				assert.Len(t, endpoint.Properties.CustomHeaders, 1, "endpoint %s wasn't updated", *endpoint.Name)
+			}
+			assert.Equal(t, tt.want, targets)
+		})
+	}
+}
+
+func TestGeneratedProfileName_VanityHostname(t *testing.T) {
+	ctx := context.Background()
+	azure := fakeazure.New()
+	p := newFakeAzureProvider(t, azure, "")
+
+	// Without the profile name annotation, the name is generated from the vanity hostname
+	record := func() *Endpoint {
+		r := managedRecord("app-east.example.com", "203.0.113.10", "east")
+		properties := r.ProviderSpecific[:0]
+		for _, property := range r.ProviderSpecific {
+			if property.Name != annotations.AnnotationProfileName {
+				properties = append(properties, property)
+			}
+		}
+		r.ProviderSpecific = properties
+		return r
+	}
+	old := record()
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{Create: []*Endpoint{old}}))
+	assert.Equal(t, []string{"app-example-com-tm"}, azure.ProfileNames())
+
+	// The cache doesn't know the profile under the record's own DNS name either
+	p.stateManager.Clear()
+	updated := record()
+	updated.ProviderSpecific = append(updated.ProviderSpecific,
+		ProviderSpecificProperty{Name: annotations.AnnotationEndpointCustomHeaders, Value: "host:tenant-a.example.com"})
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{UpdateOld: []*Endpoint{old}, UpdateNew: []*Endpoint{updated}}))
+	profile := azure.Profile("default-sub", "tm-rg", "app-example-com-tm")
+	require.NotNil(t, profile)
+	require.Len(t, profile.Properties.Endpoints, 1)
+	assert.Len(t, profile.Properties.Endpoints[0].Properties.CustomHeaders, 1)
+
+	p.stateManager.Clear()
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{Delete: []*Endpoint{updated}}))
+	assert.Empty(t, azure.ProfileNames())
+}
+
+func TestUpdateEndpoint_IPv6Target(t *testing.T) {
+	ctx := context.Background()
+	azure := fakeazure.New()
+	p := newFakeAzureProvider(t, azure, "")
+
+	record := func() *Endpoint {
+		r := managedRecord("app-east.example.com", "2001:DB8:0:0::1", "east")
+		r.RecordType = "AAAA"
+		r.SetIdentifier = "east"
+		return r
+	}
+	old := record()
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{Create: []*Endpoint{old}}))
+
+	// The update writes the endpoint the create made rather than one for the address as written
+	updated := record()
+	updated.ProviderSpecific = append(updated.ProviderSpecific,
+		ProviderSpecificProperty{Name: annotations.AnnotationEndpointCustomHeaders, Value: "host:tenant-a.example.com"})
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{UpdateOld: []*Endpoint{old}, UpdateNew: []*Endpoint{updated}}))
+
+	profile := azure.Profile("default-sub", "tm-rg", "app-tm")
+	require.NotNil(t, profile)
+	require.Len(t, profile.Properties.Endpoints, 1)
+	endpoint := profile.Properties.Endpoints[0]
+	assert.Equal(t, "east", *endpoint.Name)
+	assert.Equal(t, "2001:db8::1", *endpoint.Properties.Target)
+	assert.Len(t, endpoint.Properties.CustomHeaders, 1)
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/publicip"
+	"go.uber.org/zap"
+)
+
+// publicIPResolver finds public IP address resources by address; implemented by publicip.Client
+type publicIPResolver interface {
+	Lookup(ctx context.Context, ip string) (address publicip.Address, ok bool, err error)
+}
+
+// resolvePublicIPs looks up the public IP resources behind an A record's addresses when public IP
+// resolution is on. If every address belongs to one, config becomes AzureEndpoints and the
+// resources are returned by address: Azure then knows each endpoint's region, so Performance
+// routing needs no endpoint location. Otherwise it returns nil and the record is handled as an
+// external endpoint as before.
+func (p *TrafficManagerProvider) resolvePublicIPs(ctx context.Context, config *annotations.TrafficManagerConfig, endpoint *Endpoint) map[string]publicip.Address {
+	if p.publicIPs == nil || endpoint.RecordType != "A" || len(endpoint.Targets) == 0 || config.EndpointType != "ExternalEndpoints" {
+		return nil
+	}
+
+	addresses := make(map[string]publicip.Address, len(endpoint.Targets))
+	for _, target := range endpoint.Targets {
+		address, ok, err := p.publicIPs.Lookup(ctx, target)
+		if err != nil {
+			p.log(ctx).Warn("Failed to look up public IP address, using an external endpoint",
+				zap.String("dnsName", endpoint.DNSName),
+				zap.String("target", target),
+				zap.Error(err))
+			return nil
+		}
+		if !ok {
+			p.log(ctx).Debug("Target is not a public IP resource in the subscription, using an external endpoint",
+				zap.String("dnsName", endpoint.DNSName),
+				zap.String("target", target))
+			return nil
+		}
+		if address.FQDN == "" {
+			// Traffic Manager rejects public IPs without a DNS name label as AzureEndpoints
+			p.log(ctx).Warn("Public IP address has no DNS name label, using an external endpoint",
+				zap.String("dnsName", endpoint.DNSName),
+				zap.String("publicIP", address.ID))
+			return nil
+		}
+		addresses[target] = address
+	}
+
+	config.EndpointType = "AzureEndpoints"
+	return addresses
+}
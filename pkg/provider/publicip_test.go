@@ -0,0 +1,56 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/publicip"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakePublicIPs resolves the addresses it holds
+type fakePublicIPs struct {
+	addresses map[string]publicip.Address
+	err       error
+}
+
+func (f *fakePublicIPs) Lookup(ctx context.Context, ip string) (publicip.Address, bool, error) {
+	address, ok := f.addresses[ip]
+	return address, ok, f.err
+}
+
+func TestResolvePublicIPs(t *testing.T) {
+	east := publicip.Address{ID: "/subscriptions/sub/resourceGroups/mc_rg/providers/Microsoft.Network/publicIPAddresses/east", IP: "20.30.40.50", FQDN: "east.eastus.cloudapp.azure.com"}
+	unlabelled := publicip.Address{ID: "/subscriptions/sub/resourceGroups/mc_rg/providers/Microsoft.Network/publicIPAddresses/unlabelled", IP: "20.30.40.52"}
+	resolver := &fakePublicIPs{addresses: map[string]publicip.Address{east.IP: east, unlabelled.IP: unlabelled}}
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t), publicIPs: resolver}
+	ctx := context.Background()
+
+	config := &annotations.TrafficManagerConfig{EndpointType: "ExternalEndpoints"}
+	addresses := p.resolvePublicIPs(ctx, config, &Endpoint{DNSName: "app-east.example.com", RecordType: "A", Targets: []string{"20.30.40.50"}})
+	assert.Equal(t, map[string]publicip.Address{"20.30.40.50": east}, addresses)
+	assert.Equal(t, "AzureEndpoints", config.EndpointType)
+
+	for name, endpoint := range map[string]*Endpoint{
+		"address outside the subscription": {DNSName: "app.example.com", RecordType: "A", Targets: []string{"20.30.40.50", "20.30.40.51"}},
+		"public IP without a DNS label":    {DNSName: "app.example.com", RecordType: "A", Targets: []string{"20.30.40.52"}},
+		"not an A record":                  {DNSName: "app.example.com", RecordType: "CNAME", Targets: []string{"backend.example.net"}},
+	} {
+		config := &annotations.TrafficManagerConfig{EndpointType: "ExternalEndpoints"}
+		assert.Nil(t, p.resolvePublicIPs(ctx, config, endpoint), name)
+		assert.Equal(t, "ExternalEndpoints", config.EndpointType, name)
+	}
+
+	stored := &annotations.TrafficManagerConfig{EndpointType: "AzureEndpoints"}
+	assert.Nil(t, p.resolvePublicIPs(ctx, stored, &Endpoint{RecordType: "A", Targets: []string{"20.30.40.50"}}), "only external endpoints are resolved")
+	assert.Equal(t, "AzureEndpoints", stored.EndpointType)
+
+	resolver.err = errors.New("forbidden")
+	assert.Nil(t, p.resolvePublicIPs(ctx, &annotations.TrafficManagerConfig{EndpointType: "ExternalEndpoints"}, &Endpoint{RecordType: "A", Targets: []string{"20.30.40.50"}}))
+
+	disabled := &TrafficManagerProvider{logger: zaptest.NewLogger(t)}
+	assert.Nil(t, disabled.resolvePublicIPs(ctx, &annotations.TrafficManagerConfig{EndpointType: "ExternalEndpoints"}, &Endpoint{RecordType: "A", Targets: []string{"20.30.40.50"}}))
+}
@@ -0,0 +1,187 @@
+package provider
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+)
+
+// namespaceQuotas limits the profiles and endpoints each namespace can create; 0 means unlimited
+type namespaceQuotas struct {
+	maxProfiles  int
+	maxEndpoints int
+	profiles     map[string]int // Per-namespace overrides of maxProfiles
+	endpoints    map[string]int // Per-namespace overrides of maxEndpoints
+}
+
+// QuotaUsage is a namespace's current use of its quotas. Max values of 0 mean unlimited.
+type QuotaUsage struct {
+	Namespace    string `json:"namespace"`
+	Profiles     int    `json:"profiles"`
+	MaxProfiles  int    `json:"maxProfiles"`
+	Endpoints    int    `json:"endpoints"`
+	MaxEndpoints int    `json:"maxEndpoints"`
+}
+
+// newNamespaceQuotas parses the quota settings. Overrides are "<namespace>=<limit>" entries.
+func newNamespaceQuotas(maxProfiles, maxEndpoints int, profileOverrides, endpointOverrides []string) (*namespaceQuotas, error) {
+	if maxProfiles < 0 || maxEndpoints < 0 {
+		return nil, fmt.Errorf("namespace quotas must not be negative")
+	}
+
+	profiles, err := parseQuotaOverrides(profileOverrides)
+	if err != nil {
+		return nil, err
+	}
+	endpoints, err := parseQuotaOverrides(endpointOverrides)
+	if err != nil {
+		return nil, err
+	}
+
+	return &namespaceQuotas{
+		maxProfiles:  maxProfiles,
+		maxEndpoints: maxEndpoints,
+		profiles:     profiles,
+		endpoints:    endpoints,
+	}, nil
+}
+
+func parseQuotaOverrides(entries []string) (map[string]int, error) {
+	overrides := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		namespace, value, ok := strings.Cut(entry, "=")
+		limit, err := strconv.Atoi(value)
+		if !ok || namespace == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid namespace quota %q, must be <namespace>=<limit>", entry)
+		}
+		overrides[namespace] = limit
+	}
+	return overrides, nil
+}
+
+// limits returns the profile and endpoint quotas of a namespace
+func (q *namespaceQuotas) limits(namespace string) (int, int) {
+	maxProfiles, maxEndpoints := q.maxProfiles, q.maxEndpoints
+	if limit, ok := q.profiles[namespace]; ok {
+		maxProfiles = limit
+	}
+	if limit, ok := q.endpoints[namespace]; ok {
+		maxEndpoints = limit
+	}
+	return maxProfiles, maxEndpoints
+}
+
+// QuotaUsage returns the usage of every namespace that owns endpoints or has a quota override,
+// ordered by namespace. Usage is counted from the namespace recorded in endpoint metadata;
+// a profile counts against every namespace with an endpoint in it.
+func (p *TrafficManagerProvider) QuotaUsage() []QuotaUsage {
+	usage := namespaceUsage(p.stateManager.ListProfileSnapshots())
+	if p.quotas != nil {
+		for namespace := range p.quotas.profiles {
+			usage[namespace] = usage[namespace]
+		}
+		for namespace := range p.quotas.endpoints {
+			usage[namespace] = usage[namespace]
+		}
+	}
+
+	result := make([]QuotaUsage, 0, len(usage))
+	for namespace, u := range usage {
+		u.Namespace = namespace
+		if p.quotas != nil {
+			u.MaxProfiles, u.MaxEndpoints = p.quotas.limits(namespace)
+		}
+		result = append(result, u)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Namespace < result[j].Namespace })
+	return result
+}
+
+// namespaceUsage counts profiles and endpoints per source namespace
+func namespaceUsage(profiles []*state.ProfileState) map[string]QuotaUsage {
+	usage := make(map[string]QuotaUsage)
+	for _, profile := range profiles {
+		counted := make(map[string]bool)
+		for _, endpoint := range profile.Endpoints {
+			if endpoint.Metadata == nil || endpoint.Metadata.Namespace == "" {
+				continue
+			}
+			namespace := endpoint.Metadata.Namespace
+			u := usage[namespace]
+			u.Endpoints++
+			if !counted[namespace] {
+				counted[namespace] = true
+				u.Profiles++
+			}
+			usage[namespace] = u
+		}
+	}
+	return usage
+}
+
+// checkQuota returns a quota_exceeded error if creating targets for the profile serving
+// vanityHostname would take namespace over its quotas. Targets already in the profile and a
+// profile the namespace already uses don't count again. Endpoints without a namespace are unlimited.
+func (p *TrafficManagerProvider) checkQuota(namespace, vanityHostname string, targets []string) error {
+	if p.quotas == nil || namespace == "" {
+		return nil
+	}
+	maxProfiles, maxEndpoints := p.quotas.limits(namespace)
+	if maxProfiles == 0 && maxEndpoints == 0 {
+		return nil
+	}
+
+	newProfile := true
+	newEndpoints := len(targets)
+	if profile, ok := p.stateManager.GetProfile(vanityHostname); ok {
+		existingTargets := make(map[string]bool)
+		for _, endpoint := range profile.Endpoints {
+			existingTargets[endpoint.Target] = true
+			if endpoint.Metadata != nil && endpoint.Metadata.Namespace == namespace {
+				newProfile = false
+			}
+		}
+		for _, target := range targets {
+			if existingTargets[target] {
+				newEndpoints--
+			}
+		}
+	}
+
+	usage := namespaceUsage(p.stateManager.ListProfileSnapshots())[namespace]
+	if newProfile && maxProfiles > 0 && usage.Profiles+1 > maxProfiles {
+		return withCode(ErrorCodeQuotaExceeded, fmt.Errorf("namespace %s has reached its quota of %d Traffic Manager profiles", namespace, maxProfiles))
+	}
+	if newEndpoints > 0 && maxEndpoints > 0 && usage.Endpoints+newEndpoints > maxEndpoints {
+		return withCode(ErrorCodeQuotaExceeded, fmt.Errorf("namespace %s would exceed its quota of %d Traffic Manager endpoints (%d in use, %d requested)",
+			namespace, maxEndpoints, usage.Endpoints, newEndpoints))
+	}
+	return nil
+}
+
+// updateQuotaMetrics exports the current quota usage; nothing is exported while quotas are disabled
+func (p *TrafficManagerProvider) updateQuotaMetrics() {
+	if p.quotas == nil {
+		return
+	}
+
+	metrics.NamespaceProfiles.Reset()
+	metrics.NamespaceEndpoints.Reset()
+	metrics.NamespaceProfileQuota.Reset()
+	metrics.NamespaceEndpointQuota.Reset()
+
+	for _, u := range p.QuotaUsage() {
+		metrics.NamespaceProfiles.WithLabelValues(u.Namespace).Set(float64(u.Profiles))
+		metrics.NamespaceEndpoints.WithLabelValues(u.Namespace).Set(float64(u.Endpoints))
+		if u.MaxProfiles > 0 {
+			metrics.NamespaceProfileQuota.WithLabelValues(u.Namespace).Set(float64(u.MaxProfiles))
+		}
+		if u.MaxEndpoints > 0 {
+			metrics.NamespaceEndpointQuota.WithLabelValues(u.Namespace).Set(float64(u.MaxEndpoints))
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newQuotaTestProvider(t *testing.T, quotas *namespaceQuotas) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:         logger,
+		subscriptionID: defaultSub,
+		stateManager:   state.NewManager(5*time.Minute, logger),
+		quotas:         quotas,
+	}
+
+	// team-a owns two endpoints in one profile and one in another; team-b shares the first profile
+	p.stateManager.SetProfile("app.example.com", &state.ProfileState{
+		ProfileName: "app-example-com",
+		Hostname:    "app.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"east": {EndpointName: "east", Target: "east.example.com", Metadata: &state.EndpointMetadata{Namespace: "team-a"}},
+			"west": {EndpointName: "west", Target: "west.example.com", Metadata: &state.EndpointMetadata{Namespace: "team-a"}},
+			"b":    {EndpointName: "b", Target: "b.example.com", Metadata: &state.EndpointMetadata{Namespace: "team-b"}},
+		},
+	})
+	p.stateManager.SetProfile("api.example.com", &state.ProfileState{
+		ProfileName: "api-example-com",
+		Hostname:    "api.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"east":     {EndpointName: "east", Target: "api-east.example.com", Metadata: &state.EndpointMetadata{Namespace: "team-a"}},
+			"external": {EndpointName: "external", Target: "other.example.net"},
+		},
+	})
+	return p
+}
+
+func TestNewNamespaceQuotas(t *testing.T) {
+	quotas, err := newNamespaceQuotas(5, 20, []string{"team-a=10"}, []string{"team-b=0"})
+	require.NoError(t, err)
+
+	maxProfiles, maxEndpoints := quotas.limits("team-a")
+	assert.Equal(t, 10, maxProfiles)
+	assert.Equal(t, 20, maxEndpoints)
+
+	maxProfiles, maxEndpoints = quotas.limits("team-b")
+	assert.Equal(t, 5, maxProfiles)
+	assert.Equal(t, 0, maxEndpoints, "an override of 0 lifts the endpoint quota")
+
+	_, err = newNamespaceQuotas(0, 0, []string{"team-a"}, nil)
+	assert.ErrorContains(t, err, "must be <namespace>=<limit>")
+
+	_, err = newNamespaceQuotas(0, 0, nil, []string{"team-a=-1"})
+	assert.ErrorContains(t, err, "must be <namespace>=<limit>")
+
+	_, err = newNamespaceQuotas(-1, 0, nil, nil)
+	assert.ErrorContains(t, err, "must not be negative")
+}
+
+func TestQuotaUsage(t *testing.T) {
+	quotas, err := newNamespaceQuotas(2, 0, nil, []string{"team-c=4"})
+	require.NoError(t, err)
+	p := newQuotaTestProvider(t, quotas)
+
+	assert.Equal(t, []QuotaUsage{
+		{Namespace: "team-a", Profiles: 2, MaxProfiles: 2, Endpoints: 3},
+		{Namespace: "team-b", Profiles: 1, MaxProfiles: 2, Endpoints: 1},
+		{Namespace: "team-c", MaxProfiles: 2, MaxEndpoints: 4},
+	}, p.QuotaUsage())
+}
+
+func TestCheckQuota(t *testing.T) {
+	quotas, err := newNamespaceQuotas(2, 4, nil, []string{"team-b=1"})
+	require.NoError(t, err)
+	p := newQuotaTestProvider(t, quotas)
+
+	// team-a is at its profile quota, so only profiles it already uses are allowed
+	assert.NoError(t, p.checkQuota("team-a", "app.example.com", []string{"north.example.com"}))
+	err = p.checkQuota("team-a", "new.example.com", []string{"new.example.com"})
+	assert.ErrorContains(t, err, "namespace team-a has reached its quota of 2 Traffic Manager profiles")
+	assert.Equal(t, ErrorCodeQuotaExceeded, errorCode(err))
+
+	// Targets already in the profile don't count again
+	assert.NoError(t, p.checkQuota("team-a", "app.example.com", []string{"east.example.com", "north.example.com"}))
+	err = p.checkQuota("team-a", "app.example.com", []string{"north.example.com", "south.example.com"})
+	assert.ErrorContains(t, err, "would exceed its quota of 4 Traffic Manager endpoints (3 in use, 2 requested)")
+
+	assert.Error(t, p.checkQuota("team-b", "app.example.com", []string{"b2.example.com"}))
+	assert.NoError(t, p.checkQuota("", "new.example.com", []string{"new.example.com"}), "endpoints without a namespace are unlimited")
+
+	var unlimited TrafficManagerProvider
+	assert.NoError(t, unlimited.checkQuota("team-a", "new.example.com", []string{"new.example.com"}))
+}
+
+func TestApplyChanges_RejectsQuotaExceeded(t *testing.T) {
+	quotas, err := newNamespaceQuotas(1, 0, nil, nil)
+	require.NoError(t, err)
+	p := newQuotaTestProvider(t, quotas)
+
+	// No Azure client is configured, so the change must be rejected before any Azure call
+	err = p.ApplyChanges(context.Background(), &Changes{Create: []*Endpoint{{
+		DNSName:    "new.example.com",
+		Targets:    []string{"1.2.3.4"},
+		RecordType: "A",
+		Labels: map[string]string{
+			"resource":                             "service/team-a/new",
+			annotations.AnnotationEnabled:          "true",
+			annotations.AnnotationResourceGroup:    "tm-rg",
+			annotations.AnnotationEndpointLocation: "eastus",
+		},
+	}}})
+	require.Error(t, err)
+	assert.Equal(t, ErrorCodeQuotaExceeded, errorCode(err))
+}
+
+func TestHandleQuotas(t *testing.T) {
+	quotas, err := newNamespaceQuotas(2, 0, nil, nil)
+	require.NoError(t, err)
+	s := NewWebhookServer(newQuotaTestProvider(t, quotas), zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleQuotas(rec, httptest.NewRequest(http.MethodGet, "/quotas", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var usage []QuotaUsage
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &usage))
+	require.Len(t, usage, 2)
+	assert.Equal(t, "team-a", usage[0].Namespace)
+	assert.Equal(t, 3, usage[0].Endpoints)
+
+	rec = httptest.NewRecorder()
+	s.HandleQuotas(rec, httptest.NewRequest(http.MethodPost, "/quotas", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
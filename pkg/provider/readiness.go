@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+const (
+	// tokenRefreshMargin is how long before expiry the readiness check fetches a new token
+	tokenRefreshMargin = 5 * time.Minute
+
+	// armCheckInterval limits how often readiness probes call Azure Resource Manager
+	armCheckInterval = time.Minute
+)
+
+// readinessState caches the results of readiness checks between probes
+type readinessState struct {
+	mu           sync.Mutex
+	token        azcore.AccessToken
+	armCheckedAt time.Time
+	armErr       error
+	ping         func(ctx context.Context) error // Checks ARM reachability; defaults to the default client's Ping
+
+	// Checks Kubernetes API reachability; defaults to the DNSEndpoint manager's Ping
+	kubernetesPing func(ctx context.Context) error
+}
+
+// CheckReadiness verifies the Azure credential can still mint a management token and
+// that Azure Resource Manager is reachable. The token is cached and refreshed ahead of
+// expiry; the ARM check runs at most once per armCheckInterval.
+func (p *TrafficManagerProvider) CheckReadiness(ctx context.Context) error {
+	if err := p.checkCredential(ctx); err != nil {
+		return err
+	}
+	return p.checkARM(ctx)
+}
+
+// checkCredential obtains a management token, unless the cached one is far enough from expiry
+func (p *TrafficManagerProvider) checkCredential(ctx context.Context) error {
+	r := &p.readiness
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token.ExpiresOn.Sub(p.now()) < tokenRefreshMargin {
+		token, err := p.credential.GetToken(ctx, policy.TokenRequestOptions{
+			Scopes: []string{trafficmanager.ManagementScope(p.cloud)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to obtain Azure token: %w", err)
+		}
+		r.token = token
+	}
+	return nil
+}
+
+// checkARM pings Azure Resource Manager, reusing the last result within armCheckInterval
+func (p *TrafficManagerProvider) checkARM(ctx context.Context) error {
+	r := &p.readiness
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := p.now()
+	if r.armCheckedAt.IsZero() || now.Sub(r.armCheckedAt) >= armCheckInterval {
+		ping := r.ping
+		if ping == nil {
+			ping = p.tmClient.Ping
+		}
+		r.armErr = ping(ctx)
+		r.armCheckedAt = now
+	}
+
+	return r.armErr
+}
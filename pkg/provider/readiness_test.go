@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeCredential counts token requests and returns tokens valid for an hour
+type fakeCredential struct {
+	now   func() time.Time
+	calls int
+	err   error
+}
+
+func (f *fakeCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	f.calls++
+	if f.err != nil {
+		return azcore.AccessToken{}, f.err
+	}
+	return azcore.AccessToken{Token: "token", ExpiresOn: f.now().Add(time.Hour)}, nil
+}
+
+func newReadinessProvider(t *testing.T) (*TrafficManagerProvider, *fakeCredential, *time.Time, *int) {
+	now := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	cred := &fakeCredential{now: func() time.Time { return now }}
+	pings := 0
+
+	p := &TrafficManagerProvider{
+		logger:     zaptest.NewLogger(t),
+		credential: cred,
+		clock:      func() time.Time { return now },
+	}
+	p.readiness.ping = func(context.Context) error {
+		pings++
+		return nil
+	}
+	return p, cred, &now, &pings
+}
+
+func TestCheckReadiness_CachesTokenAndPing(t *testing.T) {
+	p, cred, now, pings := newReadinessProvider(t)
+
+	require.NoError(t, p.CheckReadiness(context.Background()))
+	require.NoError(t, p.CheckReadiness(context.Background()))
+	assert.Equal(t, 1, cred.calls)
+	assert.Equal(t, 1, *pings)
+
+	// ARM is checked again after the interval
+	*now = now.Add(armCheckInterval)
+	require.NoError(t, p.CheckReadiness(context.Background()))
+	assert.Equal(t, 1, cred.calls)
+	assert.Equal(t, 2, *pings)
+
+	// The token is refreshed ahead of expiry
+	*now = now.Add(time.Hour - tokenRefreshMargin)
+	require.NoError(t, p.CheckReadiness(context.Background()))
+	assert.Equal(t, 2, cred.calls)
+}
+
+func TestCheckReadiness_Failures(t *testing.T) {
+	p, cred, _, _ := newReadinessProvider(t)
+	cred.err = errors.New("identity not found")
+
+	err := p.CheckReadiness(context.Background())
+	assert.ErrorContains(t, err, "failed to obtain Azure token")
+
+	p, _, _, _ = newReadinessProvider(t)
+	p.readiness.ping = func(context.Context) error { return errors.New("connection refused") }
+	assert.ErrorContains(t, p.CheckReadiness(context.Background()), "connection refused")
+}
+
+func TestHandleReady(t *testing.T) {
+	p, cred, _, _ := newReadinessProvider(t)
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ready"}`, rec.Body.String())
+
+	p, cred, _, _ = newReadinessProvider(t)
+	cred.err = errors.New("identity not found")
+	s = NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec = httptest.NewRecorder()
+	s.HandleReady(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "identity not found")
+}
+
+func TestHandleHealth_Verbose(t *testing.T) {
+	p, cred, now, _ := newReadinessProvider(t)
+	p.stateManager = state.NewManager(5*time.Minute, zaptest.NewLogger(t))
+	p.recordSync(*now, 0, 0, nil)
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	// The fast path checks nothing
+	cred.err = errors.New("identity not found")
+	rec := httptest.NewRecorder()
+	s.HandleHealth(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"healthy"}`, rec.Body.String())
+	assert.Equal(t, 0, cred.calls)
+
+	verbose := func() HealthResponse {
+		rec := httptest.NewRecorder()
+		s.HandleHealth(rec, httptest.NewRequest(http.MethodGet, "/healthz?verbose=true", nil))
+		var response HealthResponse
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+		if response.Status == "unhealthy" {
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+		} else {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		return response
+	}
+	statuses := func(response HealthResponse) map[string]string {
+		byName := make(map[string]string)
+		for _, dependency := range response.Dependencies {
+			byName[dependency.Name] = dependency.Status
+		}
+		return byName
+	}
+
+	response := verbose()
+	assert.Equal(t, "unhealthy", response.Status)
+	assert.Equal(t, map[string]string{
+		"azureCredential":      DependencyFailed,
+		"azureResourceManager": DependencyOK,
+		"kubernetesAPI":        DependencyDisabled,
+		"stateCache":           DependencyOK,
+		"azurePermissions":     DependencyDisabled,
+	}, statuses(response))
+
+	cred.err = nil
+	p.readiness.kubernetesPing = func(context.Context) error { return nil }
+	response = verbose()
+	assert.Equal(t, "healthy", response.Status)
+	assert.Equal(t, DependencyOK, statuses(response)["kubernetesAPI"])
+
+	// Without a successful sync for a while the cache is stale, which degrades but doesn't fail health
+	*now = now.Add(syncStaleAfter + time.Minute)
+	response = verbose()
+	assert.Equal(t, "degraded", response.Status)
+	assert.Equal(t, DependencyStale, statuses(response)["stateCache"])
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// DefaultMaxRequestBytes is the largest webhook API request body accepted unless configured otherwise
+const DefaultMaxRequestBytes = 10 << 20
+
+// RequestLimits bound the webhook API requests External DNS sends, so an oversized or malformed
+// body can't exhaust memory and a stuck request can't hold the provider
+type RequestLimits struct {
+	MaxBodyBytes   int64         // Largest request body accepted; 0 is unlimited
+	StrictDecoding bool          // Reject bodies with fields the webhook doesn't model
+	Timeout        time.Duration // Longest a records, adjustendpoints or plan request may run; 0 is unlimited
+
+	// POST /records requests accepted a minute on average, and at once; 0 is unlimited
+	ApplyPerMinute int
+	ApplyBurst     int
+}
+
+// SetRequestLimits sets the limits applied to webhook API requests
+func (s *WebhookServer) SetRequestLimits(limits RequestLimits) {
+	s.limits = limits
+	s.applyLimiter = nil
+	if limits.ApplyPerMinute > 0 {
+		s.applyLimiter = rate.NewLimiter(rate.Limit(float64(limits.ApplyPerMinute)/60), max(limits.ApplyBurst, 1))
+	}
+}
+
+// allowApply reports whether a POST /records request is within the apply rate limit. Otherwise it
+// writes the error response, with a Retry-After of when the next request will be accepted.
+func (s *WebhookServer) allowApply(w http.ResponseWriter, r *http.Request) bool {
+	if s.applyLimiter == nil {
+		return true
+	}
+	reservation := s.applyLimiter.Reserve()
+	delay := reservation.Delay()
+	if delay == 0 {
+		return true
+	}
+	reservation.Cancel()
+
+	metrics.WebhookRequestsRateLimited.Inc()
+	retryAfter := int(math.Ceil(delay.Seconds()))
+	s.log(r).Warn("Rejected apply changes request over the rate limit", zap.Int("retryAfterSeconds", retryAfter))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	s.writeError(w, ErrorCodeRateLimited, fmt.Sprintf("Too many apply changes requests, retry in %ds", retryAfter))
+	return false
+}
+
+// withRequestTimeout returns r with the request timeout applied to its context, and the
+// function releasing it
+func (s *WebhookServer) withRequestTimeout(r *http.Request) (*http.Request, context.CancelFunc) {
+	if s.limits.Timeout <= 0 {
+		return r, func() {}
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), s.limits.Timeout)
+	return r.WithContext(ctx), cancel
+}
+
+// decodeBody decodes the JSON body of r into v within the request limits. It writes the error
+// response and returns false when the body is rejected.
+func (s *WebhookServer) decodeBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	body := r.Body
+	if s.limits.MaxBodyBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, s.limits.MaxBodyBytes)
+	}
+
+	decoder := json.NewDecoder(body)
+	if s.limits.StrictDecoding {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(v)
+	if err == nil {
+		// A second value after the body is as malformed as a broken one
+		if _, trailing := decoder.Token(); trailing != io.EOF {
+			err = errors.New("unexpected data after the JSON body")
+		}
+	}
+	if err == nil && s.limits.StrictDecoding {
+		err = strictEndpointFields(v)
+	}
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.log(r).Warn("Rejected oversized request body", zap.Int64("limit", tooLarge.Limit))
+		s.writeError(w, ErrorCodeRequestTooLarge, fmt.Sprintf("Request body larger than %d bytes", tooLarge.Limit))
+		return false
+	}
+	s.log(r).Error("Failed to decode request body", zap.Error(err))
+	s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+	return false
+}
+
+// strictEndpointFields rejects endpoints in v carrying fields Endpoint doesn't model, which its
+// own decoding keeps rather than failing on
+func strictEndpointFields(v any) error {
+	var names []string
+	switch body := v.(type) {
+	case *Changes:
+		names = unknownFields(body.Create, body.UpdateOld, body.UpdateNew, body.Delete)
+	case *[]*Endpoint:
+		names = unknownFields(*body)
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("unknown endpoint fields: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
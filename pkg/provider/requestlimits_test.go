@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func postAdjustEndpoints(s *WebhookServer, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/adjustendpoints", strings.NewReader(body))
+	s.HandleAdjustEndpoints(rec, req)
+	return rec
+}
+
+func TestDecodeBody(t *testing.T) {
+	endpoints := `[{"dnsName":"app.example.com","targets":["1.2.3.4"],"recordType":"A"}]`
+	withUnknownField := `[{"dnsName":"app.example.com","targets":["1.2.3.4"],"recordType":"A","futureField":true}]`
+
+	tests := []struct {
+		name     string
+		limits   RequestLimits
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{name: "within limits", limits: RequestLimits{MaxBodyBytes: 1024}, body: endpoints, wantCode: http.StatusOK},
+		{name: "oversized body", limits: RequestLimits{MaxBodyBytes: 16}, body: endpoints, wantCode: http.StatusRequestEntityTooLarge, wantErr: ErrorCodeRequestTooLarge},
+		{name: "unlimited", body: endpoints, wantCode: http.StatusOK},
+		{name: "malformed body", body: `[{"dnsName":`, wantCode: http.StatusBadRequest, wantErr: ErrorCodeInvalidRequest},
+		{name: "trailing data", body: endpoints + `{}`, wantCode: http.StatusBadRequest, wantErr: ErrorCodeInvalidRequest},
+		{name: "unknown field kept", body: withUnknownField, wantCode: http.StatusOK},
+		{name: "unknown field rejected when strict", limits: RequestLimits{StrictDecoding: true}, body: withUnknownField, wantCode: http.StatusBadRequest, wantErr: ErrorCodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+			s.SetRequestLimits(tt.limits)
+
+			rec := postAdjustEndpoints(s, tt.body)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantErr != "" {
+				var resp ErrorResponse
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+				assert.Equal(t, tt.wantErr, resp.Code)
+			}
+		})
+	}
+}
+
+func TestStrictEndpointFields_Changes(t *testing.T) {
+	changes := &Changes{UpdateNew: []*Endpoint{{DNSName: "app.example.com", Extra: map[string]json.RawMessage{"futureField": json.RawMessage(`1`)}}}}
+	err := strictEndpointFields(changes)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "futureField")
+
+	assert.NoError(t, strictEndpointFields(&Changes{Create: []*Endpoint{{DNSName: "app.example.com"}}}))
+}
+
+func TestWithRequestTimeout(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+
+	unbounded, cancel := s.withRequestTimeout(req)
+	cancel()
+	_, ok := unbounded.Context().Deadline()
+	assert.False(t, ok, "no deadline without a timeout")
+
+	s.SetRequestLimits(RequestLimits{Timeout: time.Minute})
+	bounded, cancel := s.withRequestTimeout(req)
+	defer cancel()
+	deadline, ok := bounded.Context().Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, 5*time.Second)
+}
+
+func TestAllowApply(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+	req := httptest.NewRequest(http.MethodPost, "/records", nil)
+	assert.True(t, s.allowApply(httptest.NewRecorder(), req), "unlimited by default")
+
+	s.SetRequestLimits(RequestLimits{ApplyPerMinute: 1, ApplyBurst: 2})
+	for i := 0; i < 2; i++ {
+		assert.True(t, s.allowApply(httptest.NewRecorder(), req), "request %d is within the burst", i+1)
+	}
+
+	rec := httptest.NewRecorder()
+	assert.False(t, s.allowApply(rec, req))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	var resp ErrorResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.Equal(t, ErrorCodeRateLimited, resp.Code)
+
+	// A rejected request doesn't use up a token
+	rec = httptest.NewRecorder()
+	assert.False(t, s.allowApply(rec, req))
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+}
@@ -0,0 +1,186 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// rolloutWeightScale converts the percentage Argo Rollouts sends into Traffic Manager weights (1-1000)
+const rolloutWeightScale = 10
+
+// RolloutRoute identifies the stable and canary endpoints an Argo Rollout shifts traffic between.
+// It mirrors the plugin configuration of a Rollout's trafficRouting section.
+type RolloutRoute struct {
+	SubscriptionID string `json:"subscriptionId,omitempty"` // Empty means the webhook's default subscription
+	ResourceGroup  string `json:"resourceGroup"`
+	ProfileName    string `json:"profileName"`
+	StableEndpoint string `json:"stableEndpoint"`
+	CanaryEndpoint string `json:"canaryEndpoint"`
+	EndpointType   string `json:"endpointType,omitempty"` // Defaults to ExternalEndpoints
+}
+
+// RolloutWeightRequest is the body accepted by POST /rollouts/setweight and /rollouts/verifyweight
+type RolloutWeightRequest struct {
+	RolloutRoute
+	Weight int32 `json:"weight"` // Percentage of traffic for the canary endpoint, 0-100
+}
+
+// RolloutWeightResponse reports the endpoint weights after SetWeight, or whether VerifyWeight found them in place
+type RolloutWeightResponse struct {
+	Verified     *bool `json:"verified,omitempty"`
+	StableWeight int64 `json:"stableWeight"` // 0 when the endpoint is disabled
+	CanaryWeight int64 `json:"canaryWeight"`
+}
+
+// rolloutShare is the desired weight of one endpoint; a weight of 0 disables it
+type rolloutShare struct {
+	endpointName string
+	weight       int64
+}
+
+// validate checks the route and weight and fills in defaults
+func (r *RolloutWeightRequest) validate() error {
+	if r.ResourceGroup == "" || r.ProfileName == "" || r.StableEndpoint == "" || r.CanaryEndpoint == "" {
+		return fmt.Errorf("resourceGroup, profileName, stableEndpoint and canaryEndpoint are required")
+	}
+	if r.StableEndpoint == r.CanaryEndpoint {
+		return fmt.Errorf("stableEndpoint and canaryEndpoint must differ, both are %q", r.StableEndpoint)
+	}
+	if r.Weight < 0 || r.Weight > 100 {
+		return fmt.Errorf("weight must be between 0 and 100, got %d", r.Weight)
+	}
+	if r.EndpointType == "" {
+		r.EndpointType = annotations.DefaultEndpointType
+	}
+	return nil
+}
+
+// shares returns the desired endpoint weights, the endpoint gaining traffic first so that
+// applying them in order never leaves the profile without an enabled endpoint
+func (r *RolloutWeightRequest) shares() []rolloutShare {
+	canary := rolloutShare{endpointName: r.CanaryEndpoint, weight: int64(r.Weight) * rolloutWeightScale}
+	stable := rolloutShare{endpointName: r.StableEndpoint, weight: int64(100-r.Weight) * rolloutWeightScale}
+	if canary.weight > stable.weight {
+		return []rolloutShare{canary, stable}
+	}
+	return []rolloutShare{stable, canary}
+}
+
+// rolloutClient validates a rollout request against the resource policy and returns its client
+func (p *TrafficManagerProvider) rolloutClient(req *RolloutWeightRequest) (*trafficmanager.Client, error) {
+	if err := req.validate(); err != nil {
+		return nil, withCode(ErrorCodeInvalidRequest, err)
+	}
+	if err := p.resourcePolicy.check("", req.SubscriptionID, req.ResourceGroup); err != nil {
+		return nil, err
+	}
+	return p.clientFor(req.SubscriptionID, req.ResourceGroup)
+}
+
+// SetRolloutWeight implements the Argo Rollouts traffic router SetWeight call: it gives the canary
+// endpoint weight percent of the traffic and the stable endpoint the rest. Endpoints with no share
+// are disabled, since Traffic Manager weights can't be 0.
+func (p *TrafficManagerProvider) SetRolloutWeight(ctx context.Context, req RolloutWeightRequest) (*RolloutWeightResponse, error) {
+	tmClient, err := p.rolloutClient(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, share := range req.shares() {
+		// Rollouts drives the weight from here on, so any annotation canary would fight it
+		p.stopCanary(req.ProfileName, share.endpointName)
+
+		current, err := tmClient.GetEndpoint(ctx, req.ResourceGroup, req.ProfileName, req.EndpointType, share.endpointName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get endpoint %s: %w", share.endpointName, err)
+		}
+
+		if share.weight == 0 {
+			if current.Status != "Disabled" {
+				if err := tmClient.UpdateEndpointStatus(ctx, req.ResourceGroup, req.ProfileName, req.EndpointType, share.endpointName, "Disabled"); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		if current.Weight != share.weight {
+			if err := tmClient.UpdateEndpointWeight(ctx, req.ResourceGroup, req.ProfileName, req.EndpointType, share.endpointName, share.weight); err != nil {
+				return nil, err
+			}
+		}
+		if current.Status == "Disabled" {
+			if err := tmClient.UpdateEndpointStatus(ctx, req.ResourceGroup, req.ProfileName, req.EndpointType, share.endpointName, "Enabled"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	p.log(ctx).Info("Set rollout weight",
+		zap.String("profileName", req.ProfileName),
+		zap.String("stableEndpoint", req.StableEndpoint),
+		zap.String("canaryEndpoint", req.CanaryEndpoint),
+		zap.Int32("weight", req.Weight))
+
+	p.refreshProfile(ctx, tmClient, req.ResourceGroup, req.ProfileName)
+
+	return &RolloutWeightResponse{
+		StableWeight: int64(100-req.Weight) * rolloutWeightScale,
+		CanaryWeight: int64(req.Weight) * rolloutWeightScale,
+	}, nil
+}
+
+// VerifyRolloutWeight implements the Argo Rollouts traffic router VerifyWeight call:
+// it reports whether the endpoints in Azure have the weights SetRolloutWeight would give them.
+func (p *TrafficManagerProvider) VerifyRolloutWeight(ctx context.Context, req RolloutWeightRequest) (*RolloutWeightResponse, error) {
+	tmClient, err := p.rolloutClient(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	verified := true
+	actual := make(map[string]int64, 2)
+	for _, share := range req.shares() {
+		current, err := tmClient.GetEndpoint(ctx, req.ResourceGroup, req.ProfileName, req.EndpointType, share.endpointName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get endpoint %s: %w", share.endpointName, err)
+		}
+
+		weight := current.Weight
+		if current.Status == "Disabled" {
+			weight = 0
+		}
+		actual[share.endpointName] = weight
+		if weight != share.weight {
+			verified = false
+		}
+	}
+
+	return &RolloutWeightResponse{
+		Verified:     &verified,
+		StableWeight: actual[req.StableEndpoint],
+		CanaryWeight: actual[req.CanaryEndpoint],
+	}, nil
+}
+
+// refreshProfile re-reads a cached profile from Azure after it was changed outside an apply
+func (p *TrafficManagerProvider) refreshProfile(ctx context.Context, tmClient *trafficmanager.Client, resourceGroup, profileName string) {
+	cached, ok := p.stateManager.GetProfileByName(profileName)
+	if !ok {
+		return
+	}
+
+	profile, err := tmClient.GetProfileState(ctx, resourceGroup, profileName)
+	if err != nil {
+		p.log(ctx).Warn("Failed to refresh profile state",
+			zap.String("profileName", profileName),
+			zap.Error(err))
+		return
+	}
+	profile.Hostname = cached.Hostname
+	p.stateManager.SetProfile(profile.Hostname, profile)
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func rolloutRequest(weight int32) RolloutWeightRequest {
+	return RolloutWeightRequest{
+		RolloutRoute: RolloutRoute{
+			ResourceGroup:  "tm-rg",
+			ProfileName:    "app-example-com-tm",
+			StableEndpoint: "stable",
+			CanaryEndpoint: "canary",
+		},
+		Weight: weight,
+	}
+}
+
+func TestRolloutWeightRequest_Shares(t *testing.T) {
+	req := rolloutRequest(20)
+	assert.Equal(t, []rolloutShare{{"stable", 800}, {"canary", 200}}, req.shares())
+
+	// The endpoint gaining traffic is changed first
+	req = rolloutRequest(100)
+	assert.Equal(t, []rolloutShare{{"canary", 1000}, {"stable", 0}}, req.shares())
+
+	req = rolloutRequest(0)
+	assert.Equal(t, []rolloutShare{{"stable", 1000}, {"canary", 0}}, req.shares())
+}
+
+func TestRolloutWeightRequest_Validate(t *testing.T) {
+	req := rolloutRequest(50)
+	require.NoError(t, req.validate())
+	assert.Equal(t, "ExternalEndpoints", req.EndpointType)
+
+	req = rolloutRequest(101)
+	assert.ErrorContains(t, req.validate(), "weight must be between 0 and 100")
+
+	req = rolloutRequest(50)
+	req.CanaryEndpoint = "stable"
+	assert.ErrorContains(t, req.validate(), "must differ")
+
+	req = rolloutRequest(50)
+	req.ProfileName = ""
+	assert.ErrorContains(t, req.validate(), "are required")
+}
+
+func TestSetRolloutWeight_PolicyViolation(t *testing.T) {
+	policy, err := newResourcePolicy(defaultSub, nil, []string{"other-rg"}, nil)
+	require.NoError(t, err)
+	p := &TrafficManagerProvider{
+		logger:         zaptest.NewLogger(t),
+		subscriptionID: defaultSub,
+		resourcePolicy: policy,
+	}
+
+	// No Azure client is configured, so the request must be rejected before any Azure call
+	_, err = p.SetRolloutWeight(context.Background(), rolloutRequest(50))
+	require.Error(t, err)
+	assert.Equal(t, ErrorCodePolicyViolation, errorCode(err))
+}
+
+func TestHandleRolloutSetWeight_Invalid(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleRolloutSetWeight(rec, httptest.NewRequest(http.MethodPost, "/rollouts/setweight",
+		strings.NewReader(`{"resourceGroup":"tm-rg","profileName":"app","stableEndpoint":"stable","canaryEndpoint":"canary","weight":150}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "weight must be between 0 and 100")
+
+	rec = httptest.NewRecorder()
+	s.HandleRolloutVerifyWeight(rec, httptest.NewRequest(http.MethodGet, "/rollouts/verifyweight", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,171 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"go.uber.org/zap"
+)
+
+// ScheduledEndpoint is an endpoint whose status is changed by its schedule annotations
+type ScheduledEndpoint struct {
+	Hostname        string    `json:"hostname"`
+	ProfileName     string    `json:"profileName"`
+	EndpointName    string    `json:"endpointName"`
+	DisableSchedule string    `json:"disableSchedule"`
+	EnableSchedule  string    `json:"enableSchedule"`
+	Status          string    `json:"status"`          // Status in the cache
+	ScheduledStatus string    `json:"scheduledStatus"` // Status the schedules give now
+	NextChangeAt    time.Time `json:"nextChangeAt,omitempty"`
+}
+
+// scheduledStatus returns the status to create or update an endpoint with. Inside a scheduled
+// disable window an endpoint the annotations enable is disabled instead.
+func (p *TrafficManagerProvider) scheduledStatus(config *annotations.TrafficManagerConfig, status string) string {
+	if status == "Disabled" || config.DisableSchedule == nil || config.EnableSchedule == nil {
+		return status
+	}
+	return annotations.ScheduledStatus(config.DisableSchedule, config.EnableSchedule, p.now())
+}
+
+// endpointSchedules parses the schedules recorded in an endpoint's metadata
+func endpointSchedules(endpoint *state.EndpointState) (disable, enable *annotations.Schedule, ok bool) {
+	if endpoint.Metadata == nil || endpoint.Metadata.DisableSchedule == "" || endpoint.Metadata.EnableSchedule == "" {
+		return nil, nil, false
+	}
+	disable, err := annotations.ParseSchedule(endpoint.Metadata.DisableSchedule)
+	if err != nil {
+		return nil, nil, false
+	}
+	enable, err = annotations.ParseSchedule(endpoint.Metadata.EnableSchedule)
+	if err != nil {
+		return nil, nil, false
+	}
+	return disable, enable, true
+}
+
+// ScheduledEndpoints returns the cached endpoints with schedules, ordered by profile and endpoint
+func (p *TrafficManagerProvider) ScheduledEndpoints() []ScheduledEndpoint {
+	now := p.now()
+
+	scheduled := []ScheduledEndpoint{}
+	for _, profile := range p.stateManager.ListProfileSnapshots() {
+		for name, endpoint := range profile.Endpoints {
+			disable, enable, ok := endpointSchedules(endpoint)
+			if !ok {
+				continue
+			}
+
+			desired := annotations.ScheduledStatus(disable, enable, now)
+			next := disable.Next(now)
+			if desired == "Disabled" {
+				next = enable.Next(now)
+			}
+
+			scheduled = append(scheduled, ScheduledEndpoint{
+				Hostname:        profile.Hostname,
+				ProfileName:     profile.ProfileName,
+				EndpointName:    name,
+				DisableSchedule: disable.String(),
+				EnableSchedule:  enable.String(),
+				Status:          endpoint.Status,
+				ScheduledStatus: desired,
+				NextChangeAt:    next,
+			})
+		}
+	}
+
+	sort.Slice(scheduled, func(i, j int) bool {
+		if scheduled[i].ProfileName != scheduled[j].ProfileName {
+			return scheduled[i].ProfileName < scheduled[j].ProfileName
+		}
+		return scheduled[i].EndpointName < scheduled[j].EndpointName
+	})
+	return scheduled
+}
+
+// ApplySchedules enables or disables every cached endpoint whose status differs from what its
+// schedules give now. Endpoints recorded as created by another cluster are left to that cluster.
+// It returns the number of endpoints changed.
+func (p *TrafficManagerProvider) ApplySchedules(ctx context.Context) (int, error) {
+	changed := 0
+	for _, entry := range p.ScheduledEndpoints() {
+		if entry.Status == entry.ScheduledStatus {
+			continue
+		}
+		if p.endpointDraining(entry.ProfileName, entry.EndpointName) {
+			continue
+		}
+		if owner, other := p.ownedByOtherCluster(entry.Hostname, entry.EndpointName); other {
+			p.log(ctx).Debug("Skipping schedule for endpoint owned by another cluster",
+				zap.String("profileName", entry.ProfileName),
+				zap.String("endpointName", entry.EndpointName),
+				zap.String("owner", owner))
+			continue
+		}
+
+		profile, ok := p.stateManager.GetProfile(entry.Hostname)
+		if !ok {
+			continue
+		}
+		endpoint, ok := profile.Endpoints[entry.EndpointName]
+		if !ok {
+			continue
+		}
+		// The Service readiness watcher restores the scheduled status once the Service is ready
+		if endpoint.Metadata != nil && endpoint.Metadata.NotReady {
+			continue
+		}
+
+		tmClient, err := p.clientFor(subscriptionFromResourceID(profile.ResourceID), profile.ResourceGroup)
+		if err != nil {
+			return changed, err
+		}
+
+		logger := p.log(ctx).With(
+			zap.String("hostname", entry.Hostname),
+			zap.String("profileName", entry.ProfileName),
+			zap.String("endpointName", entry.EndpointName),
+			zap.String("status", entry.ScheduledStatus))
+
+		if err := tmClient.UpdateEndpointStatus(ctx, profile.ResourceGroup, profile.ProfileName, endpoint.EndpointType, entry.EndpointName, entry.ScheduledStatus); err != nil {
+			logger.Error("Failed to apply endpoint schedule", zap.Error(err))
+			continue
+		}
+		logger.Info("Applied endpoint schedule")
+
+		if entry.ScheduledStatus == "Disabled" {
+			p.silence(ctx, entry.Hostname, entry.ProfileName, entry.EndpointName, SilenceReasonScheduled)
+		} else {
+			p.unsilence(entry.ProfileName, entry.EndpointName)
+		}
+
+		endpoint.Status = entry.ScheduledStatus
+		p.stateManager.SetEndpoint(entry.Hostname, entry.EndpointName, endpoint)
+		metrics.ScheduledStatusChanges.WithLabelValues(entry.ProfileName, entry.ScheduledStatus).Inc()
+		changed++
+	}
+
+	return changed, nil
+}
+
+// RunScheduler runs ApplySchedules every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.ApplySchedules(ctx); err != nil {
+				p.log(ctx).Error("Endpoint scheduler failed", zap.Error(err))
+			}
+		}
+	}
+}
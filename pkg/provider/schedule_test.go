@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func newScheduleProvider(t *testing.T, now time.Time) *TrafficManagerProvider {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		clusterName:  "aks-east",
+		stateManager: state.NewManager(5*time.Minute, logger),
+		clock:        func() time.Time { return now },
+	}
+
+	nightly := func(cluster string) *state.EndpointMetadata {
+		return &state.EndpointMetadata{Cluster: cluster, DisableSchedule: "0 1 * * *", EnableSchedule: "0 3 * * *"}
+	}
+	p.stateManager.SetProfile("app.example.com", &state.ProfileState{
+		ProfileName: "app-example-com-tm",
+		Hostname:    "app.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			"east":  {EndpointName: "east", Status: "Enabled", Metadata: nightly("aks-east")},
+			"west":  {EndpointName: "west", Status: "Enabled", Metadata: nightly("aks-west")},
+			"south": {EndpointName: "south", Status: "Enabled", Metadata: &state.EndpointMetadata{Cluster: "aks-east"}},
+		},
+	})
+	return p
+}
+
+func TestScheduledStatus(t *testing.T) {
+	p := newScheduleProvider(t, time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC))
+
+	disable, err := annotations.ParseSchedule("0 1 * * *")
+	require.NoError(t, err)
+	enable, err := annotations.ParseSchedule("0 3 * * *")
+	require.NoError(t, err)
+	config := &annotations.TrafficManagerConfig{DisableSchedule: disable, EnableSchedule: enable}
+
+	assert.Equal(t, "Disabled", p.scheduledStatus(config, "Enabled"), "inside the window")
+	assert.Equal(t, "Enabled", p.scheduledStatus(&annotations.TrafficManagerConfig{}, "Enabled"), "no schedule")
+
+	p.clock = func() time.Time { return time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC) }
+	assert.Equal(t, "Enabled", p.scheduledStatus(config, "Enabled"), "outside the window")
+	assert.Equal(t, "Disabled", p.scheduledStatus(config, "Disabled"), "schedules never enable a disabled endpoint")
+}
+
+func TestScheduledEndpoints(t *testing.T) {
+	p := newScheduleProvider(t, time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC))
+
+	scheduled := p.ScheduledEndpoints()
+	require.Len(t, scheduled, 2)
+	assert.Equal(t, "east", scheduled[0].EndpointName)
+	assert.Equal(t, "Enabled", scheduled[0].Status)
+	assert.Equal(t, "Disabled", scheduled[0].ScheduledStatus)
+	assert.Equal(t, time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC), scheduled[0].NextChangeAt)
+	assert.Equal(t, "west", scheduled[1].EndpointName)
+}
+
+func TestApplySchedules_SkipsUpToDateAndOtherClusters(t *testing.T) {
+	// Outside the window every endpoint already has its scheduled status
+	p := newScheduleProvider(t, time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC))
+	changed, err := p.ApplySchedules(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	// Inside the window east is already disabled, and west belongs to aks-west so is left alone
+	p = newScheduleProvider(t, time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC))
+	p.stateManager.SetEndpoint("app.example.com", "east", &state.EndpointState{EndpointName: "east", Status: "Disabled",
+		Metadata: &state.EndpointMetadata{Cluster: "aks-east", DisableSchedule: "0 1 * * *", EnableSchedule: "0 3 * * *"}})
+	changed, err = p.ApplySchedules(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+}
+
+func TestHandleSchedules(t *testing.T) {
+	p := newScheduleProvider(t, time.Date(2026, 10, 15, 2, 0, 0, 0, time.UTC))
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleSchedules(rec, httptest.NewRequest(http.MethodGet, "/schedules", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var scheduled []ScheduledEndpoint
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &scheduled))
+	assert.Len(t, scheduled, 2)
+
+	rec = httptest.NewRecorder()
+	s.HandleSchedules(rec, httptest.NewRequest(http.MethodPost, "/schedules", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	serviceGVR       = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	endpointSliceGVR = schema.GroupVersionResource{Group: "discovery.k8s.io", Version: "v1", Resource: "endpointslices"}
+)
+
+// serviceNameLabel links an EndpointSlice to its Service
+const serviceNameLabel = "kubernetes.io/service-name"
+
+// serviceReadiness counts the ready endpoints Kubernetes tracks for a Service in its EndpointSlices
+type serviceReadiness struct {
+	client dynamic.Interface
+}
+
+func newServiceReadiness(client dynamic.Interface) *serviceReadiness {
+	return &serviceReadiness{client: client}
+}
+
+// readyEndpoints returns the number of ready endpoints of a Service. ok is false when the Service
+// doesn't exist or has no selector, because Kubernetes doesn't track its readiness then.
+func (s *serviceReadiness) readyEndpoints(ctx context.Context, namespace, name string) (ready int, ok bool, err error) {
+	service, err := s.client.Resource(serviceGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get Service %s/%s: %w", namespace, name, err)
+	}
+	selector, _, _ := unstructured.NestedStringMap(service.Object, "spec", "selector")
+	if len(selector) == 0 {
+		return 0, false, nil
+	}
+
+	slices, err := s.client.Resource(endpointSliceGVR).Namespace(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: serviceNameLabel + "=" + name,
+	})
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to list EndpointSlices of Service %s/%s: %w", namespace, name, err)
+	}
+
+	for _, slice := range slices.Items {
+		endpoints, _, _ := unstructured.NestedSlice(slice.Object, "endpoints")
+		for _, e := range endpoints {
+			endpoint, isMap := e.(map[string]interface{})
+			if !isMap {
+				continue
+			}
+			// A missing ready condition means ready
+			if isReady, found, _ := unstructured.NestedBool(endpoint, "conditions", "ready"); !found || isReady {
+				ready++
+			}
+		}
+	}
+	return ready, true, nil
+}
+
+// CheckServiceReadiness disables every cached endpoint whose backing Service has no ready endpoints,
+// and re-enables the ones it disabled once their Service is ready again. Endpoints recorded as created
+// by another cluster are left to that cluster. It returns the number of endpoints changed.
+func (p *TrafficManagerProvider) CheckServiceReadiness(ctx context.Context) (int, error) {
+	if p.serviceReadiness == nil {
+		return 0, nil
+	}
+
+	changed := 0
+	for _, profile := range p.stateManager.ListProfiles() {
+		for name, endpoint := range profile.Endpoints {
+			metadata := endpoint.Metadata
+			if metadata == nil || metadata.Service == "" || metadata.Namespace == "" {
+				continue
+			}
+			if p.endpointDraining(profile.ProfileName, name) {
+				continue
+			}
+			if _, other := p.ownedByOtherCluster(profile.Hostname, name); other {
+				continue
+			}
+
+			ready, ok, err := p.serviceReadiness.readyEndpoints(ctx, metadata.Namespace, metadata.Service)
+			if err != nil {
+				p.log(ctx).Warn("Failed to check Service readiness",
+					zap.String("profileName", profile.ProfileName),
+					zap.String("endpointName", name),
+					zap.Error(err))
+				continue
+			}
+			if !ok {
+				continue
+			}
+			metrics.ServiceReadyEndpoints.WithLabelValues(profile.ProfileName, name).Set(float64(ready))
+
+			if !serviceReadinessChanges(endpoint, ready) {
+				continue
+			}
+
+			tmClient, err := p.clientFor(subscriptionFromResourceID(profile.ResourceID), profile.ResourceGroup)
+			if err != nil {
+				return changed, err
+			}
+			if err := p.applyServiceReadiness(ctx, tmClient, profile, name, endpoint, ready > 0); err != nil {
+				p.log(ctx).Error("Failed to apply Service readiness",
+					zap.String("profileName", profile.ProfileName),
+					zap.String("endpointName", name),
+					zap.Error(err))
+				continue
+			}
+			changed++
+		}
+	}
+
+	return changed, nil
+}
+
+// serviceReadinessChanges reports whether an endpoint's status should change for the number of ready
+// endpoints of its Service. Only enabled endpoints are disabled, so one disabled by its annotations
+// stays as it is, and only endpoints disabled for readiness are re-enabled.
+func serviceReadinessChanges(endpoint *state.EndpointState, ready int) bool {
+	if ready == 0 {
+		return endpoint.Status == "Enabled"
+	}
+	return endpoint.Metadata.NotReady
+}
+
+// applyServiceReadiness disables an endpoint whose Service has no ready endpoints, or re-enables one
+// disabled for that reason with the status its schedules give. The endpoint is marked NotReady in its
+// metadata before it is disabled, so it is still re-enabled after a restart.
+func (p *TrafficManagerProvider) applyServiceReadiness(ctx context.Context, tmClient *trafficmanager.Client, profile *state.ProfileState, name string, endpoint *state.EndpointState, ready bool) error {
+	metadata := *endpoint.Metadata
+	metadata.NotReady = !ready
+
+	status := "Disabled"
+	if ready {
+		status = "Enabled"
+		if disable, enable, ok := endpointSchedules(endpoint); ok {
+			status = annotations.ScheduledStatus(disable, enable, p.now())
+		}
+	}
+
+	logger := p.log(ctx).With(
+		zap.String("hostname", profile.Hostname),
+		zap.String("profileName", profile.ProfileName),
+		zap.String("endpointName", name),
+		zap.String("service", metadata.Namespace+"/"+metadata.Service),
+		zap.String("status", status))
+
+	if !ready {
+		if err := tmClient.SetEndpointMetadata(ctx, profile.ResourceGroup, profile.ProfileName, name, &metadata); err != nil {
+			return err
+		}
+	}
+	if endpoint.Status != status {
+		if err := tmClient.UpdateEndpointStatus(ctx, profile.ResourceGroup, profile.ProfileName, endpoint.EndpointType, name, status); err != nil {
+			return err
+		}
+	}
+	if ready {
+		if err := tmClient.SetEndpointMetadata(ctx, profile.ResourceGroup, profile.ProfileName, name, &metadata); err != nil {
+			return err
+		}
+		logger.Info("Service has ready endpoints again, restored Traffic Manager endpoint")
+	} else {
+		logger.Warn("Service has no ready endpoints, disabled Traffic Manager endpoint")
+	}
+
+	endpoint.Status = status
+	endpoint.Metadata = &metadata
+	p.stateManager.SetEndpoint(profile.Hostname, name, endpoint)
+	return nil
+}
+
+// RunServiceReadinessWatcher runs CheckServiceReadiness every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunServiceReadinessWatcher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.CheckServiceReadiness(ctx); err != nil {
+				p.log(ctx).Error("Service readiness check failed", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestService(namespace, name string, selector map[string]interface{}) *unstructured.Unstructured {
+	spec := map[string]interface{}{}
+	if selector != nil {
+		spec["selector"] = selector
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       spec,
+	}}
+}
+
+func newTestEndpointSlice(namespace, name, service string, ready ...interface{}) *unstructured.Unstructured {
+	endpoints := make([]interface{}, 0, len(ready))
+	for _, r := range ready {
+		conditions := map[string]interface{}{}
+		if r != nil {
+			conditions["ready"] = r
+		}
+		endpoints = append(endpoints, map[string]interface{}{"addresses": []interface{}{"10.0.0.1"}, "conditions": conditions})
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "discovery.k8s.io/v1",
+		"kind":       "EndpointSlice",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{serviceNameLabel: service},
+		},
+		"endpoints": endpoints,
+	}}
+}
+
+func newServiceReadinessClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{endpointSliceGVR: "EndpointSliceList"}, objects...)
+}
+
+func TestResourceService(t *testing.T) {
+	assert.Equal(t, "myapp", resourceService(map[string]string{"resource": "service/default/myapp"}))
+	assert.Equal(t, "", resourceService(map[string]string{"resource": "ingress/default/myapp"}))
+	assert.Equal(t, "", resourceService(nil))
+}
+
+func TestServiceReadiness_ReadyEndpoints(t *testing.T) {
+	readiness := newServiceReadiness(newServiceReadinessClient(
+		newTestService("team-a", "web", map[string]interface{}{"app": "web"}),
+		newTestEndpointSlice("team-a", "web-abc", "web", true, false, nil),
+		newTestEndpointSlice("team-a", "web-def", "web", false),
+		newTestService("team-a", "api", map[string]interface{}{"app": "api"}),
+		newTestEndpointSlice("team-a", "api-abc", "api", false),
+		newTestService("team-a", "external", nil),
+	))
+	ctx := context.Background()
+
+	ready, ok, err := readiness.readyEndpoints(ctx, "team-a", "web")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 2, ready, "a missing ready condition counts as ready")
+
+	ready, ok, err = readiness.readyEndpoints(ctx, "team-a", "api")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, ready)
+
+	_, ok, err = readiness.readyEndpoints(ctx, "team-a", "external")
+	require.NoError(t, err)
+	assert.False(t, ok, "a Service without a selector isn't judged")
+
+	_, ok, err = readiness.readyEndpoints(ctx, "team-a", "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestServiceReadinessChanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		notReady bool
+		ready    int
+		want     bool
+	}{
+		{"enabled with no ready endpoints", "Enabled", false, 0, true},
+		{"disabled by annotations", "Disabled", false, 0, false},
+		{"already disabled for readiness", "Disabled", true, 0, false},
+		{"ready again", "Disabled", true, 2, true},
+		{"ready and enabled", "Enabled", false, 2, false},
+		{"ready but disabled by annotations", "Disabled", false, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint := &state.EndpointState{Status: tt.status, Metadata: &state.EndpointMetadata{NotReady: tt.notReady}}
+			assert.Equal(t, tt.want, serviceReadinessChanges(endpoint, tt.ready))
+		})
+	}
+}
+
+func TestCheckServiceReadiness_SkipsHealthyAndOtherClusters(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		clusterName:  "aks-east",
+		stateManager: state.NewManager(5*time.Minute, logger),
+		serviceReadiness: newServiceReadiness(newServiceReadinessClient(
+			newTestService("team-a", "web", map[string]interface{}{"app": "web"}),
+			newTestEndpointSlice("team-a", "web-abc", "web", true),
+		)),
+	}
+	p.stateManager.SetProfile("app.example.com", &state.ProfileState{
+		ProfileName: "app-example-com-tm",
+		Hostname:    "app.example.com",
+		Endpoints: map[string]*state.EndpointState{
+			// Healthy, so nothing changes
+			"east": {EndpointName: "east", Status: "Enabled",
+				Metadata: &state.EndpointMetadata{Cluster: "aks-east", Namespace: "team-a", Service: "web"}},
+			// The Service lives in aks-west, which checks it there
+			"west": {EndpointName: "west", Status: "Enabled",
+				Metadata: &state.EndpointMetadata{Cluster: "aks-west", Namespace: "team-a", Service: "missing"}},
+			// Created from an Ingress, so there is no Service to check
+			"south": {EndpointName: "south", Status: "Enabled",
+				Metadata: &state.EndpointMetadata{Cluster: "aks-east", Namespace: "team-a"}},
+		},
+	})
+
+	changed, err := p.CheckServiceReadiness(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	// Disabled when the provider isn't configured for it
+	p.serviceReadiness = nil
+	changed, err = p.CheckServiceReadiness(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed)
+}
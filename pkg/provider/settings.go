@@ -0,0 +1,95 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"go.uber.org/zap"
+)
+
+// Settings are the provider settings that can be changed without restarting the webhook
+type Settings struct {
+	DomainFilter        []string
+	DomainFilterExclude []string             // Subdomains of DomainFilter the webhook leaves alone
+	Defaults            annotations.Defaults // Used when an endpoint's annotations leave a setting out
+}
+
+// Settings returns the current runtime settings
+func (p *TrafficManagerProvider) Settings() Settings {
+	p.settingsMu.RLock()
+	defer p.settingsMu.RUnlock()
+	return Settings{DomainFilter: p.domainFilter, DomainFilterExclude: p.domainFilterExclude, Defaults: p.defaults}
+}
+
+// UpdateSettings replaces the runtime settings. The new domain filter is advertised on the
+// next negotiation and applies to the next records and apply calls. Invalid settings are
+// rejected and the current ones kept.
+func (p *TrafficManagerProvider) UpdateSettings(settings Settings) error {
+	if err := annotations.ValidateDefaults(settings.Defaults); err != nil {
+		return err
+	}
+
+	p.settingsMu.Lock()
+	defer p.settingsMu.Unlock()
+
+	previous := p.domainFilter
+	p.domainFilter = settings.DomainFilter
+	mappers, err := p.newHostnameMappers(p.hostnameMapping)
+	if err != nil {
+		p.domainFilter = previous
+		return err
+	}
+	p.hostnameMappers = mappers
+	p.domainFilterExclude = settings.DomainFilterExclude
+	p.defaults = settings.Defaults
+
+	p.logger.Info("Updated provider settings",
+		zap.Strings("domainFilter", settings.DomainFilter),
+		zap.Strings("domainFilterExclude", settings.DomainFilterExclude),
+		zap.Any("defaults", settings.Defaults))
+	return nil
+}
+
+// DomainFilter returns the domains the provider manages
+func (p *TrafficManagerProvider) DomainFilter() []string {
+	p.settingsMu.RLock()
+	defer p.settingsMu.RUnlock()
+	return p.domainFilter
+}
+
+// DomainFilterExclude returns the domains excluded from the domain filter
+func (p *TrafficManagerProvider) DomainFilterExclude() []string {
+	p.settingsMu.RLock()
+	defer p.settingsMu.RUnlock()
+	return p.domainFilterExclude
+}
+
+// parseAnnotations parses Traffic Manager configuration using the current defaults.
+// Defaults from the source namespace's ConfigMap take precedence over the global ones;
+// annotations take precedence over both. The detected cluster region is the last resort for
+// the endpoint location.
+func (p *TrafficManagerProvider) parseAnnotations(ctx context.Context, labels map[string]string) (*annotations.TrafficManagerConfig, error) {
+	p.settingsMu.RLock()
+	defaults := p.defaults
+	p.settingsMu.RUnlock()
+
+	if namespace := resourceNamespace(labels); p.namespaceDefaults != nil && namespace != "" {
+		namespaceDefaults, err := p.namespaceDefaults.get(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		defaults = defaults.Merge(namespaceDefaults)
+	}
+	if defaults.EndpointLocation == "" {
+		defaults.EndpointLocation = p.detectedLocation
+	}
+
+	return annotations.ParseConfigWithDefaults(labels, defaults)
+}
+
+// mappers returns the current hostname mappers
+func (p *TrafficManagerProvider) mappers() []HostnameMapper {
+	p.settingsMu.RLock()
+	defer p.settingsMu.RUnlock()
+	return p.hostnameMappers
+}
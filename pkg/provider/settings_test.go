@@ -0,0 +1,81 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestUpdateSettings_DomainFilter(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:          logger,
+		domainFilter:    []string{"example.com"},
+		stateManager:    state.NewManager(0, logger),
+		hostnameMapping: []string{HostnameMappingNaming},
+	}
+	s := NewWebhookServer(p, logger)
+
+	require.NoError(t, p.UpdateSettings(Settings{DomainFilter: []string{"example.org"}, DomainFilterExclude: []string{"internal.example.org"}}))
+
+	assert.True(t, p.matchesDomainFilter("app.example.org"))
+	assert.False(t, p.matchesDomainFilter("app.example.com"))
+	assert.False(t, p.matchesDomainFilter("app.internal.example.org"))
+
+	// The new filter is advertised on the next negotiation
+	rec := httptest.NewRecorder()
+	s.HandleNegotiate(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response NegotiationResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Equal(t, []string{"example.org"}, response.DomainFilter.Include)
+	assert.Equal(t, []string{"internal.example.org"}, response.DomainFilter.Exclude)
+
+	// The naming mapper is rebuilt with the new domains
+	require.Len(t, p.mappers(), 1)
+	assert.Equal(t, []string{"example.org"}, p.mappers()[0].(namingMapper).domains)
+}
+
+func TestUpdateSettings_Defaults(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t)}
+
+	labels := map[string]string{annotations.AnnotationEnabled: "true"}
+	_, err := p.parseAnnotations(context.Background(), labels)
+	require.Error(t, err, "resource group is required without a default")
+
+	require.NoError(t, p.UpdateSettings(Settings{Defaults: annotations.Defaults{
+		ResourceGroup: "tm-rg",
+		RoutingMethod: "Priority",
+		MonitorPath:   "/healthz",
+	}}))
+
+	config, err := p.parseAnnotations(context.Background(), labels)
+	require.NoError(t, err)
+	assert.Equal(t, "tm-rg", config.ResourceGroup)
+	assert.Equal(t, "Priority", config.RoutingMethod)
+	assert.Equal(t, "/healthz", config.MonitorPath)
+	assert.Equal(t, annotations.DefaultMonitorPort, config.MonitorPort)
+}
+
+func TestUpdateSettings_RejectsInvalidDefaults(t *testing.T) {
+	p := &TrafficManagerProvider{
+		logger:       zaptest.NewLogger(t),
+		domainFilter: []string{"example.com"},
+	}
+
+	err := p.UpdateSettings(Settings{
+		DomainFilter: []string{"example.org"},
+		Defaults:     annotations.Defaults{RoutingMethod: "RoundRobin"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid default routing method")
+	assert.Equal(t, []string{"example.com"}, p.DomainFilter(), "settings are unchanged after a rejected update")
+}
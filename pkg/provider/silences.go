@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"go.uber.org/zap"
+)
+
+// Reasons a removal is silenced
+const (
+	SilenceReasonDeleted     = "deleted"
+	SilenceReasonDisabled    = "disabled"
+	SilenceReasonMaintenance = "maintenance"
+	SilenceReasonScheduled   = "scheduled"
+)
+
+// Silence marks a profile or endpoint that was removed on purpose, so alerting can tell
+// planned traffic removal from an outage until it expires
+type Silence struct {
+	Hostname     string    `json:"hostname"`
+	ProfileName  string    `json:"profileName"`
+	EndpointName string    `json:"endpointName,omitempty"` // Empty when the whole profile was removed
+	Reason       string    `json:"reason"`
+	Until        time.Time `json:"until"`
+}
+
+func (s Silence) key() string {
+	return s.ProfileName + "/" + s.EndpointName
+}
+
+func (s Silence) labels() []string {
+	return []string{s.Hostname, s.ProfileName, s.EndpointName, s.Reason}
+}
+
+// silence records an intentional removal for the configured silence duration.
+// It does nothing when silences are disabled.
+func (p *TrafficManagerProvider) silence(ctx context.Context, hostname, profileName, endpointName, reason string) {
+	if p.silenceDuration <= 0 {
+		return
+	}
+
+	s := Silence{
+		Hostname:     hostname,
+		ProfileName:  profileName,
+		EndpointName: endpointName,
+		Reason:       reason,
+		Until:        p.now().Add(p.silenceDuration),
+	}
+
+	p.silencesMu.Lock()
+	defer p.silencesMu.Unlock()
+	p.pruneSilences()
+
+	if p.silences == nil {
+		p.silences = make(map[string]Silence)
+	}
+	if existing, ok := p.silences[s.key()]; ok {
+		metrics.SilenceExpiry.DeleteLabelValues(existing.labels()...)
+	}
+	p.silences[s.key()] = s
+	metrics.SilenceExpiry.WithLabelValues(s.labels()...).Set(float64(s.Until.Unix()))
+
+	p.log(ctx).Info("Silenced planned removal",
+		zap.String("hostname", hostname),
+		zap.String("profileName", profileName),
+		zap.String("endpointName", endpointName),
+		zap.String("reason", reason),
+		zap.Time("until", s.Until))
+}
+
+// unsilence lifts the silence for a profile or endpoint that is serving traffic again.
+// Lifting an endpoint's silence also lifts its profile's.
+func (p *TrafficManagerProvider) unsilence(profileName, endpointName string) {
+	p.silencesMu.Lock()
+	defer p.silencesMu.Unlock()
+
+	for _, key := range []string{profileName + "/" + endpointName, profileName + "/"} {
+		if existing, ok := p.silences[key]; ok {
+			metrics.SilenceExpiry.DeleteLabelValues(existing.labels()...)
+			delete(p.silences, key)
+		}
+	}
+}
+
+// Silences returns the active silences, ordered by hostname
+func (p *TrafficManagerProvider) Silences() []Silence {
+	p.silencesMu.Lock()
+	defer p.silencesMu.Unlock()
+	p.pruneSilences()
+
+	active := make([]Silence, 0, len(p.silences))
+	for _, s := range p.silences {
+		active = append(active, s)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if active[i].Hostname != active[j].Hostname {
+			return active[i].Hostname < active[j].Hostname
+		}
+		return active[i].key() < active[j].key()
+	})
+	return active
+}
+
+// expireSilences drops expired silences and their metrics
+func (p *TrafficManagerProvider) expireSilences() {
+	p.silencesMu.Lock()
+	defer p.silencesMu.Unlock()
+	p.pruneSilences()
+}
+
+// pruneSilences drops expired silences; callers must hold silencesMu
+func (p *TrafficManagerProvider) pruneSilences() {
+	now := p.now()
+	for key, s := range p.silences {
+		if !now.Before(s.Until) {
+			metrics.SilenceExpiry.DeleteLabelValues(s.labels()...)
+			delete(p.silences, key)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSilences(t *testing.T) {
+	metrics.SilenceExpiry.Reset()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	p := &TrafficManagerProvider{
+		logger:          zaptest.NewLogger(t),
+		silenceDuration: time.Hour,
+		clock:           func() time.Time { return now },
+	}
+	ctx := context.Background()
+
+	p.silence(ctx, "app.example.com", "app-example-com-tm", "east", SilenceReasonDisabled)
+	p.silence(ctx, "app.example.com", "app-example-com-tm", "", SilenceReasonDeleted)
+
+	silences := p.Silences()
+	require.Len(t, silences, 2)
+	assert.Equal(t, "", silences[0].EndpointName)
+	assert.Equal(t, SilenceReasonDisabled, silences[1].Reason)
+	assert.Equal(t, now.Add(time.Hour), silences[1].Until)
+	assert.Equal(t, float64(now.Add(time.Hour).Unix()),
+		testutil.ToFloat64(metrics.SilenceExpiry.WithLabelValues("app.example.com", "app-example-com-tm", "east", SilenceReasonDisabled)))
+
+	// Serving traffic again lifts the endpoint's silence and its profile's
+	p.unsilence("app-example-com-tm", "east")
+	assert.Empty(t, p.Silences())
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.SilenceExpiry))
+
+	// Silences expire
+	p.silence(ctx, "app.example.com", "app-example-com-tm", "west", SilenceReasonDeleted)
+	now = now.Add(time.Hour)
+	p.expireSilences()
+	assert.Empty(t, p.Silences())
+	assert.Equal(t, 0, testutil.CollectAndCount(metrics.SilenceExpiry))
+}
+
+func TestSilences_Disabled(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t)}
+
+	p.silence(context.Background(), "app.example.com", "app-example-com-tm", "east", SilenceReasonDeleted)
+	assert.Empty(t, p.Silences())
+}
+
+func TestHandleSilences(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t), silenceDuration: time.Hour}
+	p.silence(context.Background(), "app.example.com", "app-example-com-tm", "east", SilenceReasonDeleted)
+	t.Cleanup(func() { p.unsilence("app-example-com-tm", "east") })
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleSilences(rec, httptest.NewRequest(http.MethodGet, "/silences", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var silences []Silence
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&silences))
+	require.Len(t, silences, 1)
+	assert.Equal(t, "east", silences[0].EndpointName)
+
+	rec = httptest.NewRecorder()
+	s.HandleSilences(rec, httptest.NewRequest(http.MethodPost, "/silences", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,103 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// softDeleted reports whether a profile was soft-deleted and is waiting to be purged
+func softDeleted(profile *state.ProfileState) bool {
+	_, ok := profile.Tags[trafficmanager.DeleteAfterTag]
+	return ok
+}
+
+// purgeDue reports whether a soft-deleted profile's grace period has passed at now.
+// A tag that can't be parsed counts as due, so a damaged profile doesn't linger forever.
+func purgeDue(profile *state.ProfileState, now time.Time) bool {
+	deleteAfter, err := time.Parse(time.RFC3339, profile.Tags[trafficmanager.DeleteAfterTag])
+	if err != nil {
+		return true
+	}
+	return !now.Before(deleteAfter)
+}
+
+// retireProfile deletes an empty profile, or with a grace period configured disables it and
+// tags it for PurgeDeletedProfiles to delete once the grace period has passed
+func (p *TrafficManagerProvider) retireProfile(ctx context.Context, tmClient *trafficmanager.Client, config *annotations.TrafficManagerConfig) error {
+	var err error
+	if p.profileDeleteGracePeriod <= 0 {
+		err = tmClient.DeleteProfile(ctx, config.ResourceGroup, config.ProfileName)
+	} else {
+		err = tmClient.SoftDeleteProfile(ctx, config.ResourceGroup, config.ProfileName, p.now().Add(p.profileDeleteGracePeriod))
+	}
+	if errors.Is(err, trafficmanager.ErrProfileNotFound) {
+		return nil
+	}
+	return err
+}
+
+// PurgeDeletedProfiles deletes soft-deleted profiles whose grace period has passed. A profile that
+// has had endpoints added back is left for the next apply to restore. It returns the number deleted.
+func (p *TrafficManagerProvider) PurgeDeletedProfiles(ctx context.Context) (int, error) {
+	now := p.now()
+	purged, pending := 0, 0
+
+	// Profiles in the resource groups that synced are purged even when others failed
+	profiles, syncErr := p.syncProfiles(ctx)
+	if syncErr != nil && !errors.As(syncErr, new(*trafficmanager.SyncError)) {
+		return purged, syncErr
+	}
+
+	for _, profile := range profiles {
+		if !softDeleted(profile) || primaryEndpointCount(profile) > 0 {
+			continue
+		}
+		if !purgeDue(profile, now) {
+			pending++
+			continue
+		}
+
+		tmClient, err := p.clientFor(subscriptionFromResourceID(profile.ResourceID), profile.ResourceGroup)
+		if err != nil {
+			return purged, err
+		}
+		if err := tmClient.DeleteProfile(ctx, profile.ResourceGroup, profile.ProfileName); err != nil && !trafficmanager.IsNotFound(err) {
+			p.log(ctx).Error("Failed to purge soft-deleted profile",
+				zap.String("profileName", profile.ProfileName),
+				zap.Error(err))
+			pending++
+			continue
+		}
+		p.log(ctx).Info("Purged soft-deleted Traffic Manager profile",
+			zap.String("profileName", profile.ProfileName),
+			zap.String("deleteAfter", profile.Tags[trafficmanager.DeleteAfterTag]))
+		purged++
+	}
+
+	metrics.ProfilesPendingPurge.Set(float64(pending))
+	return purged, syncErr
+}
+
+// RunProfilePurge runs PurgeDeletedProfiles every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunProfilePurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.PurgeDeletedProfiles(ctx); err != nil {
+				p.log(ctx).Error("Profile purge failed", zap.Error(err))
+			}
+		}
+	}
+}
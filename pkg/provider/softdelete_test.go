@@ -0,0 +1,25 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoftDeleted(t *testing.T) {
+	assert.False(t, softDeleted(&state.ProfileState{Tags: map[string]string{"managedBy": trafficmanager.DefaultManagedByValue}}))
+	assert.True(t, softDeleted(&state.ProfileState{Tags: map[string]string{trafficmanager.DeleteAfterTag: "2026-10-16T12:00:00Z"}}))
+}
+
+func TestPurgeDue(t *testing.T) {
+	profile := &state.ProfileState{Tags: map[string]string{trafficmanager.DeleteAfterTag: "2026-10-16T12:00:00Z"}}
+
+	assert.False(t, purgeDue(profile, time.Date(2026, 10, 16, 11, 59, 0, 0, time.UTC)), "inside the grace period")
+	assert.True(t, purgeDue(profile, time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)))
+
+	profile.Tags[trafficmanager.DeleteAfterTag] = "tomorrow"
+	assert.True(t, purgeDue(profile, time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)), "an unreadable tag counts as due")
+}
@@ -0,0 +1,39 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+)
+
+// defaultStateCacheTTL is how long cached profiles are used when no TTL is configured
+const defaultStateCacheTTL = 5 * time.Minute
+
+// revalidateTimeout bounds the Azure read refreshing a stale cached profile
+const revalidateTimeout = 30 * time.Second
+
+// revalidateProfile reads a stale cached profile from Azure again, for the state cache's
+// stale-while-revalidate refreshes. A profile that was deleted or soft-deleted comes back nil.
+func (p *TrafficManagerProvider) revalidateProfile(cached *state.ProfileState) (*state.ProfileState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+	defer cancel()
+
+	tmClient, err := p.clientFor(subscriptionFromResourceID(cached.ResourceID), cached.ResourceGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	profile, err := tmClient.GetProfileState(ctx, cached.ResourceGroup, cached.ProfileName)
+	if trafficmanager.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if softDeleted(profile) {
+		return nil, nil
+	}
+	return profile, nil
+}
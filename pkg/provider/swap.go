@@ -0,0 +1,252 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultSwapVerifyTimeout is how long a swap waits for the new endpoint to come Online
+	defaultSwapVerifyTimeout = 2 * time.Minute
+
+	// swapPollInterval is how often monitor status is read while verifying a swap
+	swapPollInterval = 10 * time.Second
+
+	// swapRollbackTimeout bounds restoring the endpoints after a failed swap, which runs apart from the request
+	swapRollbackTimeout = time.Minute
+
+	monitorStatusOnline = "Online"
+)
+
+// SwapRequest is the body accepted by POST /swap
+type SwapRequest struct {
+	SubscriptionID string `json:"subscriptionId,omitempty"` // Empty means the webhook's default subscription
+	ResourceGroup  string `json:"resourceGroup"`
+	ProfileName    string `json:"profileName"`
+	From           string `json:"from"`                    // Endpoint serving traffic now ("blue")
+	To             string `json:"to"`                      // Endpoint to cut over to ("green")
+	EndpointType   string `json:"endpointType,omitempty"`  // Defaults to ExternalEndpoints
+	VerifyTimeout  string `json:"verifyTimeout,omitempty"` // How long to wait for To to come Online; defaults to 2m
+	SkipVerify     bool   `json:"skipVerify,omitempty"`    // Cut over without checking monitor status, e.g. when health checks are off
+}
+
+// SwapResult reports a completed swap
+type SwapResult struct {
+	ProfileName   string `json:"profileName"`
+	RoutingMethod string `json:"routingMethod"`
+	From          string `json:"from"`
+	To            string `json:"to"`
+	Weight        int64  `json:"weight,omitempty"` // Weight given to To in a weighted profile
+}
+
+// swapClient is the part of the Traffic Manager client a swap uses
+type swapClient interface {
+	GetEndpoint(ctx context.Context, resourceGroup, profileName, endpointType, endpointName string) (*trafficmanager.EndpointState, error)
+	UpdateEndpointStatus(ctx context.Context, resourceGroup, profileName, endpointType, endpointName, status string) error
+	UpdateEndpointWeight(ctx context.Context, resourceGroup, profileName, endpointType, endpointName string, weight int64) error
+}
+
+// swap carries out one blue/green swap, remembering what to restore on rollback
+type swap struct {
+	req           SwapRequest
+	client        swapClient
+	routingMethod string
+	timeout       time.Duration
+	from, to      *trafficmanager.EndpointState
+	logger        *zap.Logger
+	sleep         func(ctx context.Context, d time.Duration) error
+}
+
+// SwapEndpoints cuts a profile over from one endpoint to another. The new endpoint is enabled
+// (at the minimum weight in a weighted profile) and must report Online before the old one is
+// disabled; in a weighted profile the new endpoint takes over the old one's weight. If the new
+// endpoint doesn't come Online, or degrades after the cutover, both endpoints are restored.
+func (p *TrafficManagerProvider) SwapEndpoints(ctx context.Context, req SwapRequest) (*SwapResult, error) {
+	if req.ResourceGroup == "" || req.ProfileName == "" || req.From == "" || req.To == "" {
+		return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("resourceGroup, profileName, from and to are required"))
+	}
+	if req.From == req.To {
+		return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("from and to must differ, both are %q", req.From))
+	}
+	if req.EndpointType == "" {
+		req.EndpointType = annotations.DefaultEndpointType
+	}
+	timeout := defaultSwapVerifyTimeout
+	if req.VerifyTimeout != "" {
+		d, err := time.ParseDuration(req.VerifyTimeout)
+		if err != nil || d <= 0 {
+			return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("invalid verifyTimeout %q", req.VerifyTimeout))
+		}
+		timeout = d
+	}
+	if err := p.resourcePolicy.check("", req.SubscriptionID, req.ResourceGroup); err != nil {
+		return nil, err
+	}
+
+	tmClient, err := p.clientFor(req.SubscriptionID, req.ResourceGroup)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := tmClient.GetProfileState(ctx, req.ResourceGroup, req.ProfileName)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &swap{
+		req:           req,
+		client:        tmClient,
+		routingMethod: profile.RoutingMethod,
+		timeout:       timeout,
+		logger:        p.log(ctx).With(zap.String("profileName", req.ProfileName), zap.String("from", req.From), zap.String("to", req.To)),
+		sleep:         sleepContext,
+	}
+	result, err := s.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Both endpoints are driven by the swap now, so stop any canary on them
+	p.stopCanary(req.ProfileName, req.From)
+	p.stopCanary(req.ProfileName, req.To)
+	p.silence(ctx, p.cachedHostname(req.ProfileName), req.ProfileName, req.From, SilenceReasonDisabled)
+	p.refreshProfile(ctx, tmClient, req.ResourceGroup, req.ProfileName)
+
+	return result, nil
+}
+
+// run performs the swap; on failure the endpoints are restored and the error returned
+func (s *swap) run(ctx context.Context) (*SwapResult, error) {
+	if s.routingMethod != "Priority" && s.routingMethod != "Weighted" {
+		return nil, withCode(ErrorCodeInvalidRequest, fmt.Errorf("swap requires a Priority or Weighted profile, %s uses %s", s.req.ProfileName, s.routingMethod))
+	}
+
+	var err error
+	if s.from, err = s.client.GetEndpoint(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.From); err != nil {
+		return nil, fmt.Errorf("failed to get endpoint %s: %w", s.req.From, err)
+	}
+	if s.to, err = s.client.GetEndpoint(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.To); err != nil {
+		return nil, fmt.Errorf("failed to get endpoint %s: %w", s.req.To, err)
+	}
+
+	result := &SwapResult{ProfileName: s.req.ProfileName, RoutingMethod: s.routingMethod, From: s.req.From, To: s.req.To}
+
+	// Bring the new endpoint up while it takes as little traffic as possible
+	if s.routingMethod == "Weighted" && s.to.Status == "Disabled" {
+		if err := s.client.UpdateEndpointWeight(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.To, annotations.MinWeight); err != nil {
+			return nil, s.rollback(ctx, err)
+		}
+	}
+	if s.to.Status != "Enabled" {
+		if err := s.client.UpdateEndpointStatus(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.To, "Enabled"); err != nil {
+			return nil, s.rollback(ctx, err)
+		}
+	}
+	s.logger.Info("Enabled swap target, verifying before cutover")
+
+	if err := s.verify(ctx, s.timeout); err != nil {
+		return nil, s.rollback(ctx, err)
+	}
+
+	// Cut over
+	if s.routingMethod == "Weighted" {
+		result.Weight = s.from.Weight
+		if err := s.client.UpdateEndpointWeight(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.To, s.from.Weight); err != nil {
+			return nil, s.rollback(ctx, err)
+		}
+	}
+	if err := s.client.UpdateEndpointStatus(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.From, "Disabled"); err != nil {
+		return nil, s.rollback(ctx, err)
+	}
+
+	// The new endpoint now takes all the traffic; make sure it held up
+	if err := s.verify(ctx, 0); err != nil {
+		return nil, s.rollback(ctx, err)
+	}
+
+	s.logger.Info("Swapped endpoints")
+	return result, nil
+}
+
+// verify waits up to timeout for the new endpoint to report Online; a timeout of 0 checks once
+func (s *swap) verify(ctx context.Context, timeout time.Duration) error {
+	if s.req.SkipVerify {
+		return nil
+	}
+
+	waited := time.Duration(0)
+	for {
+		endpoint, err := s.client.GetEndpoint(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.To)
+		if err != nil {
+			return fmt.Errorf("failed to verify endpoint %s: %w", s.req.To, err)
+		}
+		if endpoint.MonitorStatus == monitorStatusOnline {
+			return nil
+		}
+		if endpoint.MonitorStatus == monitorStatusDegraded || waited >= timeout {
+			return fmt.Errorf("endpoint %s is %s, not %s", s.req.To, endpoint.MonitorStatus, monitorStatusOnline)
+		}
+
+		if err := s.sleep(ctx, swapPollInterval); err != nil {
+			return err
+		}
+		waited += swapPollInterval
+	}
+}
+
+// rollback restores both endpoints to how they were before the swap and returns the cause,
+// wrapped with any failure to restore
+func (s *swap) rollback(ctx context.Context, cause error) error {
+	s.logger.Warn("Swap failed, rolling back", zap.Error(cause))
+
+	// The swap may have failed because the caller went away, which mustn't stop the restore
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), swapRollbackTimeout)
+	defer cancel()
+
+	var failed []error
+	// Restore the old endpoint first so the profile keeps serving
+	if s.from != nil {
+		if err := s.client.UpdateEndpointStatus(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.From, s.from.Status); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if s.to != nil {
+		if s.routingMethod == "Weighted" {
+			if err := s.client.UpdateEndpointWeight(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.To, s.to.Weight); err != nil {
+				failed = append(failed, err)
+			}
+		}
+		if err := s.client.UpdateEndpointStatus(ctx, s.req.ResourceGroup, s.req.ProfileName, s.req.EndpointType, s.req.To, s.to.Status); err != nil {
+			failed = append(failed, err)
+		}
+	}
+
+	if len(failed) > 0 {
+		s.logger.Error("Swap rollback failed", zap.Errors("errors", failed))
+		return fmt.Errorf("swap failed: %w; rollback also failed: %v", cause, failed)
+	}
+	return fmt.Errorf("swap failed and was rolled back: %w", cause)
+}
+
+// cachedHostname returns the vanity hostname of a cached profile, or "" if it isn't cached
+func (p *TrafficManagerProvider) cachedHostname(profileName string) string {
+	if profile, ok := p.stateManager.GetProfileByName(profileName); ok {
+		return profile.Hostname
+	}
+	return ""
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,182 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeSwapClient keeps endpoints in memory; monitor holds the statuses the green endpoint reports, one per read
+type fakeSwapClient struct {
+	endpoints map[string]*trafficmanager.EndpointState
+	monitor   []string
+	failOn    string
+}
+
+func (f *fakeSwapClient) GetEndpoint(_ context.Context, _, _, _, endpointName string) (*trafficmanager.EndpointState, error) {
+	endpoint := *f.endpoints[endpointName]
+	if endpointName == "green" && len(f.monitor) > 0 {
+		endpoint.MonitorStatus = f.monitor[0]
+		if len(f.monitor) > 1 {
+			f.monitor = f.monitor[1:]
+		}
+	}
+	return &endpoint, nil
+}
+
+func (f *fakeSwapClient) UpdateEndpointStatus(ctx context.Context, _, _, _, endpointName, status string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.failOn == endpointName+"="+status {
+		return errors.New("update failed")
+	}
+	f.endpoints[endpointName].Status = status
+	return nil
+}
+
+func (f *fakeSwapClient) UpdateEndpointWeight(ctx context.Context, _, _, _, endpointName string, weight int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f.endpoints[endpointName].Weight = weight
+	return nil
+}
+
+func newTestSwap(t *testing.T, routingMethod string, monitor ...string) (*swap, *fakeSwapClient) {
+	client := &fakeSwapClient{
+		endpoints: map[string]*trafficmanager.EndpointState{
+			"blue":  {EndpointName: "blue", Status: "Enabled", Weight: 500, Priority: 1},
+			"green": {EndpointName: "green", Status: "Disabled", Weight: 200, Priority: 2},
+		},
+		monitor: monitor,
+	}
+	s := &swap{
+		req:           SwapRequest{ResourceGroup: "tm-rg", ProfileName: "app-example-com-tm", From: "blue", To: "green", EndpointType: "ExternalEndpoints"},
+		client:        client,
+		routingMethod: routingMethod,
+		timeout:       30 * time.Second,
+		logger:        zaptest.NewLogger(t),
+		sleep:         func(context.Context, time.Duration) error { return nil },
+	}
+	return s, client
+}
+
+func TestSwap_Priority(t *testing.T) {
+	s, client := newTestSwap(t, "Priority", "CheckingEndpoint", "Online")
+
+	result, err := s.run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "green", result.To)
+	assert.Equal(t, "Disabled", client.endpoints["blue"].Status)
+	assert.Equal(t, "Enabled", client.endpoints["green"].Status)
+	assert.Equal(t, int64(200), client.endpoints["green"].Weight, "priority swaps leave weights alone")
+}
+
+func TestSwap_WeightedFlipsWeight(t *testing.T) {
+	s, client := newTestSwap(t, "Weighted", "Online")
+
+	result, err := s.run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), result.Weight)
+	assert.Equal(t, "Disabled", client.endpoints["blue"].Status)
+	assert.Equal(t, "Enabled", client.endpoints["green"].Status)
+	assert.Equal(t, int64(500), client.endpoints["green"].Weight)
+}
+
+func TestSwap_RollsBackWhenNotOnline(t *testing.T) {
+	// The green endpoint never comes Online within the verify timeout
+	s, client := newTestSwap(t, "Weighted", "CheckingEndpoint")
+
+	_, err := s.run(context.Background())
+	require.ErrorContains(t, err, "rolled back")
+	assert.Equal(t, "Enabled", client.endpoints["blue"].Status)
+	assert.Equal(t, "Disabled", client.endpoints["green"].Status)
+	assert.Equal(t, int64(200), client.endpoints["green"].Weight)
+
+	// A Degraded endpoint fails at once, including after the cutover
+	s, client = newTestSwap(t, "Priority", "Online", monitorStatusDegraded)
+	_, err = s.run(context.Background())
+	require.ErrorContains(t, err, "Degraded")
+	assert.Equal(t, "Enabled", client.endpoints["blue"].Status)
+	assert.Equal(t, "Disabled", client.endpoints["green"].Status)
+}
+
+func TestSwap_RollsBackOnUpdateFailure(t *testing.T) {
+	s, client := newTestSwap(t, "Priority", "Online")
+	client.failOn = "blue=Disabled"
+
+	_, err := s.run(context.Background())
+	require.ErrorContains(t, err, "update failed")
+	assert.Equal(t, "Enabled", client.endpoints["blue"].Status)
+	assert.Equal(t, "Disabled", client.endpoints["green"].Status)
+}
+
+func TestSwap_RollsBackWhenCallerDisconnects(t *testing.T) {
+	s, client := newTestSwap(t, "Weighted", "CheckingEndpoint")
+	ctx, cancel := context.WithCancel(context.Background())
+	// The operator's curl goes away while the swap waits for green to come Online
+	s.sleep = func(ctx context.Context, _ time.Duration) error {
+		cancel()
+		return ctx.Err()
+	}
+
+	_, err := s.run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "rolled back")
+	assert.Equal(t, "Enabled", client.endpoints["blue"].Status)
+	assert.Equal(t, "Disabled", client.endpoints["green"].Status)
+	assert.Equal(t, int64(200), client.endpoints["green"].Weight)
+}
+
+func TestSwap_SkipVerify(t *testing.T) {
+	s, client := newTestSwap(t, "Priority", "CheckingEndpoint")
+	s.req.SkipVerify = true
+
+	_, err := s.run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Disabled", client.endpoints["blue"].Status)
+}
+
+func TestSwap_RequiresPriorityOrWeighted(t *testing.T) {
+	s, _ := newTestSwap(t, "Performance")
+
+	_, err := s.run(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, ErrorCodeInvalidRequest, errorCode(err))
+}
+
+func TestSwapEndpoints_Invalid(t *testing.T) {
+	p := &TrafficManagerProvider{logger: zaptest.NewLogger(t)}
+	ctx := context.Background()
+
+	_, err := p.SwapEndpoints(ctx, SwapRequest{ResourceGroup: "tm-rg", ProfileName: "app", From: "blue"})
+	assert.ErrorContains(t, err, "are required")
+
+	_, err = p.SwapEndpoints(ctx, SwapRequest{ResourceGroup: "tm-rg", ProfileName: "app", From: "blue", To: "blue"})
+	assert.ErrorContains(t, err, "must differ")
+
+	_, err = p.SwapEndpoints(ctx, SwapRequest{ResourceGroup: "tm-rg", ProfileName: "app", From: "blue", To: "green", VerifyTimeout: "soon"})
+	assert.Equal(t, ErrorCodeInvalidRequest, errorCode(err))
+}
+
+func TestHandleSwap_Invalid(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleSwap(rec, httptest.NewRequest(http.MethodPost, "/swap", strings.NewReader(`{"resourceGroup":"tm-rg","profileName":"app","from":"blue","to":"blue"}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.HandleSwap(rec, httptest.NewRequest(http.MethodGet, "/swap", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,115 @@
+package provider
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// deletionProtectionTag is set to "true" on profiles created with the deletion-protection annotation
+const deletionProtectionTag = "deletionProtection"
+
+// deletionProtected reports whether a profile must be kept when its last endpoint is deleted, either
+// because the deleted endpoint's annotations ask for it or because the profile was tagged when it was written
+func deletionProtected(config *annotations.TrafficManagerConfig, profile *state.ProfileState) bool {
+	return config.DeletionProtection || profile.Tags[deletionProtectionTag] == "true"
+}
+
+// owner returns the tags that mark the profiles this webhook manages. Profiles that lost their
+// tags are still managed while state records them.
+func (p *TrafficManagerProvider) owner() trafficmanager.Ownership {
+	owner := p.ownership.WithDefaults()
+	owner.Recorded = p.recordedProfile
+	return owner
+}
+
+// recordedProfile reports whether state holds the profile, i.e. it has been synced with the
+// managed-by tag or written by the webhook
+func (p *TrafficManagerProvider) recordedProfile(resourceGroup, profileName string) bool {
+	for _, profile := range p.stateManager.ListProfileSnapshots() {
+		if profile.ProfileName == profileName && strings.EqualFold(profile.ResourceGroup, resourceGroup) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTags reports whether every tag in want is set to the same value in tags
+func hasTags(tags, want map[string]string) bool {
+	for k, v := range want {
+		if actual, ok := tags[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHostnameTags looks for managed profiles whose hostname tag was removed or rewritten,
+// typically by an Azure Policy that strips unknown tags. It recovers their hostname from
+// state or the profile naming convention where it can, and logs and counts every affected
+// profile so the problem is visible rather than the profile silently vanishing from Records.
+// It runs after the configured hostname mappers.
+func (p *TrafficManagerProvider) checkHostnameTags(ctx context.Context, profiles []*state.ProfileState) {
+	fallbacks := []HostnameMapper{
+		stateMapper{stateManager: p.stateManager},
+		namingMapper{domains: p.DomainFilter()},
+	}
+
+	owner := p.owner()
+	missing, unmapped := 0, 0
+	for _, profile := range profiles {
+		tagged := profile.Tags[owner.ManagedByTag] == owner.ManagedByValue
+		tag := profile.Tags[owner.HostnameTag]
+
+		// A rewritten tag is caught by comparing it to the hostname recorded when the profile was written
+		if tag != "" {
+			if cached, ok := p.stateManager.GetProfileByName(profile.ProfileName); ok && cached.Hostname != "" &&
+				strings.EqualFold(cached.ResourceGroup, profile.ResourceGroup) && !strings.EqualFold(cached.Hostname, tag) {
+				p.log(ctx).Warn("Hostname tag on Traffic Manager profile was changed outside the webhook; using the recorded hostname",
+					zap.String("profileName", profile.ProfileName),
+					zap.String("resourceGroup", profile.ResourceGroup),
+					zap.String("tag", tag),
+					zap.String("hostname", cached.Hostname))
+				profile.Hostname = cached.Hostname
+			}
+			continue
+		}
+
+		for _, fallback := range fallbacks {
+			if profile.Hostname != "" {
+				break
+			}
+			_ = fallback.MapHostnames(ctx, []*state.ProfileState{profile})
+		}
+
+		// Untagged profiles are only kept if their hostname can be recovered
+		if !tagged && profile.Hostname == "" {
+			p.log(ctx).Debug("Ignoring untagged profile that can't be matched to a hostname",
+				zap.String("profileName", profile.ProfileName),
+				zap.String("resourceGroup", profile.ResourceGroup))
+			continue
+		}
+
+		missing++
+		if profile.Hostname == "" {
+			unmapped++
+			p.log(ctx).Error("Managed Traffic Manager profile is missing its hostname tag and no hostname could be recovered; it is omitted from records. Check for an Azure Policy removing tags",
+				zap.String("profileName", profile.ProfileName),
+				zap.String("resourceGroup", profile.ResourceGroup))
+			continue
+		}
+
+		p.log(ctx).Warn("Managed Traffic Manager profile is missing its hostname tag; recovered the hostname. Check for an Azure Policy removing tags",
+			zap.String("profileName", profile.ProfileName),
+			zap.String("resourceGroup", profile.ResourceGroup),
+			zap.String("hostname", profile.Hostname))
+	}
+
+	metrics.ProfilesMissingHostnameTag.Set(float64(missing))
+	metrics.ProfilesUnmapped.Set(float64(unmapped))
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestCheckHostnameTags(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	p := &TrafficManagerProvider{
+		logger:       logger,
+		domainFilter: []string{"example.com"},
+		stateManager: state.NewManager(5*time.Minute, logger),
+	}
+	p.stateManager.SetProfile("recorded.example.com", &state.ProfileState{
+		ProfileName:   "custom-name",
+		ResourceGroup: "tm-rg",
+		Hostname:      "recorded.example.com",
+	})
+	p.stateManager.SetProfile("original.example.com", &state.ProfileState{
+		ProfileName:   "rewritten-tm",
+		ResourceGroup: "tm-rg",
+		Hostname:      "original.example.com",
+	})
+
+	managed := map[string]string{"managedBy": trafficmanager.DefaultManagedByValue}
+	profiles := []*state.ProfileState{
+		// Hostname tag stripped, recovered from state
+		{ProfileName: "custom-name", ResourceGroup: "tm-rg", Tags: managed},
+		// All tags stripped, recovered from the naming convention
+		{ProfileName: "shop-example-com-tm", ResourceGroup: "tm-rg", Tags: map[string]string{}},
+		// Hostname tag stripped and unrecoverable
+		{ProfileName: "opaque", ResourceGroup: "tm-rg", Tags: managed},
+		// Untagged and unrecoverable, so not treated as ours
+		{ProfileName: "someone-elses-tm", ResourceGroup: "tm-rg", Tags: map[string]string{}},
+		// Hostname tag rewritten
+		{ProfileName: "rewritten-tm", ResourceGroup: "tm-rg", Hostname: "changed.example.com",
+			Tags: map[string]string{"managedBy": trafficmanager.DefaultManagedByValue, "hostname": "changed.example.com"}},
+	}
+
+	p.checkHostnameTags(context.Background(), profiles)
+
+	assert.Equal(t, "recorded.example.com", profiles[0].Hostname)
+	assert.Equal(t, "shop.example.com", profiles[1].Hostname)
+	assert.Equal(t, "", profiles[2].Hostname)
+	assert.Equal(t, "", profiles[3].Hostname)
+	assert.Equal(t, "original.example.com", profiles[4].Hostname)
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(metrics.ProfilesMissingHostnameTag))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.ProfilesUnmapped))
+}
@@ -0,0 +1,169 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"go.uber.org/zap"
+)
+
+// TrafficView is the latest Traffic View heat map of a profile, listed by GET /admin/trafficview
+type TrafficView struct {
+	Hostname      string                  `json:"hostname"`
+	ProfileName   string                  `json:"profileName"`
+	ResourceGroup string                  `json:"resourceGroup"`
+	PulledAt      time.Time               `json:"pulledAt"`
+	Endpoints     []TrafficViewEndpoint   `json:"endpoints"` // Totals across the heat map's sources
+	HeatMap       *trafficmanager.HeatMap `json:"heatMap"`
+}
+
+// TrafficViewEndpoint totals the queries one endpoint answered in a heat map
+type TrafficViewEndpoint struct {
+	EndpointName string  `json:"endpointName"`
+	Queries      int64   `json:"queries"`
+	Latency      float64 `json:"latencyMs,omitempty"` // Mean latency weighted by queries, 0 when unknown
+}
+
+// summarizeHeatMap totals the queries of each endpoint in heatMap, ordered by endpoint name
+func summarizeHeatMap(heatMap *trafficmanager.HeatMap) []TrafficViewEndpoint {
+	type total struct {
+		queries, measured int64
+		latency           float64
+	}
+	totals := make(map[string]*total)
+	for _, flow := range heatMap.Flows {
+		for _, query := range flow.Queries {
+			t, ok := totals[query.EndpointName]
+			if !ok {
+				t = &total{}
+				totals[query.EndpointName] = t
+			}
+			t.queries += query.QueryCount
+			if query.Latency > 0 {
+				t.measured += query.QueryCount
+				t.latency += query.Latency * float64(query.QueryCount)
+			}
+		}
+	}
+
+	endpoints := make([]TrafficViewEndpoint, 0, len(totals))
+	for _, name := range sortedKeys(totals) {
+		t := totals[name]
+		endpoint := TrafficViewEndpoint{EndpointName: name, Queries: t.queries}
+		if t.measured > 0 {
+			endpoint.Latency = t.latency / float64(t.measured)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// PullTrafficViews reads the heat map of every cached profile enrolled in Traffic View and
+// publishes it as metrics. A profile whose heat map can't be read keeps its last one. It returns
+// the number of heat maps read.
+func (p *TrafficManagerProvider) PullTrafficViews(ctx context.Context) (int, error) {
+	pulled := 0
+	enrolled := make(map[string]bool)
+	defer func() {
+		p.pruneTrafficViews(enrolled)
+		p.updateTrafficViewMetrics()
+	}()
+
+	for _, cached := range p.stateManager.ListProfiles() {
+		if !cached.TrafficViewEnabled {
+			continue
+		}
+		enrolled[cached.Hostname] = true
+
+		tmClient, err := p.clientFor(subscriptionFromResourceID(cached.ResourceID), cached.ResourceGroup)
+		if err != nil {
+			return pulled, err
+		}
+		heatMap, err := tmClient.GetHeatMap(ctx, cached.ResourceGroup, cached.ProfileName)
+		if err != nil {
+			// Azure has no heat map until it has processed a day or so of queries
+			p.log(ctx).Warn("Failed to read Traffic View heat map",
+				zap.String("hostname", cached.Hostname),
+				zap.String("profileName", cached.ProfileName),
+				zap.Error(err))
+			continue
+		}
+
+		p.trafficViewsMu.Lock()
+		if p.trafficViews == nil {
+			p.trafficViews = make(map[string]*TrafficView)
+		}
+		p.trafficViews[cached.Hostname] = &TrafficView{
+			Hostname:      cached.Hostname,
+			ProfileName:   cached.ProfileName,
+			ResourceGroup: cached.ResourceGroup,
+			PulledAt:      p.now(),
+			Endpoints:     summarizeHeatMap(heatMap),
+			HeatMap:       heatMap,
+		}
+		p.trafficViewsMu.Unlock()
+		pulled++
+	}
+	return pulled, nil
+}
+
+// pruneTrafficViews forgets the heat maps of profiles no longer enrolled in Traffic View
+func (p *TrafficManagerProvider) pruneTrafficViews(enrolled map[string]bool) {
+	p.trafficViewsMu.Lock()
+	defer p.trafficViewsMu.Unlock()
+	for hostname := range p.trafficViews {
+		if !enrolled[hostname] {
+			delete(p.trafficViews, hostname)
+		}
+	}
+}
+
+// updateTrafficViewMetrics publishes the stored heat maps, dropping the series of forgotten ones
+func (p *TrafficManagerProvider) updateTrafficViewMetrics() {
+	metrics.TrafficViewQueries.Reset()
+	metrics.TrafficViewSources.Reset()
+	metrics.TrafficViewLatency.Reset()
+
+	for _, view := range p.TrafficViews() {
+		metrics.TrafficViewSources.WithLabelValues(view.Hostname).Set(float64(len(view.HeatMap.Flows)))
+		for _, endpoint := range view.Endpoints {
+			metrics.TrafficViewQueries.WithLabelValues(view.Hostname, endpoint.EndpointName).Set(float64(endpoint.Queries))
+			if endpoint.Latency > 0 {
+				metrics.TrafficViewLatency.WithLabelValues(view.Hostname, endpoint.EndpointName).Set(endpoint.Latency)
+			}
+		}
+	}
+}
+
+// TrafficViews returns the latest heat map of each profile enrolled in Traffic View, ordered by hostname
+func (p *TrafficManagerProvider) TrafficViews() []TrafficView {
+	p.trafficViewsMu.Lock()
+	defer p.trafficViewsMu.Unlock()
+
+	views := make([]TrafficView, 0, len(p.trafficViews))
+	for _, view := range p.trafficViews {
+		views = append(views, *view)
+	}
+	sort.Slice(views, func(i, j int) bool { return views[i].Hostname < views[j].Hostname })
+	return views
+}
+
+// RunTrafficViewPoller runs PullTrafficViews every interval until ctx is cancelled
+func (p *TrafficManagerProvider) RunTrafficViewPoller(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := p.PullTrafficViews(ctx); err != nil {
+				p.log(ctx).Error("Traffic View pull failed", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSummarizeHeatMap(t *testing.T) {
+	endpoints := summarizeHeatMap(&trafficmanager.HeatMap{Flows: []trafficmanager.TrafficFlow{
+		{SourceIP: "10.0.0.1", Queries: []trafficmanager.QueryExperience{
+			{EndpointName: "west", QueryCount: 10, Latency: 40},
+			{EndpointName: "east", QueryCount: 5},
+		}},
+		{SourceIP: "10.0.0.2", Queries: []trafficmanager.QueryExperience{
+			{EndpointName: "west", QueryCount: 30, Latency: 20},
+		}},
+	}})
+
+	assert.Equal(t, []TrafficViewEndpoint{
+		{EndpointName: "east", Queries: 5},
+		{EndpointName: "west", Queries: 40, Latency: 25},
+	}, endpoints)
+}
+
+func TestHandleAdminTrafficView(t *testing.T) {
+	p := newAdminProvider(t)
+	p.trafficViews = map[string]*TrafficView{
+		"app.example.com": {Hostname: "app.example.com", ProfileName: "app-example-com", HeatMap: &trafficmanager.HeatMap{}},
+		"api.example.com": {Hostname: "api.example.com", ProfileName: "api-example-com", HeatMap: &trafficmanager.HeatMap{}},
+	}
+	s := NewWebhookServer(p, zaptest.NewLogger(t))
+
+	rec := httptest.NewRecorder()
+	s.HandleAdminTrafficView(rec, httptest.NewRequest(http.MethodGet, "/admin/trafficview", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var views []TrafficView
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&views))
+	require.Len(t, views, 2)
+	assert.Equal(t, "api.example.com", views[0].Hostname)
+
+	rec = httptest.NewRecorder()
+	s.HandleAdminTrafficView(rec, httptest.NewRequest(http.MethodGet, "/admin/trafficview?hostname=APP.example.com", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&views))
+	require.Len(t, views, 1)
+	assert.Equal(t, "app-example-com", views[0].ProfileName)
+
+	rec = httptest.NewRecorder()
+	s.HandleAdminTrafficView(rec, httptest.NewRequest(http.MethodGet, "/admin/trafficview?hostname=other.example.com", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestPruneTrafficViews(t *testing.T) {
+	p := newAdminProvider(t)
+	p.trafficViews = map[string]*TrafficView{
+		"app.example.com": {Hostname: "app.example.com", HeatMap: &trafficmanager.HeatMap{}},
+		"old.example.com": {Hostname: "old.example.com", HeatMap: &trafficmanager.HeatMap{}},
+	}
+	p.pruneTrafficViews(map[string]bool{"app.example.com": true})
+
+	views := p.TrafficViews()
+	require.Len(t, views, 1)
+	assert.Equal(t, "app.example.com", views[0].Hostname)
+}
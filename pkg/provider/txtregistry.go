@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"go.uber.org/zap"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// recordTypeTXT is the record type External DNS' TXT registry writes ownership records as
+	recordTypeTXT = "TXT"
+
+	// txtRegistryKey is the ConfigMap data key holding the registry records as JSON
+	txtRegistryKey = "records"
+)
+
+// txtRegistry stores External DNS' TXT ownership records in a ConfigMap. Traffic Manager has
+// nowhere to keep them, so without it the webhook can't be the only provider with --registry=txt.
+type txtRegistry struct {
+	store  *configMapStore
+	logger *zap.Logger
+}
+
+// txtRecord is a stored ownership record
+type txtRecord struct {
+	DNSName       string            `json:"dnsName"`
+	SetIdentifier string            `json:"setIdentifier,omitempty"`
+	Targets       []string          `json:"targets"`
+	RecordTTL     int64             `json:"recordTTL,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+}
+
+// newTXTRegistry returns a registry backed by the ConfigMap ref, written "<namespace>/<name>" or "<name>"
+func newTXTRegistry(client dynamic.Interface, ref string, logger *zap.Logger) (*txtRegistry, error) {
+	store, err := newConfigMapStore(client, ref, txtRegistryKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TXT registry: %w", err)
+	}
+	return &txtRegistry{store: store, logger: logger}, nil
+}
+
+// key identifies a record; External DNS can keep one TXT record per name and set identifier
+func (r txtRecord) key() string {
+	return strings.ToLower(r.DNSName) + "/" + r.SetIdentifier
+}
+
+func toTXTRecord(endpoint *Endpoint) txtRecord {
+	return txtRecord{
+		DNSName:       endpoint.DNSName,
+		SetIdentifier: endpoint.SetIdentifier,
+		Targets:       endpoint.Targets,
+		RecordTTL:     endpoint.RecordTTL,
+		Labels:        endpoint.Labels,
+	}
+}
+
+func (r txtRecord) endpoint() *Endpoint {
+	return &Endpoint{
+		DNSName:       r.DNSName,
+		SetIdentifier: r.SetIdentifier,
+		Targets:       r.Targets,
+		RecordType:    recordTypeTXT,
+		RecordTTL:     r.RecordTTL,
+		Labels:        r.Labels,
+	}
+}
+
+// Records returns the stored TXT records as endpoints
+func (t *txtRegistry) Records(ctx context.Context) ([]*Endpoint, error) {
+	data, err := t.store.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records, err := decodeTXTRecords(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TXT registry ConfigMap %s: %w", t.store, err)
+	}
+
+	endpoints := make([]*Endpoint, 0, len(records))
+	for _, key := range sortedKeys(records) {
+		endpoints = append(endpoints, records[key].endpoint())
+	}
+	metrics.TXTRegistryRecords.Set(float64(len(endpoints)))
+	return endpoints, nil
+}
+
+// Apply writes the TXT records of a change set. Creates and updates replace any stored record of
+// the same name and set identifier; deleting a record that isn't stored is not an error.
+func (t *txtRegistry) Apply(ctx context.Context, changes *Changes) error {
+	if len(changes.Create) == 0 && len(changes.UpdateNew) == 0 && len(changes.Delete) == 0 {
+		return nil
+	}
+
+	var count int
+	err := t.store.update(ctx, func(data string) (string, error) {
+		records, err := decodeTXTRecords(data)
+		if err != nil {
+			// Start over rather than fail every apply on a corrupt ConfigMap
+			logging.FromContext(ctx, t.logger).Warn("Discarding unreadable TXT registry records",
+				zap.String("configMap", t.store.String()),
+				zap.Error(err))
+			records = make(map[string]txtRecord)
+		}
+
+		for _, endpoint := range changes.Delete {
+			delete(records, toTXTRecord(endpoint).key())
+		}
+		for _, endpoint := range changes.UpdateOld {
+			delete(records, toTXTRecord(endpoint).key())
+		}
+		for _, endpoints := range [][]*Endpoint{changes.Create, changes.UpdateNew} {
+			for _, endpoint := range endpoints {
+				record := toTXTRecord(endpoint)
+				records[record.key()] = record
+			}
+		}
+
+		count = len(records)
+		return encodeTXTRecords(records)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write TXT registry: %w", err)
+	}
+
+	metrics.TXTRegistryRecords.Set(float64(count))
+	return nil
+}
+
+// decodeTXTRecords parses stored records by key
+func decodeTXTRecords(data string) (map[string]txtRecord, error) {
+	records := make(map[string]txtRecord)
+	if data == "" {
+		return records, nil
+	}
+
+	var list []txtRecord
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		return nil, err
+	}
+	for _, record := range list {
+		records[record.key()] = record
+	}
+	return records, nil
+}
+
+// encodeTXTRecords serializes records sorted by key, so unchanged records write identical data
+func encodeTXTRecords(records map[string]txtRecord) (string, error) {
+	list := make([]txtRecord, 0, len(records))
+	for _, key := range sortedKeys(records) {
+		list = append(list, records[key])
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode TXT registry records: %w", err)
+	}
+	return string(data), nil
+}
+
+// splitTXTChanges separates the TXT records of a change set from the records Traffic Manager handles
+func splitTXTChanges(changes *Changes) (txt, rest *Changes) {
+	txt, rest = &Changes{}, &Changes{}
+	for _, endpoint := range changes.Create {
+		if endpoint.RecordType == recordTypeTXT {
+			txt.Create = append(txt.Create, endpoint)
+		} else {
+			rest.Create = append(rest.Create, endpoint)
+		}
+	}
+	for i := range changes.UpdateOld {
+		if changes.UpdateNew[i].RecordType == recordTypeTXT {
+			txt.UpdateOld = append(txt.UpdateOld, changes.UpdateOld[i])
+			txt.UpdateNew = append(txt.UpdateNew, changes.UpdateNew[i])
+		} else {
+			rest.UpdateOld = append(rest.UpdateOld, changes.UpdateOld[i])
+			rest.UpdateNew = append(rest.UpdateNew, changes.UpdateNew[i])
+		}
+	}
+	for _, endpoint := range changes.Delete {
+		if endpoint.RecordType == recordTypeTXT {
+			txt.Delete = append(txt.Delete, endpoint)
+		} else {
+			rest.Delete = append(rest.Delete, endpoint)
+		}
+	}
+	return txt, rest
+}
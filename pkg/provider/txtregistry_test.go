@@ -0,0 +1,112 @@
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTXTEndpoint(dnsName, owner string) *Endpoint {
+	return &Endpoint{
+		DNSName:    dnsName,
+		RecordType: recordTypeTXT,
+		Targets:    []string{"\"heritage=external-dns,external-dns/owner=" + owner + "\""},
+		Labels:     map[string]string{"owner": owner},
+	}
+}
+
+func TestNewTXTRegistry(t *testing.T) {
+	registry, err := newTXTRegistry(nil, "external-dns/tm-registry", zaptest.NewLogger(t))
+	require.NoError(t, err)
+	assert.Equal(t, "external-dns/tm-registry", registry.store.String())
+
+	registry, err = newTXTRegistry(nil, "tm-registry", zaptest.NewLogger(t))
+	require.NoError(t, err)
+	assert.Equal(t, "default/tm-registry", registry.store.String())
+
+	for _, ref := range []string{"", "external-dns/", "/tm-registry", "a/b/c"} {
+		_, err := newTXTRegistry(nil, ref, zaptest.NewLogger(t))
+		assert.Error(t, err, ref)
+	}
+}
+
+func TestTXTRegistry_RoundTrip(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	registry, err := newTXTRegistry(client, "external-dns/tm-registry", zaptest.NewLogger(t))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	records, err := registry.Records(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, records, "a missing ConfigMap has no records")
+
+	require.NoError(t, registry.Apply(ctx, &Changes{Create: []*Endpoint{
+		newTXTEndpoint("a-demo.example.com", "cluster-a"),
+		newTXTEndpoint("cname-demo.example.com", "cluster-a"),
+	}}))
+	_, err = client.Resource(configMapGVR).Namespace("external-dns").Get(ctx, "tm-registry", metav1.GetOptions{})
+	require.NoError(t, err, "the ConfigMap is created on the first write")
+
+	records, err = registry.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "a-demo.example.com", records[0].DNSName)
+	assert.Equal(t, recordTypeTXT, records[0].RecordType)
+	assert.Equal(t, "cluster-a", records[0].Labels["owner"])
+
+	require.NoError(t, registry.Apply(ctx, &Changes{
+		UpdateOld: []*Endpoint{newTXTEndpoint("a-demo.example.com", "cluster-a")},
+		UpdateNew: []*Endpoint{newTXTEndpoint("a-demo.example.com", "cluster-b")},
+		Delete:    []*Endpoint{newTXTEndpoint("cname-demo.example.com", "cluster-a"), newTXTEndpoint("missing.example.com", "cluster-a")},
+	}))
+
+	records, err = registry.Records(ctx)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "cluster-b", records[0].Labels["owner"])
+}
+
+func TestSplitTXTChanges(t *testing.T) {
+	cname := &Endpoint{DNSName: "demo.example.com", RecordType: "CNAME"}
+	txt := newTXTEndpoint("cname-demo.example.com", "default")
+
+	registry, rest := splitTXTChanges(&Changes{
+		Create:    []*Endpoint{cname, txt},
+		UpdateOld: []*Endpoint{txt},
+		UpdateNew: []*Endpoint{txt},
+		Delete:    []*Endpoint{cname},
+	})
+
+	assert.Equal(t, []*Endpoint{txt}, registry.Create)
+	assert.Len(t, registry.UpdateNew, 1)
+	assert.Empty(t, registry.Delete)
+	assert.Equal(t, []*Endpoint{cname}, rest.Create)
+	assert.Empty(t, rest.UpdateOld)
+	assert.Equal(t, []*Endpoint{cname}, rest.Delete)
+}
+
+func TestApplyChanges_TXTRegistry(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme())
+	registry, err := newTXTRegistry(client, "tm-registry", zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	p := &TrafficManagerProvider{
+		logger:      zaptest.NewLogger(t),
+		policy:      PolicyUpsertOnly,
+		txtRegistry: registry,
+	}
+	ctx := context.Background()
+
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{Create: []*Endpoint{newTXTEndpoint("cname-demo.example.com", "default")}}))
+	require.NoError(t, p.ApplyChanges(ctx, &Changes{Delete: []*Endpoint{newTXTEndpoint("cname-demo.example.com", "default")}}))
+
+	records, err := registry.Records(ctx)
+	require.NoError(t, err)
+	assert.Len(t, records, 1, "upsert-only keeps ownership records")
+}
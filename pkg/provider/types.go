@@ -1,5 +1,12 @@
 package provider
 
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+)
+
 // Endpoint represents a DNS endpoint from External DNS
 // This matches the External DNS endpoint type used in webhook communication
 type Endpoint struct {
@@ -10,6 +17,101 @@ type Endpoint struct {
 	RecordTTL        int64                      `json:"recordTTL,omitempty"`
 	Labels           map[string]string          `json:"labels,omitempty"`
 	ProviderSpecific []ProviderSpecificProperty `json:"providerSpecific,omitempty"`
+
+	// Fields added by newer External DNS versions that aren't modelled above.
+	// They are kept so endpoints returned from AdjustEndpoints round-trip unchanged.
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// endpointFields are the JSON fields modelled by Endpoint
+var endpointFields = map[string]bool{
+	"dnsName":          true,
+	"targets":          true,
+	"recordType":       true,
+	"setIdentifier":    true,
+	"recordTTL":        true,
+	"labels":           true,
+	"providerSpecific": true,
+}
+
+// endpointJSON has Endpoint's fields without its JSON methods
+type endpointJSON Endpoint
+
+// UnmarshalJSON decodes an endpoint, keeping unknown fields in Extra
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*endpointJSON)(e)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	e.Extra = nil
+	for name, value := range fields {
+		if endpointFields[name] {
+			continue
+		}
+		if e.Extra == nil {
+			e.Extra = make(map[string]json.RawMessage)
+		}
+		e.Extra[name] = value
+	}
+	return nil
+}
+
+// MarshalJSON encodes an endpoint, including any unknown fields it was decoded with
+func (e Endpoint) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(endpointJSON(e))
+	if err != nil || len(e.Extra) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range e.Extra {
+		if !endpointFields[name] {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// annotationMap returns the labels and provider-specific properties of an endpoint as one map
+// of Traffic Manager settings. External DNS passes resource annotations as provider-specific
+// properties, with the "webhook/" prefix or, from some sources, under the original annotation
+// key; both are normalized to the keys the annotations package parses. Provider-specific
+// properties override labels of the same name.
+func (e *Endpoint) annotationMap() map[string]string {
+	merged := make(map[string]string, len(e.Labels)+len(e.ProviderSpecific))
+	for k, v := range e.Labels {
+		merged[k] = v
+	}
+	for _, prop := range e.ProviderSpecific {
+		merged[prop.Name] = prop.Value
+	}
+	return annotations.NormalizeAnnotations(merged)
+}
+
+// unknownFields returns the sorted names of fields in endpoints that Endpoint doesn't model
+func unknownFields(endpoints ...[]*Endpoint) []string {
+	seen := make(map[string]bool)
+	for _, list := range endpoints {
+		for _, endpoint := range list {
+			for name := range endpoint.Extra {
+				seen[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ProviderSpecificProperty holds provider-specific metadata
@@ -32,10 +134,15 @@ type DomainFilter struct {
 	Exclude []string `json:"exclude,omitempty"`
 }
 
-// NegotiationResponse is the response for the negotiation endpoint
+// NegotiationResponse is the response for the negotiation endpoint.
+// External DNS decodes the body as its own domain filter, so the filter is also given at the
+// top level; DomainFilter and the version fields are kept for other clients.
 type NegotiationResponse struct {
-	Version      string       `json:"version"`
-	DomainFilter DomainFilter `json:"domainFilter"`
+	Include           []string     `json:"include,omitempty"`
+	Exclude           []string     `json:"exclude,omitempty"`
+	Version           string       `json:"version"`
+	SupportedVersions []string     `json:"supportedVersions"`
+	DomainFilter      DomainFilter `json:"domainFilter"`
 }
 
 // RecordsResponse is the response for the GET /records endpoint
@@ -56,4 +163,22 @@ type AdjustEndpointsResponse struct {
 // HealthResponse is the response for the health check endpoint
 type HealthResponse struct {
 	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	// Missing role assignments found by the permission probe, for /readyz. They don't make the
+	// webhook unready, as resource groups it can manage are still served.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// Each dependency's status, only for /healthz?verbose=true
+	Dependencies []DependencyHealth `json:"dependencies,omitempty"`
+}
+
+// ErrorResponse is the body returned by webhook handlers when a request fails
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// Records of an ApplyChanges batch that failed, while the others were applied
+	Applied  int             `json:"applied,omitempty"`
+	Failures []ChangeFailure `json:"failures,omitempty"`
 }
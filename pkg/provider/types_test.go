@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEndpoint_RoundTripsUnknownFields(t *testing.T) {
+	input := `{"dnsName":"demo.example.com","targets":["1.2.3.4"],"recordType":"A","ownedRecord":"demo.example.com","aliasHint":{"zone":"example.com"}}`
+
+	var endpoint Endpoint
+	require.NoError(t, json.Unmarshal([]byte(input), &endpoint))
+	assert.Equal(t, "demo.example.com", endpoint.DNSName)
+	assert.Equal(t, []string{"aliasHint", "ownedRecord"}, unknownFields([]*Endpoint{&endpoint}))
+
+	output, err := json.Marshal([]*Endpoint{&endpoint})
+	require.NoError(t, err)
+	assert.JSONEq(t, "["+input+"]", string(output))
+}
+
+func TestEndpoint_MarshalWithoutExtra(t *testing.T) {
+	output, err := json.Marshal(Endpoint{DNSName: "demo.example.com", Targets: []string{"1.2.3.4"}, RecordType: "A"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"dnsName":"demo.example.com","targets":["1.2.3.4"],"recordType":"A"}`, string(output))
+}
+
+func TestEndpoint_AnnotationMap(t *testing.T) {
+	endpoint := &Endpoint{
+		Labels: map[string]string{
+			"resource":                     "service/apps/demo",
+			annotations.AnnotationWeight:   "10",
+			annotations.AnnotationPriority: "5",
+		},
+		ProviderSpecific: []ProviderSpecificProperty{
+			{Name: annotations.AnnotationWeight, Value: "20"},
+			{Name: annotations.ResourceAnnotationPrefix + "resource-group", Value: "tm-rg"},
+		},
+	}
+
+	assert.Equal(t, map[string]string{
+		"resource":                          "service/apps/demo",
+		annotations.AnnotationWeight:        "20",
+		annotations.AnnotationPriority:      "5",
+		annotations.AnnotationResourceGroup: "tm-rg",
+	}, endpoint.annotationMap())
+}
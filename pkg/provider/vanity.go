@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/dnsendpoint"
+	"go.uber.org/zap"
+)
+
+// vanityRecord describes the record that points a vanity hostname at a Traffic Manager profile
+type vanityRecord struct {
+	Hostname       string // Vanity hostname (e.g., demo.example.com)
+	Target         string // Traffic Manager FQDN
+	SubscriptionID string // Subscription of the profile; empty means the default subscription
+	ProfileName    string
+	ResourceGroup  string
+	ProfileID      string // Traffic Manager profile resource ID (used for alias records)
+	RecordType     string // annotations.VanityRecordType*; empty means automatic
+	TTL            int64
+}
+
+// vanityTTL returns the TTL of the vanity record for a source endpoint: its own TTL when the
+// source sets one, otherwise the profile's DNS TTL
+func vanityTTL(config *annotations.TrafficManagerConfig, endpoint *Endpoint) int64 {
+	if endpoint.RecordTTL > 0 {
+		return endpoint.RecordTTL
+	}
+	if config.DNSTTL > 0 {
+		return config.DNSTTL
+	}
+	return defaultRecordTTL
+}
+
+// applyVanityRecords writes the queued vanity records in one batch using the configured mode.
+// Failures are logged but don't fail the whole operation; failed DNSEndpoint writes are
+// retried in the background by RunDNSEndpointRetries.
+func (p *TrafficManagerProvider) applyVanityRecords(ctx context.Context, pending map[string]vanityRecord) {
+	if len(pending) == 0 {
+		return
+	}
+
+	if p.vanityRecordMode == VanityRecordModeAzureDNS {
+		for _, record := range pending {
+			if err := p.azureDNSClient.UpsertVanityRecord(ctx, record.Hostname, record.Target, record.ProfileID, record.TTL, record.RecordType); err != nil {
+				p.log(ctx).Error("Failed to write Azure DNS record for vanity URL",
+					zap.String("vanityHostname", record.Hostname),
+					zap.String("trafficManagerFQDN", record.Target),
+					zap.Error(err))
+			}
+		}
+		return
+	}
+
+	records := make([]dnsendpoint.CNAMERecord, 0, len(pending))
+	for _, record := range pending {
+		records = append(records, dnsendpoint.CNAMERecord{
+			Name:           dnsendpoint.GenerateName(record.Hostname),
+			Hostname:       record.Hostname,
+			Target:         record.Target,
+			TTL:            record.TTL,
+			SubscriptionID: record.SubscriptionID,
+			ProfileName:    record.ProfileName,
+			ResourceGroup:  record.ResourceGroup,
+		})
+	}
+
+	if err := p.dnsEndpointManager.ApplyCNAMEs(ctx, records); err != nil {
+		p.log(ctx).Error("Failed to apply DNSEndpoints for vanity URLs",
+			zap.Int("count", len(records)),
+			zap.Error(err))
+		return
+	}
+
+	p.log(ctx).Info("Successfully applied DNSEndpoints for vanity URLs",
+		zap.Int("count", len(records)))
+}
+
+// deleteVanityRecord removes the record for a vanity hostname using the configured mode.
+// Failures are logged but don't fail the whole operation; failed DNSEndpoint deletes are
+// retried in the background by RunDNSEndpointRetries.
+func (p *TrafficManagerProvider) deleteVanityRecord(ctx context.Context, vanityHostname, recordType string) {
+	if p.vanityRecordMode == VanityRecordModeAzureDNS {
+		if err := p.azureDNSClient.DeleteVanityRecord(ctx, vanityHostname, recordType); err != nil {
+			p.log(ctx).Warn("Failed to delete Azure DNS record for vanity URL",
+				zap.String("vanityHostname", vanityHostname),
+				zap.Error(err))
+			return
+		}
+		p.log(ctx).Info("Successfully deleted Azure DNS record for vanity URL",
+			zap.String("vanityHostname", vanityHostname))
+		return
+	}
+
+	dnsEndpointName := dnsendpoint.GenerateName(vanityHostname)
+	if err := p.dnsEndpointManager.Delete(ctx, dnsEndpointName); err != nil {
+		p.log(ctx).Warn("Failed to delete DNSEndpoint for vanity URL",
+			zap.String("vanityHostname", vanityHostname),
+			zap.String("dnsEndpointName", dnsEndpointName),
+			zap.Error(err))
+		return
+	}
+
+	p.log(ctx).Info("Successfully deleted DNSEndpoint for vanity URL",
+		zap.String("vanityHostname", vanityHostname),
+		zap.String("dnsEndpointName", dnsEndpointName))
+}
+
+// checkVanityRecordType reports whether the vanity record type annotation can be honoured in
+// the configured vanity record mode. The annotation values match the azuredns record types.
+func (p *TrafficManagerProvider) checkVanityRecordType(recordType string) error {
+	if recordType == annotations.VanityRecordTypeAlias && p.vanityRecordMode != VanityRecordModeAzureDNS {
+		return fmt.Errorf("vanity record type %q requires vanity record mode %q", recordType, VanityRecordModeAzureDNS)
+	}
+	return nil
+}
+
+// ManagedDNSEndpoints lists the DNSEndpoints this webhook manages for vanity CNAMEs.
+// It returns an empty list when vanity records aren't written as DNSEndpoints.
+func (p *TrafficManagerProvider) ManagedDNSEndpoints(ctx context.Context) ([]dnsendpoint.ManagedEndpoint, error) {
+	if p.dnsEndpointManager == nil {
+		return []dnsendpoint.ManagedEndpoint{}, nil
+	}
+	return p.dnsEndpointManager.ListManaged(ctx)
+}
+
+// RunDNSEndpointRetries retries failed DNSEndpoint writes with backoff, checking every interval
+// until ctx is cancelled. It returns immediately if vanity records aren't written as DNSEndpoints.
+func (p *TrafficManagerProvider) RunDNSEndpointRetries(ctx context.Context, interval time.Duration) {
+	if p.dnsEndpointManager == nil {
+		return
+	}
+	p.dnsEndpointManager.RunRetries(ctx, interval)
+}
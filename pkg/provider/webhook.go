@@ -1,17 +1,33 @@
 package provider
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
 // WebhookServer handles HTTP requests for the webhook provider
 type WebhookServer struct {
 	provider *TrafficManagerProvider
 	logger   *zap.Logger
+
+	// Endpoint fields from newer External DNS versions that have already been reported
+	reportedFields sync.Map
+
+	drain drainState
+
+	// Limits on the size, decoding, duration and rate of webhook API requests
+	limits       RequestLimits
+	applyLimiter *rate.Limiter
 }
 
 // NewWebhookServer creates a new webhook server
@@ -24,147 +40,520 @@ func NewWebhookServer(provider *TrafficManagerProvider, logger *zap.Logger) *Web
 
 // HandleNegotiate handles GET / - Domain filter negotiation
 func (s *WebhookServer) HandleNegotiate(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("Handling negotiation request",
+	s.log(r).Info("Handling negotiation request",
 		zap.String("method", r.Method),
 		zap.String("path", r.URL.Path),
 	)
 
 	if r.Method != http.MethodGet {
-		s.logger.Warn("Invalid method for negotiation", zap.String("method", r.Method))
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.log(r).Warn("Invalid method for negotiation", zap.String("method", r.Method))
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	if !s.checkMediaType(w, r) {
 		return
 	}
 
+	exclude := s.provider.DomainFilterExclude()
+	if exclude == nil {
+		exclude = []string{}
+	}
 	response := NegotiationResponse{
-		Version: "1",
+		Include:           s.provider.DomainFilter(),
+		Exclude:           exclude,
+		Version:           webhookVersion,
+		SupportedVersions: SupportedVersions,
 		DomainFilter: DomainFilter{
-			Include: s.provider.domainFilter,
-			Exclude: []string{},
+			Include: s.provider.DomainFilter(),
+			Exclude: exclude,
 		},
 	}
 
-	w.Header().Set("Content-Type", "application/external.dns.webhook+json;version=1")
+	w.Header().Set("Content-Type", webhookContentType())
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		s.logger.Error("Failed to encode negotiation response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.log(r).Error("Failed to encode negotiation response", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
 		return
 	}
 
-	s.logger.Info("Negotiation response sent successfully", zap.Any("domainFilter", s.provider.domainFilter))
+	s.log(r).Info("Negotiation response sent successfully", zap.Any("domainFilter", response.DomainFilter))
 }
 
 // HandleHealth handles GET /healthz - Health check
+// It answers without checking anything, for liveness probes. With ?verbose=true it checks each
+// dependency and returns 503 when one has failed; a stale cache is reported as degraded.
 func (s *WebhookServer) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
 	response := HealthResponse{
 		Status: "healthy",
 	}
+	status := http.StatusOK
+	if verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose")); verbose {
+		response.Dependencies = s.provider.CheckDependencies(r.Context())
+		for _, dependency := range response.Dependencies {
+			switch dependency.Status {
+			case DependencyFailed:
+				response.Status = "unhealthy"
+				status = http.StatusServiceUnavailable
+			case DependencyStale:
+				if status == http.StatusOK {
+					response.Status = "degraded"
+				}
+			}
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		s.logger.Error("Failed to encode health response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.log(r).Error("Failed to encode health response", zap.Error(err))
+	}
+}
+
+// HandleReady handles GET /readyz - Readiness check
+// Unlike /healthz this verifies the Azure credential and Azure Resource Manager connectivity, and
+// lists the missing role assignments the permission probe found.
+func (s *WebhookServer) HandleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	response := HealthResponse{
+		Status: "ready",
+	}
+	status := http.StatusOK
+	if s.Draining() {
+		// Stop new traffic being routed here while requests already in flight complete
+		response.Status = "draining"
+		status = http.StatusServiceUnavailable
+	} else if err := s.provider.CheckReadiness(r.Context()); err != nil {
+		s.log(r).Warn("Readiness check failed", zap.Error(err))
+		response = HealthResponse{
+			Status: "not ready",
+			Error:  err.Error(),
+		}
+		status = http.StatusServiceUnavailable
+	}
+	response.Warnings = s.provider.PermissionWarnings()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.log(r).Error("Failed to encode readiness response", zap.Error(err))
+	}
+}
+
+// HandleDrain handles GET and POST /drain - Start draining and respond once the drain delay has passed.
+// GET is accepted because Kubernetes preStop httpGet hooks can only send GET.
+func (s *WebhookServer) HandleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	s.Drain()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(HealthResponse{Status: "draining"}); err != nil {
+		s.log(r).Error("Failed to encode drain response", zap.Error(err))
+	}
+}
+
+// FreezeBypassRequest is the body accepted by PUT /freeze
+type FreezeBypassRequest struct {
+	BypassFor string `json:"bypassFor"` // Duration such as "2h"
+}
+
+// HandleFreeze handles the change freeze admin endpoint:
+// GET returns the freeze status, PUT bypasses freeze windows for a duration and DELETE ends the bypass
+func (s *WebhookServer) HandleFreeze(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req FreezeBypassRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+			return
+		}
+		duration, err := time.ParseDuration(req.BypassFor)
+		if err != nil || duration <= 0 {
+			s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid bypassFor duration %q", req.BypassFor))
+			return
+		}
+		s.log(r).Warn("Change freeze bypassed via admin endpoint",
+			zap.Duration("bypassFor", duration),
+			zap.String("remoteAddr", r.RemoteAddr))
+		s.provider.SetFreezeBypass(s.provider.now().Add(duration))
+	case http.MethodDelete:
+		s.provider.SetFreezeBypass(time.Time{})
+	default:
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.provider.FreezeStatus()); err != nil {
+		s.log(r).Error("Failed to encode freeze status", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleDNSEndpoints handles GET /dnsendpoints - List DNSEndpoints managed for vanity CNAMEs
+func (s *WebhookServer) HandleDNSEndpoints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
+
+	managed, err := s.provider.ManagedDNSEndpoints(r.Context())
+	if err != nil {
+		s.log(r).Error("Failed to list managed DNSEndpoints", zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to list DNSEndpoints: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(managed); err != nil {
+		s.log(r).Error("Failed to encode DNSEndpoints", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleSilences handles GET /silences - List intentional removals currently silenced for alerting
+func (s *WebhookServer) HandleSilences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.provider.Silences()); err != nil {
+		s.log(r).Error("Failed to encode silences", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleQuotas handles GET /quotas - List per-namespace profile and endpoint quota usage
+func (s *WebhookServer) HandleQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.provider.QuotaUsage()); err != nil {
+		s.log(r).Error("Failed to encode quota usage", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleCanaries handles GET /canaries - List endpoints whose weight is being shifted in steps
+func (s *WebhookServer) HandleCanaries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.provider.Canaries()); err != nil {
+		s.log(r).Error("Failed to encode canaries", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleSchedules handles GET /schedules - List endpoints enabled and disabled by schedule annotations
+func (s *WebhookServer) HandleSchedules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.provider.ScheduledEndpoints()); err != nil {
+		s.log(r).Error("Failed to encode schedules", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleEndpointDrains handles GET /endpointdrains - List endpoints taken out of rotation and waiting to be deleted
+func (s *WebhookServer) HandleEndpointDrains(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.provider.EndpointDrains()); err != nil {
+		s.log(r).Error("Failed to encode endpoint drains", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleRolloutSetWeight handles POST /rollouts/setweight - Argo Rollouts traffic router SetWeight
+func (s *WebhookServer) HandleRolloutSetWeight(w http.ResponseWriter, r *http.Request) {
+	s.handleRolloutWeight(w, r, s.provider.SetRolloutWeight)
+}
+
+// HandleRolloutVerifyWeight handles POST /rollouts/verifyweight - Argo Rollouts traffic router VerifyWeight
+func (s *WebhookServer) HandleRolloutVerifyWeight(w http.ResponseWriter, r *http.Request) {
+	s.handleRolloutWeight(w, r, s.provider.VerifyRolloutWeight)
+}
+
+func (s *WebhookServer) handleRolloutWeight(w http.ResponseWriter, r *http.Request, call func(context.Context, RolloutWeightRequest) (*RolloutWeightResponse, error)) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req RolloutWeightRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+
+	response, err := call(r.Context(), req)
+	if err != nil {
+		s.log(r).Error("Rollout weight request failed", zap.String("profileName", req.ProfileName), zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Rollout weight request failed: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		s.log(r).Error("Failed to encode rollout weight response", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleHandoff handles POST /handoff - Re-record endpoints created by one cluster as created by another.
+// Set dryRun to list the endpoints that would change without writing to Azure.
+func (s *WebhookServer) HandleHandoff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req HandoffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+
+	result, err := s.provider.Handoff(r.Context(), req)
+	if err != nil {
+		s.log(r).Error("Failed to hand off endpoints", zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to hand off endpoints: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.log(r).Error("Failed to encode handoff result", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// HandleSwap handles POST /swap - Cut a Priority or Weighted profile over from a blue endpoint to a green one,
+// rolling back if the green endpoint isn't Online
+func (s *WebhookServer) HandleSwap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	var req SwapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeError(w, ErrorCodeInvalidRequest, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+
+	// Verification can outlast the server's write timeout
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	result, err := s.provider.SwapEndpoints(r.Context(), req)
+	if err != nil {
+		s.log(r).Error("Failed to swap endpoints", zap.String("profileName", req.ProfileName), zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to swap endpoints: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		s.log(r).Error("Failed to encode swap result", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
 }
 
 // HandleRecords handles GET /records and POST /records
 func (s *WebhookServer) HandleRecords(w http.ResponseWriter, r *http.Request) {
+	if !s.checkMediaType(w, r) {
+		return
+	}
+
+	r, cancel := s.withRequestTimeout(r)
+	defer cancel()
+
 	switch r.Method {
 	case http.MethodGet:
 		s.handleGetRecords(w, r)
 	case http.MethodPost:
 		s.handleApplyChanges(w, r)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
 	}
 }
 
 // handleGetRecords handles GET /records - Get current records
 func (s *WebhookServer) handleGetRecords(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("Handling get records request")
+	s.log(r).Info("Handling get records request")
 
 	endpoints, err := s.provider.Records(r.Context())
 	if err != nil {
-		s.logger.Error("Failed to get records", zap.Error(err))
-		http.Error(w, fmt.Sprintf("Failed to get records: %v", err), http.StatusInternalServerError)
+		s.log(r).Error("Failed to get records", zap.String("code", errorCode(err)), zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to get records: %v", err))
 		return
 	}
 
-	// Return endpoints array directly, not wrapped in an object
-	w.Header().Set("Content-Type", "application/external.dns.webhook+json;version=1")
+	// Return endpoints array directly, not wrapped in an object, and never null
+	if endpoints == nil {
+		endpoints = []*Endpoint{}
+	}
+	w.Header().Set("Content-Type", webhookContentType())
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(endpoints); err != nil {
-		s.logger.Error("Failed to encode records response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.log(r).Error("Failed to encode records response", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
 		return
 	}
 
-	s.logger.Info("Successfully returned records", zap.Int("count", len(endpoints)))
+	s.log(r).Info("Successfully returned records", zap.Int("count", len(endpoints)))
 }
 
 // handleApplyChanges handles POST /records - Apply changes
 func (s *WebhookServer) handleApplyChanges(w http.ResponseWriter, r *http.Request) {
-	s.logger.Info("Handling apply changes request")
+	s.log(r).Info("Handling apply changes request")
+
+	if !s.allowApply(w, r) {
+		return
+	}
 
 	var changes Changes
-	if err := json.NewDecoder(r.Body).Decode(&changes); err != nil {
-		s.logger.Error("Failed to decode changes request", zap.Error(err))
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	if !s.decodeBody(w, r, &changes) {
 		return
 	}
 
-	s.logger.Info("Parsed changes",
+	s.reportUnknownFields(r, changes.Create, changes.UpdateOld, changes.UpdateNew, changes.Delete)
+
+	s.log(r).Info("Parsed changes",
 		zap.Int("create", len(changes.Create)),
 		zap.Int("updateOld", len(changes.UpdateOld)),
 		zap.Int("updateNew", len(changes.UpdateNew)),
 		zap.Int("delete", len(changes.Delete)))
 
 	if err := s.provider.ApplyChanges(r.Context(), &changes); err != nil {
-		s.logger.Error("Failed to apply changes", zap.Error(err))
-		http.Error(w, fmt.Sprintf("Failed to apply changes: %v", err), http.StatusInternalServerError)
+		s.log(r).Error("Failed to apply changes", zap.String("code", errorCode(err)), zap.Error(err))
+		resp := ErrorResponse{Code: errorCode(err), Message: fmt.Sprintf("Failed to apply changes: %v", err)}
+		var applyErr *ApplyError
+		if errors.As(err, &applyErr) {
+			resp.Applied = applyErr.Applied
+			resp.Failures = applyErr.Failures
+		}
+		s.writeErrorResponse(w, resp)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-	s.logger.Info("Successfully applied changes")
+	s.log(r).Info("Successfully applied changes")
 }
 
 // HandleAdjustEndpoints handles POST /adjustendpoints
 func (s *WebhookServer) HandleAdjustEndpoints(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
 		return
 	}
 
-	s.logger.Info("Handling adjust endpoints request")
+	if !s.checkMediaType(w, r) {
+		return
+	}
+
+	s.log(r).Info("Handling adjust endpoints request")
+
+	r, cancel := s.withRequestTimeout(r)
+	defer cancel()
 
 	// External-DNS sends endpoints array directly, not wrapped in an object
 	var endpoints []*Endpoint
-	if err := json.NewDecoder(r.Body).Decode(&endpoints); err != nil {
-		s.logger.Error("Failed to decode adjust endpoints request", zap.Error(err))
-		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+	if !s.decodeBody(w, r, &endpoints) {
 		return
 	}
 
-	s.logger.Info("Received endpoints to adjust", zap.Int("count", len(endpoints)))
+	s.log(r).Info("Received endpoints to adjust", zap.Int("count", len(endpoints)))
+	s.reportUnknownFields(r, endpoints)
 
-	// Adjust endpoints with Traffic Manager annotations
-	// Convert service A records to CNAME records pointing to Traffic Manager profiles
 	adjustedEndpoints := s.provider.AdjustEndpoints(r.Context(), endpoints)
-	
-	w.Header().Set("Content-Type", "application/external.dns.webhook+json;version=1")
+
+	w.Header().Set("Content-Type", webhookContentType())
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(adjustedEndpoints); err != nil {
-		s.logger.Error("Failed to encode adjust endpoints response", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		s.log(r).Error("Failed to encode adjust endpoints response", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
 		return
 	}
 
-	s.logger.Info("Successfully adjusted endpoints", zap.Int("returned", len(adjustedEndpoints)))
+	s.log(r).Info("Successfully adjusted endpoints", zap.Int("returned", len(adjustedEndpoints)))
+}
+
+// HandlePlan handles POST /plan - Return the Traffic Manager operations a Changes body would
+// trigger, without applying them
+func (s *WebhookServer) HandlePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, ErrorCodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	r, cancel := s.withRequestTimeout(r)
+	defer cancel()
+
+	var changes Changes
+	if !s.decodeBody(w, r, &changes) {
+		return
+	}
+
+	plan, err := s.provider.PlanChanges(r.Context(), &changes)
+	if err != nil {
+		s.log(r).Error("Failed to plan changes", zap.Error(err))
+		s.writeError(w, errorCode(err), fmt.Sprintf("Failed to plan changes: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		s.log(r).Error("Failed to encode plan", zap.Error(err))
+		s.writeError(w, ErrorCodeInternal, "Internal server error")
+	}
+}
+
+// reportUnknownFields logs, once per field, endpoint fields this webhook doesn't understand.
+// They are passed back unchanged from AdjustEndpoints but have no effect on Traffic Manager,
+// so a new External DNS version relying on them needs a webhook upgrade.
+func (s *WebhookServer) reportUnknownFields(r *http.Request, endpoints ...[]*Endpoint) {
+	for _, name := range unknownFields(endpoints...) {
+		if _, reported := s.reportedFields.LoadOrStore(name, true); !reported {
+			s.log(r).Warn("External DNS sent an endpoint field this webhook doesn't support; it is ignored",
+				zap.String("field", name))
+		}
+	}
+}
+
+// log returns the server logger with the request ID of r attached
+func (s *WebhookServer) log(r *http.Request) *zap.Logger {
+	return logging.FromContext(r.Context(), s.logger)
 }
@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultWebhookAuthHeader is the header carrying the webhook token unless configured otherwise
+const DefaultWebhookAuthHeader = "Authorization"
+
+// WebhookToken is the token webhook API requests must carry. In the Authorization header it is
+// sent as a bearer token; in any other header it is sent as is. A token read from a file mounted
+// from a Kubernetes Secret is read again by Watch when the secret rotates.
+type WebhookToken struct {
+	header string
+	path   string
+
+	mu       sync.RWMutex
+	expected []byte
+}
+
+// NewWebhookToken returns the token required in header, read from path when it is set and
+// otherwise token. The admin API's token is one too, always in the Authorization header.
+func NewWebhookToken(header, token, path string) (*WebhookToken, error) {
+	if header == "" {
+		header = DefaultWebhookAuthHeader
+	}
+	t := &WebhookToken{header: http.CanonicalHeaderKey(header), path: path}
+	if path == "" {
+		if token == "" {
+			return nil, errors.New("token is empty")
+		}
+		t.set(token)
+		return t, nil
+	}
+	if _, err := t.Reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reload reads the token file again, reporting whether the token changed. On error the previous
+// token is kept.
+func (t *WebhookToken) Reload() (bool, error) {
+	if t.path == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read token file %s: %w", t.path, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return false, fmt.Errorf("token file %s is empty", t.path)
+	}
+
+	expected := t.expectedValue(token)
+	t.mu.RLock()
+	unchanged := subtle.ConstantTimeCompare(expected, t.expected) == 1
+	t.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	t.set(token)
+	return true, nil
+}
+
+// Watch reads the token file every interval until ctx is cancelled. It returns immediately if the
+// token isn't read from a file.
+func (t *WebhookToken) Watch(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	if t.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := t.Reload()
+			if err != nil {
+				// The secret can be briefly missing mid-rotation; keep the old token and retry
+				logger.Warn("Failed to reload token", zap.String("path", t.path), zap.Error(err))
+				continue
+			}
+			if reloaded {
+				logger.Info("Reloaded token after mounted secret changed", zap.String("path", t.path))
+			}
+		}
+	}
+}
+
+// valid reports whether r carries the token
+func (t *WebhookToken) valid(r *http.Request) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(t.header)), t.expected) == 1
+}
+
+func (t *WebhookToken) set(token string) {
+	expected := t.expectedValue(token)
+	t.mu.Lock()
+	t.expected = expected
+	t.mu.Unlock()
+}
+
+// expectedValue returns the header value carrying token
+func (t *WebhookToken) expectedValue(token string) []byte {
+	if t.header == DefaultWebhookAuthHeader {
+		return []byte("Bearer " + token)
+	}
+	return []byte(token)
+}
+
+// RequireWebhookToken rejects requests to next that don't carry token
+func (s *WebhookServer) RequireWebhookToken(token *WebhookToken, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !token.valid(r) {
+			s.log(r).Warn("Rejected webhook request without a valid token",
+				zap.String("path", r.URL.Path),
+				zap.String("remoteAddr", r.RemoteAddr))
+			if token.header == DefaultWebhookAuthHeader {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			s.writeError(w, ErrorCodeUnauthorized, fmt.Sprintf("A valid token is required in the %s header", token.header))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func serveWithToken(s *WebhookServer, token *WebhookToken, header, value string) *httptest.ResponseRecorder {
+	handler := s.RequireWebhookToken(token, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/records", nil)
+	if value != "" {
+		req.Header.Set(header, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRequireWebhookToken(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+
+	t.Run("bearer token", func(t *testing.T) {
+		token, err := NewWebhookToken("", "s3cret", "")
+		require.NoError(t, err)
+
+		for _, value := range []string{"", "Bearer wrong", "s3cret"} {
+			rec := serveWithToken(s, token, "Authorization", value)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, "Authorization: %q", value)
+			assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+		}
+		assert.Equal(t, http.StatusNoContent, serveWithToken(s, token, "Authorization", "Bearer s3cret").Code)
+	})
+
+	t.Run("shared secret header", func(t *testing.T) {
+		token, err := NewWebhookToken("x-webhook-token", "s3cret", "")
+		require.NoError(t, err)
+
+		rec := serveWithToken(s, token, "X-Webhook-Token", "Bearer s3cret")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, http.StatusUnauthorized, serveWithToken(s, token, "Authorization", "Bearer s3cret").Code)
+		assert.Equal(t, http.StatusNoContent, serveWithToken(s, token, "X-Webhook-Token", "s3cret").Code)
+	})
+}
+
+func TestWebhookToken_File(t *testing.T) {
+	s := NewWebhookServer(&TrafficManagerProvider{logger: zaptest.NewLogger(t)}, zaptest.NewLogger(t))
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("first\n"), 0o600))
+
+	token, err := NewWebhookToken("", "ignored", path)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, serveWithToken(s, token, "Authorization", "Bearer first").Code, "the file takes precedence and is trimmed")
+	assert.Equal(t, http.StatusUnauthorized, serveWithToken(s, token, "Authorization", "Bearer ignored").Code)
+
+	reloaded, err := token.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "unchanged file")
+
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0o600))
+	reloaded, err = token.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, http.StatusNoContent, serveWithToken(s, token, "Authorization", "Bearer second").Code)
+
+	// A missing or empty file keeps the rotated token
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	_, err = token.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNoContent, serveWithToken(s, token, "Authorization", "Bearer second").Code)
+
+	_, err = NewWebhookToken("", "", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+	_, err = NewWebhookToken("", "", "")
+	assert.Error(t, err)
+}
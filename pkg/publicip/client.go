@@ -0,0 +1,172 @@
+package publicip
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	// apiVersion of the Microsoft.Network publicIPAddresses API
+	apiVersion = "2023-09-01"
+
+	// cacheTTL is how long the listed addresses are used before they are listed again
+	cacheTTL = 5 * time.Minute
+
+	// missRefreshInterval is how soon an address that isn't listed causes the list to be refreshed,
+	// so a public IP created moments ago is found without listing on every lookup
+	missRefreshInterval = 30 * time.Second
+)
+
+// Address is a public IP address resource
+type Address struct {
+	ID       string // Resource ID, which an AzureEndpoint references
+	IP       string
+	FQDN     string // From the DNS name label; Traffic Manager needs one to use the address in an AzureEndpoint
+	Location string
+}
+
+// Client finds the public IP address resources of a subscription by their address. Addresses
+// are listed once for the whole subscription and cached, as a LoadBalancer Service's address
+// doesn't say which resource group its public IP is in.
+type Client struct {
+	list   func(ctx context.Context) ([]Address, error)
+	logger *zap.Logger
+
+	mu       sync.Mutex
+	byIP     map[string]Address
+	listedAt time.Time
+	now      func() time.Time
+}
+
+// NewClient creates a client for the public IP addresses of a subscription
+func NewClient(subscriptionID string, credential azcore.TokenCredential, options *arm.ClientOptions, logger *zap.Logger) (*Client, error) {
+	if subscriptionID == "" {
+		return nil, fmt.Errorf("subscription ID is required")
+	}
+
+	armClient, err := arm.NewClient("publicip", "v1.0.0", credential, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create public IP client: %w", err)
+	}
+
+	firstPage := runtime.JoinPaths(armClient.Endpoint(),
+		"/subscriptions/"+url.PathEscape(subscriptionID)+"/providers/Microsoft.Network/publicIPAddresses") +
+		"?api-version=" + apiVersion
+
+	return newClient(func(ctx context.Context) ([]Address, error) {
+		return listAddresses(ctx, armClient.Pipeline(), firstPage)
+	}, logger), nil
+}
+
+func newClient(list func(ctx context.Context) ([]Address, error), logger *zap.Logger) *Client {
+	return &Client{list: list, logger: logger, now: time.Now}
+}
+
+// Lookup returns the public IP address resource with address ip; ok is false when the
+// subscription has none
+func (c *Client) Lookup(ctx context.Context, ip string) (address Address, ok bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := c.now().Sub(c.listedAt)
+	if c.byIP == nil || age >= cacheTTL {
+		if err := c.refresh(ctx); err != nil {
+			return Address{}, false, err
+		}
+	} else if _, listed := c.byIP[ip]; !listed && age >= missRefreshInterval {
+		if err := c.refresh(ctx); err != nil {
+			return Address{}, false, err
+		}
+	}
+
+	address, ok = c.byIP[ip]
+	return address, ok, nil
+}
+
+// refresh lists the addresses again; c.mu must be held
+func (c *Client) refresh(ctx context.Context) error {
+	addresses, err := c.list(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.byIP = make(map[string]Address, len(addresses))
+	for _, address := range addresses {
+		if address.IP != "" {
+			c.byIP[address.IP] = address
+		}
+	}
+	c.listedAt = c.now()
+
+	logging.FromContext(ctx, c.logger).Debug("Listed public IP addresses",
+		zap.Int("count", len(c.byIP)))
+	return nil
+}
+
+// publicIPAddressList is a page of the publicIPAddresses list API
+type publicIPAddressList struct {
+	Value []struct {
+		ID         string `json:"id"`
+		Location   string `json:"location"`
+		Properties struct {
+			IPAddress   string `json:"ipAddress"`
+			DNSSettings *struct {
+				FQDN string `json:"fqdn"`
+			} `json:"dnsSettings"`
+		} `json:"properties"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+// listAddresses follows the pages of the publicIPAddresses list API from firstPage
+func listAddresses(ctx context.Context, pipeline runtime.Pipeline, firstPage string) ([]Address, error) {
+	var addresses []Address
+	for next := firstPage; next != ""; {
+		req, err := runtime.NewRequest(ctx, http.MethodGet, next)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := pipeline.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list public IP addresses: %w", err)
+		}
+		if !runtime.HasStatusCode(resp, http.StatusOK) {
+			return nil, fmt.Errorf("failed to list public IP addresses: %w", runtime.NewResponseError(resp))
+		}
+
+		var page publicIPAddressList
+		if err := runtime.UnmarshalAsJSON(resp, &page); err != nil {
+			return nil, fmt.Errorf("failed to read public IP addresses: %w", err)
+		}
+		addresses = append(addresses, page.addresses()...)
+		next = page.NextLink
+	}
+	return addresses, nil
+}
+
+func (l publicIPAddressList) addresses() []Address {
+	addresses := make([]Address, 0, len(l.Value))
+	for _, item := range l.Value {
+		address := Address{
+			ID:       item.ID,
+			IP:       item.Properties.IPAddress,
+			Location: strings.ToLower(strings.ReplaceAll(item.Location, " ", "")),
+		}
+		if item.Properties.DNSSettings != nil {
+			address.FQDN = item.Properties.DNSSettings.FQDN
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
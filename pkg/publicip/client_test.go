@@ -0,0 +1,94 @@
+package publicip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPublicIPAddressList_Addresses(t *testing.T) {
+	var page publicIPAddressList
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"value": [
+			{
+				"id": "/subscriptions/sub/resourceGroups/mc_rg/providers/Microsoft.Network/publicIPAddresses/kubernetes-a1",
+				"location": "eastus",
+				"properties": {"ipAddress": "20.30.40.50", "dnsSettings": {"fqdn": "app-east.eastus.cloudapp.azure.com"}}
+			},
+			{
+				"id": "/subscriptions/sub/resourceGroups/mc_rg/providers/Microsoft.Network/publicIPAddresses/unassigned",
+				"location": "West Europe",
+				"properties": {}
+			}
+		],
+		"nextLink": "https://management.azure.com/next"
+	}`), &page))
+
+	assert.Equal(t, []Address{
+		{
+			ID:       "/subscriptions/sub/resourceGroups/mc_rg/providers/Microsoft.Network/publicIPAddresses/kubernetes-a1",
+			IP:       "20.30.40.50",
+			FQDN:     "app-east.eastus.cloudapp.azure.com",
+			Location: "eastus",
+		},
+		{
+			ID:       "/subscriptions/sub/resourceGroups/mc_rg/providers/Microsoft.Network/publicIPAddresses/unassigned",
+			Location: "westeurope",
+		},
+	}, page.addresses())
+	assert.Equal(t, "https://management.azure.com/next", page.NextLink)
+}
+
+func TestClient_Lookup(t *testing.T) {
+	listed := []Address{{ID: "ip-1", IP: "20.30.40.50"}}
+	lists := 0
+	c := newClient(func(ctx context.Context) ([]Address, error) {
+		lists++
+		return listed, nil
+	}, zaptest.NewLogger(t))
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	address, ok, err := c.Lookup(ctx, "20.30.40.50")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "ip-1", address.ID)
+
+	// A miss right after listing doesn't list again
+	_, ok, err = c.Lookup(ctx, "20.30.40.51")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 1, lists)
+
+	// A later miss does, and finds the new address
+	listed = append(listed, Address{ID: "ip-2", IP: "20.30.40.51"})
+	now = now.Add(missRefreshInterval)
+	address, ok, err = c.Lookup(ctx, "20.30.40.51")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "ip-2", address.ID)
+	assert.Equal(t, 2, lists)
+
+	// Hits use the cache until it expires
+	_, _, _ = c.Lookup(ctx, "20.30.40.50")
+	assert.Equal(t, 2, lists)
+	now = now.Add(cacheTTL)
+	_, _, _ = c.Lookup(ctx, "20.30.40.50")
+	assert.Equal(t, 3, lists)
+}
+
+func TestClient_LookupError(t *testing.T) {
+	c := newClient(func(ctx context.Context) ([]Address, error) {
+		return nil, errors.New("forbidden")
+	}, zaptest.NewLogger(t))
+
+	_, _, err := c.Lookup(context.Background(), "20.30.40.50")
+	assert.EqualError(t, err, "forbidden")
+}
@@ -1,48 +1,110 @@
 package state
 
 import (
+	"container/list"
 	"sync"
 	"time"
 
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
 	"go.uber.org/zap"
 )
 
-// Manager manages the state of Traffic Manager profiles
+// Manager manages the state of Traffic Manager profiles. Stored profiles are never modified in
+// place, only replaced, so snapshots can share them with the cache.
 type Manager struct {
 	profiles map[string]*ProfileState // Map of hostname to profile state
 	mu       sync.RWMutex
 	logger   *zap.Logger
 	cacheTTL time.Duration
+
+	// Least recently used order, for evicting profiles beyond maxEntries (0 is unbounded)
+	maxEntries int
+	recency    *list.List               // Hostnames, most recently used first
+	elements   map[string]*list.Element // Each hostname's place in recency
+
+	// Approximate memory used by each profile, and in total
+	sizes map[string]int
+	bytes int
+
+	// Expired profiles are served for up to staleFor while refresh reads them again; nil disables
+	staleFor     time.Duration
+	refresh      RefreshFunc
+	revalidating map[string]bool // Hostnames being refreshed
 }
 
+// RefreshFunc reads a cached profile from its source again. It returns nil when the profile no
+// longer exists.
+type RefreshFunc func(cached *ProfileState) (*ProfileState, error)
+
 // NewManager creates a new state manager
 func NewManager(cacheTTL time.Duration, logger *zap.Logger) *Manager {
 	return &Manager{
 		profiles: make(map[string]*ProfileState),
 		logger:   logger,
 		cacheTTL: cacheTTL,
+		recency:  list.New(),
+		elements: make(map[string]*list.Element),
+		sizes:    make(map[string]int),
+
+		revalidating: make(map[string]bool),
 	}
 }
 
+// SetRevalidation makes GetProfile return a profile for up to staleFor past its TTL while
+// refresh reads it again in the background, so callers don't wait for it when it expires
+func (m *Manager) SetRevalidation(staleFor time.Duration, refresh RefreshFunc) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.staleFor = staleFor
+	m.refresh = refresh
+}
+
+// SetMaxEntries bounds the cache to max profiles, evicting the least recently used ones beyond
+// it. 0 leaves it unbounded.
+func (m *Manager) SetMaxEntries(max int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.maxEntries = max
+	m.evict()
+}
+
 // GetProfile retrieves a profile by hostname
 func (m *Manager) GetProfile(hostname string) (*ProfileState, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
+	profile, ok := m.GetProfileSnapshot(hostname)
+	if !ok {
+		return nil, false
+	}
+	return profile.Clone(), true
+}
+
+// GetProfileSnapshot is GetProfile without the copy, for hot paths that only read the profile.
+// The profile is shared with the cache and must not be modified.
+func (m *Manager) GetProfileSnapshot(hostname string) (*ProfileState, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
 	profile, exists := m.profiles[hostname]
 	if !exists {
 		return nil, false
 	}
 
-	// Check if cache is expired
+	// Check if cache is expired; a stale profile is served while it is refreshed
 	if profile.IsExpired(m.cacheTTL) {
-		m.logger.Debug("Profile cache expired",
-			zap.String("hostname", hostname),
-			zap.Time("cachedAt", profile.CachedAt))
-		return nil, false
+		if m.refresh == nil || profile.IsExpired(m.cacheTTL+m.staleFor) {
+			m.logger.Debug("Profile cache expired",
+				zap.String("hostname", hostname),
+				zap.Time("cachedAt", profile.CachedAt))
+			return nil, false
+		}
+		m.revalidate(hostname, profile)
 	}
 
-	return profile.Clone(), true
+	if element, ok := m.elements[hostname]; ok {
+		m.recency.MoveToFront(element)
+	}
+	return profile, true
 }
 
 // SetProfile stores or updates a profile
@@ -51,7 +113,8 @@ func (m *Manager) SetProfile(hostname string, profile *ProfileState) {
 	defer m.mu.Unlock()
 
 	profile.CachedAt = time.Now()
-	m.profiles[hostname] = profile.Clone()
+	m.store(hostname, profile.Clone())
+	m.evict()
 
 	m.logger.Debug("Profile state updated",
 		zap.String("hostname", hostname),
@@ -64,7 +127,7 @@ func (m *Manager) DeleteProfile(hostname string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	delete(m.profiles, hostname)
+	m.remove(hostname)
 
 	m.logger.Debug("Profile state deleted",
 		zap.String("hostname", hostname))
@@ -72,17 +135,118 @@ func (m *Manager) DeleteProfile(hostname string) {
 
 // ListProfiles returns all profiles
 func (m *Manager) ListProfiles() []*ProfileState {
+	profiles := m.ListProfileSnapshots()
+	for i, profile := range profiles {
+		profiles[i] = profile.Clone()
+	}
+	return profiles
+}
+
+// ListProfileSnapshots is ListProfiles without copying the profiles, for hot paths that only
+// read them. The profiles are shared with the cache and must not be modified.
+func (m *Manager) ListProfileSnapshots() []*ProfileState {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	profiles := make([]*ProfileState, 0, len(m.profiles))
 	for _, profile := range m.profiles {
-		profiles = append(profiles, profile.Clone())
+		profiles = append(profiles, profile)
 	}
 
 	return profiles
 }
 
+// revalidate refreshes the stale profile of hostname in the background, unless it is already
+// being refreshed. The caller must hold the write lock.
+func (m *Manager) revalidate(hostname string, stale *ProfileState) {
+	if m.revalidating[hostname] {
+		return
+	}
+	m.revalidating[hostname] = true
+	refresh := m.refresh
+
+	go func() {
+		fresh, err := refresh(stale.Clone())
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.revalidating, hostname)
+
+		if err != nil {
+			m.logger.Warn("Failed to refresh stale profile",
+				zap.String("hostname", hostname),
+				zap.Error(err))
+			return
+		}
+		// A write since the refresh started is newer than what it read
+		if current, ok := m.profiles[hostname]; !ok || current != stale {
+			return
+		}
+		if fresh == nil {
+			m.remove(hostname)
+			return
+		}
+
+		fresh = fresh.Clone()
+		fresh.Hostname = hostname
+		fresh.CachedAt = time.Now()
+		m.store(hostname, fresh)
+		m.evict()
+
+		m.logger.Debug("Refreshed stale profile",
+			zap.String("hostname", hostname))
+	}()
+}
+
+// store puts profile in the cache as the most recently used. The caller must hold the write lock.
+func (m *Manager) store(hostname string, profile *ProfileState) {
+	m.profiles[hostname] = profile
+	if element, ok := m.elements[hostname]; ok {
+		m.recency.MoveToFront(element)
+	} else {
+		m.elements[hostname] = m.recency.PushFront(hostname)
+	}
+
+	size := profile.approximateSize()
+	m.bytes += size - m.sizes[hostname]
+	m.sizes[hostname] = size
+	m.updateMetrics()
+}
+
+// remove drops hostname from the cache. The caller must hold the write lock.
+func (m *Manager) remove(hostname string) {
+	delete(m.profiles, hostname)
+	if element, ok := m.elements[hostname]; ok {
+		m.recency.Remove(element)
+		delete(m.elements, hostname)
+	}
+	m.bytes -= m.sizes[hostname]
+	delete(m.sizes, hostname)
+	m.updateMetrics()
+}
+
+// evict removes the least recently used profiles beyond maxEntries. The caller must hold the
+// write lock.
+func (m *Manager) evict() {
+	if m.maxEntries <= 0 {
+		return
+	}
+	for m.recency.Len() > m.maxEntries {
+		hostname := m.recency.Back().Value.(string)
+		m.remove(hostname)
+		metrics.StateCacheEvictions.Inc()
+
+		m.logger.Debug("Evicted least recently used profile from state",
+			zap.String("hostname", hostname))
+	}
+}
+
+// updateMetrics reports the cache's size. The caller must hold the write lock.
+func (m *Manager) updateMetrics() {
+	metrics.StateCacheProfiles.Set(float64(len(m.profiles)))
+	metrics.StateCacheBytes.Set(float64(m.bytes))
+}
+
 // GetProfileByName retrieves a profile by its Traffic Manager profile name
 func (m *Manager) GetProfileByName(profileName string) (*ProfileState, bool) {
 	m.mu.RLock()
@@ -103,10 +267,32 @@ func (m *Manager) Clear() {
 	defer m.mu.Unlock()
 
 	m.profiles = make(map[string]*ProfileState)
+	m.recency.Init()
+	m.elements = make(map[string]*list.Element)
+	m.sizes = make(map[string]int)
+	m.bytes = 0
+	m.updateMetrics()
 
 	m.logger.Debug("State cleared")
 }
 
+// Ages returns how long ago each cached profile was stored, by hostname, and how many are past
+// the cache TTL
+func (m *Manager) Ages(now time.Time) (map[string]time.Duration, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ages := make(map[string]time.Duration, len(m.profiles))
+	expired := 0
+	for hostname, profile := range m.profiles {
+		ages[hostname] = now.Sub(profile.CachedAt)
+		if ages[hostname] > m.cacheTTL {
+			expired++
+		}
+	}
+	return ages, expired
+}
+
 // Count returns the number of profiles in state
 func (m *Manager) Count() int {
 	m.mu.RLock()
@@ -143,13 +329,11 @@ func (m *Manager) SetEndpoint(hostname, endpointName string, endpoint *EndpointS
 		return
 	}
 
-	if profile.Endpoints == nil {
-		profile.Endpoints = make(map[string]*EndpointState)
-	}
-
-	profile.Endpoints[endpointName] = endpoint.Clone()
-	profile.UpdatedAt = time.Now()
-	profile.CachedAt = time.Now()
+	updated := profile.withEndpoints()
+	updated.Endpoints[endpointName] = endpoint.Clone()
+	updated.UpdatedAt = time.Now()
+	updated.CachedAt = time.Now()
+	m.store(hostname, updated)
 
 	m.logger.Debug("Endpoint state updated",
 		zap.String("hostname", hostname),
@@ -166,9 +350,11 @@ func (m *Manager) DeleteEndpoint(hostname, endpointName string) {
 		return
 	}
 
-	delete(profile.Endpoints, endpointName)
-	profile.UpdatedAt = time.Now()
-	profile.CachedAt = time.Now()
+	updated := profile.withEndpoints()
+	delete(updated.Endpoints, endpointName)
+	updated.UpdatedAt = time.Now()
+	updated.CachedAt = time.Now()
+	m.store(hostname, updated)
 
 	m.logger.Debug("Endpoint state deleted",
 		zap.String("hostname", hostname),
@@ -195,5 +381,7 @@ func (m *Manager) GetStats() map[string]interface{} {
 		"totalEndpoints":   totalEndpoints,
 		"expiredProfiles":  expiredProfiles,
 		"cacheTTL":         m.cacheTTL.String(),
+		"maxProfiles":      m.maxEntries,
+		"approximateBytes": m.bytes,
 	}
 }
@@ -304,6 +304,7 @@ func TestProfileState_Clone(t *testing.T) {
 	original := &ProfileState{
 		ProfileName:   "test-profile",
 		ResourceGroup: "test-rg",
+		ResourceID:    "/subscriptions/sub/resourceGroups/test-rg/providers/Microsoft.Network/trafficManagerProfiles/test-profile",
 		Hostname:      "app.example.com",
 		FQDN:          "test.trafficmanager.net",
 		Endpoints: map[string]*EndpointState{
@@ -316,6 +317,7 @@ func TestProfileState_Clone(t *testing.T) {
 
 	// Verify values are equal
 	assert.Equal(t, original.ProfileName, cloned.ProfileName)
+	assert.Equal(t, original.ResourceID, cloned.ResourceID)
 	assert.Equal(t, original.Hostname, cloned.Hostname)
 
 	// Verify it's a deep clone
@@ -403,3 +405,138 @@ func TestProfileState_IsExpired(t *testing.T) {
 		})
 	}
 }
+
+func TestManager_MaxEntries(t *testing.T) {
+	manager := NewManager(5*time.Minute, zaptest.NewLogger(t))
+	manager.SetMaxEntries(2)
+
+	for _, hostname := range []string{"a.example.com", "b.example.com"} {
+		manager.SetProfile(hostname, &ProfileState{ProfileName: hostname, Hostname: hostname})
+	}
+
+	// Reading a makes b the least recently used
+	_, ok := manager.GetProfile("a.example.com")
+	require.True(t, ok)
+	manager.SetProfile("c.example.com", &ProfileState{ProfileName: "c", Hostname: "c.example.com"})
+
+	assert.Equal(t, 2, manager.Count())
+	_, ok = manager.GetProfile("b.example.com")
+	assert.False(t, ok, "the least recently used profile is evicted")
+	_, ok = manager.GetProfile("a.example.com")
+	assert.True(t, ok)
+
+	// Lowering the bound evicts straight away
+	manager.SetMaxEntries(1)
+	assert.Equal(t, 1, manager.Count())
+	_, ok = manager.GetProfile("a.example.com")
+	assert.True(t, ok)
+}
+
+func TestManager_ApproximateBytes(t *testing.T) {
+	manager := NewManager(5*time.Minute, zaptest.NewLogger(t))
+	assert.Equal(t, 0, manager.GetStats()["approximateBytes"])
+
+	manager.SetProfile("app.example.com", &ProfileState{ProfileName: "app", Hostname: "app.example.com"})
+	small := manager.GetStats()["approximateBytes"].(int)
+	assert.Positive(t, small)
+
+	manager.SetEndpoint("app.example.com", "east", &EndpointState{EndpointName: "east", Target: "east.example.com"})
+	assert.Greater(t, manager.GetStats()["approximateBytes"].(int), small)
+
+	manager.DeleteEndpoint("app.example.com", "east")
+	assert.Equal(t, small, manager.GetStats()["approximateBytes"])
+
+	manager.DeleteProfile("app.example.com")
+	assert.Equal(t, 0, manager.GetStats()["approximateBytes"])
+}
+
+func TestManager_SnapshotsAreNotChanged(t *testing.T) {
+	manager := NewManager(5*time.Minute, zaptest.NewLogger(t))
+	manager.SetProfile("app.example.com", &ProfileState{
+		ProfileName: "app",
+		Hostname:    "app.example.com",
+		Endpoints:   map[string]*EndpointState{"east": {EndpointName: "east", Weight: 100}},
+	})
+
+	snapshot, ok := manager.GetProfileSnapshot("app.example.com")
+	require.True(t, ok)
+	listed := manager.ListProfileSnapshots()
+	require.Len(t, listed, 1)
+	assert.Same(t, snapshot, listed[0], "snapshots share the cached profile")
+
+	manager.SetEndpoint("app.example.com", "west", &EndpointState{EndpointName: "west"})
+	manager.DeleteEndpoint("app.example.com", "east")
+
+	assert.Contains(t, snapshot.Endpoints, "east", "endpoint writes replace the cached profile")
+	assert.NotContains(t, snapshot.Endpoints, "west")
+
+	current, ok := manager.GetProfileSnapshot("app.example.com")
+	require.True(t, ok)
+	assert.NotContains(t, current.Endpoints, "east")
+	assert.Contains(t, current.Endpoints, "west")
+}
+
+func TestManager_StaleWhileRevalidate(t *testing.T) {
+	manager := NewManager(time.Minute, zaptest.NewLogger(t))
+
+	refreshed := make(chan string, 2)
+	release := make(chan struct{})
+	manager.SetRevalidation(time.Hour, func(cached *ProfileState) (*ProfileState, error) {
+		<-release
+		refreshed <- cached.ProfileName
+		if cached.ProfileName == "gone" {
+			return nil, nil
+		}
+		return &ProfileState{ProfileName: cached.ProfileName, RoutingMethod: "Priority"}, nil
+	})
+
+	stale := &ProfileState{ProfileName: "app", Hostname: "app.example.com", RoutingMethod: "Weighted"}
+	manager.SetProfile("app.example.com", stale)
+	expire := func(hostname string, age time.Duration) {
+		manager.mu.Lock()
+		manager.profiles[hostname].CachedAt = time.Now().Add(-age)
+		manager.mu.Unlock()
+	}
+	expire("app.example.com", 2*time.Minute)
+
+	// The stale profile is served, and only one refresh starts
+	for i := 0; i < 2; i++ {
+		profile, ok := manager.GetProfile("app.example.com")
+		require.True(t, ok)
+		assert.Equal(t, "Weighted", profile.RoutingMethod)
+	}
+	close(release)
+	assert.Equal(t, "app", <-refreshed)
+
+	assert.Eventually(t, func() bool {
+		profile, ok := manager.GetProfile("app.example.com")
+		return ok && profile.RoutingMethod == "Priority" && profile.Hostname == "app.example.com"
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, refreshed, "a fresh profile isn't refreshed")
+
+	// A profile that no longer exists is removed
+	manager.SetProfile("gone.example.com", &ProfileState{ProfileName: "gone", Hostname: "gone.example.com"})
+	expire("gone.example.com", 2*time.Minute)
+	_, ok := manager.GetProfile("gone.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "gone", <-refreshed)
+	assert.Eventually(t, func() bool { return manager.Count() == 1 }, time.Second, 10*time.Millisecond)
+
+	// Past the stale window the profile is a miss
+	expire("app.example.com", 2*time.Hour)
+	_, ok = manager.GetProfile("app.example.com")
+	assert.False(t, ok)
+}
+
+func TestManager_Ages(t *testing.T) {
+	manager := NewManager(5*time.Minute, zaptest.NewLogger(t))
+	manager.SetProfile("fresh.example.com", &ProfileState{ProfileName: "fresh-tm"})
+	manager.SetProfile("stale.example.com", &ProfileState{ProfileName: "stale-tm"})
+	manager.profiles["stale.example.com"].CachedAt = time.Now().Add(-10 * time.Minute)
+
+	ages, expired := manager.Ages(time.Now())
+	require.Len(t, ages, 2)
+	assert.Less(t, ages["fresh.example.com"], time.Minute)
+	assert.GreaterOrEqual(t, ages["stale.example.com"], 10*time.Minute)
+	assert.Equal(t, 1, expired)
+}
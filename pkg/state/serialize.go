@@ -0,0 +1,248 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// SchemaVersion is the snapshot format written by this build
+	SchemaVersion = 1
+
+	// MinReaderVersion is the oldest reader able to load snapshots written by this build.
+	// Bump it only for changes older readers would misinterpret; additive fields don't need it.
+	MinReaderVersion = 1
+)
+
+// snapshot is the versioned envelope for persisted state
+type snapshot struct {
+	SchemaVersion    int             `json:"schemaVersion"`
+	MinReaderVersion int             `json:"minReaderVersion"`
+	CreatedAt        time.Time       `json:"createdAt"`
+	Profiles         json.RawMessage `json:"profiles"`
+}
+
+// profileRecord is the persisted form of ProfileState (schema version 1)
+type profileRecord struct {
+	ProfileName   string            `json:"profileName"`
+	ResourceGroup string            `json:"resourceGroup"`
+	ResourceID    string            `json:"resourceId,omitempty"`
+	Hostname      string            `json:"hostname"`
+	FQDN          string            `json:"fqdn"`
+	RoutingMethod string            `json:"routingMethod"`
+	DNSTTL        int64             `json:"dnsTTL"`
+	Endpoints     []endpointRecord  `json:"endpoints,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+	CachedAt      time.Time         `json:"cachedAt"`
+
+	MonitorProtocol     string `json:"monitorProtocol,omitempty"`
+	MonitorPort         int64  `json:"monitorPort,omitempty"`
+	MonitorPath         string `json:"monitorPath,omitempty"`
+	HealthChecksEnabled *bool  `json:"healthChecksEnabled,omitempty"` // Missing from older snapshots, where it means true
+	TrafficViewEnabled  bool   `json:"trafficViewEnabled,omitempty"`
+	ProfileStatus       string `json:"profileStatus,omitempty"`
+}
+
+// endpointRecord is the persisted form of EndpointState (schema version 1)
+type endpointRecord struct {
+	EndpointName  string            `json:"endpointName"`
+	EndpointType  string            `json:"endpointType"`
+	Target        string            `json:"target"`
+	Weight        int64             `json:"weight"`
+	Priority      int64             `json:"priority"`
+	Status        string            `json:"status"`
+	MonitorStatus string            `json:"monitorStatus,omitempty"`
+	Location      string            `json:"location,omitempty"`
+	Metadata      *EndpointMetadata `json:"metadata,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+
+	TargetResourceID string            `json:"targetResourceId,omitempty"`
+	AlwaysServe      bool              `json:"alwaysServe,omitempty"`
+	CustomHeaders    map[string]string `json:"customHeaders,omitempty"`
+}
+
+// MarshalSnapshot serializes profiles into a versioned snapshot
+func MarshalSnapshot(profiles []*ProfileState) ([]byte, error) {
+	records := make([]profileRecord, 0, len(profiles))
+	for _, profile := range profiles {
+		records = append(records, toProfileRecord(profile))
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode profiles: %w", err)
+	}
+
+	return json.Marshal(snapshot{
+		SchemaVersion:    SchemaVersion,
+		MinReaderVersion: MinReaderVersion,
+		CreatedAt:        time.Now(),
+		Profiles:         data,
+	})
+}
+
+// UnmarshalSnapshot parses a versioned snapshot.
+// Snapshots from newer builds are accepted as long as their minReaderVersion allows it;
+// fields this build doesn't know about are ignored.
+func UnmarshalSnapshot(data []byte) ([]*ProfileState, error) {
+	var env snapshot
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	if env.SchemaVersion < 1 {
+		return nil, fmt.Errorf("snapshot has no schema version")
+	}
+	if env.MinReaderVersion > SchemaVersion {
+		return nil, fmt.Errorf("snapshot schema version %d requires reader version %d, this build supports %d",
+			env.SchemaVersion, env.MinReaderVersion, SchemaVersion)
+	}
+
+	// Older schema versions are migrated forward here before decoding; version 1 is the first format
+
+	var records []profileRecord
+	if err := json.Unmarshal(env.Profiles, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode profiles for schema version %d: %w", env.SchemaVersion, err)
+	}
+
+	profiles := make([]*ProfileState, 0, len(records))
+	for _, record := range records {
+		profiles = append(profiles, record.toProfileState())
+	}
+
+	return profiles, nil
+}
+
+// Snapshot serializes all profiles in the manager
+func (m *Manager) Snapshot() ([]byte, error) {
+	return MarshalSnapshot(m.ListProfiles())
+}
+
+// Restore loads profiles from a snapshot, keeping their original cache times
+func (m *Manager) Restore(data []byte) error {
+	profiles, err := UnmarshalSnapshot(data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, profile := range profiles {
+		m.store(profile.Hostname, profile)
+	}
+	m.evict()
+
+	m.logger.Debug("State restored from snapshot",
+		zap.Int("profileCount", len(profiles)))
+
+	return nil
+}
+
+func toProfileRecord(profile *ProfileState) profileRecord {
+	healthChecksEnabled := profile.HealthChecksEnabled
+	record := profileRecord{
+		ProfileName:   profile.ProfileName,
+		ResourceGroup: profile.ResourceGroup,
+		ResourceID:    profile.ResourceID,
+		Hostname:      profile.Hostname,
+		FQDN:          profile.FQDN,
+		RoutingMethod: profile.RoutingMethod,
+		DNSTTL:        profile.DNSTTL,
+		Tags:          profile.Tags,
+		CreatedAt:     profile.CreatedAt,
+		UpdatedAt:     profile.UpdatedAt,
+		CachedAt:      profile.CachedAt,
+
+		MonitorProtocol:     profile.MonitorProtocol,
+		MonitorPort:         profile.MonitorPort,
+		MonitorPath:         profile.MonitorPath,
+		HealthChecksEnabled: &healthChecksEnabled,
+		TrafficViewEnabled:  profile.TrafficViewEnabled,
+		ProfileStatus:       profile.ProfileStatus,
+	}
+
+	for _, endpoint := range profile.Endpoints {
+		record.Endpoints = append(record.Endpoints, endpointRecord{
+			EndpointName:  endpoint.EndpointName,
+			EndpointType:  endpoint.EndpointType,
+			Target:        endpoint.Target,
+			Weight:        endpoint.Weight,
+			Priority:      endpoint.Priority,
+			Status:        endpoint.Status,
+			MonitorStatus: endpoint.MonitorStatus,
+			Location:      endpoint.Location,
+			Metadata:      endpoint.Metadata,
+			CreatedAt:     endpoint.CreatedAt,
+			UpdatedAt:     endpoint.UpdatedAt,
+
+			TargetResourceID: endpoint.TargetResourceID,
+			AlwaysServe:      endpoint.AlwaysServe,
+			CustomHeaders:    endpoint.CustomHeaders,
+		})
+	}
+
+	// Keep output stable across writes
+	sort.Slice(record.Endpoints, func(i, j int) bool {
+		return record.Endpoints[i].EndpointName < record.Endpoints[j].EndpointName
+	})
+
+	return record
+}
+
+func (r profileRecord) toProfileState() *ProfileState {
+	profile := &ProfileState{
+		ProfileName:   r.ProfileName,
+		ResourceGroup: r.ResourceGroup,
+		ResourceID:    r.ResourceID,
+		Hostname:      r.Hostname,
+		FQDN:          r.FQDN,
+		RoutingMethod: r.RoutingMethod,
+		DNSTTL:        r.DNSTTL,
+		Endpoints:     make(map[string]*EndpointState),
+		Tags:          make(map[string]string),
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+		CachedAt:      r.CachedAt,
+
+		MonitorProtocol:     r.MonitorProtocol,
+		MonitorPort:         r.MonitorPort,
+		MonitorPath:         r.MonitorPath,
+		HealthChecksEnabled: r.HealthChecksEnabled == nil || *r.HealthChecksEnabled,
+		TrafficViewEnabled:  r.TrafficViewEnabled,
+		ProfileStatus:       r.ProfileStatus,
+	}
+
+	for k, v := range r.Tags {
+		profile.Tags[k] = v
+	}
+
+	for _, endpoint := range r.Endpoints {
+		profile.Endpoints[endpoint.EndpointName] = &EndpointState{
+			EndpointName:  endpoint.EndpointName,
+			EndpointType:  endpoint.EndpointType,
+			Target:        endpoint.Target,
+			Weight:        endpoint.Weight,
+			Priority:      endpoint.Priority,
+			Status:        endpoint.Status,
+			MonitorStatus: endpoint.MonitorStatus,
+			Location:      endpoint.Location,
+			Metadata:      endpoint.Metadata,
+			CreatedAt:     endpoint.CreatedAt,
+			UpdatedAt:     endpoint.UpdatedAt,
+
+			TargetResourceID: endpoint.TargetResourceID,
+			AlwaysServe:      endpoint.AlwaysServe,
+			CustomHeaders:    endpoint.CustomHeaders,
+		}
+	}
+
+	return profile
+}
@@ -0,0 +1,150 @@
+package state
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	profiles := []*ProfileState{
+		{
+			ProfileName:   "demo-tm",
+			ResourceGroup: "tm-rg",
+			ResourceID:    "/subscriptions/sub/resourceGroups/tm-rg/providers/Microsoft.Network/trafficManagerProfiles/demo-tm",
+			Hostname:      "demo.example.com",
+			FQDN:          "demo-tm.trafficmanager.net",
+			RoutingMethod: "Weighted",
+			DNSTTL:        30,
+			Endpoints: map[string]*EndpointState{
+				"east": {
+					EndpointName:  "east",
+					EndpointType:  "AzureEndpoints",
+					Target:        "demo-east.example.com",
+					Weight:        100,
+					Priority:      1,
+					Status:        "Enabled",
+					MonitorStatus: "Online",
+					Location:      "eastus",
+					Metadata:      &EndpointMetadata{Cluster: "aks-east", Namespace: "default", Weight: 100},
+					CreatedAt:     now,
+					UpdatedAt:     now,
+
+					TargetResourceID: "/subscriptions/sub/resourceGroups/app-rg/providers/Microsoft.Network/publicIPAddresses/demo-east",
+					AlwaysServe:      true,
+					CustomHeaders:    map[string]string{"host": "demo.example.com"},
+				},
+			},
+			Tags:      map[string]string{"managedBy": "external-dns-traffic-manager-webhook"},
+			CreatedAt: now,
+			UpdatedAt: now,
+			CachedAt:  now,
+
+			MonitorProtocol:     "HTTPS",
+			MonitorPort:         8443,
+			MonitorPath:         "/healthz",
+			HealthChecksEnabled: true,
+			TrafficViewEnabled:  true,
+			ProfileStatus:       "Enabled",
+		},
+	}
+
+	// Every field is set, so one the snapshot doesn't persist fails the round trip
+	assertAllFieldsSet(t, *profiles[0])
+	assertAllFieldsSet(t, *profiles[0].Endpoints["east"])
+
+	data, err := MarshalSnapshot(profiles)
+	require.NoError(t, err)
+
+	restored, err := UnmarshalSnapshot(data)
+	require.NoError(t, err)
+	assert.Equal(t, profiles, restored)
+
+	// False is kept too, rather than read back as the default
+	profiles[0].HealthChecksEnabled = false
+	data, err = MarshalSnapshot(profiles)
+	require.NoError(t, err)
+	restored, err = UnmarshalSnapshot(data)
+	require.NoError(t, err)
+	assert.False(t, restored[0].HealthChecksEnabled)
+}
+
+// assertAllFieldsSet fails for each field of the struct v left at its zero value
+func assertAllFieldsSet(t *testing.T, v any) {
+	t.Helper()
+	value := reflect.ValueOf(v)
+	for i := 0; i < value.NumField(); i++ {
+		assert.False(t, value.Field(i).IsZero(), "%s.%s isn't set in the fixture", value.Type().Name(), value.Type().Field(i).Name)
+	}
+}
+
+func TestUnmarshalSnapshot_HealthChecksDefault(t *testing.T) {
+	// Snapshots written before health check settings were persisted
+	data := []byte(`{"schemaVersion": 1, "minReaderVersion": 1, "profiles": [{"profileName": "demo-tm", "hostname": "demo.example.com"}]}`)
+
+	profiles, err := UnmarshalSnapshot(data)
+	require.NoError(t, err)
+	require.Len(t, profiles, 1)
+	assert.True(t, profiles[0].HealthChecksEnabled)
+}
+
+func TestUnmarshalSnapshot_NewerCompatibleVersion(t *testing.T) {
+	data := []byte(`{
+		"schemaVersion": 2,
+		"minReaderVersion": 1,
+		"profiles": [{"profileName": "demo-tm", "hostname": "demo.example.com", "futureField": "ignored"}]
+	}`)
+
+	profiles, err := UnmarshalSnapshot(data)
+	require.NoError(t, err)
+	require.Len(t, profiles, 1)
+	assert.Equal(t, "demo-tm", profiles[0].ProfileName)
+}
+
+func TestUnmarshalSnapshot_IncompatibleVersion(t *testing.T) {
+	data := []byte(`{"schemaVersion": 3, "minReaderVersion": 3, "profiles": []}`)
+
+	_, err := UnmarshalSnapshot(data)
+	assert.Error(t, err)
+}
+
+func TestUnmarshalSnapshot_Unversioned(t *testing.T) {
+	_, err := UnmarshalSnapshot([]byte(`{"profiles": []}`))
+	assert.Error(t, err)
+}
+
+func TestMarshalSnapshot_WritesVersion(t *testing.T) {
+	data, err := MarshalSnapshot(nil)
+	require.NoError(t, err)
+
+	var env map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &env))
+	assert.Equal(t, float64(SchemaVersion), env["schemaVersion"])
+	assert.Equal(t, float64(MinReaderVersion), env["minReaderVersion"])
+}
+
+func TestManager_SnapshotRestore(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	source := NewManager(5*time.Minute, logger)
+	source.SetProfile("demo.example.com", &ProfileState{
+		ProfileName: "demo-tm",
+		Hostname:    "demo.example.com",
+		Endpoints:   map[string]*EndpointState{},
+	})
+
+	data, err := source.Snapshot()
+	require.NoError(t, err)
+
+	target := NewManager(5*time.Minute, logger)
+	require.NoError(t, target.Restore(data))
+
+	profile, exists := target.GetProfile("demo.example.com")
+	require.True(t, exists)
+	assert.Equal(t, "demo-tm", profile.ProfileName)
+}
@@ -1,6 +1,7 @@
 package state
 
 import (
+	"maps"
 	"time"
 )
 
@@ -8,6 +9,7 @@ import (
 type ProfileState struct {
 	ProfileName   string
 	ResourceGroup string
+	ResourceID    string                    // Azure resource ID of the profile
 	Hostname      string                    // The DNS hostname this profile manages
 	FQDN          string                    // Traffic Manager FQDN (e.g., myapp-tm.trafficmanager.net)
 	RoutingMethod string                    // Weighted, Priority, Performance, Geographic
@@ -17,19 +19,50 @@ type ProfileState struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	CachedAt      time.Time // When this state was last cached
+
+	// Health check settings
+	MonitorProtocol     string // HTTP, HTTPS or TCP
+	MonitorPort         int64
+	MonitorPath         string
+	HealthChecksEnabled bool   // Whether Azure probes the endpoints, false when they all Always Serve
+	TrafficViewEnabled  bool   // Whether the profile is enrolled in Traffic View
+	ProfileStatus       string // Enabled or Disabled; a disabled profile answers no queries
 }
 
 // EndpointState represents the current state of a Traffic Manager endpoint
 type EndpointState struct {
-	EndpointName string
-	EndpointType string // AzureEndpoints, ExternalEndpoints, NestedEndpoints
-	Target       string // IP address or FQDN
-	Weight       int64  // 1-1000 for weighted routing
-	Priority     int64  // 1-1000 for priority routing
-	Status       string // Enabled or Disabled
-	Location     string // Azure region
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	EndpointName  string
+	EndpointType  string            // AzureEndpoints, ExternalEndpoints, NestedEndpoints
+	Target        string            // IP address or FQDN
+	Weight        int64             // 1-1000 for weighted routing
+	Priority      int64             // 1-1000 for priority routing
+	Status        string            // Enabled or Disabled
+	MonitorStatus string            // Health reported by Traffic Manager: Online, Degraded, CheckingEndpoint, ...
+	Location      string            // Azure region
+	Metadata      *EndpointMetadata // Source metadata persisted on the profile, if any
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	TargetResourceID string            // Resource an AzureEndpoints endpoint points at
+	AlwaysServe      bool              // Health checks are off and the endpoint always counts as healthy
+	CustomHeaders    map[string]string // HTTP headers sent with the endpoint's health probes
+}
+
+// EndpointMetadata records where an endpoint came from and the configuration it was created with.
+// Azure endpoints can't carry tags, so this is persisted as JSON in a profile tag keyed by endpoint name.
+// Field names are kept short because Azure limits tag values to 256 characters.
+type EndpointMetadata struct {
+	Cluster   string `json:"c,omitempty"` // Source cluster name
+	Namespace string `json:"n,omitempty"` // Source Kubernetes namespace
+	Weight    int64  `json:"w,omitempty"` // Weight requested by annotations
+
+	// Cron schedules that disable and re-enable the endpoint, if any
+	DisableSchedule string `json:"sd,omitempty"`
+	EnableSchedule  string `json:"se,omitempty"`
+
+	// Kubernetes Service backing the endpoint, and whether it was disabled because the Service had no ready endpoints
+	Service  string `json:"s,omitempty"`
+	NotReady bool   `json:"nr,omitempty"`
 }
 
 // Clone creates a deep copy of ProfileState
@@ -37,6 +70,7 @@ func (ps *ProfileState) Clone() *ProfileState {
 	clone := &ProfileState{
 		ProfileName:   ps.ProfileName,
 		ResourceGroup: ps.ResourceGroup,
+		ResourceID:    ps.ResourceID,
 		Hostname:      ps.Hostname,
 		FQDN:          ps.FQDN,
 		RoutingMethod: ps.RoutingMethod,
@@ -46,6 +80,13 @@ func (ps *ProfileState) Clone() *ProfileState {
 		CreatedAt:     ps.CreatedAt,
 		UpdatedAt:     ps.UpdatedAt,
 		CachedAt:      ps.CachedAt,
+
+		MonitorProtocol:     ps.MonitorProtocol,
+		MonitorPort:         ps.MonitorPort,
+		MonitorPath:         ps.MonitorPath,
+		HealthChecksEnabled: ps.HealthChecksEnabled,
+		TrafficViewEnabled:  ps.TrafficViewEnabled,
+		ProfileStatus:       ps.ProfileStatus,
 	}
 
 	// Deep copy endpoints
@@ -63,17 +104,70 @@ func (ps *ProfileState) Clone() *ProfileState {
 
 // Clone creates a deep copy of EndpointState
 func (es *EndpointState) Clone() *EndpointState {
-	return &EndpointState{
-		EndpointName: es.EndpointName,
-		EndpointType: es.EndpointType,
-		Target:       es.Target,
-		Weight:       es.Weight,
-		Priority:     es.Priority,
-		Status:       es.Status,
-		Location:     es.Location,
-		CreatedAt:    es.CreatedAt,
-		UpdatedAt:    es.UpdatedAt,
+	clone := &EndpointState{
+		EndpointName:  es.EndpointName,
+		EndpointType:  es.EndpointType,
+		Target:        es.Target,
+		Weight:        es.Weight,
+		Priority:      es.Priority,
+		Status:        es.Status,
+		MonitorStatus: es.MonitorStatus,
+		Location:      es.Location,
+		CreatedAt:     es.CreatedAt,
+		UpdatedAt:     es.UpdatedAt,
+
+		TargetResourceID: es.TargetResourceID,
+		AlwaysServe:      es.AlwaysServe,
+		CustomHeaders:    maps.Clone(es.CustomHeaders),
+	}
+
+	if es.Metadata != nil {
+		metadata := *es.Metadata
+		clone.Metadata = &metadata
+	}
+
+	return clone
+}
+
+// withEndpoints returns a copy of ps sharing everything but its endpoints map, which can be
+// changed without affecting ps
+func (ps *ProfileState) withEndpoints() *ProfileState {
+	clone := *ps
+	clone.Endpoints = make(map[string]*EndpointState, len(ps.Endpoints)+1)
+	for k, v := range ps.Endpoints {
+		clone.Endpoints[k] = v
+	}
+	return &clone
+}
+
+// Rough sizes of the fixed parts of cached values, used by approximateSize
+const (
+	profileOverhead  = 320
+	endpointOverhead = 256
+	metadataOverhead = 128
+	mapEntryOverhead = 48
+)
+
+// approximateSize estimates the bytes ps holds, for the state cache's memory accounting
+func (ps *ProfileState) approximateSize() int {
+	size := profileOverhead + len(ps.ProfileName) + len(ps.ResourceGroup) + len(ps.ResourceID) +
+		len(ps.Hostname) + len(ps.FQDN) + len(ps.RoutingMethod) + len(ps.MonitorProtocol) + len(ps.MonitorPath)
+
+	for k, v := range ps.Tags {
+		size += mapEntryOverhead + len(k) + len(v)
+	}
+	for k, endpoint := range ps.Endpoints {
+		size += mapEntryOverhead + len(k) + endpointOverhead + len(endpoint.EndpointName) +
+			len(endpoint.EndpointType) + len(endpoint.Target) + len(endpoint.Status) +
+			len(endpoint.MonitorStatus) + len(endpoint.Location) + len(endpoint.TargetResourceID)
+		for k, v := range endpoint.CustomHeaders {
+			size += mapEntryOverhead + len(k) + len(v)
+		}
+		if endpoint.Metadata != nil {
+			size += metadataOverhead + len(endpoint.Metadata.Cluster) + len(endpoint.Metadata.Namespace) + len(endpoint.Metadata.Service)
+		}
 	}
+	return size
 }
 
 // IsExpired checks if the cached state has expired
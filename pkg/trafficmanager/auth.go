@@ -3,30 +3,174 @@ package trafficmanager
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 )
 
+// Authentication modes accepted by GetAzureCredential
+const (
+	AuthModeDefault           = "default"
+	AuthModeWorkloadIdentity  = "workload-identity"
+	AuthModeManagedIdentity   = "managed-identity"
+	AuthModeClientSecret      = "client-secret"
+	AuthModeClientCertificate = "client-certificate"
+	AuthModeCLI               = "cli"
+)
+
+// AuthModes lists the valid authentication modes
+var AuthModes = []string{AuthModeDefault, AuthModeWorkloadIdentity, AuthModeManagedIdentity, AuthModeClientSecret, AuthModeClientCertificate, AuthModeCLI}
+
+// CredentialConfig selects how the webhook authenticates to Azure
+type CredentialConfig struct {
+	AuthMode     string // One of AuthModes; empty means default
+	TenantID     string
+	ClientID     string // Client ID of the app registration or user-assigned identity
+	ClientSecret string // Only used by client-secret mode
+	Cloud        cloud.Configuration
+
+	// Files mounted from a Kubernetes Secret. Credentials built from files are
+	// returned as a *FileCredential so they can be rebuilt when the secret rotates.
+	ClientSecretFile          string // client-secret mode; takes precedence over ClientSecret
+	ClientCertificateFile     string // client-certificate mode; PEM or PKCS#12 containing the certificate and private key
+	ClientCertificatePassword string // Password for the certificate file, if any
+
+	// HTTP proxy for token requests, as in ClientOptions. Managed identity tokens come from the
+	// node's metadata endpoint and never use it.
+	ProxyURL string
+}
+
 // GetAzureCredential returns an Azure credential for authentication
-// It uses DefaultAzureCredential which tries multiple authentication methods:
+// In default mode it uses DefaultAzureCredential which tries multiple authentication methods:
 // 1. Environment variables (AZURE_CLIENT_ID, AZURE_TENANT_ID, AZURE_CLIENT_SECRET)
 // 2. Managed Identity (when running in Azure)
 // 3. Azure CLI (for local development)
-func GetAzureCredential() (azcore.TokenCredential, error) {
-	cred, err := azidentity.NewDefaultAzureCredential(nil)
+// The other modes construct that specific credential so the wrong identity can't be picked up.
+// Tokens are requested from the authority of the configured cloud.
+func GetAzureCredential(config CredentialConfig) (azcore.TokenCredential, error) {
+	var (
+		cred azcore.TokenCredential
+		err  error
+	)
+
+	switch config.AuthMode {
+	case AuthModeDefault, "":
+		options := &azidentity.DefaultAzureCredentialOptions{TenantID: config.TenantID}
+		options.Cloud = config.Cloud
+		if err := config.withProxy(&options.ClientOptions); err != nil {
+			return nil, err
+		}
+		cred, err = azidentity.NewDefaultAzureCredential(options)
+	case AuthModeWorkloadIdentity:
+		// Tenant, client ID and token file default to the AZURE_* variables injected by the workload identity webhook
+		options := &azidentity.WorkloadIdentityCredentialOptions{
+			TenantID: config.TenantID,
+			ClientID: config.ClientID,
+		}
+		options.Cloud = config.Cloud
+		if err := config.withProxy(&options.ClientOptions); err != nil {
+			return nil, err
+		}
+		cred, err = azidentity.NewWorkloadIdentityCredential(options)
+	case AuthModeManagedIdentity:
+		options := &azidentity.ManagedIdentityCredentialOptions{}
+		options.Cloud = config.Cloud
+		if config.ClientID != "" {
+			options.ID = azidentity.ClientID(config.ClientID)
+		}
+		cred, err = azidentity.NewManagedIdentityCredential(options)
+	case AuthModeClientSecret:
+		if config.ClientSecretFile != "" {
+			return NewFileCredential([]string{config.ClientSecretFile}, func() (azcore.TokenCredential, error) {
+				secret, err := os.ReadFile(config.ClientSecretFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read client secret file: %w", err)
+				}
+				return newClientSecretCredential(config, strings.TrimSpace(string(secret)))
+			})
+		}
+		cred, err = newClientSecretCredential(config, config.ClientSecret)
+	case AuthModeClientCertificate:
+		if config.ClientCertificateFile == "" {
+			return nil, fmt.Errorf("client-certificate authentication requires a certificate file")
+		}
+		return NewFileCredential([]string{config.ClientCertificateFile}, func() (azcore.TokenCredential, error) {
+			return newClientCertificateCredential(config)
+		})
+	case AuthModeCLI:
+		cred, err = azidentity.NewAzureCLICredential(&azidentity.AzureCLICredentialOptions{TenantID: config.TenantID})
+	default:
+		return nil, fmt.Errorf("invalid auth mode %q, must be one of: %v", config.AuthMode, AuthModes)
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("failed to obtain Azure credential: %w", err)
 	}
 	return cred, nil
 }
 
-// TestCredential tests if the credential can obtain a token
-func TestCredential(ctx context.Context, cred azcore.TokenCredential) error {
+// withProxy sends a credential's token requests through the configured proxy, if any
+func (config CredentialConfig) withProxy(options *azcore.ClientOptions) error {
+	transport, err := ClientOptions{ProxyURL: config.ProxyURL}.transport()
+	if err != nil {
+		return err
+	}
+	if transport != nil {
+		options.Transport = transport
+	}
+	return nil
+}
+
+// newClientSecretCredential builds a client secret credential for the configured app registration
+func newClientSecretCredential(config CredentialConfig, secret string) (azcore.TokenCredential, error) {
+	if config.TenantID == "" || config.ClientID == "" || secret == "" {
+		return nil, fmt.Errorf("client-secret authentication requires tenant ID, client ID and client secret")
+	}
+	options := &azidentity.ClientSecretCredentialOptions{}
+	options.Cloud = config.Cloud
+	if err := config.withProxy(&options.ClientOptions); err != nil {
+		return nil, err
+	}
+	return azidentity.NewClientSecretCredential(config.TenantID, config.ClientID, secret, options)
+}
+
+// newClientCertificateCredential builds a client certificate credential from the certificate file
+func newClientCertificateCredential(config CredentialConfig) (azcore.TokenCredential, error) {
+	if config.TenantID == "" || config.ClientID == "" {
+		return nil, fmt.Errorf("client-certificate authentication requires tenant ID and client ID")
+	}
+
+	data, err := os.ReadFile(config.ClientCertificateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate file: %w", err)
+	}
+
+	var password []byte
+	if config.ClientCertificatePassword != "" {
+		password = []byte(config.ClientCertificatePassword)
+	}
+	certs, key, err := azidentity.ParseCertificates(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+	}
+
+	options := &azidentity.ClientCertificateCredentialOptions{}
+	options.Cloud = config.Cloud
+	if err := config.withProxy(&options.ClientOptions); err != nil {
+		return nil, err
+	}
+	return azidentity.NewClientCertificateCredential(config.TenantID, config.ClientID, certs, key, options)
+}
+
+// TestCredential tests if the credential can obtain a management token for the given cloud
+func TestCredential(ctx context.Context, cred azcore.TokenCredential, cloudConfig cloud.Configuration) error {
 	// Try to get a token to verify the credential works
 	token, err := cred.GetToken(ctx, policy.TokenRequestOptions{
-		Scopes: []string{"https://management.azure.com/.default"},
+		Scopes: []string{ManagementScope(cloudConfig)},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to obtain token: %w", err)
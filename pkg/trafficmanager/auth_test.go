@@ -0,0 +1,39 @@
+package trafficmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAzureCredential_Modes(t *testing.T) {
+	publicCloud, err := CloudConfiguration("")
+	require.NoError(t, err)
+
+	cred, err := GetAzureCredential(CredentialConfig{
+		AuthMode:     AuthModeClientSecret,
+		TenantID:     "00000000-0000-0000-0000-000000000001",
+		ClientID:     "00000000-0000-0000-0000-000000000002",
+		ClientSecret: "secret",
+		Cloud:        publicCloud,
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, cred)
+
+	cred, err = GetAzureCredential(CredentialConfig{
+		AuthMode: AuthModeManagedIdentity,
+		ClientID: "00000000-0000-0000-0000-000000000002",
+		Cloud:    publicCloud,
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, cred)
+}
+
+func TestGetAzureCredential_Errors(t *testing.T) {
+	_, err := GetAzureCredential(CredentialConfig{AuthMode: "magic"})
+	assert.ErrorContains(t, err, "invalid auth mode")
+
+	_, err = GetAzureCredential(CredentialConfig{AuthMode: AuthModeClientSecret, ClientID: "client"})
+	assert.ErrorContains(t, err, "requires tenant ID, client ID and client secret")
+}
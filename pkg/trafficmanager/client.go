@@ -5,7 +5,9 @@ import (
 	"fmt"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/logging"
 	"go.uber.org/zap"
 )
 
@@ -13,46 +15,96 @@ import (
 type Client struct {
 	profilesClient  *armtrafficmanager.ProfilesClient
 	endpointsClient *armtrafficmanager.EndpointsClient
+	heatMapClient   *armtrafficmanager.HeatMapClient
+	armClient       *arm.Client // Requests outside the Traffic Manager SDK, at ARM's own API versions
 	subscriptionID  string
+	ownership       Ownership // Tags identifying the profiles this client syncs
+	syncConcurrency int       // Resource groups listed in parallel by SyncProfilesFromAzure
 	logger          *zap.Logger
 }
 
-// NewClient creates a new Traffic Manager client
-func NewClient(subscriptionID string, credential azcore.TokenCredential, logger *zap.Logger) (*Client, error) {
+// NewClient creates a new Traffic Manager client for a subscription, with the cloud, user agent,
+// retries, API version and proxy in options
+func NewClient(subscriptionID string, credential azcore.TokenCredential, options ClientOptions, logger *zap.Logger) (*Client, error) {
 	if subscriptionID == "" {
 		return nil, fmt.Errorf("subscription ID is required")
 	}
 
-	profilesClient, err := armtrafficmanager.NewProfilesClient(subscriptionID, credential, nil)
+	armOptions, err := options.ARM()
+	if err != nil {
+		return nil, err
+	}
+
+	// Created before the Traffic Manager API version is set, which would override the version of its requests
+	armClient, err := arm.NewClient("trafficmanager", "v1.0.0", credential, armOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ARM client: %w", err)
+	}
+	armOptions.APIVersion = options.APIVersion
+
+	profilesClient, err := armtrafficmanager.NewProfilesClient(subscriptionID, credential, armOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create profiles client: %w", err)
 	}
 
-	endpointsClient, err := armtrafficmanager.NewEndpointsClient(subscriptionID, credential, nil)
+	endpointsClient, err := armtrafficmanager.NewEndpointsClient(subscriptionID, credential, armOptions)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create endpoints client: %w", err)
 	}
 
+	heatMapClient, err := armtrafficmanager.NewHeatMapClient(subscriptionID, credential, armOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create heat map client: %w", err)
+	}
+
 	return &Client{
 		profilesClient:  profilesClient,
 		endpointsClient: endpointsClient,
+		heatMapClient:   heatMapClient,
+		armClient:       armClient,
 		subscriptionID:  subscriptionID,
+		ownership:       DefaultOwnership(),
+		syncConcurrency: DefaultSyncConcurrency,
 		logger:          logger,
 	}, nil
 }
 
+// SetOwnership changes the tags that identify the profiles SyncProfilesFromAzure returns.
+// It must be called before the client is used.
+func (c *Client) SetOwnership(ownership Ownership) {
+	c.ownership = ownership.WithDefaults()
+}
+
 // TestConnection tests connectivity to Azure Traffic Manager API
 func (c *Client) TestConnection(ctx context.Context, resourceGroup string) error {
-	c.logger.Info("Testing Traffic Manager API connectivity",
+	c.log(ctx).Info("Testing Traffic Manager API connectivity",
 		zap.String("resourceGroup", resourceGroup))
 
 	// Try to list profiles in the resource group
 	pager := c.profilesClient.NewListByResourceGroupPager(resourceGroup, nil)
 	_, err := pager.NextPage(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Traffic Manager API: %w", err)
+		return fmt.Errorf("failed to connect to Traffic Manager API: %w", classify(err, nil))
 	}
 
-	c.logger.Info("Successfully connected to Traffic Manager API")
+	c.log(ctx).Info("Successfully connected to Traffic Manager API")
 	return nil
 }
+
+// Ping checks that Azure Resource Manager is reachable and accepts the credential.
+// It uses the provider-level name availability check, which needs no RBAC on any resource.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.profilesClient.CheckTrafficManagerRelativeDNSNameAvailability(ctx, armtrafficmanager.CheckTrafficManagerRelativeDNSNameAvailabilityParameters{
+		Name: toStringPtr("external-dns-traffic-manager-readiness"),
+		Type: toStringPtr("Microsoft.Network/trafficManagerProfiles"),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to reach Azure Resource Manager: %w", classify(err, nil))
+	}
+	return nil
+}
+
+// log returns the client logger with the request ID from ctx attached
+func (c *Client) log(ctx context.Context) *zap.Logger {
+	return logging.FromContext(ctx, c.logger)
+}
@@ -0,0 +1,97 @@
+package trafficmanager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+)
+
+// Names accepted for the Azure cloud setting (AZURE_ENVIRONMENT)
+const (
+	CloudPublic       = "AzurePublicCloud"
+	CloudUSGovernment = "AzureUSGovernmentCloud"
+	CloudChina        = "AzureChinaCloud"
+	CloudGermany      = "AzureGermanCloud"
+)
+
+var clouds = map[string]cloud.Configuration{
+	CloudPublic: {
+		ActiveDirectoryAuthorityHost: "https://login.microsoftonline.com/",
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: "https://management.core.windows.net/",
+				Endpoint: "https://management.azure.com",
+			},
+		},
+	},
+	CloudUSGovernment: {
+		ActiveDirectoryAuthorityHost: "https://login.microsoftonline.us/",
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: "https://management.core.usgovcloudapi.net/",
+				Endpoint: "https://management.usgovcloudapi.net",
+			},
+		},
+	},
+	CloudChina: {
+		ActiveDirectoryAuthorityHost: "https://login.chinacloudapi.cn/",
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: "https://management.core.chinacloudapi.cn/",
+				Endpoint: "https://management.chinacloudapi.cn",
+			},
+		},
+	},
+	CloudGermany: {
+		ActiveDirectoryAuthorityHost: "https://login.microsoftonline.de/",
+		Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+			cloud.ResourceManager: {
+				Audience: "https://management.core.cloudapi.de/",
+				Endpoint: "https://management.microsoftazure.de",
+			},
+		},
+	},
+}
+
+// cloudAliases maps the short and azure-cli style names onto the canonical cloud names
+var cloudAliases = map[string]string{
+	"":                       CloudPublic,
+	"public":                 CloudPublic,
+	"azurecloud":             CloudPublic,
+	"azurepubliccloud":       CloudPublic,
+	"usgovernment":           CloudUSGovernment,
+	"azureusgovernment":      CloudUSGovernment,
+	"azureusgovernmentcloud": CloudUSGovernment,
+	"china":                  CloudChina,
+	"azurechinacloud":        CloudChina,
+	"germany":                CloudGermany,
+	"azuregermancloud":       CloudGermany,
+}
+
+// CloudConfiguration returns the azcore cloud configuration for a cloud name.
+// An empty name selects the public cloud.
+func CloudConfiguration(name string) (cloud.Configuration, error) {
+	canonical, ok := cloudAliases[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return cloud.Configuration{}, fmt.Errorf("unknown Azure cloud %q, must be one of: %v",
+			name, []string{CloudPublic, CloudUSGovernment, CloudChina, CloudGermany})
+	}
+	return clouds[canonical], nil
+}
+
+// ManagementScope returns the token scope for Azure Resource Manager in a cloud
+func ManagementScope(cloudConfig cloud.Configuration) string {
+	audience := cloudConfig.Services[cloud.ResourceManager].Audience
+	if audience == "" {
+		audience = clouds[CloudPublic].Services[cloud.ResourceManager].Audience
+	}
+	return strings.TrimSuffix(audience, "/") + "/.default"
+}
+
+// ARMClientOptions returns ARM client options targeting a cloud, with the SDK's other defaults
+func ARMClientOptions(cloudConfig cloud.Configuration) *arm.ClientOptions {
+	options, _ := ClientOptions{Cloud: cloudConfig}.ARM() // Only a proxy URL can fail
+	return options
+}
@@ -0,0 +1,49 @@
+package trafficmanager
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudConfiguration(t *testing.T) {
+	tests := []struct {
+		name      string
+		authority string
+		endpoint  string
+	}{
+		{"", "https://login.microsoftonline.com/", "https://management.azure.com"},
+		{"AzurePublicCloud", "https://login.microsoftonline.com/", "https://management.azure.com"},
+		{"AzureUSGovernmentCloud", "https://login.microsoftonline.us/", "https://management.usgovcloudapi.net"},
+		{"usgovernment", "https://login.microsoftonline.us/", "https://management.usgovcloudapi.net"},
+		{"AzureChinaCloud", "https://login.chinacloudapi.cn/", "https://management.chinacloudapi.cn"},
+		{"germany", "https://login.microsoftonline.de/", "https://management.microsoftazure.de"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := CloudConfiguration(tt.name)
+			require.NoError(t, err)
+			assert.Equal(t, tt.authority, config.ActiveDirectoryAuthorityHost)
+			assert.Equal(t, tt.endpoint, config.Services[cloud.ResourceManager].Endpoint)
+		})
+	}
+
+	_, err := CloudConfiguration("AzureMoonCloud")
+	assert.Error(t, err)
+}
+
+func TestManagementScope(t *testing.T) {
+	public, err := CloudConfiguration("")
+	require.NoError(t, err)
+	assert.Equal(t, "https://management.core.windows.net/.default", ManagementScope(public))
+
+	china, err := CloudConfiguration(CloudChina)
+	require.NoError(t, err)
+	assert.Equal(t, "https://management.core.chinacloudapi.cn/.default", ManagementScope(china))
+
+	// Falls back to the public cloud when no audience is configured
+	assert.Equal(t, "https://management.core.windows.net/.default", ManagementScope(cloud.Configuration{}))
+}
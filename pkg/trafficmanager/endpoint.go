@@ -3,6 +3,8 @@ package trafficmanager
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
@@ -11,40 +13,26 @@ import (
 
 // CreateEndpoint creates a new Traffic Manager endpoint
 func (c *Client) CreateEndpoint(ctx context.Context, resourceGroup, profileName string, config *EndpointConfig) (*EndpointState, error) {
-	c.logger.Info("Creating Traffic Manager endpoint",
+	c.log(ctx).Info("Creating Traffic Manager endpoint",
 		zap.String("profileName", profileName),
 		zap.String("endpointName", config.EndpointName),
 		zap.String("target", config.Target),
 		zap.Int64("weight", config.Weight))
 
-	endpoint := armtrafficmanager.Endpoint{
-		Properties: &armtrafficmanager.EndpointProperties{
-			Target:         &config.Target,
-			Weight:         &config.Weight,
-			Priority:       &config.Priority,
-			EndpointStatus: toEndpointStatus(config.Status),
-		},
-	}
-
-	// Add location for ExternalEndpoints
-	if config.EndpointType == "ExternalEndpoints" {
-		endpoint.Properties.EndpointLocation = &config.Location
-	}
-
 	resp, err := c.endpointsClient.CreateOrUpdate(
 		ctx,
 		resourceGroup,
 		profileName,
 		armtrafficmanager.EndpointType(config.EndpointType),
 		config.EndpointName,
-		endpoint,
+		newEndpoint(config),
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create endpoint: %w", err)
+		return nil, fmt.Errorf("failed to create endpoint: %w", endpointError(err))
 	}
 
-	c.logger.Info("Successfully created Traffic Manager endpoint",
+	c.log(ctx).Info("Successfully created Traffic Manager endpoint",
 		zap.String("endpointName", config.EndpointName),
 		zap.String("target", config.Target))
 
@@ -53,7 +41,7 @@ func (c *Client) CreateEndpoint(ctx context.Context, resourceGroup, profileName
 
 // GetEndpoint retrieves a Traffic Manager endpoint
 func (c *Client) GetEndpoint(ctx context.Context, resourceGroup, profileName, endpointType, endpointName string) (*EndpointState, error) {
-	c.logger.Debug("Getting Traffic Manager endpoint",
+	c.log(ctx).Debug("Getting Traffic Manager endpoint",
 		zap.String("profileName", profileName),
 		zap.String("endpointName", endpointName))
 
@@ -66,7 +54,7 @@ func (c *Client) GetEndpoint(ctx context.Context, resourceGroup, profileName, en
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get endpoint: %w", err)
+		return nil, fmt.Errorf("failed to get endpoint: %w", endpointError(err))
 	}
 
 	return endpointResponseToState(&resp.Endpoint), nil
@@ -74,7 +62,7 @@ func (c *Client) GetEndpoint(ctx context.Context, resourceGroup, profileName, en
 
 // UpdateEndpoint updates an existing Traffic Manager endpoint
 func (c *Client) UpdateEndpoint(ctx context.Context, resourceGroup, profileName string, config *EndpointConfig) (*EndpointState, error) {
-	c.logger.Info("Updating Traffic Manager endpoint",
+	c.log(ctx).Info("Updating Traffic Manager endpoint",
 		zap.String("profileName", profileName),
 		zap.String("endpointName", config.EndpointName))
 
@@ -90,6 +78,9 @@ func (c *Client) UpdateEndpoint(ctx context.Context, resourceGroup, profileName
 	if config.EndpointType == "ExternalEndpoints" && config.Location != "" {
 		endpoint.Properties.EndpointLocation = &config.Location
 	}
+	setTargetResource(&endpoint, config.TargetResourceID)
+	setAlwaysServe(&endpoint, config.AlwaysServe)
+	setCustomHeaders(&endpoint, config.CustomHeaders)
 
 	resp, err := c.endpointsClient.CreateOrUpdate(
 		ctx,
@@ -101,10 +92,10 @@ func (c *Client) UpdateEndpoint(ctx context.Context, resourceGroup, profileName
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to update endpoint: %w", err)
+		return nil, fmt.Errorf("failed to update endpoint: %w", endpointError(err))
 	}
 
-	c.logger.Info("Successfully updated Traffic Manager endpoint",
+	c.log(ctx).Info("Successfully updated Traffic Manager endpoint",
 		zap.String("endpointName", config.EndpointName))
 
 	return endpointResponseToState(&resp.Endpoint), nil
@@ -112,7 +103,7 @@ func (c *Client) UpdateEndpoint(ctx context.Context, resourceGroup, profileName
 
 // UpdateEndpointWeight updates only the weight of an endpoint
 func (c *Client) UpdateEndpointWeight(ctx context.Context, resourceGroup, profileName, endpointType, endpointName string, weight int64) error {
-	c.logger.Info("Updating endpoint weight",
+	c.log(ctx).Info("Updating endpoint weight",
 		zap.String("profileName", profileName),
 		zap.String("endpointName", endpointName),
 		zap.Int64("weight", weight))
@@ -136,6 +127,9 @@ func (c *Client) UpdateEndpointWeight(ctx context.Context, resourceGroup, profil
 	if current.Location != "" {
 		endpoint.Properties.EndpointLocation = &current.Location
 	}
+	setTargetResource(&endpoint, current.TargetResourceID)
+	setAlwaysServe(&endpoint, current.AlwaysServe)
+	setCustomHeaders(&endpoint, current.CustomHeaders)
 
 	_, err = c.endpointsClient.CreateOrUpdate(
 		ctx,
@@ -147,10 +141,10 @@ func (c *Client) UpdateEndpointWeight(ctx context.Context, resourceGroup, profil
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update endpoint weight: %w", err)
+		return fmt.Errorf("failed to update endpoint weight: %w", endpointError(err))
 	}
 
-	c.logger.Info("Successfully updated endpoint weight",
+	c.log(ctx).Info("Successfully updated endpoint weight",
 		zap.String("endpointName", endpointName),
 		zap.Int64("weight", weight))
 
@@ -159,7 +153,7 @@ func (c *Client) UpdateEndpointWeight(ctx context.Context, resourceGroup, profil
 
 // UpdateEndpointStatus updates only the status (Enabled/Disabled) of an endpoint
 func (c *Client) UpdateEndpointStatus(ctx context.Context, resourceGroup, profileName, endpointType, endpointName, status string) error {
-	c.logger.Info("Updating endpoint status",
+	c.log(ctx).Info("Updating endpoint status",
 		zap.String("profileName", profileName),
 		zap.String("endpointName", endpointName),
 		zap.String("status", status))
@@ -183,6 +177,9 @@ func (c *Client) UpdateEndpointStatus(ctx context.Context, resourceGroup, profil
 	if current.Location != "" {
 		endpoint.Properties.EndpointLocation = &current.Location
 	}
+	setTargetResource(&endpoint, current.TargetResourceID)
+	setAlwaysServe(&endpoint, current.AlwaysServe)
+	setCustomHeaders(&endpoint, current.CustomHeaders)
 
 	_, err = c.endpointsClient.CreateOrUpdate(
 		ctx,
@@ -194,10 +191,10 @@ func (c *Client) UpdateEndpointStatus(ctx context.Context, resourceGroup, profil
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update endpoint status: %w", err)
+		return fmt.Errorf("failed to update endpoint status: %w", endpointError(err))
 	}
 
-	c.logger.Info("Successfully updated endpoint status",
+	c.log(ctx).Info("Successfully updated endpoint status",
 		zap.String("endpointName", endpointName),
 		zap.String("status", status))
 
@@ -206,7 +203,7 @@ func (c *Client) UpdateEndpointStatus(ctx context.Context, resourceGroup, profil
 
 // DeleteEndpoint deletes a Traffic Manager endpoint
 func (c *Client) DeleteEndpoint(ctx context.Context, resourceGroup, profileName, endpointType, endpointName string) error {
-	c.logger.Info("Deleting Traffic Manager endpoint",
+	c.log(ctx).Info("Deleting Traffic Manager endpoint",
 		zap.String("profileName", profileName),
 		zap.String("endpointName", endpointName))
 
@@ -219,10 +216,10 @@ func (c *Client) DeleteEndpoint(ctx context.Context, resourceGroup, profileName,
 		nil,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to delete endpoint: %w", err)
+		return fmt.Errorf("failed to delete endpoint: %w", endpointError(err))
 	}
 
-	c.logger.Info("Successfully deleted Traffic Manager endpoint",
+	c.log(ctx).Info("Successfully deleted Traffic Manager endpoint",
 		zap.String("endpointName", endpointName))
 
 	return nil
@@ -253,14 +250,111 @@ func endpointResponseToState(endpoint *armtrafficmanager.Endpoint) *EndpointStat
 		if endpoint.Properties.EndpointStatus != nil {
 			state.Status = string(*endpoint.Properties.EndpointStatus)
 		}
+		if endpoint.Properties.EndpointMonitorStatus != nil {
+			state.MonitorStatus = string(*endpoint.Properties.EndpointMonitorStatus)
+		}
 		if endpoint.Properties.EndpointLocation != nil {
 			state.Location = *endpoint.Properties.EndpointLocation
 		}
+		if endpoint.Properties.TargetResourceID != nil {
+			state.TargetResourceID = *endpoint.Properties.TargetResourceID
+		}
+		if endpoint.Properties.AlwaysServe != nil {
+			state.AlwaysServe = *endpoint.Properties.AlwaysServe == armtrafficmanager.AlwaysServeEnabled
+		}
+		state.CustomHeaders = customHeadersOf(endpoint.Properties.CustomHeaders)
 	}
 
 	return state
 }
 
+// newEndpoint builds the body of an endpoint for config
+func newEndpoint(config *EndpointConfig) armtrafficmanager.Endpoint {
+	endpoint := armtrafficmanager.Endpoint{
+		Properties: &armtrafficmanager.EndpointProperties{
+			Target:         &config.Target,
+			Weight:         &config.Weight,
+			Priority:       &config.Priority,
+			EndpointStatus: toEndpointStatus(config.Status),
+		},
+	}
+
+	// Add location for ExternalEndpoints
+	if config.EndpointType == "ExternalEndpoints" {
+		endpoint.Properties.EndpointLocation = &config.Location
+	}
+	setTargetResource(&endpoint, config.TargetResourceID)
+	setAlwaysServe(&endpoint, config.AlwaysServe)
+	setCustomHeaders(&endpoint, config.CustomHeaders)
+	return endpoint
+}
+
+// endpointResourceType returns the ARM resource type of an endpoint type, which an endpoint
+// written as part of its profile must carry, e.g. Microsoft.Network/trafficManagerProfiles/externalEndpoints
+func endpointResourceType(endpointType string) string {
+	if endpointType == "" {
+		return ""
+	}
+	return profileResourceType + "/" + strings.ToLower(endpointType[:1]) + endpointType[1:]
+}
+
+// setTargetResource points an AzureEndpoints endpoint at a resource. Azure takes the target
+// from the resource, so the endpoint doesn't set one itself.
+func setTargetResource(endpoint *armtrafficmanager.Endpoint, resourceID string) {
+	if resourceID == "" {
+		return
+	}
+	endpoint.Properties.TargetResourceID = &resourceID
+	endpoint.Properties.Target = nil
+}
+
+// setAlwaysServe stops Azure probing an endpoint, which then always counts as healthy
+func setAlwaysServe(endpoint *armtrafficmanager.Endpoint, alwaysServe bool) {
+	if !alwaysServe {
+		return
+	}
+	enabled := armtrafficmanager.AlwaysServeEnabled
+	endpoint.Properties.AlwaysServe = &enabled
+}
+
+// setCustomHeaders sets the HTTP headers Azure sends with an endpoint's health probes, in name order
+func setCustomHeaders(endpoint *armtrafficmanager.Endpoint, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		endpoint.Properties.CustomHeaders = append(endpoint.Properties.CustomHeaders, &armtrafficmanager.EndpointPropertiesCustomHeadersItem{
+			Name:  toStringPtr(name),
+			Value: toStringPtr(headers[name]),
+		})
+	}
+}
+
+// customHeadersOf returns an endpoint's custom headers by name, or nil when it has none
+func customHeadersOf(items []*armtrafficmanager.EndpointPropertiesCustomHeadersItem) map[string]string {
+	var headers map[string]string
+	for _, item := range items {
+		if item == nil || item.Name == nil {
+			continue
+		}
+		if headers == nil {
+			headers = make(map[string]string, len(items))
+		}
+		var value string
+		if item.Value != nil {
+			value = *item.Value
+		}
+		headers[*item.Name] = value
+	}
+	return headers
+}
+
 // toEndpointStatus converts a string status to SDK EndpointStatus
 func toEndpointStatus(status string) *armtrafficmanager.EndpointStatus {
 	s := armtrafficmanager.EndpointStatus(status)
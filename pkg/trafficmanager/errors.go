@@ -0,0 +1,142 @@
+package trafficmanager
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+// Kinds of Azure failure the client's errors are classified into; test for them with errors.Is
+var (
+	ErrProfileNotFound  = errors.New("traffic manager profile not found")
+	ErrEndpointNotFound = errors.New("traffic manager endpoint not found")
+	ErrThrottled        = errors.New("azure throttled the request")
+	ErrAuth             = errors.New("azure authentication or authorization failed")
+	ErrQuotaExceeded    = errors.New("azure quota exceeded")
+)
+
+// AzureError is an Azure failure classified as one of the Err* kinds. It unwraps to both the kind
+// and the SDK's error, so errors.As still finds the *azcore.ResponseError.
+type AzureError struct {
+	Kind error
+	Err  error
+}
+
+func (e *AzureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AzureError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// profileError classifies err from a profile operation, where a 404 means the profile is missing
+func profileError(err error) error {
+	return classify(err, ErrProfileNotFound)
+}
+
+// endpointError classifies err from an endpoint operation, where a 404 means the endpoint, or the
+// profile holding it, is missing
+func endpointError(err error) error {
+	return classify(err, ErrEndpointNotFound)
+}
+
+// classify wraps err in an AzureError when it is one of the known kinds of failure, with notFound
+// as the kind of a 404
+func classify(err, notFound error) error {
+	var classified *AzureError
+	if err == nil || errors.As(err, &classified) {
+		return err
+	}
+	if kind := kindOf(err, notFound); kind != nil {
+		return &AzureError{Kind: kind, Err: err}
+	}
+	return err
+}
+
+// kindOf returns the kind of failure err is, or nil when it is none of them
+func kindOf(err, notFound error) error {
+	switch status, code := responseOf(err); {
+	case isAuthFailure(err):
+		return ErrAuth
+	case status == http.StatusTooManyRequests:
+		return ErrThrottled
+	case isQuotaCode(code):
+		return ErrQuotaExceeded
+	case status == http.StatusNotFound:
+		return notFound
+	}
+	return nil
+}
+
+// responseOf returns the status and error code of the Azure response in err, if there is one
+func responseOf(err error) (int, string) {
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode, respErr.ErrorCode
+	}
+	return 0, ""
+}
+
+// isAuthFailure reports whether err is a failure to get a token, or a 401 or 403 from Azure
+func isAuthFailure(err error) bool {
+	var authErr *azidentity.AuthenticationFailedError
+	if errors.As(err, &authErr) {
+		return true
+	}
+	status, _ := responseOf(err)
+	return status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+// isQuotaCode reports whether an Azure error code reports a subscription quota or resource limit,
+// e.g. QuotaExceeded or MaxProfilesPerSubscriptionLimitExceeded
+func isQuotaCode(code string) bool {
+	code = strings.ToLower(code)
+	return strings.Contains(code, "quota") || strings.Contains(code, "limitexceeded") || strings.Contains(code, "limitreached")
+}
+
+// IsNotFound reports whether err is an Azure "resource not found" response
+func IsNotFound(err error) bool {
+	if errors.Is(err, ErrProfileNotFound) || errors.Is(err, ErrEndpointNotFound) {
+		return true
+	}
+	status, _ := responseOf(err)
+	return status == http.StatusNotFound
+}
+
+// IsThrottled reports whether err is an Azure "too many requests" response
+func IsThrottled(err error) bool {
+	return errors.Is(err, ErrThrottled) || kindOf(err, nil) == ErrThrottled
+}
+
+// IsQuotaExceeded reports whether err is Azure refusing a write over a quota or resource limit
+func IsQuotaExceeded(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded) || kindOf(err, nil) == ErrQuotaExceeded
+}
+
+// IsConflict reports whether err is an Azure "conflict" response, such as a relative DNS name already in use
+func IsConflict(err error) bool {
+	status, _ := responseOf(err)
+	return status == http.StatusConflict && !IsQuotaExceeded(err)
+}
+
+// IsPreconditionFailed reports whether err is an Azure "precondition failed" response, returned when
+// a write conditional on an ETag finds the resource was changed by another writer
+func IsPreconditionFailed(err error) bool {
+	status, _ := responseOf(err)
+	return status == http.StatusPreconditionFailed
+}
+
+// IsAuthorizationFailed reports whether err is an Azure authentication or authorization failure
+func IsAuthorizationFailed(err error) bool {
+	return errors.Is(err, ErrAuth) || kindOf(err, nil) == ErrAuth
+}
+
+// IsAzureError reports whether err is any error response from Azure Resource Manager
+func IsAzureError(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr)
+}
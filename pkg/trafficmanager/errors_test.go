@@ -0,0 +1,55 @@
+package trafficmanager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"not found", &azcore.ResponseError{StatusCode: http.StatusNotFound}, ErrProfileNotFound},
+		{"throttled", &azcore.ResponseError{StatusCode: http.StatusTooManyRequests}, ErrThrottled},
+		{"unauthorized", &azcore.ResponseError{StatusCode: http.StatusUnauthorized}, ErrAuth},
+		{"forbidden", &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "AuthorizationFailed"}, ErrAuth},
+		{"quota", &azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "QuotaExceeded"}, ErrQuotaExceeded},
+		{"limit", &azcore.ResponseError{StatusCode: http.StatusBadRequest, ErrorCode: "MaxProfilesPerSubscriptionLimitExceeded"}, ErrQuotaExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := fmt.Errorf("failed to get profile: %w", profileError(tt.err))
+			assert.ErrorIs(t, err, tt.want)
+
+			var respErr *azcore.ResponseError
+			assert.ErrorAs(t, err, &respErr, "the SDK's error is still wrapped")
+			assert.Equal(t, tt.err.Error(), errors.Unwrap(err).Error(), "the message is unchanged")
+		})
+	}
+
+	assert.ErrorIs(t, endpointError(&azcore.ResponseError{StatusCode: http.StatusNotFound}), ErrEndpointNotFound)
+	assert.NoError(t, profileError(nil))
+
+	conflict := &azcore.ResponseError{StatusCode: http.StatusConflict}
+	assert.Same(t, error(conflict), profileError(conflict), "unclassified errors are returned as they are")
+	assert.True(t, IsConflict(conflict))
+	assert.False(t, IsConflict(&azcore.ResponseError{StatusCode: http.StatusConflict, ErrorCode: "QuotaExceeded"}))
+
+	plain := errors.New("connection reset")
+	assert.Same(t, plain, classify(plain, nil))
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, IsNotFound(&azcore.ResponseError{StatusCode: http.StatusNotFound}))
+	assert.True(t, IsNotFound(fmt.Errorf("failed to delete endpoint: %w", endpointError(&azcore.ResponseError{StatusCode: http.StatusNotFound}))))
+	assert.False(t, IsNotFound(&azcore.ResponseError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, IsNotFound(errors.New("boom")))
+}
@@ -0,0 +1,56 @@
+package trafficmanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"go.uber.org/zap"
+)
+
+// profileWriteAttempts is how many times a read-modify-write of a profile is tried when another
+// writer, such as a webhook in another cluster or someone in the Azure portal, changes the
+// profile between the read and the write
+const profileWriteAttempts = 3
+
+// ErrProfileConflict is returned when another writer changes settings of a profile that a write
+// would otherwise overwrite
+var ErrProfileConflict = errors.New("profile settings were changed by another writer")
+
+// getProfile gets a profile with the ETag Azure returned for it. The ETag is empty when Azure
+// doesn't send one, and writes conditional on it are then unconditional.
+func (c *Client) getProfile(ctx context.Context, resourceGroup, profileName string) (armtrafficmanager.ProfilesClientGetResponse, string, error) {
+	var raw *http.Response
+	resp, err := c.profilesClient.Get(policy.WithCaptureResponse(ctx, &raw), resourceGroup, profileName, nil)
+	if err != nil || raw == nil {
+		return resp, "", err
+	}
+	return resp, raw.Header.Get("ETag"), nil
+}
+
+// ifMatch makes the request sent with ctx fail with 412 Precondition Failed unless the resource
+// still has etag
+func ifMatch(ctx context.Context, etag string) context.Context {
+	if etag == "" {
+		return ctx
+	}
+	return policy.WithHTTPHeader(ctx, http.Header{"If-Match": []string{etag}})
+}
+
+// retryOnProfileChange runs write, a read-modify-write of a profile that makes its write
+// conditional on the ETag it read, again with a fresh read when Azure rejects the write because
+// the profile changed in between
+func (c *Client) retryOnProfileChange(ctx context.Context, profileName string, write func() error) error {
+	var err error
+	for attempt := 1; attempt <= profileWriteAttempts; attempt++ {
+		if err = write(); !IsPreconditionFailed(err) {
+			return err
+		}
+		c.log(ctx).Warn("Profile was changed by another writer, retrying with a fresh copy",
+			zap.String("profileName", profileName),
+			zap.Int("attempt", attempt))
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package trafficmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestRetryOnProfileChange(t *testing.T) {
+	c := &Client{logger: zaptest.NewLogger(t)}
+	ctx := context.Background()
+	changed := fmt.Errorf("failed to update profile tags: %w", &azcore.ResponseError{StatusCode: http.StatusPreconditionFailed})
+
+	attempts := 0
+	err := c.retryOnProfileChange(ctx, "app-tm", func() error {
+		attempts++
+		if attempts < 2 {
+			return changed
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	attempts = 0
+	err = c.retryOnProfileChange(ctx, "app-tm", func() error {
+		attempts++
+		return changed
+	})
+	assert.True(t, IsPreconditionFailed(err))
+	assert.Equal(t, profileWriteAttempts, attempts)
+
+	attempts = 0
+	other := errors.New("boom")
+	err = c.retryOnProfileChange(ctx, "app-tm", func() error {
+		attempts++
+		return other
+	})
+	assert.ErrorIs(t, err, other)
+	assert.Equal(t, 1, attempts, "only precondition failures are retried")
+}
+
+func TestIfMatch(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ctx, ifMatch(ctx, ""), "writes without an ETag are unconditional")
+	assert.NotEqual(t, ctx, ifMatch(ctx, `W/"1"`))
+}
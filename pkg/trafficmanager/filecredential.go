@@ -0,0 +1,113 @@
+package trafficmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"go.uber.org/zap"
+)
+
+// FileCredential is a TokenCredential built from files mounted from a Kubernetes Secret.
+// Kubernetes updates mounted secrets in place when they rotate; Watch notices the new
+// contents and rebuilds the underlying credential without a restart.
+type FileCredential struct {
+	mu      sync.RWMutex
+	current azcore.TokenCredential
+	digest  string
+	paths   []string
+	build   func() (azcore.TokenCredential, error)
+}
+
+// NewFileCredential builds a credential from files using build, recording their contents
+// so later changes can be detected
+func NewFileCredential(paths []string, build func() (azcore.TokenCredential, error)) (*FileCredential, error) {
+	c := &FileCredential{paths: paths, build: build}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetToken gets a token from the current credential
+func (c *FileCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	c.mu.RLock()
+	current := c.current
+	c.mu.RUnlock()
+
+	return current.GetToken(ctx, options)
+}
+
+// Reload rebuilds the credential if the files changed since the last build.
+// It reports whether the credential was replaced. On error the previous credential is kept.
+func (c *FileCredential) Reload() (bool, error) {
+	digest, err := c.fileDigest()
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.current != nil && digest == c.digest
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cred, err := c.build()
+	if err != nil {
+		return false, fmt.Errorf("failed to build credential from files: %w", err)
+	}
+
+	c.mu.Lock()
+	c.current = cred
+	c.digest = digest
+	c.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch checks the files every interval and rebuilds the credential when they change,
+// until ctx is cancelled
+func (c *FileCredential) Watch(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.Reload()
+			if err != nil {
+				// Secrets can be briefly inconsistent mid-rotation; keep the old credential and retry
+				logger.Warn("Failed to reload Azure credential from files",
+					zap.Strings("paths", c.paths),
+					zap.Error(err))
+				continue
+			}
+			if reloaded {
+				logger.Info("Reloaded Azure credential after mounted secret changed",
+					zap.Strings("paths", c.paths))
+			}
+		}
+	}
+}
+
+// fileDigest hashes the contents of all watched files
+func (c *FileCredential) fileDigest() (string, error) {
+	hash := sha256.New()
+	for _, path := range c.paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read credential file %s: %w", path, err)
+		}
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,96 @@
+package trafficmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticCredential returns a fixed token
+type staticCredential string
+
+func (s staticCredential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: string(s)}, nil
+}
+
+func TestFileCredential_ReloadsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client-secret")
+	require.NoError(t, os.WriteFile(path, []byte("first"), 0o600))
+
+	builds := 0
+	cred, err := NewFileCredential([]string{path}, func() (azcore.TokenCredential, error) {
+		builds++
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return staticCredential(data), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, builds)
+
+	token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "first", token.Token)
+
+	// Unchanged files don't rebuild
+	reloaded, err := cred.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+	assert.Equal(t, 1, builds)
+
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0o600))
+	reloaded, err = cred.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+
+	token, err = cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "second", token.Token)
+}
+
+func TestFileCredential_KeepsPreviousOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client-secret")
+	require.NoError(t, os.WriteFile(path, []byte("first"), 0o600))
+
+	cred, err := NewFileCredential([]string{path}, func() (azcore.TokenCredential, error) {
+		return staticCredential("first"), nil
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(path))
+	_, err = cred.Reload()
+	assert.Error(t, err)
+
+	token, err := cred.GetToken(context.Background(), policy.TokenRequestOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "first", token.Token)
+}
+
+func TestGetAzureCredential_ClientSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client-secret")
+	require.NoError(t, os.WriteFile(path, []byte("secret\n"), 0o600))
+
+	cred, err := GetAzureCredential(CredentialConfig{
+		AuthMode:         AuthModeClientSecret,
+		TenantID:         "00000000-0000-0000-0000-000000000001",
+		ClientID:         "00000000-0000-0000-0000-000000000002",
+		ClientSecretFile: path,
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &FileCredential{}, cred)
+
+	_, err = GetAzureCredential(CredentialConfig{
+		AuthMode:              AuthModeClientCertificate,
+		TenantID:              "00000000-0000-0000-0000-000000000001",
+		ClientID:              "00000000-0000-0000-0000-000000000002",
+		ClientCertificateFile: path,
+	})
+	assert.ErrorContains(t, err, "failed to parse client certificate")
+}
@@ -0,0 +1,103 @@
+package trafficmanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"go.uber.org/zap"
+)
+
+// HeatMap is the Traffic View data of a profile: where its DNS queries came from over a time
+// window, and which endpoints answered them
+type HeatMap struct {
+	StartTime time.Time     `json:"startTime"`
+	EndTime   time.Time     `json:"endTime"`
+	Flows     []TrafficFlow `json:"flows"`
+}
+
+// TrafficFlow is the queries from one source resolver
+type TrafficFlow struct {
+	SourceIP  string            `json:"sourceIp"`
+	Latitude  float64           `json:"latitude"`
+	Longitude float64           `json:"longitude"`
+	Queries   []QueryExperience `json:"queries"`
+}
+
+// QueryExperience is the queries from a source that one endpoint answered
+type QueryExperience struct {
+	EndpointName string  `json:"endpointName"`
+	QueryCount   int64   `json:"queryCount"`
+	Latency      float64 `json:"latencyMs,omitempty"` // Measured latency in milliseconds, 0 when unknown
+}
+
+// GetHeatMap reads the Traffic View heat map of a profile enrolled in Traffic View
+func (c *Client) GetHeatMap(ctx context.Context, resourceGroup, profileName string) (*HeatMap, error) {
+	c.log(ctx).Debug("Getting Traffic View heat map",
+		zap.String("profileName", profileName))
+
+	resp, err := c.heatMapClient.Get(ctx, resourceGroup, profileName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get heat map: %w", profileError(err))
+	}
+	return heatMapToModel(&resp.HeatMapModel), nil
+}
+
+// heatMapToModel converts an Azure heat map, naming the endpoints its query experiences refer to by ID
+func heatMapToModel(model *armtrafficmanager.HeatMapModel) *HeatMap {
+	heatMap := &HeatMap{Flows: []TrafficFlow{}}
+	if model.Properties == nil {
+		return heatMap
+	}
+	if model.Properties.StartTime != nil {
+		heatMap.StartTime = *model.Properties.StartTime
+	}
+	if model.Properties.EndTime != nil {
+		heatMap.EndTime = *model.Properties.EndTime
+	}
+
+	names := make(map[int32]string, len(model.Properties.Endpoints))
+	for _, endpoint := range model.Properties.Endpoints {
+		if endpoint == nil || endpoint.EndpointID == nil || endpoint.ResourceID == nil {
+			continue
+		}
+		id := *endpoint.ResourceID
+		names[*endpoint.EndpointID] = id[strings.LastIndex(id, "/")+1:]
+	}
+
+	for _, flow := range model.Properties.TrafficFlows {
+		if flow == nil {
+			continue
+		}
+		converted := TrafficFlow{Queries: make([]QueryExperience, 0, len(flow.QueryExperiences))}
+		if flow.SourceIP != nil {
+			converted.SourceIP = *flow.SourceIP
+		}
+		if flow.Latitude != nil {
+			converted.Latitude = *flow.Latitude
+		}
+		if flow.Longitude != nil {
+			converted.Longitude = *flow.Longitude
+		}
+		for _, query := range flow.QueryExperiences {
+			if query == nil || query.EndpointID == nil {
+				continue
+			}
+			experience := QueryExperience{EndpointName: names[*query.EndpointID]}
+			if experience.EndpointName == "" {
+				experience.EndpointName = fmt.Sprintf("%d", *query.EndpointID)
+			}
+			if query.QueryCount != nil {
+				experience.QueryCount = int64(*query.QueryCount)
+			}
+			if query.Latency != nil {
+				experience.Latency = *query.Latency
+			}
+			converted.Queries = append(converted.Queries, experience)
+		}
+		heatMap.Flows = append(heatMap.Flows, converted)
+	}
+	return heatMap
+}
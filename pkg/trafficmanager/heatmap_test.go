@@ -0,0 +1,46 @@
+package trafficmanager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeatMapToModel(t *testing.T) {
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	id := func(v int32) *int32 { return &v }
+	float := func(v float64) *float64 { return &v }
+
+	heatMap := heatMapToModel(&armtrafficmanager.HeatMapModel{Properties: &armtrafficmanager.HeatMapProperties{
+		StartTime: &start,
+		Endpoints: []*armtrafficmanager.HeatMapEndpoint{
+			{EndpointID: id(1), ResourceID: toStringPtr("/subscriptions/x/resourceGroups/rg/providers/Microsoft.Network/trafficManagerProfiles/app/externalEndpoints/east")},
+		},
+		TrafficFlows: []*armtrafficmanager.TrafficFlow{
+			{
+				SourceIP:  toStringPtr("192.0.2.1"),
+				Latitude:  float(51.5),
+				Longitude: float(-0.1),
+				QueryExperiences: []*armtrafficmanager.QueryExperience{
+					{EndpointID: id(1), QueryCount: id(12), Latency: float(23.5)},
+					{EndpointID: id(7), QueryCount: id(3)},
+				},
+			},
+		},
+	}})
+
+	assert.Equal(t, start, heatMap.StartTime)
+	require.Len(t, heatMap.Flows, 1)
+	flow := heatMap.Flows[0]
+	assert.Equal(t, "192.0.2.1", flow.SourceIP)
+	assert.Equal(t, 51.5, flow.Latitude)
+	assert.Equal(t, []QueryExperience{
+		{EndpointName: "east", QueryCount: 12, Latency: 23.5},
+		{EndpointName: "7", QueryCount: 3},
+	}, flow.Queries, "endpoints missing from the heat map are named by their ID")
+
+	assert.Empty(t, heatMapToModel(&armtrafficmanager.HeatMapModel{}).Flows)
+}
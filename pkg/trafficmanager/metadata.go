@@ -0,0 +1,265 @@
+package trafficmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"go.uber.org/zap"
+)
+
+const (
+	// EndpointMetadataTag is the profile tag holding per-endpoint metadata as a JSON map keyed by
+	// endpoint name. Metadata that doesn't fit one tag continues in endpointMetadata2, endpointMetadata3, ...
+	EndpointMetadataTag = "endpointMetadata"
+
+	// MaxTagValueLength is the Azure limit for resource tag values
+	MaxTagValueLength = 256
+
+	// MaxTagsPerResource is the Azure limit for tags on one resource
+	MaxTagsPerResource = 50
+)
+
+// ErrEndpointMetadataTooLarge is returned when endpoint metadata can't be saved in the profile's
+// tags at all. Unlike a failed request, trying again won't help.
+var ErrEndpointMetadataTooLarge = errors.New("endpoint metadata doesn't fit the profile's tags")
+
+// endpointMetadataTagKey returns the key of the i-th endpoint metadata tag, counting from 0
+func endpointMetadataTagKey(i int) string {
+	if i == 0 {
+		return EndpointMetadataTag
+	}
+	return EndpointMetadataTag + strconv.Itoa(i+1)
+}
+
+// IsEndpointMetadataTag reports whether key is one of the profile tags holding endpoint metadata
+func IsEndpointMetadataTag(key string) bool {
+	suffix, ok := strings.CutPrefix(key, EndpointMetadataTag)
+	if !ok {
+		return false
+	}
+	if suffix == "" {
+		return true
+	}
+	n, err := strconv.Atoi(suffix)
+	return err == nil && n >= 2 && strconv.Itoa(n) == suffix
+}
+
+// endpointMetadataValues returns the values of the endpoint metadata tags in tags
+func endpointMetadataValues(tags map[string]string) []string {
+	var values []string
+	for key, value := range tags {
+		if IsEndpointMetadataTag(key) {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// EncodeEndpointMetadata serializes per-endpoint metadata into profile tag values. Endpoints are
+// packed in name order into as few values as fit Azure's tag value limit, each a JSON map of its
+// own, so a value can be read without the others. An endpoint whose metadata alone is too long is
+// trimmed by FitEndpointMetadata, and left out if even that doesn't fit.
+func EncodeEndpointMetadata(metadata map[string]*state.EndpointMetadata) ([]string, error) {
+	names := make([]string, 0, len(metadata))
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var values []string
+	chunk := make(map[string]*state.EndpointMetadata)
+	encoded := ""
+	for _, name := range names {
+		fitted, ok := FitEndpointMetadata(name, metadata[name])
+		if !ok {
+			continue
+		}
+		chunk[name] = fitted
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode endpoint metadata: %w", err)
+		}
+		if len(data) > MaxTagValueLength {
+			// Close the value before this endpoint and start the next one with it
+			values = append(values, encoded)
+			chunk = map[string]*state.EndpointMetadata{name: fitted}
+			if data, err = json.Marshal(chunk); err != nil {
+				return nil, fmt.Errorf("failed to encode endpoint metadata: %w", err)
+			}
+		}
+		encoded = string(data)
+	}
+	if len(chunk) > 0 {
+		values = append(values, encoded)
+	}
+
+	return values, nil
+}
+
+// FitEndpointMetadata returns the metadata of an endpoint as it is saved: whole if it fits one tag
+// value, otherwise a copy with optional fields dropped until it does. The Service and its readiness
+// go first, then the schedules, the namespace and the weight; the cluster, which decides ownership,
+// is kept. It returns false when even the cluster alone is too long to save.
+func FitEndpointMetadata(endpointName string, metadata *state.EndpointMetadata) (*state.EndpointMetadata, bool) {
+	if metadata == nil || endpointMetadataFits(endpointName, metadata) {
+		return metadata, true
+	}
+
+	fitted := *metadata
+	for _, drop := range []func(*state.EndpointMetadata){
+		func(m *state.EndpointMetadata) { m.Service, m.NotReady = "", false },
+		func(m *state.EndpointMetadata) { m.DisableSchedule, m.EnableSchedule = "", "" },
+		func(m *state.EndpointMetadata) { m.Namespace = "" },
+		func(m *state.EndpointMetadata) { m.Weight = 0 },
+	} {
+		drop(&fitted)
+		if endpointMetadataFits(endpointName, &fitted) {
+			return &fitted, true
+		}
+	}
+	return nil, false
+}
+
+// endpointMetadataFits reports whether an endpoint's metadata fits one tag value on its own
+func endpointMetadataFits(endpointName string, metadata *state.EndpointMetadata) bool {
+	data, err := json.Marshal(map[string]*state.EndpointMetadata{endpointName: metadata})
+	return err == nil && len(data) <= MaxTagValueLength
+}
+
+// DecodeEndpointMetadata parses profile tag values into per-endpoint metadata. Values that can't
+// be read are reported in the error; the metadata of the others is still returned.
+func DecodeEndpointMetadata(values ...string) (map[string]*state.EndpointMetadata, error) {
+	metadata := make(map[string]*state.EndpointMetadata)
+	var errs []error
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		var chunk map[string]*state.EndpointMetadata
+		if err := json.Unmarshal([]byte(value), &chunk); err != nil {
+			errs = append(errs, fmt.Errorf("failed to decode endpoint metadata: %w", err))
+			continue
+		}
+		maps.Copy(metadata, chunk)
+	}
+
+	return metadata, errors.Join(errs...)
+}
+
+// SetEndpointMetadata records metadata for an endpoint in the profile's metadata tag
+func (c *Client) SetEndpointMetadata(ctx context.Context, resourceGroup, profileName, endpointName string, metadata *state.EndpointMetadata) error {
+	return c.updateEndpointMetadata(ctx, resourceGroup, profileName, func(all map[string]*state.EndpointMetadata) {
+		all[endpointName] = metadata
+	})
+}
+
+// RemoveEndpointMetadata removes an endpoint's entry from the profile's metadata tag
+func (c *Client) RemoveEndpointMetadata(ctx context.Context, resourceGroup, profileName, endpointName string) error {
+	return c.updateEndpointMetadata(ctx, resourceGroup, profileName, func(all map[string]*state.EndpointMetadata) {
+		delete(all, endpointName)
+	})
+}
+
+// ReassignEndpointMetadata records endpoints created by cluster from as created by cluster to,
+// returning the names of the endpoints reassigned. Other entries in the tag are left untouched.
+func (c *Client) ReassignEndpointMetadata(ctx context.Context, resourceGroup, profileName, from, to string) ([]string, error) {
+	var reassigned []string
+	err := c.updateEndpointMetadata(ctx, resourceGroup, profileName, func(all map[string]*state.EndpointMetadata) {
+		for name, metadata := range all {
+			if metadata != nil && metadata.Cluster == from {
+				metadata.Cluster = to
+				reassigned = append(reassigned, name)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(reassigned)
+	return reassigned, nil
+}
+
+// updateEndpointMetadata reads the profile's metadata tag, applies mutate and patches the tags back
+func (c *Client) updateEndpointMetadata(ctx context.Context, resourceGroup, profileName string, mutate func(map[string]*state.EndpointMetadata)) error {
+	return c.retryOnProfileChange(ctx, profileName, func() error {
+		return c.writeEndpointMetadata(ctx, resourceGroup, profileName, mutate)
+	})
+}
+
+// writeEndpointMetadata performs one read-modify-write of the profile's metadata tag
+func (c *Client) writeEndpointMetadata(ctx context.Context, resourceGroup, profileName string, mutate func(map[string]*state.EndpointMetadata)) error {
+	resp, etag, err := c.getProfile(ctx, resourceGroup, profileName)
+	if err != nil {
+		return fmt.Errorf("failed to get profile: %w", profileError(err))
+	}
+
+	tags := resp.Tags
+	if tags == nil {
+		tags = make(map[string]*string)
+	}
+
+	// The metadata tags are written again from scratch, as the endpoints may pack differently
+	var current []string
+	for key, value := range tags {
+		if IsEndpointMetadataTag(key) {
+			if value != nil {
+				current = append(current, *value)
+			}
+			delete(tags, key)
+		}
+	}
+
+	metadata, err := DecodeEndpointMetadata(current...)
+	if err != nil {
+		// Drop the unreadable values rather than keep corrupt tags around
+		c.log(ctx).Warn("Discarding unreadable endpoint metadata tag",
+			zap.String("profileName", profileName),
+			zap.Error(err))
+	}
+
+	mutate(metadata)
+
+	values, err := EncodeEndpointMetadata(metadata)
+	if err != nil {
+		return err
+	}
+	if len(tags)+len(values) > MaxTagsPerResource {
+		return fmt.Errorf("%w: metadata of %d endpoints needs %d tags, but profile %s only has room for %d of Azure's %d tags",
+			ErrEndpointMetadataTooLarge, len(metadata), len(values), profileName, max(MaxTagsPerResource-len(tags), 0), MaxTagsPerResource)
+	}
+	for i := range values {
+		tags[endpointMetadataTagKey(i)] = &values[i]
+	}
+
+	_, err = c.profilesClient.Update(ifMatch(ctx, etag), resourceGroup, profileName, armtrafficmanager.Profile{Tags: tags}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to update profile tags: %w", profileError(err))
+	}
+
+	c.log(ctx).Debug("Updated endpoint metadata tag",
+		zap.String("profileName", profileName),
+		zap.Int("endpointCount", len(metadata)))
+
+	return nil
+}
+
+// preserveEndpointMetadata copies the metadata tags from an existing profile into tags,
+// so that a full profile PUT does not wipe metadata written by other clusters
+func preserveEndpointMetadata(existing *armtrafficmanager.Profile, tags map[string]string) {
+	if len(endpointMetadataValues(tags)) > 0 {
+		return
+	}
+	for key, value := range existing.Tags {
+		if IsEndpointMetadataTag(key) && value != nil {
+			tags[key] = *value
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package trafficmanager
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestEndpointMetadata_RoundTrip(t *testing.T) {
+	metadata := map[string]*state.EndpointMetadata{
+		"east": {Cluster: "aks-east", Namespace: "default", Weight: 100},
+		"west": {Cluster: "aks-west", Namespace: "apps", Weight: 50},
+	}
+
+	values, err := EncodeEndpointMetadata(metadata)
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	assert.LessOrEqual(t, len(values[0]), MaxTagValueLength)
+
+	decoded, err := DecodeEndpointMetadata(values...)
+	require.NoError(t, err)
+	assert.Equal(t, metadata, decoded)
+}
+
+func TestEndpointMetadata_SpreadAcrossTags(t *testing.T) {
+	metadata := make(map[string]*state.EndpointMetadata)
+	for i := 0; i < 12; i++ {
+		metadata[fmt.Sprintf("endpoint-%02d", i)] = &state.EndpointMetadata{Cluster: "aks-west-europe", Namespace: "payments", Weight: 100, Service: "checkout-api"}
+	}
+
+	values, err := EncodeEndpointMetadata(metadata)
+	require.NoError(t, err)
+	assert.Greater(t, len(values), 1)
+	for _, value := range values {
+		assert.LessOrEqual(t, len(value), MaxTagValueLength)
+	}
+
+	decoded, err := DecodeEndpointMetadata(values...)
+	require.NoError(t, err)
+	assert.Equal(t, metadata, decoded)
+
+	partial, err := DecodeEndpointMetadata(append(values, "not-json")...)
+	assert.Error(t, err)
+	assert.Equal(t, metadata, partial, "the readable values are kept")
+}
+
+func TestIsEndpointMetadataTag(t *testing.T) {
+	assert.True(t, IsEndpointMetadataTag(EndpointMetadataTag))
+	assert.Equal(t, "endpointMetadata2", endpointMetadataTagKey(1))
+	assert.True(t, IsEndpointMetadataTag(endpointMetadataTagKey(1)))
+	assert.True(t, IsEndpointMetadataTag("endpointMetadata12"))
+	assert.False(t, IsEndpointMetadataTag("endpointMetadata1"))
+	assert.False(t, IsEndpointMetadataTag("endpointMetadata02"))
+	assert.False(t, IsEndpointMetadataTag("endpointMetadataOwner"))
+	assert.False(t, IsEndpointMetadataTag("hostname"))
+}
+
+func TestEncodeEndpointMetadata_TooLarge(t *testing.T) {
+	metadata := map[string]*state.EndpointMetadata{
+		strings.Repeat("e", 300): {Cluster: "aks-east"},
+		"west":                   {Cluster: "aks-west"},
+	}
+
+	values, err := EncodeEndpointMetadata(metadata)
+	require.NoError(t, err)
+	decoded, err := DecodeEndpointMetadata(values...)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*state.EndpointMetadata{"west": {Cluster: "aks-west"}}, decoded, "metadata that can't fit is left out")
+}
+
+func TestFitEndpointMetadata(t *testing.T) {
+	// Namespace and Service names at Kubernetes' 63 character limit, with both schedules
+	metadata := &state.EndpointMetadata{
+		Cluster:         "aks-west-europe-production",
+		Namespace:       strings.Repeat("n", 63),
+		Weight:          100,
+		Service:         strings.Repeat("s", 63),
+		DisableSchedule: "0 22 * * MON-FRI Europe/Amsterdam",
+		EnableSchedule:  "0 6 * * MON-FRI Europe/Amsterdam",
+	}
+
+	fitted, ok := FitEndpointMetadata("east", metadata)
+	require.True(t, ok)
+	assert.Empty(t, fitted.Service, "the Service is dropped first")
+	assert.Equal(t, metadata.DisableSchedule, fitted.DisableSchedule)
+	assert.Equal(t, metadata.Namespace, fitted.Namespace)
+	assert.Equal(t, metadata.Cluster, fitted.Cluster)
+	assert.Equal(t, strings.Repeat("s", 63), metadata.Service, "the metadata passed in is left alone")
+
+	values, err := EncodeEndpointMetadata(map[string]*state.EndpointMetadata{"east": metadata})
+	require.NoError(t, err)
+	decoded, err := DecodeEndpointMetadata(values...)
+	require.NoError(t, err)
+	assert.Equal(t, fitted, decoded["east"])
+
+	fitted, ok = FitEndpointMetadata(strings.Repeat("e", 215), metadata)
+	require.True(t, ok)
+	assert.Equal(t, &state.EndpointMetadata{Cluster: metadata.Cluster}, fitted, "the cluster is kept to the last")
+
+	small := &state.EndpointMetadata{Cluster: "aks-east", Service: "api"}
+	fitted, ok = FitEndpointMetadata("east", small)
+	require.True(t, ok)
+	assert.Same(t, small, fitted)
+
+	_, ok = FitEndpointMetadata(strings.Repeat("e", 300), &state.EndpointMetadata{Cluster: "aks-east"})
+	assert.False(t, ok)
+}
+
+func TestDecodeEndpointMetadata_Empty(t *testing.T) {
+	decoded, err := DecodeEndpointMetadata("")
+	require.NoError(t, err)
+	assert.Empty(t, decoded)
+}
+
+func TestDecodeEndpointMetadata_Invalid(t *testing.T) {
+	_, err := DecodeEndpointMetadata("not-json")
+	assert.Error(t, err)
+}
+
+func TestSetEndpointMetadata_SpreadAcrossTags(t *testing.T) {
+	azure := fakeazure.New()
+	name, managedBy := "app-tm", DefaultManagedByValue
+	azure.AddProfile("sub", "tm-rg", armtrafficmanager.Profile{Name: &name, Tags: map[string]*string{DefaultManagedByTag: &managedBy}})
+	client, err := NewClient("sub", fakeazure.Credential{}, ClientOptions{Transport: azure}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for i := 0; i < 12; i++ {
+		metadata := &state.EndpointMetadata{Cluster: "aks-west-europe", Namespace: "payments", Weight: 100, Service: "checkout-api"}
+		require.NoError(t, client.SetEndpointMetadata(ctx, "tm-rg", "app-tm", fmt.Sprintf("endpoint-%02d", i), metadata))
+	}
+	tags := azure.Profile("sub", "tm-rg", "app-tm").Tags
+	require.Contains(t, tags, "endpointMetadata2")
+	values := make(map[string]string)
+	for key, value := range tags {
+		values[key] = *value
+	}
+	decoded, err := DecodeEndpointMetadata(endpointMetadataValues(values)...)
+	require.NoError(t, err)
+	assert.Len(t, decoded, 12)
+
+	// Removing endpoints drops the tags that are no longer needed
+	for i := 1; i < 12; i++ {
+		require.NoError(t, client.RemoveEndpointMetadata(ctx, "tm-rg", "app-tm", fmt.Sprintf("endpoint-%02d", i)))
+	}
+	tags = azure.Profile("sub", "tm-rg", "app-tm").Tags
+	assert.Contains(t, tags, EndpointMetadataTag)
+	assert.NotContains(t, tags, "endpointMetadata2")
+}
+
+func TestSetEndpointMetadata_NoRoomForTags(t *testing.T) {
+	azure := fakeazure.New()
+	name := "app-tm"
+	tags := make(map[string]*string)
+	for i := 0; i < MaxTagsPerResource; i++ {
+		value := "x"
+		tags[fmt.Sprintf("custom%d", i)] = &value
+	}
+	azure.AddProfile("sub", "tm-rg", armtrafficmanager.Profile{Name: &name, Tags: tags})
+	client, err := NewClient("sub", fakeazure.Credential{}, ClientOptions{Transport: azure}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	err = client.SetEndpointMetadata(context.Background(), "tm-rg", "app-tm", "east", &state.EndpointMetadata{Cluster: "aks-east"})
+	assert.ErrorIs(t, err, ErrEndpointMetadataTooLarge)
+	assert.ErrorContains(t, err, "only has room for 0 of Azure's 50 tags")
+}
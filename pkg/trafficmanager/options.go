@@ -0,0 +1,97 @@
+package trafficmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+// MaxUserAgentLength is the longest user agent Azure SDK requests carry; longer ones are cut
+const MaxUserAgentLength = 24
+
+// ClientOptions tunes the HTTP pipeline of the webhook's Azure clients. The zero value uses the
+// public cloud and the SDK's defaults.
+type ClientOptions struct {
+	Cloud cloud.Configuration
+
+	// Prefixed to the User-Agent header so Azure support can find the webhook's requests
+	UserAgent string
+
+	// Retries of a failed request and the delays between them; 0 uses the SDK's defaults of
+	// 3 retries from 800ms up to 60s, and negative MaxRetries disables retries
+	MaxRetries    int32
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// Traffic Manager API version; empty uses the version the SDK was generated for
+	APIVersion string
+
+	// HTTP proxy for requests to Azure; empty uses HTTPS_PROXY and NO_PROXY from the environment
+	ProxyURL string
+
+	// Limit on write requests, shared by every client built from these options; nil is unlimited
+	WriteLimiter *WriteLimiter
+
+	// Sends requests instead of an HTTP client, such as an in-memory Azure in tests; takes
+	// precedence over ProxyURL
+	Transport policy.Transporter
+}
+
+// Validate checks the options that can be wrong
+func (o ClientOptions) Validate() error {
+	if len(o.UserAgent) > MaxUserAgentLength {
+		return fmt.Errorf("user agent %q is longer than %d characters", o.UserAgent, MaxUserAgentLength)
+	}
+	_, err := o.transport()
+	return err
+}
+
+// ARM returns the ARM client options for o. The API version is left out, as it only applies to
+// the Traffic Manager clients.
+func (o ClientOptions) ARM() (*arm.ClientOptions, error) {
+	transport, err := o.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	options := &arm.ClientOptions{}
+	options.Cloud = o.Cloud
+	options.Telemetry.ApplicationID = o.UserAgent
+	options.Retry = policy.RetryOptions{
+		MaxRetries:    o.MaxRetries,
+		RetryDelay:    o.RetryDelay,
+		MaxRetryDelay: o.MaxRetryDelay,
+	}
+	if transport != nil {
+		options.Transport = transport
+	}
+	if o.Transport != nil {
+		options.Transport = o.Transport
+	}
+	if o.WriteLimiter != nil {
+		// Per retry, so retried writes wait for a token too
+		options.PerRetryPolicies = append(options.PerRetryPolicies, o.WriteLimiter)
+	}
+	return options, nil
+}
+
+// transport returns an HTTP client sending requests through ProxyURL, or nil without one
+func (o ClientOptions) transport() (*http.Client, error) {
+	if o.ProxyURL == "" {
+		return nil, nil
+	}
+
+	proxy, err := url.Parse(o.ProxyURL)
+	if err != nil || proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", o.ProxyURL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxy)
+	return &http.Client{Transport: transport}, nil
+}
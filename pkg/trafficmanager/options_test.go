@@ -0,0 +1,50 @@
+package trafficmanager
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOptionsARM(t *testing.T) {
+	options, err := ClientOptions{}.ARM()
+	require.NoError(t, err)
+	assert.Equal(t, cloud.Configuration{}, options.Cloud)
+	assert.Nil(t, options.Transport, "the SDK's default transport is kept without a proxy")
+
+	options, err = ClientOptions{
+		Cloud:         cloud.AzureChina,
+		UserAgent:     "contoso-dns",
+		MaxRetries:    5,
+		RetryDelay:    time.Second,
+		MaxRetryDelay: 30 * time.Second,
+		APIVersion:    "2022-04-01",
+		ProxyURL:      "http://proxy.internal:3128",
+	}.ARM()
+	require.NoError(t, err)
+	assert.Equal(t, cloud.AzureChina, options.Cloud)
+	assert.Equal(t, "contoso-dns", options.Telemetry.ApplicationID)
+	assert.Equal(t, int32(5), options.Retry.MaxRetries)
+	assert.Equal(t, time.Second, options.Retry.RetryDelay)
+	assert.Equal(t, 30*time.Second, options.Retry.MaxRetryDelay)
+	assert.Empty(t, options.APIVersion, "the API version only applies to Traffic Manager clients")
+
+	client, ok := options.Transport.(*http.Client)
+	require.True(t, ok)
+	request, err := http.NewRequest(http.MethodGet, "https://management.chinacloudapi.cn", nil)
+	require.NoError(t, err)
+	proxy, err := client.Transport.(*http.Transport).Proxy(request)
+	require.NoError(t, err)
+	assert.Equal(t, "proxy.internal:3128", proxy.Host)
+}
+
+func TestClientOptionsValidate(t *testing.T) {
+	assert.NoError(t, ClientOptions{UserAgent: "external-dns-tm"}.Validate())
+	assert.ErrorContains(t, ClientOptions{UserAgent: "external-dns-traffic-manager"}.Validate(), "longer than 24 characters")
+	assert.ErrorContains(t, ClientOptions{ProxyURL: "proxy.internal"}.Validate(), "invalid proxy URL")
+	assert.ErrorContains(t, ClientOptions{ProxyURL: "http://[::1"}.Validate(), "invalid proxy URL")
+}
@@ -0,0 +1,101 @@
+package trafficmanager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+)
+
+const (
+	// permissionsAPIVersion is the Microsoft.Authorization API version used to read the caller's permissions
+	permissionsAPIVersion = "2022-04-01"
+
+	// ContributorRole is the built-in role granting every action in RequiredActions
+	ContributorRole = "Traffic Manager Contributor"
+)
+
+// RequiredActions are the Azure actions the webhook uses on the profiles of a resource group
+var RequiredActions = []string{
+	"Microsoft.Network/trafficManagerProfiles/read",
+	"Microsoft.Network/trafficManagerProfiles/write",
+	"Microsoft.Network/trafficManagerProfiles/delete",
+	"Microsoft.Network/trafficManagerProfiles/externalEndpoints/write",
+	"Microsoft.Network/trafficManagerProfiles/externalEndpoints/delete",
+	"Microsoft.Network/trafficManagerProfiles/azureEndpoints/write",
+	"Microsoft.Network/trafficManagerProfiles/azureEndpoints/delete",
+}
+
+// permission is one entry of the caller's permissions on a scope
+type permission struct {
+	Actions    []string `json:"actions"`
+	NotActions []string `json:"notActions"`
+}
+
+type permissionList struct {
+	Value    []permission `json:"value"`
+	NextLink string       `json:"nextLink"`
+}
+
+// MissingActions reads the identity's effective permissions on a resource group and returns the
+// RequiredActions they don't grant, in order. Nothing is written, so it can run on a schedule.
+func (c *Client) MissingActions(ctx context.Context, resourceGroup string) ([]string, error) {
+	endpoint := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Authorization/permissions?api-version=%s",
+		strings.TrimSuffix(c.armClient.Endpoint(), "/"), url.PathEscape(c.subscriptionID), url.PathEscape(resourceGroup), permissionsAPIVersion)
+
+	var permissions []permission
+	for endpoint != "" {
+		req, err := runtime.NewRequest(ctx, http.MethodGet, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.armClient.Pipeline().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read permissions on resource group %s: %w", resourceGroup, classify(err, nil))
+		}
+		if !runtime.HasStatusCode(resp, http.StatusOK) {
+			return nil, fmt.Errorf("failed to read permissions on resource group %s: %w", resourceGroup, classify(runtime.NewResponseError(resp), nil))
+		}
+
+		var page permissionList
+		if err := runtime.UnmarshalAsJSON(resp, &page); err != nil {
+			return nil, fmt.Errorf("failed to read permissions on resource group %s: %w", resourceGroup, err)
+		}
+		permissions = append(permissions, page.Value...)
+		endpoint = page.NextLink
+	}
+
+	var missing []string
+	for _, action := range RequiredActions {
+		if !permitted(permissions, action) {
+			missing = append(missing, action)
+		}
+	}
+	return missing, nil
+}
+
+// permitted reports whether any permission allows action without also excluding it
+func permitted(permissions []permission, action string) bool {
+	for _, p := range permissions {
+		if matchesAnyAction(p.Actions, action) && !matchesAnyAction(p.NotActions, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyAction reports whether one of patterns matches action. Actions are compared without
+// case, and * in a pattern matches any characters, as in Azure role definitions.
+func matchesAnyAction(patterns []string, action string) bool {
+	for _, pattern := range patterns {
+		expr := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+		if matched, _ := regexp.MatchString(expr, action); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package trafficmanager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermitted(t *testing.T) {
+	contributor := []permission{{Actions: []string{"Microsoft.Network/trafficManagerProfiles/*"}}}
+	readOnly := []permission{{Actions: []string{"*/read"}}}
+	excluded := []permission{{
+		Actions:    []string{"*"},
+		NotActions: []string{"Microsoft.Network/trafficManagerProfiles/*/delete"},
+	}}
+
+	tests := []struct {
+		name        string
+		permissions []permission
+		action      string
+		want        bool
+	}{
+		{"wildcard resource type", contributor, "Microsoft.Network/trafficManagerProfiles/write", true},
+		{"wildcard nested type", contributor, "Microsoft.Network/trafficManagerProfiles/externalEndpoints/delete", true},
+		{"case-insensitive", contributor, "microsoft.network/TRAFFICMANAGERPROFILES/read", true},
+		{"other resource type", contributor, "Microsoft.Network/dnszones/write", false},
+		{"read-only reads", readOnly, "Microsoft.Network/trafficManagerProfiles/read", true},
+		{"read-only writes", readOnly, "Microsoft.Network/trafficManagerProfiles/write", false},
+		{"not action", excluded, "Microsoft.Network/trafficManagerProfiles/azureEndpoints/delete", false},
+		{"outside not action", excluded, "Microsoft.Network/trafficManagerProfiles/delete", true},
+		{"no permissions", nil, "Microsoft.Network/trafficManagerProfiles/read", false},
+		{"pattern is not a regexp", []permission{{Actions: []string{"Microsoft.Network/trafficManagerProfiles/.+"}}}, "Microsoft.Network/trafficManagerProfiles/read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, permitted(tt.permissions, tt.action))
+		})
+	}
+}
@@ -3,6 +3,10 @@ package trafficmanager
 import (
 	"context"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
@@ -11,48 +15,20 @@ import (
 
 // CreateProfile creates a new Traffic Manager profile
 func (c *Client) CreateProfile(ctx context.Context, config *ProfileConfig) (*ProfileState, error) {
-	c.logger.Info("Creating Traffic Manager profile",
+	c.log(ctx).Info("Creating Traffic Manager profile",
 		zap.String("profileName", config.ProfileName),
 		zap.String("resourceGroup", config.ResourceGroup),
 		zap.String("routingMethod", config.RoutingMethod),
 		zap.String("location", config.Location),
 		zap.Int64("dnsttl", config.DNSTTL))
 
-	// Convert routing method to SDK type
-	routingMethod := armtrafficmanager.TrafficRoutingMethod(config.RoutingMethod)
-
-	// Build profile properties
-	profile := armtrafficmanager.Profile{
-		Location: toStringPtr(config.Location),
-		Properties: &armtrafficmanager.ProfileProperties{
-			TrafficRoutingMethod: &routingMethod,
-			DNSConfig: &armtrafficmanager.DNSConfig{
-				RelativeName: &config.ProfileName,
-				TTL:          &config.DNSTTL,
-			},
-			MonitorConfig: &armtrafficmanager.MonitorConfig{
-				Protocol: toMonitorProtocol(config.MonitorProtocol),
-				Port:     &config.MonitorPort,
-				Path:     &config.MonitorPath,
-			},
-			ProfileStatus: toProfileStatus(getProfileStatus(config.HealthChecksEnabled)),
-		},
-		Tags: toStringMapPtr(config.Tags),
-	}
-
 	// Create the profile
-	resp, err := c.profilesClient.CreateOrUpdate(
-		ctx,
-		config.ResourceGroup,
-		config.ProfileName,
-		profile,
-		nil,
-	)
+	resp, err := c.putProfile(ctx, config, newProfile(config), nil, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create profile: %w", err)
+		return nil, fmt.Errorf("failed to create profile: %w", profileError(err))
 	}
 
-	c.logger.Info("Successfully created Traffic Manager profile",
+	c.log(ctx).Info("Successfully created Traffic Manager profile",
 		zap.String("profileName", config.ProfileName),
 		zap.String("fqdn", *resp.Properties.DNSConfig.Fqdn))
 
@@ -61,30 +37,28 @@ func (c *Client) CreateProfile(ctx context.Context, config *ProfileConfig) (*Pro
 
 // GetProfile retrieves a Traffic Manager profile
 func (c *Client) GetProfile(ctx context.Context, resourceGroup, profileName string) (*ProfileState, error) {
-	c.logger.Debug("Getting Traffic Manager profile",
+	c.log(ctx).Debug("Getting Traffic Manager profile",
 		zap.String("profileName", profileName),
 		zap.String("resourceGroup", resourceGroup))
 
-	resp, err := c.profilesClient.Get(ctx, resourceGroup, profileName, nil)
+	resp, etag, err := c.getProfile(ctx, resourceGroup, profileName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get profile: %w", err)
+		return nil, fmt.Errorf("failed to get profile: %w", profileError(err))
 	}
 
-	return profileResponseToState(resourceGroup, &resp.Profile), nil
+	state := profileResponseToState(resourceGroup, &resp.Profile)
+	state.ETag = etag
+	return state, nil
 }
 
-// UpdateProfile updates an existing Traffic Manager profile
+// UpdateProfile updates an existing Traffic Manager profile. If another writer changes the
+// profile's settings while the update is being written, it fails with ErrProfileConflict rather
+// than overwriting them; changes to endpoint metadata alone are merged and the write retried.
 func (c *Client) UpdateProfile(ctx context.Context, config *ProfileConfig) (*ProfileState, error) {
-	c.logger.Info("Updating Traffic Manager profile",
+	c.log(ctx).Info("Updating Traffic Manager profile",
 		zap.String("profileName", config.ProfileName),
 		zap.String("resourceGroup", config.ResourceGroup))
 
-	// Get existing profile first
-	existing, err := c.GetProfile(ctx, config.ResourceGroup, config.ProfileName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get existing profile: %w", err)
-	}
-
 	// Update only changed fields
 	routingMethod := armtrafficmanager.TrafficRoutingMethod(config.RoutingMethod)
 	profile := armtrafficmanager.Profile{
@@ -94,56 +68,267 @@ func (c *Client) UpdateProfile(ctx context.Context, config *ProfileConfig) (*Pro
 			DNSConfig: &armtrafficmanager.DNSConfig{
 				TTL: &config.DNSTTL,
 			},
-			MonitorConfig: &armtrafficmanager.MonitorConfig{
-				Protocol: toMonitorProtocol(config.MonitorProtocol),
-				Port:     &config.MonitorPort,
-				Path:     &config.MonitorPath,
-			},
-			ProfileStatus: toProfileStatus(getProfileStatus(config.HealthChecksEnabled)),
+			MonitorConfig:               toMonitorConfig(config),
+			ProfileStatus:               toProfileStatus(profileStatusOrDefault(config.ProfileStatus)),
+			TrafficViewEnrollmentStatus: toTrafficViewStatus(config.TrafficViewEnabled),
 		},
-		Tags: toStringMapPtr(config.Tags),
 	}
 
-	resp, err := c.profilesClient.CreateOrUpdate(
-		ctx,
-		config.ResourceGroup,
-		config.ProfileName,
-		profile,
-		nil,
-	)
+	// The settings this update replaces are the ones first read; a retry that finds others would
+	// overwrite another writer's change
+	var first, existing *armtrafficmanager.Profile
+	resp, err := c.putProfile(ctx, config, profile, nil, func(current *armtrafficmanager.Profile) error {
+		existing = current
+		if first == nil {
+			first = current
+		} else if !reflect.DeepEqual(profileSettings(first), profileSettings(current)) {
+			return fmt.Errorf("%w: %s", ErrProfileConflict, config.ProfileName)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update profile: %w", err)
+		return nil, fmt.Errorf("failed to update profile: %w", profileError(err))
 	}
 
-	c.logger.Info("Successfully updated Traffic Manager profile",
+	c.log(ctx).Info("Successfully updated Traffic Manager profile",
 		zap.String("profileName", config.ProfileName))
 
 	state := profileResponseToState(config.ResourceGroup, &resp.Profile)
-	// Preserve endpoints from existing state
-	state.Endpoints = existing.Endpoints
+	// Preserve endpoints from the profile as read
+	state.Endpoints = profileResponseToState(config.ResourceGroup, existing).Endpoints
 	return state, nil
 }
 
+// profileSettings returns the settings of profile UpdateProfile writes
+func profileSettings(profile *armtrafficmanager.Profile) armtrafficmanager.ProfileProperties {
+	if profile.Properties == nil {
+		return armtrafficmanager.ProfileProperties{}
+	}
+	properties := profile.Properties
+	settings := armtrafficmanager.ProfileProperties{
+		TrafficRoutingMethod:        properties.TrafficRoutingMethod,
+		MonitorConfig:               properties.MonitorConfig,
+		ProfileStatus:               properties.ProfileStatus,
+		TrafficViewEnrollmentStatus: properties.TrafficViewEnrollmentStatus,
+	}
+	if properties.DNSConfig != nil {
+		settings.DNSConfig = &armtrafficmanager.DNSConfig{TTL: properties.DNSConfig.TTL}
+	}
+	return settings
+}
+
+// CreateProfileWithEndpoints creates or replaces a profile and writes endpoints in the same
+// request, rather than one request per endpoint. The profile's other endpoints are kept.
+func (c *Client) CreateProfileWithEndpoints(ctx context.Context, config *ProfileConfig, endpoints []*EndpointConfig) (*ProfileState, error) {
+	c.log(ctx).Info("Creating Traffic Manager profile with endpoints",
+		zap.String("profileName", config.ProfileName),
+		zap.String("resourceGroup", config.ResourceGroup),
+		zap.Int("endpoints", len(endpoints)))
+
+	resp, err := c.putProfile(ctx, config, newProfile(config), endpoints, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create profile: %w", profileError(err))
+	}
+
+	c.log(ctx).Info("Successfully created Traffic Manager profile with endpoints",
+		zap.String("profileName", config.ProfileName))
+
+	return profileResponseToState(config.ResourceGroup, &resp.Profile), nil
+}
+
+// newProfile builds the body of a profile for config, without tags or endpoints
+func newProfile(config *ProfileConfig) armtrafficmanager.Profile {
+	// Convert routing method to SDK type
+	routingMethod := armtrafficmanager.TrafficRoutingMethod(config.RoutingMethod)
+
+	// Build profile properties
+	return armtrafficmanager.Profile{
+		Location: toStringPtr(config.Location),
+		Properties: &armtrafficmanager.ProfileProperties{
+			TrafficRoutingMethod: &routingMethod,
+			DNSConfig: &armtrafficmanager.DNSConfig{
+				RelativeName: &config.ProfileName,
+				TTL:          &config.DNSTTL,
+			},
+			MonitorConfig:               toMonitorConfig(config),
+			ProfileStatus:               toProfileStatus(profileStatusOrDefault(config.ProfileStatus)),
+			TrafficViewEnrollmentStatus: toTrafficViewStatus(config.TrafficViewEnabled),
+		},
+	}
+}
+
+// putProfile creates or replaces a profile with config's tags. Endpoint metadata written by other
+// clusters is kept, and the write fails with 412 if the profile changes after the metadata is read,
+// in which case it is read again and the write retried. With endpoints, they are written in the
+// same request alongside the profile's other endpoints. With check, the profile must exist; check
+// sees it as read before every attempt and its error stops the write.
+func (c *Client) putProfile(ctx context.Context, config *ProfileConfig, profile armtrafficmanager.Profile, endpoints []*EndpointConfig, check func(existing *armtrafficmanager.Profile) error) (armtrafficmanager.ProfilesClientCreateOrUpdateResponse, error) {
+	var resp armtrafficmanager.ProfilesClientCreateOrUpdateResponse
+	err := c.retryOnProfileChange(ctx, config.ProfileName, func() error {
+		tags := maps.Clone(config.Tags)
+		var existing *armtrafficmanager.Profile
+		etag := ""
+		if check != nil {
+			current, currentETag, err := c.getProfile(ctx, config.ResourceGroup, config.ProfileName)
+			if err != nil {
+				return err
+			}
+			existing, etag = &current.Profile, currentETag
+			if err := check(existing); err != nil {
+				return err
+			}
+		} else if tags != nil || endpoints != nil {
+			// A profile that doesn't exist yet has nothing to keep
+			if current, currentETag, err := c.getProfile(ctx, config.ResourceGroup, config.ProfileName); err == nil {
+				existing, etag = &current.Profile, currentETag
+			}
+		}
+		if tags != nil && existing != nil {
+			preserveEndpointMetadata(existing, tags)
+		}
+		profile.Tags = toStringMapPtr(tags)
+
+		if endpoints != nil {
+			var current []*armtrafficmanager.Endpoint
+			if existing != nil && existing.Properties != nil {
+				current = existing.Properties.Endpoints
+			}
+			profile.Properties.Endpoints = mergeEndpoints(current, endpoints)
+		}
+
+		var err error
+		resp, err = c.profilesClient.CreateOrUpdate(ifMatch(ctx, etag), config.ResourceGroup, config.ProfileName, profile, nil)
+		return err
+	})
+	return resp, err
+}
+
+// mergeEndpoints returns current with the endpoints in endpoints added or replaced
+func mergeEndpoints(current []*armtrafficmanager.Endpoint, endpoints []*EndpointConfig) []*armtrafficmanager.Endpoint {
+	merged := make([]*armtrafficmanager.Endpoint, 0, len(current)+len(endpoints))
+	for _, endpoint := range current {
+		replaced := slices.ContainsFunc(endpoints, func(config *EndpointConfig) bool {
+			return endpoint.Name != nil && strings.EqualFold(*endpoint.Name, config.EndpointName)
+		})
+		if !replaced {
+			merged = append(merged, endpoint)
+		}
+	}
+	for _, config := range endpoints {
+		endpoint := newEndpoint(config)
+		endpoint.Name = toStringPtr(config.EndpointName)
+		endpoint.Type = toStringPtr(endpointResourceType(config.EndpointType))
+		merged = append(merged, &endpoint)
+	}
+	return merged
+}
+
 // DeleteProfile deletes a Traffic Manager profile
 func (c *Client) DeleteProfile(ctx context.Context, resourceGroup, profileName string) error {
-	c.logger.Info("Deleting Traffic Manager profile",
+	c.log(ctx).Info("Deleting Traffic Manager profile",
 		zap.String("profileName", profileName),
 		zap.String("resourceGroup", resourceGroup))
 
 	_, err := c.profilesClient.Delete(ctx, resourceGroup, profileName, nil)
 	if err != nil {
-		return fmt.Errorf("failed to delete profile: %w", err)
+		return fmt.Errorf("failed to delete profile: %w", profileError(err))
 	}
 
-	c.logger.Info("Successfully deleted Traffic Manager profile",
+	c.log(ctx).Info("Successfully deleted Traffic Manager profile",
 		zap.String("profileName", profileName))
 
 	return nil
 }
 
+// AddProfileTags sets tags on a profile, keeping its other tags and settings
+func (c *Client) AddProfileTags(ctx context.Context, resourceGroup, profileName string, add map[string]string) error {
+	return c.retryOnProfileChange(ctx, profileName, func() error {
+		resp, etag, err := c.getProfile(ctx, resourceGroup, profileName)
+		if err != nil {
+			return fmt.Errorf("failed to get profile: %w", profileError(err))
+		}
+
+		tags := resp.Tags
+		if tags == nil {
+			tags = make(map[string]*string)
+		}
+		for k, v := range add {
+			tags[k] = toStringPtr(v)
+		}
+
+		_, err = c.profilesClient.Update(ifMatch(ctx, etag), resourceGroup, profileName, armtrafficmanager.Profile{Tags: tags}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to update profile tags: %w", profileError(err))
+		}
+		return nil
+	})
+}
+
+// DeleteAfterTag is the profile tag holding the RFC 3339 time after which a soft-deleted profile is purged
+const DeleteAfterTag = "deleteAfter"
+
+// SoftDeleteProfile disables a profile and tags it with the time after which it may be deleted.
+// Creating the profile again with CreateProfile replaces the tags and resets its status.
+func (c *Client) SoftDeleteProfile(ctx context.Context, resourceGroup, profileName string, deleteAfter time.Time) error {
+	c.log(ctx).Info("Soft-deleting Traffic Manager profile",
+		zap.String("profileName", profileName),
+		zap.String("resourceGroup", resourceGroup),
+		zap.Time("deleteAfter", deleteAfter))
+
+	return c.retryOnProfileChange(ctx, profileName, func() error {
+		resp, etag, err := c.getProfile(ctx, resourceGroup, profileName)
+		if err != nil {
+			return fmt.Errorf("failed to get profile: %w", profileError(err))
+		}
+
+		tags := resp.Tags
+		if tags == nil {
+			tags = make(map[string]*string)
+		}
+		tags[DeleteAfterTag] = toStringPtr(deleteAfter.UTC().Format(time.RFC3339))
+
+		_, err = c.profilesClient.Update(ifMatch(ctx, etag), resourceGroup, profileName, armtrafficmanager.Profile{
+			Properties: &armtrafficmanager.ProfileProperties{
+				ProfileStatus: toProfileStatus("Disabled"),
+			},
+			Tags: tags,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("failed to soft-delete profile: %w", profileError(err))
+		}
+		return nil
+	})
+}
+
+// profileResourceType is the ARM resource type checked for relative DNS name availability
+const profileResourceType = "Microsoft.Network/trafficManagerProfiles"
+
+// RelativeNameAvailable reports whether a relative DNS name is free under trafficmanager.net.
+// Relative names are unique across all of Azure, so a name can be taken by a profile in any
+// subscription. When it isn't available the reason Azure gives is returned.
+func (c *Client) RelativeNameAvailable(ctx context.Context, relativeName string) (bool, string, error) {
+	resp, err := c.profilesClient.CheckTrafficManagerRelativeDNSNameAvailability(ctx,
+		armtrafficmanager.CheckTrafficManagerRelativeDNSNameAvailabilityParameters{
+			Name: toStringPtr(relativeName),
+			Type: toStringPtr(profileResourceType),
+		}, nil)
+	if err != nil {
+		return false, "", fmt.Errorf("failed to check relative DNS name availability: %w", classify(err, nil))
+	}
+
+	available := resp.NameAvailable != nil && *resp.NameAvailable
+	reason := ""
+	if resp.Message != nil {
+		reason = *resp.Message
+	} else if resp.Reason != nil {
+		reason = *resp.Reason
+	}
+	return available, reason, nil
+}
+
 // ListProfiles lists all Traffic Manager profiles in a resource group
 func (c *Client) ListProfiles(ctx context.Context, resourceGroup string) ([]*ProfileState, error) {
-	c.logger.Debug("Listing Traffic Manager profiles",
+	c.log(ctx).Debug("Listing Traffic Manager profiles",
 		zap.String("resourceGroup", resourceGroup))
 
 	var profiles []*ProfileState
@@ -152,7 +337,7 @@ func (c *Client) ListProfiles(ctx context.Context, resourceGroup string) ([]*Pro
 	for pager.More() {
 		page, err := pager.NextPage(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list profiles: %w", err)
+			return nil, fmt.Errorf("failed to list profiles: %w", classify(err, nil))
 		}
 
 		for _, profile := range page.Value {
@@ -160,7 +345,7 @@ func (c *Client) ListProfiles(ctx context.Context, resourceGroup string) ([]*Pro
 		}
 	}
 
-	c.logger.Debug("Successfully listed Traffic Manager profiles",
+	c.log(ctx).Debug("Successfully listed Traffic Manager profiles",
 		zap.Int("count", len(profiles)))
 
 	return profiles, nil
@@ -218,6 +403,28 @@ func toStringMapPtr(m map[string]string) map[string]*string {
 	return result
 }
 
+// toTrafficViewStatus returns the Traffic View enrollment status for enabled
+func toTrafficViewStatus(enabled bool) *armtrafficmanager.TrafficViewEnrollmentStatus {
+	status := armtrafficmanager.TrafficViewEnrollmentStatusDisabled
+	if enabled {
+		status = armtrafficmanager.TrafficViewEnrollmentStatusEnabled
+	}
+	return &status
+}
+
+// toMonitorConfig returns the health check settings of config. TCP probes only open a connection,
+// and Azure rejects them with a path.
+func toMonitorConfig(config *ProfileConfig) *armtrafficmanager.MonitorConfig {
+	monitor := &armtrafficmanager.MonitorConfig{
+		Protocol: toMonitorProtocol(config.MonitorProtocol),
+		Port:     &config.MonitorPort,
+	}
+	if !strings.EqualFold(config.MonitorProtocol, string(armtrafficmanager.MonitorProtocolTCP)) {
+		monitor.Path = &config.MonitorPath
+	}
+	return monitor
+}
+
 func toMonitorProtocol(protocol string) *armtrafficmanager.MonitorProtocol {
 	p := armtrafficmanager.MonitorProtocol(protocol)
 	return &p
@@ -228,9 +435,10 @@ func toProfileStatus(status string) *armtrafficmanager.ProfileStatus {
 	return &s
 }
 
-func getProfileStatus(healthChecksEnabled bool) string {
-	if healthChecksEnabled {
+// profileStatusOrDefault returns status, or Enabled when it isn't set
+func profileStatusOrDefault(status string) string {
+	if status == "" {
 		return "Enabled"
 	}
-	return "Disabled"
+	return status
 }
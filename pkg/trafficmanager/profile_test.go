@@ -0,0 +1,165 @@
+package trafficmanager
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestMergeEndpoints(t *testing.T) {
+	current := []*armtrafficmanager.Endpoint{
+		{Name: toStringPtr("East"), Type: toStringPtr("Microsoft.Network/trafficManagerProfiles/externalEndpoints")},
+		{Name: toStringPtr("west"), Type: toStringPtr("Microsoft.Network/trafficManagerProfiles/externalEndpoints")},
+	}
+	merged := mergeEndpoints(current, []*EndpointConfig{
+		{EndpointName: "east", EndpointType: "ExternalEndpoints", Target: "east.example.com", Weight: 10, Priority: 1, Status: "Enabled", Location: "eastus"},
+		{EndpointName: "ip", EndpointType: "AzureEndpoints", TargetResourceID: "/subscriptions/x/ip", Weight: 5, Priority: 2, Status: "Enabled"},
+	})
+
+	require.Len(t, merged, 3)
+	assert.Equal(t, "west", *merged[0].Name, "endpoints not being written are kept")
+
+	assert.Equal(t, "east", *merged[1].Name)
+	assert.Equal(t, "Microsoft.Network/trafficManagerProfiles/externalEndpoints", *merged[1].Type)
+	assert.Equal(t, "east.example.com", *merged[1].Properties.Target)
+	assert.Equal(t, "eastus", *merged[1].Properties.EndpointLocation)
+
+	assert.Equal(t, "Microsoft.Network/trafficManagerProfiles/azureEndpoints", *merged[2].Type)
+	assert.Nil(t, merged[2].Properties.Target)
+	assert.Equal(t, "/subscriptions/x/ip", *merged[2].Properties.TargetResourceID)
+}
+
+func TestToMonitorConfig(t *testing.T) {
+	https := toMonitorConfig(&ProfileConfig{MonitorProtocol: "HTTPS", MonitorPort: 443, MonitorPath: "/healthz"})
+	assert.Equal(t, armtrafficmanager.MonitorProtocolHTTPS, *https.Protocol)
+	assert.Equal(t, int64(443), *https.Port)
+	require.NotNil(t, https.Path)
+	assert.Equal(t, "/healthz", *https.Path)
+
+	tcp := toMonitorConfig(&ProfileConfig{MonitorProtocol: "TCP", MonitorPort: 5432, MonitorPath: "/"})
+	assert.Equal(t, armtrafficmanager.MonitorProtocolTCP, *tcp.Protocol)
+	assert.Nil(t, tcp.Path, "TCP probes send no path")
+}
+
+func TestNewEndpoint_AlwaysServe(t *testing.T) {
+	probed := newEndpoint(&EndpointConfig{EndpointType: "ExternalEndpoints", Target: "a.example.com", Status: "Enabled"})
+	assert.Nil(t, probed.Properties.AlwaysServe)
+
+	alwaysServe := newEndpoint(&EndpointConfig{EndpointType: "ExternalEndpoints", Target: "a.example.com", Status: "Enabled", AlwaysServe: true})
+	require.NotNil(t, alwaysServe.Properties.AlwaysServe)
+	assert.Equal(t, armtrafficmanager.AlwaysServeEnabled, *alwaysServe.Properties.AlwaysServe)
+}
+
+func TestNewEndpoint_CustomHeaders(t *testing.T) {
+	plain := newEndpoint(&EndpointConfig{EndpointType: "ExternalEndpoints", Target: "a.example.com", Status: "Enabled"})
+	assert.Nil(t, plain.Properties.CustomHeaders)
+	assert.Nil(t, customHeadersOf(plain.Properties.CustomHeaders))
+
+	headers := map[string]string{"x-probe": "traffic-manager", "host": "tenant-a.example.com"}
+	endpoint := newEndpoint(&EndpointConfig{EndpointType: "ExternalEndpoints", Target: "a.example.com", Status: "Enabled", CustomHeaders: headers})
+	require.Len(t, endpoint.Properties.CustomHeaders, 2)
+	assert.Equal(t, "host", *endpoint.Properties.CustomHeaders[0].Name, "headers are written in name order")
+	assert.Equal(t, headers, customHeadersOf(endpoint.Properties.CustomHeaders))
+}
+
+// writeBeforePut changes the profile in azure just before the first PUT reaches it, as another
+// writer would between the client's read and its write
+type writeBeforePut struct {
+	azure  *fakeazure.Server
+	change func(profile *armtrafficmanager.Profile)
+	done   bool
+}
+
+func (w *writeBeforePut) Do(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodPut && !w.done {
+		w.done = true
+		profile := w.azure.Profile("sub", "tm-rg", "app-tm")
+		w.change(profile)
+		w.azure.AddProfile("sub", "tm-rg", *profile)
+	}
+	return w.azure.Do(req)
+}
+
+func TestUpdateProfile_ConcurrentWriter(t *testing.T) {
+	newAzure := func() *fakeazure.Server {
+		azure := fakeazure.New()
+		name, managedBy := "app-tm", DefaultManagedByValue
+		routing := armtrafficmanager.TrafficRoutingMethodWeighted
+		ttl, port := int64(30), int64(443)
+		azure.AddProfile("sub", "tm-rg", armtrafficmanager.Profile{
+			Name: &name,
+			Tags: map[string]*string{DefaultManagedByTag: &managedBy},
+			Properties: &armtrafficmanager.ProfileProperties{
+				TrafficRoutingMethod: &routing,
+				DNSConfig:            &armtrafficmanager.DNSConfig{TTL: &ttl},
+				MonitorConfig: &armtrafficmanager.MonitorConfig{
+					Protocol: toMonitorProtocol("HTTPS"), Port: &port, Path: toStringPtr("/health"),
+				},
+			},
+		})
+		return azure
+	}
+	config := &ProfileConfig{
+		ProfileName:     "app-tm",
+		ResourceGroup:   "tm-rg",
+		Location:        "global",
+		RoutingMethod:   "Weighted",
+		DNSTTL:          60,
+		MonitorProtocol: "HTTPS",
+		MonitorPort:     443,
+		MonitorPath:     "/health",
+		Tags:            map[string]string{DefaultManagedByTag: DefaultManagedByValue},
+	}
+	ctx := context.Background()
+
+	t.Run("one read before the write", func(t *testing.T) {
+		azure := newAzure()
+		client, err := NewClient("sub", fakeazure.Credential{}, ClientOptions{Transport: azure}, zaptest.NewLogger(t))
+		require.NoError(t, err)
+
+		_, err = client.UpdateProfile(ctx, config)
+		require.NoError(t, err)
+		var methods []string
+		for _, req := range azure.Requests() {
+			methods = append(methods, req.Method)
+		}
+		assert.Equal(t, []string{http.MethodGet, http.MethodPut}, methods)
+		assert.Equal(t, int64(60), *azure.Profile("sub", "tm-rg", "app-tm").Properties.DNSConfig.TTL)
+	})
+
+	t.Run("settings changed by another writer", func(t *testing.T) {
+		azure := newAzure()
+		transport := &writeBeforePut{azure: azure, change: func(profile *armtrafficmanager.Profile) {
+			profile.Properties.MonitorConfig.Path = toStringPtr("/ready")
+		}}
+		client, err := NewClient("sub", fakeazure.Credential{}, ClientOptions{Transport: transport}, zaptest.NewLogger(t))
+		require.NoError(t, err)
+
+		_, err = client.UpdateProfile(ctx, config)
+		require.ErrorIs(t, err, ErrProfileConflict)
+		profile := azure.Profile("sub", "tm-rg", "app-tm")
+		assert.Equal(t, "/ready", *profile.Properties.MonitorConfig.Path, "the other writer's change is kept")
+		assert.Equal(t, int64(30), *profile.Properties.DNSConfig.TTL)
+	})
+
+	t.Run("endpoint metadata changed by another writer", func(t *testing.T) {
+		azure := newAzure()
+		transport := &writeBeforePut{azure: azure, change: func(profile *armtrafficmanager.Profile) {
+			profile.Tags[EndpointMetadataTag] = toStringPtr(`{"west":{"cluster":"aks-west"}}`)
+		}}
+		client, err := NewClient("sub", fakeazure.Credential{}, ClientOptions{Transport: transport}, zaptest.NewLogger(t))
+		require.NoError(t, err)
+
+		_, err = client.UpdateProfile(ctx, config)
+		require.NoError(t, err)
+		profile := azure.Profile("sub", "tm-rg", "app-tm")
+		assert.Equal(t, int64(60), *profile.Properties.DNSConfig.TTL)
+		assert.Contains(t, profile.Tags, EndpointMetadataTag, "the other writer's metadata is kept")
+	})
+}
@@ -0,0 +1,44 @@
+package trafficmanager
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/metrics"
+	"golang.org/x/time/rate"
+)
+
+// WriteLimiter is a token bucket on ARM write requests. It is shared by every client built from
+// the ClientOptions holding it, so a loop of changes can't use up the subscription's write quota.
+type WriteLimiter struct {
+	limiter *rate.Limiter
+}
+
+// NewWriteLimiter allows perMinute writes a minute on average, and up to burst at once. It returns
+// nil, which is unlimited, when perMinute isn't positive.
+func NewWriteLimiter(perMinute, burst int) *WriteLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &WriteLimiter{limiter: rate.NewLimiter(rate.Limit(float64(perMinute)/60), burst)}
+}
+
+// Do waits for a token before sending a write request; reads are sent straight away. A write that
+// can't get a token before its context ends fails as throttled, so it is retried like one.
+func (l *WriteLimiter) Do(req *policy.Request) (*http.Response, error) {
+	switch req.Raw().Method {
+	case http.MethodPut, http.MethodPatch, http.MethodDelete:
+		start := time.Now()
+		if err := l.limiter.Wait(req.Raw().Context()); err != nil {
+			metrics.AzureWritesRateLimited.Inc()
+			return nil, fmt.Errorf("%w: write rate limit reached: %v", ErrThrottled, err)
+		}
+		metrics.AzureWriteRateLimitWait.Observe(time.Since(start).Seconds())
+	}
+	return req.Next()
+}
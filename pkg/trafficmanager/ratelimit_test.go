@@ -0,0 +1,65 @@
+package trafficmanager
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// okTransport answers every request with 200 and counts them
+type okTransport struct {
+	requests int
+}
+
+func (t *okTransport) Do(req *http.Request) (*http.Response, error) {
+	t.requests++
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Header: http.Header{}, Request: req}, nil
+}
+
+func TestWriteLimiter(t *testing.T) {
+	assert.Nil(t, NewWriteLimiter(0, 10), "no limit")
+
+	transport := &okTransport{}
+	pipeline := runtime.NewPipeline("test", "v1", runtime.PipelineOptions{}, &policy.ClientOptions{
+		Transport:        transport,
+		Retry:            policy.RetryOptions{MaxRetries: -1},
+		PerRetryPolicies: []policy.Policy{NewWriteLimiter(1, 1)},
+	})
+	send := func(method string, timeout time.Duration) error {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		req, err := runtime.NewRequest(ctx, method, "https://management.azure.com/profile")
+		require.NoError(t, err)
+		resp, err := pipeline.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	require.NoError(t, send(http.MethodPut, time.Second), "the burst allows the first write")
+
+	err := send(http.MethodDelete, 50*time.Millisecond)
+	require.Error(t, err, "the next token is a minute away")
+	assert.True(t, IsThrottled(err))
+
+	require.NoError(t, send(http.MethodGet, time.Second), "reads aren't limited")
+	assert.Equal(t, 2, transport.requests)
+}
+
+func TestClientOptionsARM_WriteLimiter(t *testing.T) {
+	options, err := ClientOptions{}.ARM()
+	require.NoError(t, err)
+	assert.Empty(t, options.PerRetryPolicies)
+
+	limiter := NewWriteLimiter(60, 5)
+	options, err = ClientOptions{WriteLimiter: limiter}.ARM()
+	require.NoError(t, err)
+	assert.Equal(t, []policy.Policy{limiter}, options.PerRetryPolicies)
+}
@@ -3,33 +3,102 @@ package trafficmanager
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
 	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
 	"go.uber.org/zap"
 )
 
-// SyncProfilesFromAzure queries all Traffic Manager profiles and returns them as state
+// DefaultSyncConcurrency is the number of resource groups SyncProfilesFromAzure lists in parallel
+const DefaultSyncConcurrency = 4
+
+// syncPageAttempts is how many times a page of profiles is requested before its resource group
+// counts as failed. Each attempt resumes from the failed page rather than the first.
+const syncPageAttempts = 3
+
+// SyncError names the resource groups SyncProfilesFromAzure couldn't list. The profiles of the
+// other resource groups are returned with it.
+type SyncError struct {
+	ResourceGroups map[string]error // Why each failed resource group couldn't be listed
+}
+
+func (e *SyncError) Error() string {
+	names := make([]string, 0, len(e.ResourceGroups))
+	for name := range e.ResourceGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	failures := make([]string, 0, len(names))
+	for _, name := range names {
+		failures = append(failures, fmt.Sprintf("%s: %v", name, e.ResourceGroups[name]))
+	}
+	return fmt.Sprintf("failed to list profiles in %d resource group(s): %s", len(names), strings.Join(failures, "; "))
+}
+
+// Unwrap returns the resource groups' errors, so IsThrottled and the like see through a SyncError
+func (e *SyncError) Unwrap() []error {
+	errs := make([]error, 0, len(e.ResourceGroups))
+	for _, err := range e.ResourceGroups {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// SyncProfilesFromAzure queries all Traffic Manager profiles and returns them as state, listing
+// resource groups in parallel. When some resource groups fail, the profiles of the others are
+// returned with a *SyncError naming the failed ones.
 func (c *Client) SyncProfilesFromAzure(ctx context.Context, resourceGroups []string) ([]*state.ProfileState, error) {
-	c.logger.Info("Syncing Traffic Manager profiles from Azure",
+	c.log(ctx).Info("Syncing Traffic Manager profiles from Azure",
 		zap.Strings("resourceGroups", resourceGroups))
 
-	var allProfiles []*state.ProfileState
+	// Indexed by resource group, so the profiles come back in the configured order
+	results := make([][]*state.ProfileState, len(resourceGroups))
+	errs := make([]error, len(resourceGroups))
 
-	for _, rg := range resourceGroups {
-		profiles, err := c.listProfilesInResourceGroup(ctx, rg)
-		if err != nil {
-			c.logger.Error("Failed to list profiles in resource group",
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, max(c.syncConcurrency, 1))
+
+	for i, rg := range resourceGroups {
+		i, rg := i, rg
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i], errs[i] = c.listProfilesInResourceGroup(ctx, rg)
+		}()
+	}
+	wg.Wait()
+
+	var allProfiles []*state.ProfileState
+	failed := make(map[string]error)
+	for i, rg := range resourceGroups {
+		if errs[i] != nil {
+			c.log(ctx).Error("Failed to list profiles in resource group",
 				zap.String("resourceGroup", rg),
-				zap.Error(err))
-			// Continue with other resource groups
+				zap.Error(errs[i]))
+			failed[rg] = errs[i]
 			continue
 		}
-		allProfiles = append(allProfiles, profiles...)
+		allProfiles = append(allProfiles, results[i]...)
+	}
+
+	if len(failed) > 0 {
+		c.log(ctx).Warn("Synced profiles from some resource groups only",
+			zap.Int("profileCount", len(allProfiles)),
+			zap.Int("failedResourceGroups", len(failed)))
+		return allProfiles, &SyncError{ResourceGroups: failed}
 	}
 
-	c.logger.Info("Successfully synced profiles from Azure",
+	c.log(ctx).Info("Successfully synced profiles from Azure",
 		zap.Int("profileCount", len(allProfiles)))
 
 	return allProfiles, nil
@@ -42,14 +111,14 @@ func (c *Client) listProfilesInResourceGroup(ctx context.Context, resourceGroup
 	pager := c.profilesClient.NewListByResourceGroupPager(resourceGroup, nil)
 
 	for pager.More() {
-		page, err := pager.NextPage(ctx)
+		page, err := nextPage(ctx, pager)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get next page: %w", err)
+			return nil, fmt.Errorf("failed to get next page: %w", classify(err, nil))
 		}
 
 		for _, profile := range page.Value {
 			// Check if this profile is managed by us
-			if !isManagedByUs(profile) {
+			if !c.ownership.managesProfile(resourceGroup, profile) {
 				continue
 			}
 
@@ -61,6 +130,62 @@ func (c *Client) listProfilesInResourceGroup(ctx context.Context, resourceGroup
 	return profiles, nil
 }
 
+// SyncSubscriptionProfiles queries the managed Traffic Manager profiles of every resource group
+// in the client's subscription and returns them as state
+func (c *Client) SyncSubscriptionProfiles(ctx context.Context) ([]*state.ProfileState, error) {
+	c.log(ctx).Info("Syncing Traffic Manager profiles from the whole subscription",
+		zap.String("subscriptionID", c.subscriptionID))
+
+	var profiles []*state.ProfileState
+
+	pager := c.profilesClient.NewListBySubscriptionPager(nil)
+
+	for pager.More() {
+		page, err := nextPage(ctx, pager)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get next page: %w", classify(err, nil))
+		}
+
+		for _, profile := range page.Value {
+			if profile.ID == nil {
+				continue
+			}
+
+			id, err := arm.ParseResourceID(*profile.ID)
+			if err != nil {
+				c.log(ctx).Warn("Skipping profile with an unparseable resource ID",
+					zap.String("resourceID", *profile.ID),
+					zap.Error(err))
+				continue
+			}
+			if !c.ownership.managesProfile(id.ResourceGroupName, profile) {
+				continue
+			}
+			profiles = append(profiles, c.profileToState(id.ResourceGroupName, profile))
+		}
+	}
+
+	c.log(ctx).Info("Successfully synced profiles from Azure",
+		zap.Int("profileCount", len(profiles)))
+
+	return profiles, nil
+}
+
+// nextPage gets the next page from pager, trying up to syncPageAttempts times. A pager keeps
+// its position when a page fails, so a retry asks for the same page again.
+func nextPage[T any](ctx context.Context, pager *runtime.Pager[T]) (T, error) {
+	var (
+		page T
+		err  error
+	)
+	for attempt := 1; attempt <= syncPageAttempts; attempt++ {
+		if page, err = pager.NextPage(ctx); err == nil || ctx.Err() != nil {
+			return page, err
+		}
+	}
+	return page, err
+}
+
 // profileToState converts an Azure SDK profile to state.ProfileState
 func (c *Client) profileToState(resourceGroup string, profile *armtrafficmanager.Profile) *state.ProfileState {
 	profileState := &state.ProfileState{
@@ -73,6 +198,10 @@ func (c *Client) profileToState(resourceGroup string, profile *armtrafficmanager
 		CachedAt:      time.Now(),
 	}
 
+	if profile.ID != nil {
+		profileState.ResourceID = *profile.ID
+	}
+
 	if profile.Properties != nil {
 		if profile.Properties.DNSConfig != nil {
 			if profile.Properties.DNSConfig.Fqdn != nil {
@@ -87,6 +216,24 @@ func (c *Client) profileToState(resourceGroup string, profile *armtrafficmanager
 			profileState.RoutingMethod = string(*profile.Properties.TrafficRoutingMethod)
 		}
 
+		if monitor := profile.Properties.MonitorConfig; monitor != nil {
+			if monitor.Protocol != nil {
+				profileState.MonitorProtocol = string(*monitor.Protocol)
+			}
+			if monitor.Port != nil {
+				profileState.MonitorPort = *monitor.Port
+			}
+			if monitor.Path != nil {
+				profileState.MonitorPath = *monitor.Path
+			}
+		}
+		if profile.Properties.ProfileStatus != nil {
+			profileState.ProfileStatus = string(*profile.Properties.ProfileStatus)
+		}
+		if profile.Properties.TrafficViewEnrollmentStatus != nil {
+			profileState.TrafficViewEnabled = *profile.Properties.TrafficViewEnrollmentStatus == armtrafficmanager.TrafficViewEnrollmentStatusEnabled
+		}
+
 		// Convert endpoints
 		if profile.Properties.Endpoints != nil {
 			for _, endpoint := range profile.Properties.Endpoints {
@@ -98,6 +245,15 @@ func (c *Client) profileToState(resourceGroup string, profile *armtrafficmanager
 		}
 	}
 
+	// The webhook sets Always Serve on all endpoints of a profile whose health checks are off
+	profileState.HealthChecksEnabled = true
+	for _, endpointState := range profileState.Endpoints {
+		if endpointState.AlwaysServe {
+			profileState.HealthChecksEnabled = false
+			break
+		}
+	}
+
 	// Copy tags
 	if profile.Tags != nil {
 		for k, v := range profile.Tags {
@@ -106,9 +262,19 @@ func (c *Client) profileToState(resourceGroup string, profile *armtrafficmanager
 			}
 		}
 
-		// Extract hostname from tags
-		if hostname, ok := profileState.Tags["hostname"]; ok {
-			profileState.Hostname = hostname
+		// Attach persisted endpoint metadata
+		if values := endpointMetadataValues(profileState.Tags); len(values) > 0 {
+			metadata, err := DecodeEndpointMetadata(values...)
+			if err != nil {
+				c.logger.Warn("Failed to decode endpoint metadata tag",
+					zap.String("profileName", profileState.ProfileName),
+					zap.Error(err))
+			}
+			for name, endpointMetadata := range metadata {
+				if endpointState, ok := profileState.Endpoints[name]; ok {
+					endpointState.Metadata = endpointMetadata
+				}
+			}
 		}
 	}
 
@@ -140,33 +306,95 @@ func (c *Client) endpointToState(endpoint *armtrafficmanager.Endpoint) *state.En
 		if endpoint.Properties.EndpointStatus != nil {
 			endpointState.Status = string(*endpoint.Properties.EndpointStatus)
 		}
+		if endpoint.Properties.EndpointMonitorStatus != nil {
+			endpointState.MonitorStatus = string(*endpoint.Properties.EndpointMonitorStatus)
+		}
 		if endpoint.Properties.EndpointLocation != nil {
 			endpointState.Location = *endpoint.Properties.EndpointLocation
 		}
+		if endpoint.Properties.TargetResourceID != nil {
+			endpointState.TargetResourceID = *endpoint.Properties.TargetResourceID
+		}
+		if endpoint.Properties.AlwaysServe != nil {
+			endpointState.AlwaysServe = *endpoint.Properties.AlwaysServe == armtrafficmanager.AlwaysServeEnabled
+		}
+		endpointState.CustomHeaders = customHeadersOf(endpoint.Properties.CustomHeaders)
 	}
 
 	return endpointState
 }
 
-// isManagedByUs checks if a profile has the managed-by tag
-func isManagedByUs(profile *armtrafficmanager.Profile) bool {
-	if profile.Tags == nil {
-		return false
+// GeneratedProfileSuffix ends the names of profiles generated from a hostname
+const GeneratedProfileSuffix = "-tm"
+
+// Default tags marking the profiles a webhook deployment manages
+const (
+	DefaultManagedByTag   = "managedBy"
+	DefaultManagedByValue = "external-dns-traffic-manager-webhook"
+	DefaultHostnameTag    = "hostname"
+)
+
+// Ownership names the tags that mark a profile as managed by a webhook deployment and record
+// its vanity hostname. Deployments with different values ignore each other's profiles.
+type Ownership struct {
+	ManagedByTag   string
+	ManagedByValue string
+	HostnameTag    string
+
+	// Recorded reports whether a profile without the managed-by tag is one the webhook has
+	// written, since Azure Policy may have stripped its tags. Nil means none are.
+	Recorded func(resourceGroup, profileName string) bool
+}
+
+// DefaultOwnership returns the tags used when none are configured
+func DefaultOwnership() Ownership {
+	return Ownership{ManagedByTag: DefaultManagedByTag, ManagedByValue: DefaultManagedByValue, HostnameTag: DefaultHostnameTag}
+}
+
+// WithDefaults returns o with empty fields set to their defaults
+func (o Ownership) WithDefaults() Ownership {
+	if o.ManagedByTag == "" {
+		o.ManagedByTag = DefaultManagedByTag
+	}
+	if o.ManagedByValue == "" {
+		o.ManagedByValue = DefaultManagedByValue
+	}
+	if o.HostnameTag == "" {
+		o.HostnameTag = DefaultHostnameTag
 	}
+	return o
+}
 
-	managedBy, exists := profile.Tags["managedBy"]
-	if !exists || managedBy == nil {
-		return false
+// Manages checks if a profile has the managed-by tag. A profile with no managed-by tag is only
+// managed when Recorded knows it; a generated-looking name isn't enough, as it may belong to anyone.
+func (o Ownership) Manages(resourceGroup, profileName string, tags map[string]string) bool {
+	managedBy, exists := tags[o.ManagedByTag]
+	if !exists {
+		return o.Recorded != nil && o.Recorded(resourceGroup, profileName)
 	}
+	return managedBy == o.ManagedByValue
+}
 
-	return *managedBy == "external-dns-traffic-manager-webhook"
+// managesProfile applies Manages to an Azure SDK profile in resourceGroup
+func (o Ownership) managesProfile(resourceGroup string, profile *armtrafficmanager.Profile) bool {
+	name := ""
+	if profile.Name != nil {
+		name = *profile.Name
+	}
+	tags := make(map[string]string, len(profile.Tags))
+	for k, v := range profile.Tags {
+		if v != nil {
+			tags[k] = *v
+		}
+	}
+	return o.Manages(resourceGroup, name, tags)
 }
 
 // GetProfileState queries a single profile and returns its state
 func (c *Client) GetProfileState(ctx context.Context, resourceGroup, profileName string) (*state.ProfileState, error) {
 	resp, err := c.profilesClient.Get(ctx, resourceGroup, profileName, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get profile: %w", err)
+		return nil, fmt.Errorf("failed to get profile: %w", profileError(err))
 	}
 
 	return c.profileToState(resourceGroup, &resp.Profile), nil
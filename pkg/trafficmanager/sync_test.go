@@ -0,0 +1,93 @@
+package trafficmanager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnershipManages(t *testing.T) {
+	owner := DefaultOwnership()
+	assert.True(t, owner.Manages("rg", "legacy", map[string]string{DefaultManagedByTag: DefaultManagedByValue}))
+	assert.False(t, owner.Manages("rg", "app-tm", map[string]string{DefaultManagedByTag: "terraform"}))
+	assert.False(t, owner.Manages("rg", "app-example-com-tm", nil), "a generated-looking name alone doesn't count")
+	assert.False(t, owner.Manages("rg", "legacy", nil))
+
+	owner.Recorded = func(resourceGroup, profileName string) bool {
+		return resourceGroup == "rg" && profileName == "app-example-com-tm"
+	}
+	assert.True(t, owner.Manages("rg", "app-example-com-tm", nil), "an untagged profile in state counts")
+	assert.False(t, owner.Manages("other-rg", "app-example-com-tm", nil))
+	assert.False(t, owner.Manages("rg", "app-example-com-tm", map[string]string{DefaultManagedByTag: "terraform"}), "another owner's tag wins over state")
+
+	staging := Ownership{ManagedByValue: "webhook-staging"}.WithDefaults()
+	assert.Equal(t, DefaultManagedByTag, staging.ManagedByTag)
+	assert.Equal(t, DefaultHostnameTag, staging.HostnameTag)
+	assert.False(t, staging.Manages("rg", "app-tm", map[string]string{DefaultManagedByTag: DefaultManagedByValue}), "the default deployment's profiles aren't claimed")
+}
+
+func TestOwnershipManagesProfile(t *testing.T) {
+	name, value := "app-tm", "webhook-staging"
+	profile := &armtrafficmanager.Profile{Name: &name, Tags: map[string]*string{"owner": &value, "hostname": nil}}
+
+	assert.True(t, Ownership{ManagedByTag: "owner", ManagedByValue: "webhook-staging"}.WithDefaults().managesProfile("rg", profile))
+	assert.False(t, DefaultOwnership().managesProfile("rg", &armtrafficmanager.Profile{Name: &name, Tags: map[string]*string{DefaultManagedByTag: &value}}))
+}
+
+func TestSyncError(t *testing.T) {
+	err := &SyncError{ResourceGroups: map[string]error{
+		"rg-west": &azcore.ResponseError{StatusCode: http.StatusTooManyRequests},
+		"rg-east": errors.New("failed to get next page: connection reset"),
+	}}
+
+	assert.Regexp(t, `^failed to list profiles in 2 resource group\(s\): rg-east: failed to get next page: connection reset; rg-west: `, err.Error())
+	assert.True(t, IsThrottled(err), "the resource groups' errors are unwrapped")
+	assert.False(t, IsNotFound(err))
+}
+
+func TestNextPageResumes(t *testing.T) {
+	var requested []int
+	failures := 1
+	pager := runtime.NewPager(runtime.PagingHandler[int]{
+		More: func(page int) bool { return page < 2 },
+		Fetcher: func(_ context.Context, current *int) (int, error) {
+			page := 0
+			if current != nil {
+				page = *current + 1
+			}
+			requested = append(requested, page)
+			if page == 1 && failures > 0 {
+				failures--
+				return 0, errors.New("connection reset")
+			}
+			return page, nil
+		},
+	})
+
+	var pages []int
+	for pager.More() {
+		page, err := nextPage(context.Background(), pager)
+		assert.NoError(t, err)
+		pages = append(pages, page)
+	}
+	assert.Equal(t, []int{0, 1, 2}, pages)
+	assert.Equal(t, []int{0, 1, 1, 2}, requested, "the failed page is requested again, not the first")
+
+	requested = nil
+	pager = runtime.NewPager(runtime.PagingHandler[int]{
+		More: func(int) bool { return true },
+		Fetcher: func(context.Context, *int) (int, error) {
+			requested = append(requested, 0)
+			return 0, errors.New("connection reset")
+		},
+	})
+	_, err := nextPage(context.Background(), pager)
+	assert.Error(t, err)
+	assert.Len(t, requested, syncPageAttempts)
+}
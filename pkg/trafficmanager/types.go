@@ -6,16 +6,18 @@ import (
 
 // ProfileConfig holds configuration for creating a Traffic Manager profile
 type ProfileConfig struct {
-	ProfileName     string
-	ResourceGroup   string
-	Location        string            // Always "global" for Traffic Manager
-	RoutingMethod   string            // Weighted, Priority, Performance, Geographic
-	DNSTTL          int64             // DNS TTL in seconds
-	MonitorProtocol      string            // HTTP, HTTPS, TCP
-	MonitorPort          int64             // Port to monitor
-	MonitorPath          string            // Path for HTTP/HTTPS monitoring
-	HealthChecksEnabled  bool              // Enable or disable endpoint health checks
-	Tags                 map[string]string // Azure resource tags
+	ProfileName         string
+	ResourceGroup       string
+	Location            string            // Always "global" for Traffic Manager
+	RoutingMethod       string            // Weighted, Priority, Performance, Geographic
+	DNSTTL              int64             // DNS TTL in seconds
+	MonitorProtocol     string            // HTTP, HTTPS, TCP
+	MonitorPort         int64             // Port to monitor
+	MonitorPath         string            // Path for HTTP/HTTPS monitoring
+	HealthChecksEnabled bool              // Probe endpoints; false makes them Always Serve
+	ProfileStatus       string            // Enabled or Disabled, empty for Enabled
+	TrafficViewEnabled  bool              // Enrol the profile in Traffic View
+	Tags                map[string]string // Azure resource tags
 }
 
 // ProfileState represents the current state of a Traffic Manager profile
@@ -29,6 +31,8 @@ type ProfileState struct {
 	Endpoints     map[string]*EndpointState
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
+
+	ETag string // Version of the profile returned by GetProfile, empty if Azure didn't send one
 }
 
 // EndpointConfig holds configuration for creating a Traffic Manager endpoint
@@ -40,32 +44,45 @@ type EndpointConfig struct {
 	Priority     int64  // 1-1000 for priority routing
 	Status       string // Enabled or Disabled
 	Location     string // Azure region (required for ExternalEndpoints)
+	AlwaysServe  bool   // Skip health checks and always count the endpoint as healthy
+
+	// Resource an AzureEndpoints endpoint points at, such as a public IP address; replaces Target
+	TargetResourceID string
+
+	// HTTP headers sent with the endpoint's health probes, by name
+	CustomHeaders map[string]string
 }
 
 // EndpointState represents the current state of a Traffic Manager endpoint
 type EndpointState struct {
-	EndpointName string
-	EndpointType string
-	Target       string
-	Weight       int64
-	Priority     int64
-	Status       string
-	Location     string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	EndpointName  string
+	EndpointType  string
+	Target        string
+	Weight        int64
+	Priority      int64
+	Status        string
+	MonitorStatus string
+	Location      string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	TargetResourceID string            // Set for AzureEndpoints
+	AlwaysServe      bool              // Health checks are off for the endpoint
+	CustomHeaders    map[string]string // Sent with the endpoint's health probes
 }
 
 // DefaultProfileConfig returns a ProfileConfig with sensible defaults
 func DefaultProfileConfig() *ProfileConfig {
 	return &ProfileConfig{
-		Location:        "global",
-		RoutingMethod:   "Weighted",
-		DNSTTL:          30,
-		MonitorProtocol:      "HTTPS",
-		MonitorPort:          443,
-		MonitorPath:          "/",
-		HealthChecksEnabled:  true,
-		Tags:                 make(map[string]string),
+		Location:            "global",
+		RoutingMethod:       "Weighted",
+		DNSTTL:              30,
+		MonitorProtocol:     "HTTPS",
+		MonitorPort:         443,
+		MonitorPath:         "/",
+		HealthChecksEnabled: true,
+		ProfileStatus:       "Enabled",
+		Tags:                make(map[string]string),
 	}
 }
 
@@ -0,0 +1,167 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/dnsendpoint"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// Settings for the sandbox subscription the suite runs against
+var (
+	subscriptionID = os.Getenv("E2E_SUBSCRIPTION_ID")
+	resourceGroup  = os.Getenv("E2E_RESOURCE_GROUP")
+	domain         = getEnv("E2E_DOMAIN", "e2e.example.com")
+	cloudName      = os.Getenv("AZURE_ENVIRONMENT")
+)
+
+func TestMain(m *testing.M) {
+	if subscriptionID == "" || resourceGroup == "" {
+		fmt.Fprintln(os.Stderr, "Skipping e2e tests: E2E_SUBSCRIPTION_ID and E2E_RESOURCE_GROUP must be set")
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// env is one test's provider plus a client for checking Azure directly
+type env struct {
+	t        *testing.T
+	ctx      context.Context
+	provider *provider.TrafficManagerProvider
+	client   *trafficmanager.Client
+	id       string
+}
+
+// newEnv creates a provider against the sandbox subscription with a fake Kubernetes API for DNSEndpoints.
+// Each env has a unique ID used in every hostname so parallel and repeated runs don't collide.
+func newEnv(t *testing.T) *env {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	t.Cleanup(cancel)
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.InfoLevel))
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{dnsendpoint.DNSEndpointGVR(): "DNSEndpointList"})
+
+	p, err := provider.NewTrafficManagerProvider(&provider.Config{
+		SubscriptionID: subscriptionID,
+		Cloud:          cloudName,
+		AuthMode:       getEnv("AZURE_AUTH_MODE", trafficmanager.AuthModeDefault),
+		TenantID:       os.Getenv("AZURE_TENANT_ID"),
+		ClientID:       os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret:   os.Getenv("AZURE_CLIENT_SECRET"),
+		ResourceGroups: []string{resourceGroup},
+		DomainFilter:   []string{domain},
+		ClusterName:    "e2e",
+	}, dynamicClient, logger)
+	require.NoError(t, err)
+
+	cloudConfig, err := trafficmanager.CloudConfiguration(cloudName)
+	require.NoError(t, err)
+	cred, err := trafficmanager.GetAzureCredential(trafficmanager.CredentialConfig{
+		AuthMode:     getEnv("AZURE_AUTH_MODE", trafficmanager.AuthModeDefault),
+		TenantID:     os.Getenv("AZURE_TENANT_ID"),
+		ClientID:     os.Getenv("AZURE_CLIENT_ID"),
+		ClientSecret: os.Getenv("AZURE_CLIENT_SECRET"),
+		Cloud:        cloudConfig,
+	})
+	require.NoError(t, err)
+	client, err := trafficmanager.NewClient(subscriptionID, cred, trafficmanager.ClientOptions{Cloud: cloudConfig}, logger.Named("e2e"))
+	require.NoError(t, err)
+
+	return &env{t: t, ctx: ctx, provider: p, client: client, id: uniqueID(t)}
+}
+
+// hostname returns a hostname unique to this env
+func (e *env) hostname(label string) string {
+	return fmt.Sprintf("%s-%s.%s", label, e.id, domain)
+}
+
+// profileName returns the name the provider generates for a vanity hostname
+func (e *env) profileName(hostname string) string {
+	return strings.ReplaceAll(hostname, ".", "-") + trafficmanager.GeneratedProfileSuffix
+}
+
+// cleanupProfile deletes the profile when the test ends, even if the provider failed to
+func (e *env) cleanupProfile(profileName string) {
+	e.t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+
+		err := e.client.DeleteProfile(ctx, resourceGroup, profileName)
+		if err != nil && !trafficmanager.IsNotFound(err) {
+			e.t.Errorf("Failed to clean up Traffic Manager profile %s: %v", profileName, err)
+		}
+	})
+}
+
+// endpoint builds an External DNS A record annotated for the given vanity hostname.
+// Annotations are set as both labels and provider-specific properties, and the profile
+// name is explicit so updates and deletes resolve the same profile as the create.
+func (e *env) endpoint(dnsName, vanity, endpointName, target string, extra map[string]string) *provider.Endpoint {
+	props := map[string]string{
+		annotations.AnnotationEnabled:          "true",
+		annotations.AnnotationHostname:         vanity,
+		annotations.AnnotationProfileName:      e.profileName(vanity),
+		annotations.AnnotationResourceGroup:    resourceGroup,
+		annotations.AnnotationEndpointName:     endpointName,
+		annotations.AnnotationEndpointLocation: getEnv("E2E_LOCATION", "westeurope"),
+		annotations.AnnotationRoutingMethod:    "Weighted",
+		annotations.AnnotationWeight:           "50",
+	}
+	for k, v := range extra {
+		props[k] = v
+	}
+
+	endpoint := &provider.Endpoint{
+		DNSName:    dnsName,
+		Targets:    []string{target},
+		RecordType: "A",
+		RecordTTL:  30,
+		Labels:     props,
+	}
+	for k, v := range props {
+		endpoint.ProviderSpecific = append(endpoint.ProviderSpecific, provider.ProviderSpecificProperty{Name: k, Value: v})
+	}
+	return endpoint
+}
+
+// apply sends changes through the provider, as External DNS would
+func (e *env) apply(changes *provider.Changes) {
+	e.t.Helper()
+	require.NoError(e.t, e.provider.ApplyChanges(e.ctx, changes))
+}
+
+// uniqueID returns a short random ID that is valid in hostnames and Traffic Manager names
+func uniqueID(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 4)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return hex.EncodeToString(b)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,109 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/annotations"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/dnsendpoint"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestProfileLifecycle drives a weighted profile with two endpoints through create,
+// weight update, failover and delete, checking Azure after each step
+func TestProfileLifecycle(t *testing.T) {
+	e := newEnv(t)
+
+	vanity := e.hostname("app")
+	profileName := e.profileName(vanity)
+	e.cleanupProfile(profileName)
+
+	east := e.endpoint(e.hostname("app-east"), vanity, "east", "203.0.113.10", nil)
+	west := e.endpoint(e.hostname("app-west"), vanity, "west", "203.0.113.20", nil)
+
+	t.Run("create", func(t *testing.T) {
+		e.apply(&provider.Changes{Create: []*provider.Endpoint{east, west}})
+
+		profile, err := e.client.GetProfileState(e.ctx, resourceGroup, profileName)
+		require.NoError(t, err)
+		assert.Equal(t, "Weighted", profile.RoutingMethod)
+		assert.Equal(t, vanity, profile.Tags["hostname"])
+		require.Len(t, profile.Endpoints, 2)
+		assert.Equal(t, int64(50), profile.Endpoints["east"].Weight)
+		assert.Equal(t, int64(50), profile.Endpoints["west"].Weight)
+
+		records, err := e.provider.Records(e.ctx)
+		require.NoError(t, err)
+		assert.True(t, hasRecord(records, vanity), "vanity hostname should be returned from Records")
+
+		managed, err := e.provider.ManagedDNSEndpoints(e.ctx)
+		require.NoError(t, err)
+		assert.True(t, hasDNSEndpoint(managed, vanity), "DNSEndpoint should be created for the vanity hostname")
+	})
+
+	t.Run("update weight", func(t *testing.T) {
+		updated := e.endpoint(east.DNSName, vanity, "east", "203.0.113.10", map[string]string{
+			annotations.AnnotationWeight: "80",
+		})
+		e.apply(&provider.Changes{UpdateOld: []*provider.Endpoint{east}, UpdateNew: []*provider.Endpoint{updated}})
+		east = updated
+
+		profile, err := e.client.GetProfileState(e.ctx, resourceGroup, profileName)
+		require.NoError(t, err)
+		assert.Equal(t, int64(80), profile.Endpoints["east"].Weight)
+		assert.Equal(t, int64(50), profile.Endpoints["west"].Weight)
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		disabled := e.endpoint(east.DNSName, vanity, "east", "203.0.113.10", map[string]string{
+			annotations.AnnotationWeight:         "80",
+			annotations.AnnotationEndpointStatus: "Disabled",
+		})
+		e.apply(&provider.Changes{UpdateOld: []*provider.Endpoint{east}, UpdateNew: []*provider.Endpoint{disabled}})
+		east = disabled
+
+		profile, err := e.client.GetProfileState(e.ctx, resourceGroup, profileName)
+		require.NoError(t, err)
+		assert.Equal(t, "Disabled", profile.Endpoints["east"].Status)
+		assert.Equal(t, "Enabled", profile.Endpoints["west"].Status, "traffic should fail over to west")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		e.apply(&provider.Changes{Delete: []*provider.Endpoint{east}})
+
+		profile, err := e.client.GetProfileState(e.ctx, resourceGroup, profileName)
+		require.NoError(t, err)
+		assert.Len(t, profile.Endpoints, 1, "profile should remain while west is still published")
+
+		e.apply(&provider.Changes{Delete: []*provider.Endpoint{west}})
+
+		_, err = e.client.GetProfileState(e.ctx, resourceGroup, profileName)
+		assert.True(t, trafficmanager.IsNotFound(err), "profile should be deleted with its last endpoint, got %v", err)
+
+		managed, err := e.provider.ManagedDNSEndpoints(e.ctx)
+		require.NoError(t, err)
+		assert.False(t, hasDNSEndpoint(managed, vanity), "DNSEndpoint should be deleted with the profile")
+	})
+}
+
+func hasRecord(records []*provider.Endpoint, dnsName string) bool {
+	for _, record := range records {
+		if record.DNSName == dnsName {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDNSEndpoint(managed []dnsendpoint.ManagedEndpoint, hostname string) bool {
+	for _, endpoint := range managed {
+		if endpoint.Hostname == hostname {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,483 @@
+// Package fakeazure is an in-memory Azure Resource Manager serving the Traffic Manager API, so the
+// webhook can be run end to end without a subscription. It keeps profiles and their endpoints as
+// Azure would return them, with ETags, and records every request it serves.
+package fakeazure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+)
+
+const (
+	profileType = "Microsoft.Network/trafficManagerProfiles"
+
+	// fqdnSuffix is the zone Azure serves profiles' relative names in
+	fqdnSuffix = ".trafficmanager.net"
+)
+
+// Request is a request the fake served
+type Request struct {
+	Method string
+	Path   string
+}
+
+// Server is the fake Azure Resource Manager. Use it as the Transport of the webhook's
+// trafficmanager.ClientOptions, or serve it over HTTP with httptest.
+type Server struct {
+	mu       sync.Mutex
+	profiles map[string]*storedProfile // By lower-cased subscription, resource group and name, as ARM ignores case
+	etags    int
+	requests []Request
+
+	// Actions granted by resource group, keyed like profiles. A resource group without an entry grants every action.
+	permissions map[string][]string
+}
+
+type storedProfile struct {
+	subscriptionID string
+	resourceGroup  string
+	profile        armtrafficmanager.Profile
+	etag           string
+}
+
+// New returns a fake with no profiles
+func New() *Server {
+	return &Server{profiles: make(map[string]*storedProfile)}
+}
+
+// Do serves req in memory, implementing policy.Transporter
+func (s *Server) Do(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+// ServeHTTP serves the Traffic Manager API
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path})
+
+	// /subscriptions/{sub}/resourceGroups/{rg}/providers/Microsoft.Network/trafficmanagerprofiles/{name}/{endpointType}/{endpointName}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(segments) >= 3 && strings.EqualFold(segments[len(segments)-1], "checkTrafficManagerNameAvailability"),
+		len(segments) >= 3 && strings.EqualFold(segments[len(segments)-1], "checkTrafficManagerNameAvailabilityV2"):
+		s.checkNameAvailability(w, r)
+	case len(segments) == 5 && strings.EqualFold(segments[4], "trafficmanagerprofiles"):
+		s.listProfiles(w, segments[1], "")
+	case len(segments) == 7 && strings.EqualFold(segments[6], "permissions"):
+		s.servePermissions(w, segments[1], segments[3])
+	case len(segments) == 7 && strings.EqualFold(segments[6], "trafficmanagerprofiles"):
+		s.listProfiles(w, segments[1], segments[3])
+	case len(segments) == 8:
+		s.serveProfile(w, r, segments[1], segments[3], segments[7])
+	case len(segments) == 10 && strings.EqualFold(segments[8], "heatMaps"):
+		writeError(w, http.StatusNotFound, "NotFound", "No heat map has been generated for the profile yet")
+	case len(segments) == 10:
+		s.serveEndpoint(w, r, segments[1], segments[3], segments[7], segments[8], segments[9])
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", fmt.Sprintf("%s %s isn't served by the fake", r.Method, r.URL.Path))
+	}
+}
+
+// AddProfile stores profile as if it had been created in Azure, e.g. by another tool
+func (s *Server) AddProfile(subscriptionID, resourceGroup string, profile armtrafficmanager.Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store(subscriptionID, resourceGroup, *profile.Name, copyProfile(profile))
+}
+
+// SetPermissions sets the actions the caller is granted on a resource group, which is every action until set
+func (s *Server) SetPermissions(subscriptionID, resourceGroup string, actions ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.permissions == nil {
+		s.permissions = make(map[string][]string)
+	}
+	s.permissions[key(subscriptionID, resourceGroup, "")] = actions
+}
+
+// Profile returns a copy of a profile, or nil if it doesn't exist
+func (s *Server) Profile(subscriptionID, resourceGroup, name string) *armtrafficmanager.Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.profiles[key(subscriptionID, resourceGroup, name)]
+	if !ok {
+		return nil
+	}
+	profile := copyProfile(stored.profile)
+	return &profile
+}
+
+// ProfileNames returns the names of all profiles, sorted
+func (s *Server) ProfileNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.profiles))
+	for _, stored := range s.profiles {
+		names = append(names, *stored.profile.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Requests returns the requests served so far
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Writes returns how many PUT, PATCH and DELETE requests were served
+func (s *Server) Writes() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writes := 0
+	for _, req := range s.requests {
+		if req.Method == http.MethodPut || req.Method == http.MethodPatch || req.Method == http.MethodDelete {
+			writes++
+		}
+	}
+	return writes
+}
+
+// servePermissions answers Microsoft.Authorization/permissions with the caller's actions on a resource group
+func (s *Server) servePermissions(w http.ResponseWriter, subscriptionID, resourceGroup string) {
+	actions, ok := s.permissions[key(subscriptionID, resourceGroup, "")]
+	if !ok {
+		actions = []string{"*"}
+	}
+	writeJSON(w, http.StatusOK, "", map[string]any{
+		"value": []map[string]any{{"actions": actions, "notActions": []string{}}},
+	})
+}
+
+func (s *Server) listProfiles(w http.ResponseWriter, subscriptionID, resourceGroup string) {
+	keys := make([]string, 0, len(s.profiles))
+	for k, stored := range s.profiles {
+		if strings.EqualFold(stored.subscriptionID, subscriptionID) && (resourceGroup == "" || strings.EqualFold(stored.resourceGroup, resourceGroup)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	list := armtrafficmanager.ProfileListResult{Value: make([]*armtrafficmanager.Profile, 0, len(keys))}
+	for _, k := range keys {
+		profile := copyProfile(s.profiles[k].profile)
+		list.Value = append(list.Value, &profile)
+	}
+	writeJSON(w, http.StatusOK, "", list)
+}
+
+func (s *Server) serveProfile(w http.ResponseWriter, r *http.Request, subscriptionID, resourceGroup, name string) {
+	k := key(subscriptionID, resourceGroup, name)
+	stored, exists := s.profiles[k]
+	if exists && !matchesETag(r, stored.etag) {
+		writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", "The profile was changed since it was read")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if !exists {
+			writeProfileNotFound(w, name)
+			return
+		}
+		writeJSON(w, http.StatusOK, stored.etag, stored.profile)
+
+	case http.MethodPut:
+		var profile armtrafficmanager.Profile
+		if !decode(w, r, &profile) {
+			return
+		}
+		if profile.Properties == nil {
+			profile.Properties = &armtrafficmanager.ProfileProperties{}
+		}
+		if profile.Properties.DNSConfig == nil {
+			profile.Properties.DNSConfig = &armtrafficmanager.DNSConfig{}
+		}
+		if exists {
+			// Endpoints and the relative name are kept when a replacement leaves them out
+			if profile.Properties.Endpoints == nil {
+				profile.Properties.Endpoints = stored.profile.Properties.Endpoints
+			}
+			if profile.Properties.DNSConfig.RelativeName == nil {
+				profile.Properties.DNSConfig.RelativeName = stored.profile.Properties.DNSConfig.RelativeName
+			}
+		}
+		if relativeName := profile.Properties.DNSConfig.RelativeName; relativeName != nil && s.relativeNameTaken(*relativeName, k) {
+			writeError(w, http.StatusConflict, "DnsNameAlreadyInUse", fmt.Sprintf("The relative DNS name %s is already in use", *relativeName))
+			return
+		}
+		status := http.StatusCreated
+		if exists {
+			status = http.StatusOK
+		}
+		stored = s.store(subscriptionID, resourceGroup, name, profile)
+		writeJSON(w, status, stored.etag, stored.profile)
+
+	case http.MethodPatch:
+		if !exists {
+			writeProfileNotFound(w, name)
+			return
+		}
+		var patch armtrafficmanager.Profile
+		if !decode(w, r, &patch) {
+			return
+		}
+		profile := copyProfile(stored.profile)
+		if patch.Tags != nil {
+			profile.Tags = patch.Tags
+		}
+		if patch.Properties != nil && patch.Properties.ProfileStatus != nil {
+			profile.Properties.ProfileStatus = patch.Properties.ProfileStatus
+		}
+		if patch.Properties != nil && patch.Properties.TrafficViewEnrollmentStatus != nil {
+			profile.Properties.TrafficViewEnrollmentStatus = patch.Properties.TrafficViewEnrollmentStatus
+		}
+		stored = s.store(subscriptionID, resourceGroup, name, profile)
+		writeJSON(w, http.StatusOK, stored.etag, stored.profile)
+
+	case http.MethodDelete:
+		if !exists {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		delete(s.profiles, k)
+		writeJSON(w, http.StatusOK, "", armtrafficmanager.DeleteOperationResult{})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" isn't supported on profiles")
+	}
+}
+
+func (s *Server) serveEndpoint(w http.ResponseWriter, r *http.Request, subscriptionID, resourceGroup, profileName, endpointType, name string) {
+	stored, ok := s.profiles[key(subscriptionID, resourceGroup, profileName)]
+	if !ok {
+		writeProfileNotFound(w, profileName)
+		return
+	}
+	endpoints := stored.profile.Properties.Endpoints
+	index := -1
+	for i, endpoint := range endpoints {
+		if strings.EqualFold(*endpoint.Name, name) && strings.EqualFold(endpointTypeName(endpoint), endpointType) {
+			index = i
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if index < 0 {
+			writeEndpointNotFound(w, name)
+			return
+		}
+		writeJSON(w, http.StatusOK, "", endpoints[index])
+
+	case http.MethodPut:
+		var endpoint armtrafficmanager.Endpoint
+		if !decode(w, r, &endpoint) {
+			return
+		}
+		endpoint.Name = &name
+		endpoint.Type = to(profileType + "/" + strings.ToLower(endpointType[:1]) + endpointType[1:])
+		profile := copyProfile(stored.profile)
+		status := http.StatusCreated
+		if index >= 0 {
+			profile.Properties.Endpoints[index] = &endpoint
+			status = http.StatusOK
+		} else {
+			profile.Properties.Endpoints = append(profile.Properties.Endpoints, &endpoint)
+		}
+		stored = s.store(subscriptionID, resourceGroup, profileName, profile)
+		for _, written := range stored.profile.Properties.Endpoints {
+			if strings.EqualFold(*written.Name, name) {
+				writeJSON(w, status, "", written)
+			}
+		}
+
+	case http.MethodDelete:
+		if index < 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		profile := copyProfile(stored.profile)
+		profile.Properties.Endpoints = append(profile.Properties.Endpoints[:index], profile.Properties.Endpoints[index+1:]...)
+		s.store(subscriptionID, resourceGroup, profileName, profile)
+		writeJSON(w, http.StatusOK, "", armtrafficmanager.DeleteOperationResult{})
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method+" isn't supported on endpoints")
+	}
+}
+
+func (s *Server) checkNameAvailability(w http.ResponseWriter, r *http.Request) {
+	var params armtrafficmanager.CheckTrafficManagerRelativeDNSNameAvailabilityParameters
+	if !decode(w, r, &params) {
+		return
+	}
+	available := params.Name == nil || !s.relativeNameTaken(*params.Name, "")
+	result := armtrafficmanager.NameAvailability{Name: params.Name, Type: params.Type, NameAvailable: &available}
+	if !available {
+		result.Reason = to("AlreadyExists")
+		result.Message = to(fmt.Sprintf("The relative DNS name %s is already in use", *params.Name))
+	}
+	writeJSON(w, http.StatusOK, "", result)
+}
+
+// relativeNameTaken reports whether a profile other than the one stored at except uses relativeName
+func (s *Server) relativeNameTaken(relativeName, except string) bool {
+	for k, stored := range s.profiles {
+		dns := stored.profile.Properties.DNSConfig
+		if k != except && dns != nil && dns.RelativeName != nil && strings.EqualFold(*dns.RelativeName, relativeName) {
+			return true
+		}
+	}
+	return false
+}
+
+// store saves profile with the fields Azure fills in, and a new ETag
+func (s *Server) store(subscriptionID, resourceGroup, name string, profile armtrafficmanager.Profile) *storedProfile {
+	id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/%s/%s", subscriptionID, resourceGroup, profileType, name)
+	profile.ID = &id
+	profile.Name = &name
+	profile.Type = to(profileType)
+	if profile.Properties == nil {
+		profile.Properties = &armtrafficmanager.ProfileProperties{}
+	}
+	properties := profile.Properties
+	if properties.DNSConfig == nil {
+		properties.DNSConfig = &armtrafficmanager.DNSConfig{}
+	}
+	if properties.DNSConfig.RelativeName == nil {
+		properties.DNSConfig.RelativeName = to(strings.ToLower(name))
+	}
+	properties.DNSConfig.Fqdn = to(strings.ToLower(*properties.DNSConfig.RelativeName) + fqdnSuffix)
+	if properties.ProfileStatus == nil {
+		status := armtrafficmanager.ProfileStatusEnabled
+		properties.ProfileStatus = &status
+	}
+	if properties.Endpoints == nil {
+		properties.Endpoints = []*armtrafficmanager.Endpoint{}
+	}
+	for _, endpoint := range properties.Endpoints {
+		endpoint.ID = to(id + "/" + endpointTypeName(endpoint) + "/" + *endpoint.Name)
+		if endpoint.Properties == nil {
+			endpoint.Properties = &armtrafficmanager.EndpointProperties{}
+		}
+		if endpoint.Properties.EndpointStatus == nil {
+			status := armtrafficmanager.EndpointStatusEnabled
+			endpoint.Properties.EndpointStatus = &status
+		}
+		// Endpoints are healthy as soon as they are enabled; Azure would probe them first
+		monitorStatus := armtrafficmanager.EndpointMonitorStatusOnline
+		if *endpoint.Properties.EndpointStatus == armtrafficmanager.EndpointStatusDisabled || *properties.ProfileStatus == armtrafficmanager.ProfileStatusDisabled {
+			monitorStatus = armtrafficmanager.EndpointMonitorStatusDisabled
+		}
+		endpoint.Properties.EndpointMonitorStatus = &monitorStatus
+	}
+
+	s.etags++
+	stored := &storedProfile{
+		subscriptionID: subscriptionID,
+		resourceGroup:  resourceGroup,
+		profile:        profile,
+		etag:           `W/"` + strconv.Itoa(s.etags) + `"`,
+	}
+	s.profiles[key(subscriptionID, resourceGroup, name)] = stored
+	return stored
+}
+
+// Credential is a TokenCredential handing out a static token, for use with Server
+type Credential struct{}
+
+// GetToken returns a token valid for an hour
+func (Credential) GetToken(context.Context, policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "fake-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func key(subscriptionID, resourceGroup, name string) string {
+	return strings.ToLower(subscriptionID + "/" + resourceGroup + "/" + name)
+}
+
+// endpointTypeName returns the path segment of an endpoint's type, e.g. externalEndpoints
+func endpointTypeName(endpoint *armtrafficmanager.Endpoint) string {
+	if endpoint.Type == nil {
+		return "externalEndpoints"
+	}
+	return (*endpoint.Type)[strings.LastIndex(*endpoint.Type, "/")+1:]
+}
+
+// matchesETag reports whether r's If-Match header, if any, is etag
+func matchesETag(r *http.Request, etag string) bool {
+	ifMatch := r.Header.Get("If-Match")
+	return ifMatch == "" || ifMatch == "*" || ifMatch == etag
+}
+
+// copyProfile deep copies a profile through its JSON form
+func copyProfile(profile armtrafficmanager.Profile) armtrafficmanager.Profile {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		panic(err)
+	}
+	var copied armtrafficmanager.Profile
+	if err := json.Unmarshal(data, &copied); err != nil {
+		panic(err)
+	}
+	return copied
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidRequestContent", err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, etag string, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
+
+func writeProfileNotFound(w http.ResponseWriter, name string) {
+	writeError(w, http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("The Resource '%s/%s' was not found", profileType, name))
+}
+
+func writeEndpointNotFound(w http.ResponseWriter, name string) {
+	writeError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("The endpoint %s was not found", name))
+}
+
+func to[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,79 @@
+package fakeazure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/trafficmanager/armtrafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newProfilesClient(t *testing.T, s *Server) *armtrafficmanager.ProfilesClient {
+	client, err := armtrafficmanager.NewProfilesClient("sub", Credential{}, &arm.ClientOptions{
+		ClientOptions: policy.ClientOptions{Transport: s, Retry: policy.RetryOptions{MaxRetries: -1}},
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func responseStatus(t *testing.T, err error) int {
+	t.Helper()
+	var respErr *azcore.ResponseError
+	require.True(t, errors.As(err, &respErr), "expected a response error, got %v", err)
+	return respErr.StatusCode
+}
+
+func TestServer_Profiles(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	client := newProfilesClient(t, s)
+
+	profile := armtrafficmanager.Profile{
+		Location: to("global"),
+		Properties: &armtrafficmanager.ProfileProperties{
+			DNSConfig: &armtrafficmanager.DNSConfig{RelativeName: to("app")},
+		},
+	}
+	created, err := client.CreateOrUpdate(ctx, "rg", "app-tm", profile, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "app.trafficmanager.net", *created.Properties.DNSConfig.Fqdn)
+	assert.Equal(t, armtrafficmanager.ProfileStatusEnabled, *created.Properties.ProfileStatus)
+	assert.Equal(t, []string{"app-tm"}, s.ProfileNames())
+
+	_, err = client.CreateOrUpdate(ctx, "rg", "other-tm", profile, nil)
+	assert.Equal(t, http.StatusConflict, responseStatus(t, err), "relative names are unique")
+
+	_, err = client.Get(ctx, "rg", "missing-tm", nil)
+	assert.Equal(t, http.StatusNotFound, responseStatus(t, err))
+
+	assert.Equal(t, 2, s.Writes(), "rejected writes are counted too")
+}
+
+func TestServer_IfMatch(t *testing.T) {
+	s := New()
+	s.AddProfile("sub", "rg", armtrafficmanager.Profile{Name: to("app-tm"), Properties: &armtrafficmanager.ProfileProperties{}})
+	etag := s.profiles[key("sub", "rg", "app-tm")].etag
+
+	send := func(ifMatch string) int {
+		req, err := http.NewRequest(http.MethodPatch,
+			"https://management.azure.com/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/trafficmanagerprofiles/app-tm",
+			strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := s.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusPreconditionFailed, send(`W/"stale"`))
+	assert.Equal(t, http.StatusOK, send(etag))
+	assert.Equal(t, http.StatusPreconditionFailed, send(etag), "the update changes the ETag")
+}
@@ -0,0 +1,183 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The External DNS webhook provider specification, as the webhook client in External DNS
+// implements it: every request carries the versioned media type, GET / answers with the domain
+// filter, GET /records and POST /adjustendpoints answer with a bare endpoint array, and
+// POST /records answers 204 with no body. External DNS rejects responses that don't match.
+
+// endpointJSON is an endpoint as External DNS serializes it
+const endpointJSON = `{
+	"dnsName": "app-east.example.com",
+	"targets": ["203.0.113.10"],
+	"recordType": "A",
+	"recordTTL": 30,
+	"labels": {"resource": "service/default/app-east"},
+	"providerSpecific": [
+		{"name": "webhook/traffic-manager-enabled", "value": "true"},
+		{"name": "webhook/traffic-manager-hostname", "value": "app.example.com"},
+		{"name": "webhook/traffic-manager-profile-name", "value": "app-tm"},
+		{"name": "webhook/traffic-manager-resource-group", "value": "tm-rg"},
+		{"name": "webhook/traffic-manager-endpoint-name", "value": "east"},
+		{"name": "webhook/traffic-manager-endpoint-location", "value": "westeurope"},
+		{"name": "webhook/traffic-manager-routing-method", "value": "Weighted"},
+		{"name": "webhook/traffic-manager-weight", "value": "50"}
+	]
+}`
+
+// do sends a request with the given Accept and Content-Type headers, omitting empty ones,
+// and returns the response with its body read
+func (h *harness) do(method, path, accept, contentType, body string) (*http.Response, []byte) {
+	h.t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(h.ctx, method, h.url+path, reader)
+	require.NoError(h.t, err)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(h.t, err)
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(h.t, err)
+	return resp, respBody
+}
+
+// requireEndpointArray checks a response is a JSON array of endpoints with the fields External
+// DNS requires, and returns it
+func requireEndpointArray(t *testing.T, resp *http.Response, body []byte) []map[string]json.RawMessage {
+	t.Helper()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode, "%s", body)
+	assert.Equal(t, mediaType, resp.Header.Get("Content-Type"))
+	require.True(t, strings.HasPrefix(strings.TrimSpace(string(body)), "["), "expected a bare JSON array, got %s", body)
+
+	var endpoints []map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &endpoints))
+	for _, endpoint := range endpoints {
+		for _, field := range []string{"dnsName", "targets", "recordType"} {
+			assert.Contains(t, endpoint, field, "endpoint %s", body)
+		}
+	}
+	return endpoints
+}
+
+func TestConformance_Negotiate(t *testing.T) {
+	h := newHarness(t)
+
+	resp, body := h.do(http.MethodGet, "/", mediaType, "", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, "%s", body)
+	assert.Equal(t, mediaType, resp.Header.Get("Content-Type"))
+
+	// External DNS decodes the body directly as its domain filter
+	var filter struct {
+		Include []string `json:"include"`
+		Exclude []string `json:"exclude"`
+	}
+	require.NoError(t, json.Unmarshal(body, &filter))
+	assert.Equal(t, []string{"example.com"}, filter.Include)
+}
+
+func TestConformance_Records(t *testing.T) {
+	h := newHarness(t)
+
+	t.Run("empty", func(t *testing.T) {
+		resp, body := h.do(http.MethodGet, "/records", mediaType, "", "")
+		assert.Empty(t, requireEndpointArray(t, resp, body))
+	})
+
+	t.Run("apply", func(t *testing.T) {
+		resp, body := h.do(http.MethodPost, "/records", mediaType, mediaType, `{"create": [`+endpointJSON+`]}`)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "%s", body)
+		assert.Empty(t, body)
+	})
+
+	t.Run("apply with External DNS field names", func(t *testing.T) {
+		// plan.Changes has no JSON tags, so External DNS sends capitalized keys
+		changes := `{"Create": [], "UpdateOld": [], "UpdateNew": [], "Delete": []}`
+		resp, body := h.do(http.MethodPost, "/records", mediaType, mediaType, changes)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode, "%s", body)
+	})
+
+	t.Run("managed", func(t *testing.T) {
+		resp, body := h.do(http.MethodGet, "/records", mediaType, "", "")
+		endpoints := requireEndpointArray(t, resp, body)
+		require.NotEmpty(t, endpoints)
+		assert.JSONEq(t, `"app.example.com"`, string(endpoints[0]["dnsName"]))
+	})
+}
+
+func TestConformance_AdjustEndpoints(t *testing.T) {
+	h := newHarness(t)
+
+	t.Run("endpoints", func(t *testing.T) {
+		resp, body := h.do(http.MethodPost, "/adjustendpoints", mediaType, mediaType, `[`+endpointJSON+`]`)
+		endpoints := requireEndpointArray(t, resp, body)
+		require.Len(t, endpoints, 1)
+		assert.JSONEq(t, `"app-east.example.com"`, string(endpoints[0]["dnsName"]))
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		resp, body := h.do(http.MethodPost, "/adjustendpoints", mediaType, mediaType, `[]`)
+		assert.Empty(t, requireEndpointArray(t, resp, body))
+	})
+}
+
+// TestConformance_Errors checks requests External DNS would never send are refused with the
+// status code the specification gives, and a JSON error body
+func TestConformance_Errors(t *testing.T) {
+	h := newHarness(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		accept      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"unsupported version", http.MethodGet, "/records", "application/external.dns.webhook+json;version=2", "", "", http.StatusNotAcceptable},
+		{"unsupported accept", http.MethodGet, "/", "text/plain", "", "", http.StatusNotAcceptable},
+		{"unsupported content type", http.MethodPost, "/records", mediaType, "text/plain", "{}", http.StatusUnsupportedMediaType},
+		{"negotiate method", http.MethodPost, "/", mediaType, mediaType, "{}", http.StatusMethodNotAllowed},
+		{"records method", http.MethodDelete, "/records", mediaType, "", "", http.StatusMethodNotAllowed},
+		{"adjust method", http.MethodGet, "/adjustendpoints", mediaType, "", "", http.StatusMethodNotAllowed},
+		{"malformed changes", http.MethodPost, "/records", mediaType, mediaType, `{"create": `, http.StatusBadRequest},
+		{"malformed endpoints", http.MethodPost, "/adjustendpoints", mediaType, mediaType, `{"dnsName": 1}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := h.do(tt.method, tt.path, tt.accept, tt.contentType, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode, "%s", body)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+			var errResp struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			require.NoError(t, json.Unmarshal(body, &errResp), "%s", body)
+			assert.NotEmpty(t, errResp.Code)
+			assert.NotEmpty(t, errResp.Message)
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/dnsendpoint"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/middleware"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/provider"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/state"
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/sam-cogan/external-dns-traffic-manager/test/fakeazure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const (
+	subscriptionID = "00000000-0000-0000-0000-000000000000"
+	resourceGroup  = "tm-rg"
+
+	// mediaType is sent by External DNS on every webhook request
+	mediaType = "application/external.dns.webhook+json;version=1"
+)
+
+// recording is a sequence of webhook requests captured from External DNS
+type recording struct {
+	Description string            `json:"description"`
+	Requests    []recordedRequest `json:"requests"`
+}
+
+type recordedRequest struct {
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Body     json.RawMessage `json:"body,omitempty"`
+	Status   int             `json:"status"`             // Status the webhook must answer with
+	Contains []string        `json:"contains,omitempty"` // Text the response body must contain
+}
+
+// harness is the webhook served over HTTP, backed by the fake Azure and a fake Kubernetes API
+type harness struct {
+	t        *testing.T
+	ctx      context.Context
+	azure    *fakeazure.Server
+	provider *provider.TrafficManagerProvider
+	client   *trafficmanager.Client
+	url      string
+}
+
+// newHarness starts a webhook server configured as the webhook sidecar of External DNS would be
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	logger := zaptest.NewLogger(t, zaptest.Level(zap.WarnLevel))
+	azure := fakeazure.New()
+	options := trafficmanager.ClientOptions{Transport: azure}
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{dnsendpoint.DNSEndpointGVR(): "DNSEndpointList"})
+	dynamicClient.PrependReactor("patch", "dnsendpoints", applyReactor(dynamicClient.Tracker()))
+
+	p, err := provider.NewTrafficManagerProvider(&provider.Config{
+		SubscriptionID: subscriptionID,
+		Credential:     fakeazure.Credential{},
+		ClientOptions:  options,
+		ResourceGroups: []string{resourceGroup},
+		DomainFilter:   []string{"example.com"},
+		ClusterName:    "replay",
+	}, dynamicClient, logger)
+	require.NoError(t, err)
+
+	client, err := trafficmanager.NewClient(subscriptionID, fakeazure.Credential{}, options, logger.Named("check"))
+	require.NoError(t, err)
+
+	// The routes of the webhook port, as cmd/webhook serves them
+	webhookServer := provider.NewWebhookServer(p, logger.Named("webhook"))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", webhookServer.HandleNegotiate)
+	mux.HandleFunc("/records", webhookServer.HandleRecords)
+	mux.HandleFunc("/adjustendpoints", webhookServer.HandleAdjustEndpoints)
+	mux.HandleFunc("/plan", webhookServer.HandlePlan)
+	server := httptest.NewServer(middleware.Wrap(mux, logger.Named("http")))
+	t.Cleanup(server.Close)
+
+	return &harness{t: t, ctx: context.Background(), azure: azure, provider: p, client: client, url: server.URL}
+}
+
+// applyReactor stores server-side applied DNSEndpoints, which the fake dynamic client only
+// accepts for objects that already exist
+func applyReactor(tracker k8stesting.ObjectTracker) k8stesting.ReactionFunc {
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal(patch.GetPatch(), &obj.Object); err != nil {
+			return true, nil, err
+		}
+		gvr := patch.GetResource()
+		if _, err := tracker.Get(gvr, patch.GetNamespace(), patch.GetName()); apierrors.IsNotFound(err) {
+			return true, obj, tracker.Create(gvr, obj, patch.GetNamespace())
+		}
+		return true, obj, tracker.Update(gvr, obj, patch.GetNamespace())
+	}
+}
+
+// replay sends the requests recorded in testdata/<name>.json in order, checking each response
+func (h *harness) replay(name string) {
+	h.t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	require.NoError(h.t, err)
+	var rec recording
+	require.NoError(h.t, json.Unmarshal(data, &rec))
+
+	for i, recorded := range rec.Requests {
+		var body io.Reader
+		if len(recorded.Body) > 0 {
+			body = strings.NewReader(string(recorded.Body))
+		}
+		req, err := http.NewRequestWithContext(h.ctx, recorded.Method, h.url+recorded.Path, body)
+		require.NoError(h.t, err)
+		req.Header.Set("Accept", mediaType)
+		if body != nil {
+			req.Header.Set("Content-Type", mediaType)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(h.t, err)
+		respBody, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(h.t, err)
+
+		step := name + " request " + recorded.Method + " " + recorded.Path
+		require.Equal(h.t, recorded.Status, resp.StatusCode, "%s (#%d): %s", step, i+1, respBody)
+		for _, want := range recorded.Contains {
+			assert.Contains(h.t, string(respBody), want, "%s (#%d)", step, i+1)
+		}
+	}
+}
+
+// profile reads a profile from the fake Azure, failing the test if it doesn't exist
+func (h *harness) profile(name string) *state.ProfileState {
+	h.t.Helper()
+	profile, err := h.client.GetProfileState(h.ctx, resourceGroup, name)
+	require.NoError(h.t, err)
+	return profile
+}
+
+// hasDNSEndpoint reports whether a DNSEndpoint publishes the vanity hostname
+func (h *harness) hasDNSEndpoint(hostname string) bool {
+	h.t.Helper()
+	managed, err := h.provider.ManagedDNSEndpoints(h.ctx)
+	require.NoError(h.t, err)
+	for _, m := range managed {
+		if m.Hostname == hostname {
+			return true
+		}
+	}
+	return false
+}
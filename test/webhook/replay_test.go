@@ -0,0 +1,72 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/sam-cogan/external-dns-traffic-manager/pkg/trafficmanager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReplay_Lifecycle replays External DNS publishing a weighted vanity hostname, changing
+// its weights, failing over and removing it, checking Azure after each sequence
+func TestReplay_Lifecycle(t *testing.T) {
+	h := newHarness(t)
+
+	t.Run("create", func(t *testing.T) {
+		h.replay("create")
+
+		profile := h.profile("app-tm")
+		assert.Equal(t, "Weighted", profile.RoutingMethod)
+		assert.Equal(t, "app.example.com", profile.Tags["hostname"])
+		require.Len(t, profile.Endpoints, 2)
+		assert.Equal(t, int64(50), profile.Endpoints["east"].Weight)
+		assert.Equal(t, "app-west.example.com", profile.Endpoints["west"].Target)
+		assert.True(t, h.hasDNSEndpoint("app.example.com"), "DNSEndpoint should be created for the vanity hostname")
+	})
+
+	t.Run("update", func(t *testing.T) {
+		h.replay("update")
+
+		profile := h.profile("app-tm")
+		assert.Equal(t, int64(80), profile.Endpoints["east"].Weight)
+		assert.Equal(t, int64(50), profile.Endpoints["west"].Weight)
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		h.replay("failover")
+
+		profile := h.profile("app-tm")
+		assert.Equal(t, "Disabled", profile.Endpoints["east"].Status)
+		assert.Equal(t, "Enabled", profile.Endpoints["west"].Status, "traffic should fail over to west")
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		h.replay("delete")
+
+		_, err := h.client.GetProfileState(h.ctx, resourceGroup, "app-tm")
+		assert.True(t, trafficmanager.IsNotFound(err), "profile should be deleted with its last endpoint, got %v", err)
+		assert.False(t, h.hasDNSEndpoint("app.example.com"), "DNSEndpoint should be deleted with the profile")
+	})
+}
+
+// TestReplay_InvalidRecord replays a batch with one invalid record: it is reported and the rest of
+// the batch still reaches Azure
+func TestReplay_InvalidRecord(t *testing.T) {
+	h := newHarness(t)
+	h.replay("invalid")
+
+	assert.Equal(t, []string{"app-tm"}, h.azure.ProfileNames(), "only the valid record's profile is created")
+	assert.Len(t, h.profile("app-tm").Endpoints, 1)
+}
+
+// TestReplay_RecordsAreReadOnly checks that polling records, as External DNS does every interval,
+// doesn't write to Azure
+func TestReplay_RecordsAreReadOnly(t *testing.T) {
+	h := newHarness(t)
+	h.replay("create")
+	writes := h.azure.Writes()
+
+	h.replay("poll")
+	assert.Equal(t, writes, h.azure.Writes())
+}